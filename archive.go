@@ -0,0 +1,130 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+)
+
+// archiveIndex holds infos of regular files and directories of an archive by
+// their paths.
+type archiveIndex struct {
+	files map[string]*memFileInfo
+	dirs  map[string]*archiveDir
+}
+
+// archiveDir is a directory with sorted entries.
+type archiveDir struct {
+	info    *memFileInfo
+	entries []fs.DirEntry
+}
+
+func newArchiveIndex() *archiveIndex {
+	return &archiveIndex{
+		files: make(map[string]*memFileInfo),
+		dirs: map[string]*archiveDir{
+			".": {info: &memFileInfo{name: ".", mode: fs.ModeDir | 0o555}},
+		},
+	}
+}
+
+// add adds a regular file or a directory, depending on the mode of info, to
+// the index. The name must be a valid path other than ".".
+func (x *archiveIndex) add(name string, info *memFileInfo) {
+	if info.mode.IsDir() {
+		x.dirs[name] = &archiveDir{info: info}
+		return
+	}
+	x.files[name] = info
+}
+
+// finish adds implicit parent directories with 0o555 permissions and a zero
+// modification time and populates sorted directory entries. Directories take
+// precedence over regular files with the same name. It must be called after
+// all files are added.
+func (x *archiveIndex) finish() {
+	names := make([]string, 0, len(x.files)+len(x.dirs))
+	for name := range x.files {
+		names = append(names, name)
+	}
+	for name := range x.dirs {
+		names = append(names, name)
+	}
+	for _, name := range names {
+		for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+			if _, ok := x.dirs[dir]; ok {
+				break
+			}
+			x.dirs[dir] = &archiveDir{info: &memFileInfo{
+				name: path.Base(dir),
+				mode: fs.ModeDir | 0o555,
+			}}
+		}
+	}
+
+	for name, info := range x.files {
+		if _, ok := x.dirs[name]; ok {
+			delete(x.files, name)
+			continue
+		}
+		d := x.dirs[path.Dir(name)]
+		d.entries = append(d.entries, info)
+	}
+	for name, d := range x.dirs {
+		if name == "." {
+			continue
+		}
+		parent := x.dirs[path.Dir(name)]
+		parent.entries = append(parent.entries, d.info)
+	}
+	for _, d := range x.dirs {
+		sort.Slice(d.entries, func(i, j int) bool {
+			return d.entries[i].Name() < d.entries[j].Name()
+		})
+	}
+}
+
+// readDir returns a copy of entries of the directory.
+func (x *archiveIndex) readDir(name string) ([]fs.DirEntry, error) {
+	d, ok := x.dirs[name]
+	if !ok {
+		if _, ok := x.files[name]; ok {
+			return nil, &fs.PathError{Op: "readdir", Path: name, Err: errNotDir}
+		}
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	entries := make([]fs.DirEntry, len(d.entries))
+	copy(entries, d.entries)
+	return entries, nil
+}
+
+// stat returns the info of a regular file or a directory.
+func (x *archiveIndex) stat(name string) (*memFileInfo, error) {
+	if d, ok := x.dirs[name]; ok {
+		return d.info, nil
+	}
+	if info, ok := x.files[name]; ok {
+		return info, nil
+	}
+	return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+// sectionFile is an open file with content in a section of an archive.
+type sectionFile struct {
+	*io.SectionReader
+	info *memFileInfo
+}
+
+func (f *sectionFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *sectionFile) Close() error {
+	return nil
+}
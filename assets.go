@@ -0,0 +1,369 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Assets serves static files with content hashes in their names. It wires
+// HashFS, MimeTypeFS, gzip compression and HTTP caching headers, and provides
+// the manifest of hashed paths and template functions for referencing files
+// in HTML templates.
+type Assets struct {
+	hash   *HashFS
+	mime   *MimeTypeFS
+	served fs.FS
+	o      assetsOptions
+
+	gzipped   map[string][]byte
+	gzippedMu sync.Mutex
+}
+
+// AssetsOption is used to provide optional parameters to NewAssets function.
+type AssetsOption func(*assetsOptions)
+
+type assetsOptions struct {
+	prefix          string
+	hashOpts        []HashFSOption
+	mimeOpts        []MimeTypeFSOption
+	precompress     bool
+	minCompressSize int64
+}
+
+// WithAssetsPrefix sets the URL path prefix under which files are served by
+// the Handler and referenced by the template functions. The default prefix is
+// "/".
+func WithAssetsPrefix(prefix string) AssetsOption {
+	return func(o *assetsOptions) {
+		o.prefix = prefix
+	}
+}
+
+// WithAssetsHashOptions sets options for the HashFS that hashes files.
+func WithAssetsHashOptions(opts ...HashFSOption) AssetsOption {
+	return func(o *assetsOptions) {
+		o.hashOpts = opts
+	}
+}
+
+// WithAssetsMimeTypeOptions sets options for the MimeTypeFS that detects
+// content types of files.
+func WithAssetsMimeTypeOptions(opts ...MimeTypeFSOption) AssetsOption {
+	return func(o *assetsOptions) {
+		o.mimeOpts = opts
+	}
+}
+
+// WithAssetsPrecompression enables gzip compression of text files that are at
+// least minSize bytes large. All such files are compressed by NewAssets and
+// the compressed content is served by the Handler to clients that accept it.
+// Without this option, files are served uncompressed.
+func WithAssetsPrecompression(minSize int64) AssetsOption {
+	return func(o *assetsOptions) {
+		o.precompress = true
+		o.minCompressSize = minSize
+	}
+}
+
+// NewAssets returns a new instance of Assets that serves files from the fsys
+// filesystem hashed by the hasher.
+func NewAssets(fsys fs.FS, hasher Hasher, opts ...AssetsOption) (*Assets, error) {
+	o := assetsOptions{
+		prefix: "/",
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if !strings.HasSuffix(o.prefix, "/") {
+		o.prefix += "/"
+	}
+	if !strings.HasPrefix(o.prefix, "/") {
+		o.prefix = "/" + o.prefix
+	}
+
+	hfs := NewHashFS(fsys, hasher, o.hashOpts...)
+	mfs := NewMimeTypeFS(hfs, o.mimeOpts...)
+	a := &Assets{
+		hash:    hfs,
+		mime:    mfs,
+		served:  SeekableFS(mfs),
+		o:       o,
+		gzipped: make(map[string][]byte),
+	}
+
+	if o.precompress {
+		if err := a.precompress(); err != nil {
+			return nil, fmt.Errorf("precompress: %w", err)
+		}
+	}
+	return a, nil
+}
+
+// FS returns the HashFS with files that are served.
+func (a *Assets) FS() *HashFS {
+	return a.hash
+}
+
+// Path returns the URL path of the named file with the hash in its name and
+// the prefix set by WithAssetsPrefix option. A leading slash in the name is
+// ignored.
+func (a *Assets) Path(name string) (string, error) {
+	p, err := a.hash.HashedPath(strings.TrimPrefix(name, "/"))
+	if err != nil {
+		return "", err
+	}
+	return a.o.prefix + p, nil
+}
+
+// Handler returns a http.Handler that serves files under the prefix. Files
+// requested by names with hashes are served with headers that allow clients
+// to cache them forever. Files requested by names without hashes, if they are
+// accessible by the HashFS options, are served with headers that require
+// revalidation, or redirected to their hashed paths with the
+// UnhashedAccessRedirectInfo mode. Directories are not listed.
+func (a *Assets) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upath := path.Clean("/" + r.URL.Path)
+		if !strings.HasPrefix(upath, a.o.prefix) {
+			http.NotFound(w, r)
+			return
+		}
+		name := strings.TrimPrefix(upath, a.o.prefix)
+		if name == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		f, err := a.served.Open(name)
+		if err != nil {
+			a.serveError(w, r, err)
+			return
+		}
+		defer f.Close()
+
+		info, err := f.Stat()
+		if err != nil {
+			a.serveError(w, r, err)
+			return
+		}
+		if info.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+		content, ok := f.(io.ReadSeeker)
+		if !ok {
+			a.serveError(w, r, &fs.PathError{Op: "seek", Path: name, Err: ErrNotSeekable})
+			return
+		}
+
+		h := w.Header()
+		if typ, err := a.mime.ContentType(name); err == nil {
+			h.Set("Content-Type", typ)
+		}
+		canonicalName, hash, err := a.hash.canonicalName("open", name)
+		if err != nil {
+			a.serveError(w, r, err)
+			return
+		}
+		hashed := hash != "" && canonicalName != name
+		if hashed {
+			h.Set("Cache-Control", "public, max-age=31536000, immutable")
+			h.Set("ETag", `"`+hash+`"`)
+		} else {
+			h.Set("Cache-Control", "no-cache")
+		}
+
+		if a.o.precompress && hash != "" {
+			h.Add("Vary", "Accept-Encoding")
+			if acceptsGzip(r) {
+				data, err := a.compress(a.hash.hashedPath(canonicalName, hash), info.Size(), h.Get("Content-Type"))
+				if err != nil {
+					a.serveError(w, r, err)
+					return
+				}
+				if data != nil {
+					h.Set("Content-Encoding", "gzip")
+					if hashed {
+						h.Set("ETag", `"`+hash+`-gzip"`)
+					}
+					http.ServeContent(w, r, name, info.ModTime(), bytes.NewReader(data))
+					return
+				}
+			}
+		}
+		http.ServeContent(w, r, name, info.ModTime(), content)
+	})
+}
+
+// ManifestJSON returns a JSON object that maps paths of all files to their
+// paths with hashes. Paths are relative to the root of the filesystem, without
+// the prefix.
+func (a *Assets) ManifestJSON() ([]byte, error) {
+	manifest := make(map[string]string)
+	if err := fs.WalkDir(a.hash.fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		hashed, err := a.hash.HashedPath(p)
+		if err != nil {
+			return err
+		}
+		manifest[p] = hashed
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("manifest: %w", err)
+	}
+	return json.Marshal(manifest)
+}
+
+// TemplateFuncs returns template functions as the TemplateFuncs function
+// does, with the assetPath function returning paths returned by the Path
+// method.
+func (a *Assets) TemplateFuncs() template.FuncMap {
+	funcs := TemplateFuncs(a.hash)
+	funcs["assetPath"] = func(name string) (string, error) {
+		p, err := a.Path(name)
+		if err != nil {
+			return "", fmt.Errorf("asset path %s: %w", name, err)
+		}
+		return p, nil
+	}
+	return funcs
+}
+
+func (a *Assets) serveError(w http.ResponseWriter, r *http.Request, err error) {
+	var herr *HashedPathError
+	switch {
+	case errors.As(err, &herr):
+		w.Header().Set("Cache-Control", "no-cache")
+		http.Redirect(w, r, a.o.prefix+herr.HashedPath, http.StatusFound)
+	case errors.Is(err, fs.ErrNotExist):
+		http.NotFound(w, r)
+	case errors.Is(err, fs.ErrPermission):
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+	default:
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+// precompress compresses all files that should be compressed.
+func (a *Assets) precompress() error {
+	return fs.WalkDir(a.hash.fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		hashed, err := a.hash.HashedPath(p)
+		if err != nil {
+			return err
+		}
+		typ, err := a.mime.ContentType(hashed)
+		if err != nil {
+			return err
+		}
+		if _, err := a.compress(hashed, info.Size(), typ); err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// compress returns the compressed content of the file with the hashed name,
+// or nil if it is not compressible or compression does not reduce its size.
+// Results are cached by the hashed name, as the content of the file with it
+// does not change.
+func (a *Assets) compress(name string, size int64, contentType string) ([]byte, error) {
+	if size < a.o.minCompressSize || !isCompressible(contentType) {
+		return nil, nil
+	}
+
+	a.gzippedMu.Lock()
+	data, ok := a.gzipped[name]
+	a.gzippedMu.Unlock()
+	if ok {
+		return data, nil
+	}
+
+	content, err := fs.ReadFile(a.hash, name)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(content); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	if buf.Len() < len(content) {
+		data = buf.Bytes()
+	}
+
+	a.gzippedMu.Lock()
+	a.gzipped[name] = data
+	a.gzippedMu.Unlock()
+
+	return data, nil
+}
+
+// isCompressible reports whether the content of the type is likely to be
+// reduced by compression.
+func isCompressible(contentType string) bool {
+	typ := strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+	if strings.HasPrefix(typ, "text/") || strings.HasSuffix(typ, "+json") || strings.HasSuffix(typ, "+xml") {
+		return true
+	}
+	switch typ {
+	case "application/javascript", "application/json", "application/xml", "application/wasm", "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+// acceptsGzip reports whether the request accepts gzip content encoding.
+func acceptsGzip(r *http.Request) bool {
+	for _, v := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		parts := strings.Split(v, ";")
+		if strings.TrimSpace(parts[0]) != "gzip" {
+			continue
+		}
+		for _, p := range parts[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				q, err := strconv.ParseFloat(strings.TrimPrefix(p, "q="), 64)
+				return err == nil && q > 0
+			}
+		}
+		return true
+	}
+	return false
+}
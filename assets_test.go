@@ -0,0 +1,221 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"html/template"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"resenje.org/fsutil"
+)
+
+func TestAssets(t *testing.T) {
+	css := strings.Repeat("body { color: blue; }\n", 50)
+	files := fsutil.MapFS{
+		"css/main.css":  {Data: []byte(css)},
+		"img/logo.png":  {Data: []byte("\x89PNG\r\n\x1a\n" + strings.Repeat("x", 2000))},
+		"js/app.js":     {Data: []byte("app()")},
+		"empty/.keep":   {},
+		"passwords.txt": {Data: []byte("secret")},
+	}
+	hasher := fsutil.NewMD5Hasher(8)
+	assets, err := fsutil.NewAssets(files, hasher,
+		fsutil.WithAssetsPrefix("/static"),
+		fsutil.WithAssetsPrecompression(100),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hfs := fsutil.NewHashFS(files, hasher)
+	hashedCSS, err := hfs.HashedPath("css/main.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashedPNG, err := hfs.HashedPath("img/logo.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashedJS, err := hfs.HashedPath("js/app.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("path", func(t *testing.T) {
+		p, err := assets.Path("/css/main.css")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "/static/" + hashedCSS; p != want {
+			t.Errorf("got path %q, want %q", p, want)
+		}
+	})
+
+	t.Run("template funcs", func(t *testing.T) {
+		tpl := template.Must(template.New("").Funcs(assets.TemplateFuncs()).Parse(`<script src="{{assetPath "js/app.js"}}"></script>`))
+		var b strings.Builder
+		if err := tpl.Execute(&b, nil); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := b.String(), `<script src="/static/`+hashedJS+`"></script>`; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("manifest", func(t *testing.T) {
+		data, err := assets.ManifestJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got map[string]string
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatal(err)
+		}
+		if got["css/main.css"] != hashedCSS || got["js/app.js"] != hashedJS || len(got) != len(files) {
+			t.Errorf("got manifest %v", got)
+		}
+	})
+
+	handler := assets.Handler()
+	serve := func(t *testing.T, urlPath string, header http.Header) *http.Response {
+		t.Helper()
+
+		r := httptest.NewRequest(http.MethodGet, urlPath, nil)
+		for k, v := range header {
+			r.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Result()
+	}
+
+	t.Run("hashed", func(t *testing.T) {
+		resp := serve(t, "/static/"+hashedJS, nil)
+		testAssetsResponse(t, resp, http.StatusOK, "app()")
+		if got, want := resp.Header.Get("Cache-Control"), "public, max-age=31536000, immutable"; got != want {
+			t.Errorf("got cache control %q, want %q", got, want)
+		}
+		if got := resp.Header.Get("Content-Type"); !strings.HasPrefix(got, "text/javascript") && !strings.HasPrefix(got, "application/javascript") {
+			t.Errorf("got content type %q", got)
+		}
+
+		etag := resp.Header.Get("ETag")
+		if etag == "" {
+			t.Fatal("got no etag")
+		}
+		resp = serve(t, "/static/"+hashedJS, http.Header{"If-None-Match": {etag}})
+		testAssetsResponse(t, resp, http.StatusNotModified, "")
+	})
+
+	t.Run("gzip", func(t *testing.T) {
+		resp := serve(t, "/static/"+hashedCSS, http.Header{"Accept-Encoding": {"br, gzip;q=0.8"}})
+		if got := resp.Header.Get("Content-Encoding"); got != "gzip" {
+			t.Fatalf("got content encoding %q, want gzip", got)
+		}
+		if got := resp.Header.Get("Vary"); got != "Accept-Encoding" {
+			t.Errorf("got vary %q, want Accept-Encoding", got)
+		}
+		zr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != css {
+			t.Errorf("got decompressed content %q", data)
+		}
+
+		for _, tc := range []struct {
+			name   string
+			path   string
+			header http.Header
+		}{
+			{name: "not accepted", path: hashedCSS, header: http.Header{"Accept-Encoding": {"gzip;q=0"}}},
+			{name: "not compressible", path: hashedPNG, header: http.Header{"Accept-Encoding": {"gzip"}}},
+			{name: "too small", path: hashedJS, header: http.Header{"Accept-Encoding": {"gzip"}}},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				resp := serve(t, "/static/"+tc.path, tc.header)
+				if got := resp.Header.Get("Content-Encoding"); got != "" {
+					t.Errorf("got content encoding %q", got)
+				}
+			})
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		for _, p := range []string{
+			"/static/js/app.js",
+			"/static/js/missing.js",
+			"/static/empty",
+			"/static/",
+			"/" + hashedJS,
+		} {
+			testAssetsResponse(t, serve(t, p, nil), http.StatusNotFound, "404 page not found\n")
+		}
+	})
+}
+
+func TestAssets_unhashedAccess(t *testing.T) {
+	files := fsutil.MapFS{
+		"js/app.js": {Data: []byte("app()")},
+	}
+	hasher := fsutil.NewMD5Hasher(8)
+	hashedJS, err := fsutil.NewHashFS(files, hasher).HashedPath("js/app.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		mode         fsutil.UnhashedAccessMode
+		status       int
+		cacheControl string
+		location     string
+	}{
+		{mode: fsutil.UnhashedAccessPermissive, status: http.StatusOK, cacheControl: "no-cache"},
+		{mode: fsutil.UnhashedAccessRedirectInfo, status: http.StatusFound, cacheControl: "no-cache", location: "/" + hashedJS},
+	} {
+		assets, err := fsutil.NewAssets(files, hasher, fsutil.WithAssetsHashOptions(fsutil.WithUnhashedAccessMode(tc.mode)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		assets.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/js/app.js", nil))
+		resp := w.Result()
+		if resp.StatusCode != tc.status {
+			t.Errorf("got status %v, want %v", resp.StatusCode, tc.status)
+		}
+		if got := resp.Header.Get("Cache-Control"); got != tc.cacheControl {
+			t.Errorf("got cache control %q, want %q", got, tc.cacheControl)
+		}
+		if got := resp.Header.Get("Location"); got != tc.location {
+			t.Errorf("got location %q, want %q", got, tc.location)
+		}
+	}
+}
+
+func testAssetsResponse(t *testing.T, resp *http.Response, status int, body string) {
+	t.Helper()
+
+	if resp.StatusCode != status {
+		t.Errorf("got status %v, want %v", resp.StatusCode, status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != body {
+		t.Errorf("got body %q, want %q", data, body)
+	}
+}
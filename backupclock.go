@@ -0,0 +1,59 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import "time"
+
+var _ Clock = systemClock{}
+
+// Clock provides the current time and timers to BackupFS.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// NewTimer returns a new Timer that sends the current time on its channel
+	// after at least duration d.
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a single event timer created by a Clock.
+type Timer interface {
+	// C returns the channel on which the time is delivered.
+	C() <-chan time.Time
+	// Stop prevents the Timer from firing. It returns false if the timer has
+	// already expired or been stopped.
+	Stop() bool
+}
+
+// WithClock sets the clock that BackupFS uses to expire the backup, to measure
+// the copy duration and to record the cleaning and archiving time. It allows
+// testing the expiry deterministically or running BackupFS with virtualized
+// time. Markers of instances that share the backup directory with the
+// WithSharedBackup option and the lock file use the system time, as they are
+// compared across processes. The default is the system clock.
+func WithClock(c Clock) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.clock = c
+	}
+}
+
+// systemClock is the Clock that uses the time package.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+type systemTimer struct {
+	*time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
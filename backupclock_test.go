@@ -0,0 +1,138 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestBackupFS_clock(t *testing.T) {
+	backupDir := filepath.Join(t.TempDir(), "backup")
+	archiveDir := t.TempDir()
+
+	clock := newManualClock(time.Date(2021, 8, 9, 10, 11, 12, 0, time.UTC))
+
+	fsys, err := fsutil.NewBackupFS(assetsBackupFS, backupDir, time.Hour, fsutil.WithClock(clock), fsutil.WithArchiveDir(archiveDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock.waitTimer()
+
+	clock.advance(59 * time.Minute)
+	select {
+	case <-fsys.Cleaned():
+		t.Fatal("backup cleaned before expiry")
+	default:
+	}
+
+	clock.advance(time.Minute)
+	<-fsys.Cleaned()
+
+	stats := fsys.Stats()
+	if stats.CleaningErr != nil {
+		t.Fatalf("got cleaning error %v", stats.CleaningErr)
+	}
+	if want := clock.now(); !stats.CleanedAt.Equal(want) {
+		t.Errorf("got cleaned at %v, want %v", stats.CleanedAt, want)
+	}
+	if _, err := os.Stat(filepath.Join(archiveDir, "backup-20210809T111112.000000000Z", "assets", "main.45b416.css")); err != nil {
+		t.Error(err)
+	}
+}
+
+// manualClock is a fsutil.Clock that changes time only when it is advanced.
+type manualClock struct {
+	t       time.Time
+	timers  []*manualTimer
+	created chan struct{}
+	once    sync.Once
+	mu      sync.Mutex
+}
+
+func newManualClock(t time.Time) *manualClock {
+	return &manualClock{
+		t:       t,
+		created: make(chan struct{}),
+	}
+}
+
+func (c *manualClock) Now() time.Time {
+	return c.now()
+}
+
+func (c *manualClock) NewTimer(d time.Duration) fsutil.Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &manualTimer{
+		c:        make(chan time.Time, 1),
+		deadline: c.t.Add(d),
+	}
+	c.timers = append(c.timers, t)
+	c.once.Do(func() { close(c.created) })
+	return t
+}
+
+func (c *manualClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.t
+}
+
+// waitTimer blocks until the first timer is created.
+func (c *manualClock) waitTimer() {
+	<-c.created
+}
+
+// advance moves the time forward and fires expired timers.
+func (c *manualClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.t = c.t.Add(d)
+	for _, t := range c.timers {
+		t.fire(c.t)
+	}
+}
+
+type manualTimer struct {
+	c        chan time.Time
+	deadline time.Time
+	done     bool
+	mu       sync.Mutex
+}
+
+func (t *manualTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *manualTimer) Stop() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stopped := !t.done
+	t.done = true
+	return stopped
+}
+
+func (t *manualTimer) fire(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.done || now.Before(t.deadline) {
+		return
+	}
+	t.done = true
+	t.c <- now
+}
@@ -14,6 +14,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -25,6 +26,8 @@ var (
 	_ fs.ReadDirFS  = (*BackupFS)(nil)
 	_ fs.ReadFileFS = (*BackupFS)(nil)
 	_ fs.StatFS     = (*BackupFS)(nil)
+	_ fs.SubFS      = (*BackupFS)(nil)
+	_ ReadLinkFS    = (*BackupFS)(nil)
 )
 
 // BackupFS implements a filesystem which copies all data from another
@@ -34,11 +37,319 @@ var (
 // files if they are needed shorty after new embedded filesystem with new files
 // is available.
 type BackupFS struct {
-	fsys          fs.FS
-	backup        fs.FS
-	cleaned       chan struct{}
-	cleaningErr   error
-	cleaningErrMu sync.Mutex
+	fsys            fs.FS
+	dir             string
+	backup          fs.FS
+	primary         fs.FS // filesystem that is read first
+	secondary       fs.FS // filesystem that is read if a file is not in primary
+	cleaned         chan struct{}
+	cleaningErr     error
+	cleanedAt       time.Time
+	isCleaned       bool
+	done            []chan error
+	cleaningErrMu   sync.Mutex
+	copied          chan struct{}
+	lazy            *lazyCopy
+	copyStats       BackupStats
+	skippedSymlinks []string
+	encodedNames    map[string]string
+	safeNames       bool
+	globWorkers     int
+	readDirCache    *readDirMemo
+	statsMu         sync.Mutex
+}
+
+// ErrBackupExpired is returned by BackupFS for files that are not in the
+// original filesystem after the backup directory is cleaned. It wraps
+// fs.ErrNotExist.
+var ErrBackupExpired = fmt.Errorf("backup expired: %w", fs.ErrNotExist)
+
+// ErrUnsupportedDir is returned for backup and mirror directory paths that
+// can not be used, such as the root or the current directory.
+var ErrUnsupportedDir = errors.New("unsupported directory")
+
+// BackupFSOption sets an optional parameter of the BackupFS.
+type BackupFSOption func(*backupFSOptions)
+
+type backupFSOptions struct {
+	shared        bool
+	linkDir       string
+	preferBackup  bool
+	cleanup       func(dir string) error
+	onCleaned     func(err error)
+	symlinkPolicy SymlinkPolicy
+	lazy          bool
+	maxBytes      int64
+	safeNames     bool
+	filePerm      func(perm fs.FileMode) fs.FileMode
+	dirPerm       func(perm fs.FileMode) fs.FileMode
+	clock         Clock
+	globWorkers   int
+	readDirCache  bool
+	preallocate   bool
+}
+
+// backupFilePerm returns permissions of a backup file for the permissions of
+// the original file and reports whether they have to be set regardless of the
+// process umask.
+func (o backupFSOptions) backupFilePerm(perm fs.FileMode) (fs.FileMode, bool) {
+	if o.filePerm == nil {
+		return perm.Perm() | permUserWrite, false // always user write
+	}
+	return o.filePerm(perm.Perm()).Perm(), true
+}
+
+// backupDirPerm returns permissions of a directory in the backup directory for
+// the permissions of the original directory and reports whether they have to
+// be set regardless of the process umask.
+func (o backupFSOptions) backupDirPerm(perm fs.FileMode) (fs.FileMode, bool) {
+	if o.dirPerm == nil {
+		return 0o777, false
+	}
+	return o.dirPerm(perm.Perm()).Perm(), true
+}
+
+// mkdirAll creates the directory in the backup directory with its parents and
+// sets its permissions for the permissions of the original directory.
+func (o backupFSOptions) mkdirAll(path string, perm fs.FileMode) error {
+	perm, set := o.backupDirPerm(perm)
+	if err := os.MkdirAll(path, perm); err != nil {
+		return fmt.Errorf("create directory %s: %w", path, err)
+	}
+	if set {
+		if err := os.Chmod(path, perm); err != nil {
+			return fmt.Errorf("set directory permissions %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// backupName returns the operating system path in the backup directory for
+// the slash separated path of the file in the original filesystem.
+func (o backupFSOptions) backupName(path string) string {
+	if o.safeNames {
+		path = EncodeSafeName(path)
+	}
+	return filepath.FromSlash(path)
+}
+
+// SymlinkPolicy defines how symbolic links are copied to the backup directory.
+type SymlinkPolicy int
+
+const (
+	// SymlinkFollow copies files and directories that symbolic links point
+	// to. This is the default policy.
+	SymlinkFollow SymlinkPolicy = iota
+	// SymlinkRecreate creates symbolic links in the backup directory with the
+	// same targets. The filesystem must have a ReadLink method.
+	SymlinkRecreate
+	// SymlinkSkip does not copy symbolic links. Their paths are reported by
+	// the BackupFS SkippedSymlinks method.
+	SymlinkSkip
+)
+
+// WithSymlinkPolicy sets how symbolic links are copied to the backup
+// directory.
+func WithSymlinkPolicy(p SymlinkPolicy) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.symlinkPolicy = p
+	}
+}
+
+// WithSharedBackup allows multiple BackupFS instances, possibly in different
+// processes, to use the same backup directory. Instead of returning
+// ErrBackupLocked when the backup directory is locked, NewBackupFS waits for
+// the lock to be released and adds its files to the backup directory. The
+// backup directory is removed only when the last of the instances that use it
+// expires.
+func WithSharedBackup() BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.shared = true
+	}
+}
+
+// WithLinkDir enables fast copying of files by cloning or hard linking them
+// from dir, which must be the operating system directory of the filesystem that
+// is backed up, for example the directory passed to os.DirFS. Files are cloned
+// where the filesystem supports it, otherwise hard linked if the backup
+// directory is on the same volume. If both fail, file data is copied.
+//
+// Hard linked files share their content with the original files, so this
+// option should be used only if files in dir are replaced and not modified in
+// place.
+func WithLinkDir(dir string) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.linkDir = dir
+	}
+}
+
+// WithPreferBackup makes the BackupFS read files from the backup directory
+// first and from the original filesystem only if files are not in the backup.
+// This is useful when the original filesystem may be updated in place and the
+// backup is the known good state.
+func WithPreferBackup() BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.preferBackup = true
+	}
+}
+
+// WithArchiveDir makes the expired backup directory to be moved into the
+// archive directory under a name with the expiration timestamp, instead of being
+// deleted. The archive directory must be on the same volume as the backup
+// directory.
+func WithArchiveDir(archiveDir string) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.cleanup = func(dir string) error {
+			if err := os.MkdirAll(archiveDir, 0o777); err != nil {
+				return fmt.Errorf("create archive directory: %w", err)
+			}
+			name := filepath.Base(dir) + "-" + o.clock.Now().UTC().Format("20060102T150405.000000000Z")
+			if err := os.Rename(dir, filepath.Join(archiveDir, name)); err != nil {
+				return fmt.Errorf("move backup to archive directory: %w", err)
+			}
+			return nil
+		}
+	}
+}
+
+// WithBackupGlobWorkers makes the Glob method read directories from a number
+// of concurrent workers with GlobConcurrent, which is faster for patterns with
+// wildcards in directory names on large trees.
+func WithBackupGlobWorkers(workers int) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.globWorkers = workers
+	}
+}
+
+// WithReadDirCache makes BackupFS keep merged directory entries of both the
+// original and the backup directory in memory, instead of reading, sorting
+// and deduplicating them on every ReadDir call, which reduces allocations
+// when directories are listed frequently, for example by http.FileServer. The
+// cache is cleared when the backup is cleaned. It should be used only if the
+// original filesystem does not change, as its changes are not reflected in
+// cached entries.
+func WithReadDirCache() BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.readDirCache = true
+	}
+}
+
+// WithBackupPreallocate makes BackupFS reserve disk space for the whole
+// content of every backup file before copying it, where the operating system
+// supports it, which reduces fragmentation of large files. Files are copied
+// even if the space can not be reserved.
+func WithBackupPreallocate() BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.preallocate = true
+	}
+}
+
+// WithCleanupFunc sets the function that is called with the backup directory
+// path when the backup is expired, instead of deleting the directory. The
+// function is responsible for removing the backup directory, for example after
+// archiving its content.
+func WithCleanupFunc(cleanup func(dir string) error) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.cleanup = cleanup
+	}
+}
+
+// WithCleanedFunc sets the function that is called with the result of
+// cleaning, nil if the backup directory is removed successfully, after the
+// backup is expired. The function is called in a separate goroutine.
+func WithCleanedFunc(f func(err error)) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.onCleaned = f
+	}
+}
+
+// WithLazyCopy makes NewBackupFS return without copying files. Files are
+// copied to the backup directory when they are opened for the first time and
+// by a background goroutine that copies all remaining files. The Copied method
+// returns a channel that is closed when all files are copied. The size of
+// files is checked by the background goroutine, which does not copy the
+// remaining files and reports *InsufficientSpaceError in the CopyErr field of
+// BackupStats if they do not fit.
+func WithLazyCopy() BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.lazy = true
+	}
+}
+
+// WithMaxBackupBytes limits the total size of files that are copied to the
+// backup directory. If the files are larger, NewBackupFS returns
+// *InsufficientSpaceError, or, with the WithLazyCopy option, the error is
+// reported by the Stats method.
+func WithMaxBackupBytes(n int64) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.maxBytes = n
+	}
+}
+
+// WithSafeNames makes files to be stored in the backup directory under names
+// that are valid on all supported operating systems, including Windows. File
+// names with characters that are not allowed, with trailing dots or spaces and
+// reserved device names, such as CON or NUL, are encoded with EncodeSafeName
+// and served by BackupFS under their original names. The backup directory path
+// is made absolute, so that paths longer than 260 characters can be used on
+// Windows. Names that are encoded are reported by the BackupFS EncodedNames
+// method. Files restored with the Restore method get their original names,
+// while RestoreBackup decodes names only with the WithRestoreSafeNames option.
+func WithSafeNames() BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.safeNames = true
+	}
+}
+
+// WithPermissionMask removes permission bits in the mask from files and
+// directories created in the backup directory, similar to umask, instead of
+// creating directories with all permissions and files with the original
+// permissions with added user write permission, both limited by the process
+// umask. For example, the 0o077 mask makes the backup accessible only to its
+// owner.
+func WithPermissionMask(mask fs.FileMode) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.filePerm = func(perm fs.FileMode) fs.FileMode {
+			return (perm | permUserWrite) &^ mask
+		}
+		o.dirPerm = func(fs.FileMode) fs.FileMode {
+			return 0o777 &^ mask
+		}
+	}
+}
+
+// WithFixedPermissions sets the same permissions, such as 0o644 and 0o755, to
+// all files and directories created in the backup directory, regardless of
+// the permissions of the original files. Directory permissions must allow the
+// owner to write files in them.
+func WithFixedPermissions(filePerm, dirPerm fs.FileMode) BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.filePerm = func(fs.FileMode) fs.FileMode {
+			return filePerm
+		}
+		o.dirPerm = func(fs.FileMode) fs.FileMode {
+			return dirPerm
+		}
+	}
+}
+
+// WithPreservedPermissions sets permissions of files in the backup directory
+// to be exactly the same as the permissions of the original files. Directories
+// have permissions of the original directories with added owner read, write
+// and execute permissions, so that files can be copied to them.
+//
+// Files that are cloned or hard linked with the WithLinkDir option keep their
+// permissions with this and other permission options, as hard linked files
+// share them with the original files.
+func WithPreservedPermissions() BackupFSOption {
+	return func(o *backupFSOptions) {
+		o.filePerm = func(perm fs.FileMode) fs.FileMode {
+			return perm
+		}
+		o.dirPerm = func(perm fs.FileMode) fs.FileMode {
+			return perm | 0o700
+		}
+	}
 }
 
 // NewBackupFS constructs a new BackupFS for another filesystem, that is copied
@@ -46,21 +357,106 @@ type BackupFS struct {
 //
 // Be aware that the complete dir will be deleted after it is expired. Make sure
 // that it does not contain any relevant
-func NewBackupFS(fsys fs.FS, dir string, ttl time.Duration) (*BackupFS, error) {
+//
+// While files are copied, the backup directory is locked with a lock file next
+// to it. If the lock is held by another BackupFS, ErrBackupLocked is returned,
+// unless the WithSharedBackup option is used. Every BackupFS records that it
+// uses the backup directory until it expires, so that the backup directory is
+// removed only when the last BackupFS that uses it expires.
+func NewBackupFS(fsys fs.FS, dir string, ttl time.Duration, opts ...BackupFSOption) (*BackupFS, error) {
 	dir = filepath.Clean(dir)
 	if !validateDir(dir) {
-		return nil, errors.New("unsupported directory")
+		return nil, ErrUnsupportedDir
+	}
+
+	o := backupFSOptions{
+		cleanup: os.RemoveAll,
+		clock:   systemClock{},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.safeNames {
+		// Absolute paths are prefixed by the os package on Windows to allow
+		// paths longer than the MAX_PATH limit.
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, fmt.Errorf("absolute backup directory path: %w", err)
+		}
+		dir = abs
 	}
 
 	s := new(BackupFS)
 	s.fsys = fsys
+	s.dir = dir
 	s.backup = os.DirFS(dir)
+	if o.safeNames {
+		s.backup = NewSafeNameFS(s.backup)
+		s.safeNames = true
+	}
+	if o.preferBackup {
+		s.primary, s.secondary = s.backup, s.fsys
+	} else {
+		s.primary, s.secondary = s.fsys, s.backup
+	}
+	s.globWorkers = o.globWorkers
+	if o.readDirCache {
+		s.readDirCache = newReadDirMemo()
+	}
 	s.cleaned = make(chan struct{})
+	s.copied = make(chan struct{})
+
+	parentPerm, _ := o.backupDirPerm(0o777)
+	if err := os.MkdirAll(filepath.Dir(dir), parentPerm); err != nil {
+		return nil, fmt.Errorf("create backup parent directory: %w", err)
+	}
+
+	lock := newBackupLock(dir)
+	if err := lock.acquire(o.shared); err != nil {
+		return nil, fmt.Errorf("lock backup directory: %w", err)
+	}
 
-	if err := s.copy(dir); err != nil {
+	// With lazy copying, files are not walked before NewBackupFS returns and
+	// space is checked in the background before the remaining files are
+	// copied.
+	if !o.lazy {
+		if err := s.checkSpace(dir, o); err != nil {
+			_ = lock.release()
+			return nil, err
+		}
+	}
+
+	var user *backupUser
+	var err error
+	if o.lazy {
+		s.lazy, err = newLazyCopy(dir, o)
+	} else {
+		start := o.clock.Now()
+		err = s.copy(dir, o)
+		s.copyStats.CopyDuration = o.clock.Now().Sub(start)
+		close(s.copied)
+	}
+	if err == nil {
+		user, err = addBackupUser(dir, time.Now().Add(ttl))
+	}
+	if err != nil || !o.lazy {
+		if rerr := lock.release(); err == nil {
+			err = rerr
+		}
+	}
+	if err != nil {
+		if s.lazy != nil {
+			_ = os.RemoveAll(s.lazy.tmpDir)
+		}
 		return nil, fmt.Errorf("copy files to the backup directory: %w", err)
 	}
 
+	if o.lazy {
+		// The lock is held until all files are copied.
+		go s.copyRemaining(lock)
+	}
+
 	done := make(chan struct{})
 
 	runtime.SetFinalizer(s, func(_ *BackupFS) {
@@ -68,15 +464,27 @@ func NewBackupFS(fsys fs.FS, dir string, ttl time.Duration) (*BackupFS, error) {
 	})
 
 	go func() {
-		t := time.NewTimer(ttl)
+		t := o.clock.NewTimer(ttl)
 		defer t.Stop()
 		select {
-		case <-t.C:
-			err := os.RemoveAll(dir)
+		case <-t.C():
+			err := removeBackup(dir, lock, user, o.cleanup)
 			s.cleaningErrMu.Lock()
 			s.cleaningErr = err
+			s.cleanedAt = o.clock.Now()
+			s.isCleaned = true
+			waiting := s.done
+			s.done = nil
 			s.cleaningErrMu.Unlock()
+			s.readDirCache.clear()
 			close(s.cleaned)
+			for _, c := range waiting {
+				c <- err
+				close(c)
+			}
+			if o.onCleaned != nil {
+				o.onCleaned(err)
+			}
 		case <-done:
 		}
 	}()
@@ -84,141 +492,630 @@ func NewBackupFS(fsys fs.FS, dir string, ttl time.Duration) (*BackupFS, error) {
 	return s, nil
 }
 
+// removeBackup removes the backup directory with the cleanup function while
+// holding the lock. It is removed only if no other BackupFS uses it.
+func removeBackup(dir string, lock *backupLock, user *backupUser, cleanup func(dir string) error) (err error) {
+	if err := lock.acquire(true); err != nil {
+		return fmt.Errorf("lock backup directory: %w", err)
+	}
+	defer func() {
+		if rerr := lock.release(); err == nil {
+			err = rerr
+		}
+	}()
+
+	othersActive, err := user.remove()
+	if err != nil {
+		return err
+	}
+	if othersActive {
+		return nil
+	}
+	return cleanup(dir)
+}
+
 // Open implements fs.FS interface.
 func (s *BackupFS) Open(name string) (fs.File, error) {
-	f, err := s.fsys.Open(name)
+	s.copyOnAccess(name)
+	f, err := s.primary.Open(name)
 	if err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
-			f, err := s.backup.Open(name)
+			f, err := s.secondary.Open(name)
 			if err != nil {
-				return nil, err
+				return nil, s.pathError("open", name, err)
 			}
-			return newBackupFile(name, f, s.backup), nil
+			return newBackupFile(name, f, nil, s.readDirCache), nil
 		}
-		return nil, err
+		return nil, s.pathError("open", name, err)
 	}
-	return newBackupFile(name, f, s.backup), nil
+	return newBackupFile(name, f, s.secondary, s.readDirCache), nil
 }
 
 // Glob implements fs.GlobFS interface.
 func (s *BackupFS) Glob(pattern string) ([]string, error) {
-	r, err := fs.Glob(s.fsys, pattern)
+	r, err := s.glob(s.primary, pattern)
 	if err != nil {
 		return nil, err
 	}
-	rc, err := fs.Glob(s.backup, pattern)
+	rc, err := s.glob(s.secondary, pattern)
 	if err != nil {
 		return nil, err
 	}
-	r = append(r, rc...)
-	sort.Strings(r)
-	return uniqueStrings(r), nil
+	if !sort.StringsAreSorted(r) {
+		sort.Strings(r)
+	}
+	if !sort.StringsAreSorted(rc) {
+		sort.Strings(rc)
+	}
+	return mergeStrings(r, rc), nil
+}
+
+// glob returns names matching the pattern, concurrently if the
+// WithBackupGlobWorkers option is used.
+func (s *BackupFS) glob(fsys fs.FS, pattern string) ([]string, error) {
+	if s.globWorkers > 0 {
+		return GlobConcurrent(fsys, pattern, s.globWorkers)
+	}
+	return fs.Glob(fsys, pattern)
 }
 
 // ReadDir implements fs.ReadDirFS interface.
 func (s *BackupFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := s.readDirCache.load(name, func() ([]fs.DirEntry, error) {
+		return s.readDir(name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append([]fs.DirEntry(nil), entries...), nil
+}
+
+// readDir returns merged and sorted entries of the directory in both
+// filesystems.
+func (s *BackupFS) readDir(name string) ([]fs.DirEntry, error) {
 	var doesNotExist bool
-	r, err := fs.ReadDir(s.fsys, name)
+	r, err := fs.ReadDir(s.primary, name)
 	if err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
 			doesNotExist = true
 		} else {
-			return nil, err
+			return nil, s.pathError("readdir", name, err)
 		}
 	}
-	rc, err := fs.ReadDir(s.backup, name)
+	rc, err := fs.ReadDir(s.secondary, name)
 	if err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
 			if doesNotExist {
-				return nil, err
+				return nil, s.pathError("readdir", name, err)
 			}
 		} else {
-			return nil, err
+			return nil, s.pathError("readdir", name, err)
 		}
 	}
-	r = append(r, rc...)
-	sort.SliceStable(r, func(i, j int) bool {
-		return r[i].Name() < r[j].Name()
-	})
-	return uniqueDirEntry(r), nil
+	// ReadDirFS implementations are expected, but not guaranteed, to
+	// return sorted entries.
+	sortDirEntries(r)
+	sortDirEntries(rc)
+	return mergeDirEntries(r, rc), nil
 }
 
 // ReadFile implements fs.ReadFileFS interface.
 func (s *BackupFS) ReadFile(name string) ([]byte, error) {
-	data, err := fs.ReadFile(s.fsys, name)
+	s.copyOnAccess(name)
+	data, err := fs.ReadFile(s.primary, name)
 	if err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
-			return fs.ReadFile(s.backup, name)
+			data, err = fs.ReadFile(s.secondary, name)
+		}
+		if err != nil {
+			return nil, s.pathError("readfile", name, err)
 		}
-		return nil, err
 	}
 	return data, nil
 }
 
 // Stat implements fs.StatFS interface.
 func (s *BackupFS) Stat(name string) (fs.FileInfo, error) {
-	stat, err := fs.Stat(s.fsys, name)
+	stat, err := fs.Stat(s.primary, name)
 	if err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
-			return fs.Stat(s.backup, name)
+			stat, err = fs.Stat(s.secondary, name)
+		}
+		if err != nil {
+			return nil, s.pathError("stat", name, err)
 		}
-		return nil, err
 	}
 	return stat, nil
 }
 
+// ReadLink implements ReadLinkFS interface.
+func (s *BackupFS) ReadLink(name string) (string, error) {
+	target, err := ReadLink(s.primary, name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			target, err = ReadLink(s.secondary, name)
+		}
+		if err != nil {
+			return "", s.pathError("readlink", name, err)
+		}
+	}
+	return target, nil
+}
+
+// Lstat implements ReadLinkFS interface.
+func (s *BackupFS) Lstat(name string) (fs.FileInfo, error) {
+	info, err := Lstat(s.primary, name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			info, err = Lstat(s.secondary, name)
+		}
+		if err != nil {
+			return nil, s.pathError("lstat", name, err)
+		}
+	}
+	return info, nil
+}
+
+// pathError returns the error as *fs.PathError with the op and the name. Files
+// that do not exist after the backup directory is cleaned are reported with
+// ErrBackupExpired.
+func (s *BackupFS) pathError(op, name string, err error) error {
+	if errors.Is(err, fs.ErrNotExist) && s.expired() {
+		return &fs.PathError{Op: op, Path: name, Err: ErrBackupExpired}
+	}
+	return &fs.PathError{Op: op, Path: name, Err: unwrapPathError(err)}
+}
+
+// expired reports whether the backup directory is cleaned.
+func (s *BackupFS) expired() bool {
+	select {
+	case <-s.cleaned:
+		return true
+	default:
+		return false
+	}
+}
+
+// Sub implements fs.SubFS interface.
+func (s *BackupFS) Sub(dir string) (fs.FS, error) {
+	return newSubFS(s, dir)
+}
+
+// Unwrap returns the underlying filesystem.
+func (s *BackupFS) Unwrap() fs.FS {
+	return s.fsys
+}
+
+// Copied returns a channel that is closed when all files are copied to the
+// backup directory.
+func (s *BackupFS) Copied() <-chan struct{} {
+	return s.copied
+}
+
+// Done returns a channel that receives the result of cleaning, nil if the
+// backup directory is removed successfully, after the backup is expired. The
+// channel is closed after the result is received. Every call returns a new
+// channel, so that the result can be received by multiple goroutines.
+func (s *BackupFS) Done() <-chan error {
+	c := make(chan error, 1)
+	s.cleaningErrMu.Lock()
+	defer s.cleaningErrMu.Unlock()
+	if s.isCleaned {
+		c <- s.cleaningErr
+		close(c)
+		return c
+	}
+	s.done = append(s.done, c)
+	return c
+}
+
 // Cleaned returns a channel that is closed when the backup directory is cleaned.
+//
+// Deprecated: Use Done, which also provides the cleaning error.
 func (s *BackupFS) Cleaned() <-chan struct{} {
 	return s.cleaned
 }
 
 // CleaningErr return the error when the backup is removed. The value is set only
 // after the Cleaned() channel is closed.
+//
+// Deprecated: Use Done, which provides the error when it is set.
 func (s *BackupFS) CleaningErr() error {
 	s.cleaningErrMu.Lock()
 	defer s.cleaningErrMu.Unlock()
 	return s.cleaningErr
 }
 
-func (s *BackupFS) copy(dir string) error {
-	if err := os.MkdirAll(dir, 0o777); err != nil {
-		return fmt.Errorf("create backup data directory: %w", err)
+// ErrInsufficientSpace is the error that InsufficientSpaceError wraps.
+var ErrInsufficientSpace = errors.New("insufficient space for backup")
+
+// InsufficientSpaceError is returned by NewBackupFS if files can not fit into
+// the backup directory, either because of the limit set by the
+// WithMaxBackupBytes option or because of the available space on the volume.
+type InsufficientSpaceError struct {
+	// Required is the total size of files in bytes.
+	Required int64
+	// Available is the number of bytes that can be used for the backup.
+	Available int64
+}
+
+// Error implements error interface.
+func (e *InsufficientSpaceError) Error() string {
+	return fmt.Sprintf("%v: required %v bytes, available %v bytes", ErrInsufficientSpace, e.Required, e.Available)
+}
+
+// Unwrap returns ErrInsufficientSpace.
+func (e *InsufficientSpaceError) Unwrap() error {
+	return ErrInsufficientSpace
+}
+
+// checkSpace returns *InsufficientSpaceError if the size of all files exceeds
+// the maximal backup size or the available space on the volume of the backup
+// directory. Available space is not checked if files are linked, as links do
+// not take additional space.
+func (s *BackupFS) checkSpace(dir string, o backupFSOptions) error {
+	if o.maxBytes <= 0 && o.linkDir != "" {
+		return nil
+	}
+	plan, err := newCopyPlan(s.fsys, o)
+	if err != nil {
+		return fmt.Errorf("calculate backup size: %w", err)
+	}
+	required := plan.Bytes
+	if o.maxBytes > 0 && required > o.maxBytes {
+		return &InsufficientSpaceError{Required: required, Available: o.maxBytes}
+	}
+	if o.linkDir != "" {
+		return nil
+	}
+	if available, ok := availableSpace(filepath.Dir(dir)); ok && required > available {
+		return &InsufficientSpaceError{Required: required, Available: available}
+	}
+	return nil
+}
+
+// BackupStats contains information about copying files to the backup
+// directory and its cleaning.
+type BackupStats struct {
+	// CopiedFiles is the number of files copied to the backup directory.
+	CopiedFiles int
+	// CopiedBytes is the total size of files copied to the backup directory.
+	CopiedBytes int64
+	// CopyDuration is the time spent on copying files.
+	CopyDuration time.Duration
+	// CopyErr is the error from copying files in the background with the
+	// WithLazyCopy option.
+	CopyErr error
+	// AccessCopyErr is the last error from copying a file when it is accessed
+	// with the WithLazyCopy option. Such files are copied again in the
+	// background.
+	AccessCopyErr error
+	// CleanedAt is the time when the backup directory was cleaned. It is zero
+	// if the backup is not cleaned.
+	CleanedAt time.Time
+	// CleaningErr is the error from cleaning the backup directory.
+	CleaningErr error
+}
+
+// Stats returns the current backup statistics.
+func (s *BackupFS) Stats() BackupStats {
+	s.statsMu.Lock()
+	stats := s.copyStats
+	s.statsMu.Unlock()
+	s.cleaningErrMu.Lock()
+	stats.CleanedAt = s.cleanedAt
+	stats.CleaningErr = s.cleaningErr
+	s.cleaningErrMu.Unlock()
+	return stats
+}
+
+// backupTempPattern is the pattern for temporary sibling directories where
+// files are copied before they are moved into the backup directory.
+const backupTempPattern = ".tmp-"
+
+// SkippedSymlinks returns paths of symbolic links that are not copied to the
+// backup directory because of the SymlinkSkip policy.
+func (s *BackupFS) SkippedSymlinks() []string {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+	return append([]string(nil), s.skippedSymlinks...)
+}
+
+// EncodedNames returns a map of paths in the original filesystem to the slash
+// separated paths in the backup directory for files and directories that are
+// stored under encoded names because of the WithSafeNames option.
+func (s *BackupFS) EncodedNames() map[string]string {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+	names := make(map[string]string, len(s.encodedNames))
+	for name, encoded := range s.encodedNames {
+		names[name] = encoded
+	}
+	return names
+}
+
+// backupPath returns the operating system path of the file in the dir and
+// records its name if it is encoded.
+func (s *BackupFS) backupPath(dir, path string, o backupFSOptions) string {
+	name := o.backupName(path)
+	if encoded := filepath.ToSlash(name); encoded != path {
+		s.statsMu.Lock()
+		if s.encodedNames == nil {
+			s.encodedNames = make(map[string]string)
+		}
+		s.encodedNames[path] = encoded
+		s.statsMu.Unlock()
+	}
+	return filepath.Join(dir, name)
+}
+
+func (s *BackupFS) copy(dir string, o backupFSOptions) error {
+	parent, base := filepath.Dir(dir), filepath.Base(dir)
+
+	if err := removeStaleBackupTempDirs(parent, base); err != nil {
+		return fmt.Errorf("remove stale temporary directories: %w", err)
+	}
+
+	tmpDir, err := mkdirBackupTemp(parent, base, o)
+	if err != nil {
+		return fmt.Errorf("create temporary backup directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if err := s.copyFiles(tmpDir, o); err != nil {
+		return err
 	}
 
-	return fs.WalkDir(s.fsys, ".", func(path string, d fs.DirEntry, err error) error {
+	if _, err := os.Stat(dir); err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("stat backup directory: %w", err)
+		}
+		if err := os.Rename(tmpDir, dir); err != nil {
+			return fmt.Errorf("move temporary backup directory: %w", err)
+		}
+		return nil
+	}
+
+	// The backup directory already exists with files from previous backups,
+	// move every file individually so that none of them is ever partially
+	// written.
+	return moveFiles(tmpDir, dir, o.dirPerm != nil)
+}
+
+// moveFiles moves all files from the src directory into the dst directory,
+// creating directories as needed with the permissions of directories in src.
+// If syncPerm is true, permissions of existing directories in dst are also set
+// to the permissions of directories in src. If src is a file, it is moved to
+// the dst path.
+func moveFiles(src, dst string, syncPerm bool) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
-		backupPath := filepath.Join(dir, path)
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		backupPath := filepath.Join(dst, rel)
 		if d.IsDir() {
-			if err := os.MkdirAll(backupPath, 0o777); err != nil {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(backupPath, info.Mode().Perm()); err != nil {
 				return fmt.Errorf("create directory %s: %w", backupPath, err)
 			}
+			if syncPerm {
+				if err := syncDirPerm(backupPath, info.Mode().Perm()); err != nil {
+					return fmt.Errorf("set directory permissions %s: %w", backupPath, err)
+				}
+			}
 			return nil
 		}
+		if err := os.Rename(path, backupPath); err != nil {
+			return fmt.Errorf("move file %s: %w", backupPath, err)
+		}
+		return nil
+	})
+}
 
-		fr, err := s.fsys.Open(path)
+// syncDirPerm sets the permissions of the existing directory if they differ.
+func syncDirPerm(path string, perm fs.FileMode) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode().Perm() == perm {
+		return nil
+	}
+	return os.Chmod(path, perm)
+}
+
+func (s *BackupFS) copyFiles(dir string, o backupFSOptions) error {
+	return fs.WalkDir(s.fsys, ".", s.copyWalkFunc(dir, o, 0))
+}
+
+// maxSymlinkDepth limits the number of nested directory symbolic links that
+// are followed to prevent infinite loops.
+const maxSymlinkDepth = 40
+
+func (s *BackupFS) copyWalkFunc(dir string, o backupFSOptions, depth int) fs.WalkDirFunc {
+	return func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
-			return fmt.Errorf("open file %s: %w", path, err)
+			return err
+		}
+		backupPath := s.backupPath(dir, path, o)
+		if d.IsDir() {
+			info, err := d.Info()
+			if err != nil {
+				return fmt.Errorf("directory info %s: %w", path, err)
+			}
+			return o.mkdirAll(backupPath, info.Mode())
 		}
-		defer fr.Close()
 
-		info, err := d.Info()
-		if err != nil {
-			return fmt.Errorf("file info %s: %w", path, err)
+		if d.Type()&fs.ModeSymlink != 0 {
+			switch o.symlinkPolicy {
+			case SymlinkSkip:
+				s.statsMu.Lock()
+				s.skippedSymlinks = append(s.skippedSymlinks, path)
+				s.statsMu.Unlock()
+				return nil
+			case SymlinkRecreate:
+				rl, ok := s.fsys.(readLinkFS)
+				if !ok {
+					return &fs.PathError{Op: "readlink", Path: path, Err: fs.ErrInvalid}
+				}
+				target, err := rl.ReadLink(path)
+				if err != nil {
+					return fmt.Errorf("read link %s: %w", path, err)
+				}
+				if !filepath.IsAbs(target) {
+					target = o.backupName(filepath.ToSlash(target))
+				}
+				if err := os.Symlink(target, backupPath); err != nil {
+					return fmt.Errorf("create symlink %s: %w", backupPath, err)
+				}
+				s.addCopied(0)
+				return nil
+			default:
+				info, err := fs.Stat(s.fsys, path)
+				if err != nil {
+					return fmt.Errorf("stat link target %s: %w", path, err)
+				}
+				if info.IsDir() {
+					if depth >= maxSymlinkDepth {
+						return fmt.Errorf("follow link %s: too many levels of symbolic links", path)
+					}
+					return fs.WalkDir(s.fsys, path, s.copyWalkFunc(dir, o, depth+1))
+				}
+			}
+		}
+
+		linkDir := o.linkDir
+		if !d.Type().IsRegular() {
+			linkDir = ""
+		}
+		return s.copyFile(path, backupPath, linkDir, o)
+	}
+}
+
+// copyFile copies a single file from the filesystem to the backupPath. If the
+// linkDir is not empty, cloning or hard linking of the file is tried first.
+func (s *BackupFS) copyFile(path, backupPath, linkDir string, o backupFSOptions) error {
+	if linkDir != "" {
+		if linkFile(filepath.Join(linkDir, filepath.FromSlash(path)), backupPath) == nil {
+			var size int64
+			if info, err := fs.Stat(s.fsys, path); err == nil {
+				size = info.Size()
+			}
+			s.addCopied(size)
+			return nil
+		}
+	}
+
+	fr, err := s.fsys.Open(path)
+	if err != nil {
+		return fmt.Errorf("open file %s: %w", path, err)
+	}
+	defer fr.Close()
+
+	info, err := fr.Stat()
+	if err != nil {
+		return fmt.Errorf("file info %s: %w", path, err)
+	}
+	perm, set := o.backupFilePerm(info.Mode())
+	fw, err := os.OpenFile(backupPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return fmt.Errorf("create backup file %s: %w", backupPath, err)
+	}
+	defer fw.Close()
+
+	if set {
+		if err := fw.Chmod(perm); err != nil {
+			return fmt.Errorf("set backup file permissions %s: %w", backupPath, err)
+		}
+	}
+
+	if o.preallocate {
+		_ = preallocate(fw, info.Size())
+	}
+
+	n, err := copyFileData(fw, fr)
+	if err != nil {
+		return fmt.Errorf("copy file data %s: %w", backupPath, err)
+	}
+	s.addCopied(n)
+	return nil
+}
+
+func (s *BackupFS) addCopied(size int64) {
+	s.statsMu.Lock()
+	s.copyStats.CopiedFiles++
+	s.copyStats.CopiedBytes += size
+	s.statsMu.Unlock()
+}
+
+// readLinkFS is implemented by filesystems that can read symbolic links, such
+// as os.DirFS.
+type readLinkFS interface {
+	ReadLink(name string) (string, error)
+}
+
+// mkdirBackupTemp creates a new temporary directory in the parent directory
+// with the permissions of other backup directories, as it becomes the backup
+// directory if it does not exist. Unlike os.MkdirTemp, which creates it with
+// 0o700 permissions, it is created with permissions limited by the process
+// umask or set by a permissions option.
+func mkdirBackupTemp(parent, base string, o backupFSOptions) (string, error) {
+	perm, set := o.backupDirPerm(0o777)
+	for i := 0; ; i++ {
+		dir := filepath.Join(parent, base+backupTempPattern+strconv.FormatInt(time.Now().UnixNano()+int64(i), 36))
+		err := os.Mkdir(dir, perm)
+		if errors.Is(err, fs.ErrExist) && i < 10000 {
+			continue
 		}
-		const permUserWrite = 0o200
-		fw, err := os.OpenFile(backupPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode().Perm()|permUserWrite) // always user write
 		if err != nil {
-			return fmt.Errorf("create backup file %s: %w", backupPath, err)
+			return "", err
+		}
+		if set {
+			if err := os.Chmod(dir, perm); err != nil {
+				_ = os.Remove(dir)
+				return "", err
+			}
 		}
-		defer fw.Close()
+		return dir, nil
+	}
+}
 
-		if _, err := io.Copy(fw, fr); err != nil {
-			return fmt.Errorf("copy file data %s: %w", backupPath, err)
+// removeStaleBackupTempDirs removes temporary directories left in the parent
+// directory by backups that did not complete.
+func removeStaleBackupTempDirs(parent, base string) error {
+	entries, err := os.ReadDir(parent)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !e.IsDir() || !strings.HasPrefix(e.Name(), base+backupTempPattern) {
+			continue
 		}
+		if err := os.RemoveAll(filepath.Join(parent, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// permUserWrite is added to permissions of all backup files so that they can
+// be overwritten by subsequent backups.
+const permUserWrite = 0o200
+
+// linkFile creates a file at the dst path with the same content as the file
+// at src path by cloning it or by creating a hard link.
+func linkFile(src, dst string) error {
+	if err := cloneFile(src, dst); err == nil {
 		return nil
-	})
+	}
+	return os.Link(src, dst)
 }
 
 func uniqueStrings(s []string) []string {
@@ -235,20 +1132,107 @@ func uniqueStrings(s []string) []string {
 	return s[:n]
 }
 
+// mergeStrings merges two sorted slices into a single sorted slice without
+// duplicates. Elements of a take precedence over equal elements of b. The
+// returned slice may share the underlying array with a.
+func mergeStrings(a, b []string) []string {
+	if len(b) == 0 {
+		return uniqueStrings(a)
+	}
+	if len(a) == 0 {
+		return uniqueStrings(b)
+	}
+	r := make([]string, 0, len(a)+len(b))
+	var i, j int
+	for i < len(a) || j < len(b) {
+		var x string
+		switch {
+		case j == len(b) || i < len(a) && a[i] <= b[j]:
+			x = a[i]
+			i++
+		default:
+			x = b[j]
+			j++
+		}
+		if len(r) > 0 && r[len(r)-1] == x {
+			continue
+		}
+		r = append(r, x)
+	}
+	return r
+}
+
+// mergeDirEntries merges two slices of directory entries sorted by name into
+// a single sorted slice without entries with duplicate names. Entries of a
+// take precedence over entries of b with the same name. The returned slice
+// may share the underlying array with a.
+func mergeDirEntries(a, b []fs.DirEntry) []fs.DirEntry {
+	if len(b) == 0 {
+		return uniqueDirEntry(a)
+	}
+	if len(a) == 0 {
+		return uniqueDirEntry(b)
+	}
+	r := make([]fs.DirEntry, 0, len(a)+len(b))
+	var last string
+	var i, j int
+	for i < len(a) || j < len(b) {
+		var e fs.DirEntry
+		switch {
+		case j == len(b):
+			e = a[i]
+			i++
+		case i == len(a):
+			e = b[j]
+			j++
+		case a[i].Name() <= b[j].Name():
+			e = a[i]
+			i++
+		default:
+			e = b[j]
+			j++
+		}
+		name := e.Name()
+		if len(r) > 0 && last == name {
+			continue
+		}
+		r = append(r, e)
+		last = name
+	}
+	return r
+}
+
+// uniqueDirEntry removes entries with duplicate names in place from a slice
+// sorted by name.
 func uniqueDirEntry(e []fs.DirEntry) []fs.DirEntry {
 	if len(e) <= 1 {
 		return e
 	}
 	n := 1
-	for i, x := range e[1:] {
-		if x.Name() != e[i].Name() {
+	last := e[0].Name()
+	for _, x := range e[1:] {
+		if name := x.Name(); name != last {
 			e[n] = x
 			n++
+			last = name
 		}
 	}
 	return e[:n]
 }
 
+// sortDirEntries sorts directory entries by name, skipping the sort if they
+// are already sorted, as they are with most ReadDir implementations.
+func sortDirEntries(e []fs.DirEntry) {
+	for i := 1; i < len(e); i++ {
+		if e[i].Name() < e[i-1].Name() {
+			sort.SliceStable(e, func(i, j int) bool {
+				return e[i].Name() < e[j].Name()
+			})
+			return
+		}
+	}
+}
+
 func validateDir(dir string) bool {
 	pathSeparator := string(os.PathSeparator)
 	for _, n := range []string{
@@ -266,98 +1250,174 @@ func validateDir(dir string) bool {
 	return !strings.HasSuffix(dir, pathSeparator+"..")
 }
 
+// readDirIfExists returns entries of the named directory, or no entries if the
+// directory does not exist or if it is not a directory.
+func readDirIfExists(fsys fs.FS, name string) ([]fs.DirEntry, error) {
+	info, err := fs.Stat(fsys, name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, nil
+	}
+	return fs.ReadDir(fsys, name)
+}
+
 type backupFile struct {
-	name string
-	fs.File
+	wrappedFile
 	backupFS fs.FS
+	cache    *readDirMemo
 
-	initialized bool
-	isDir       bool
-	backupFile  fs.ReadDirFile
+	entries []fs.DirEntry
+	offset  int
+	read    bool
 }
 
-func newBackupFile(name string, f fs.File, backupFS fs.FS) *backupFile {
+func newBackupFile(name string, f fs.File, backupFS fs.FS, cache *readDirMemo) *backupFile {
 	return &backupFile{
-		name:     name,
-		File:     f,
-		backupFS: backupFS,
+		wrappedFile: wrappedFile{File: f, name: name},
+		backupFS:    backupFS,
+		cache:       cache,
 	}
 }
 
 // ReadDir reads the contents of the directory and returns
-// a slice of up to n DirEntry values in directory order.
-// Subsequent calls on the same file will yield further DirEntry values.
+// a slice of up to n DirEntry values in sorted order by name. Entries from the
+// backup directory are merged with entries from the original directory, each
+// name returned only once. Subsequent calls on the same file will yield
+// further DirEntry values.
 //
-// If n > 0, ReadDir returns an error as not supported argument.
+// If n > 0, ReadDir returns at most n DirEntry structures.
+// In this case, if ReadDir returns an empty slice, it will return
+// a non-nil error explaining why.
+// At the end of a directory, the error is io.EOF.
 //
-// If n <= 0, ReadDir returns all the DirEntry values from the directory
-// in a single slice. In this case, if ReadDir succeeds (reads all the way
-// to the end of the directory), it returns the slice and a nil error.
-// If it encounters an error before the end of the directory,
-// ReadDir returns the DirEntry list read until that point and a non-nil error.
+// If n <= 0, ReadDir returns all the remaining DirEntry values from the
+// directory in a single slice.
 func (f *backupFile) ReadDir(n int) ([]fs.DirEntry, error) {
-	dir, ok := f.File.(fs.ReadDirFile)
-	if !ok {
-		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: errors.New("not implemented")}
-	}
-
-	if !f.initialized {
-		s, err := f.File.Stat()
+	if !f.read {
+		entries, err := f.cache.load(f.name, f.readDir)
 		if err != nil {
 			return nil, err
 		}
-		f.isDir = s.IsDir()
-		bf, err := f.backupFS.Open(f.name)
-		if err != nil && !errors.Is(err, fs.ErrNotExist) {
-			return nil, err
+		f.entries = entries
+		f.read = true
+	}
+
+	entries := f.entries[f.offset:]
+	if n > 0 {
+		if len(entries) == 0 {
+			return nil, io.EOF
 		}
-		if dir, ok := bf.(fs.ReadDirFile); ok {
-			f.backupFile = dir
+		if n < len(entries) {
+			entries = entries[:n]
 		}
-		f.initialized = true
 	}
+	f.offset += len(entries)
+	return append([]fs.DirEntry(nil), entries...), nil
+}
 
-	if !f.isDir {
-		return nil, errors.New("not a directory")
+// readDir returns merged and sorted entries of the directory and the same
+// directory in the backup filesystem.
+func (f *backupFile) readDir() ([]fs.DirEntry, error) {
+	dir, ok := f.File.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: errors.New("not implemented")}
 	}
-
-	if n >= 0 {
-		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: errors.New("BackupFS File does not support positive arguments for ReadDir")}
+	s, err := f.File.Stat()
+	if err != nil {
+		return nil, err
 	}
-
-	if f.backupFile == nil {
-		return dir.ReadDir(n)
+	if !s.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: errNotDir}
 	}
 
-	r, err := dir.ReadDir(n)
+	r, err := dir.ReadDir(-1)
 	if err != nil {
 		return nil, err
 	}
-	rc, err := f.backupFile.ReadDir(n)
+	// File.ReadDir does not guarantee any order, unlike fs.ReadDir.
+	sortDirEntries(r)
+
+	if f.backupFS == nil {
+		return mergeDirEntries(r, nil), nil
+	}
+	rc, err := readDirIfExists(f.backupFS, f.name)
 	if err != nil {
 		return nil, err
 	}
-	r = append(r, rc...)
-	sort.SliceStable(r, func(i, j int) bool {
-		return r[i].Name() < r[j].Name()
-	})
-	return uniqueDirEntry(r), nil
+	sortDirEntries(rc)
+	return mergeDirEntries(r, rc), nil
 }
 
-func (f *backupFile) Close() error {
-	if err := f.File.Close(); err != nil {
-		return err
+// WriteTo implements io.WriterTo interface with the WriteTo method of the
+// underlying file or with io.Copy from it, to keep optimizations of copying
+// from the underlying file, such as sendfile of *os.File.
+func (f *backupFile) WriteTo(w io.Writer) (int64, error) {
+	if wt, ok := f.File.(io.WriterTo); ok {
+		return wt.WriteTo(w)
 	}
-	if f.backupFile != nil {
-		return f.backupFile.Close()
+	return io.Copy(w, f.File)
+}
+
+// RawFile returns the underlying *os.File, if there is one.
+func (f *backupFile) RawFile() *os.File {
+	return RawFile(f.File)
+}
+
+// readDirMemo holds merged directory entries by directory names. Methods of a
+// nil readDirMemo do not cache entries.
+type readDirMemo struct {
+	entries map[string][]fs.DirEntry
+	// generation is incremented on clear, so that entries that are read
+	// before clearing are not cached after it.
+	generation uint64
+	mu         sync.Mutex
+}
+
+func newReadDirMemo() *readDirMemo {
+	return &readDirMemo{
+		entries: make(map[string][]fs.DirEntry),
 	}
-	return nil
 }
 
-func (f *backupFile) Seek(offset int64, whence int) (int64, error) {
-	s, ok := f.File.(io.Seeker)
-	if !ok {
-		return 0, errors.New("backup file missing seek function")
+// load returns cached entries of the directory or caches and returns the ones
+// returned by the read function. Returned entries must not be modified.
+func (m *readDirMemo) load(name string, read func() ([]fs.DirEntry, error)) ([]fs.DirEntry, error) {
+	if m == nil {
+		return read()
+	}
+
+	m.mu.Lock()
+	entries, ok := m.entries[name]
+	generation := m.generation
+	m.mu.Unlock()
+	if ok {
+		return entries, nil
+	}
+
+	entries, err := read()
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	if m.generation == generation {
+		m.entries[name] = entries
+	}
+	m.mu.Unlock()
+	return entries, nil
+}
+
+func (m *readDirMemo) clear() {
+	if m == nil {
+		return
 	}
-	return s.Seek(offset, whence)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = make(map[string][]fs.DirEntry)
+	m.generation++
 }
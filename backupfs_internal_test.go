@@ -0,0 +1,57 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_mergeStrings(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		a, b []string
+		want []string
+	}{
+		{
+			name: "nil",
+		},
+		{
+			name: "only first",
+			a:    []string{"a", "b"},
+			want: []string{"a", "b"},
+		},
+		{
+			name: "only second",
+			b:    []string{"a", "b"},
+			want: []string{"a", "b"},
+		},
+		{
+			name: "interleaved",
+			a:    []string{"a", "c", "e"},
+			b:    []string{"b", "d", "f"},
+			want: []string{"a", "b", "c", "d", "e", "f"},
+		},
+		{
+			name: "duplicates",
+			a:    []string{"a", "b", "c"},
+			b:    []string{"b", "c", "d"},
+			want: []string{"a", "b", "c", "d"},
+		},
+		{
+			name: "duplicates within",
+			a:    []string{"a", "a", "c"},
+			b:    []string{"b", "b"},
+			want: []string{"a", "b", "c"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := mergeStrings(tc.a, tc.b); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("mergeStrings() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"runtime"
 	"sort"
 	"testing"
+	"testing/fstest"
 	"time"
 
 	"resenje.org/fsutil"
@@ -84,6 +85,100 @@ func TestBackupFS_expiry(t *testing.T) {
 	testStat(t, fsys, fileName, fileInfo, 0)
 }
 
+func TestBackupFS_expiredError(t *testing.T) {
+	files := fstest.MapFS{
+		"index.html": {Data: []byte("<html>")},
+	}
+	fsys, err := fsutil.NewBackupFS(files, t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fsys.Open("missing.html"); errors.Is(err, fsutil.ErrBackupExpired) || !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got error %v before expiry, want %v", err, fs.ErrNotExist)
+	}
+
+	fsys, err = fsutil.NewBackupFS(files, t.TempDir(), 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-fsys.Cleaned():
+	case <-time.After(30 * time.Second):
+		t.Fatal("timeout waiting for backup to be cleaned")
+	}
+
+	delete(files, "index.html")
+	_, err = fsys.Stat("index.html")
+	if !errors.Is(err, fsutil.ErrBackupExpired) || !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("got error %v, want %v", err, fsutil.ErrBackupExpired)
+	}
+	var e *fs.PathError
+	if !errors.As(err, &e) || e.Op != "stat" || e.Path != "index.html" {
+		t.Errorf("got error %#v, want stat path error", err)
+	}
+}
+
+func TestBackupFS_readDirCache(t *testing.T) {
+	files := fstest.MapFS{
+		"assets/main.css": {Data: []byte("body {}")},
+	}
+	clock := newManualClock(time.Date(2021, 8, 9, 10, 11, 12, 0, time.UTC))
+
+	fsys, err := fsutil.NewBackupFS(files, t.TempDir(), time.Hour, fsutil.WithClock(clock), fsutil.WithReadDirCache())
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.waitTimer()
+
+	readDirNames := func(t *testing.T, want ...string) {
+		t.Helper()
+
+		entries, err := fsys.ReadDir("assets")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		if fmt.Sprint(names) != fmt.Sprint(want) {
+			t.Errorf("got names %v, want %v", names, want)
+		}
+
+		entries, err = fs.ReadDir(fsutil.FSFunc(fsys.Open), "assets")
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = nil
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		if fmt.Sprint(names) != fmt.Sprint(want) {
+			t.Errorf("got file names %v, want %v", names, want)
+		}
+	}
+
+	readDirNames(t, "main.css")
+
+	delete(files, "assets/main.css")
+	files["assets/main.js"] = &fstest.MapFile{Data: []byte("main()")}
+
+	// Cached entries are returned until the backup is cleaned.
+	readDirNames(t, "main.css")
+
+	clock.advance(time.Hour)
+	<-fsys.Cleaned()
+
+	readDirNames(t, "main.js")
+}
+
+func TestBackupFS_unsupportedDir(t *testing.T) {
+	if _, err := fsutil.NewBackupFS(fstest.MapFS{}, ".", time.Hour); !errors.Is(err, fsutil.ErrUnsupportedDir) {
+		t.Errorf("got error %v, want %v", err, fsutil.ErrUnsupportedDir)
+	}
+}
+
 func TestBackupFS_fromBackup(t *testing.T) {
 	backupDir := t.TempDir()
 
@@ -163,6 +258,466 @@ func TestBackupFS_overwriteFiles(t *testing.T) {
 	testStat(t, fsys, fileName, fileInfo, 0)
 }
 
+func TestBackupFS_staleTempDirs(t *testing.T) {
+	parentDir := t.TempDir()
+	backupDir := filepath.Join(parentDir, "backup")
+
+	staleDir := filepath.Join(parentDir, "backup.tmp-123456")
+	if err := os.MkdirAll(filepath.Join(staleDir, "assets"), 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(staleDir, "assets", "partial.css"), []byte("body {"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys, err := fsutil.NewBackupFS(assetsBackupFS, backupDir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(parentDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+	if want := []string{"backup", "backup.users"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got directories %v, want %v", got, want)
+	}
+
+	fileName, fileContent, _, _ := backupFSFiles(t)
+
+	testOpen(t, fsys, fileName, fileContent)
+	testOpenNotExist(t, fsys, "assets/partial.css")
+}
+
+func TestBackupFS_linkDir(t *testing.T) {
+	dir := t.TempDir()
+	backupDir := t.TempDir()
+
+	if err := os.Mkdir(filepath.Join(dir, "assets"), 0o777); err != nil {
+		t.Fatal(err)
+	}
+	fileName := "assets/main.css"
+	fileContent := "body { color: red; }"
+	if err := os.WriteFile(filepath.Join(dir, fileName), []byte(fileContent), 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		linkDir string
+	}{
+		{name: "link", linkDir: dir},
+		{name: "fallback to copy", linkDir: filepath.Join(dir, "missing")},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := fsutil.NewBackupFS(os.DirFS(dir), backupDir, time.Hour, fsutil.WithLinkDir(tc.linkDir)); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(filepath.Join(backupDir, fileName))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != fileContent {
+				t.Errorf("got content %q, want %q", string(data), fileContent)
+			}
+		})
+	}
+}
+
+func TestBackupFS_preferBackup(t *testing.T) {
+	dir := t.TempDir()
+	backupDir := t.TempDir()
+
+	fileName := "main.css"
+	if err := os.WriteFile(filepath.Join(dir, fileName), []byte("body { color: red; }"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	defaultFS, err := fsutil.NewBackupFS(os.DirFS(dir), backupDir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	preferBackupFS, err := fsutil.NewBackupFS(os.DirFS(dir), backupDir, time.Hour, fsutil.WithPreferBackup())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, fileName), []byte("body { color: blue; }"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	testOpen(t, defaultFS, fileName, "body { color: blue; }")
+	testReadFile(t, defaultFS, fileName, "body { color: blue; }")
+
+	testOpen(t, preferBackupFS, fileName, "body { color: red; }")
+	testReadFile(t, preferBackupFS, fileName, "body { color: red; }")
+}
+
+func TestBackupFS_preallocate(t *testing.T) {
+	backupDir := t.TempDir()
+
+	fsys, err := fsutil.NewBackupFS(assetsBackupFS, backupDir, time.Hour, fsutil.WithBackupPreallocate())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fileName, fileContent, fileInfo, _ := backupFSFiles(t)
+
+	testOpen(t, fsys, fileName, fileContent)
+	testStat(t, fsys, fileName, fileInfo, 0)
+
+	if want := int64(len(fileContent)); fsys.Stats().CopiedBytes != want {
+		t.Errorf("got copied bytes %v, want %v", fsys.Stats().CopiedBytes, want)
+	}
+}
+
+func TestBackupFS_Stats(t *testing.T) {
+	backupDir := t.TempDir()
+
+	fsys, err := fsutil.NewBackupFS(assetsBackupFS, backupDir, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats := fsys.Stats()
+	if stats.CopiedFiles != 1 {
+		t.Errorf("got copied files %v, want %v", stats.CopiedFiles, 1)
+	}
+	if want := int64(len("body { color: green; }")); stats.CopiedBytes != want {
+		t.Errorf("got copied bytes %v, want %v", stats.CopiedBytes, want)
+	}
+	if stats.CopyDuration <= 0 {
+		t.Errorf("got copy duration %v, want positive", stats.CopyDuration)
+	}
+
+	select {
+	case <-fsys.Cleaned():
+	case <-time.After(30 * time.Second):
+		t.Fatal("timeout waiting for backup to be cleaned")
+	}
+
+	stats = fsys.Stats()
+	if stats.CleanedAt.IsZero() {
+		t.Error("got zero cleaned at time")
+	}
+	if stats.CleaningErr != nil {
+		t.Errorf("got cleaning error %v", stats.CleaningErr)
+	}
+}
+
+func TestBackupFS_archiveDir(t *testing.T) {
+	backupDir := filepath.Join(t.TempDir(), "backup")
+	archiveDir := t.TempDir()
+
+	fsys, err := fsutil.NewBackupFS(assetsBackupFS, backupDir, 10*time.Millisecond, fsutil.WithArchiveDir(archiveDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-fsys.Done():
+		if err != nil {
+			t.Fatalf("clean error: %v", err)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("timeout waiting for backup to be cleaned")
+	}
+
+	if _, err := os.Stat(backupDir); !os.IsNotExist(err) {
+		t.Errorf("got backup directory stat error %v, want not exist", err)
+	}
+
+	matches, err := filepath.Glob(filepath.Join(archiveDir, "backup-*", "assets", "main.45b416.css"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 {
+		t.Errorf("got archived files %v, want one", matches)
+	}
+}
+
+func TestBackupFS_cleanupFunc(t *testing.T) {
+	backupDir := t.TempDir()
+
+	var gotDir string
+	cleanedErr := make(chan error, 1)
+	fsys, err := fsutil.NewBackupFS(assetsBackupFS, backupDir, 10*time.Millisecond,
+		fsutil.WithCleanupFunc(func(dir string) error {
+			gotDir = dir
+			return errTest1
+		}),
+		fsutil.WithCleanedFunc(func(err error) {
+			cleanedErr <- err
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done1, done2 := fsys.Done(), fsys.Done()
+
+	for _, c := range []<-chan error{done1, done2, cleanedErr} {
+		select {
+		case err := <-c:
+			if !errors.Is(err, errTest1) {
+				t.Errorf("got clean error %v, want %v", err, errTest1)
+			}
+		case <-time.After(30 * time.Second):
+			t.Fatal("timeout waiting for backup to be cleaned")
+		}
+	}
+	if _, ok := <-done1; ok {
+		t.Error("done channel is not closed")
+	}
+
+	// Channels returned after cleaning receive the error immediately.
+	if err := <-fsys.Done(); !errors.Is(err, errTest1) {
+		t.Errorf("got clean error %v, want %v", err, errTest1)
+	}
+
+	if gotDir != backupDir {
+		t.Errorf("got cleanup dir %q, want %q", gotDir, backupDir)
+	}
+}
+
+func TestBackupFS_symlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links require privileges on windows")
+	}
+
+	dir := t.TempDir()
+
+	if err := os.Mkdir(filepath.Join(dir, "assets"), 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "assets", "main.css"), []byte("body { color: red; }"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("main.css", filepath.Join(dir, "assets", "link.css")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("assets", filepath.Join(dir, "static")); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("follow", func(t *testing.T) {
+		backupDir := t.TempDir()
+
+		fsys, err := fsutil.NewBackupFS(os.DirFS(dir), backupDir, time.Hour, fsutil.WithSymlinkPolicy(fsutil.SymlinkFollow))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, name := range []string{"assets/link.css", "static/main.css", "static/link.css"} {
+			info, err := os.Lstat(filepath.Join(backupDir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !info.Mode().IsRegular() {
+				t.Errorf("got file %q mode %v, want regular file", name, info.Mode())
+			}
+		}
+		if got := fsys.SkippedSymlinks(); len(got) != 0 {
+			t.Errorf("got skipped symlinks %v", got)
+		}
+	})
+
+	t.Run("recreate", func(t *testing.T) {
+		if _, ok := os.DirFS(dir).(interface {
+			ReadLink(name string) (string, error)
+		}); !ok {
+			t.Skip("os.DirFS does not support reading links")
+		}
+
+		backupDir := t.TempDir()
+
+		if _, err := fsutil.NewBackupFS(os.DirFS(dir), backupDir, time.Hour, fsutil.WithSymlinkPolicy(fsutil.SymlinkRecreate)); err != nil {
+			t.Fatal(err)
+		}
+
+		for name, want := range map[string]string{
+			"assets/link.css": "main.css",
+			"static":          "assets",
+		} {
+			got, err := os.Readlink(filepath.Join(backupDir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Errorf("got link %q target %q, want %q", name, got, want)
+			}
+		}
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		backupDir := t.TempDir()
+
+		fsys, err := fsutil.NewBackupFS(os.DirFS(dir), backupDir, time.Hour, fsutil.WithSymlinkPolicy(fsutil.SymlinkSkip))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, name := range []string{"assets/link.css", "static"} {
+			if _, err := os.Lstat(filepath.Join(backupDir, name)); !os.IsNotExist(err) {
+				t.Errorf("got file %q stat error %v, want not exist", name, err)
+			}
+		}
+		if got, want := fsys.SkippedSymlinks(), []string{"assets/link.css", "static"}; fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("got skipped symlinks %v, want %v", got, want)
+		}
+	})
+}
+
+func TestBackupFS_permissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permissions are not supported on windows")
+	}
+
+	files := fstest.MapFS{
+		"assets":          {Mode: fs.ModeDir | 0o500},
+		"assets/main.css": {Data: []byte("body {}"), Mode: 0o440},
+		"index.html":      {Data: []byte("<html>"), Mode: 0o664},
+	}
+
+	for _, tc := range []struct {
+		name     string
+		opts     []fsutil.BackupFSOption
+		dirPerm  fs.FileMode
+		filePerm fs.FileMode
+		htmlPerm fs.FileMode
+	}{
+		{
+			name:     "mask",
+			opts:     []fsutil.BackupFSOption{fsutil.WithPermissionMask(0o077)},
+			dirPerm:  0o700,
+			filePerm: 0o600,
+			htmlPerm: 0o600,
+		},
+		{
+			name:     "fixed",
+			opts:     []fsutil.BackupFSOption{fsutil.WithFixedPermissions(0o644, 0o755)},
+			dirPerm:  0o755,
+			filePerm: 0o644,
+			htmlPerm: 0o644,
+		},
+		{
+			name:     "preserved",
+			opts:     []fsutil.BackupFSOption{fsutil.WithPreservedPermissions()},
+			dirPerm:  0o700,
+			filePerm: 0o440,
+			htmlPerm: 0o664,
+		},
+		{
+			name:     "lazy",
+			opts:     []fsutil.BackupFSOption{fsutil.WithFixedPermissions(0o640, 0o750), fsutil.WithLazyCopy()},
+			dirPerm:  0o750,
+			filePerm: 0o640,
+			htmlPerm: 0o640,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			backupDir := filepath.Join(t.TempDir(), "backup")
+
+			fsys, err := fsutil.NewBackupFS(files, backupDir, time.Hour, tc.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			<-fsys.Copied()
+			if err := fsys.Stats().CopyErr; err != nil {
+				t.Fatal(err)
+			}
+
+			for name, want := range map[string]fs.FileMode{
+				"assets":          tc.dirPerm,
+				"assets/main.css": tc.filePerm,
+				"index.html":      tc.htmlPerm,
+			} {
+				info, err := os.Stat(filepath.Join(backupDir, filepath.FromSlash(name)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := info.Mode().Perm(); got != want {
+					t.Errorf("got %s permissions %v, want %v", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestBackupFS_rootPermissions(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts []fsutil.BackupFSOption
+	}{
+		{name: "copy"},
+		{name: "lazy copy", opts: []fsutil.BackupFSOption{fsutil.WithLazyCopy()}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			parentDir := t.TempDir()
+			backupDir := filepath.Join(parentDir, "backup")
+
+			fsys, err := fsutil.NewBackupFS(assetsBackupFS, backupDir, time.Hour, tc.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case <-fsys.Copied():
+			case <-time.After(30 * time.Second):
+				t.Fatal("timeout waiting for files to be copied")
+			}
+
+			// The backup directory has the same permissions as directories
+			// created with all permissions limited by the process umask.
+			wantDir := filepath.Join(parentDir, "want")
+			if err := os.Mkdir(wantDir, 0o777); err != nil {
+				t.Fatal(err)
+			}
+			want, err := os.Stat(wantDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range []string{".", "assets"} {
+				info, err := os.Stat(filepath.Join(backupDir, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := info.Mode().Perm(); got != want.Mode().Perm() {
+					t.Errorf("got %s permissions %v, want %v", name, got, want.Mode().Perm())
+				}
+			}
+		})
+	}
+}
+
+func TestBackupFS_maxBackupBytes(t *testing.T) {
+	backupDir := t.TempDir()
+
+	size := int64(len("body { color: green; }"))
+
+	_, err := fsutil.NewBackupFS(assetsBackupFS, backupDir, time.Hour, fsutil.WithMaxBackupBytes(size-1))
+	var serr *fsutil.InsufficientSpaceError
+	if !errors.As(err, &serr) {
+		t.Fatalf("got error %v, want insufficient space error", err)
+	}
+	if serr.Required != size {
+		t.Errorf("got required %v, want %v", serr.Required, size)
+	}
+	if serr.Available != size-1 {
+		t.Errorf("got available %v, want %v", serr.Available, size-1)
+	}
+	if !errors.Is(err, fsutil.ErrInsufficientSpace) {
+		t.Errorf("error %v is not %v", err, fsutil.ErrInsufficientSpace)
+	}
+
+	if _, err := fsutil.NewBackupFS(assetsBackupFS, backupDir, time.Hour, fsutil.WithMaxBackupBytes(size)); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func backupFSFiles(t *testing.T) (fileName, fileContent string, fileInfo fs.FileInfo, dirEntries []fs.DirEntry) {
 	t.Helper()
 
@@ -388,7 +943,9 @@ func TestBackupFS_File_ReadDir(t *testing.T) {
 	})
 
 	t.Run("all after expire", func(t *testing.T) {
-		fsys, err := fsutil.NewBackupFS(os.DirFS(dir), backupDir, 0)
+		// The backup directory of the previous subtest is still used by its
+		// BackupFS, so it would not be removed on expiration.
+		fsys, err := fsutil.NewBackupFS(os.DirFS(dir), t.TempDir(), 0)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -427,6 +984,95 @@ func TestBackupFS_File_ReadDir(t *testing.T) {
 	})
 }
 
+func TestBackupFS_File_ReadDir_root(t *testing.T) {
+	dir := t.TempDir()
+	backupDir := t.TempDir()
+
+	for _, p := range []string{
+		filepath.Join(dir, "a.txt"),
+		filepath.Join(dir, "c", "x.txt"),
+		filepath.Join(backupDir, "b.txt"),
+		filepath.Join(backupDir, "c", "y.txt"),
+	} {
+		if err := os.MkdirAll(filepath.Dir(p), 0o777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(filepath.Base(p)), 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fsys, err := fsutil.NewBackupFS(os.DirFS(dir), backupDir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fstest.TestFS(fsys, "a.txt", "b.txt", "c/x.txt", "c/y.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("walk", func(t *testing.T) {
+		var got []string
+		if err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			got = append(got, path)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		want := []string{".", "a.txt", "b.txt", "c", "c/x.txt", "c/y.txt"}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("got paths %v, want %v", got, want)
+		}
+	})
+
+	t.Run("paging", func(t *testing.T) {
+		f, err := fsys.Open(".")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		fd := f.(fs.ReadDirFile)
+
+		var got []string
+		for {
+			r, err := fd.ReadDir(2)
+			if err == io.EOF {
+				if len(r) != 0 {
+					t.Errorf("got %v entries with io.EOF", len(r))
+				}
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(r) == 0 || len(r) > 2 {
+				t.Fatalf("got %v entries, want 1 or 2", len(r))
+			}
+			for _, e := range r {
+				got = append(got, e.Name())
+			}
+		}
+
+		want := []string{"a.txt", "b.txt", "c"}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("got entries %v, want %v", got, want)
+		}
+
+		r, err := fd.ReadDir(-1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(r) != 0 {
+			t.Errorf("got %v entries after the end of directory, want 0", len(r))
+		}
+	})
+}
+
 func Test_uniqueStrings(t *testing.T) {
 	for _, tc := range []struct {
 		name string
@@ -533,6 +1179,58 @@ func Test_uniqueDirEntry(t *testing.T) {
 	}
 }
 
+func Test_mergeDirEntries(t *testing.T) {
+	primary := dir("b")
+	secondary := dir("b")
+	for _, tc := range []struct {
+		name string
+		a, b []fs.DirEntry
+		want []fs.DirEntry
+	}{
+		{
+			name: "nil",
+		},
+		{
+			name: "only first",
+			a:    []fs.DirEntry{dir("a"), dir("b")},
+			want: []fs.DirEntry{dir("a"), dir("b")},
+		},
+		{
+			name: "only second",
+			b:    []fs.DirEntry{dir("a"), dir("b")},
+			want: []fs.DirEntry{dir("a"), dir("b")},
+		},
+		{
+			name: "interleaved",
+			a:    []fs.DirEntry{dir("a"), dir("c")},
+			b:    []fs.DirEntry{dir("b"), dir("d")},
+			want: []fs.DirEntry{dir("a"), dir("b"), dir("c"), dir("d")},
+		},
+		{
+			name: "duplicates",
+			a:    []fs.DirEntry{dir("a"), dir("b"), dir("b")},
+			b:    []fs.DirEntry{dir("b"), dir("c")},
+			want: []fs.DirEntry{dir("a"), dir("b"), dir("c")},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := fsutil.MergeDirEntries(tc.a, tc.b); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("mergeDirEntries() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	t.Run("first takes precedence", func(t *testing.T) {
+		got := fsutil.MergeDirEntries([]fs.DirEntry{dir("a"), primary}, []fs.DirEntry{secondary, dir("c")})
+		if len(got) != 3 {
+			t.Fatalf("got %v entries, want 3", len(got))
+		}
+		if got[1] != primary {
+			t.Error("duplicate entry is not from the first slice")
+		}
+	})
+}
+
 type dirEntry struct {
 	name string
 	fs.DirEntry
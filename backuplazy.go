@@ -0,0 +1,203 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// lazyCopy keeps track of files that are copied to the backup directory with
+// the WithLazyCopy option.
+type lazyCopy struct {
+	dir    string
+	tmpDir string
+	o      backupFSOptions
+
+	flights flightGroup    // copies of files in progress by path
+	active  sync.WaitGroup // copies that must complete before finish
+
+	copied   map[string]struct{}
+	finished bool
+	mu       sync.Mutex
+}
+
+func newLazyCopy(dir string, o backupFSOptions) (*lazyCopy, error) {
+	parent, base := filepath.Dir(dir), filepath.Base(dir)
+
+	if err := removeStaleBackupTempDirs(parent, base); err != nil {
+		return nil, fmt.Errorf("remove stale temporary directories: %w", err)
+	}
+	if err := o.mkdirAll(dir, 0o777); err != nil {
+		return nil, fmt.Errorf("create backup directory: %w", err)
+	}
+	tmpDir, err := mkdirBackupTemp(parent, base, o)
+	if err != nil {
+		return nil, fmt.Errorf("create temporary backup directory: %w", err)
+	}
+	return &lazyCopy{
+		dir:    dir,
+		tmpDir: tmpDir,
+		o:      o,
+		copied: make(map[string]struct{}),
+	}, nil
+}
+
+// copy creates a file in the temporary directory with the copyFunc and moves it
+// to the backup directory, if the file with the path is not already copied.
+// Concurrent copies of the same path are done only once, while different
+// paths are copied in parallel.
+func (l *lazyCopy) copy(path string, copyFunc func(tmpPath string) error) error {
+	if !l.begin(path) {
+		return nil
+	}
+	defer l.active.Done()
+
+	_, err := l.flights.do(path, func() (string, error) {
+		// The path may be copied by a call that completed in the meantime.
+		l.mu.Lock()
+		_, ok := l.copied[path]
+		l.mu.Unlock()
+		if ok {
+			return "", nil
+		}
+		if err := l.copyFile(path, copyFunc); err != nil {
+			return "", err
+		}
+		l.mu.Lock()
+		l.copied[path] = struct{}{}
+		l.mu.Unlock()
+		return "", nil
+	})
+	return err
+}
+
+// begin reports whether the file with the path needs to be copied and, if it
+// does, registers the copy so that finish waits for it.
+func (l *lazyCopy) begin(path string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.finished {
+		return false
+	}
+	if _, ok := l.copied[path]; ok {
+		return false
+	}
+	l.active.Add(1)
+	return true
+}
+
+// copyFile creates the file in the temporary directory with the copyFunc and
+// moves it to the backup directory.
+func (l *lazyCopy) copyFile(path string, copyFunc func(tmpPath string) error) error {
+	tmpPath := filepath.Join(l.tmpDir, l.o.backupName(path))
+	// Permissions of parent directories are set when they are copied.
+	perm, _ := l.o.backupDirPerm(0o777)
+	if err := os.MkdirAll(filepath.Dir(tmpPath), perm); err != nil {
+		return fmt.Errorf("create directory %s: %w", filepath.Dir(tmpPath), err)
+	}
+	if err := copyFunc(tmpPath); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(tmpPath); err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		// Nothing is created, for example a skipped symbolic link.
+		return nil
+	}
+	backupPath := filepath.Join(l.dir, l.o.backupName(path))
+	if err := os.MkdirAll(filepath.Dir(backupPath), perm); err != nil {
+		return fmt.Errorf("create directory %s: %w", filepath.Dir(backupPath), err)
+	}
+	return moveFiles(tmpPath, backupPath, false)
+}
+
+// finish marks that all files are copied, waits for copies in progress and
+// removes the temporary directory.
+func (l *lazyCopy) finish() error {
+	l.mu.Lock()
+	l.finished = true
+	l.mu.Unlock()
+
+	l.active.Wait()
+	return os.RemoveAll(l.tmpDir)
+}
+
+// copyOnAccess copies a regular file to the backup directory if it is not
+// already copied. Errors are recorded in stats and do not fail the access, as
+// the file is copied again by the background goroutine.
+func (s *BackupFS) copyOnAccess(name string) {
+	l := s.lazy
+	if l == nil || !fs.ValidPath(name) {
+		return
+	}
+	l.mu.Lock()
+	_, ok := l.copied[name]
+	finished := l.finished
+	l.mu.Unlock()
+	if ok || finished {
+		return
+	}
+
+	info, err := fs.Stat(s.fsys, name)
+	if err != nil || !info.Mode().IsRegular() {
+		return
+	}
+	// Only records the name if it is encoded, as lazyCopy creates the path.
+	_ = s.backupPath(l.dir, name, l.o)
+	if err := l.copy(name, func(tmpPath string) error {
+		return s.copyFile(name, tmpPath, l.o.linkDir, l.o)
+	}); err != nil {
+		s.statsMu.Lock()
+		s.copyStats.AccessCopyErr = err
+		s.statsMu.Unlock()
+	}
+}
+
+// copyRemaining checks the space for all files, copies the files that are not
+// copied on access and releases the lock when it is done.
+func (s *BackupFS) copyRemaining(lock *backupLock) {
+	l := s.lazy
+	start := l.o.clock.Now()
+
+	err := s.checkSpace(l.dir, l.o)
+	if err == nil {
+		err = fs.WalkDir(s.fsys, ".", func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				info, err := d.Info()
+				if err != nil {
+					return fmt.Errorf("directory info %s: %w", path, err)
+				}
+				return l.o.mkdirAll(s.backupPath(l.dir, path, l.o), info.Mode())
+			}
+			return l.copy(path, func(string) error {
+				return s.copyWalkFunc(l.tmpDir, l.o, 0)(path, d, nil)
+			})
+		})
+	}
+	if ferr := l.finish(); err == nil {
+		err = ferr
+	}
+	if rerr := lock.release(); err == nil {
+		err = rerr
+	}
+
+	s.statsMu.Lock()
+	s.copyStats.CopyDuration = l.o.clock.Now().Sub(start)
+	s.copyStats.CopyErr = err
+	s.statsMu.Unlock()
+
+	close(s.copied)
+}
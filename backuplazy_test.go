@@ -0,0 +1,213 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestBackupFS_lazyCopy(t *testing.T) {
+	dir := t.TempDir()
+	backupDir := t.TempDir()
+
+	files := map[string]string{
+		"index.html":      "<h1>Hello</h1>",
+		"assets/main.css": "body { color: red; }",
+		"assets/main.js":  "console.log('hello');",
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fsys, err := fsutil.NewBackupFS(os.DirFS(dir), backupDir, time.Hour, fsutil.WithLazyCopy())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testOpen(t, fsys, "assets/main.css", files["assets/main.css"])
+
+	data, err := os.ReadFile(filepath.Join(backupDir, "assets/main.css"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != files["assets/main.css"] {
+		t.Errorf("got content %q, want %q", string(data), files["assets/main.css"])
+	}
+
+	select {
+	case <-fsys.Copied():
+	case <-time.After(30 * time.Second):
+		t.Fatal("timeout waiting for files to be copied")
+	}
+
+	for name, content := range files {
+		data, err := os.ReadFile(filepath.Join(backupDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != content {
+			t.Errorf("got file %q content %q, want %q", name, string(data), content)
+		}
+	}
+
+	stats := fsys.Stats()
+	if stats.CopyErr != nil {
+		t.Errorf("got copy error %v", stats.CopyErr)
+	}
+	if stats.CopiedFiles != len(files) {
+		t.Errorf("got copied files %v, want %v", stats.CopiedFiles, len(files))
+	}
+
+	matches, err := filepath.Glob(backupDir + ".tmp-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 0 {
+		t.Errorf("got temporary directories %v", matches)
+	}
+	if _, err := os.Stat(backupDir + ".lock"); !os.IsNotExist(err) {
+		t.Errorf("got lock file stat error %v, want not exist", err)
+	}
+}
+
+func TestBackupFS_lazyCopy_maxBackupBytes(t *testing.T) {
+	backupDir := t.TempDir()
+
+	fsys, err := fsutil.NewBackupFS(fstest.MapFS{
+		"index.html": {Data: []byte("<h1>Hello</h1>")},
+	}, backupDir, time.Hour, fsutil.WithLazyCopy(), fsutil.WithMaxBackupBytes(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-fsys.Copied():
+	case <-time.After(30 * time.Second):
+		t.Fatal("timeout waiting for files to be copied")
+	}
+
+	var serr *fsutil.InsufficientSpaceError
+	if err := fsys.Stats().CopyErr; !errors.As(err, &serr) {
+		t.Fatalf("got copy error %v, want insufficient space error", err)
+	}
+	if serr.Required != int64(len("<h1>Hello</h1>")) || serr.Available != 1 {
+		t.Errorf("got required %v available %v, want %v and %v", serr.Required, serr.Available, len("<h1>Hello</h1>"), 1)
+	}
+	if _, err := os.Stat(filepath.Join(backupDir, "index.html")); !os.IsNotExist(err) {
+		t.Errorf("got stat error %v, want not exist", err)
+	}
+}
+
+func TestBackupFS_lazyCopy_concurrent(t *testing.T) {
+	dir := t.TempDir()
+	backupDir := t.TempDir()
+
+	names := []string{"a.txt", "b.txt", "c.txt"}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fsys, err := fsutil.NewBackupFS(os.DirFS(dir), backupDir, time.Hour, fsutil.WithLazyCopy())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		for _, name := range names {
+			wg.Add(1)
+			go func(name string) {
+				defer wg.Done()
+				data, err := fs.ReadFile(fsys, name)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if string(data) != name {
+					t.Errorf("got content %q, want %q", data, name)
+				}
+			}(name)
+		}
+	}
+	wg.Wait()
+
+	select {
+	case <-fsys.Copied():
+	case <-time.After(30 * time.Second):
+		t.Fatal("timeout waiting for files to be copied")
+	}
+
+	stats := fsys.Stats()
+	if stats.CopyErr != nil {
+		t.Errorf("got copy error %v", stats.CopyErr)
+	}
+	if stats.AccessCopyErr != nil {
+		t.Errorf("got access copy error %v", stats.AccessCopyErr)
+	}
+	if stats.CopiedFiles != len(names) {
+		t.Errorf("got copied files %v, want %v", stats.CopiedFiles, len(names))
+	}
+}
+
+func TestBackupFS_lazyCopy_accessError(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte("<html>"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	errOpen := errors.New("open error")
+
+	fsys, err := fsutil.NewBackupFS(failOpenFS{
+		StatFS: os.DirFS(dir).(fs.StatFS),
+		name:   "index.html",
+		err:    errOpen,
+	}, t.TempDir(), time.Hour, fsutil.WithLazyCopy())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fsys.Open("index.html"); err == nil {
+		t.Fatal("expected open error")
+	}
+	if err := fsys.Stats().AccessCopyErr; !errors.Is(err, errOpen) {
+		t.Errorf("got access copy error %v, want %v", err, errOpen)
+	}
+
+	<-fsys.Copied()
+	if err := fsys.Stats().CopyErr; !errors.Is(err, errOpen) {
+		t.Errorf("got copy error %v, want %v", err, errOpen)
+	}
+}
+
+// failOpenFS returns an error when the file with the name is opened, while its
+// other methods succeed.
+type failOpenFS struct {
+	fs.StatFS
+	name string
+	err  error
+}
+
+func (f failOpenFS) Open(name string) (fs.File, error) {
+	if name == f.name {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: f.err}
+	}
+	return f.StatFS.Open(name)
+}
@@ -0,0 +1,191 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// ErrBackupLocked is returned by NewBackupFS if the backup directory is locked
+// by another BackupFS and the WithSharedBackup option is not used.
+var ErrBackupLocked = errors.New("backup directory is locked")
+
+const (
+	// backupLockSuffix is appended to the backup directory path to construct
+	// the lock file path.
+	backupLockSuffix = ".lock"
+	// backupUsersSuffix is appended to the backup directory path to construct
+	// the path of the directory with markers of BackupFS instances that share
+	// the backup directory.
+	backupUsersSuffix = ".users"
+	// backupLockPollInterval is the interval between lock acquisition attempts.
+	backupLockPollInterval = 50 * time.Millisecond
+)
+
+// backupLock is an advisory lock on the backup directory. It is an operating
+// system lock on a file next to the backup directory, which is released by
+// the kernel if the process that holds it exits, so that locks are never left
+// behind by processes that crashed.
+type backupLock struct {
+	path string
+	f    *os.File
+}
+
+func newBackupLock(dir string) *backupLock {
+	return &backupLock{path: dir + backupLockSuffix}
+}
+
+// acquire locks the lock file, creating it if needed. If the lock is held by
+// another BackupFS and wait is false, ErrBackupLocked is returned, otherwise
+// acquire retries until the lock is released.
+func (l *backupLock) acquire(wait bool) error {
+	for {
+		f, err := os.OpenFile(l.path, os.O_CREATE|os.O_RDWR, 0o666)
+		if err != nil {
+			return fmt.Errorf("open lock file: %w", err)
+		}
+		locked, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("lock file: %w", err)
+		}
+		if !locked {
+			f.Close()
+			if !wait {
+				return ErrBackupLocked
+			}
+			time.Sleep(backupLockPollInterval)
+			continue
+		}
+		// The lock file is removed on release, so the locked file may not be
+		// the one at the path anymore if it was removed after it was opened.
+		if current, err := l.sameFile(f); err != nil || !current {
+			_ = unlockFile(f)
+			f.Close()
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		l.f = f
+		return nil
+	}
+}
+
+// release removes and unlocks the lock file. The file is removed while it is
+// still locked, so that waiting BackupFS instances that opened it detect that
+// it is not current anymore. Removal may fail on systems that do not allow
+// removing open files, which leaves the lock file to be reused.
+func (l *backupLock) release() error {
+	if l.f == nil {
+		return nil
+	}
+	_ = os.Remove(l.path)
+	err := unlockFile(l.f)
+	if cerr := l.f.Close(); err == nil {
+		err = cerr
+	}
+	l.f = nil
+	if err != nil {
+		return fmt.Errorf("unlock file: %w", err)
+	}
+	return nil
+}
+
+// sameFile reports whether the file f is the file at the lock path.
+func (l *backupLock) sameFile(f *os.File) (bool, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return false, fmt.Errorf("stat lock file: %w", err)
+	}
+	pathInfo, err := os.Stat(l.path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("stat lock file: %w", err)
+	}
+	return os.SameFile(info, pathInfo), nil
+}
+
+// backupUser is a marker of a BackupFS instance that uses the backup directory
+// until its expiration time. Every BackupFS records it, so that the backup
+// directory is never removed while another BackupFS uses it.
+type backupUser struct {
+	path string
+}
+
+// addBackupUser creates a marker for a BackupFS instance that uses the backup
+// directory until the expiration time. It must be called while holding the
+// backup lock.
+func addBackupUser(dir string, expires time.Time) (*backupUser, error) {
+	usersDir := dir + backupUsersSuffix
+	if err := os.MkdirAll(usersDir, 0o777); err != nil {
+		return nil, fmt.Errorf("create users directory: %w", err)
+	}
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("generate user id: %w", err)
+	}
+	path := filepath.Join(usersDir, strconv.Itoa(os.Getpid())+"-"+hex.EncodeToString(b))
+	if err := os.WriteFile(path, []byte(expires.UTC().Format(time.RFC3339Nano)), 0o666); err != nil {
+		return nil, fmt.Errorf("write user marker: %w", err)
+	}
+	return &backupUser{path: path}, nil
+}
+
+// remove removes the marker and reports if there are other BackupFS instances
+// that still use the backup directory. It must be called while holding the
+// backup lock.
+func (u *backupUser) remove() (othersActive bool, err error) {
+	if err := os.Remove(u.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, fmt.Errorf("remove user marker: %w", err)
+	}
+	return backupUsersActive(filepath.Dir(u.path))
+}
+
+// backupUsersActive reports if there are markers of BackupFS instances in the
+// users directory that did not expire. Markers of instances that expired are
+// ignored and removed, and the directory is removed if there are no active
+// markers. It must be called while holding the backup lock.
+func backupUsersActive(usersDir string) (active bool, err error) {
+	entries, err := os.ReadDir(usersDir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("read users directory: %w", err)
+	}
+	for _, e := range entries {
+		path := filepath.Join(usersDir, e.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return false, fmt.Errorf("read user marker: %w", err)
+		}
+		expires, err := time.Parse(time.RFC3339Nano, string(data))
+		if err == nil && time.Now().Before(expires) {
+			active = true
+			continue
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return false, fmt.Errorf("remove expired user marker: %w", err)
+		}
+	}
+	if !active {
+		if err := os.Remove(usersDir); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return false, fmt.Errorf("remove users directory: %w", err)
+		}
+	}
+	return active, nil
+}
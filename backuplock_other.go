@@ -0,0 +1,44 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux && !darwin && !freebsd && !openbsd && !netbsd && !dragonfly && !windows
+// +build !linux,!darwin,!freebsd,!openbsd,!netbsd,!dragonfly,!windows
+
+package fsutil
+
+import (
+	"os"
+	"sync"
+)
+
+// lockedFiles are the names of files locked by tryLockFile. File locking is
+// not used on this platform, so locks only exclude BackupFS instances in the
+// same process.
+var (
+	lockedFiles   = make(map[string]struct{})
+	lockedFilesMu sync.Mutex
+)
+
+// tryLockFile locks the file name within the process. It returns false if the
+// lock is already held.
+func tryLockFile(f *os.File) (bool, error) {
+	lockedFilesMu.Lock()
+	defer lockedFilesMu.Unlock()
+
+	if _, ok := lockedFiles[f.Name()]; ok {
+		return false, nil
+	}
+	lockedFiles[f.Name()] = struct{}{}
+	return true, nil
+}
+
+// unlockFile releases the lock acquired by tryLockFile.
+func unlockFile(f *os.File) error {
+	lockedFilesMu.Lock()
+	defer lockedFilesMu.Unlock()
+
+	delete(lockedFiles, f.Name())
+	return nil
+}
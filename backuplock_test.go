@@ -0,0 +1,136 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestBackupFS_locked(t *testing.T) {
+	backupDir := t.TempDir()
+
+	lockBackupDir(t, backupDir)
+
+	if _, err := fsutil.NewBackupFS(assetsBackupFS, backupDir, time.Hour); !errors.Is(err, fsutil.ErrBackupLocked) {
+		t.Fatalf("got error %v, want %v", err, fsutil.ErrBackupLocked)
+	}
+}
+
+func TestBackupFS_staleLock(t *testing.T) {
+	backupDir := t.TempDir()
+
+	// A lock file that is left behind, but not locked, does not block.
+	if err := os.WriteFile(backupDir+".lock", []byte("12345\n"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys, err := fsutil.NewBackupFS(assetsBackupFS, backupDir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fileName, fileContent, _, _ := backupFSFiles(t)
+
+	testOpen(t, fsys, fileName, fileContent)
+
+	if _, err := os.Stat(backupDir + ".lock"); !os.IsNotExist(err) {
+		t.Errorf("got lock file stat error %v, want not exist", err)
+	}
+}
+
+func TestBackupFS_shared(t *testing.T) {
+	backupDir := t.TempDir()
+
+	release := lockBackupDir(t, backupDir)
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_ = release()
+	}()
+
+	fsys1, err := fsutil.NewBackupFS(assetsBackupFS, backupDir, 10*time.Millisecond, fsutil.WithSharedBackup())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fsys2, err := fsutil.NewBackupFS(assetsBackupFS, backupDir, time.Hour, fsutil.WithSharedBackup())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-fsys1.Cleaned():
+		if err := fsys1.CleaningErr(); err != nil {
+			t.Errorf("clean error: %v", err)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("timeout waiting for backup to be cleaned")
+	}
+
+	fileName, fileContent, _, _ := backupFSFiles(t)
+
+	if _, err := os.Stat(filepath.Join(backupDir, fileName)); err != nil {
+		t.Fatalf("shared backup removed while in use: %v", err)
+	}
+
+	testOpen(t, fsys2, fileName, fileContent)
+}
+
+func TestBackupFS_reusedDir(t *testing.T) {
+	backupDir := t.TempDir()
+
+	fsys1, err := fsutil.NewBackupFS(assetsBackupFS, backupDir, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fsys2, err := fsutil.NewBackupFS(assetsBackupFS, backupDir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-fsys1.Cleaned():
+		if err := fsys1.CleaningErr(); err != nil {
+			t.Errorf("clean error: %v", err)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("timeout waiting for backup to be cleaned")
+	}
+
+	fileName, fileContent, _, _ := backupFSFiles(t)
+
+	if _, err := os.Stat(filepath.Join(backupDir, fileName)); err != nil {
+		t.Fatalf("backup removed while used by another instance: %v", err)
+	}
+
+	testOpen(t, fsys2, fileName, fileContent)
+}
+
+func lockBackupDir(t *testing.T, dir string) (release func() error) {
+	t.Helper()
+
+	unlock, err := fsutil.LockBackupDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var once sync.Once
+	release = func() (err error) {
+		once.Do(func() { err = unlock() })
+		return err
+	}
+	t.Cleanup(func() {
+		_ = release()
+	})
+	return release
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+)
+
+// CopyPlan describes files that NewBackupFS would copy to the backup
+// directory.
+type CopyPlan struct {
+	// Copy contains paths of files that would be copied, including symbolic
+	// links that would be recreated, in the order of copying.
+	Copy []string
+	// Skip contains paths of symbolic links that would not be copied because
+	// of the SymlinkSkip policy.
+	Skip []string
+	// Bytes is the total size of files that would be written. With the
+	// WithLinkDir option, files that are cloned or hard linked do not take
+	// this space.
+	Bytes int64
+	// AvailableBytes is the available space on the volume of the backup
+	// directory, or -1 if it can not be determined.
+	AvailableBytes int64
+}
+
+// Plan returns the plan of copying files from fsys to the backup directory dir
+// that NewBackupFS with the same options would execute, without writing
+// anything.
+func Plan(fsys fs.FS, dir string, opts ...BackupFSOption) (CopyPlan, error) {
+	dir = filepath.Clean(dir)
+	if !validateDir(dir) {
+		return CopyPlan{}, ErrUnsupportedDir
+	}
+
+	var o backupFSOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	plan, err := newCopyPlan(fsys, o)
+	if err != nil {
+		return CopyPlan{}, err
+	}
+	plan.AvailableBytes = -1
+	if available, ok := availableSpace(filepath.Dir(dir)); ok {
+		plan.AvailableBytes = available
+	}
+	return plan, nil
+}
+
+// newCopyPlan walks the filesystem in the same way as BackupFS copies files.
+func newCopyPlan(fsys fs.FS, o backupFSOptions) (plan CopyPlan, err error) {
+	err = fs.WalkDir(fsys, ".", planWalkFunc(fsys, o, &plan, 0))
+	return plan, err
+}
+
+func planWalkFunc(fsys fs.FS, o backupFSOptions, plan *CopyPlan, depth int) fs.WalkDirFunc {
+	return func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		if d.Type()&fs.ModeSymlink != 0 {
+			switch o.symlinkPolicy {
+			case SymlinkSkip:
+				plan.Skip = append(plan.Skip, path)
+				return nil
+			case SymlinkRecreate:
+				if _, ok := fsys.(readLinkFS); !ok {
+					return &fs.PathError{Op: "readlink", Path: path, Err: fs.ErrInvalid}
+				}
+				plan.Copy = append(plan.Copy, path)
+				return nil
+			default:
+				info, err := fs.Stat(fsys, path)
+				if err != nil {
+					return fmt.Errorf("stat link target %s: %w", path, err)
+				}
+				if info.IsDir() {
+					if depth >= maxSymlinkDepth {
+						return fmt.Errorf("follow link %s: too many levels of symbolic links", path)
+					}
+					return fs.WalkDir(fsys, path, planWalkFunc(fsys, o, plan, depth+1))
+				}
+				plan.Copy = append(plan.Copy, path)
+				plan.Bytes += info.Size()
+				return nil
+			}
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return fmt.Errorf("file info %s: %w", path, err)
+		}
+		plan.Copy = append(plan.Copy, path)
+		plan.Bytes += info.Size()
+		return nil
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestPlan(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.Mkdir(filepath.Join(dir, "assets"), 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte("<html>"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "assets", "main.css"), []byte("body { color: red; }"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	backupDir := filepath.Join(t.TempDir(), "backup")
+
+	plan, err := fsutil.Plan(os.DirFS(dir), backupDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCopyPlan(t, plan, []string{"assets/main.css", "index.html"}, nil, 26)
+	if plan.AvailableBytes == 0 {
+		t.Error("got no available bytes")
+	}
+	if _, err := os.Stat(backupDir); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got backup directory stat error %v, want %v", err, fs.ErrNotExist)
+	}
+
+	fsys, err := fsutil.NewBackupFS(os.DirFS(dir), backupDir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := fsys.Stats()
+	if stats.CopiedFiles != len(plan.Copy) {
+		t.Errorf("got %v copied files, planned %v", stats.CopiedFiles, len(plan.Copy))
+	}
+	if stats.CopiedBytes != plan.Bytes {
+		t.Errorf("got %v copied bytes, planned %v", stats.CopiedBytes, plan.Bytes)
+	}
+
+	if _, err := fsutil.Plan(os.DirFS(dir), "."); err == nil {
+		t.Error("expected error for unsupported directory")
+	}
+
+	t.Run("symlinks", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("symbolic links require privileges on windows")
+		}
+
+		if err := os.Symlink("main.css", filepath.Join(dir, "assets", "link.css")); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink("assets", filepath.Join(dir, "static")); err != nil {
+			t.Fatal(err)
+		}
+
+		plan, err := fsutil.Plan(os.DirFS(dir), backupDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testCopyPlan(t, plan, []string{"assets/link.css", "assets/main.css", "index.html", "static/link.css", "static/main.css"}, nil, 86)
+
+		plan, err = fsutil.Plan(os.DirFS(dir), backupDir, fsutil.WithSymlinkPolicy(fsutil.SymlinkSkip))
+		if err != nil {
+			t.Fatal(err)
+		}
+		testCopyPlan(t, plan, []string{"assets/main.css", "index.html"}, []string{"assets/link.css", "static"}, 26)
+	})
+}
+
+func testCopyPlan(t *testing.T, plan fsutil.CopyPlan, copy, skip []string, bytes int64) {
+	t.Helper()
+
+	if fmt.Sprint(plan.Copy) != fmt.Sprint(copy) {
+		t.Errorf("got copy %v, want %v", plan.Copy, copy)
+	}
+	if fmt.Sprint(plan.Skip) != fmt.Sprint(skip) {
+		t.Errorf("got skip %v, want %v", plan.Skip, skip)
+	}
+	if plan.Bytes != bytes {
+		t.Errorf("got bytes %v, want %v", plan.Bytes, bytes)
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Restore copies all files from the backup directory to the dst directory. It
+// is the same as calling RestoreBackup with the backup directory of this
+// BackupFS and, if the WithSafeNames option is used, the
+// WithRestoreSafeNames option.
+func (s *BackupFS) Restore(dst string) error {
+	var opts []RestoreBackupOption
+	if s.safeNames {
+		opts = append(opts, WithRestoreSafeNames())
+	}
+	return RestoreBackup(s.dir, dst, opts...)
+}
+
+// RestoreBackupOption sets an optional parameter of the RestoreBackup
+// function.
+type RestoreBackupOption func(*restoreBackupOptions)
+
+type restoreBackupOptions struct {
+	safeNames bool
+}
+
+// WithRestoreSafeNames makes RestoreBackup decode names of files in the backup
+// directory created with the WithSafeNames option, so that files are restored
+// under their original names. Restoring fails if a decoded name is not valid
+// on the operating system.
+func WithRestoreSafeNames() RestoreBackupOption {
+	return func(o *restoreBackupOptions) {
+		o.safeNames = true
+	}
+}
+
+// RestoreBackup copies all files from the backup directory dir, created by
+// NewBackupFS, to the dst directory, creating it if it does not exist. It can
+// be used to extract previous files when new files in the original filesystem
+// are broken, even if there is no BackupFS that uses the backup directory.
+// Files are copied to a temporary directory first and then moved to the dst
+// directory, so that no file in dst is partially written. Existing files in dst
+// with the same paths are replaced. The backup directory is locked while the
+// files are copied, so that it is not removed or changed by BackupFS.
+func RestoreBackup(dir, dst string, opts ...RestoreBackupOption) error {
+	var o restoreBackupOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	dir = filepath.Clean(dir)
+	if !validateDir(dir) {
+		return ErrUnsupportedDir
+	}
+	dst = filepath.Clean(dst)
+	if !validateDir(dst) {
+		return fmt.Errorf("destination: %w", ErrUnsupportedDir)
+	}
+	if dst == dir || strings.HasPrefix(dst, dir+string(os.PathSeparator)) {
+		return errors.New("destination directory is in the backup directory")
+	}
+
+	lock := newBackupLock(dir)
+	if err := lock.acquire(true); err != nil {
+		return fmt.Errorf("lock backup directory: %w", err)
+	}
+	err := restoreBackup(dir, dst, o)
+	if rerr := lock.release(); err == nil {
+		err = rerr
+	}
+	if err != nil {
+		return fmt.Errorf("restore backup: %w", err)
+	}
+	return nil
+}
+
+func restoreBackup(dir, dst string, o restoreBackupOptions) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("stat backup directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("backup directory %s: %w", dir, errNotDir)
+	}
+
+	parent, base := filepath.Dir(dst), filepath.Base(dst)
+	if err := os.MkdirAll(parent, 0o777); err != nil {
+		return fmt.Errorf("create destination parent directory: %w", err)
+	}
+	tmpDir, err := os.MkdirTemp(parent, base+backupTempPattern)
+	if err != nil {
+		return fmt.Errorf("create temporary destination directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if err := filepath.WalkDir(dir, restoreWalkFunc(dir, tmpDir, o)); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(dst); err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("stat destination directory: %w", err)
+		}
+		if err := os.Rename(tmpDir, dst); err != nil {
+			return fmt.Errorf("move temporary destination directory: %w", err)
+		}
+		return nil
+	}
+	return moveFiles(tmpDir, dst, false)
+}
+
+func restoreWalkFunc(dir, dst string, o restoreBackupOptions) fs.WalkDirFunc {
+	return func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if o.safeNames {
+			rel, err = decodeRestoreName(rel)
+			if err != nil {
+				return err
+			}
+		}
+		dstPath := filepath.Join(dst, rel)
+		if d.IsDir() {
+			if err := os.MkdirAll(dstPath, 0o777); err != nil {
+				return fmt.Errorf("create directory %s: %w", dstPath, err)
+			}
+			return nil
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			if err != nil {
+				return fmt.Errorf("read link %s: %w", path, err)
+			}
+			if err := os.Symlink(target, dstPath); err != nil {
+				return fmt.Errorf("create symlink %s: %w", dstPath, err)
+			}
+			return nil
+		}
+		return restoreFile(path, dstPath)
+	}
+}
+
+// decodeRestoreName decodes the operating system path relative to the backup
+// directory that is encoded with EncodeSafeName. Decoded paths that are not
+// valid fs.FS paths or that contain backslashes are rejected, so that files
+// are not restored outside of the destination directory.
+func decodeRestoreName(rel string) (string, error) {
+	name, err := DecodeSafeName(filepath.ToSlash(rel))
+	if err != nil {
+		return "", fmt.Errorf("decode name %s: %w", rel, err)
+	}
+	if !fs.ValidPath(name) || strings.Contains(name, `\`) {
+		return "", fmt.Errorf("decode name %s: %w: %q", rel, errInvalidSafeName, name)
+	}
+	return filepath.FromSlash(name), nil
+}
+
+// restoreFile copies a single file from the backup directory to the dstPath,
+// preserving its permissions.
+func restoreFile(path, dstPath string) error {
+	fr, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open backup file %s: %w", path, err)
+	}
+	defer fr.Close()
+
+	info, err := fr.Stat()
+	if err != nil {
+		return fmt.Errorf("backup file info %s: %w", path, err)
+	}
+	fw, err := os.OpenFile(dstPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("create file %s: %w", dstPath, err)
+	}
+
+	if _, err := io.Copy(fw, fr); err != nil {
+		fw.Close()
+		return fmt.Errorf("copy file data %s: %w", dstPath, err)
+	}
+	if err := fw.Close(); err != nil {
+		return fmt.Errorf("close file %s: %w", dstPath, err)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"embed"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestBackupFS_Restore(t *testing.T) {
+	backupDir := filepath.Join(t.TempDir(), "backup")
+
+	if _, err := fsutil.NewBackupFS(assetsBackupFS, backupDir, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	// The original filesystem does not have files from the backup anymore.
+	fsys, err := fsutil.NewBackupFS(new(embed.FS), backupDir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fileName, fileContent, _, _ := backupFSFiles(t)
+
+	t.Run("new directory", func(t *testing.T) {
+		dst := filepath.Join(t.TempDir(), "restored", "assets")
+
+		if err := fsys.Restore(dst); err != nil {
+			t.Fatal(err)
+		}
+
+		testReadFile(t, os.DirFS(dst).(fs.ReadFileFS), fileName, fileContent)
+	})
+
+	t.Run("existing directory", func(t *testing.T) {
+		dst := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dst, "other.txt"), []byte("other"), 0o666); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dst, filepath.FromSlash(fileName))), 0o777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dst, filepath.FromSlash(fileName)), []byte("broken"), 0o666); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := fsutil.RestoreBackup(backupDir, dst); err != nil {
+			t.Fatal(err)
+		}
+
+		dstFS := os.DirFS(dst).(fs.ReadFileFS)
+		testReadFile(t, dstFS, fileName, fileContent)
+		testReadFile(t, dstFS, "other.txt", "other")
+	})
+
+	t.Run("invalid destination", func(t *testing.T) {
+		for _, dst := range []string{".", backupDir, filepath.Join(backupDir, "assets")} {
+			if err := fsys.Restore(dst); err == nil {
+				t.Errorf("expected error for destination %q", dst)
+			}
+		}
+	})
+
+	t.Run("no backup", func(t *testing.T) {
+		dst := filepath.Join(t.TempDir(), "restored")
+
+		if err := fsutil.RestoreBackup(filepath.Join(t.TempDir(), "missing"), dst); err == nil {
+			t.Error("expected error")
+		}
+		if _, err := os.Stat(dst); err == nil {
+			t.Error("destination directory created")
+		}
+	})
+}
+
+func TestBackupFS_Restore_safeNames(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("decoded names are not valid on windows")
+	}
+
+	files := fstest.MapFS{
+		"aux/main.css": {Data: []byte("body {}")},
+		"docs/100%":    {Data: []byte("done")},
+	}
+	backupDir := filepath.Join(t.TempDir(), "backup")
+
+	fsys, err := fsutil.NewBackupFS(files, backupDir, time.Hour, fsutil.WithSafeNames())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("restore", func(t *testing.T) {
+		dst := filepath.Join(t.TempDir(), "restored")
+
+		if err := fsys.Restore(dst); err != nil {
+			t.Fatal(err)
+		}
+
+		dstFS := os.DirFS(dst).(fs.ReadFileFS)
+		testReadFile(t, dstFS, "aux/main.css", "body {}")
+		testReadFile(t, dstFS, "docs/100%", "done")
+	})
+
+	t.Run("restore backup", func(t *testing.T) {
+		dst := filepath.Join(t.TempDir(), "restored")
+
+		if err := fsutil.RestoreBackup(backupDir, dst); err != nil {
+			t.Fatal(err)
+		}
+		testReadFile(t, os.DirFS(dst).(fs.ReadFileFS), "%61ux/main.css", "body {}")
+
+		dst = filepath.Join(t.TempDir(), "restored")
+
+		if err := fsutil.RestoreBackup(backupDir, dst, fsutil.WithRestoreSafeNames()); err != nil {
+			t.Fatal(err)
+		}
+		testReadFile(t, os.DirFS(dst).(fs.ReadFileFS), "aux/main.css", "body {}")
+	})
+
+	t.Run("invalid name", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTestFile(t, filepath.Join(dir, "%2E%2E", "escaped.txt"), "escaped")
+		dst := filepath.Join(t.TempDir(), "restored")
+
+		if err := fsutil.RestoreBackup(dir, dst, fsutil.WithRestoreSafeNames()); err == nil {
+			t.Error("expected error")
+		}
+		if _, err := os.Stat(filepath.Join(dst, "..", "escaped.txt")); err == nil {
+			t.Error("file restored outside of the destination directory")
+		}
+	})
+}
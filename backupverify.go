@@ -0,0 +1,141 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+// ErrBackupMismatch is the error for a file in the backup directory that has a
+// different content than the file in the original filesystem.
+var ErrBackupMismatch = errors.New("backup file content mismatch")
+
+// VerifyError is returned by BackupFS.Verify and it contains all files in the
+// backup directory that do not match files in the original filesystem.
+type VerifyError struct {
+	Files []VerifyFileError
+}
+
+// VerifyFileError describes why a file in the backup directory does not match
+// the file in the original filesystem.
+type VerifyFileError struct {
+	Path string
+	Err  error
+}
+
+// Error implements error interface.
+func (e *VerifyError) Error() string {
+	return e.fileErrors().message("backup verification failed for ")
+}
+
+// Is reports whether an error of any file matches the target.
+func (e *VerifyError) Is(target error) bool {
+	return e.fileErrors().is(target)
+}
+
+// As finds the first error of a file that matches the target.
+func (e *VerifyError) As(target interface{}) bool {
+	return e.fileErrors().as(target)
+}
+
+func (e *VerifyError) fileErrors() fileErrors {
+	errs := make(fileErrors, 0, len(e.Files))
+	for _, f := range e.Files {
+		errs = append(errs, fileError(f))
+	}
+	return errs
+}
+
+// Verify compares all files from the original filesystem with the files in the
+// backup directory. If any of the files is missing or has a different content,
+// for example if it is truncated, a *VerifyError is returned. Other files in
+// the backup directory are not checked as they are preserved from previous
+// backups.
+func (s *BackupFS) Verify() error {
+	var verr VerifyError
+	if err := fs.WalkDir(s.fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if err := s.verifyFile(path); err != nil {
+			var ferr *verifyFileErr
+			if !errors.As(err, &ferr) {
+				return err
+			}
+			verr.Files = append(verr.Files, VerifyFileError{Path: path, Err: ferr.err})
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("verify backup: %w", err)
+	}
+	if len(verr.Files) > 0 {
+		return &verr
+	}
+	return nil
+}
+
+// verifyFileErr distinguishes backup file problems from errors while reading
+// the original filesystem.
+type verifyFileErr struct {
+	err error
+}
+
+func (e *verifyFileErr) Error() string {
+	return e.err.Error()
+}
+
+func (s *BackupFS) verifyFile(path string) error {
+	fr, err := s.fsys.Open(path)
+	if err != nil {
+		return fmt.Errorf("open file %s: %w", path, err)
+	}
+	defer fr.Close()
+
+	br, err := s.backup.Open(path)
+	if err != nil {
+		return &verifyFileErr{err: err}
+	}
+	defer br.Close()
+
+	equal, err := equalContent(fr, br)
+	if err != nil {
+		return fmt.Errorf("compare file %s: %w", path, err)
+	}
+	if !equal {
+		return &verifyFileErr{err: ErrBackupMismatch}
+	}
+	return nil
+}
+
+// equalContent reports whether two readers have the same content.
+func equalContent(r1, r2 io.Reader) (bool, error) {
+	const bufSize = 32 * 1024
+	b1 := make([]byte, bufSize)
+	b2 := make([]byte, bufSize)
+	for {
+		n1, err1 := io.ReadFull(r1, b1)
+		if err1 != nil && !errors.Is(err1, io.EOF) && !errors.Is(err1, io.ErrUnexpectedEOF) {
+			return false, err1
+		}
+		n2, err2 := io.ReadFull(r2, b2)
+		if err2 != nil && !errors.Is(err2, io.EOF) && !errors.Is(err2, io.ErrUnexpectedEOF) {
+			return false, err2
+		}
+		if !bytes.Equal(b1[:n1], b2[:n2]) {
+			return false, nil
+		}
+		if err1 != nil || err2 != nil {
+			return err1 != nil && err2 != nil, nil
+		}
+	}
+}
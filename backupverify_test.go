@@ -0,0 +1,76 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestBackupFS_Verify(t *testing.T) {
+	dir := t.TempDir()
+	backupDir := t.TempDir()
+
+	for name, content := range map[string]string{
+		"index.html":      "<h1>Hello</h1>",
+		"assets/main.css": "body { color: red; }",
+		"assets/main.js":  "console.log('hello');",
+	} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fsys, err := fsutil.NewBackupFS(os.DirFS(dir), backupDir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fsys.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(backupDir, "assets/main.css"), []byte("body {"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(backupDir, "index.html")); err != nil {
+		t.Fatal(err)
+	}
+
+	err = fsys.Verify()
+	var verr *fsutil.VerifyError
+	if !errors.As(err, &verr) {
+		t.Fatalf("got error %v, want verify error", err)
+	}
+	if len(verr.Files) != 2 {
+		t.Fatalf("got %v files, want 2", len(verr.Files))
+	}
+	if f := verr.Files[0]; f.Path != "assets/main.css" || !errors.Is(f.Err, fsutil.ErrBackupMismatch) {
+		t.Errorf("got file %q error %v, want %q error %v", f.Path, f.Err, "assets/main.css", fsutil.ErrBackupMismatch)
+	}
+	if f := verr.Files[1]; f.Path != "index.html" || !errors.Is(f.Err, fs.ErrNotExist) {
+		t.Errorf("got file %q error %v, want %q error %v", f.Path, f.Err, "index.html", fs.ErrNotExist)
+	}
+	if !errors.Is(err, fsutil.ErrBackupMismatch) {
+		t.Errorf("error %v is not %v", err, fsutil.ErrBackupMismatch)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("error %v is not %v", err, fs.ErrNotExist)
+	}
+	var perr *fs.PathError
+	if !errors.As(err, &perr) || perr.Path != "index.html" {
+		t.Errorf("got path error %v, want path error for %q", perr, "index.html")
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"resenje.org/fsutil"
+	"resenje.org/fsutil/fstestutil"
+)
+
+// Synthetic trees used by benchmarks, representative of static website
+// assets, a single large directory and a backup of many small files.
+var (
+	benchmarkAssetsTree = fstestutil.Tree{
+		Dirs:        20,
+		FilesPerDir: 50,
+		FileSize:    4 * 1024,
+		Extensions:  []string{"css", "js", "png", "svg"},
+	}
+	benchmarkLargeDirTree = fstestutil.Tree{
+		FilesPerDir: 1000,
+	}
+	benchmarkSmallFilesTree = fstestutil.Tree{
+		Dirs:        10,
+		FilesPerDir: 50,
+		FileSize:    4 * 1024,
+	}
+)
+
+func BenchmarkHashFSOpen(b *testing.B) {
+	files := benchmarkAssetsTree.MapFS()
+	fsys := fsutil.NewHashFS(files, fsutil.NewMD5Hasher(8))
+	paths := benchmarkAssetsTree.Paths()
+	hashedPaths := make([]string, len(paths))
+	for i, p := range paths {
+		h, err := fsys.HashedPath(p)
+		if err != nil {
+			b.Fatal(err)
+		}
+		hashedPaths[i] = h
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f, err := fsys.Open(hashedPaths[i%len(hashedPaths)])
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := io.Copy(io.Discard, f); err != nil {
+			b.Fatal(err)
+		}
+		f.Close()
+	}
+}
+
+func BenchmarkBackupFSReadDir(b *testing.B) {
+	dir := b.TempDir()
+	if err := benchmarkLargeDirTree.Write(dir); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		opts []fsutil.BackupFSOption
+	}{
+		{name: "default"},
+		{name: "cache", opts: []fsutil.BackupFSOption{fsutil.WithReadDirCache()}},
+	} {
+		fsys, err := fsutil.NewBackupFS(os.DirFS(dir), filepath.Join(b.TempDir(), "backup"), time.Hour, tc.opts...)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(tc.name+"/ReadDir", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := fsys.ReadDir("."); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(tc.name+"/File.ReadDir", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				f, err := fsys.Open(".")
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := f.(fs.ReadDirFile).ReadDir(-1); err != nil {
+					b.Fatal(err)
+				}
+				f.Close()
+			}
+		})
+	}
+}
+
+func BenchmarkCopyFS(b *testing.B) {
+	files := benchmarkSmallFilesTree.MapFS()
+
+	for _, tc := range []struct {
+		name string
+		opts []fsutil.CopyFSOption
+	}{
+		{name: "copy"},
+		{name: "dedupe", opts: []fsutil.CopyFSOption{fsutil.WithCopyDedupe(fsutil.NewMD5Hasher(8))}},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			root := b.TempDir()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				dst := filepath.Join(root, strconv.Itoa(i))
+				if _, err := fsutil.CopyFS(dst, files, tc.opts...); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// TestAllocationBudget fails if hot paths that are optimized to avoid
+// allocations regress, as measured by the benchmarks above. Budgets are
+// set with a margin over the measured values, so that they do not depend on
+// the Go version.
+func TestAllocationBudget(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping allocation budget in short mode")
+	}
+
+	t.Run("HashFS Open", func(t *testing.T) {
+		files := benchmarkAssetsTree.MapFS()
+		fsys := fsutil.NewHashFS(files, fsutil.NewMD5Hasher(8))
+		p, err := fsys.HashedPath(benchmarkAssetsTree.Paths()[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		allocs := testing.AllocsPerRun(100, func() {
+			f, err := fsys.Open(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+		})
+		if budget := 20.0; allocs > budget {
+			t.Errorf("got %v allocations, want at most %v", allocs, budget)
+		}
+	})
+
+	t.Run("BackupFS cached ReadDir", func(t *testing.T) {
+		files := benchmarkLargeDirTree.MapFS()
+		fsys, err := fsutil.NewBackupFS(files, filepath.Join(t.TempDir(), "backup"), time.Hour, fsutil.WithReadDirCache())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fsys.ReadDir("."); err != nil {
+			t.Fatal(err)
+		}
+		allocs := testing.AllocsPerRun(100, func() {
+			if _, err := fsys.ReadDir("."); err != nil {
+				t.Fatal(err)
+			}
+		})
+		// only the copy of cached entries is allocated
+		if budget := 2.0; allocs > budget {
+			t.Errorf("got %v allocations, want at most %v", allocs, budget)
+		}
+	})
+}
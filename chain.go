@@ -0,0 +1,281 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"errors"
+	"io/fs"
+	"time"
+)
+
+var (
+	_ fs.FS         = (*ChainFS)(nil)
+	_ fs.GlobFS     = (*ChainFS)(nil)
+	_ fs.ReadDirFS  = (*ChainFS)(nil)
+	_ fs.ReadFileFS = (*ChainFS)(nil)
+	_ fs.StatFS     = (*ChainFS)(nil)
+	_ fs.SubFS      = (*ChainFS)(nil)
+	_ ReadLinkFS    = (*ChainFS)(nil)
+)
+
+// ErrNotInChain is returned by ChainFS methods that require a wrapper that was
+// not added to the chain.
+var ErrNotInChain = errors.New("wrapper not in chain")
+
+// ChainBuilder composes filesystem wrappers around a base filesystem. Wrappers
+// are added with its methods, each accepting the options of the wrapper's
+// constructor, and they are applied by Build in a fixed order, regardless of
+// the order in which the methods are called, from the innermost one:
+//
+//	Retry, Timeout, Cache, Filter, Hash, MimeTypes, Count, Limit, Validate
+//
+// so that transient errors of the base filesystem are retried within the
+// timeout, metadata is cached before it is used for filtering and hashing,
+// usage is counted by the names that clients request and invalid paths are
+// rejected before any other work is done. Adding the same wrapper more than
+// once replaces its previous options.
+type ChainBuilder struct {
+	fsys fs.FS
+
+	retry      []RetryFSOption
+	hasRetry   bool
+	timeout    time.Duration
+	cacheTTL   time.Duration
+	keepDir    func(dir string) (bool, error)
+	hasher     Hasher
+	hashOpts   []HashFSOption
+	mimeOpts   []MimeTypeFSOption
+	hasMime    bool
+	count      bool
+	maxOpen    int
+	limitOpts  []LimitFSOption
+	validation []PathValidationFSOption
+	hasValid   bool
+}
+
+// Chain returns a new ChainBuilder for wrappers around the fsys filesystem.
+func Chain(fsys fs.FS) *ChainBuilder {
+	return &ChainBuilder{fsys: fsys}
+}
+
+// Retry adds RetryFS to the chain.
+func (b *ChainBuilder) Retry(opts ...RetryFSOption) *ChainBuilder {
+	b.retry = opts
+	b.hasRetry = true
+	return b
+}
+
+// Timeout adds TimeoutFS to the chain.
+func (b *ChainBuilder) Timeout(timeout time.Duration) *ChainBuilder {
+	b.timeout = timeout
+	return b
+}
+
+// Cache adds StatCacheFS to the chain.
+func (b *ChainBuilder) Cache(ttl time.Duration) *ChainBuilder {
+	b.cacheTTL = ttl
+	return b
+}
+
+// Filter adds a wrapper that returns fs.ErrNotExist for directories for which
+// the keep function returns false, with the same semantics as NoDirsFS and
+// OnlyDirsWithIndexHTMLFS.
+func (b *ChainBuilder) Filter(keep func(dir string) (bool, error)) *ChainBuilder {
+	b.keepDir = keep
+	return b
+}
+
+// Hash adds HashFS to the chain.
+func (b *ChainBuilder) Hash(hasher Hasher, opts ...HashFSOption) *ChainBuilder {
+	b.hasher = hasher
+	b.hashOpts = opts
+	return b
+}
+
+// MimeTypes adds MimeTypeFS to the chain.
+func (b *ChainBuilder) MimeTypes(opts ...MimeTypeFSOption) *ChainBuilder {
+	b.mimeOpts = opts
+	b.hasMime = true
+	return b
+}
+
+// Count adds CountingFS to the chain.
+func (b *ChainBuilder) Count() *ChainBuilder {
+	b.count = true
+	return b
+}
+
+// Limit adds LimitFS to the chain.
+func (b *ChainBuilder) Limit(maxOpen int, opts ...LimitFSOption) *ChainBuilder {
+	b.maxOpen = maxOpen
+	b.limitOpts = opts
+	return b
+}
+
+// Validate adds PathValidationFS to the chain.
+func (b *ChainBuilder) Validate(opts ...PathValidationFSOption) *ChainBuilder {
+	b.validation = opts
+	b.hasValid = true
+	return b
+}
+
+// Build constructs the wrappers and returns the resulting filesystem.
+func (b *ChainBuilder) Build() *ChainFS {
+	c := new(ChainFS)
+	fsys := b.fsys
+	if b.hasRetry {
+		fsys = NewRetryFS(fsys, b.retry...)
+	}
+	if b.timeout > 0 {
+		fsys = NewTimeoutFS(fsys, b.timeout)
+	}
+	if b.cacheTTL > 0 {
+		c.cache = NewStatCacheFS(fsys, b.cacheTTL)
+		fsys = c.cache
+	}
+	if b.keepDir != nil {
+		fsys = filterDirsFS(fsys, b.keepDir)
+	}
+	if b.hasher != nil {
+		c.hash = NewHashFS(fsys, b.hasher, b.hashOpts...)
+		fsys = c.hash
+	}
+	if b.hasMime {
+		c.mime = NewMimeTypeFS(fsys, b.mimeOpts...)
+		fsys = c.mime
+	}
+	if b.count {
+		c.counting = NewCountingFS(fsys)
+		fsys = c.counting
+	}
+	if b.maxOpen > 0 {
+		fsys = NewLimitFS(fsys, b.maxOpen, b.limitOpts...)
+	}
+	if b.hasValid {
+		c.validation = NewPathValidationFS(fsys, b.validation...)
+		fsys = c.validation
+	}
+	c.fsys = fsys
+	return c
+}
+
+// ChainFS is a filesystem constructed by ChainBuilder. It implements all
+// optional interfaces of the io/fs package and exposes the methods of the
+// wrappers in the chain. Methods of wrappers that are not in the chain return
+// errors that wrap ErrNotInChain.
+type ChainFS struct {
+	fsys fs.FS
+
+	cache      *StatCacheFS
+	hash       *HashFS
+	mime       *MimeTypeFS
+	counting   *CountingFS
+	validation *PathValidationFS
+}
+
+// Open implements fs.FS interface.
+func (s *ChainFS) Open(name string) (fs.File, error) {
+	return s.fsys.Open(name)
+}
+
+// Glob implements fs.GlobFS interface.
+func (s *ChainFS) Glob(pattern string) ([]string, error) {
+	return fs.Glob(s.fsys, pattern)
+}
+
+// ReadDir implements fs.ReadDirFS interface.
+func (s *ChainFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(s.fsys, name)
+}
+
+// ReadFile implements fs.ReadFileFS interface.
+func (s *ChainFS) ReadFile(name string) ([]byte, error) {
+	return fs.ReadFile(s.fsys, name)
+}
+
+// Stat implements fs.StatFS interface.
+func (s *ChainFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(s.fsys, name)
+}
+
+// ReadLink implements ReadLinkFS interface.
+func (s *ChainFS) ReadLink(name string) (string, error) {
+	return ReadLink(s.fsys, name)
+}
+
+// Lstat implements ReadLinkFS interface.
+func (s *ChainFS) Lstat(name string) (fs.FileInfo, error) {
+	return Lstat(s.fsys, name)
+}
+
+// Sub implements fs.SubFS interface.
+func (s *ChainFS) Sub(dir string) (fs.FS, error) {
+	return newSubFS(s, dir)
+}
+
+// Unwrap returns the outermost wrapper in the chain, or the base filesystem
+// if there are no wrappers.
+func (s *ChainFS) Unwrap() fs.FS {
+	return s.fsys
+}
+
+// HashedPath returns the path with the content hash of the named file as
+// HashFS does.
+func (s *ChainFS) HashedPath(name string) (string, error) {
+	if s.hash == nil {
+		return "", &fs.PathError{Op: "hashedpath", Path: name, Err: ErrNotInChain}
+	}
+	return s.hash.HashedPath(name)
+}
+
+// ContentType returns the content type of the named file as MimeTypeFS does.
+func (s *ChainFS) ContentType(name string) (string, error) {
+	if s.mime == nil {
+		return "", &fs.PathError{Op: "contenttype", Path: name, Err: ErrNotInChain}
+	}
+	return s.mime.ContentType(name)
+}
+
+// Counts returns usage counts of files as CountingFS does.
+func (s *ChainFS) Counts() (map[string]FileCounts, error) {
+	if s.counting == nil {
+		return nil, &fs.PathError{Op: "counts", Path: ".", Err: ErrNotInChain}
+	}
+	return s.counting.Counts(), nil
+}
+
+// Validate returns PathValidationError if the path violates any of the rules
+// of PathValidationFS.
+func (s *ChainFS) Validate(name string) error {
+	if s.validation == nil {
+		return &fs.PathError{Op: "validate", Path: name, Err: ErrNotInChain}
+	}
+	return s.validation.Validate(name)
+}
+
+// Invalidate removes cached information about the named file from the
+// StatCacheFS and HashFS in the chain.
+func (s *ChainFS) Invalidate(name string) error {
+	if s.cache == nil && s.hash == nil {
+		return &fs.PathError{Op: "invalidate", Path: name, Err: ErrNotInChain}
+	}
+	if s.cache != nil {
+		s.cache.Invalidate(name)
+	}
+	if s.hash != nil {
+		return s.hash.Invalidate(name)
+	}
+	return nil
+}
+
+// Close closes the HashFS in the chain, saving its hash cache. It is a no-op
+// if there is no HashFS in the chain.
+func (s *ChainFS) Close() error {
+	if s.hash == nil {
+		return nil
+	}
+	return s.hash.Close()
+}
@@ -0,0 +1,154 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"errors"
+	"io/fs"
+	"reflect"
+	"testing"
+	"time"
+
+	"resenje.org/fsutil"
+	"resenje.org/fsutil/fstestutil"
+)
+
+func TestChain(t *testing.T) {
+	files := fsutil.MapFS{
+		"index.html":      {Data: []byte("<html>")},
+		"css/app.css":     {Data: []byte("body{}")},
+		"private/key.txt": {Data: []byte("secret")},
+	}
+
+	fsys := fsutil.Chain(files).
+		Validate(fsutil.WithBannedComponents("private")).
+		Count().
+		Hash(fsutil.NewMD5Hasher(8)).
+		Cache(time.Minute).
+		MimeTypes().
+		Limit(10).
+		Retry().
+		Timeout(time.Second).
+		Build()
+
+	hashFS := fsutil.NewHashFS(files, fsutil.NewMD5Hasher(8))
+	wantHashed, err := hashFS.HashedPath("css/app.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashed, err := fsys.HashedPath("css/app.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hashed != wantHashed {
+		t.Errorf("got hashed path %q, want %q", hashed, wantHashed)
+	}
+
+	fstestutil.RunFSConformance(t, fsys, []string{"css", hashed})
+
+	testReadFile(t, fsys, hashed, "body{}")
+	if _, err := fsys.Open("private/key.txt"); !errors.Is(err, fsutil.ErrPathNotAllowed) {
+		t.Errorf("got error %v, want %v", err, fsutil.ErrPathNotAllowed)
+	}
+
+	typ, err := fsys.ContentType(hashed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "text/css; charset=utf-8"; typ != want {
+		t.Errorf("got content type %q, want %q", typ, want)
+	}
+
+	var verr *fsutil.PathValidationError
+	if err := fsys.Validate("private/key.txt"); !errors.As(err, &verr) {
+		t.Errorf("got validation error %v, want %T", err, verr)
+	}
+
+	counts, err := fsys.Counts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := counts[hashed].Opens; got == 0 {
+		t.Errorf("got no opens of %q in counts %v", hashed, counts)
+	}
+
+	if err := fsys.Invalidate("css/app.css"); err != nil {
+		t.Fatal(err)
+	}
+
+	var h *fsutil.HashFS
+	if !fsutil.As(fsys, &h) {
+		t.Fatal("hash filesystem not found in the chain")
+	}
+	var l *fsutil.LimitFS
+	if !fsutil.As(fsys, &l) {
+		t.Fatal("limit filesystem not found in the chain")
+	}
+
+	if err := fsys.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChain_order(t *testing.T) {
+	files := fsutil.MapFS{
+		"index.html": {Data: []byte("<html>")},
+	}
+
+	var got []string
+	for _, fsys := range []fs.FS{
+		fsutil.Chain(files).Validate().Count().Cache(time.Minute).Build(),
+		fsutil.Chain(files).Cache(time.Minute).Count().Validate().Build(),
+	} {
+		var chain []string
+		for f := fsutil.Unwrap(fsys); f != nil; f = fsutil.Unwrap(f) {
+			chain = append(chain, reflect.TypeOf(f).String())
+		}
+		if got != nil && !reflect.DeepEqual(chain, got) {
+			t.Errorf("got chain %v, want %v", chain, got)
+		}
+		got = chain
+	}
+	want := []string{"*fsutil.PathValidationFS", "*fsutil.CountingFS", "*fsutil.StatCacheFS", "fsutil.MapFS"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got chain %v, want %v", got, want)
+	}
+}
+
+func TestChain_notInChain(t *testing.T) {
+	files := fsutil.MapFS{
+		"index.html":  {Data: []byte("<html>")},
+		"css/app.css": {Data: []byte("body{}")},
+	}
+	fsys := fsutil.Chain(files).Filter(func(string) (bool, error) { return false, nil }).Build()
+
+	testReadFile(t, fsys, "index.html", "<html>")
+	testStatNotExist(t, fsys, "css")
+
+	if _, err := fsys.HashedPath("index.html"); !errors.Is(err, fsutil.ErrNotInChain) {
+		t.Errorf("got error %v, want %v", err, fsutil.ErrNotInChain)
+	}
+	if _, err := fsys.ContentType("index.html"); !errors.Is(err, fsutil.ErrNotInChain) {
+		t.Errorf("got error %v, want %v", err, fsutil.ErrNotInChain)
+	}
+	_, err := fsys.Counts()
+	if !errors.Is(err, fsutil.ErrNotInChain) {
+		t.Errorf("got error %v, want %v", err, fsutil.ErrNotInChain)
+	}
+	var pathErr *fs.PathError
+	if !errors.As(err, &pathErr) {
+		t.Errorf("got error %v, want path error", err)
+	}
+	if err := fsys.Validate("index.html"); !errors.Is(err, fsutil.ErrNotInChain) {
+		t.Errorf("got error %v, want %v", err, fsutil.ErrNotInChain)
+	}
+	if err := fsys.Invalidate("index.html"); !errors.Is(err, fsutil.ErrNotInChain) {
+		t.Errorf("got error %v, want %v", err, fsutil.ErrNotInChain)
+	}
+	if err := fsys.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+// ChecksumFormat defines the format of the checksums manifest.
+type ChecksumFormat int
+
+const (
+	// ChecksumFormatSum is the format of sha256sum and similar utilities, a
+	// line with the hash, two spaces and the file path for every file. Paths
+	// with backslash or new line characters are escaped in the same way as
+	// these utilities do.
+	ChecksumFormatSum ChecksumFormat = iota
+	// ChecksumFormatJSON is a JSON object with file paths as keys and hashes
+	// as values.
+	ChecksumFormatJSON
+)
+
+// ErrChecksumMismatch is the error for a file that has a different hash than
+// the one in the checksums manifest.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// ChecksumError is returned by VerifyChecksums and it contains all files that
+// do not match their checksums.
+type ChecksumError struct {
+	Files []ChecksumFileError
+}
+
+// ChecksumFileError describes why a file does not match its checksum.
+type ChecksumFileError struct {
+	Path string
+	Err  error
+}
+
+// Error implements error interface.
+func (e *ChecksumError) Error() string {
+	return e.fileErrors().message("checksum verification failed for ")
+}
+
+// Is reports whether an error of any file matches the target.
+func (e *ChecksumError) Is(target error) bool {
+	return e.fileErrors().is(target)
+}
+
+// As finds the first error of a file that matches the target.
+func (e *ChecksumError) As(target interface{}) bool {
+	return e.fileErrors().as(target)
+}
+
+func (e *ChecksumError) fileErrors() fileErrors {
+	errs := make(fileErrors, 0, len(e.Files))
+	for _, f := range e.Files {
+		errs = append(errs, fileError(f))
+	}
+	return errs
+}
+
+// WriteChecksums writes hashes of all regular files in the filesystem to w in
+// the format. Files are written in lexical order. With SHA256Hasher and the
+// hash length of 64, the ChecksumFormatSum output can be verified with the
+// sha256sum utility.
+func WriteChecksums(w io.Writer, fsys fs.FS, h Hasher, format ChecksumFormat) error {
+	var paths, hashes []string
+	if err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		hash, err := checksumFile(fsys, path, h)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, path)
+		hashes = append(hashes, hash)
+		return nil
+	}); err != nil {
+		return fmt.Errorf("write checksums: %w", err)
+	}
+
+	switch format {
+	case ChecksumFormatSum:
+		bw := bufio.NewWriter(w)
+		for i, path := range paths {
+			if strings.ContainsAny(path, "\\\n") {
+				bw.WriteString("\\")
+				path = checksumPathReplacer.Replace(path)
+			}
+			bw.WriteString(hashes[i])
+			bw.WriteString("  ")
+			bw.WriteString(path)
+			bw.WriteString("\n")
+		}
+		if err := bw.Flush(); err != nil {
+			return fmt.Errorf("write checksums: %w", err)
+		}
+	case ChecksumFormatJSON:
+		m := make(map[string]string, len(paths))
+		for i, path := range paths {
+			m[path] = hashes[i]
+		}
+		data, err := json.MarshalIndent(m, "", "  ")
+		if err != nil {
+			return fmt.Errorf("write checksums: %w", err)
+		}
+		if _, err := w.Write(append(data, '\n')); err != nil {
+			return fmt.Errorf("write checksums: %w", err)
+		}
+	default:
+		return fmt.Errorf("write checksums: unsupported format %v", format)
+	}
+	return nil
+}
+
+// VerifyChecksums reads the checksums manifest from r in the format and
+// compares the hashes with the hashes of files in the filesystem. If any of
+// the files is missing or has a different hash, a *ChecksumError is returned.
+// Files that are not in the manifest are not checked.
+func VerifyChecksums(r io.Reader, fsys fs.FS, h Hasher, format ChecksumFormat) error {
+	var paths, hashes []string
+	switch format {
+	case ChecksumFormatSum:
+		scanner := bufio.NewScanner(r)
+		for n := 1; scanner.Scan(); n++ {
+			line := scanner.Text()
+			if line == "" {
+				continue
+			}
+			escaped := strings.HasPrefix(line, "\\")
+			if escaped {
+				line = line[1:]
+			}
+			i := strings.Index(line, " ")
+			if i <= 0 || i+1 >= len(line) || (line[i+1] != ' ' && line[i+1] != '*') {
+				return fmt.Errorf("verify checksums: invalid line %v", n)
+			}
+			path := line[i+2:]
+			if escaped {
+				path = checksumPathUnreplacer.Replace(path)
+			}
+			paths = append(paths, path)
+			hashes = append(hashes, line[:i])
+		}
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("verify checksums: %w", err)
+		}
+	case ChecksumFormatJSON:
+		var m map[string]string
+		if err := json.NewDecoder(r).Decode(&m); err != nil {
+			return fmt.Errorf("verify checksums: %w", err)
+		}
+		for path := range m {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			hashes = append(hashes, m[path])
+		}
+	default:
+		return fmt.Errorf("verify checksums: unsupported format %v", format)
+	}
+
+	var cerr ChecksumError
+	for i, path := range paths {
+		hash, err := checksumFile(fsys, path, h)
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				return fmt.Errorf("verify checksums: %w", err)
+			}
+			cerr.Files = append(cerr.Files, ChecksumFileError{Path: path, Err: fs.ErrNotExist})
+			continue
+		}
+		if hash != hashes[i] {
+			cerr.Files = append(cerr.Files, ChecksumFileError{Path: path, Err: ErrChecksumMismatch})
+		}
+	}
+	if len(cerr.Files) > 0 {
+		return &cerr
+	}
+	return nil
+}
+
+var (
+	checksumPathReplacer   = strings.NewReplacer("\\", "\\\\", "\n", "\\n")
+	checksumPathUnreplacer = strings.NewReplacer("\\\\", "\\", "\\n", "\n")
+)
+
+// checksumFile computes the hash of the named file content with the hasher.
+func checksumFile(fsys fs.FS, path string, h Hasher) (string, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	hash, err := hashFileContent(h, f, info)
+	if err != nil {
+		return "", fmt.Errorf("hash file %s: %w", path, err)
+	}
+	return hash, nil
+}
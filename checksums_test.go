@@ -0,0 +1,153 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"resenje.org/fsutil"
+)
+
+func TestWriteChecksums(t *testing.T) {
+	files := fstest.MapFS{
+		"index.html":    {Data: []byte("<html>")},
+		"css/main.css":  {Data: []byte("body{}")},
+		"empty":         {Mode: fs.ModeDir},
+		"link":          {Data: []byte("index.html"), Mode: fs.ModeSymlink},
+		"odd\\name.css": {Data: []byte("body{}")},
+	}
+	hasher := fsutil.NewSHA256Hasher(64)
+
+	t.Run("sum", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := fsutil.WriteChecksums(&buf, files, hasher, fsutil.ChecksumFormatSum); err != nil {
+			t.Fatal(err)
+		}
+		want := "7c98040a541657584690ae2a1cc3b42a8b53b159cc60c5d3abbfecbaeac6c94a  css/main.css\n" +
+			"b7d082ee12e91b756ea22e8513b8594eebcf5d39fab813da3cb55794dc888ad7  index.html\n" +
+			"\\7c98040a541657584690ae2a1cc3b42a8b53b159cc60c5d3abbfecbaeac6c94a  odd\\\\name.css\n"
+		if got := buf.String(); got != want {
+			t.Errorf("got checksums %q, want %q", got, want)
+		}
+
+		if err := fsutil.VerifyChecksums(&buf, files, hasher, fsutil.ChecksumFormatSum); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := fsutil.WriteChecksums(&buf, files, hasher, fsutil.ChecksumFormatJSON); err != nil {
+			t.Fatal(err)
+		}
+		want := `{
+  "css/main.css": "7c98040a541657584690ae2a1cc3b42a8b53b159cc60c5d3abbfecbaeac6c94a",
+  "index.html": "b7d082ee12e91b756ea22e8513b8594eebcf5d39fab813da3cb55794dc888ad7",
+  "odd\\name.css": "7c98040a541657584690ae2a1cc3b42a8b53b159cc60c5d3abbfecbaeac6c94a"
+}
+`
+		if got := buf.String(); got != want {
+			t.Errorf("got checksums %q, want %q", got, want)
+		}
+
+		if err := fsutil.VerifyChecksums(&buf, files, hasher, fsutil.ChecksumFormatJSON); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("sha256sum", func(t *testing.T) {
+		sha256sum, err := exec.LookPath("sha256sum")
+		if err != nil {
+			t.Skip("sha256sum not found")
+		}
+
+		dir := t.TempDir()
+		for name, f := range map[string]string{"index.html": "<html>", "css/main.css": "body{}"} {
+			p := filepath.Join(dir, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(p), 0o777); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(p, []byte(f), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var buf bytes.Buffer
+		if err := fsutil.WriteChecksums(&buf, os.DirFS(dir), hasher, fsutil.ChecksumFormatSum); err != nil {
+			t.Fatal(err)
+		}
+
+		cmd := exec.Command(sha256sum, "--check", "--strict", "-")
+		cmd.Dir = dir
+		cmd.Stdin = &buf
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Errorf("sha256sum: %v: %s", err, out)
+		}
+	})
+}
+
+func TestVerifyChecksums(t *testing.T) {
+	files := fstest.MapFS{
+		"index.html":   {Data: []byte("<html>")},
+		"css/main.css": {Data: []byte("body{color:red}")},
+		"extra.js":     {Data: []byte("alert()")},
+	}
+	hasher := fsutil.NewSHA256Hasher(64)
+
+	manifest := "7c98040a541657584690ae2a1cc3b42a8b53b159cc60c5d3abbfecbaeac6c94a  css/main.css\n" +
+		"b7d082ee12e91b756ea22e8513b8594eebcf5d39fab813da3cb55794dc888ad7 *index.html\n" +
+		"\n" +
+		"b7d082ee12e91b756ea22e8513b8594eebcf5d39fab813da3cb55794dc888ad7  missing.html\n"
+
+	err := fsutil.VerifyChecksums(strings.NewReader(manifest), files, hasher, fsutil.ChecksumFormatSum)
+	var cerr *fsutil.ChecksumError
+	if !errors.As(err, &cerr) {
+		t.Fatalf("got error %v, want %T", err, cerr)
+	}
+	want := []fsutil.ChecksumFileError{
+		{Path: "css/main.css", Err: fsutil.ErrChecksumMismatch},
+		{Path: "missing.html", Err: fs.ErrNotExist},
+	}
+	if len(cerr.Files) != len(want) {
+		t.Fatalf("got files %v, want %v", cerr.Files, want)
+	}
+	for i, f := range cerr.Files {
+		if f.Path != want[i].Path || !errors.Is(f.Err, want[i].Err) {
+			t.Errorf("got file %v, want %v", f, want[i])
+		}
+	}
+	if !errors.Is(err, fsutil.ErrChecksumMismatch) {
+		t.Errorf("got error %v, want %v", err, fsutil.ErrChecksumMismatch)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got error %v, want %v", err, fs.ErrNotExist)
+	}
+
+	for _, manifest := range []string{
+		"b7d082ee12e91b756ea22e8513b8594eebcf5d39fab813da3cb55794dc888ad7\n",
+		"b7d082ee12e91b756ea22e8513b8594eebcf5d39fab813da3cb55794dc888ad7 index.html\n",
+	} {
+		err := fsutil.VerifyChecksums(strings.NewReader(manifest), files, hasher, fsutil.ChecksumFormatSum)
+		if err == nil || errors.As(err, &cerr) {
+			t.Errorf("got error %v for invalid manifest %q", err, manifest)
+		}
+	}
+
+	if err := fsutil.VerifyChecksums(strings.NewReader("{"), files, hasher, fsutil.ChecksumFormatJSON); err == nil {
+		t.Error("expected error for invalid json")
+	}
+	if err := fsutil.VerifyChecksums(strings.NewReader(""), files, hasher, fsutil.ChecksumFormat(-1)); err == nil {
+		t.Error("expected error for unsupported format")
+	}
+}
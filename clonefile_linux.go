@@ -0,0 +1,41 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"os"
+	"syscall"
+)
+
+// ficlone is the FICLONE ioctl request number.
+const ficlone = 0x40049409
+
+// cloneFile creates a copy-on-write clone of the file at the src path, if the
+// filesystem supports it.
+func cloneFile(src, dst string) error {
+	fr, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer fr.Close()
+
+	info, err := fr.Stat()
+	if err != nil {
+		return err
+	}
+
+	fw, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, info.Mode().Perm()|permUserWrite)
+	if err != nil {
+		return err
+	}
+
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fw.Fd(), ficlone, fr.Fd()); errno != 0 {
+		fw.Close()
+		os.Remove(dst)
+		return errno
+	}
+	return fw.Close()
+}
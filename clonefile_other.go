@@ -0,0 +1,17 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package fsutil
+
+import "errors"
+
+// cloneFile creates a copy-on-write clone of the file at the src path, if the
+// filesystem supports it.
+func cloneFile(src, dst string) error {
+	return errors.New("file cloning not supported")
+}
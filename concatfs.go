@@ -0,0 +1,272 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	_ fs.FS         = (*ConcatFS)(nil)
+	_ fs.GlobFS     = (*ConcatFS)(nil)
+	_ fs.ReadDirFS  = (*ConcatFS)(nil)
+	_ fs.ReadFileFS = (*ConcatFS)(nil)
+	_ fs.StatFS     = (*ConcatFS)(nil)
+	_ fs.SubFS      = (*ConcatFS)(nil)
+	_ ReadLinkFS    = (*ConcatFS)(nil)
+)
+
+// ConcatFS is a filesystem with virtual files that are concatenations of
+// files from another filesystem. All other files are served from the
+// underlying filesystem. The intended usage is simple bundling of CSS and
+// JavaScript files. As opening a bundle returns its concatenated content,
+// ConcatFS can be used with HashFS to hash bundles.
+//
+// File info of a bundle reports the combined size of all files in it and the
+// latest modification time of them. Bundles with files that do not exist are
+// not listed in directories, while opening them returns an error that wraps
+// fs.ErrNotExist.
+type ConcatFS struct {
+	fsys    fs.FS
+	bundles map[string][]string
+}
+
+// NewConcatFS returns a new instance of ConcatFS with bundles defined as a map
+// from the virtual file path to the ordered list of file paths that are
+// concatenated.
+func NewConcatFS(fsys fs.FS, bundles map[string][]string) *ConcatFS {
+	return &ConcatFS{
+		fsys:    fsys,
+		bundles: bundles,
+	}
+}
+
+// Open implements fs.FS interface.
+func (s *ConcatFS) Open(name string) (fs.File, error) {
+	files, ok := s.bundles[name]
+	if !ok {
+		if !s.isVirtualDir(name) {
+			return s.fsys.Open(name)
+		}
+		// Directories with bundles are listed with them.
+		info, err := s.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+		entries, err := s.ReadDir(name)
+		if err != nil {
+			return nil, err
+		}
+		return newMemDir(name, info, entries), nil
+	}
+	data, err := s.concat(files)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	info, err := s.stat(name, files)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	info.size = int64(len(data))
+	return newMemFile(name, info, data), nil
+}
+
+// Glob implements fs.GlobFS interface.
+func (s *ConcatFS) Glob(pattern string) ([]string, error) {
+	return fs.Glob(readDirFS{FSFunc: s.Open, readDir: s.ReadDir}, pattern)
+}
+
+// ReadDir implements fs.ReadDirFS interface.
+func (s *ConcatFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := fs.ReadDir(s.fsys, name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err != nil && !s.isVirtualDir(name) {
+		return nil, err
+	}
+	for bundle, files := range s.bundles {
+		dir := path.Dir(bundle)
+		if dir == name {
+			info, err := s.stat(bundle, files)
+			if errors.Is(err, fs.ErrNotExist) {
+				// Bundles that can not be resolved are not listed.
+				continue
+			}
+			if err != nil {
+				return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+			}
+			entries = setDirEntry(entries, info)
+			continue
+		}
+		// Add virtual parent directories of bundles.
+		for ; dir != "."; dir = path.Dir(dir) {
+			if path.Dir(dir) != name {
+				continue
+			}
+			if !hasDirEntry(entries, path.Base(dir)) {
+				entries = append(entries, virtualDirInfo(dir))
+			}
+			break
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// ReadFile implements fs.ReadFileFS interface.
+func (s *ConcatFS) ReadFile(name string) ([]byte, error) {
+	files, ok := s.bundles[name]
+	if !ok {
+		return fs.ReadFile(s.fsys, name)
+	}
+	data, err := s.concat(files)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: err}
+	}
+	return data, nil
+}
+
+// Stat implements fs.StatFS interface.
+func (s *ConcatFS) Stat(name string) (fs.FileInfo, error) {
+	files, ok := s.bundles[name]
+	if !ok {
+		info, err := fs.Stat(s.fsys, name)
+		if err != nil && errors.Is(err, fs.ErrNotExist) && s.isVirtualDir(name) {
+			return virtualDirInfo(name), nil
+		}
+		return info, err
+	}
+	info, err := s.stat(name, files)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return info, nil
+}
+
+// ReadLink implements ReadLinkFS interface. Bundles are not symbolic links.
+func (s *ConcatFS) ReadLink(name string) (string, error) {
+	if _, ok := s.bundles[name]; ok {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return ReadLink(s.fsys, name)
+}
+
+// Lstat implements ReadLinkFS interface.
+func (s *ConcatFS) Lstat(name string) (fs.FileInfo, error) {
+	if _, ok := s.bundles[name]; ok {
+		return s.Stat(name)
+	}
+	info, err := Lstat(s.fsys, name)
+	if err != nil && errors.Is(err, fs.ErrNotExist) && s.isVirtualDir(name) {
+		return virtualDirInfo(name), nil
+	}
+	return info, err
+}
+
+// Sub implements fs.SubFS interface.
+func (s *ConcatFS) Sub(dir string) (fs.FS, error) {
+	return newSubFS(s, dir)
+}
+
+// Unwrap returns the underlying filesystem.
+func (s *ConcatFS) Unwrap() fs.FS {
+	return s.fsys
+}
+
+func (s *ConcatFS) concat(files []string) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, name := range files {
+		if err := s.copyFile(&buf, name); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *ConcatFS) copyFile(w io.Writer, name string) error {
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return fmt.Errorf("open bundled file %s: %w", name, err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(w, f); err != nil {
+		return fmt.Errorf("read bundled file %s: %w", name, err)
+	}
+	return nil
+}
+
+func (s *ConcatFS) stat(name string, files []string) (*memFileInfo, error) {
+	var size int64
+	var modTime time.Time
+	for _, f := range files {
+		info, err := fs.Stat(s.fsys, f)
+		if err != nil {
+			return nil, fmt.Errorf("stat bundled file %s: %w", f, err)
+		}
+		size += info.Size()
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	return &memFileInfo{
+		name:    path.Base(name),
+		size:    size,
+		mode:    0o444,
+		modTime: modTime,
+	}, nil
+}
+
+// isVirtualDir reports whether the directory with the name contains bundles.
+func (s *ConcatFS) isVirtualDir(name string) bool {
+	if name == "." {
+		return true
+	}
+	for bundle := range s.bundles {
+		if strings.HasPrefix(bundle, name+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func virtualDirInfo(name string) *memFileInfo {
+	return &memFileInfo{
+		name: path.Base(name),
+		mode: fs.ModeDir | 0o555,
+	}
+}
+
+// setDirEntry replaces the entry with the same name or appends it.
+func setDirEntry(entries []fs.DirEntry, e fs.DirEntry) []fs.DirEntry {
+	for i, x := range entries {
+		if x.Name() == e.Name() {
+			entries[i] = e
+			return entries
+		}
+	}
+	return append(entries, e)
+}
+
+func hasDirEntry(entries []fs.DirEntry, name string) bool {
+	for _, e := range entries {
+		if e.Name() == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestConcatFS(t *testing.T) {
+	modTime := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	fsys := fsutil.NewConcatFS(fsutil.MapFS{
+		"css/reset.css": {Data: []byte("* { margin: 0; }\n"), ModTime: modTime},
+		"css/theme.css": {Data: []byte("body { color: red; }\n"), ModTime: modTime.Add(time.Hour)},
+		"js/app.js":     {Data: []byte("app();\n")},
+	}, map[string][]string{
+		"css/bundle.css":     {"css/reset.css", "css/theme.css"},
+		"dist/bundle.min.js": {"js/app.js", "js/app.js"},
+		"broken/all.css":     {"css/missing.css"},
+		"css/broken.css":     {"css/reset.css", "css/missing.css"},
+	})
+
+	wantCSS := "* { margin: 0; }\nbody { color: red; }\n"
+
+	testOpen(t, fsys, "css/bundle.css", wantCSS)
+	testOpen(t, fsys, "css/reset.css", "* { margin: 0; }\n")
+	testOpen(t, fsys, "dist/bundle.min.js", "app();\napp();\n")
+	testReadFile(t, fsys, "css/bundle.css", wantCSS)
+	testGlob(t, fsys, "*/*.css", []string{"css/bundle.css", "css/reset.css", "css/theme.css"})
+	testGlob(t, fsys, "dist/*", []string{"dist/bundle.min.js"})
+	testGlob(t, fsys, "*", []string{"broken", "css", "dist", "js"})
+
+	info, err := fsys.Stat("css/bundle.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != int64(len(wantCSS)) {
+		t.Errorf("got size %v, want %v", info.Size(), len(wantCSS))
+	}
+	if !info.ModTime().Equal(modTime.Add(time.Hour)) {
+		t.Errorf("got mod time %v, want %v", info.ModTime(), modTime.Add(time.Hour))
+	}
+
+	if _, err := fsys.Open("broken/all.css"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got error %v, want %v", err, fs.ErrNotExist)
+	}
+
+	t.Run("read dir with missing bundled files", func(t *testing.T) {
+		for dir, want := range map[string][]string{
+			"css":    {"bundle.css", "reset.css", "theme.css"},
+			"broken": nil,
+		} {
+			entries, err := fs.ReadDir(fsys, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, e := range entries {
+				got = append(got, e.Name())
+			}
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("got entries %v in %s, want %v", got, dir, want)
+			}
+		}
+	})
+
+	t.Run("fstest", func(t *testing.T) {
+		fsys := fsutil.NewConcatFS(fsutil.MapFS{
+			"css/reset.css": {Data: []byte("* { margin: 0; }\n")},
+			"css/theme.css": {Data: []byte("body { color: red; }\n")},
+		}, map[string][]string{
+			"css/bundle.css":  {"css/reset.css", "css/theme.css"},
+			"dist/bundle.css": {"css/reset.css", "css/theme.css"},
+		})
+		if err := fstest.TestFS(fsys, "css/bundle.css", "dist/bundle.css", "css/reset.css"); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("hashfs", func(t *testing.T) {
+		hfs := fsutil.NewHashFS(fsys, fsutil.NewMD5Hasher(8))
+
+		sum := md5.Sum([]byte(wantCSS))
+		want := fmt.Sprintf("css/bundle.%s.css", hex.EncodeToString(sum[:])[:8])
+
+		testHashedPath(t, hfs, "css/bundle.css", want)
+		testOpen(t, hfs, want, wantCSS)
+	})
+}
@@ -0,0 +1,38 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// copyBufferSize is the size of buffers used to copy file data, larger than
+// the io.Copy default to reduce the number of read and write calls.
+const copyBufferSize = 256 * 1024
+
+var copyBufferPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, copyBufferSize)
+		return &b
+	},
+}
+
+// copyFileData copies data from the reader to the file with a buffer from the
+// pool, instead of allocating a new buffer for every file. If the reader is an
+// *os.File, the copy is left to the operating system, which may copy data
+// without passing it through user space.
+func copyFileData(dst *os.File, src io.Reader) (int64, error) {
+	if _, ok := src.(*os.File); ok {
+		return io.Copy(dst, src)
+	}
+	b := copyBufferPool.Get().(*[]byte)
+	defer copyBufferPool.Put(b)
+	// os.File implements io.ReaderFrom which would make io.CopyBuffer ignore
+	// the buffer, so only its Write method is exposed.
+	return io.CopyBuffer(struct{ io.Writer }{dst}, src, *b)
+}
@@ -0,0 +1,210 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// CopyReport describes files that are copied by CopyFS.
+type CopyReport struct {
+	// Files is the number of copied files, including duplicates.
+	Files int
+	// Bytes is the total size of copied files, including duplicates.
+	Bytes int64
+	// Duplicates maps paths of files with the same content as a file that is
+	// copied before them to the path of that file. It is set only with the
+	// WithCopyDedupe or WithCopyDedupeReport options.
+	Duplicates map[string]string
+	// LinkedBytes is the total size of duplicates that are hard linked
+	// instead of copied.
+	LinkedBytes int64
+}
+
+// CopyFSOption sets an optional parameter of the CopyFS function.
+type CopyFSOption func(*copyFSOptions)
+
+type copyFSOptions struct {
+	hasher      Hasher
+	link        bool
+	preallocate bool
+}
+
+// WithCopyDedupe makes CopyFS hard link files with the same content as a
+// previously copied file to that file, instead of copying the content again.
+// Files with the same size and hash computed by the hasher are considered to
+// have the same content. Duplicates are reported in CopyReport. If a hard link
+// can not be created, for example if the filesystem does not support it, the
+// file is copied.
+//
+// Hard linked files share their content and permissions, so modifying one of
+// them changes all of them.
+func WithCopyDedupe(h Hasher) CopyFSOption {
+	return func(o *copyFSOptions) {
+		o.hasher = h
+		o.link = true
+	}
+}
+
+// WithCopyDedupeReport makes CopyFS report files with the same content in
+// CopyReport without hard linking them. Files with the same size and hash
+// computed by the hasher are considered to have the same content.
+func WithCopyDedupeReport(h Hasher) CopyFSOption {
+	return func(o *copyFSOptions) {
+		o.hasher = h
+		o.link = false
+	}
+}
+
+// WithCopyPreallocate makes CopyFS reserve disk space for the whole content of
+// every file before copying it, where the operating system supports it, which
+// reduces fragmentation of large files. Files are copied even if the space can
+// not be reserved.
+func WithCopyPreallocate() CopyFSOption {
+	return func(o *copyFSOptions) {
+		o.preallocate = true
+	}
+}
+
+// CopyFS copies the file tree of the filesystem into the directory dir,
+// creating it if necessary. Files are created with mode 0o666 plus any
+// execute permissions from the source, and directories are created with mode
+// 0o777, both before the umask. Existing files are not overwritten and
+// CopyFS returns an error for them. Symbolic links and other files that are
+// not regular files or directories are not supported and CopyFS returns an
+// error that wraps fs.ErrInvalid for them.
+func CopyFS(dir string, fsys fs.FS, opts ...CopyFSOption) (CopyReport, error) {
+	var o copyFSOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	c := &fsCopier{
+		fsys:   fsys,
+		dir:    dir,
+		o:      o,
+		hashes: make(map[copyContentKey]string),
+	}
+	if o.hasher != nil {
+		c.report.Duplicates = make(map[string]string)
+	}
+	if err := fs.WalkDir(fsys, ".", c.walk); err != nil {
+		return c.report, err
+	}
+	return c.report, nil
+}
+
+// copyContentKey identifies files with the same content.
+type copyContentKey struct {
+	size int64
+	hash string
+}
+
+// fsCopier holds the state of CopyFS.
+type fsCopier struct {
+	fsys   fs.FS
+	dir    string
+	o      copyFSOptions
+	hashes map[copyContentKey]string // paths of the first files with the content
+	report CopyReport
+}
+
+func (c *fsCopier) walk(path string, d fs.DirEntry, err error) error {
+	if err != nil {
+		return err
+	}
+	dst := filepath.Join(c.dir, filepath.FromSlash(path))
+	if d.IsDir() {
+		if err := os.MkdirAll(dst, 0o777); err != nil {
+			return fmt.Errorf("create directory %s: %w", dst, err)
+		}
+		return nil
+	}
+	if !d.Type().IsRegular() {
+		return &fs.PathError{Op: "copy", Path: path, Err: fs.ErrInvalid}
+	}
+
+	info, err := d.Info()
+	if err != nil {
+		return fmt.Errorf("file info %s: %w", path, err)
+	}
+
+	if c.o.hasher != nil {
+		original, err := c.duplicateOf(path, info)
+		if err != nil {
+			return err
+		}
+		if original != "" {
+			c.report.Duplicates[path] = original
+			if c.o.link && os.Link(filepath.Join(c.dir, filepath.FromSlash(original)), dst) == nil {
+				c.report.Files++
+				c.report.Bytes += info.Size()
+				c.report.LinkedBytes += info.Size()
+				return nil
+			}
+		}
+	}
+
+	n, err := c.copyFile(path, dst, info)
+	if err != nil {
+		return err
+	}
+	c.report.Files++
+	c.report.Bytes += n
+	return nil
+}
+
+// duplicateOf returns the path of the previously copied file with the same
+// content, or an empty string if there is no such file, in which case the
+// file is recorded as the first one with its content.
+func (c *fsCopier) duplicateOf(path string, info fs.FileInfo) (string, error) {
+	f, err := c.fsys.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("open file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	hash, err := hashFileContent(c.o.hasher, f, info)
+	if err != nil {
+		return "", fmt.Errorf("hash file %s: %w", path, err)
+	}
+	key := copyContentKey{size: info.Size(), hash: hash}
+	if original, ok := c.hashes[key]; ok {
+		return original, nil
+	}
+	c.hashes[key] = path
+	return "", nil
+}
+
+func (c *fsCopier) copyFile(path, dst string, info fs.FileInfo) (int64, error) {
+	fr, err := c.fsys.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("open file %s: %w", path, err)
+	}
+	defer fr.Close()
+
+	fw, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o666|info.Mode()&0o111)
+	if err != nil {
+		return 0, fmt.Errorf("create file %s: %w", dst, err)
+	}
+
+	if c.o.preallocate {
+		_ = preallocate(fw, info.Size())
+	}
+
+	n, err := copyFileData(fw, fr)
+	if err != nil {
+		_ = fw.Close()
+		return n, fmt.Errorf("copy file data %s: %w", dst, err)
+	}
+	if err := fw.Close(); err != nil {
+		return n, fmt.Errorf("close file %s: %w", dst, err)
+	}
+	return n, nil
+}
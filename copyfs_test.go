@@ -0,0 +1,146 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"resenje.org/fsutil"
+)
+
+func TestCopyFS(t *testing.T) {
+	files := fstest.MapFS{
+		"index.html":           {Data: []byte("<html>")},
+		"bin/run.sh":           {Data: []byte("#!/bin/sh"), Mode: 0o755},
+		"vendor/a/jquery.js":   {Data: []byte("jquery()")},
+		"vendor/b/jquery.js":   {Data: []byte("jquery()")},
+		"vendor/c/jquery.js":   {Data: []byte("jquery()")},
+		"vendor/d/lodash.js":   {Data: []byte("lodash()")},
+		"vendor/e/lodash.js":   {Data: []byte("lodash(1)")},
+		"empty/.keep":          {},
+		"vendor/e/.gitignore":  {},
+		"vendor/f/placeholder": {Data: []byte{}},
+	}
+
+	for _, tc := range []struct {
+		name       string
+		opts       []fsutil.CopyFSOption
+		duplicates map[string]string
+		linked     bool
+	}{
+		{
+			name: "copy",
+		},
+		{
+			name: "dedupe report",
+			opts: []fsutil.CopyFSOption{fsutil.WithCopyDedupeReport(fsutil.NewMD5Hasher(8))},
+			duplicates: map[string]string{
+				"vendor/b/jquery.js":   "vendor/a/jquery.js",
+				"vendor/c/jquery.js":   "vendor/a/jquery.js",
+				"vendor/e/.gitignore":  "empty/.keep",
+				"vendor/f/placeholder": "empty/.keep",
+			},
+		},
+		{
+			name: "dedupe",
+			opts: []fsutil.CopyFSOption{fsutil.WithCopyDedupe(fsutil.NewMD5Hasher(8))},
+			duplicates: map[string]string{
+				"vendor/b/jquery.js":   "vendor/a/jquery.js",
+				"vendor/c/jquery.js":   "vendor/a/jquery.js",
+				"vendor/e/.gitignore":  "empty/.keep",
+				"vendor/f/placeholder": "empty/.keep",
+			},
+			linked: true,
+		},
+		{
+			name: "preallocate",
+			opts: []fsutil.CopyFSOption{fsutil.WithCopyPreallocate()},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "copy")
+
+			report, err := fsutil.CopyFS(dir, files, tc.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Files != len(files) {
+				t.Errorf("got %v files, want %v", report.Files, len(files))
+			}
+			if report.Bytes != 56 {
+				t.Errorf("got %v bytes, want %v", report.Bytes, 56)
+			}
+			if !reflect.DeepEqual(report.Duplicates, tc.duplicates) {
+				t.Errorf("got duplicates %v, want %v", report.Duplicates, tc.duplicates)
+			}
+			var wantLinked int64
+			if tc.linked {
+				wantLinked = 16
+			}
+			if report.LinkedBytes != wantLinked {
+				t.Errorf("got linked bytes %v, want %v", report.LinkedBytes, wantLinked)
+			}
+
+			if err := fstest.TestFS(os.DirFS(dir), "index.html", "bin/run.sh", "vendor/c/jquery.js"); err != nil {
+				t.Fatal(err)
+			}
+			for name, f := range files {
+				data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(data) != string(f.Data) {
+					t.Errorf("got %s content %q, want %q", name, data, f.Data)
+				}
+			}
+
+			a, err := os.Stat(filepath.Join(dir, "vendor", "a", "jquery.js"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			c, err := os.Stat(filepath.Join(dir, "vendor", "c", "jquery.js"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if os.SameFile(a, c) != tc.linked {
+				t.Errorf("got same file %v, want %v", os.SameFile(a, c), tc.linked)
+			}
+
+			info, err := os.Stat(filepath.Join(dir, "bin", "run.sh"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode()&0o100 == 0 {
+				t.Errorf("got mode %v, want executable", info.Mode())
+			}
+		})
+	}
+}
+
+func TestCopyFS_existingFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte("old"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := fsutil.CopyFS(dir, fstest.MapFS{"index.html": {Data: []byte("new")}})
+	if !errors.Is(err, fs.ErrExist) {
+		t.Errorf("got error %v, want %v", err, fs.ErrExist)
+	}
+}
+
+func TestCopyFS_symlink(t *testing.T) {
+	_, err := fsutil.CopyFS(t.TempDir(), fstest.MapFS{"link": {Data: []byte("target"), Mode: fs.ModeSymlink}})
+	if !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("got error %v, want %v", err, fs.ErrInvalid)
+	}
+}
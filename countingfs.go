@@ -0,0 +1,173 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"io/fs"
+	"sync"
+)
+
+var (
+	_ fs.FS         = (*CountingFS)(nil)
+	_ fs.GlobFS     = (*CountingFS)(nil)
+	_ fs.ReadDirFS  = (*CountingFS)(nil)
+	_ fs.ReadFileFS = (*CountingFS)(nil)
+	_ fs.StatFS     = (*CountingFS)(nil)
+	_ fs.SubFS      = (*CountingFS)(nil)
+	_ ReadLinkFS    = (*CountingFS)(nil)
+)
+
+// CountingFS is a filesystem that counts how many times every file is opened
+// and how many bytes are read from it. The counts can be used to find files
+// that are never used, for example embedded assets that can be removed from
+// the binary.
+type CountingFS struct {
+	fsys fs.FS
+
+	counts   map[string]*FileCounts
+	countsMu sync.Mutex
+}
+
+// FileCounts holds usage counts of a single file.
+type FileCounts struct {
+	Opens     int64 // number of successful Open and ReadFile calls
+	BytesRead int64 // number of bytes read
+}
+
+// NewCountingFS returns a new instance of CountingFS.
+func NewCountingFS(fsys fs.FS) *CountingFS {
+	return &CountingFS{
+		fsys:   fsys,
+		counts: make(map[string]*FileCounts),
+	}
+}
+
+// Open implements fs.FS interface.
+func (s *CountingFS) Open(name string) (fs.File, error) {
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	s.add(name, 1, 0)
+	return &countingFile{wrappedFile: wrappedFile{File: f, name: name}, countingFS: s}, nil
+}
+
+// Glob implements fs.GlobFS interface.
+func (s *CountingFS) Glob(pattern string) ([]string, error) {
+	return fs.Glob(s.fsys, pattern)
+}
+
+// ReadDir implements fs.ReadDirFS interface.
+func (s *CountingFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(s.fsys, name)
+}
+
+// ReadFile implements fs.ReadFileFS interface.
+func (s *CountingFS) ReadFile(name string) ([]byte, error) {
+	data, err := fs.ReadFile(s.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	s.add(name, 1, int64(len(data)))
+	return data, nil
+}
+
+// Stat implements fs.StatFS interface.
+func (s *CountingFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(s.fsys, name)
+}
+
+// ReadLink implements ReadLinkFS interface.
+func (s *CountingFS) ReadLink(name string) (string, error) {
+	return ReadLink(s.fsys, name)
+}
+
+// Lstat implements ReadLinkFS interface.
+func (s *CountingFS) Lstat(name string) (fs.FileInfo, error) {
+	return Lstat(s.fsys, name)
+}
+
+// Sub implements fs.SubFS interface.
+func (s *CountingFS) Sub(dir string) (fs.FS, error) {
+	return newSubFS(s, dir)
+}
+
+// Unwrap returns the underlying filesystem.
+func (s *CountingFS) Unwrap() fs.FS {
+	return s.fsys
+}
+
+// Counts returns a snapshot of counts for all files that are opened at least
+// once. Files that are not in the returned map are not used.
+func (s *CountingFS) Counts() map[string]FileCounts {
+	s.countsMu.Lock()
+	defer s.countsMu.Unlock()
+
+	counts := make(map[string]FileCounts, len(s.counts))
+	for name, c := range s.counts {
+		counts[name] = *c
+	}
+	return counts
+}
+
+// Unused returns sorted names of regular files in the underlying filesystem
+// that are not opened. Counts are taken before the underlying filesystem is
+// walked, so that files can be opened while the walk is in progress.
+func (s *CountingFS) Unused() ([]string, error) {
+	counts := s.Counts()
+
+	var unused []string
+	err := fs.WalkDir(s.fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if _, ok := counts[path]; !ok {
+			unused = append(unused, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return unused, nil
+}
+
+// Reset sets all counts to zero.
+func (s *CountingFS) Reset() {
+	s.countsMu.Lock()
+	defer s.countsMu.Unlock()
+
+	s.counts = make(map[string]*FileCounts)
+}
+
+func (s *CountingFS) add(name string, opens, bytes int64) {
+	s.countsMu.Lock()
+	defer s.countsMu.Unlock()
+
+	c, ok := s.counts[name]
+	if !ok {
+		c = new(FileCounts)
+		s.counts[name] = c
+	}
+	c.Opens += opens
+	c.BytesRead += bytes
+}
+
+type countingFile struct {
+	wrappedFile
+	countingFS *CountingFS
+}
+
+func (f *countingFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	if n > 0 {
+		f.countingFS.add(f.name, 0, int64(n))
+	}
+	return n, err
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"resenje.org/fsutil"
+)
+
+func TestCountingFS(t *testing.T) {
+	files := fsutil.MapFS{
+		"index.html":  {Data: []byte("<html>")},
+		"css/app.css": {Data: []byte("body{}")},
+		"js/app.js":   {Data: []byte("app()")},
+		"js/old.js":   {Data: []byte("old()")},
+	}
+	fsys := fsutil.NewCountingFS(files)
+
+	if err := fstest.TestFS(fsys, "index.html", "css/app.css", "js/app.js", "js/old.js"); err != nil {
+		t.Fatal(err)
+	}
+	fsys.Reset()
+
+	testOpen(t, fsys, "index.html", "<html>")
+	testOpen(t, fsys, "index.html", "<html>")
+	testReadFile(t, fsys, "js/app.js", "app()")
+	testOpenNotExist(t, fsys, "missing.js")
+
+	got := fsys.Counts()
+	want := map[string]fsutil.FileCounts{
+		"index.html": {Opens: 2, BytesRead: 12},
+		"js/app.js":  {Opens: 1, BytesRead: 5},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got counts %v, want %v", got, want)
+	}
+
+	unused, err := fsys.Unused()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantUnused := []string{"css/app.css", "js/old.js"}
+	if !reflect.DeepEqual(unused, wantUnused) {
+		t.Errorf("got unused %v, want %v", unused, wantUnused)
+	}
+
+	fsys.Reset()
+	if got := fsys.Counts(); len(got) != 0 {
+		t.Errorf("got counts %v after reset, want none", got)
+	}
+}
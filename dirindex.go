@@ -0,0 +1,283 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DirIndex is the data that is passed to the directory index template.
+type DirIndex struct {
+	// Path is the URL path of the directory with the trailing slash, relative
+	// to the handler.
+	Path string
+	// Entries are files and directories in the directory, sorted by the sort
+	// and order query parameters.
+	Entries []DirIndexEntry
+	// Sort is the column by which the entries are sorted, "name", "size" or
+	// "time".
+	Sort string
+	// Desc is true if the entries are sorted in the descending order.
+	Desc bool
+}
+
+// DirIndexEntry is a file or a directory in the directory index.
+type DirIndexEntry struct {
+	// Name is the name of the file.
+	Name string
+	// URL is the escaped URL of the file relative to the directory.
+	URL string
+	// IsDir is true for directories.
+	IsDir bool
+	// Size is the length in bytes for regular files.
+	Size int64
+	// ModTime is the modification time.
+	ModTime time.Time
+}
+
+// DirIndexOption sets an optional parameter of the directory index handler.
+type DirIndexOption func(*dirIndexOptions)
+
+type dirIndexOptions struct {
+	hidden bool
+}
+
+// WithDirIndexHidden makes the directory index handler list and serve hidden
+// files and directories, the ones with names that start with a dot. By
+// default, they are not listed and they are not found.
+func WithDirIndexHidden() DirIndexOption {
+	return func(o *dirIndexOptions) {
+		o.hidden = true
+	}
+}
+
+// DirIndexHandler returns an HTTP handler that serves files from the
+// filesystem and lists directories with the template, which is executed with
+// the DirIndex data. If the template is nil, a simple HTML table with name,
+// size and modification time columns is rendered. Directory entries are sorted
+// by the "sort" query parameter, which can be "name", "size" or "time", and
+// the "order" query parameter, which can be "asc" or "desc". Directories are
+// listed before files. Directories are listed even if they contain index.html
+// files.
+//
+// DirIndexHandler is the intentional counterpart of NoDirsFS, for example for
+// internal file sharing endpoints, and it should not be used to serve files
+// that are not meant to be listed.
+func DirIndexHandler(fsys fs.FS, tmpl *template.Template, opts ...DirIndexOption) http.Handler {
+	var o dirIndexOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if tmpl == nil {
+		tmpl = defaultDirIndexTemplate
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upath := path.Clean("/" + r.URL.Path)
+		name := strings.TrimPrefix(upath, "/")
+		if name == "" {
+			name = "."
+		}
+		if !o.hidden && isHiddenPath(name) {
+			http.NotFound(w, r)
+			return
+		}
+
+		info, err := fs.Stat(fsys, name)
+		if err != nil {
+			serveFSError(w, r, err)
+			return
+		}
+
+		if !info.IsDir() {
+			ServeFile(w, r, fsys, name)
+			return
+		}
+
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			// Redirect relatively, as http.FileServer does, so that the
+			// handler can be used with http.StripPrefix.
+			location := path.Base(r.URL.Path) + "/"
+			if q := r.URL.RawQuery; q != "" {
+				location += "?" + q
+			}
+			w.Header().Set("Location", location)
+			w.WriteHeader(http.StatusMovedPermanently)
+			return
+		}
+
+		index, err := newDirIndex(fsys, name, r.URL.Query(), o)
+		if err != nil {
+			serveFSError(w, r, err)
+			return
+		}
+		index.Path = strings.TrimSuffix(upath, "/") + "/"
+
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, index); err != nil {
+			serveFSError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		_, _ = buf.WriteTo(w)
+	})
+}
+
+// newDirIndex reads the directory and sorts its entries according to the
+// query parameters.
+func newDirIndex(fsys fs.FS, dir string, query url.Values, o dirIndexOptions) (*DirIndex, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	index := &DirIndex{
+		Sort:    "name",
+		Entries: make([]DirIndexEntry, 0, len(entries)),
+	}
+	switch s := query.Get("sort"); s {
+	case "size", "time":
+		index.Sort = s
+	}
+	index.Desc = query.Get("order") == "desc"
+
+	for _, e := range entries {
+		if !o.hidden && strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		u := (&url.URL{Path: e.Name()}).EscapedPath()
+		if strings.Contains(e.Name(), ":") {
+			// Prevent names with colons from being parsed as schemes.
+			u = "./" + u
+		}
+		entry := DirIndexEntry{
+			Name:    e.Name(),
+			URL:     u,
+			IsDir:   e.IsDir(),
+			ModTime: info.ModTime(),
+		}
+		if entry.IsDir {
+			entry.URL += "/"
+		} else {
+			entry.Size = info.Size()
+		}
+		index.Entries = append(index.Entries, entry)
+	}
+
+	sort.SliceStable(index.Entries, func(i, j int) bool {
+		a, b := index.Entries[i], index.Entries[j]
+		if a.IsDir != b.IsDir {
+			return a.IsDir
+		}
+		if index.Desc {
+			a, b = b, a
+		}
+		switch index.Sort {
+		case "size":
+			if a.Size != b.Size {
+				return a.Size < b.Size
+			}
+		case "time":
+			if !a.ModTime.Equal(b.ModTime) {
+				return a.ModTime.Before(b.ModTime)
+			}
+		}
+		return a.Name < b.Name
+	})
+	return index, nil
+}
+
+// isHiddenPath reports whether any element of the slash separated path starts
+// with a dot.
+func isHiddenPath(name string) bool {
+	for _, e := range strings.Split(name, "/") {
+		if strings.HasPrefix(e, ".") && e != "." {
+			return true
+		}
+	}
+	return false
+}
+
+// formatSize returns the size in bytes in a human readable form.
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+var defaultDirIndexTemplate = template.Must(template.New("dirindex").Funcs(template.FuncMap{
+	"formatSize": formatSize,
+	"sortQuery": func(index *DirIndex, column string) string {
+		order := "asc"
+		if index.Sort == column && !index.Desc {
+			order = "desc"
+		}
+		return "?sort=" + column + "&order=" + order
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Index of {{.Path}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { padding: 0.25em 1em; text-align: left; }
+td.size { text-align: right; }
+</style>
+</head>
+<body>
+<h1>Index of {{.Path}}</h1>
+<table>
+<thead>
+<tr>
+<th><a href="{{sortQuery . "name"}}">Name</a></th>
+<th><a href="{{sortQuery . "size"}}">Size</a></th>
+<th><a href="{{sortQuery . "time"}}">Modified</a></th>
+</tr>
+</thead>
+<tbody>
+{{- if ne .Path "/"}}
+<tr><td><a href="../">../</a></td><td></td><td></td></tr>
+{{- end}}
+{{- range .Entries}}
+<tr>
+<td><a href="{{.URL}}">{{.Name}}{{if .IsDir}}/{{end}}</a></td>
+<td class="size">{{if not .IsDir}}{{formatSize .Size}}{{end}}</td>
+<td>{{.ModTime.UTC.Format "2006-01-02 15:04:05"}}</td>
+</tr>
+{{- end}}
+</tbody>
+</table>
+</body>
+</html>
+`))
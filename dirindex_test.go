@@ -0,0 +1,131 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"html/template"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestDirIndexHandler(t *testing.T) {
+	modTime := time.Date(2021, 8, 9, 10, 11, 12, 0, time.UTC)
+	files := fsutil.MapFS{
+		"docs/a.txt":        {Data: []byte("aaa"), ModTime: modTime.Add(time.Hour)},
+		"docs/b.txt":        {Data: []byte("b"), ModTime: modTime},
+		"docs/c d.txt":      {Data: []byte("cc"), ModTime: modTime.Add(2 * time.Hour)},
+		"docs/images/x.png": {Data: []byte("png")},
+		"docs/.env":         {Data: []byte("SECRET=1")},
+		".git/config":       {Data: []byte("[core]")},
+		"index.html":        {Data: []byte("<html>")},
+	}
+	tmpl := template.Must(template.New("").Parse(
+		`{{.Path}} {{.Sort}} {{.Desc}}:{{range .Entries}} {{.URL}}({{.Size}}){{end}}`,
+	))
+	handler := fsutil.DirIndexHandler(files, tmpl)
+
+	for _, tc := range []struct {
+		name     string
+		target   string
+		status   int
+		body     string
+		location string
+	}{
+		{name: "root", target: "/", status: http.StatusOK, body: "/ name false: docs/(0) index.html(6)"},
+		{name: "sort by name", target: "/docs/", status: http.StatusOK, body: "/docs/ name false: images/(0) a.txt(3) b.txt(1) c%20d.txt(2)"},
+		{name: "sort by size", target: "/docs/?sort=size", status: http.StatusOK, body: "/docs/ size false: images/(0) b.txt(1) c%20d.txt(2) a.txt(3)"},
+		{name: "sort by time descending", target: "/docs/?sort=time&order=desc", status: http.StatusOK, body: "/docs/ time true: images/(0) c%20d.txt(2) a.txt(3) b.txt(1)"},
+		{name: "invalid sort", target: "/docs/?sort=owner", status: http.StatusOK, body: "/docs/ name false: images/(0) a.txt(3) b.txt(1) c%20d.txt(2)"},
+		{name: "file", target: "/docs/a.txt", status: http.StatusOK, body: "aaa"},
+		{name: "index file", target: "/index.html", status: http.StatusOK, body: "<html>"},
+		{name: "redirect", target: "/docs/images?sort=size", status: http.StatusMovedPermanently, location: "images/?sort=size"},
+		{name: "not found", target: "/docs/missing.txt", status: http.StatusNotFound},
+		{name: "hidden file", target: "/docs/.env", status: http.StatusNotFound},
+		{name: "hidden directory", target: "/.git/", status: http.StatusNotFound},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.target, nil))
+			resp := w.Result()
+			if resp.StatusCode != tc.status {
+				t.Fatalf("got status %v, want %v", resp.StatusCode, tc.status)
+			}
+			if tc.body != "" {
+				body, err := io.ReadAll(resp.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(body) != tc.body {
+					t.Errorf("got body %q, want %q", body, tc.body)
+				}
+			}
+			if got := resp.Header.Get("Location"); got != tc.location {
+				t.Errorf("got location %q, want %q", got, tc.location)
+			}
+		})
+	}
+}
+
+func TestDirIndexHandler_hidden(t *testing.T) {
+	files := fsutil.MapFS{
+		"docs/a.txt": {Data: []byte("aaa")},
+		"docs/.env":  {Data: []byte("SECRET=1")},
+	}
+	tmpl := template.Must(template.New("").Parse(`{{range .Entries}}{{.Name}} {{end}}`))
+	handler := fsutil.DirIndexHandler(files, tmpl, fsutil.WithDirIndexHidden())
+
+	for target, want := range map[string]string{
+		"/docs/":     ".env a.txt ",
+		"/docs/.env": "SECRET=1",
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if got := w.Body.String(); got != want {
+			t.Errorf("got %s body %q, want %q", target, got, want)
+		}
+	}
+}
+
+func TestDirIndexHandler_defaultTemplate(t *testing.T) {
+	files := fsutil.MapFS{
+		"docs/report <2021>.pdf": {Data: []byte(strings.Repeat("x", 2048))},
+	}
+	server := httptest.NewServer(http.StripPrefix("/files", fsutil.DirIndexHandler(files, nil)))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/files/docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.Request.URL.Path != "/files/docs/" {
+		t.Errorf("got redirected to %q, want %q", resp.Request.URL.Path, "/files/docs/")
+	}
+	if got := resp.Header.Get("Content-Type"); got != "text/html; charset=utf-8" {
+		t.Errorf("got content type %q", got)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"<title>Index of /docs/</title>",
+		`<a href="../">../</a>`,
+		`<a href="report%20%3C2021%3E.pdf">report &lt;2021&gt;.pdf</a>`,
+		"2.0 KiB",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("body does not contain %q:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux && !darwin && !freebsd && !windows
+// +build !linux,!darwin,!freebsd,!windows
+
+package fsutil
+
+// availableSpace returns the number of bytes available to the current user on
+// the volume of the path. If it is not possible to determine it, ok is false.
+func availableSpace(path string) (available int64, ok bool) {
+	return 0, false
+}
@@ -0,0 +1,21 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package fsutil
+
+import "syscall"
+
+// availableSpace returns the number of bytes available to the current user on
+// the volume of the path. If it is not possible to determine it, ok is false.
+func availableSpace(path string) (available int64, ok bool) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, false
+	}
+	return int64(st.Bavail) * int64(st.Bsize), true
+}
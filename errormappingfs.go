@@ -0,0 +1,135 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"io"
+	"io/fs"
+)
+
+var (
+	_ fs.FS         = (*errorMappingFS)(nil)
+	_ fs.GlobFS     = (*errorMappingFS)(nil)
+	_ fs.ReadDirFS  = (*errorMappingFS)(nil)
+	_ fs.ReadFileFS = (*errorMappingFS)(nil)
+	_ fs.StatFS     = (*errorMappingFS)(nil)
+	_ fs.SubFS      = (*errorMappingFS)(nil)
+	_ ReadLinkFS    = (*errorMappingFS)(nil)
+)
+
+// ErrorMappingFS returns a filesystem that translates errors returned by the
+// underlying filesystem and its files with the mapping function. It allows
+// backend specific errors to be mapped to errors from the io/fs package, such
+// as fs.ErrNotExist, which other filesystems in this package check with
+// errors.Is.
+//
+// If the error is fs.PathError, only its Err field is passed to the mapping
+// function and the operation and the path are preserved. If the mapping
+// function returns nil, the original error is kept, as errors can not be
+// mapped to successful results. The io.EOF error is never mapped.
+func ErrorMappingFS(fsys fs.FS, mapping func(err error) error) fs.FS {
+	return &errorMappingFS{
+		fsys:    fsys,
+		mapping: mapping,
+	}
+}
+
+type errorMappingFS struct {
+	fsys    fs.FS
+	mapping func(err error) error
+}
+
+func (s *errorMappingFS) Open(name string) (fs.File, error) {
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return nil, s.mapError(err)
+	}
+	return &errorMappingFile{wrappedFile: wrappedFile{File: f, name: name}, errorMappingFS: s}, nil
+}
+
+func (s *errorMappingFS) Glob(pattern string) ([]string, error) {
+	matches, err := fs.Glob(s.fsys, pattern)
+	return matches, s.mapError(err)
+}
+
+func (s *errorMappingFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := fs.ReadDir(s.fsys, name)
+	return entries, s.mapError(err)
+}
+
+func (s *errorMappingFS) ReadFile(name string) ([]byte, error) {
+	data, err := fs.ReadFile(s.fsys, name)
+	return data, s.mapError(err)
+}
+
+func (s *errorMappingFS) Stat(name string) (fs.FileInfo, error) {
+	info, err := fs.Stat(s.fsys, name)
+	return info, s.mapError(err)
+}
+
+func (s *errorMappingFS) ReadLink(name string) (string, error) {
+	target, err := ReadLink(s.fsys, name)
+	return target, s.mapError(err)
+}
+
+func (s *errorMappingFS) Lstat(name string) (fs.FileInfo, error) {
+	info, err := Lstat(s.fsys, name)
+	return info, s.mapError(err)
+}
+
+func (s *errorMappingFS) Sub(dir string) (fs.FS, error) {
+	return newSubFS(s, dir)
+}
+
+func (s *errorMappingFS) Unwrap() fs.FS {
+	return s.fsys
+}
+
+func (s *errorMappingFS) mapError(err error) error {
+	if err == nil || err == io.EOF {
+		return err
+	}
+	if pathErr, ok := err.(*fs.PathError); ok {
+		mapped := s.mapping(pathErr.Err)
+		if mapped == nil {
+			return err
+		}
+		return &fs.PathError{Op: pathErr.Op, Path: pathErr.Path, Err: mapped}
+	}
+	if mapped := s.mapping(err); mapped != nil {
+		return mapped
+	}
+	return err
+}
+
+type errorMappingFile struct {
+	wrappedFile
+	errorMappingFS *errorMappingFS
+}
+
+func (f *errorMappingFile) Stat() (fs.FileInfo, error) {
+	info, err := f.File.Stat()
+	return info, f.errorMappingFS.mapError(err)
+}
+
+func (f *errorMappingFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	return n, f.errorMappingFS.mapError(err)
+}
+
+func (f *errorMappingFile) Close() error {
+	return f.errorMappingFS.mapError(f.File.Close())
+}
+
+func (f *errorMappingFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	entries, err := f.wrappedFile.ReadDir(n)
+	return entries, f.errorMappingFS.mapError(err)
+}
+
+func (f *errorMappingFile) Seek(offset int64, whence int) (int64, error) {
+	n, err := f.wrappedFile.Seek(offset, whence)
+	return n, f.errorMappingFS.mapError(err)
+}
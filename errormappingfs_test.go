@@ -0,0 +1,97 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"resenje.org/fsutil"
+)
+
+func TestErrorMappingFS(t *testing.T) {
+	errNotFound := errors.New("object not found")
+	errRead := errors.New("read failed")
+
+	files := fsutil.MapFS{
+		"a.txt":     {Data: []byte("a")},
+		"dir/b.txt": {Data: []byte("b")},
+	}
+	backend := fsutil.FSFunc(func(name string) (fs.File, error) {
+		if name == "broken.txt" {
+			return nil, errRead
+		}
+		f, err := files.Open(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: errNotFound}
+		}
+		return f, err
+	})
+
+	fsys := fsutil.ErrorMappingFS(backend, func(err error) error {
+		if err == errNotFound {
+			return fs.ErrNotExist
+		}
+		return err
+	})
+
+	if err := fstest.TestFS(fsys, "a.txt", "dir/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("open", func(t *testing.T) {
+		testOpen(t, fsys, "a.txt", "a")
+		testOpenNotExist(t, fsys, "missing.txt")
+
+		_, err := fsys.Open("missing.txt")
+		var pathErr *fs.PathError
+		if !errors.As(err, &pathErr) {
+			t.Fatalf("got error %v, want path error", err)
+		}
+		if pathErr.Op != "open" || pathErr.Path != "missing.txt" {
+			t.Errorf("got op %q path %q, want op %q path %q", pathErr.Op, pathErr.Path, "open", "missing.txt")
+		}
+	})
+
+	t.Run("read file", func(t *testing.T) {
+		testReadFile(t, fsys.(fs.ReadFileFS), "dir/b.txt", "b")
+		testReadFileNotExist(t, fsys.(fs.ReadFileFS), "dir/missing.txt")
+	})
+
+	t.Run("stat", func(t *testing.T) {
+		testStatNotExist(t, fsys.(fs.StatFS), "missing.txt")
+	})
+
+	t.Run("read dir", func(t *testing.T) {
+		testReadDirNotExist(t, fsys.(fs.ReadDirFS), "missing")
+	})
+
+	t.Run("unmapped", func(t *testing.T) {
+		if _, err := fsys.Open("broken.txt"); !errors.Is(err, errRead) {
+			t.Fatalf("got error %v, want %v", err, errRead)
+		}
+	})
+
+	t.Run("nil mapping", func(t *testing.T) {
+		fsys := fsutil.ErrorMappingFS(backend, func(err error) error {
+			return nil
+		})
+
+		_, err := fsys.Open("missing.txt")
+		if !errors.Is(err, errNotFound) {
+			t.Fatalf("got error %v, want %v", err, errNotFound)
+		}
+		if err.Error() != "open missing.txt: object not found" {
+			t.Errorf("got error message %q", err.Error())
+		}
+
+		if _, err := fsys.Open("broken.txt"); !errors.Is(err, errRead) {
+			t.Fatalf("got error %v, want %v", err, errRead)
+		}
+	})
+}
@@ -0,0 +1,291 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sync"
+	"time"
+)
+
+var (
+	_ fs.FS         = (*ExpiringFS)(nil)
+	_ fs.GlobFS     = (*ExpiringFS)(nil)
+	_ fs.ReadDirFS  = (*ExpiringFS)(nil)
+	_ fs.ReadFileFS = (*ExpiringFS)(nil)
+	_ fs.StatFS     = (*ExpiringFS)(nil)
+	_ fs.SubFS      = (*ExpiringFS)(nil)
+	_ ReadLinkFS    = (*ExpiringFS)(nil)
+)
+
+// ErrExpired is returned by ExpiringFS for files that are expired. It wraps
+// fs.ErrNotExist.
+var ErrExpired = fmt.Errorf("expired: %w", fs.ErrNotExist)
+
+// ExpiringFS is a filesystem where files become inaccessible after their time
+// to live passes, measured from their modification time or from their first
+// access. Expired files do not exist and they are omitted from directory
+// listings. Directories do not expire. It generalizes the expiry of the whole
+// backup of BackupFS to single files, for example to serve time limited
+// download links directly from a directory.
+type ExpiringFS struct {
+	fsys fs.FS
+	ttl  time.Duration
+	o    expiringFSOptions
+
+	// accessed holds times of the first access to files with the
+	// WithExpiryFromFirstAccess option.
+	accessed   map[string]time.Time
+	accessedMu sync.Mutex
+}
+
+// ExpiringFSOption sets an optional parameter of the ExpiringFS.
+type ExpiringFSOption func(*expiringFSOptions)
+
+type expiringFSOptions struct {
+	ttlFunc     func(name string, info fs.FileInfo) time.Duration
+	firstAccess bool
+	clock       Clock
+}
+
+// WithExpiryFunc sets the function that returns the time to live of the named
+// file, instead of the one passed to NewExpiringFS. Files for which the
+// function returns a duration that is not positive do not expire.
+func WithExpiryFunc(ttl func(name string, info fs.FileInfo) time.Duration) ExpiringFSOption {
+	return func(o *expiringFSOptions) {
+		o.ttlFunc = ttl
+	}
+}
+
+// WithExpiryFromFirstAccess makes the time to live of files measured from the
+// first time they are opened or read with ReadFile, instead of from their
+// modification time. Files that are not accessed do not expire. Times of
+// first accesses are kept in memory for the lifetime of the ExpiringFS, so
+// that expired files do not become accessible again.
+func WithExpiryFromFirstAccess() ExpiringFSOption {
+	return func(o *expiringFSOptions) {
+		o.firstAccess = true
+	}
+}
+
+// WithExpiringFSClock sets the clock that ExpiringFS uses to get the current
+// time. The default is the system clock.
+func WithExpiringFSClock(c Clock) ExpiringFSOption {
+	return func(o *expiringFSOptions) {
+		o.clock = c
+	}
+}
+
+// NewExpiringFS returns a new instance of ExpiringFS where files expire after
+// the ttl duration. If the ttl is not positive, files expire only as set by
+// the WithExpiryFunc option.
+func NewExpiringFS(fsys fs.FS, ttl time.Duration, opts ...ExpiringFSOption) *ExpiringFS {
+	o := expiringFSOptions{
+		clock: systemClock{},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &ExpiringFS{
+		fsys:     fsys,
+		ttl:      ttl,
+		o:        o,
+		accessed: make(map[string]time.Time),
+	}
+}
+
+// Open implements fs.FS interface.
+func (s *ExpiringFS) Open(name string) (fs.File, error) {
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	now := s.o.clock.Now()
+	if s.expired(name, info, now, true) {
+		f.Close()
+		return nil, &fs.PathError{Op: "open", Path: name, Err: ErrExpired}
+	}
+	if d, ok := f.(fs.ReadDirFile); ok && info.IsDir() {
+		return &expiringDir{ReadDirFile: d, name: name, expiringFS: s, now: now}, nil
+	}
+	return f, nil
+}
+
+// Glob implements fs.GlobFS interface.
+func (s *ExpiringFS) Glob(pattern string) ([]string, error) {
+	return fs.Glob(readDirFS{FSFunc: s.Open, readDir: s.ReadDir}, pattern)
+}
+
+// ReadDir implements fs.ReadDirFS interface.
+func (s *ExpiringFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := fs.ReadDir(s.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	return s.filterEntries(name, entries, s.o.clock.Now())
+}
+
+// ReadFile implements fs.ReadFileFS interface.
+func (s *ExpiringFS) ReadFile(name string) ([]byte, error) {
+	info, err := fs.Stat(s.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	if s.expired(name, info, s.o.clock.Now(), true) {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: ErrExpired}
+	}
+	return fs.ReadFile(s.fsys, name)
+}
+
+// Stat implements fs.StatFS interface.
+func (s *ExpiringFS) Stat(name string) (fs.FileInfo, error) {
+	return s.stat("stat", name, fs.Stat)
+}
+
+// ReadLink implements ReadLinkFS interface.
+func (s *ExpiringFS) ReadLink(name string) (string, error) {
+	if _, err := s.stat("readlink", name, Lstat); err != nil {
+		return "", err
+	}
+	return ReadLink(s.fsys, name)
+}
+
+// Lstat implements ReadLinkFS interface.
+func (s *ExpiringFS) Lstat(name string) (fs.FileInfo, error) {
+	return s.stat("lstat", name, Lstat)
+}
+
+// Sub implements fs.SubFS interface.
+func (s *ExpiringFS) Sub(dir string) (fs.FS, error) {
+	return newSubFS(s, dir)
+}
+
+// Unwrap returns the underlying filesystem.
+func (s *ExpiringFS) Unwrap() fs.FS {
+	return s.fsys
+}
+
+// ExpiresAt returns the time when the named file expires, or the zero time if
+// it does not expire, for example because it is a directory or because it is
+// not accessed yet with the WithExpiryFromFirstAccess option. The file is not
+// accessed by this method.
+func (s *ExpiringFS) ExpiresAt(name string) (time.Time, error) {
+	info, err := fs.Stat(s.fsys, name)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return s.expiresAt(name, info), nil
+}
+
+// stat returns the file info with the stat function, or ErrExpired if the
+// file is expired.
+func (s *ExpiringFS) stat(op, name string, stat func(fsys fs.FS, name string) (fs.FileInfo, error)) (fs.FileInfo, error) {
+	info, err := stat(s.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	if s.expired(name, info, s.o.clock.Now(), false) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: ErrExpired}
+	}
+	return info, nil
+}
+
+// expired reports whether the named file is expired at the time now. If
+// access is true, the file is recorded as accessed with the
+// WithExpiryFromFirstAccess option.
+func (s *ExpiringFS) expired(name string, info fs.FileInfo, now time.Time, access bool) bool {
+	if access && s.o.firstAccess && !info.IsDir() {
+		s.accessedMu.Lock()
+		if _, ok := s.accessed[name]; !ok {
+			s.accessed[name] = now
+		}
+		s.accessedMu.Unlock()
+	}
+	expiresAt := s.expiresAt(name, info)
+	return !expiresAt.IsZero() && !now.Before(expiresAt)
+}
+
+// expiresAt returns the time when the named file expires or the zero time if
+// it does not expire.
+func (s *ExpiringFS) expiresAt(name string, info fs.FileInfo) time.Time {
+	if info.IsDir() {
+		return time.Time{}
+	}
+	ttl := s.ttl
+	if s.o.ttlFunc != nil {
+		ttl = s.o.ttlFunc(name, info)
+	}
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	start := info.ModTime()
+	if s.o.firstAccess {
+		s.accessedMu.Lock()
+		t, ok := s.accessed[name]
+		s.accessedMu.Unlock()
+		if !ok {
+			return time.Time{}
+		}
+		start = t
+	}
+	return start.Add(ttl)
+}
+
+// filterEntries returns entries of the directory dir that are not expired.
+// Entries of files that are removed after they are listed are omitted.
+func (s *ExpiringFS) filterEntries(dir string, entries []fs.DirEntry, now time.Time) ([]fs.DirEntry, error) {
+	filtered := make([]fs.DirEntry, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() {
+			filtered = append(filtered, e)
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		if !s.expired(path.Join(dir, e.Name()), info, now, false) {
+			filtered = append(filtered, e)
+		}
+	}
+	return filtered, nil
+}
+
+// expiringDir is a directory opened from ExpiringFS with entries of expired
+// files omitted.
+type expiringDir struct {
+	fs.ReadDirFile
+	name       string
+	expiringFS *ExpiringFS
+	now        time.Time
+}
+
+func (d *expiringDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	for {
+		entries, err := d.ReadDirFile.ReadDir(n)
+		filtered, ferr := d.expiringFS.filterEntries(d.name, entries, d.now)
+		if ferr != nil {
+			return filtered, ferr
+		}
+		// Read the next batch if all entries in this one are omitted, so
+		// that an empty result is returned only at the end of the directory.
+		if n > 0 && len(filtered) == 0 && len(entries) > 0 && err == nil {
+			continue
+		}
+		return filtered, err
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"errors"
+	"io/fs"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestExpiringFS(t *testing.T) {
+	start := time.Date(2021, 8, 9, 10, 0, 0, 0, time.UTC)
+	files := fstest.MapFS{
+		"a.txt":     {Data: []byte("a"), ModTime: start},
+		"b.txt":     {Data: []byte("b"), ModTime: start.Add(time.Hour)},
+		"dir/c.txt": {Data: []byte("c"), ModTime: start},
+	}
+	clock := newManualClock(start.Add(30 * time.Minute))
+
+	fsys := fsutil.NewExpiringFS(files, time.Hour, fsutil.WithExpiringFSClock(clock))
+
+	if err := fstest.TestFS(fsys, "a.txt", "b.txt", "dir/c.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	expiresAt, err := fsys.ExpiresAt("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := start.Add(time.Hour); !expiresAt.Equal(want) {
+		t.Errorf("got expires at %v, want %v", expiresAt, want)
+	}
+
+	clock.advance(30 * time.Minute)
+
+	if err := fstest.TestFS(fsys, "b.txt", "dir"); err != nil {
+		t.Fatal(err)
+	}
+	testOpen(t, fsys, "b.txt", "b")
+	testExpired(t, fsys, "a.txt", "dir/c.txt")
+	testReadDirNames(t, fsys, ".", "b.txt", "dir")
+	testReadDirNames(t, fsys, "dir")
+
+	matches, err := fsys.Glob("*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"b.txt"}; !reflect.DeepEqual(matches, want) {
+		t.Errorf("got glob %v, want %v", matches, want)
+	}
+
+	clock.advance(time.Hour)
+
+	testExpired(t, fsys, "b.txt")
+	testReadDirNames(t, fsys, ".", "dir")
+}
+
+func TestExpiringFS_expiryFunc(t *testing.T) {
+	start := time.Date(2021, 8, 9, 10, 0, 0, 0, time.UTC)
+	files := fstest.MapFS{
+		"short.txt":   {Data: []byte("short"), ModTime: start},
+		"long.txt":    {Data: []byte("long"), ModTime: start},
+		"forever.txt": {Data: []byte("forever"), ModTime: start},
+	}
+	clock := newManualClock(start)
+
+	fsys := fsutil.NewExpiringFS(files, time.Hour,
+		fsutil.WithExpiringFSClock(clock),
+		fsutil.WithExpiryFunc(func(name string, info fs.FileInfo) time.Duration {
+			switch {
+			case strings.HasPrefix(name, "short"):
+				return time.Minute
+			case strings.HasPrefix(name, "long"):
+				return 24 * time.Hour
+			}
+			return 0
+		}),
+	)
+
+	clock.advance(time.Hour)
+
+	testExpired(t, fsys, "short.txt")
+	testOpen(t, fsys, "long.txt", "long")
+	testOpen(t, fsys, "forever.txt", "forever")
+
+	clock.advance(1000 * time.Hour)
+
+	testExpired(t, fsys, "short.txt", "long.txt")
+	testOpen(t, fsys, "forever.txt", "forever")
+
+	expiresAt, err := fsys.ExpiresAt("forever.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !expiresAt.IsZero() {
+		t.Errorf("got expires at %v, want zero time", expiresAt)
+	}
+}
+
+func TestExpiringFS_fromFirstAccess(t *testing.T) {
+	start := time.Date(2021, 8, 9, 10, 0, 0, 0, time.UTC)
+	files := fstest.MapFS{
+		"a.txt": {Data: []byte("a"), ModTime: start.Add(-24 * time.Hour)},
+		"b.txt": {Data: []byte("b"), ModTime: start.Add(-24 * time.Hour)},
+	}
+	clock := newManualClock(start)
+
+	fsys := fsutil.NewExpiringFS(files, time.Hour,
+		fsutil.WithExpiringFSClock(clock),
+		fsutil.WithExpiryFromFirstAccess(),
+	)
+
+	// Stat and directory listings do not start the time to live.
+	if _, err := fsys.Stat("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	testReadDirNames(t, fsys, ".", "a.txt", "b.txt")
+
+	testOpen(t, fsys, "a.txt", "a")
+
+	clock.advance(30 * time.Minute)
+
+	testReadFile(t, fsys, "b.txt", "b")
+	testOpen(t, fsys, "a.txt", "a")
+
+	expiresAt, err := fsys.ExpiresAt("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := start.Add(time.Hour); !expiresAt.Equal(want) {
+		t.Errorf("got expires at %v, want %v", expiresAt, want)
+	}
+
+	clock.advance(30 * time.Minute)
+
+	testExpired(t, fsys, "a.txt")
+	testOpen(t, fsys, "b.txt", "b")
+	testReadDirNames(t, fsys, ".", "b.txt")
+
+	clock.advance(30 * time.Minute)
+
+	testExpired(t, fsys, "a.txt", "b.txt")
+	testReadDirNames(t, fsys, ".")
+}
+
+func testExpired(t *testing.T, fsys *fsutil.ExpiringFS, names ...string) {
+	t.Helper()
+
+	for _, name := range names {
+		if _, err := fsys.Open(name); !errors.Is(err, fsutil.ErrExpired) {
+			t.Errorf("got open %s error %v, want %v", name, err, fsutil.ErrExpired)
+		}
+		if _, err := fsys.Stat(name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("got stat %s error %v, want %v", name, err, fs.ErrNotExist)
+		}
+		if _, err := fsys.ReadFile(name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("got read file %s error %v, want %v", name, err, fs.ErrNotExist)
+		}
+	}
+}
+
+func testReadDirNames(t *testing.T, fsys fs.FS, dir string, want ...string) {
+	t.Helper()
+
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]string, 0, len(entries))
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+	if len(want) == 0 {
+		want = []string{}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %s entries %v, want %v", dir, got, want)
+	}
+}
@@ -5,17 +5,26 @@
 
 package fsutil
 
-import "io/fs"
-
 var (
-	UniqueStrings  = uniqueStrings
-	UniqueDirEntry = uniqueDirEntry
+	UniqueStrings   = uniqueStrings
+	UniqueDirEntry  = uniqueDirEntry
+	MergeDirEntries = mergeDirEntries
 )
 
-func NewDirEntry(e fs.DirEntry, name string) fs.DirEntry {
-	return &dirEntry{e: e, name: name}
+// LockBackupDir acquires the lock of the backup directory as BackupFS does.
+func LockBackupDir(dir string) (release func() error, err error) {
+	l := newBackupLock(dir)
+	if err := l.acquire(false); err != nil {
+		return nil, err
+	}
+	return l.release, nil
 }
 
-func NewFileInfo(i fs.FileInfo, name string) fs.FileInfo {
-	return &fileInfo{i: i, name: name}
+// CacheLen returns the number of cached Stat and ReadDir results, including
+// the expired ones.
+func (s *StatCacheFS) CacheLen() int {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+
+	return len(s.stats) + len(s.dirs)
 }
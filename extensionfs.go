@@ -0,0 +1,128 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"errors"
+	"io/fs"
+)
+
+var (
+	_ fs.FS         = (*ExtensionMappingFS)(nil)
+	_ fs.ReadFileFS = (*ExtensionMappingFS)(nil)
+	_ fs.StatFS     = (*ExtensionMappingFS)(nil)
+	_ fs.SubFS      = (*ExtensionMappingFS)(nil)
+	_ ReadLinkFS    = (*ExtensionMappingFS)(nil)
+)
+
+// ExtensionMappingFS is a filesystem that opens files without their extensions
+// in names. If a file with the requested name does not exist, names with
+// extensions appended are tried in the configured order. For example, with
+// extensions ".html" and ".md", "page" is opened as "page.html" or as "page.md"
+// if the former does not exist. The intended usage is to serve clean URLs with
+// http.FileServer.
+//
+// File info of opened files keeps the name with extension, so that the
+// http.FileServer is able to detect the content type.
+type ExtensionMappingFS struct {
+	fsys       fs.FS
+	extensions []string
+}
+
+// NewExtensionMappingFS returns a new instance of ExtensionMappingFS that
+// tries extensions in the provided order.
+func NewExtensionMappingFS(fsys fs.FS, extensions ...string) *ExtensionMappingFS {
+	return &ExtensionMappingFS{
+		fsys:       fsys,
+		extensions: extensions,
+	}
+}
+
+// Open implements fs.FS interface.
+func (s *ExtensionMappingFS) Open(name string) (fs.File, error) {
+	name, err := s.Resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return s.fsys.Open(name)
+}
+
+// ReadFile implements fs.ReadFileFS interface.
+func (s *ExtensionMappingFS) ReadFile(name string) ([]byte, error) {
+	name, err := s.Resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.ReadFile(s.fsys, name)
+}
+
+// Stat implements fs.StatFS interface.
+func (s *ExtensionMappingFS) Stat(name string) (fs.FileInfo, error) {
+	name, err := s.Resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.Stat(s.fsys, name)
+}
+
+// ReadLink implements ReadLinkFS interface.
+func (s *ExtensionMappingFS) ReadLink(name string) (string, error) {
+	name, err := s.Resolve(name)
+	if err != nil {
+		return "", err
+	}
+	return ReadLink(s.fsys, name)
+}
+
+// Lstat implements ReadLinkFS interface.
+func (s *ExtensionMappingFS) Lstat(name string) (fs.FileInfo, error) {
+	name, err := s.Resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return Lstat(s.fsys, name)
+}
+
+// Sub implements fs.SubFS interface.
+func (s *ExtensionMappingFS) Sub(dir string) (fs.FS, error) {
+	return newSubFS(s, dir)
+}
+
+// Unwrap returns the underlying filesystem.
+func (s *ExtensionMappingFS) Unwrap() fs.FS {
+	return s.fsys
+}
+
+// Resolve returns the name of the file in the underlying filesystem that is
+// opened for the requested name. It is the name itself if such file exists or
+// the name with the first extension for which the file exists.
+func (s *ExtensionMappingFS) Resolve(name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	_, err := fs.Stat(s.fsys, name)
+	if err == nil {
+		return name, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) || name == "." {
+		return "", err
+	}
+	for _, ext := range s.extensions {
+		candidate := name + ext
+		info, err := fs.Stat(s.fsys, candidate)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return "", err
+		}
+		if info.IsDir() {
+			continue
+		}
+		return candidate, nil
+	}
+	return "", &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
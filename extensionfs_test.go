@@ -0,0 +1,66 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+
+	"resenje.org/fsutil"
+)
+
+func TestExtensionMappingFS(t *testing.T) {
+	fsys := fsutil.NewExtensionMappingFS(fsutil.MapFS{
+		"about.html":      {Data: []byte("<h1>About</h1>")},
+		"about.md":        {Data: []byte("# About")},
+		"notes.md":        {Data: []byte("# Notes")},
+		"robots.txt":      {Data: []byte("User-agent: *")},
+		"docs/index.html": {Data: []byte("<h1>Docs</h1>")},
+		"dir.html/a.txt":  {Data: []byte("a")},
+	}, ".html", ".md", ".txt")
+
+	for _, tc := range []struct {
+		name     string
+		resolved string
+		content  string
+	}{
+		{name: "about", resolved: "about.html", content: "<h1>About</h1>"},
+		{name: "about.md", resolved: "about.md", content: "# About"},
+		{name: "notes", resolved: "notes.md", content: "# Notes"},
+		{name: "robots", resolved: "robots.txt", content: "User-agent: *"},
+		{name: "docs/index", resolved: "docs/index.html", content: "<h1>Docs</h1>"},
+		{name: "docs", resolved: "docs", content: ""},
+	} {
+		got, err := fsys.Resolve(tc.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.resolved {
+			t.Errorf("got resolved name %q for %q, want %q", got, tc.name, tc.resolved)
+		}
+		testOpen(t, fsys, tc.name, tc.content)
+		if tc.content != "" {
+			testReadFile(t, fsys, tc.name, tc.content)
+		}
+	}
+
+	info, err := fsys.Stat("about")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name() != "about.html" {
+		t.Errorf("got name %q, want %q", info.Name(), "about.html")
+	}
+
+	for _, name := range []string{"missing", "dir"} {
+		if _, err := fsys.Resolve(name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("got error %v for %q, want %v", err, name, fs.ErrNotExist)
+		}
+		testOpenNotExist(t, fsys, name)
+		testStatNotExist(t, fsys, name)
+	}
+}
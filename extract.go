@@ -0,0 +1,252 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// ArchiveFormat is the format of an archive read by Extract.
+type ArchiveFormat int
+
+// Archive formats supported by Extract.
+const (
+	ArchiveZip ArchiveFormat = iota + 1
+	ArchiveTar
+	ArchiveTarGz
+)
+
+// ErrArchiveTooLarge is returned by Extract if the size of extracted files
+// exceeds the maximal size.
+var ErrArchiveTooLarge = errors.New("archive too large")
+
+// ErrUnsafeArchivePath is returned by Extract for archive entries with names
+// that would be written outside of the destination, such as absolute paths or
+// paths with ".." elements. It wraps fs.ErrInvalid.
+var ErrUnsafeArchivePath = fmt.Errorf("unsafe archive path: %w", fs.ErrInvalid)
+
+// ExtractOption sets an optional parameter of the Extract function.
+type ExtractOption func(*extractOptions)
+
+type extractOptions struct {
+	maxSize   int64
+	maxMemory int64
+	tmpDir    string
+}
+
+// WithExtractMaxSize sets the maximal total size in bytes of extracted files.
+// The number of extracted bytes is counted, regardless of sizes declared in
+// the archive, so that decompression bombs are stopped. By default, the size
+// is not limited.
+func WithExtractMaxSize(n int64) ExtractOption {
+	return func(o *extractOptions) {
+		o.maxSize = n
+	}
+}
+
+// WithExtractTempDir sets the directory for the temporary file with a zip
+// archive larger than 1 MiB, which needs random access. By default, the
+// default directory for temporary files is used.
+func WithExtractTempDir(dir string) ExtractOption {
+	return func(o *extractOptions) {
+		o.tmpDir = dir
+	}
+}
+
+// Extract writes regular files and directories from the archive in the format
+// to the dst filesystem. Other entries, such as links, are ignored. Entries
+// with names that are not safe to write, which could be written outside of
+// the destination, result in the ErrUnsafeArchivePath error. If dst
+// implements MkdirAllFS, directories are created, otherwise dst must create
+// parent directories on WriteFile. The content of every file is read into
+// memory before it is written, which can be limited with the
+// WithExtractMaxSize option. A zip archive is read into memory or to a
+// temporary file before extraction, as it requires random access. Files that
+// are extracted before an error is returned are not removed.
+func Extract(dst WriteFileFS, archive io.Reader, format ArchiveFormat, opts ...ExtractOption) error {
+	o := extractOptions{
+		maxMemory: defaultSeekableMaxMemory,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	x := &extractor{
+		dst: dst,
+		o:   o,
+	}
+
+	var err error
+	switch format {
+	case ArchiveZip:
+		err = x.zip(archive)
+	case ArchiveTar:
+		err = x.tar(archive)
+	case ArchiveTarGz:
+		var zr *gzip.Reader
+		zr, err = gzip.NewReader(archive)
+		if err != nil {
+			break
+		}
+		err = x.tar(zr)
+		if cerr := zr.Close(); err == nil {
+			err = cerr
+		}
+	default:
+		err = fmt.Errorf("unsupported archive format %v", format)
+	}
+	if err != nil {
+		return fmt.Errorf("extract: %w", err)
+	}
+	return nil
+}
+
+// extractor writes archive entries to the destination filesystem and counts
+// the number of extracted bytes.
+type extractor struct {
+	dst     WriteFileFS
+	o       extractOptions
+	written int64
+}
+
+func (x *extractor) tar(r io.Reader) error {
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch h.Typeflag {
+		case tar.TypeDir:
+			if err := x.dir(h.Name, h.FileInfo().Mode()); err != nil {
+				return err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			if isSparseTarHeader(h) {
+				continue
+			}
+			if err := x.file(h.Name, h.FileInfo().Mode(), tr); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (x *extractor) zip(r io.Reader) error {
+	spilled, tmpFile, err := spill(r, x.o.maxMemory, x.o.tmpDir)
+	if err != nil {
+		return err
+	}
+	if tmpFile != nil {
+		defer func() {
+			tmpFile.Close()
+			os.Remove(tmpFile.Name())
+		}()
+	}
+	size, err := spilled.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(spilled, size)
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		mode := f.Mode()
+		if strings.HasSuffix(f.Name, "/") || mode.IsDir() {
+			if err := x.dir(f.Name, mode); err != nil {
+				return err
+			}
+			continue
+		}
+		if !mode.IsRegular() {
+			continue
+		}
+		if err := x.zipFile(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x *extractor) zipFile(f *zip.File) error {
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("open %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+
+	return x.file(f.Name, f.Mode(), rc)
+}
+
+// dir creates the directory if the destination implements MkdirAllFS.
+func (x *extractor) dir(name string, mode fs.FileMode) error {
+	name, err := safeArchivePath(name)
+	if err != nil {
+		return err
+	}
+	if name == "." {
+		return nil
+	}
+	if d, ok := x.dst.(MkdirAllFS); ok {
+		return d.MkdirAll(name, mode.Perm()|0o700)
+	}
+	return nil
+}
+
+// file writes the file with the content read from r to the destination, if
+// the maximal size is not exceeded.
+func (x *extractor) file(name string, mode fs.FileMode, r io.Reader) error {
+	name, err := safeArchivePath(name)
+	if err != nil {
+		return err
+	}
+	if name == "." {
+		return &fs.PathError{Op: "extract", Path: name, Err: ErrUnsafeArchivePath}
+	}
+	if x.o.maxSize > 0 {
+		r = io.LimitReader(r, x.o.maxSize-x.written+1)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", name, err)
+	}
+	x.written += int64(len(data))
+	if x.o.maxSize > 0 && x.written > x.o.maxSize {
+		return ErrArchiveTooLarge
+	}
+	if d, ok := x.dst.(MkdirAllFS); ok {
+		if dir := path.Dir(name); dir != "." {
+			if err := d.MkdirAll(dir, 0o755); err != nil {
+				return err
+			}
+		}
+	}
+	return x.dst.WriteFile(name, data, mode.Perm()|0o600)
+}
+
+// safeArchivePath returns the cleaned name of an archive entry or
+// ErrUnsafeArchivePath if the name is not a valid fs.FS path, such as absolute
+// paths and paths outside of the archive root. Backslashes are not allowed,
+// as they are path separators on Windows.
+func safeArchivePath(name string) (string, error) {
+	cleaned := path.Clean(strings.TrimSuffix(name, "/"))
+	if !fs.ValidPath(cleaned) || strings.Contains(name, `\`) {
+		return "", &fs.PathError{Op: "extract", Path: name, Err: ErrUnsafeArchivePath}
+	}
+	return cleaned, nil
+}
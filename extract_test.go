@@ -0,0 +1,219 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestExtract(t *testing.T) {
+	modTime := time.Date(2021, 8, 9, 10, 0, 0, 0, time.UTC)
+
+	tarData := newExtractTar(t, []extractTarEntry{
+		{name: "index.html", content: "<html>"},
+		{name: "assets/", typeflag: tar.TypeDir},
+		{name: "./assets/main.css", content: "body{}"},
+		{name: "assets/img/logo.svg", content: "<svg></svg>"},
+		{name: "link.html", typeflag: tar.TypeSymlink, linkname: "/etc/passwd"},
+	})
+	var tarGzData bytes.Buffer
+	zw := gzip.NewWriter(&tarGzData)
+	if _, err := zw.Write(tarData); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zipData := newZip(t, modTime, []zipTestFile{
+		{name: "index.html", content: "<html>"},
+		{name: "assets/", mode: fs.ModeDir | 0o755},
+		{name: "assets/main.css", content: "body{}"},
+		{name: "assets/img/logo.svg", content: "<svg></svg>", method: 8},
+		{name: "link.html", content: "/etc/passwd", mode: fs.ModeSymlink | 0o777},
+	})
+	// An archive larger than 1 MiB is written to a temporary file.
+	largeZipData := newZip(t, modTime, []zipTestFile{
+		{name: "index.html", content: "<html>"},
+		{name: "assets/main.css", content: "body{}"},
+		{name: "assets/img/logo.svg", content: "<svg></svg>"},
+		{name: "large.bin", content: strings.Repeat("0", 1<<20)},
+	})
+	tmpDir := t.TempDir()
+
+	for _, tc := range []struct {
+		name   string
+		data   []byte
+		format fsutil.ArchiveFormat
+		opts   []fsutil.ExtractOption
+	}{
+		{name: "tar", data: tarData, format: fsutil.ArchiveTar},
+		{name: "tar.gz", data: tarGzData.Bytes(), format: fsutil.ArchiveTarGz},
+		{name: "zip", data: zipData, format: fsutil.ArchiveZip},
+		{
+			name:   "zip in temporary file",
+			data:   largeZipData,
+			format: fsutil.ArchiveZip,
+			opts:   []fsutil.ExtractOption{fsutil.WithExtractTempDir(tmpDir)},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dst := newExtractTempFS(t)
+
+			if err := fsutil.Extract(dst, bytes.NewReader(tc.data), tc.format, tc.opts...); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := fstest.TestFS(dst, "index.html", "assets/main.css", "assets/img/logo.svg"); err != nil {
+				t.Fatal(err)
+			}
+			testReadFile(t, dst, "index.html", "<html>")
+			testReadFile(t, dst, "assets/main.css", "body{}")
+			testReadFile(t, dst, "assets/img/logo.svg", "<svg></svg>")
+			testReadFileNotExist(t, dst, "link.html")
+
+			entries, err := os.ReadDir(tmpDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("got %v temporary files after extraction, want none", len(entries))
+			}
+		})
+	}
+}
+
+func TestExtract_unsafePath(t *testing.T) {
+	for _, name := range []string{
+		"../evil.txt",
+		"assets/../../evil.txt",
+		"/etc/evil.txt",
+		`..\evil.txt`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			for _, tc := range []struct {
+				format fsutil.ArchiveFormat
+				data   []byte
+			}{
+				{format: fsutil.ArchiveTar, data: newExtractTar(t, []extractTarEntry{{name: name, content: "evil"}})},
+				{format: fsutil.ArchiveZip, data: newZip(t, time.Now(), []zipTestFile{{name: name, content: "evil"}})},
+			} {
+				dst := newExtractTempFS(t)
+				err := fsutil.Extract(dst, bytes.NewReader(tc.data), tc.format)
+				if !errors.Is(err, fsutil.ErrUnsafeArchivePath) {
+					t.Errorf("got error %v, want %v", err, fsutil.ErrUnsafeArchivePath)
+				}
+				if !errors.Is(err, fs.ErrInvalid) {
+					t.Errorf("got error %v, want %v", err, fs.ErrInvalid)
+				}
+			}
+		})
+	}
+}
+
+func TestExtract_maxSize(t *testing.T) {
+	large := strings.Repeat("0", 1000)
+	zipData := newZip(t, time.Now(), []zipTestFile{
+		{name: "small.txt", content: "small"},
+		{name: "large.txt", content: large, method: 8},
+	})
+	tarData := newExtractTar(t, []extractTarEntry{
+		{name: "small.txt", content: "small"},
+		{name: "large.txt", content: large},
+	})
+
+	for _, tc := range []struct {
+		name   string
+		data   []byte
+		format fsutil.ArchiveFormat
+	}{
+		{name: "tar", data: tarData, format: fsutil.ArchiveTar},
+		{name: "zip", data: zipData, format: fsutil.ArchiveZip},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dst := newExtractTempFS(t)
+			err := fsutil.Extract(dst, bytes.NewReader(tc.data), tc.format, fsutil.WithExtractMaxSize(1004))
+			if !errors.Is(err, fsutil.ErrArchiveTooLarge) {
+				t.Errorf("got error %v, want %v", err, fsutil.ErrArchiveTooLarge)
+			}
+			testReadFileNotExist(t, dst, "large.txt")
+
+			dst = newExtractTempFS(t)
+			if err := fsutil.Extract(dst, bytes.NewReader(tc.data), tc.format, fsutil.WithExtractMaxSize(1005)); err != nil {
+				t.Fatal(err)
+			}
+			testReadFile(t, dst, "large.txt", large)
+		})
+	}
+}
+
+func TestExtract_unsupportedFormat(t *testing.T) {
+	if err := fsutil.Extract(newExtractTempFS(t), bytes.NewReader(nil), fsutil.ArchiveFormat(0)); err == nil {
+		t.Error("expected error for unsupported format")
+	}
+}
+
+func newExtractTempFS(t *testing.T) *fsutil.TempFS {
+	t.Helper()
+
+	fsys, err := fsutil.NewTempFS(context.Background(), fsutil.WithTempFSDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fsys.Close() })
+	return fsys
+}
+
+type extractTarEntry struct {
+	name     string
+	content  string
+	typeflag byte
+	linkname string
+}
+
+func newExtractTar(t *testing.T, entries []extractTarEntry) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		h := &tar.Header{
+			Name:     e.name,
+			Typeflag: e.typeflag,
+			Linkname: e.linkname,
+			Mode:     0o644,
+			Size:     int64(len(e.content)),
+		}
+		if h.Typeflag == 0 {
+			h.Typeflag = tar.TypeReg
+		}
+		if h.Typeflag == tar.TypeDir {
+			h.Mode = 0o755
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(tw, e.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"errors"
+	"strings"
+)
+
+// fileError is an error for a file. Exported errors for files, such as
+// VerifyFileError, have the same fields, so that they can be converted to it.
+type fileError struct {
+	Path string
+	Err  error
+}
+
+// fileErrors are errors of multiple files. They implement the message and
+// the matching of errors that contain them, as the Unwrap method returning
+// multiple errors is not supported by the errors package before Go 1.20.
+type fileErrors []fileError
+
+// message returns the prefix followed by paths and errors of all files.
+func (e fileErrors) message(prefix string) string {
+	var b strings.Builder
+	b.WriteString(prefix)
+	for i, f := range e {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(f.Path)
+		b.WriteString(": ")
+		b.WriteString(f.Err.Error())
+	}
+	return b.String()
+}
+
+// is reports whether any of the file errors matches the target with
+// errors.Is.
+func (e fileErrors) is(target error) bool {
+	for _, f := range e {
+		if errors.Is(f.Err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// as finds the first file error that matches the target with errors.As.
+func (e fileErrors) as(target interface{}) bool {
+	for _, f := range e {
+		if errors.As(f.Err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,189 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"io/fs"
+	"time"
+)
+
+var (
+	_ fs.FileInfo = (*fileInfo)(nil)
+	_ fs.DirEntry = (*dirEntry)(nil)
+)
+
+// FileInfoOption overrides a property of the file info returned by NewFileInfo
+// or of the dir entry returned by NewDirEntry.
+type FileInfoOption func(*fileInfoOptions)
+
+type fileInfoOptions struct {
+	name       string
+	hasName    bool
+	size       int64
+	hasSize    bool
+	modTime    time.Time
+	hasModTime bool
+	mode       fs.FileMode
+	hasMode    bool
+}
+
+// WithName overrides the base name of the file.
+func WithName(name string) FileInfoOption {
+	return func(o *fileInfoOptions) {
+		o.name = name
+		o.hasName = true
+	}
+}
+
+// WithSize overrides the length in bytes of the file.
+func WithSize(size int64) FileInfoOption {
+	return func(o *fileInfoOptions) {
+		o.size = size
+		o.hasSize = true
+	}
+}
+
+// WithModTime overrides the modification time of the file.
+func WithModTime(modTime time.Time) FileInfoOption {
+	return func(o *fileInfoOptions) {
+		o.modTime = modTime
+		o.hasModTime = true
+	}
+}
+
+// WithMode overrides the file mode bits. The mode also determines the values
+// returned by the IsDir and Type methods.
+func WithMode(mode fs.FileMode) FileInfoOption {
+	return func(o *fileInfoOptions) {
+		o.mode = mode
+		o.hasMode = true
+	}
+}
+
+// NewFileInfo returns the file info that returns properties of info, except
+// the ones that are overridden by the options.
+func NewFileInfo(info fs.FileInfo, opts ...FileInfoOption) fs.FileInfo {
+	var o fileInfoOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return newFileInfo(info, o)
+}
+
+func newFileInfo(info fs.FileInfo, o fileInfoOptions) fs.FileInfo {
+	// Do not wrap already wrapped file info more than once.
+	if i, ok := info.(*fileInfo); ok {
+		info = i.FileInfo
+		o = i.o.merge(o)
+	}
+	return &fileInfo{FileInfo: info, o: o}
+}
+
+// NewDirEntry returns the dir entry that returns properties of e, except the
+// ones that are overridden by the options. The overrides apply to the file
+// info returned by the Info method of the dir entry, as well.
+func NewDirEntry(e fs.DirEntry, opts ...FileInfoOption) fs.DirEntry {
+	var o fileInfoOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if d, ok := e.(*dirEntry); ok {
+		e = d.DirEntry
+		o = d.o.merge(o)
+	}
+	return &dirEntry{DirEntry: e, o: o}
+}
+
+// merge returns options with values from o overridden by the set values from
+// n.
+func (o fileInfoOptions) merge(n fileInfoOptions) fileInfoOptions {
+	if n.hasName {
+		o.name, o.hasName = n.name, true
+	}
+	if n.hasSize {
+		o.size, o.hasSize = n.size, true
+	}
+	if n.hasModTime {
+		o.modTime, o.hasModTime = n.modTime, true
+	}
+	if n.hasMode {
+		o.mode, o.hasMode = n.mode, true
+	}
+	return o
+}
+
+// fileInfo is the file info with overridden properties.
+type fileInfo struct {
+	fs.FileInfo
+	o fileInfoOptions
+}
+
+func (i *fileInfo) Name() string {
+	if i.o.hasName {
+		return i.o.name
+	}
+	return i.FileInfo.Name()
+}
+
+func (i *fileInfo) Size() int64 {
+	if i.o.hasSize {
+		return i.o.size
+	}
+	return i.FileInfo.Size()
+}
+
+func (i *fileInfo) Mode() fs.FileMode {
+	if i.o.hasMode {
+		return i.o.mode
+	}
+	return i.FileInfo.Mode()
+}
+
+func (i *fileInfo) ModTime() time.Time {
+	if i.o.hasModTime {
+		return i.o.modTime
+	}
+	return i.FileInfo.ModTime()
+}
+
+func (i *fileInfo) IsDir() bool {
+	return i.Mode().IsDir()
+}
+
+// dirEntry is the dir entry with overridden properties.
+type dirEntry struct {
+	fs.DirEntry
+	o fileInfoOptions
+}
+
+func (e *dirEntry) Name() string {
+	if e.o.hasName {
+		return e.o.name
+	}
+	return e.DirEntry.Name()
+}
+
+func (e *dirEntry) IsDir() bool {
+	if e.o.hasMode {
+		return e.o.mode.IsDir()
+	}
+	return e.DirEntry.IsDir()
+}
+
+func (e *dirEntry) Type() fs.FileMode {
+	if e.o.hasMode {
+		return e.o.mode.Type()
+	}
+	return e.DirEntry.Type()
+}
+
+func (e *dirEntry) Info() (fs.FileInfo, error) {
+	info, err := e.DirEntry.Info()
+	if err != nil {
+		return nil, err
+	}
+	return newFileInfo(info, e.o), nil
+}
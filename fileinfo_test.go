@@ -0,0 +1,99 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"io/fs"
+	"testing"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestNewFileInfo(t *testing.T) {
+	modTime := time.Date(2021, 8, 9, 10, 11, 12, 0, time.UTC)
+	setTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	files := fsutil.MapFS{
+		"page.html": {Data: []byte("<html>"), ModTime: modTime, Mode: 0o644},
+	}
+	info, err := fs.Stat(files, "page.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("no options", func(t *testing.T) {
+		got := fsutil.NewFileInfo(info)
+		testFileInfoProperties(t, got, "page.html", 6, 0o644, modTime)
+	})
+
+	t.Run("overrides", func(t *testing.T) {
+		got := fsutil.NewFileInfo(info,
+			fsutil.WithName("index.html"),
+			fsutil.WithSize(100),
+			fsutil.WithModTime(setTime),
+		)
+		testFileInfoProperties(t, got, "index.html", 100, 0o644, setTime)
+
+		got = fsutil.NewFileInfo(got, fsutil.WithName("home.html"), fsutil.WithMode(fs.ModeDir|0o755))
+		testFileInfoProperties(t, got, "home.html", 100, fs.ModeDir|0o755, setTime)
+		if !got.IsDir() {
+			t.Error("got not directory, want directory")
+		}
+	})
+
+	t.Run("dir entry", func(t *testing.T) {
+		entries, err := fs.ReadDir(files, ".")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 {
+			t.Fatalf("got %v entries, want 1", len(entries))
+		}
+
+		e := fsutil.NewDirEntry(entries[0], fsutil.WithName("index.html"), fsutil.WithModTime(setTime))
+		if got, want := e.Name(), "index.html"; got != want {
+			t.Errorf("got name %q, want %q", got, want)
+		}
+		if e.IsDir() {
+			t.Error("got directory, want not directory")
+		}
+		info, err := e.Info()
+		if err != nil {
+			t.Fatal(err)
+		}
+		testFileInfoProperties(t, info, "index.html", 6, 0o644, setTime)
+
+		e = fsutil.NewDirEntry(e, fsutil.WithSize(10), fsutil.WithMode(fs.ModeDir))
+		if !e.IsDir() {
+			t.Error("got not directory, want directory")
+		}
+		if got, want := e.Type(), fs.ModeDir; got != want {
+			t.Errorf("got type %v, want %v", got, want)
+		}
+		info, err = e.Info()
+		if err != nil {
+			t.Fatal(err)
+		}
+		testFileInfoProperties(t, info, "index.html", 10, fs.ModeDir, setTime)
+	})
+}
+
+func testFileInfoProperties(t *testing.T, info fs.FileInfo, name string, size int64, mode fs.FileMode, modTime time.Time) {
+	t.Helper()
+
+	if got := info.Name(); got != name {
+		t.Errorf("got name %q, want %q", got, name)
+	}
+	if got := info.Size(); got != size {
+		t.Errorf("got size %v, want %v", got, size)
+	}
+	if got := info.Mode(); got != mode {
+		t.Errorf("got mode %v, want %v", got, mode)
+	}
+	if got := info.ModTime(); !got.Equal(modTime) {
+		t.Errorf("got mod time %v, want %v", got, modTime)
+	}
+}
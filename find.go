@@ -0,0 +1,248 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"regexp"
+	"time"
+)
+
+// FindOption sets a predicate that files found by Find must match.
+type FindOption func(*findOptions)
+
+type findOptions struct {
+	namePattern string
+	pathPattern string
+
+	minSize, maxSize int64
+
+	modifiedAfter, modifiedBefore time.Time
+
+	content         *regexp.Regexp
+	contentMaxBytes int64
+}
+
+// WithFindName matches files with base names that match the pattern with the
+// same syntax as GlobAll, for example "*.{css,js}".
+func WithFindName(pattern string) FindOption {
+	return func(o *findOptions) {
+		o.namePattern = pattern
+	}
+}
+
+// WithFindPath matches files with paths that match the pattern with the same
+// syntax as GlobAll, for example "assets/**/*.css".
+func WithFindPath(pattern string) FindOption {
+	return func(o *findOptions) {
+		o.pathPattern = pattern
+	}
+}
+
+// WithFindSize matches files with sizes from min to max bytes, inclusive. A
+// negative max does not limit the size.
+func WithFindSize(min, max int64) FindOption {
+	return func(o *findOptions) {
+		o.minSize = min
+		o.maxSize = max
+	}
+}
+
+// WithFindModTime matches files modified after the after time and before the
+// before time. Zero times do not limit the modification time.
+func WithFindModTime(after, before time.Time) FindOption {
+	return func(o *findOptions) {
+		o.modifiedAfter = after
+		o.modifiedBefore = before
+	}
+}
+
+// WithFindContent matches files with content that matches the regular
+// expression. Only the first maxBytes of every file are read, so that large
+// files do not have to be read completely.
+func WithFindContent(re *regexp.Regexp, maxBytes int64) FindOption {
+	return func(o *findOptions) {
+		o.content = re
+		o.contentMaxBytes = maxBytes
+	}
+}
+
+// Finder iterates over files found by the Find function. Directories are read
+// and predicates are evaluated only when the Next method is called. Files are
+// found in lexical order, as with fs.WalkDir.
+type Finder struct {
+	fsys fs.FS
+	o    findOptions
+
+	dirs    []findDir
+	started bool
+
+	path  string
+	entry fs.DirEntry
+	err   error
+}
+
+// findDir is a directory with entries that are not iterated over yet.
+type findDir struct {
+	path    string
+	entries []fs.DirEntry
+}
+
+// Find returns a Finder for all files that are not directories in the
+// filesystem and that match all predicates set by options.
+func Find(fsys fs.FS, opts ...FindOption) *Finder {
+	o := findOptions{
+		maxSize: -1,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Finder{
+		fsys: fsys,
+		o:    o,
+	}
+}
+
+// Next advances the Finder to the next matched file, which is then available
+// through the Path and Entry methods. It returns false when there are no more
+// files or when an error occurs, which is returned by the Err method.
+func (f *Finder) Next() bool {
+	if f.err != nil {
+		return false
+	}
+	if !f.started {
+		f.started = true
+		if err := f.pushDir("."); err != nil {
+			f.err = err
+			return false
+		}
+	}
+	for len(f.dirs) > 0 {
+		dir := &f.dirs[len(f.dirs)-1]
+		if len(dir.entries) == 0 {
+			f.dirs = f.dirs[:len(f.dirs)-1]
+			continue
+		}
+		e := dir.entries[0]
+		dir.entries = dir.entries[1:]
+		p := path.Join(dir.path, e.Name())
+
+		if e.IsDir() {
+			if err := f.pushDir(p); err != nil {
+				f.err = err
+				return false
+			}
+			continue
+		}
+
+		ok, err := f.match(p, e)
+		if err != nil {
+			f.err = err
+			return false
+		}
+		if ok {
+			f.path = p
+			f.entry = e
+			return true
+		}
+	}
+	f.path = ""
+	f.entry = nil
+	return false
+}
+
+// Path returns the path of the current file.
+func (f *Finder) Path() string {
+	return f.path
+}
+
+// Entry returns the directory entry of the current file.
+func (f *Finder) Entry() fs.DirEntry {
+	return f.entry
+}
+
+// Err returns the error that stopped the iteration.
+func (f *Finder) Err() error {
+	return f.err
+}
+
+// All iterates over all remaining files and returns their paths.
+func (f *Finder) All() ([]string, error) {
+	var paths []string
+	for f.Next() {
+		paths = append(paths, f.Path())
+	}
+	return paths, f.Err()
+}
+
+func (f *Finder) pushDir(name string) error {
+	entries, err := fs.ReadDir(f.fsys, name)
+	if err != nil {
+		return fmt.Errorf("find: %w", err)
+	}
+	f.dirs = append(f.dirs, findDir{path: name, entries: entries})
+	return nil
+}
+
+// match evaluates predicates from the cheapest to the most expensive one.
+func (f *Finder) match(p string, e fs.DirEntry) (bool, error) {
+	if f.o.namePattern != "" {
+		ok, err := MatchAll(f.o.namePattern, e.Name())
+		if err != nil {
+			return false, fmt.Errorf("find: %w", err)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	if f.o.pathPattern != "" {
+		ok, err := MatchAll(f.o.pathPattern, p)
+		if err != nil {
+			return false, fmt.Errorf("find: %w", err)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+
+	if f.o.minSize > 0 || f.o.maxSize >= 0 || !f.o.modifiedAfter.IsZero() || !f.o.modifiedBefore.IsZero() {
+		info, err := e.Info()
+		if err != nil {
+			return false, fmt.Errorf("find: %w", err)
+		}
+		size := info.Size()
+		if size < f.o.minSize || (f.o.maxSize >= 0 && size > f.o.maxSize) {
+			return false, nil
+		}
+		modTime := info.ModTime()
+		if !f.o.modifiedAfter.IsZero() && !modTime.After(f.o.modifiedAfter) {
+			return false, nil
+		}
+		if !f.o.modifiedBefore.IsZero() && !modTime.Before(f.o.modifiedBefore) {
+			return false, nil
+		}
+	}
+
+	if f.o.content != nil {
+		file, err := f.fsys.Open(p)
+		if err != nil {
+			return false, fmt.Errorf("find: %w", err)
+		}
+		defer file.Close()
+
+		data, err := io.ReadAll(io.LimitReader(file, f.o.contentMaxBytes))
+		if err != nil {
+			return false, fmt.Errorf("find: read %s: %w", p, err)
+		}
+		if !f.o.content.Match(data) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
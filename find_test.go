@@ -0,0 +1,163 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestFind(t *testing.T) {
+	t1 := time.Date(2021, 4, 20, 10, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	t3 := t2.Add(time.Hour)
+
+	files := fstest.MapFS{
+		"index.html":           {Data: []byte("<html><title>Home</title>"), ModTime: t1},
+		"assets/main.css":      {Data: []byte("body{color:red}"), ModTime: t2},
+		"assets/main.js":       {Data: []byte("alert('TODO')"), ModTime: t3},
+		"assets/vendor/lib.js": {Data: []byte("/* library */"), ModTime: t1},
+		"notes/todo.txt":       {Data: []byte("first line\nTODO: later"), ModTime: t3},
+		"empty":                {Mode: fs.ModeDir},
+	}
+
+	for _, tc := range []struct {
+		name string
+		opts []fsutil.FindOption
+		want []string
+	}{
+		{
+			name: "all",
+			want: []string{"assets/main.css", "assets/main.js", "assets/vendor/lib.js", "index.html", "notes/todo.txt"},
+		},
+		{
+			name: "name",
+			opts: []fsutil.FindOption{fsutil.WithFindName("*.{css,js}")},
+			want: []string{"assets/main.css", "assets/main.js", "assets/vendor/lib.js"},
+		},
+		{
+			name: "path",
+			opts: []fsutil.FindOption{fsutil.WithFindPath("assets/*")},
+			want: []string{"assets/main.css", "assets/main.js"},
+		},
+		{
+			name: "size",
+			opts: []fsutil.FindOption{fsutil.WithFindSize(14, 20)},
+			want: []string{"assets/main.css"},
+		},
+		{
+			name: "min size",
+			opts: []fsutil.FindOption{fsutil.WithFindSize(20, -1)},
+			want: []string{"index.html", "notes/todo.txt"},
+		},
+		{
+			name: "mod time",
+			opts: []fsutil.FindOption{fsutil.WithFindModTime(t1, t3)},
+			want: []string{"assets/main.css"},
+		},
+		{
+			name: "modified after",
+			opts: []fsutil.FindOption{fsutil.WithFindModTime(t2, time.Time{})},
+			want: []string{"assets/main.js", "notes/todo.txt"},
+		},
+		{
+			name: "content",
+			opts: []fsutil.FindOption{fsutil.WithFindContent(regexp.MustCompile("TODO"), 1024)},
+			want: []string{"assets/main.js", "notes/todo.txt"},
+		},
+		{
+			name: "content max bytes",
+			opts: []fsutil.FindOption{fsutil.WithFindContent(regexp.MustCompile("TODO"), 12)},
+			want: []string{"assets/main.js"},
+		},
+		{
+			name: "combined",
+			opts: []fsutil.FindOption{
+				fsutil.WithFindName("*.js"),
+				fsutil.WithFindContent(regexp.MustCompile("TODO"), 1024),
+			},
+			want: []string{"assets/main.js"},
+		},
+		{
+			name: "none",
+			opts: []fsutil.FindOption{fsutil.WithFindName("*.go")},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := fsutil.Find(files, tc.opts...).All()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFind_lazy(t *testing.T) {
+	files := fstest.MapFS{
+		"a/1.txt": {Data: []byte("1")},
+		"b/2.txt": {Data: []byte("2")},
+	}
+
+	var readDirs []string
+	fsys := fsutil.FSFunc(func(name string) (fs.File, error) {
+		if path.Ext(name) != ".txt" {
+			readDirs = append(readDirs, name)
+		}
+		return files.Open(name)
+	})
+
+	f := fsutil.Find(fsys)
+	if len(readDirs) != 0 {
+		t.Errorf("got read directories %v before iteration", readDirs)
+	}
+
+	if !f.Next() {
+		t.Fatal(f.Err())
+	}
+	if got, want := f.Path(), "a/1.txt"; got != want {
+		t.Errorf("got path %q, want %q", got, want)
+	}
+	if got, want := f.Entry().Name(), "1.txt"; got != want {
+		t.Errorf("got entry name %q, want %q", got, want)
+	}
+	if fmt.Sprint(readDirs) != "[. a]" {
+		t.Errorf("got read directories %v", readDirs)
+	}
+
+	if !f.Next() || f.Path() != "b/2.txt" {
+		t.Fatalf("got path %q, error %v", f.Path(), f.Err())
+	}
+	if f.Next() {
+		t.Errorf("got unexpected path %q", f.Path())
+	}
+	if err := f.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFind_error(t *testing.T) {
+	if _, err := fsutil.Find(faultyFS{}).All(); !errors.Is(err, errTest1) {
+		t.Errorf("got error %v, want %v", err, errTest1)
+	}
+
+	files := fstest.MapFS{
+		"a.txt": {Data: []byte("a")},
+	}
+	if _, err := fsutil.Find(files, fsutil.WithFindName("[")).All(); !errors.Is(err, path.ErrBadPattern) {
+		t.Errorf("got error %v, want %v", err, path.ErrBadPattern)
+	}
+}
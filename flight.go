@@ -0,0 +1,61 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import "sync"
+
+// flightGroup deduplicates concurrent calls with the same key, so that only
+// the first call executes the function and the others wait for its result.
+// The zero value is ready to use.
+type flightGroup struct {
+	calls map[string]*flightCall
+	mu    sync.Mutex
+}
+
+// flightCall is an in-flight or completed call of flightGroup.
+type flightCall struct {
+	done chan struct{}
+	val  string
+	err  error
+}
+
+// do executes the function and returns its result, unless a call with the
+// same key is in flight, in which case it waits for that call and returns its
+// result.
+func (g *flightGroup) do(key string, fn func() (string, error)) (string, error) {
+	g.mu.Lock()
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		<-c.done
+		return c.val, c.err
+	}
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	c := &flightCall{done: make(chan struct{})}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		if g.calls[key] == c {
+			delete(g.calls, key)
+		}
+		g.mu.Unlock()
+		close(c.done)
+	}()
+
+	c.val, c.err = fn()
+	return c.val, c.err
+}
+
+// forget makes the following calls with the key execute the function, instead
+// of waiting for the call that is in flight.
+func (g *flightGroup) forget(key string) {
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+}
@@ -0,0 +1,488 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package fstestutil provides checks that implementations of fs.FS behave
+// consistently, such as wrappers built on top of filesystems from the fsutil
+// package. The checks are complementary to the testing/fstest package. They
+// report all inconsistencies instead of the first one and they do not require
+// that file names returned by Stat of opened files are base names of the
+// opened paths.
+package fstestutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Error is returned by CheckFS and it contains all failed checks.
+type Error struct {
+	Failures []Failure
+}
+
+// Failure describes an inconsistency found by a check.
+type Failure struct {
+	// Check is the name of the check.
+	Check string
+	// Path is the path of the file that is checked.
+	Path string
+	// Message describes the inconsistency.
+	Message string
+}
+
+// Error implements error interface.
+func (e *Error) Error() string {
+	var b strings.Builder
+	b.WriteString("fs conformance check failed: ")
+	for i, f := range e.Failures {
+		if i > 0 {
+			b.WriteString("; ")
+		}
+		b.WriteString(f.String())
+	}
+	return b.String()
+}
+
+// String returns the check, the path and the message.
+func (f Failure) String() string {
+	return f.Check + ": " + f.Path + ": " + f.Message
+}
+
+// checks are all checks in the order in which they are run.
+var checks = []struct {
+	name string
+	fn   func(c *checker)
+}{
+	{name: "expected paths", fn: checkExpectedPaths},
+	{name: "files", fn: checkFiles},
+	{name: "read dir", fn: checkReadDir},
+	{name: "read dir paging", fn: checkReadDirPaging},
+	{name: "glob", fn: checkGlob},
+	{name: "not exist", fn: checkNotExist},
+	{name: "invalid path", fn: checkInvalidPath},
+	{name: "seek", fn: checkSeek},
+}
+
+// RunFSConformance runs every check as a subtest of t, reporting all
+// failures. The expectedPaths must contain paths of files and directories
+// that the filesystem must have, and it may be a subset of all files.
+func RunFSConformance(t *testing.T, fsys fs.FS, expectedPaths []string) {
+	t.Helper()
+
+	for _, check := range checks {
+		check := check
+		t.Run(check.name, func(t *testing.T) {
+			c := newChecker(fsys, expectedPaths, check.name)
+			check.fn(c)
+			for _, f := range c.failures {
+				t.Errorf("%s: %s", f.Path, f.Message)
+			}
+		})
+	}
+}
+
+// CheckFS runs all checks and returns *Error if any of them fails. The
+// expectedPaths must contain paths of files and directories that the
+// filesystem must have, and it may be a subset of all files.
+//
+// The checks verify that:
+//   - all expected paths can be opened and that they are found by fs.WalkDir,
+//   - Stat of the filesystem, Stat of the opened file, directory entries and
+//     ReadFile report the same information about files,
+//   - ReadDir of the filesystem and ReadDir of the opened directory return the
+//     same entries, also when they are read in pages with a positive n,
+//   - Glob finds all files in directories,
+//   - errors for files that do not exist in directories match fs.ErrNotExist
+//     and that they are *fs.PathError,
+//   - names that are not valid paths are rejected with fs.ErrInvalid or
+//     fs.ErrNotExist,
+//   - files that implement io.Seeker seek to the correct offsets.
+func CheckFS(fsys fs.FS, expectedPaths []string) error {
+	var failures []Failure
+	for _, check := range checks {
+		c := newChecker(fsys, expectedPaths, check.name)
+		check.fn(c)
+		failures = append(failures, c.failures...)
+	}
+	if len(failures) > 0 {
+		return &Error{Failures: failures}
+	}
+	return nil
+}
+
+// checker collects failures of a single check.
+type checker struct {
+	fsys          fs.FS
+	expectedPaths []string
+	check         string
+	failures      []Failure
+}
+
+func newChecker(fsys fs.FS, expectedPaths []string, check string) *checker {
+	return &checker{
+		fsys:          fsys,
+		expectedPaths: expectedPaths,
+		check:         check,
+	}
+}
+
+func (c *checker) errorf(name, format string, a ...interface{}) {
+	c.failures = append(c.failures, Failure{
+		Check:   c.check,
+		Path:    name,
+		Message: fmt.Sprintf(format, a...),
+	})
+}
+
+// walk returns paths of all files and directories, or reports a failure.
+func (c *checker) walk() (files, dirs []string) {
+	if err := fs.WalkDir(c.fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			dirs = append(dirs, p)
+		} else {
+			files = append(files, p)
+		}
+		return nil
+	}); err != nil {
+		c.errorf(".", "walk: %v", err)
+	}
+	return files, dirs
+}
+
+func checkExpectedPaths(c *checker) {
+	files, dirs := c.walk()
+	found := make(map[string]struct{}, len(files)+len(dirs))
+	for _, p := range append(files, dirs...) {
+		found[p] = struct{}{}
+	}
+	for _, p := range c.expectedPaths {
+		f, err := c.fsys.Open(p)
+		if err != nil {
+			c.errorf(p, "open: %v", err)
+			continue
+		}
+		f.Close()
+		if _, ok := found[p]; !ok {
+			c.errorf(p, "not found by walking the filesystem")
+		}
+	}
+}
+
+func checkFiles(c *checker) {
+	files, dirs := c.walk()
+	for _, p := range append(dirs, files...) {
+		f, err := c.fsys.Open(p)
+		if err != nil {
+			c.errorf(p, "open: %v", err)
+			continue
+		}
+		fileInfo, err := f.Stat()
+		if err != nil {
+			c.errorf(p, "stat opened file: %v", err)
+			f.Close()
+			continue
+		}
+		var data []byte
+		if !fileInfo.IsDir() {
+			data, err = io.ReadAll(f)
+			if err != nil {
+				c.errorf(p, "read: %v", err)
+			}
+		}
+		f.Close()
+
+		info, err := fs.Stat(c.fsys, p)
+		if err != nil {
+			c.errorf(p, "stat: %v", err)
+			continue
+		}
+		if info.IsDir() != fileInfo.IsDir() || info.Mode() != fileInfo.Mode() || info.Size() != fileInfo.Size() {
+			c.errorf(p, "stat %v differs from stat of opened file %v", formatInfo(info), formatInfo(fileInfo))
+		}
+		if p != "." && info.Name() != path.Base(p) {
+			c.errorf(p, "stat name %q, want %q", info.Name(), path.Base(p))
+		}
+		if fileInfo.IsDir() {
+			if _, err := fs.ReadFile(c.fsys, p); err == nil {
+				c.errorf(p, "read file of a directory returned no error")
+			}
+			continue
+		}
+
+		readFileData, err := fs.ReadFile(c.fsys, p)
+		if err != nil {
+			c.errorf(p, "read file: %v", err)
+			continue
+		}
+		if !bytes.Equal(data, readFileData) {
+			c.errorf(p, "read file data differs from the data read from opened file")
+		}
+		if info.Mode().IsRegular() && int64(len(data)) != info.Size() {
+			c.errorf(p, "read %v bytes, stat size %v", len(data), info.Size())
+		}
+	}
+}
+
+func checkReadDir(c *checker) {
+	_, dirs := c.walk()
+	for _, dir := range dirs {
+		entries, err := fs.ReadDir(c.fsys, dir)
+		if err != nil {
+			c.errorf(dir, "read dir: %v", err)
+			continue
+		}
+		if !sort.SliceIsSorted(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() }) {
+			c.errorf(dir, "read dir entries are not sorted")
+		}
+
+		fileEntries, ok := c.readDirFile(dir, -1)
+		if !ok {
+			continue
+		}
+		if got, want := entryNames(fileEntries), entryNames(entries); got != want {
+			c.errorf(dir, "read dir of opened directory returned %v, want %v", got, want)
+		}
+
+		for _, e := range entries {
+			p := path.Join(dir, e.Name())
+			info, err := e.Info()
+			if err != nil {
+				c.errorf(p, "entry info: %v", err)
+				continue
+			}
+			stat, err := fs.Stat(c.fsys, p)
+			if err != nil {
+				c.errorf(p, "stat: %v", err)
+				continue
+			}
+			if e.IsDir() != stat.IsDir() || e.Type() != stat.Mode().Type() {
+				c.errorf(p, "entry type %v differs from stat mode %v", e.Type(), stat.Mode())
+			}
+			if info.Name() != e.Name() || info.IsDir() != e.IsDir() || info.Mode().Type() != e.Type() {
+				c.errorf(p, "entry info %v differs from the entry %q %v", formatInfo(info), e.Name(), e.Type())
+			}
+		}
+	}
+}
+
+func checkReadDirPaging(c *checker) {
+	_, dirs := c.walk()
+	for _, dir := range dirs {
+		all, ok := c.readDirFile(dir, -1)
+		if !ok {
+			continue
+		}
+
+		f, err := c.fsys.Open(dir)
+		if err != nil {
+			c.errorf(dir, "open: %v", err)
+			continue
+		}
+		d := f.(fs.ReadDirFile)
+		var paged []fs.DirEntry
+		for i := 0; ; i++ {
+			if i > len(all) {
+				c.errorf(dir, "read dir with n=1 did not return io.EOF after %v entries", len(all))
+				break
+			}
+			entries, err := d.ReadDir(1)
+			if len(entries) > 1 {
+				c.errorf(dir, "read dir with n=1 returned %v entries", len(entries))
+			}
+			paged = append(paged, entries...)
+			if err != nil {
+				if err != io.EOF {
+					c.errorf(dir, "read dir with n=1: %v", err)
+				} else if len(entries) != 0 {
+					c.errorf(dir, "read dir with n=1 returned entries with io.EOF")
+				}
+				break
+			}
+			if len(entries) == 0 {
+				c.errorf(dir, "read dir with n=1 returned no entries and no error")
+				break
+			}
+		}
+		f.Close()
+
+		if got, want := entryNames(paged), entryNames(all); got != want {
+			c.errorf(dir, "read dir with n=1 returned %v, want %v", got, want)
+		}
+	}
+}
+
+// readDirFile opens the directory and reads its entries with the ReadDir
+// method of the opened directory.
+func (c *checker) readDirFile(dir string, n int) ([]fs.DirEntry, bool) {
+	f, err := c.fsys.Open(dir)
+	if err != nil {
+		c.errorf(dir, "open: %v", err)
+		return nil, false
+	}
+	defer f.Close()
+
+	d, ok := f.(fs.ReadDirFile)
+	if !ok {
+		c.errorf(dir, "opened directory does not implement fs.ReadDirFile")
+		return nil, false
+	}
+	entries, err := d.ReadDir(n)
+	if err != nil {
+		c.errorf(dir, "read dir of opened directory: %v", err)
+		return nil, false
+	}
+	return entries, true
+}
+
+func checkGlob(c *checker) {
+	_, dirs := c.walk()
+	for _, dir := range dirs {
+		entries, err := fs.ReadDir(c.fsys, dir)
+		if err != nil {
+			c.errorf(dir, "read dir: %v", err)
+			continue
+		}
+		pattern := "*"
+		if dir != "." {
+			pattern = globEscape(dir) + "/*"
+		}
+		matches, err := fs.Glob(c.fsys, pattern)
+		if err != nil {
+			c.errorf(dir, "glob %q: %v", pattern, err)
+			continue
+		}
+		want := make([]string, 0, len(entries))
+		for _, e := range entries {
+			want = append(want, path.Join(dir, e.Name()))
+		}
+		sort.Strings(matches)
+		if got, want := strings.Join(matches, ", "), strings.Join(want, ", "); got != want {
+			c.errorf(dir, "glob %q returned [%v], want [%v]", pattern, got, want)
+		}
+	}
+}
+
+// globEscape escapes glob meta characters in the name.
+func globEscape(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if strings.ContainsRune(`*?[\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func checkNotExist(c *checker) {
+	_, dirs := c.walk()
+	names := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		names = append(names, path.Join(dir, "fstestutil-does-not-exist"))
+	}
+	for _, name := range names {
+		if _, err := c.fsys.Open(name); !isPathErrorNotExist(err) {
+			c.errorf(name, "open returned error %v, want *fs.PathError matching fs.ErrNotExist", err)
+		}
+		if _, err := fs.Stat(c.fsys, name); !isPathErrorNotExist(err) {
+			c.errorf(name, "stat returned error %v, want *fs.PathError matching fs.ErrNotExist", err)
+		}
+		if _, err := fs.ReadFile(c.fsys, name); !errors.Is(err, fs.ErrNotExist) {
+			c.errorf(name, "read file returned error %v, want fs.ErrNotExist", err)
+		}
+		if _, err := fs.ReadDir(c.fsys, name); !errors.Is(err, fs.ErrNotExist) {
+			c.errorf(name, "read dir returned error %v, want fs.ErrNotExist", err)
+		}
+	}
+}
+
+func isPathErrorNotExist(err error) bool {
+	var perr *fs.PathError
+	return errors.As(err, &perr) && errors.Is(err, fs.ErrNotExist)
+}
+
+func checkInvalidPath(c *checker) {
+	for _, name := range []string{"/", "/abs", "../escape", "a/../b", "a//b", "a/", ""} {
+		f, err := c.fsys.Open(name)
+		if err == nil {
+			f.Close()
+			c.errorf(name, "open of invalid path returned no error")
+			continue
+		}
+		if !errors.Is(err, fs.ErrInvalid) && !errors.Is(err, fs.ErrNotExist) {
+			c.errorf(name, "open of invalid path returned error %v, want fs.ErrInvalid or fs.ErrNotExist", err)
+		}
+	}
+}
+
+func checkSeek(c *checker) {
+	files, _ := c.walk()
+	for _, p := range files {
+		data, err := fs.ReadFile(c.fsys, p)
+		if err != nil {
+			c.errorf(p, "read file: %v", err)
+			continue
+		}
+		f, err := c.fsys.Open(p)
+		if err != nil {
+			c.errorf(p, "open: %v", err)
+			continue
+		}
+		if s, ok := f.(io.Seeker); ok {
+			c.seek(p, s, f, data)
+		}
+		f.Close()
+	}
+}
+
+func (c *checker) seek(p string, s io.Seeker, r io.Reader, data []byte) {
+	size := int64(len(data))
+	offset := size / 2
+
+	if n, err := s.Seek(offset, io.SeekStart); err != nil || n != offset {
+		c.errorf(p, "seek to %v from start returned %v, %v", offset, n, err)
+		return
+	}
+	rest, err := io.ReadAll(r)
+	if err != nil {
+		c.errorf(p, "read after seek: %v", err)
+		return
+	}
+	if !bytes.Equal(rest, data[offset:]) {
+		c.errorf(p, "read after seek to %v returned different data", offset)
+	}
+
+	if n, err := s.Seek(0, io.SeekEnd); err != nil || n != size {
+		c.errorf(p, "seek to end returned %v, %v, want %v", n, err, size)
+	}
+	if n, err := s.Seek(-offset, io.SeekCurrent); err != nil || n != size-offset {
+		c.errorf(p, "seek %v from current returned %v, %v, want %v", -offset, n, err, size-offset)
+	}
+	if n, err := s.Seek(-1, io.SeekStart); err == nil {
+		c.errorf(p, "seek to negative offset returned %v and no error", n)
+	}
+}
+
+func entryNames(entries []fs.DirEntry) string {
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return "[" + strings.Join(names, " ") + "]"
+}
+
+func formatInfo(info fs.FileInfo) string {
+	return fmt.Sprintf("%q %v %v bytes", info.Name(), info.Mode(), info.Size())
+}
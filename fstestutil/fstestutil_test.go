@@ -0,0 +1,106 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fstestutil_test
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"resenje.org/fsutil"
+	"resenje.org/fsutil/fstestutil"
+)
+
+var testFiles = fstest.MapFS{
+	"index.html":           {Data: []byte("<html>"), Mode: 0o644},
+	"assets/main.css":      {Data: []byte("body{color:red}"), Mode: 0o644},
+	"assets/vendor/lib.js": {Data: []byte("lib()"), Mode: 0o600},
+	"empty":                {Mode: fs.ModeDir | 0o755},
+}
+
+var testPaths = []string{"index.html", "assets", "assets/main.css", "assets/vendor/lib.js", "empty"}
+
+func TestRunFSConformance(t *testing.T) {
+	backupFS, err := fsutil.NewBackupFS(testFiles, filepath.Join(t.TempDir(), "backup"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	preloaded, err := fsutil.Preload(testFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		fsys fs.FS
+	}{
+		{name: "fstest map", fsys: testFiles},
+		{name: "backup", fsys: backupFS},
+		{name: "preload", fsys: preloaded},
+		{name: "stat cache", fsys: fsutil.NewStatCacheFS(testFiles, time.Minute)},
+		{name: "seekable", fsys: fsutil.SeekableFS(testFiles)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fstestutil.RunFSConformance(t, tc.fsys, testPaths)
+		})
+	}
+}
+
+func TestCheckFS(t *testing.T) {
+	if err := fstestutil.CheckFS(testFiles, testPaths); err != nil {
+		t.Fatal(err)
+	}
+
+	err := fstestutil.CheckFS(testFiles, []string{"missing.txt"})
+	var cerr *fstestutil.Error
+	if !errors.As(err, &cerr) {
+		t.Fatalf("got error %v, want %T", err, cerr)
+	}
+	testFailures(t, cerr, map[string]int{"expected paths": 1})
+
+	err = fstestutil.CheckFS(brokenFS{testFiles}, testPaths)
+	if !errors.As(err, &cerr) {
+		t.Fatalf("got error %v, want %T", err, cerr)
+	}
+	testFailures(t, cerr, map[string]int{"files": 2, "not exist": 4})
+}
+
+func testFailures(t *testing.T, err *fstestutil.Error, want map[string]int) {
+	t.Helper()
+
+	got := make(map[string]int)
+	for _, f := range err.Failures {
+		got[f.Check]++
+	}
+	for check, n := range want {
+		if got[check] != n {
+			t.Errorf("got %v failures of check %q, want %v: %v", got[check], check, n, err)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("got failures %v, want %v", got, want)
+	}
+}
+
+// brokenFS returns a wrong size from Stat of index.html and does not wrap
+// fs.ErrNotExist in errors from Stat.
+type brokenFS struct {
+	fstest.MapFS
+}
+
+func (s brokenFS) Stat(name string) (fs.FileInfo, error) {
+	info, err := s.MapFS.Stat(name)
+	if err != nil {
+		return nil, errors.New("no such file")
+	}
+	if name == "index.html" {
+		return fsutil.NewFileInfo(info, fsutil.WithSize(100)), nil
+	}
+	return info, nil
+}
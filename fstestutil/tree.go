@@ -0,0 +1,120 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fstestutil
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"testing/fstest"
+	"time"
+)
+
+// Tree describes a synthetic file tree for tests and benchmarks. Files are
+// distributed evenly in directories named "dir000", "dir001" and so on, with
+// directories nested Depth levels deep. Files are named "file000.ext",
+// "file001.ext" and so on, where the extension is chosen from Extensions in
+// turn. The content of every file is different and it depends only on its
+// path and size, so that generated trees are the same on every run.
+type Tree struct {
+	// Dirs is the number of directories with files at the deepest level. If
+	// it is zero, files are in the root directory.
+	Dirs int
+	// Depth is the number of directory levels above files, with a single
+	// directory at each level except the last one. Zero is the same as 1 if
+	// Dirs is not zero.
+	Depth int
+	// FilesPerDir is the number of files in every directory.
+	FilesPerDir int
+	// FileSize is the size of every file in bytes.
+	FileSize int
+	// Extensions of file names, "txt" if none are set.
+	Extensions []string
+	// ModTime is the modification time of all files and directories.
+	ModTime time.Time
+}
+
+// Paths returns slash-separated paths of all files in the tree, in the order
+// of directories and files within them.
+func (t Tree) Paths() []string {
+	exts := t.Extensions
+	if len(exts) == 0 {
+		exts = []string{"txt"}
+	}
+	dirs := t.dirs()
+	paths := make([]string, 0, len(dirs)*t.FilesPerDir)
+	for _, d := range dirs {
+		for i := 0; i < t.FilesPerDir; i++ {
+			paths = append(paths, path.Join(d, fmt.Sprintf("file%03d.%s", i, exts[i%len(exts)])))
+		}
+	}
+	return paths
+}
+
+// dirs returns paths of directories that contain files.
+func (t Tree) dirs() []string {
+	if t.Dirs <= 0 {
+		return []string{"."}
+	}
+	parent := "."
+	for i := 1; i < t.Depth; i++ {
+		parent = path.Join(parent, fmt.Sprintf("dir%03d", 0))
+	}
+	dirs := make([]string, 0, t.Dirs)
+	for i := 0; i < t.Dirs; i++ {
+		dirs = append(dirs, path.Join(parent, fmt.Sprintf("dir%03d", i)))
+	}
+	return dirs
+}
+
+// Content returns the content of the file with the path in the tree.
+func (t Tree) Content(name string) []byte {
+	data := make([]byte, t.FileSize)
+	seed := uint32(2166136261)
+	for i := 0; i < len(name); i++ {
+		seed = (seed ^ uint32(name[i])) * 16777619
+	}
+	for i := range data {
+		seed = seed*1664525 + 1013904223
+		data[i] = byte(seed >> 24)
+	}
+	return data
+}
+
+// MapFS returns the tree as an in-memory filesystem.
+func (t Tree) MapFS() fstest.MapFS {
+	m := make(fstest.MapFS)
+	for _, p := range t.Paths() {
+		m[p] = &fstest.MapFile{
+			Data:    t.Content(p),
+			Mode:    0o644,
+			ModTime: t.ModTime,
+		}
+	}
+	return m
+}
+
+// Write creates the tree in the directory dir on the disk, which must exist.
+func (t Tree) Write(dir string) error {
+	for _, d := range t.dirs() {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.FromSlash(d)), 0o777); err != nil {
+			return err
+		}
+	}
+	for _, p := range t.Paths() {
+		name := filepath.Join(dir, filepath.FromSlash(p))
+		if err := os.WriteFile(name, t.Content(p), 0o666); err != nil {
+			return err
+		}
+		if !t.ModTime.IsZero() {
+			if err := os.Chtimes(name, t.ModTime, t.ModTime); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fstestutil_test
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"resenje.org/fsutil/fstestutil"
+)
+
+func TestTree(t *testing.T) {
+	tree := fstestutil.Tree{
+		Dirs:        3,
+		Depth:       2,
+		FilesPerDir: 4,
+		FileSize:    100,
+		Extensions:  []string{"css", "js"},
+		ModTime:     time.Date(2021, 8, 9, 10, 11, 12, 0, time.UTC),
+	}
+
+	paths := tree.Paths()
+	if len(paths) != 12 {
+		t.Fatalf("got %v paths, want %v", len(paths), 12)
+	}
+	if want := []string{"dir000/dir000/file000.css", "dir000/dir000/file001.js"}; !reflect.DeepEqual(paths[:2], want) {
+		t.Errorf("got paths %v, want %v", paths[:2], want)
+	}
+	if want := "dir000/dir002/file003.js"; paths[11] != want {
+		t.Errorf("got path %q, want %q", paths[11], want)
+	}
+	if bytes.Equal(tree.Content(paths[0]), tree.Content(paths[1])) {
+		t.Error("got the same content for different files")
+	}
+	if !bytes.Equal(tree.Content(paths[0]), tree.Content(paths[0])) {
+		t.Error("got different content for the same file")
+	}
+
+	t.Run("map", func(t *testing.T) {
+		if err := fstest.TestFS(tree.MapFS(), paths...); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("write", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := tree.Write(dir); err != nil {
+			t.Fatal(err)
+		}
+		fsys := os.DirFS(dir)
+		if err := fstest.TestFS(fsys, paths...); err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range paths {
+			data, err := fs.ReadFile(fsys, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, tree.Content(p)) {
+				t.Errorf("got different content of %s", p)
+			}
+			info, err := fs.Stat(fsys, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !info.ModTime().Equal(tree.ModTime) {
+				t.Errorf("got %s mod time %v, want %v", p, info.ModTime(), tree.ModTime)
+			}
+		}
+	})
+
+	t.Run("root", func(t *testing.T) {
+		paths := fstestutil.Tree{FilesPerDir: 2}.Paths()
+		if want := []string{"file000.txt", "file001.txt"}; !reflect.DeepEqual(paths, want) {
+			t.Errorf("got paths %v, want %v", paths, want)
+		}
+	})
+}
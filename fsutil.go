@@ -12,6 +12,15 @@ import (
 	"path/filepath"
 )
 
+var (
+	errNotDir = errors.New("not a directory")
+	errIsDir  = errors.New("is a directory")
+)
+
+// ErrNotSeekable is returned by Seek methods of files from filesystems in this
+// package if the underlying file does not implement io.Seeker.
+var ErrNotSeekable = errors.New("file not seekable")
+
 // FSFunc type is an adapter to allow the use of ordinary functions as
 // filesystems. If f is a function with the appropriate signature, FSFunc(f) is
 // a FS that calls f.
@@ -22,6 +31,368 @@ func (f FSFunc) Open(name string) (fs.File, error) {
 	return f(name)
 }
 
+// ReadDirFunc type is an adapter to allow the use of ordinary functions as
+// the ReadDir method of fs.ReadDirFS in ComposeFS.
+type ReadDirFunc func(name string) ([]fs.DirEntry, error)
+
+// ReadDir implements fs.ReadDirFS type.
+func (f ReadDirFunc) ReadDir(name string) ([]fs.DirEntry, error) {
+	return f(name)
+}
+
+// ReadFileFunc type is an adapter to allow the use of ordinary functions as
+// the ReadFile method of fs.ReadFileFS in ComposeFS.
+type ReadFileFunc func(name string) ([]byte, error)
+
+// ReadFile implements fs.ReadFileFS type.
+func (f ReadFileFunc) ReadFile(name string) ([]byte, error) {
+	return f(name)
+}
+
+// StatFunc type is an adapter to allow the use of ordinary functions as the
+// Stat method of fs.StatFS in ComposeFS.
+type StatFunc func(name string) (fs.FileInfo, error)
+
+// Stat implements fs.StatFS type.
+func (f StatFunc) Stat(name string) (fs.FileInfo, error) {
+	return f(name)
+}
+
+// GlobFunc type is an adapter to allow the use of ordinary functions as the
+// Glob method of fs.GlobFS in ComposeFS.
+type GlobFunc func(pattern string) ([]string, error)
+
+// Glob implements fs.GlobFS type.
+func (f GlobFunc) Glob(pattern string) ([]string, error) {
+	return f(pattern)
+}
+
+// ReadLinkFunc type is an adapter to allow the use of ordinary functions as
+// the ReadLink method of ReadLinkFS in ComposeFS.
+type ReadLinkFunc func(name string) (string, error)
+
+// ReadLink implements ReadLinkFS type.
+func (f ReadLinkFunc) ReadLink(name string) (string, error) {
+	return f(name)
+}
+
+// LstatFunc type is an adapter to allow the use of ordinary functions as the
+// Lstat method of ReadLinkFS in ComposeFS.
+type LstatFunc func(name string) (fs.FileInfo, error)
+
+// Lstat implements ReadLinkFS type.
+func (f LstatFunc) Lstat(name string) (fs.FileInfo, error) {
+	return f(name)
+}
+
+// ComposeFSFunc is one of ReadDirFunc, ReadFileFunc, StatFunc, GlobFunc,
+// ReadLinkFunc or LstatFunc types that can be passed to ComposeFS.
+type ComposeFSFunc interface {
+	composeFSFunc()
+}
+
+func (ReadDirFunc) composeFSFunc()  {}
+func (ReadFileFunc) composeFSFunc() {}
+func (StatFunc) composeFSFunc()     {}
+func (GlobFunc) composeFSFunc()     {}
+func (ReadLinkFunc) composeFSFunc() {}
+func (LstatFunc) composeFSFunc()    {}
+
+// ComposeFS constructs a filesystem with the open function that implements
+// exactly the fs.ReadDirFS, fs.ReadFileFS, fs.StatFS, fs.GlobFS and ReadLinkFS
+// interfaces for which functions are provided. ReadLinkFS requires both
+// ReadLinkFunc and LstatFunc. Unlike wrapping a filesystem with FSFunc
+// alone, which hides all of these interfaces, it allows a filesystem to be
+// modified while preserving the capabilities that its users, such as
+// http.FileServer, may depend on. Nil functions are ignored and if more than
+// one function of the same type is provided, the last one is used.
+func ComposeFS(open FSFunc, funcs ...ComposeFSFunc) fs.FS {
+	var (
+		readDir  ReadDirFunc
+		readFile ReadFileFunc
+		stat     StatFunc
+		glob     GlobFunc
+		readLink ReadLinkFunc
+		lstat    LstatFunc
+	)
+	for _, f := range funcs {
+		switch f := f.(type) {
+		case ReadDirFunc:
+			if f != nil {
+				readDir = f
+			}
+		case ReadFileFunc:
+			if f != nil {
+				readFile = f
+			}
+		case StatFunc:
+			if f != nil {
+				stat = f
+			}
+		case GlobFunc:
+			if f != nil {
+				glob = f
+			}
+		case ReadLinkFunc:
+			if f != nil {
+				readLink = f
+			}
+		case LstatFunc:
+			if f != nil {
+				lstat = f
+			}
+		}
+	}
+
+	const (
+		hasReadDir = 1 << iota
+		hasReadFile
+		hasStat
+		hasGlob
+		hasReadLink
+	)
+	var mask int
+	if readDir != nil {
+		mask |= hasReadDir
+	}
+	if readFile != nil {
+		mask |= hasReadFile
+	}
+	if stat != nil {
+		mask |= hasStat
+	}
+	if glob != nil {
+		mask |= hasGlob
+	}
+	if readLink != nil && lstat != nil {
+		mask |= hasReadLink
+	}
+
+	switch mask {
+	case hasReadDir:
+		return struct {
+			FSFunc
+			ReadDirFunc
+		}{open, readDir}
+	case hasReadFile:
+		return struct {
+			FSFunc
+			ReadFileFunc
+		}{open, readFile}
+	case hasReadDir | hasReadFile:
+		return struct {
+			FSFunc
+			ReadDirFunc
+			ReadFileFunc
+		}{open, readDir, readFile}
+	case hasStat:
+		return struct {
+			FSFunc
+			StatFunc
+		}{open, stat}
+	case hasReadDir | hasStat:
+		return struct {
+			FSFunc
+			ReadDirFunc
+			StatFunc
+		}{open, readDir, stat}
+	case hasReadFile | hasStat:
+		return struct {
+			FSFunc
+			ReadFileFunc
+			StatFunc
+		}{open, readFile, stat}
+	case hasReadDir | hasReadFile | hasStat:
+		return struct {
+			FSFunc
+			ReadDirFunc
+			ReadFileFunc
+			StatFunc
+		}{open, readDir, readFile, stat}
+	case hasGlob:
+		return struct {
+			FSFunc
+			GlobFunc
+		}{open, glob}
+	case hasReadDir | hasGlob:
+		return struct {
+			FSFunc
+			ReadDirFunc
+			GlobFunc
+		}{open, readDir, glob}
+	case hasReadFile | hasGlob:
+		return struct {
+			FSFunc
+			ReadFileFunc
+			GlobFunc
+		}{open, readFile, glob}
+	case hasReadDir | hasReadFile | hasGlob:
+		return struct {
+			FSFunc
+			ReadDirFunc
+			ReadFileFunc
+			GlobFunc
+		}{open, readDir, readFile, glob}
+	case hasStat | hasGlob:
+		return struct {
+			FSFunc
+			StatFunc
+			GlobFunc
+		}{open, stat, glob}
+	case hasReadDir | hasStat | hasGlob:
+		return struct {
+			FSFunc
+			ReadDirFunc
+			StatFunc
+			GlobFunc
+		}{open, readDir, stat, glob}
+	case hasReadFile | hasStat | hasGlob:
+		return struct {
+			FSFunc
+			ReadFileFunc
+			StatFunc
+			GlobFunc
+		}{open, readFile, stat, glob}
+	case hasReadDir | hasReadFile | hasStat | hasGlob:
+		return struct {
+			FSFunc
+			ReadDirFunc
+			ReadFileFunc
+			StatFunc
+			GlobFunc
+		}{open, readDir, readFile, stat, glob}
+	case hasReadLink:
+		return struct {
+			FSFunc
+			ReadLinkFunc
+			LstatFunc
+		}{open, readLink, lstat}
+	case hasReadDir | hasReadLink:
+		return struct {
+			FSFunc
+			ReadDirFunc
+			ReadLinkFunc
+			LstatFunc
+		}{open, readDir, readLink, lstat}
+	case hasReadFile | hasReadLink:
+		return struct {
+			FSFunc
+			ReadFileFunc
+			ReadLinkFunc
+			LstatFunc
+		}{open, readFile, readLink, lstat}
+	case hasReadDir | hasReadFile | hasReadLink:
+		return struct {
+			FSFunc
+			ReadDirFunc
+			ReadFileFunc
+			ReadLinkFunc
+			LstatFunc
+		}{open, readDir, readFile, readLink, lstat}
+	case hasStat | hasReadLink:
+		return struct {
+			FSFunc
+			StatFunc
+			ReadLinkFunc
+			LstatFunc
+		}{open, stat, readLink, lstat}
+	case hasReadDir | hasStat | hasReadLink:
+		return struct {
+			FSFunc
+			ReadDirFunc
+			StatFunc
+			ReadLinkFunc
+			LstatFunc
+		}{open, readDir, stat, readLink, lstat}
+	case hasReadFile | hasStat | hasReadLink:
+		return struct {
+			FSFunc
+			ReadFileFunc
+			StatFunc
+			ReadLinkFunc
+			LstatFunc
+		}{open, readFile, stat, readLink, lstat}
+	case hasReadDir | hasReadFile | hasStat | hasReadLink:
+		return struct {
+			FSFunc
+			ReadDirFunc
+			ReadFileFunc
+			StatFunc
+			ReadLinkFunc
+			LstatFunc
+		}{open, readDir, readFile, stat, readLink, lstat}
+	case hasGlob | hasReadLink:
+		return struct {
+			FSFunc
+			GlobFunc
+			ReadLinkFunc
+			LstatFunc
+		}{open, glob, readLink, lstat}
+	case hasReadDir | hasGlob | hasReadLink:
+		return struct {
+			FSFunc
+			ReadDirFunc
+			GlobFunc
+			ReadLinkFunc
+			LstatFunc
+		}{open, readDir, glob, readLink, lstat}
+	case hasReadFile | hasGlob | hasReadLink:
+		return struct {
+			FSFunc
+			ReadFileFunc
+			GlobFunc
+			ReadLinkFunc
+			LstatFunc
+		}{open, readFile, glob, readLink, lstat}
+	case hasReadDir | hasReadFile | hasGlob | hasReadLink:
+		return struct {
+			FSFunc
+			ReadDirFunc
+			ReadFileFunc
+			GlobFunc
+			ReadLinkFunc
+			LstatFunc
+		}{open, readDir, readFile, glob, readLink, lstat}
+	case hasStat | hasGlob | hasReadLink:
+		return struct {
+			FSFunc
+			StatFunc
+			GlobFunc
+			ReadLinkFunc
+			LstatFunc
+		}{open, stat, glob, readLink, lstat}
+	case hasReadDir | hasStat | hasGlob | hasReadLink:
+		return struct {
+			FSFunc
+			ReadDirFunc
+			StatFunc
+			GlobFunc
+			ReadLinkFunc
+			LstatFunc
+		}{open, readDir, stat, glob, readLink, lstat}
+	case hasReadFile | hasStat | hasGlob | hasReadLink:
+		return struct {
+			FSFunc
+			ReadFileFunc
+			StatFunc
+			GlobFunc
+			ReadLinkFunc
+			LstatFunc
+		}{open, readFile, stat, glob, readLink, lstat}
+	case hasReadDir | hasReadFile | hasStat | hasGlob | hasReadLink:
+		return struct {
+			FSFunc
+			ReadDirFunc
+			ReadFileFunc
+			StatFunc
+			GlobFunc
+			ReadLinkFunc
+			LstatFunc
+		}{open, readDir, readFile, stat, glob, readLink, lstat}
+	}
+	return open
+}
+
 // MustSub constructs a new filesystem as a sub-directory of an existing
 // filesystem. It panics if it fs.Sub returns an error.
 func MustSub(fsys fs.FS, dir string) fs.FS {
@@ -34,21 +405,16 @@ func MustSub(fsys fs.FS, dir string) fs.FS {
 
 // NoDirsFS constructs a new filesystems that does not return directories. his
 // filesystem can be used for http.FileServer in order to disable directory
-// listing and serving index.html as directories.
+// listing and serving index.html as directories. DirIndexHandler can be used
+// where directory listing is intended.
+//
+// The returned filesystem implements the same fs.StatFS, fs.ReadDirFS,
+// fs.ReadFileFS, fs.GlobFS and ReadLinkFS interfaces as the provided one.
+// Stat, Lstat and Glob omit directories as Open does, while ReadDir still lists directory entries,
+// so that files can be discovered, for example with fs.WalkDir.
 func NoDirsFS(fsys fs.FS) fs.FS {
-	return FSFunc(func(name string) (fs.File, error) {
-		f, err := fsys.Open(name)
-		if err != nil {
-			return nil, err
-		}
-		info, err := f.Stat()
-		if err != nil {
-			return nil, err
-		}
-		if info.IsDir() {
-			return nil, fs.ErrNotExist
-		}
-		return f, nil
+	return filterDirsFS(fsys, func(string) (bool, error) {
+		return false, nil
 	})
 }
 
@@ -56,26 +422,109 @@ func NoDirsFS(fsys fs.FS) fs.FS {
 // that have index.html file in them. This filesystem can be used for
 // http.FileServer in order to disable directory listing but still preserve
 // serving index.html as the content for the directory.
+//
+// The returned filesystem implements the same optional interfaces as the
+// provided one, with the same semantics as in NoDirsFS.
 func OnlyDirsWithIndexHTMLFS(fsys fs.FS) fs.FS {
-	return FSFunc(func(name string) (fs.File, error) {
+	return filterDirsFS(fsys, func(name string) (bool, error) {
+		s, err := fs.Stat(fsys, filepath.ToSlash(filepath.Join(name, "index.html")))
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return false, nil
+			}
+			return false, err
+		}
+		return !s.IsDir(), nil
+	})
+}
+
+// filterDirsFS returns a filesystem that returns fs.ErrNotExist for
+// directories for which the keep function returns false, preserving the
+// optional interfaces of the provided filesystem.
+func filterDirsFS(fsys fs.FS, keep func(dir string) (bool, error)) fs.FS {
+	// check returns fs.ErrNotExist if the directory should be omitted.
+	check := func(name string, info fs.FileInfo) error {
+		if !info.IsDir() {
+			return nil
+		}
+		ok, err := keep(name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fs.ErrNotExist
+		}
+		return nil
+	}
+
+	open := func(name string) (fs.File, error) {
 		f, err := fsys.Open(name)
 		if err != nil {
 			return nil, err
 		}
 		info, err := f.Stat()
 		if err != nil {
+			f.Close()
 			return nil, err
 		}
-		if info.IsDir() {
-			if s, err := fs.Stat(fsys, filepath.ToSlash(filepath.Join(name, "index.html"))); err != nil {
-				if errors.Is(err, fs.ErrNotExist) || s.IsDir() {
-					return nil, fs.ErrNotExist
+		if err := check(name, info); err != nil {
+			f.Close()
+			return nil, err
+		}
+		return f, nil
+	}
+
+	var funcs []ComposeFSFunc
+	if s, ok := fsys.(fs.StatFS); ok {
+		funcs = append(funcs, StatFunc(func(name string) (fs.FileInfo, error) {
+			info, err := s.Stat(name)
+			if err != nil {
+				return nil, err
+			}
+			if err := check(name, info); err != nil {
+				return nil, err
+			}
+			return info, nil
+		}))
+	}
+	if s, ok := fsys.(fs.ReadDirFS); ok {
+		funcs = append(funcs, ReadDirFunc(s.ReadDir))
+	}
+	if s, ok := fsys.(fs.ReadFileFS); ok {
+		funcs = append(funcs, ReadFileFunc(s.ReadFile))
+	}
+	if s, ok := fsys.(fs.GlobFS); ok {
+		funcs = append(funcs, GlobFunc(func(pattern string) ([]string, error) {
+			matches, err := s.Glob(pattern)
+			if err != nil {
+				return nil, err
+			}
+			var r []string
+			for _, m := range matches {
+				info, err := fs.Stat(fsys, m)
+				if err != nil {
+					continue
+				}
+				if check(m, info) == nil {
+					r = append(r, m)
 				}
+			}
+			return r, nil
+		}))
+	}
+	if s, ok := fsys.(ReadLinkFS); ok {
+		funcs = append(funcs, ReadLinkFunc(s.ReadLink), LstatFunc(func(name string) (fs.FileInfo, error) {
+			info, err := s.Lstat(name)
+			if err != nil {
 				return nil, err
 			}
-		}
-		return f, nil
-	})
+			if err := check(name, info); err != nil {
+				return nil, err
+			}
+			return info, nil
+		}))
+	}
+	return ComposeFS(open, funcs...)
 }
 
 // ReadFileFS constructs a filesystem with ReadFile method. Even though the
@@ -13,6 +13,7 @@ import (
 	"path"
 	"path/filepath"
 	"testing"
+	"testing/fstest"
 	"time"
 
 	"resenje.org/fsutil"
@@ -48,6 +49,83 @@ func TestFSFunc(t *testing.T) {
 	}
 }
 
+func TestComposeFS(t *testing.T) {
+	files := fsutil.MapFS{
+		"index.html":  {Data: []byte("<html>")},
+		"css/app.css": {Data: []byte("body{}")},
+	}
+
+	t.Run("open only", func(t *testing.T) {
+		fsys := fsutil.ComposeFS(files.Open)
+
+		if _, ok := fsys.(fs.ReadDirFS); ok {
+			t.Error("filesystem implements fs.ReadDirFS")
+		}
+		if _, ok := fsys.(fs.StatFS); ok {
+			t.Error("filesystem implements fs.StatFS")
+		}
+	})
+
+	t.Run("read dir and stat", func(t *testing.T) {
+		var readDirCalls, statCalls int
+		fsys := fsutil.ComposeFS(files.Open,
+			fsutil.ReadDirFunc(func(name string) ([]fs.DirEntry, error) {
+				readDirCalls++
+				return files.ReadDir(name)
+			}),
+			fsutil.StatFunc(func(name string) (fs.FileInfo, error) {
+				statCalls++
+				return files.Stat(name)
+			}),
+			fsutil.GlobFunc(nil),
+		)
+
+		if _, ok := fsys.(fs.ReadDirFS); !ok {
+			t.Error("filesystem does not implement fs.ReadDirFS")
+		}
+		if _, ok := fsys.(fs.StatFS); !ok {
+			t.Error("filesystem does not implement fs.StatFS")
+		}
+		if _, ok := fsys.(fs.ReadFileFS); ok {
+			t.Error("filesystem implements fs.ReadFileFS")
+		}
+		if _, ok := fsys.(fs.GlobFS); ok {
+			t.Error("filesystem implements fs.GlobFS")
+		}
+
+		if _, err := fs.ReadDir(fsys, "css"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fs.Stat(fsys, "index.html"); err != nil {
+			t.Fatal(err)
+		}
+		if readDirCalls != 1 || statCalls != 1 {
+			t.Errorf("got %v read dir and %v stat calls, want 1 and 1", readDirCalls, statCalls)
+		}
+	})
+
+	t.Run("all", func(t *testing.T) {
+		fsys := fsutil.ComposeFS(files.Open,
+			fsutil.ReadDirFunc(files.ReadDir),
+			fsutil.ReadFileFunc(files.ReadFile),
+			fsutil.StatFunc(files.Stat),
+			fsutil.GlobFunc(files.Glob),
+		)
+
+		if _, ok := fsys.(interface {
+			fs.ReadDirFS
+			fs.ReadFileFS
+			fs.StatFS
+			fs.GlobFS
+		}); !ok {
+			t.Error("filesystem does not implement all interfaces")
+		}
+		if err := fstest.TestFS(fsys, "index.html", "css/app.css"); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
 func init() {
 	fsys = newMockFS() // setup global filesystem
 	fsys.setFile("README.md", []byte("### fsutils\n\nFilesystem utility functions"), 0, false, nil, nil, nil)
@@ -110,6 +188,34 @@ func TestNoDirsFS(t *testing.T) {
 			t.Errorf("got error %v, want %v", err, errTest2)
 		}
 	})
+
+	t.Run("interfaces", func(t *testing.T) {
+		ndfs := fsutil.NoDirsFS(fsutil.MapFS{
+			"index.html":  {Data: []byte("<html>")},
+			"css/app.css": {Data: []byte("body{}")},
+		})
+
+		if _, ok := ndfs.(interface {
+			fs.ReadDirFS
+			fs.ReadFileFS
+			fs.StatFS
+			fs.GlobFS
+		}); !ok {
+			t.Fatal("filesystem does not implement all interfaces")
+		}
+		if _, err := fs.Stat(ndfs, "css"); err != fs.ErrNotExist {
+			t.Errorf("got stat error %v, want %v", err, fs.ErrNotExist)
+		}
+		testGlob(t, ndfs.(fs.GlobFS), "*", []string{"index.html"})
+
+		entries, err := fs.ReadDir(ndfs, "css")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 || entries[0].Name() != "app.css" {
+			t.Errorf("got entries %v, want [app.css]", entries)
+		}
+	})
 }
 
 func TestOnlyDirsWithIndexHTMLFS(t *testing.T) {
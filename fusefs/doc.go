@@ -0,0 +1,12 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package fusefs mounts any fs.FS as a read-only FUSE filesystem, so that a
+// composition of filesystem wrappers can be browsed with regular shell tools,
+// for example to inspect hashed paths or filtered files while debugging.
+//
+// The package is supported on Linux, macOS and FreeBSD, and it requires a
+// FUSE implementation to be installed on the system.
+package fusefs
@@ -0,0 +1,252 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package fusefs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sync"
+	"syscall"
+
+	"bazil.org/fuse"
+	bazilfs "bazil.org/fuse/fs"
+)
+
+var (
+	_ bazilfs.FS                 = (*FS)(nil)
+	_ bazilfs.Node               = (*node)(nil)
+	_ bazilfs.NodeStringLookuper = (*node)(nil)
+	_ bazilfs.NodeOpener         = (*node)(nil)
+	_ bazilfs.HandleReadDirAller = (*node)(nil)
+	_ bazilfs.HandleReader       = (*handle)(nil)
+	_ bazilfs.HandleReleaser     = (*handle)(nil)
+)
+
+// FS serves files of an fs.FS with the bazil.org/fuse/fs package. Attributes
+// are not cached by the kernel, so that changes of the underlying filesystem
+// are visible immediately. Write permissions are removed from all files.
+type FS struct {
+	fsys fs.FS
+
+	nodes   map[string]*node
+	nodesMu sync.Mutex
+}
+
+// New returns a new FS that serves files of the fsys.
+func New(fsys fs.FS) *FS {
+	return &FS{
+		fsys:  fsys,
+		nodes: make(map[string]*node),
+	}
+}
+
+// Mount mounts the fsys read-only at the mountpoint directory and serves it
+// until the filesystem is unmounted, for example with the fusermount -u
+// command, or until the context is done, when it is unmounted by this
+// function.
+func Mount(ctx context.Context, fsys fs.FS, mountpoint string) error {
+	c, err := fuse.Mount(mountpoint,
+		fuse.ReadOnly(),
+		fuse.FSName("fsutil"),
+		fuse.Subtype("fsutil"),
+	)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	served := make(chan error, 1)
+	go func() {
+		served <- bazilfs.Serve(c, New(fsys))
+	}()
+
+	select {
+	case err = <-served:
+	case <-ctx.Done():
+		if err := fuse.Unmount(mountpoint); err != nil {
+			return err
+		}
+		err = <-served
+	}
+	if err != nil {
+		return err
+	}
+	<-c.Ready
+	return c.MountError
+}
+
+// Root implements bazil.org/fuse/fs.FS interface.
+func (s *FS) Root() (bazilfs.Node, error) {
+	return s.node("."), nil
+}
+
+// node returns the same node for the same name, as required by the
+// bazil.org/fuse/fs package to avoid spurious cache invalidations.
+func (s *FS) node(name string) *node {
+	s.nodesMu.Lock()
+	defer s.nodesMu.Unlock()
+
+	n, ok := s.nodes[name]
+	if !ok {
+		n = &node{fs: s, name: name}
+		s.nodes[name] = n
+	}
+	return n
+}
+
+// node is a file or a directory in FS. Directories are their own handles.
+type node struct {
+	fs   *FS
+	name string
+}
+
+func (n *node) Attr(ctx context.Context, a *fuse.Attr) error {
+	info, err := fs.Stat(n.fs.fsys, n.name)
+	if err != nil {
+		return errno(err)
+	}
+	a.Valid = 0
+	a.Mode = info.Mode() &^ 0o222
+	a.Size = uint64(info.Size())
+	a.Mtime = info.ModTime()
+	a.Ctime = info.ModTime()
+	return nil
+}
+
+func (n *node) Lookup(ctx context.Context, name string) (bazilfs.Node, error) {
+	p := path.Join(n.name, name)
+	if !fs.ValidPath(p) {
+		return nil, syscall.ENOENT
+	}
+	if _, err := fs.Stat(n.fs.fsys, p); err != nil {
+		return nil, errno(err)
+	}
+	return n.fs.node(p), nil
+}
+
+func (n *node) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (bazilfs.Handle, error) {
+	if !req.Flags.IsReadOnly() {
+		return nil, syscall.EROFS
+	}
+	if req.Dir {
+		return n, nil
+	}
+	f, err := n.fs.fsys.Open(n.name)
+	if err != nil {
+		return nil, errno(err)
+	}
+	return &handle{file: f}, nil
+}
+
+func (n *node) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	entries, err := fs.ReadDir(n.fs.fsys, n.name)
+	if err != nil {
+		return nil, errno(err)
+	}
+	dirents := make([]fuse.Dirent, 0, len(entries))
+	for _, e := range entries {
+		dirents = append(dirents, fuse.Dirent{
+			Name: e.Name(),
+			Type: direntType(e.Type()),
+		})
+	}
+	return dirents, nil
+}
+
+// handle is an opened file. Reads at offsets use io.ReaderAt or io.Seeker
+// if the file implements them, otherwise the whole file is read into memory
+// on the first read.
+type handle struct {
+	file fs.File
+	data []byte
+	mu   sync.Mutex
+}
+
+func (h *handle) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	buf := make([]byte, req.Size)
+	n, err := h.readAt(buf, req.Offset)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return errno(err)
+	}
+	resp.Data = buf[:n]
+	return nil
+}
+
+func (h *handle) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
+	return h.file.Close()
+}
+
+func (h *handle) readAt(p []byte, off int64) (int, error) {
+	if r, ok := h.file.(io.ReaderAt); ok {
+		n, err := r.ReadAt(p, off)
+		if err != nil && n == 0 {
+			// Some implementations, such as fstest.MapFS, return an error
+			// for offsets beyond the end of the file instead of io.EOF.
+			if info, serr := h.file.Stat(); serr == nil && off >= info.Size() {
+				return 0, io.EOF
+			}
+		}
+		return n, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if s, ok := h.file.(io.Seeker); ok {
+		if _, err := s.Seek(off, io.SeekStart); err != nil {
+			return 0, err
+		}
+		n, err := io.ReadFull(h.file, p)
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			err = io.EOF
+		}
+		return n, err
+	}
+
+	if h.data == nil {
+		data, err := io.ReadAll(h.file)
+		if err != nil {
+			return 0, err
+		}
+		h.data = data
+	}
+	if off >= int64(len(h.data)) {
+		return 0, io.EOF
+	}
+	return copy(p, h.data[off:]), nil
+}
+
+// errno converts errors of the fs package to errno values that are returned
+// to the kernel.
+func errno(err error) error {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return syscall.ENOENT
+	case errors.Is(err, fs.ErrPermission):
+		return syscall.EACCES
+	case errors.Is(err, fs.ErrInvalid):
+		return syscall.EINVAL
+	}
+	return syscall.EIO
+}
+
+func direntType(mode fs.FileMode) fuse.DirentType {
+	switch {
+	case mode.IsDir():
+		return fuse.DT_Dir
+	case mode.IsRegular():
+		return fuse.DT_File
+	case mode&fs.ModeSymlink != 0:
+		return fuse.DT_Link
+	}
+	return fuse.DT_Unknown
+}
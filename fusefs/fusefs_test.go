@@ -0,0 +1,134 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package fusefs_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+	"testing/fstest"
+
+	"bazil.org/fuse"
+	bazilfs "bazil.org/fuse/fs"
+
+	"resenje.org/fsutil"
+	"resenje.org/fsutil/fusefs"
+)
+
+func TestFS(t *testing.T) {
+	ctx := context.Background()
+	files := fstest.MapFS{
+		"index.html":     {Data: []byte("<html>"), Mode: 0o644},
+		"css/app.css":    {Data: []byte("body{}")},
+		"css/secret.css": {Data: []byte("secret")},
+	}
+	fsys := fusefs.New(fsutil.NewScopedFS(files, func(context.Context) func(name string) bool {
+		return func(name string) bool {
+			return name != "css/secret.css"
+		}
+	}))
+
+	root, err := fsys.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("root", func(t *testing.T) {
+		var a fuse.Attr
+		if err := root.Attr(ctx, &a); err != nil {
+			t.Fatal(err)
+		}
+		if !a.Mode.IsDir() {
+			t.Errorf("got mode %v, want directory", a.Mode)
+		}
+
+		dirents, err := root.(bazilfs.HandleReadDirAller).ReadDirAll(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := fmt.Sprint(dirents), "[{0 dir css} {0 file index.html}]"; got != want {
+			t.Errorf("got dirents %v, want %v", got, want)
+		}
+	})
+
+	t.Run("lookup", func(t *testing.T) {
+		n1, err := lookup(ctx, root, "index.html")
+		if err != nil {
+			t.Fatal(err)
+		}
+		n2, err := lookup(ctx, root, "index.html")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n1 != n2 {
+			t.Error("got different nodes for the same file")
+		}
+
+		var a fuse.Attr
+		if err := n1.Attr(ctx, &a); err != nil {
+			t.Fatal(err)
+		}
+		if a.Mode != 0o444 || a.Size != 6 {
+			t.Errorf("got mode %v, size %v", a.Mode, a.Size)
+		}
+
+		css, err := lookup(ctx, root, "css")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := lookup(ctx, css, "secret.css"); !errors.Is(err, syscall.ENOENT) {
+			t.Errorf("got error %v, want %v", err, syscall.ENOENT)
+		}
+	})
+
+	t.Run("read", func(t *testing.T) {
+		css, err := lookup(ctx, root, "css")
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := lookup(ctx, css, "app.css")
+		if err != nil {
+			t.Fatal(err)
+		}
+		h, err := n.(bazilfs.NodeOpener).Open(ctx, &fuse.OpenRequest{Flags: fuse.OpenReadOnly}, &fuse.OpenResponse{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer h.(bazilfs.HandleReleaser).Release(ctx, &fuse.ReleaseRequest{})
+
+		for _, tc := range []struct {
+			offset int64
+			size   int
+			want   string
+		}{
+			{offset: 0, size: 4, want: "body"},
+			{offset: 4, size: 10, want: "{}"},
+			{offset: 10, size: 10, want: ""},
+		} {
+			var resp fuse.ReadResponse
+			if err := h.(bazilfs.HandleReader).Read(ctx, &fuse.ReadRequest{Offset: tc.offset, Size: tc.size}, &resp); err != nil {
+				t.Fatal(err)
+			}
+			if string(resp.Data) != tc.want {
+				t.Errorf("got %q at offset %v, want %q", resp.Data, tc.offset, tc.want)
+			}
+		}
+
+		_, err = n.(bazilfs.NodeOpener).Open(ctx, &fuse.OpenRequest{Flags: fuse.OpenReadWrite}, &fuse.OpenResponse{})
+		if !errors.Is(err, syscall.EROFS) {
+			t.Errorf("got error %v, want %v", err, syscall.EROFS)
+		}
+	})
+}
+
+func lookup(ctx context.Context, n bazilfs.Node, name string) (bazilfs.Node, error) {
+	return n.(bazilfs.NodeStringLookuper).Lookup(ctx, name)
+}
@@ -0,0 +1,10 @@
+module resenje.org/fsutil/fusefs
+
+go 1.16
+
+require (
+	bazil.org/fuse v0.0.0-20200117225306-7b5117fecadc
+	resenje.org/fsutil v0.0.0-00010101000000-000000000000
+)
+
+replace resenje.org/fsutil => ../
@@ -0,0 +1,329 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package gitfs provides a read-only filesystem over a tree of a git
+// repository commit, so that files of a previous version can be served, for
+// example combined with the current files by fsutil.UnionFS, without checking
+// them out to disk.
+package gitfs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+var (
+	_ fs.FS         = (*FS)(nil)
+	_ fs.ReadDirFS  = (*FS)(nil)
+	_ fs.ReadFileFS = (*FS)(nil)
+	_ fs.StatFS     = (*FS)(nil)
+)
+
+var errIsDir = errors.New("is a directory")
+
+// FS is a read-only filesystem with files of a git tree. All files have the
+// same modification time, which is the commit time for trees of commits. The
+// content of an opened file is read into memory, so that the file implements
+// io.Seeker. Submodules are omitted.
+type FS struct {
+	tree    *object.Tree
+	modTime time.Time
+
+	// mu serializes access to the tree, as go-git objects and storages are
+	// not safe for concurrent use.
+	mu sync.Mutex
+}
+
+// New returns a new FS with files of the commit that the revision, such as a
+// branch or a tag name, or a commit hash, resolves to in the repository.
+func New(repo *git.Repository, revision string) (*FS, error) {
+	hash, err := repo.ResolveRevision(plumbing.Revision(revision))
+	if err != nil {
+		return nil, fmt.Errorf("resolve revision %s: %w", revision, err)
+	}
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		return nil, fmt.Errorf("commit %s: %w", hash, err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("tree of commit %s: %w", hash, err)
+	}
+	return NewTree(tree, commit.Committer.When), nil
+}
+
+// NewTree returns a new FS with files of the tree that have the modTime
+// modification time.
+func NewTree(tree *object.Tree, modTime time.Time) *FS {
+	return &FS{
+		tree:    tree,
+		modTime: modTime,
+	}
+}
+
+// Open implements fs.FS interface.
+func (s *FS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tree, f, err := s.lookup(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if tree != nil {
+		entries, err := s.entries(tree)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		return &dir{info: s.dirInfo(name), entries: entries}, nil
+	}
+	data, err := readBlob(f)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &file{Reader: bytes.NewReader(data), info: s.fileInfo(name, f)}, nil
+}
+
+// ReadDir implements fs.ReadDirFS interface.
+func (s *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tree, _, err := s.lookup(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	if tree == nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	entries, err := s.entries(tree)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	return entries, nil
+}
+
+// ReadFile implements fs.ReadFileFS interface.
+func (s *FS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tree, f, err := s.lookup(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: err}
+	}
+	if tree != nil {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: errIsDir}
+	}
+	data, err := readBlob(f)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: err}
+	}
+	return data, nil
+}
+
+// Stat implements fs.StatFS interface.
+func (s *FS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tree, f, err := s.lookup(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	if tree != nil {
+		return s.dirInfo(name), nil
+	}
+	return s.fileInfo(name, f), nil
+}
+
+// lookup returns either the tree of the named directory or the named file. It
+// must be called with the mutex locked.
+func (s *FS) lookup(name string) (*object.Tree, *object.File, error) {
+	if name == "." {
+		return s.tree, nil, nil
+	}
+	e, err := s.tree.FindEntry(name)
+	if err != nil {
+		return nil, nil, notExist(err)
+	}
+	switch e.Mode {
+	case filemode.Dir:
+		tree, err := s.tree.Tree(name)
+		if err != nil {
+			return nil, nil, notExist(err)
+		}
+		return tree, nil, nil
+	case filemode.Submodule:
+		return nil, nil, fs.ErrNotExist
+	}
+	f, err := s.tree.TreeEntryFile(e)
+	if err != nil {
+		return nil, nil, notExist(err)
+	}
+	return nil, f, nil
+}
+
+// entries returns sorted entries of the tree. It must be called with the
+// mutex locked.
+func (s *FS) entries(tree *object.Tree) ([]fs.DirEntry, error) {
+	entries := make([]fs.DirEntry, 0, len(tree.Entries))
+	for i := range tree.Entries {
+		e := &tree.Entries[i]
+		switch e.Mode {
+		case filemode.Dir:
+			entries = append(entries, s.dirInfo(e.Name))
+		case filemode.Submodule:
+		default:
+			f, err := tree.TreeEntryFile(e)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, s.fileInfo(e.Name, f))
+		}
+	}
+	// Git sorts directories as if their names end with a slash.
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+func (s *FS) fileInfo(name string, f *object.File) *fileInfo {
+	mode := fs.FileMode(0o444)
+	switch f.Mode {
+	case filemode.Executable:
+		mode = 0o555
+	case filemode.Symlink:
+		mode = fs.ModeSymlink | 0o777
+	}
+	return &fileInfo{
+		name:    path.Base(name),
+		size:    f.Size,
+		mode:    mode,
+		modTime: s.modTime,
+	}
+}
+
+func (s *FS) dirInfo(name string) *fileInfo {
+	return &fileInfo{
+		name:    path.Base(name),
+		mode:    fs.ModeDir | 0o555,
+		modTime: s.modTime,
+	}
+}
+
+// readBlob returns the content of the file. It must be called with the mutex
+// locked.
+func readBlob(f *object.File) ([]byte, error) {
+	r, err := f.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+// notExist returns fs.ErrNotExist for go-git errors about missing objects.
+func notExist(err error) error {
+	switch {
+	case errors.Is(err, object.ErrEntryNotFound),
+		errors.Is(err, object.ErrDirectoryNotFound),
+		errors.Is(err, object.ErrFileNotFound),
+		errors.Is(err, plumbing.ErrObjectNotFound):
+		return fs.ErrNotExist
+	}
+	return err
+}
+
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (i *fileInfo) Name() string               { return i.name }
+func (i *fileInfo) Size() int64                { return i.size }
+func (i *fileInfo) Mode() fs.FileMode          { return i.mode }
+func (i *fileInfo) ModTime() time.Time         { return i.modTime }
+func (i *fileInfo) IsDir() bool                { return i.mode.IsDir() }
+func (i *fileInfo) Sys() interface{}           { return nil }
+func (i *fileInfo) Type() fs.FileMode          { return i.mode.Type() }
+func (i *fileInfo) Info() (fs.FileInfo, error) { return i, nil }
+
+type file struct {
+	*bytes.Reader
+	info *fileInfo
+}
+
+func (f *file) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *file) Close() error {
+	return nil
+}
+
+type dir struct {
+	info    *fileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: errIsDir}
+}
+
+func (d *dir) Close() error {
+	return nil
+}
+
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	entries := d.entries[d.offset:]
+	if n > 0 {
+		if len(entries) == 0 {
+			return nil, io.EOF
+		}
+		if n < len(entries) {
+			entries = entries[:n]
+		}
+	}
+	d.offset += len(entries)
+	return entries, nil
+}
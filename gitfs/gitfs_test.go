@@ -0,0 +1,141 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gitfs_test
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+
+	"resenje.org/fsutil"
+	"resenje.org/fsutil/gitfs"
+)
+
+func TestFS(t *testing.T) {
+	wtfs := memfs.New()
+	repo, err := git.Init(memory.NewStorage(), wtfs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t1 := time.Date(2021, 5, 1, 10, 0, 0, 0, time.UTC)
+	commit(t, repo, wtfs, t1, map[string]string{
+		"index.html":         "<html>v1",
+		"css/main.css":       "body{color:red}",
+		"css/vendor/lib.css": "lib{}",
+	})
+	if _, err := repo.CreateTag("v1", mustHead(t, repo), nil); err != nil {
+		t.Fatal(err)
+	}
+	t2 := t1.Add(time.Hour)
+	commit(t, repo, wtfs, t2, map[string]string{
+		"index.html": "<html>v2",
+		"js/app.js":  "app()",
+	})
+
+	v1, err := gitfs.New(repo, "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(v1, "index.html", "css/main.css", "css/vendor/lib.css"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := v1.ReadFile("index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "<html>v1" {
+		t.Errorf("got %q, want %q", data, "<html>v1")
+	}
+	if _, err := v1.Stat("js/app.js"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got error %v, want %v", err, fs.ErrNotExist)
+	}
+	if _, err := v1.Open("index.html/x"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got error %v, want %v", err, fs.ErrNotExist)
+	}
+	if _, err := v1.ReadFile("css"); err == nil {
+		t.Error("got no error reading a directory")
+	}
+
+	info, err := v1.Stat("css/main.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 15 || !info.ModTime().Equal(t1) || info.Mode() != 0o444 {
+		t.Errorf("got size %v, mod time %v, mode %v", info.Size(), info.ModTime(), info.Mode())
+	}
+
+	head, err := gitfs.New(repo, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(head, "index.html", "css/main.css", "js/app.js"); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("union", func(t *testing.T) {
+		fsys := fsutil.NewUnionFS(head, v1)
+		data, err := fs.ReadFile(fsys, "index.html")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "<html>v2" {
+			t.Errorf("got %q, want %q", data, "<html>v2")
+		}
+	})
+
+	if _, err := gitfs.New(repo, "v3"); err == nil {
+		t.Error("got no error for unknown revision")
+	}
+}
+
+func commit(t *testing.T, repo *git.Repository, wtfs billy.Filesystem, when time.Time, files map[string]string) {
+	t.Helper()
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		f, err := wtfs.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := wt.Add(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sig := &object.Signature{Name: "Test", Email: "test@example.com", When: when}
+	if _, err := wt.Commit("commit", &git.CommitOptions{Author: sig, Committer: sig}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustHead(t *testing.T, repo *git.Repository) plumbing.Hash {
+	t.Helper()
+
+	ref, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ref.Hash()
+}
@@ -0,0 +1,11 @@
+module resenje.org/fsutil/gitfs
+
+go 1.16
+
+require (
+	github.com/go-git/go-billy/v5 v5.4.1
+	github.com/go-git/go-git/v5 v5.8.1
+	resenje.org/fsutil v0.0.0-00010101000000-000000000000
+)
+
+replace resenje.org/fsutil => ../
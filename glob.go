@@ -0,0 +1,331 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// GlobAll returns the names of all files matching pattern or nil if there is no
+// matching file. In addition to the path.Match syntax, the pattern may contain
+// "**" path elements that match zero or more directories and brace expansion
+// with comma separated alternatives, for example "assets/**/*.{css,js}".
+//
+// As fs.Glob, GlobAll ignores file system errors such as I/O errors reading
+// directories. The only possible returned error is path.ErrBadPattern.
+//
+// GlobAll works with any filesystem, including HashFS and BackupFS, as it
+// relies only on their ReadDir and Glob methods.
+func GlobAll(fsys fs.FS, pattern string) (matches []string, err error) {
+	patterns, err := expandBraces(pattern)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range patterns {
+		m, err := globDoublestar(fsys, p)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, m...)
+	}
+	if len(patterns) > 1 {
+		sort.Strings(matches)
+		matches = uniqueStrings(matches)
+	}
+	return matches, nil
+}
+
+// MatchAll reports whether name matches the pattern with the same syntax as
+// GlobAll.
+func MatchAll(pattern, name string) (matched bool, err error) {
+	patterns, err := expandBraces(pattern)
+	if err != nil {
+		return false, err
+	}
+	for _, p := range patterns {
+		ok, err := matchSegments(strings.Split(p, "/"), strings.Split(name, "/"))
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func globDoublestar(fsys fs.FS, pattern string) (matches []string, err error) {
+	segments := strings.Split(pattern, "/")
+	for _, s := range segments {
+		if s == "**" {
+			continue
+		}
+		if _, err := path.Match(s, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	var hasDoublestar bool
+	for _, s := range segments {
+		if s == "**" {
+			hasDoublestar = true
+			break
+		}
+	}
+	if !hasDoublestar {
+		return fs.Glob(fsys, pattern)
+	}
+
+	// Walk only the directory before the first path element with special
+	// characters.
+	var static []string
+	for _, s := range segments {
+		if s == "**" || hasMeta(s) {
+			break
+		}
+		static = append(static, s)
+	}
+	root := "."
+	if len(static) > 0 {
+		root = strings.Join(static, "/")
+	}
+
+	_ = fs.WalkDir(fsys, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if d != nil && d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if p == "." {
+			return nil
+		}
+		if ok, _ := matchSegments(segments, strings.Split(p, "/")); ok {
+			matches = append(matches, p)
+		}
+		return nil
+	})
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// matchSegments matches path elements of a name against pattern elements,
+// where "**" matches zero or more elements.
+func matchSegments(pattern, name []string) (bool, error) {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for len(pattern) > 0 && pattern[0] == "**" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true, nil
+			}
+			for i := 0; i <= len(name); i++ {
+				ok, err := matchSegments(pattern, name[i:])
+				if err != nil || ok {
+					return ok, err
+				}
+			}
+			return false, nil
+		}
+		if len(name) == 0 {
+			return false, nil
+		}
+		ok, err := path.Match(pattern[0], name[0])
+		if err != nil || !ok {
+			return false, err
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0, nil
+}
+
+// expandBraces returns all patterns constructed by replacing brace
+// expressions with their comma separated alternatives.
+func expandBraces(pattern string) ([]string, error) {
+	start := -1
+	depth := 0
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '{':
+			if depth == 0 {
+				start = i
+			}
+			depth++
+		case '}':
+			if depth == 0 {
+				return nil, path.ErrBadPattern
+			}
+			depth--
+			if depth > 0 {
+				continue
+			}
+			var patterns []string
+			for _, alt := range splitAlternatives(pattern[start+1 : i]) {
+				p, err := expandBraces(pattern[:start] + alt + pattern[i+1:])
+				if err != nil {
+					return nil, err
+				}
+				patterns = append(patterns, p...)
+			}
+			return patterns, nil
+		}
+	}
+	if depth != 0 {
+		return nil, path.ErrBadPattern
+	}
+	return []string{pattern}, nil
+}
+
+// splitAlternatives splits the content of a brace expression by commas that
+// are not in nested brace expressions.
+func splitAlternatives(s string) (alts []string) {
+	depth := 0
+	last := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				alts = append(alts, s[last:i])
+				last = i + 1
+			}
+		}
+	}
+	return append(alts, s[last:])
+}
+
+// GlobConcurrent returns the names of all files matching pattern or nil if
+// there is no matching file, as fs.Glob does, but it reads directories that
+// match the directory part of the pattern from a number of concurrent workers.
+// It is faster than fs.Glob for patterns with wildcards in directory names,
+// like "*/*/*.css", on large trees. Matches are returned in the same order as
+// fs.Glob returns them. If the filesystem implements fs.GlobFS, its Glob method
+// is used.
+//
+// As fs.Glob, GlobConcurrent ignores file system errors such as I/O errors
+// reading directories. The only possible returned error is path.ErrBadPattern.
+func GlobConcurrent(fsys fs.FS, pattern string, workers int) (matches []string, err error) {
+	if fsys, ok := fsys.(fs.GlobFS); ok {
+		return fsys.Glob(pattern)
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	return globConcurrent(fsys, pattern, workers, 0)
+}
+
+func globConcurrent(fsys fs.FS, pattern string, workers, depth int) (matches []string, err error) {
+	// Limit the recursion as fs.Glob does.
+	if depth > 10000 {
+		return nil, path.ErrBadPattern
+	}
+
+	// Check pattern is well-formed.
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	if !hasMeta(pattern) {
+		if _, err = fs.Stat(fsys, pattern); err != nil {
+			return nil, nil
+		}
+		return []string{pattern}, nil
+	}
+
+	dir, file := path.Split(pattern)
+	dir = cleanGlobPath(dir)
+
+	if !hasMeta(dir) {
+		return globDir(fsys, dir, file, nil)
+	}
+
+	// Prevent infinite recursion.
+	if dir == pattern {
+		return nil, path.ErrBadPattern
+	}
+
+	dirs, err := globConcurrent(fsys, dir, workers, depth+1)
+	if err != nil {
+		return nil, err
+	}
+	if len(dirs) < workers {
+		workers = len(dirs)
+	}
+
+	results := make([][]string, len(dirs))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				// The pattern is already validated, so globDir can not
+				// return an error.
+				results[i], _ = globDir(fsys, dirs[i], file, nil)
+			}
+		}()
+	}
+	for i := range dirs {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	for _, r := range results {
+		matches = append(matches, r...)
+	}
+	return matches, nil
+}
+
+// cleanGlobPath prepares path for glob matching.
+func cleanGlobPath(path string) string {
+	switch path {
+	case "":
+		return "."
+	default:
+		return path[0 : len(path)-1] // chop off trailing separator
+	}
+}
+
+// globDir searches for paths matching pattern in the directory dir and
+// appends them to matches, ignoring errors reading the directory.
+func globDir(fsys fs.FS, dir, pattern string, matches []string) (m []string, e error) {
+	m = matches
+	infos, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return // ignore I/O error
+	}
+
+	for _, info := range infos {
+		n := info.Name()
+		matched, err := path.Match(pattern, n)
+		if err != nil {
+			return m, err
+		}
+		if matched {
+			m = append(m, path.Join(dir, n))
+		}
+	}
+	return
+}
+
+// hasMeta reports whether the path contains any of the magic characters
+// recognized by path.Match.
+func hasMeta(path string) bool {
+	return strings.ContainsAny(path, `*?[\`)
+}
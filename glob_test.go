@@ -0,0 +1,240 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestGlobAll(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":                {},
+		"assets/main.css":           {},
+		"assets/main.js":            {},
+		"assets/css/theme.css":      {},
+		"assets/css/dark/theme.css": {},
+		"assets/img/logo.png":       {},
+		"docs/readme.md":            {},
+	}
+
+	for _, tc := range []struct {
+		pattern string
+		want    []string
+	}{
+		{
+			pattern: "assets/*.css",
+			want:    []string{"assets/main.css"},
+		},
+		{
+			pattern: "assets/**/*.css",
+			want:    []string{"assets/css/dark/theme.css", "assets/css/theme.css", "assets/main.css"},
+		},
+		{
+			pattern: "**/*.css",
+			want:    []string{"assets/css/dark/theme.css", "assets/css/theme.css", "assets/main.css"},
+		},
+		{
+			pattern: "assets/**/*.{css,js}",
+			want:    []string{"assets/css/dark/theme.css", "assets/css/theme.css", "assets/main.css", "assets/main.js"},
+		},
+		{
+			pattern: "{assets/img,docs}/*",
+			want:    []string{"assets/img/logo.png", "docs/readme.md"},
+		},
+		{
+			pattern: "assets/**/dark/*",
+			want:    []string{"assets/css/dark/theme.css"},
+		},
+		{
+			pattern: "missing/**/*.css",
+			want:    nil,
+		},
+	} {
+		t.Run(tc.pattern, func(t *testing.T) {
+			got, err := fsutil.GlobAll(fsys, tc.pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestGlobAll_hashFS(t *testing.T) {
+	fsys := fsutil.NewHashFS(assetsHashFS, fsutil.NewMD5Hasher(6))
+
+	got, err := fsutil.GlobAll(fsys, "**/main.{css,*.css}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"assets/main.012345.847f70.css",
+		"assets/main.45b416.css",
+		"assets/main.8559e1.css",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestGlobAll_badPattern(t *testing.T) {
+	for _, pattern := range []string{
+		"assets/{css,js",
+		"assets/css}",
+		"assets/**/[",
+	} {
+		if _, err := fsutil.GlobAll(fstest.MapFS{}, pattern); !errors.Is(err, path.ErrBadPattern) {
+			t.Errorf("got error %v for pattern %q, want %v", err, pattern, path.ErrBadPattern)
+		}
+	}
+}
+
+func TestMatchAll(t *testing.T) {
+	for _, tc := range []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{pattern: "assets/**/*.css", name: "assets/main.css", want: true},
+		{pattern: "assets/**/*.css", name: "assets/css/dark/theme.css", want: true},
+		{pattern: "assets/**/*.css", name: "assets/main.js", want: false},
+		{pattern: "**", name: "assets/main.js", want: true},
+		{pattern: "*.{html,md}", name: "index.html", want: true},
+		{pattern: "*.{html,md}", name: "docs/readme.md", want: false},
+	} {
+		got, err := fsutil.MatchAll(tc.pattern, tc.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("got match %v for pattern %q and name %q, want %v", got, tc.pattern, tc.name, tc.want)
+		}
+	}
+}
+
+func TestGlobConcurrent(t *testing.T) {
+	files := fstest.MapFS{
+		"index.html":                {},
+		"assets/main.css":           {},
+		"assets/main.js":            {},
+		"assets/css/theme.css":      {},
+		"assets/css/dark/theme.css": {},
+		"assets/img/logo.png":       {},
+		"docs/readme.md":            {},
+		"docs/css/print.css":        {},
+	}
+	// Hide the Glob method of fstest.MapFS.
+	fsys := fsutil.FSFunc(files.Open)
+
+	for _, pattern := range []string{
+		"*",
+		"index.html",
+		"missing.html",
+		"assets/*.css",
+		"*/*.css",
+		"*/*/*.css",
+		"*/*/*/*",
+		"[ad]*/c?s/*",
+		"missing/*/*",
+	} {
+		for _, workers := range []int{0, 1, 3, 16} {
+			t.Run(fmt.Sprintf("%s %v", pattern, workers), func(t *testing.T) {
+				want, err := fs.Glob(fsys, pattern)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := fsutil.GlobConcurrent(fsys, pattern, workers)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if fmt.Sprint(got) != fmt.Sprint(want) {
+					t.Errorf("got %v, want %v", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestGlobConcurrent_badPattern(t *testing.T) {
+	for _, pattern := range []string{
+		"[",
+		"*/[",
+		"[/*",
+	} {
+		if _, err := fsutil.GlobConcurrent(fsutil.FSFunc(fstest.MapFS{}.Open), pattern, 4); !errors.Is(err, path.ErrBadPattern) {
+			t.Errorf("got error %v for pattern %q, want %v", err, pattern, path.ErrBadPattern)
+		}
+	}
+}
+
+func TestGlobConcurrent_workersOptions(t *testing.T) {
+	files := fstest.MapFS{
+		"a/main.css": {Data: []byte("body {}")},
+		"b/main.css": {Data: []byte("body {}")},
+		"b/main.js":  {Data: []byte("main()")},
+	}
+
+	hashFS := fsutil.NewHashFS(fsutil.FSFunc(files.Open), fsutil.NewMD5Hasher(6), fsutil.WithHashGlobWorkers(4))
+	testGlob(t, hashFS, "*/*.css", []string{"a/main.fcdce6.css", "b/main.fcdce6.css"})
+
+	backupFS, err := fsutil.NewBackupFS(files, t.TempDir(), time.Hour, fsutil.WithBackupGlobWorkers(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testGlob(t, backupFS, "*/*.css", []string{"a/main.css", "b/main.css"})
+}
+
+func BenchmarkGlob(b *testing.B) {
+	dir := b.TempDir()
+	// 100k files in 1000 directories.
+	for i := 0; i < 1000; i++ {
+		d := filepath.Join(dir, "dir"+strconv.Itoa(i))
+		if err := os.Mkdir(d, 0o777); err != nil {
+			b.Fatal(err)
+		}
+		for j := 0; j < 100; j++ {
+			name := "file" + strconv.Itoa(j) + ".txt"
+			if j%10 == 0 {
+				name = "file" + strconv.Itoa(j) + ".css"
+			}
+			if err := os.WriteFile(filepath.Join(d, name), nil, 0o666); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	fsys := os.DirFS(dir)
+	const pattern = "*/*.css"
+
+	b.Run("fs.Glob", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := fs.Glob(fsys, pattern); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	for _, workers := range []int{1, 4, 16} {
+		b.Run("GlobConcurrent "+strconv.Itoa(workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := fsutil.GlobConcurrent(fsys, pattern, workers); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,451 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"container/list"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	_ io.Closer = (*HashFS)(nil)
+	_ HashCache = (*memoryHashCache)(nil)
+	_ HashCache = (*lruHashCache)(nil)
+)
+
+// HashCache stores hashes of files computed by HashFS. Implementations must be
+// safe for concurrent use. A cache that is shared between multiple instances of
+// HashFS, for example between replicas of a horizontally scaled service, must
+// be used only by the instances that serve the same files, as cached hashes are
+// not validated against files. Errors returned by the cache are returned by
+// HashFS methods.
+type HashCache interface {
+	// Get returns the hash of the named file and true, or false if the hash
+	// is not in the cache.
+	Get(name string) (hash string, ok bool, err error)
+	// Set stores the hash of the named file.
+	Set(name, hash string) error
+	// Delete removes the hash of the named file.
+	Delete(name string) error
+}
+
+// memoryHashCache is the default HashCache that keeps hashes in memory.
+type memoryHashCache struct {
+	hashes map[string]string
+	mu     sync.RWMutex
+}
+
+func newMemoryHashCache() *memoryHashCache {
+	return &memoryHashCache{
+		hashes: make(map[string]string),
+	}
+}
+
+func (c *memoryHashCache) Get(name string) (string, bool, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	h, ok := c.hashes[name]
+	return h, ok, nil
+}
+
+func (c *memoryHashCache) Set(name, hash string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.hashes[name] = hash
+	return nil
+}
+
+func (c *memoryHashCache) Delete(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.hashes, name)
+	return nil
+}
+
+func (c *memoryHashCache) len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return len(c.hashes)
+}
+
+// lruHashCache is the HashCache that keeps up to a maximal number of hashes in
+// memory, evicting the least recently used ones.
+type lruHashCache struct {
+	max       int
+	ll        *list.List // of *lruHashCacheEntry, most recently used first
+	items     map[string]*list.Element
+	evictions int64
+	onEvict   func(name string)
+	mu        sync.Mutex
+}
+
+type lruHashCacheEntry struct {
+	name string
+	hash string
+}
+
+// newLRUHashCache returns a new lruHashCache that calls the onEvict function,
+// if it is not nil, with names of evicted hashes.
+func newLRUHashCache(max int, onEvict func(name string)) *lruHashCache {
+	return &lruHashCache{
+		max:     max,
+		ll:      list.New(),
+		items:   make(map[string]*list.Element),
+		onEvict: onEvict,
+	}
+}
+
+func (c *lruHashCache) Get(name string) (string, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[name]
+	if !ok {
+		return "", false, nil
+	}
+	c.ll.MoveToFront(e)
+	return e.Value.(*lruHashCacheEntry).hash, true, nil
+}
+
+func (c *lruHashCache) Set(name, hash string) error {
+	c.mu.Lock()
+	if e, ok := c.items[name]; ok {
+		e.Value.(*lruHashCacheEntry).hash = hash
+		c.ll.MoveToFront(e)
+		c.mu.Unlock()
+		return nil
+	}
+	c.items[name] = c.ll.PushFront(&lruHashCacheEntry{name: name, hash: hash})
+	var evicted []string
+	for c.ll.Len() > c.max {
+		e := c.ll.Back()
+		c.ll.Remove(e)
+		n := e.Value.(*lruHashCacheEntry).name
+		delete(c.items, n)
+		evicted = append(evicted, n)
+		c.evictions++
+	}
+	c.mu.Unlock()
+
+	// call outside of the lock, as the function may access the cache
+	if c.onEvict != nil {
+		for _, n := range evicted {
+			c.onEvict(n)
+		}
+	}
+	return nil
+}
+
+func (c *lruHashCache) Delete(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[name]; ok {
+		c.ll.Remove(e)
+		delete(c.items, name)
+	}
+	return nil
+}
+
+func (c *lruHashCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.ll.Len()
+}
+
+func (c *lruHashCache) evicted() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.evictions
+}
+
+// WithMaxCachedHashes limits the number of hashes that are kept in memory by
+// the default cache to n, evicting the least recently used hashes when the
+// limit is reached, so that memory used by HashFS does not grow without
+// bounds when it serves files that are created over time, such as user
+// uploads. Evicted hashes are computed again on the next access and they are
+// removed from the file set by WithHashCacheFile option, as well. The option
+// has no effect if a cache is set by the WithHashCache option.
+func WithMaxCachedHashes(n int) HashFSOption {
+	return func(o *hashFSOptions) {
+		o.maxCachedHashes = n
+	}
+}
+
+// HashCacheStats contains information about the usage of the hash cache.
+type HashCacheStats struct {
+	// Entries is the number of hashes in the default cache. It is zero if a
+	// cache is set by the WithHashCache option.
+	Entries int
+	// Hits is the number of lookups of hashes that are found in the cache.
+	Hits int64
+	// Misses is the number of lookups of hashes that are not found in the
+	// cache, including lookups for files that do not exist.
+	Misses int64
+	// Evictions is the number of hashes evicted from the cache because of the
+	// limit set by the WithMaxCachedHashes option.
+	Evictions int64
+}
+
+// CacheStats returns the current statistics of the hash cache.
+func (s *HashFS) CacheStats() HashCacheStats {
+	stats := HashCacheStats{
+		Hits:   atomic.LoadInt64(&s.counters.hits),
+		Misses: atomic.LoadInt64(&s.counters.misses),
+	}
+	switch c := s.cache.(type) {
+	case *memoryHashCache:
+		stats.Entries = c.len()
+	case *lruHashCache:
+		stats.Entries = c.len()
+		stats.Evictions = c.evicted()
+	}
+	return stats
+}
+
+// hashCacheCounters counts accesses to the hash cache. It is allocated
+// separately to keep its fields aligned for atomic operations.
+type hashCacheCounters struct {
+	hits   int64
+	misses int64
+}
+
+// hashCacheVersion is the version of the hash cache file format. Files with a
+// different version are ignored.
+const hashCacheVersion = 1
+
+// WithHashCacheFile sets the file where hashes computed by HashFS are saved by
+// the SaveHashCache and Close methods and from which they are loaded when
+// HashFS is constructed, so that files are not hashed again after a restart. A
+// hash from the file is used only if the size and the modification time of the
+// file are the same as when the hash was computed, and if it is a valid hash
+// of the configured hasher. If the file can not be loaded, all files are
+// hashed.
+func WithHashCacheFile(filename string) HashFSOption {
+	return func(o *hashFSOptions) {
+		o.cacheFile = filename
+	}
+}
+
+// WithHashCacheSaveInterval makes HashFS save computed hashes to the file set
+// by WithHashCacheFile option periodically, if new hashes are computed since
+// the last save. Periodic saving is stopped by the Close method.
+func WithHashCacheSaveInterval(d time.Duration) HashFSOption {
+	return func(o *hashFSOptions) {
+		o.cacheSaveInterval = d
+	}
+}
+
+// SaveHashCache writes all computed hashes and the valid ones loaded at
+// construction to the file set by WithHashCacheFile option.
+func (s *HashFS) SaveHashCache() error {
+	if s.store == nil {
+		return errors.New("hash cache file not configured")
+	}
+	return s.store.save()
+}
+
+// Close stops periodic saving of hashes and saves them, if WithHashCacheFile
+// option is used.
+func (s *HashFS) Close() error {
+	if s.store == nil {
+		return nil
+	}
+	return s.store.close()
+}
+
+// hashCacheFile is the content of the hash cache file.
+type hashCacheFile struct {
+	Version int                  `json:"version"`
+	Files   map[string]hashEntry `json:"files"`
+}
+
+// hashCacheStore loads and saves hashes computed by HashFS.
+type hashCacheStore struct {
+	hasher   Hasher
+	filename string
+
+	loaded     map[string]hashEntry
+	computed   map[string]hashEntry
+	generation uint64 // incremented on every change of hashes
+	mu         sync.Mutex
+
+	saved  uint64 // generation of hashes at the last save
+	saveMu sync.Mutex
+
+	quit      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newHashCacheStore(s *HashFS, filename string, saveInterval time.Duration) *hashCacheStore {
+	c := &hashCacheStore{
+		hasher:   s.hasher,
+		filename: filename,
+		loaded:   loadHashCacheFile(filename),
+		computed: make(map[string]hashEntry),
+	}
+	if saveInterval > 0 {
+		c.quit = make(chan struct{})
+		c.done = make(chan struct{})
+		go c.saveLoop(saveInterval)
+	}
+	return c
+}
+
+// loadHashCacheFile returns hashes from the file, ignoring any errors.
+func loadHashCacheFile(filename string) map[string]hashEntry {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil
+	}
+	var f hashCacheFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil
+	}
+	if f.Version != hashCacheVersion {
+		return nil
+	}
+	return f.Files
+}
+
+// lookup returns the hash loaded from the file if it is computed for the file
+// with the same size and modification time as in e.
+func (c *hashCacheStore) lookup(name string, e hashEntry) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	l, ok := c.loaded[name]
+	c.mu.Unlock()
+	if !ok || l.Size != e.Size || !l.ModTime.Equal(e.ModTime) || !c.hasher.IsHash(l.Hash) {
+		return "", false
+	}
+	return l.Hash, true
+}
+
+// add records the computed hash to be saved.
+func (c *hashCacheStore) add(name string, e hashEntry) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.computed[name] = e
+	c.generation++
+}
+
+// remove forgets both loaded and computed hashes of the named file.
+func (c *hashCacheStore) remove(name string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.loaded, name)
+	delete(c.computed, name)
+	c.generation++
+}
+
+func (c *hashCacheStore) save() error {
+	c.saveMu.Lock()
+	defer c.saveMu.Unlock()
+
+	f := hashCacheFile{
+		Version: hashCacheVersion,
+		Files:   make(map[string]hashEntry),
+	}
+	c.mu.Lock()
+	for name, e := range c.loaded {
+		f.Files[name] = e
+	}
+	for name, e := range c.computed {
+		f.Files[name] = e
+	}
+	generation := c.generation
+	c.mu.Unlock()
+
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file and rename it, so that the file is never
+	// partially written.
+	tmpFile, err := os.CreateTemp(filepath.Dir(c.filename), filepath.Base(c.filename)+".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpFile.Name())
+		return err
+	}
+	if err := os.Rename(tmpFile.Name(), c.filename); err != nil {
+		os.Remove(tmpFile.Name())
+		return err
+	}
+
+	c.saved = generation
+	return nil
+}
+
+// saveLoop saves hashes in intervals if hashes are computed or removed.
+func (c *hashCacheStore) saveLoop(interval time.Duration) {
+	defer close(c.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.mu.Lock()
+			generation := c.generation
+			c.mu.Unlock()
+
+			c.saveMu.Lock()
+			changed := generation != c.saved
+			c.saveMu.Unlock()
+
+			if changed {
+				_ = c.save()
+			}
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+func (c *hashCacheStore) close() (err error) {
+	c.closeOnce.Do(func() {
+		if c.quit != nil {
+			close(c.quit)
+			<-c.done
+		}
+		err = c.save()
+	})
+	return err
+}
@@ -0,0 +1,343 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestHashFS_hashCache(t *testing.T) {
+	dir := t.TempDir()
+	cacheFile := filepath.Join(t.TempDir(), "hashes.json")
+
+	writeFile := func(t *testing.T, name, content string, modTime time.Time) {
+		t.Helper()
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	modTime := time.Date(2021, 8, 9, 10, 11, 12, 0, time.UTC)
+	writeFile(t, "app.css", "body{}", modTime)
+	writeFile(t, "app.js", "alert()", modTime)
+
+	newHashFS := func(t *testing.T, opts ...fsutil.HashFSOption) (*fsutil.HashFS, *countingHasher) {
+		t.Helper()
+		hasher := &countingHasher{Hasher: fsutil.NewMD5Hasher(8)}
+		return fsutil.NewHashFS(os.DirFS(dir), hasher, opts...), hasher
+	}
+	hashedPaths := func(t *testing.T, fsys *fsutil.HashFS) map[string]string {
+		t.Helper()
+		paths := make(map[string]string)
+		for _, name := range []string{"app.css", "app.js"} {
+			p, err := fsys.HashedPath(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			paths[name] = p
+		}
+		return paths
+	}
+
+	fsys, hasher := newHashFS(t, fsutil.WithHashCacheFile(cacheFile))
+	want := hashedPaths(t, fsys)
+	if got := hasher.count(); got != 2 {
+		t.Errorf("got %v hashed files, want 2", got)
+	}
+	if err := fsys.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("load", func(t *testing.T) {
+		fsys, hasher := newHashFS(t, fsutil.WithHashCacheFile(cacheFile))
+		defer fsys.Close()
+
+		got := hashedPaths(t, fsys)
+		if got["app.css"] != want["app.css"] || got["app.js"] != want["app.js"] {
+			t.Errorf("got hashed paths %v, want %v", got, want)
+		}
+		if got := hasher.count(); got != 0 {
+			t.Errorf("got %v hashed files, want 0", got)
+		}
+	})
+
+	t.Run("stale", func(t *testing.T) {
+		writeFile(t, "app.js", "alert(1)", modTime.Add(time.Hour))
+
+		fsys, hasher := newHashFS(t, fsutil.WithHashCacheFile(cacheFile))
+
+		got := hashedPaths(t, fsys)
+		if got["app.css"] != want["app.css"] {
+			t.Errorf("got hashed path %v, want %v", got["app.css"], want["app.css"])
+		}
+		if got["app.js"] == want["app.js"] {
+			t.Errorf("got stale hashed path %v", got["app.js"])
+		}
+		if got := hasher.count(); got != 1 {
+			t.Errorf("got %v hashed files, want 1", got)
+		}
+		if err := fsys.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		fsys, hasher = newHashFS(t, fsutil.WithHashCacheFile(cacheFile))
+		defer fsys.Close()
+
+		hashedPaths(t, fsys)
+		if got := hasher.count(); got != 0 {
+			t.Errorf("got %v hashed files, want 0", got)
+		}
+	})
+
+	t.Run("corrupted", func(t *testing.T) {
+		corruptedFile := filepath.Join(t.TempDir(), "hashes.json")
+		if err := os.WriteFile(corruptedFile, []byte("{"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		fsys, hasher := newHashFS(t, fsutil.WithHashCacheFile(corruptedFile))
+		defer fsys.Close()
+
+		hashedPaths(t, fsys)
+		if got := hasher.count(); got != 2 {
+			t.Errorf("got %v hashed files, want 2", got)
+		}
+	})
+
+	t.Run("save interval", func(t *testing.T) {
+		intervalFile := filepath.Join(t.TempDir(), "hashes.json")
+
+		fsys, _ := newHashFS(t, fsutil.WithHashCacheFile(intervalFile), fsutil.WithHashCacheSaveInterval(10*time.Millisecond))
+		defer fsys.Close()
+
+		hashedPaths(t, fsys)
+
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			if _, err := os.Stat(intervalFile); err == nil {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("hash cache file not saved")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		// A recomputed hash does not change the number of hashes, but it is
+		// saved.
+		writeFile(t, "app.css", "body{color:red}", modTime.Add(time.Hour))
+		if err := fsys.Invalidate("app.css"); err != nil {
+			t.Fatal(err)
+		}
+		p, err := fsys.HashedPath("app.css")
+		if err != nil {
+			t.Fatal(err)
+		}
+		hash := strings.Split(p, ".")[1]
+		deadline = time.Now().Add(5 * time.Second)
+		for {
+			data, err := os.ReadFile(intervalFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(data), hash) {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("recomputed hash not saved")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+
+	t.Run("not configured", func(t *testing.T) {
+		fsys, _ := newHashFS(t)
+
+		if err := fsys.SaveHashCache(); err == nil {
+			t.Error("expected error")
+		}
+		if err := fsys.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestHashFS_sharedHashCache(t *testing.T) {
+	files := fsutil.MapFS{
+		"app.css": {Data: []byte("body{}")},
+		"app.js":  {Data: []byte("alert()")},
+	}
+	cache := newMapHashCache()
+
+	hasher1 := &countingHasher{Hasher: fsutil.NewMD5Hasher(8)}
+	fsys1 := fsutil.NewHashFS(files, hasher1, fsutil.WithHashCache(cache))
+	hashedPath, err := fsys1.HashedPath("app.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hasher2 := &countingHasher{Hasher: fsutil.NewMD5Hasher(8)}
+	fsys2 := fsutil.NewHashFS(files, hasher2, fsutil.WithHashCache(cache))
+	got, err := fsys2.HashedPath("app.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != hashedPath {
+		t.Errorf("got hashed path %q, want %q", got, hashedPath)
+	}
+	if got := hasher2.count(); got != 0 {
+		t.Errorf("got %v hashed files, want 0", got)
+	}
+
+	if err := fsys2.Invalidate("app.css"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys1.HashedPath("app.css"); err != nil {
+		t.Fatal(err)
+	}
+	if got := hasher1.count(); got != 2 {
+		t.Errorf("got %v hashed files, want 2", got)
+	}
+
+	t.Run("error", func(t *testing.T) {
+		cache.err = errTest1
+		defer func() { cache.err = nil }()
+
+		if _, err := fsys1.HashedPath("app.js"); !errors.Is(err, errTest1) {
+			t.Errorf("got error %v, want %v", err, errTest1)
+		}
+	})
+}
+
+func TestHashFS_maxCachedHashes(t *testing.T) {
+	files := fsutil.MapFS{
+		"a.css": {Data: []byte("a{}")},
+		"b.css": {Data: []byte("b{}")},
+		"c.css": {Data: []byte("c{}")},
+	}
+	hasher := &countingHasher{Hasher: fsutil.NewMD5Hasher(8)}
+	fsys := fsutil.NewHashFS(files, hasher, fsutil.WithMaxCachedHashes(2))
+
+	hashedPath := func(name string) {
+		t.Helper()
+		if _, err := fsys.HashedPath(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hashedPath("a.css")
+	hashedPath("b.css")
+	hashedPath("a.css") // a.css is used more recently than b.css
+	hashedPath("c.css") // evicts b.css
+
+	want := fsutil.HashCacheStats{Entries: 2, Hits: 1, Misses: 3, Evictions: 1}
+	if got := fsys.CacheStats(); got != want {
+		t.Errorf("got stats %+v, want %+v", got, want)
+	}
+
+	hashedPath("a.css")
+	if got := hasher.count(); got != 3 {
+		t.Errorf("got %v hashed files, want 3", got)
+	}
+	hashedPath("b.css")
+	if got := hasher.count(); got != 4 {
+		t.Errorf("got %v hashed files, want 4", got)
+	}
+
+	want = fsutil.HashCacheStats{Entries: 2, Hits: 2, Misses: 4, Evictions: 2}
+	if got := fsys.CacheStats(); got != want {
+		t.Errorf("got stats %+v, want %+v", got, want)
+	}
+}
+
+func TestHashFS_CacheStats(t *testing.T) {
+	files := fsutil.MapFS{
+		"app.css": {Data: []byte("body{}")},
+	}
+
+	fsys := fsutil.NewHashFS(files, fsutil.NewMD5Hasher(8))
+	for i := 0; i < 3; i++ {
+		if _, err := fsys.HashedPath("app.css"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := fsutil.HashCacheStats{Entries: 1, Hits: 2, Misses: 1}
+	if got := fsys.CacheStats(); got != want {
+		t.Errorf("got stats %+v, want %+v", got, want)
+	}
+
+	fsys = fsutil.NewHashFS(files, fsutil.NewMD5Hasher(8), fsutil.WithHashCache(newMapHashCache()))
+	if _, err := fsys.HashedPath("app.css"); err != nil {
+		t.Fatal(err)
+	}
+	want = fsutil.HashCacheStats{Misses: 1}
+	if got := fsys.CacheStats(); got != want {
+		t.Errorf("got stats %+v, want %+v", got, want)
+	}
+}
+
+// mapHashCache is a HashCache with an error to return from its methods.
+type mapHashCache struct {
+	hashes map[string]string
+	err    error
+	mu     sync.Mutex
+}
+
+func newMapHashCache() *mapHashCache {
+	return &mapHashCache{hashes: make(map[string]string)}
+}
+
+func (c *mapHashCache) Get(name string) (string, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	h, ok := c.hashes[name]
+	return h, ok, c.err
+}
+
+func (c *mapHashCache) Set(name, hash string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.hashes[name] = hash
+	return c.err
+}
+
+func (c *mapHashCache) Delete(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.hashes, name)
+	return c.err
+}
+
+// countingHasher counts the number of hashed files.
+type countingHasher struct {
+	fsutil.Hasher
+	n int64
+}
+
+func (h *countingHasher) Hash(r io.Reader) (string, error) {
+	atomic.AddInt64(&h.n, 1)
+	return h.Hasher.Hash(r)
+}
+
+func (h *countingHasher) count() int64 {
+	return atomic.LoadInt64(&h.n)
+}
@@ -7,8 +7,17 @@ package fsutil
 
 import (
 	"crypto/md5"
+	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
 	"io"
+	"io/fs"
+)
+
+var (
+	_ Hasher         = (*MD5Hasher)(nil)
+	_ Hasher         = (*SHA256Hasher)(nil)
+	_ FileInfoHasher = (*SamplingHasher)(nil)
 )
 
 var hexChars = []rune("0123456789abcdef")
@@ -46,7 +55,44 @@ func (s *MD5Hasher) Hash(reader io.Reader) (string, error) {
 
 // IsHash checks is provided string a valid hash.
 func (s *MD5Hasher) IsHash(h string) bool {
-	if len(h) != s.hashLength {
+	return isHexHash(h, s.hashLength)
+}
+
+// SHA256Hasher uses SHA-256 sum to compute a file hash. With the hash length
+// of 64, hashes are the same as the ones computed by the sha256sum utility.
+type SHA256Hasher struct {
+	hashLength int
+}
+
+// NewSHA256Hasher creates a new instance of SHA256Hasher.
+func NewSHA256Hasher(hashLength int) *SHA256Hasher {
+	return &SHA256Hasher{
+		hashLength: hashLength,
+	}
+}
+
+// Hash returns a part of a SHA-256 sum of a file.
+func (s *SHA256Hasher) Hash(reader io.Reader) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, reader); err != nil {
+		return "", err
+	}
+	h := hex.EncodeToString(hash.Sum(nil))
+	if len(h) < s.hashLength {
+		return "", nil
+	}
+	return h[:s.hashLength], nil
+}
+
+// IsHash checks is provided string a valid hash.
+func (s *SHA256Hasher) IsHash(h string) bool {
+	return isHexHash(h, s.hashLength)
+}
+
+// isHexHash checks if the string has the length and only lowercase
+// hexadecimal characters.
+func isHexHash(h string, length int) bool {
+	if len(h) != length {
 		return false
 	}
 	var found bool
@@ -64,3 +110,68 @@ func (s *MD5Hasher) IsHash(h string) bool {
 	}
 	return true
 }
+
+// FileInfoHasher is a Hasher that also uses the file metadata to compute the
+// hash. HashFS calls HashFileInfo instead of Hash for hashers that implement
+// this interface.
+type FileInfoHasher interface {
+	Hasher
+	HashFileInfo(reader io.Reader, info fs.FileInfo) (string, error)
+}
+
+// SamplingHasher uses MD5 sum of the first sampleSize bytes of a file, its size
+// and its modification time to compute a file hash. It avoids reading the whole
+// content of large files, at the cost of not detecting changes after the
+// sample that preserve the size and the modification time. Hashes have the
+// same format as the ones computed by MD5Hasher with the same hash length.
+type SamplingHasher struct {
+	hashLength int
+	sampleSize int64
+}
+
+// NewSamplingHasher creates a new instance of SamplingHasher.
+func NewSamplingHasher(hashLength int, sampleSize int64) *SamplingHasher {
+	return &SamplingHasher{
+		hashLength: hashLength,
+		sampleSize: sampleSize,
+	}
+}
+
+// Hash returns a part of a MD5 sum of the first sampleSize bytes.
+func (s *SamplingHasher) Hash(reader io.Reader) (string, error) {
+	return s.HashFileInfo(reader, nil)
+}
+
+// HashFileInfo returns a part of a MD5 sum of the first sampleSize bytes, the
+// size and the modification time of a file.
+func (s *SamplingHasher) HashFileInfo(reader io.Reader, info fs.FileInfo) (string, error) {
+	hash := md5.New()
+	if _, err := io.CopyN(hash, reader, s.sampleSize); err != nil && err != io.EOF {
+		return "", err
+	}
+	if info != nil {
+		var b [16]byte
+		binary.BigEndian.PutUint64(b[:8], uint64(info.Size()))
+		binary.BigEndian.PutUint64(b[8:], uint64(info.ModTime().UnixNano()))
+		hash.Write(b[:])
+	}
+	h := hex.EncodeToString(hash.Sum(nil))
+	if len(h) < s.hashLength {
+		return "", nil
+	}
+	return h[:s.hashLength], nil
+}
+
+// IsHash checks is provided string a valid hash.
+func (s *SamplingHasher) IsHash(h string) bool {
+	return (&MD5Hasher{hashLength: s.hashLength}).IsHash(h)
+}
+
+// hashFileContent computes the hash of the file content with the hasher,
+// providing the file info to FileInfoHasher.
+func hashFileContent(h Hasher, reader io.Reader, info fs.FileInfo) (string, error) {
+	if h, ok := h.(FileInfoHasher); ok {
+		return h.HashFileInfo(reader, info)
+	}
+	return h.Hash(reader)
+}
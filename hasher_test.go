@@ -7,8 +7,10 @@ package fsutil_test
 
 import (
 	"errors"
+	"io/fs"
 	"strings"
 	"testing"
+	"time"
 
 	"resenje.org/fsutil"
 )
@@ -75,3 +77,81 @@ func TestMD5HasherIsHashLength(t *testing.T) {
 		t.Error("hash \"123\" reported that it is a valid hahs of length 5")
 	}
 }
+
+func TestSHA256Hasher(t *testing.T) {
+	h, err := fsutil.NewSHA256Hasher(8).Hash(strings.NewReader("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "9f86d081"; h != want {
+		t.Errorf("got hash %q, want %q", h, want)
+	}
+	if !fsutil.NewSHA256Hasher(8).IsHash(h) {
+		t.Errorf("got hash %q not valid", h)
+	}
+	if fsutil.NewSHA256Hasher(8).IsHash("9F86D081") {
+		t.Error("got uppercase hash valid")
+	}
+}
+
+func TestSamplingHasher(t *testing.T) {
+	hasher := fsutil.NewSamplingHasher(8, 4)
+	modTime := time.Date(2021, 8, 9, 10, 11, 12, 0, time.UTC)
+	info := func(size int64, modTime time.Time) fs.FileInfo {
+		return mockFileInfo{size: size, modTime: modTime}
+	}
+
+	h1, err := hasher.HashFileInfo(strings.NewReader("testdata"), info(8, modTime))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasher.IsHash(h1) {
+		t.Errorf("%q is not a valid hash", h1)
+	}
+	if !fsutil.NewMD5Hasher(8).IsHash(h1) {
+		t.Errorf("%q is not a valid md5 hasher hash", h1)
+	}
+
+	h2, err := hasher.HashFileInfo(strings.NewReader("testDATA"), info(8, modTime))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h2 != h1 {
+		t.Errorf("got hash %q for the same sample, want %q", h2, h1)
+	}
+
+	for _, tc := range []struct {
+		content string
+		info    fs.FileInfo
+	}{
+		{content: "TESTdata", info: info(8, modTime)},
+		{content: "testdata", info: info(9, modTime)},
+		{content: "testdata", info: info(8, modTime.Add(time.Second))},
+	} {
+		h, err := hasher.HashFileInfo(strings.NewReader(tc.content), tc.info)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h == h1 {
+			t.Errorf("got the same hash %q for %q, size %v and mod time %v", h, tc.content, tc.info.Size(), tc.info.ModTime())
+		}
+	}
+
+	if _, err := hasher.Hash(faultyReader{}); err != errTest {
+		t.Errorf("expected error %v, got %v", errTest, err)
+	}
+
+	for _, hashLength := range []int{20, 32, 33} {
+		want := hashLength
+		if hashLength > 32 {
+			want = 0
+		}
+		h, err := fsutil.NewSamplingHasher(hashLength, 4).Hash(strings.NewReader("testdata"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(h) != want {
+			t.Errorf("got hash %q of length %v for hash length %v, want length %v", h, len(h), hashLength, want)
+		}
+	}
+}
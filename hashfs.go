@@ -10,9 +10,12 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -22,6 +25,8 @@ var (
 	_ fs.ReadDirFS  = (*HashFS)(nil)
 	_ fs.ReadFileFS = (*HashFS)(nil)
 	_ fs.StatFS     = (*HashFS)(nil)
+	_ fs.SubFS      = (*HashFS)(nil)
+	_ ReadLinkFS    = (*HashFS)(nil)
 )
 
 // HashFS is a filesystem that injects a hash string into file names from
@@ -32,48 +37,297 @@ var (
 //
 // Method HashedPath provides a way to obtain the filename with a hash in it
 // based on the original file name.
+//
+// The hash is inserted into the file name as a dot separated part before the
+// last extension, or before the last few extensions, as set by the
+// WithHashExtensionDepth option. File names without extensions have the hash
+// appended. The leading dot of hidden files, like ".htaccess", does not
+// separate an extension. For example, "main.css" is served as
+// "main.45b416.css", "jquery.min.js" as "jquery.min.45b416.js", "LICENSE" as
+// "LICENSE.45b416" and ".htaccess" as ".htaccess.45b416". A part of a
+// requested name at the hash position that is recognized as a hash by the
+// hasher is considered to be the hash. Concurrent accesses to a file that is
+// not hashed yet share a single computation of its hash.
 type HashFS struct {
 	fsys   fs.FS
 	hasher Hasher
+	// prefix is the directory of the subtree returned by the Sub method,
+	// which is prepended to names of files in the state that is shared with
+	// the HashFS that Sub is called on.
+	prefix string
+
+	cache HashCache
+	store *hashCacheStore
+	o     hashFSOptions
+
+	// notExist caches names of files that do not exist when
+	// WithHashNotExistCache option is used.
+	notExist *NotExistCacheFS
+
+	*hashFSState
+
+	counters *hashCacheCounters
+}
+
+// hashFSState is the state of HashFS that is shared with filesystems returned
+// by its Sub method.
+type hashFSState struct {
+	// verified holds sizes and modification times of hashed files when
+	// WithVerifyOnOpen option is used.
+	verified   map[string]hashEntry
+	verifiedMu sync.Mutex
+
+	// hashing deduplicates concurrent hashing of the same file.
+	hashing flightGroup
+	// invalidations is incremented by Invalidate, so that hashes that are
+	// computed while any file is invalidated are not stored, as they may be
+	// computed from the previous file content.
+	invalidations   uint64
+	invalidationsMu sync.RWMutex
+}
+
+// HashFSOption is used to provide optional parameters to NewHashFS function.
+type HashFSOption func(*hashFSOptions)
+
+type hashFSOptions struct {
+	cache             HashCache
+	cacheFile         string
+	cacheSaveInterval time.Duration
+	lazyDirHashing    bool
+	unhashedAccess    UnhashedAccessMode
+	extensionDepth    int
+	verifyOnOpen      bool
+	overlays          []fs.FS
+	globWorkers       int
+	notExistTTL       time.Duration
+	maxCachedHashes   int
+
+	largeFileHasher    Hasher
+	largeFileThreshold int64
+}
+
+// WithHashExtensionDepth sets the number of extensions that are kept after the
+// hash in hashed file names. The default depth is 1, which places the hash
+// before the last extension, for example "jquery.min.45b416.js". With depth 2,
+// the hash is placed before the last two extensions, for example
+// "jquery.45b416.min.js" or "archive.45b416.tar.gz". With depth 0, the hash is
+// appended to the file name. Files that have fewer extensions have the hash
+// placed after the first part of their names.
+func WithHashExtensionDepth(depth int) HashFSOption {
+	return func(o *hashFSOptions) {
+		if depth < 0 {
+			depth = 0
+		}
+		o.extensionDepth = depth
+	}
+}
+
+// WithVerifyOnOpen makes Open and ReadFile methods check if the size or the
+// modification time of the file changed since its hash was computed. If it
+// did, the hash is computed again and, if the hash in the requested name is no
+// longer valid, HashedPathError with the new hashed path is returned. Without
+// this option, the content of a changed file is served under its old hashed
+// name. HashedPathError is returned for names with hashes that do not match
+// the current file content, as well.
+func WithVerifyOnOpen() HashFSOption {
+	return func(o *hashFSOptions) {
+		o.verifyOnOpen = true
+	}
+}
+
+// WithHashGlobWorkers makes the Glob method read directories of the underlying
+// filesystem from a number of concurrent workers with GlobConcurrent, which is
+// faster for patterns with wildcards in directory names on large trees.
+func WithHashGlobWorkers(workers int) HashFSOption {
+	return func(o *hashFSOptions) {
+		o.globWorkers = workers
+	}
+}
+
+// WithHashNotExistCache makes HashFS remember names of files that do not exist
+// in the underlying filesystem for the ttl duration, as NotExistCacheFS does,
+// so that repeated requests for them, for example by scanners probing for
+// known vulnerable paths, do not reach the underlying filesystem. Invalidate
+// method removes the name from this cache, as well.
+func WithHashNotExistCache(ttl time.Duration) HashFSOption {
+	return func(o *hashFSOptions) {
+		o.notExistTTL = ttl
+	}
+}
+
+// UnhashedAccessMode defines how HashFS handles access to a file by its name
+// without the hash.
+type UnhashedAccessMode int
+
+const (
+	// UnhashedAccessStrict makes the file inaccessible by its name without
+	// the hash, returning fs.ErrNotExist. It is the default mode.
+	UnhashedAccessStrict UnhashedAccessMode = iota
+	// UnhashedAccessPermissive makes the file accessible by its name without
+	// the hash, as well.
+	UnhashedAccessPermissive
+	// UnhashedAccessRedirectInfo makes the file inaccessible by its name
+	// without the hash, returning HashedPathError with the hashed path, so
+	// that HTTP handlers can redirect to it.
+	UnhashedAccessRedirectInfo
+)
+
+// WithUnhashedAccessMode sets how files are handled when accessed by their
+// names without hashes.
+func WithUnhashedAccessMode(mode UnhashedAccessMode) HashFSOption {
+	return func(o *hashFSOptions) {
+		o.unhashedAccess = mode
+	}
+}
+
+// ErrHashMismatch is returned by HashFS for names with hashes that do not match
+// the content of files. It wraps fs.ErrNotExist.
+var ErrHashMismatch = fmt.Errorf("hash mismatch: %w", fs.ErrNotExist)
+
+// HashedPathError is returned by HashFS in UnhashedAccessRedirectInfo mode
+// when a file is accessed by its name without the hash, and with the
+// WithVerifyOnOpen option when a file is accessed by its name with the hash of
+// its previous content. It wraps fs.ErrNotExist.
+type HashedPathError struct {
+	// HashedPath is the path with the hash of the file.
+	HashedPath string
+	// Mismatch is true if the file is accessed by its name with the hash of
+	// its previous content.
+	Mismatch bool
+}
+
+// Error implements error interface.
+func (e *HashedPathError) Error() string {
+	return fmt.Sprintf("file exists as %s", e.HashedPath)
+}
+
+// Unwrap returns ErrHashMismatch if the hash in the name does not match the
+// content of the file, otherwise fs.ErrNotExist.
+func (e *HashedPathError) Unwrap() error {
+	if e.Mismatch {
+		return ErrHashMismatch
+	}
+	return fs.ErrNotExist
+}
 
-	hashes   map[string]string
-	hashesMu sync.RWMutex
+// WithLargeFileHasher sets the hasher that is used for files larger than
+// threshold bytes, for example SamplingHasher, to avoid reading the whole
+// content of large files. Hashes in file names are recognized by the hasher
+// passed to NewHashFS, so both hashers must compute hashes in the same format.
+func WithLargeFileHasher(threshold int64, hasher Hasher) HashFSOption {
+	return func(o *hashFSOptions) {
+		o.largeFileHasher = hasher
+		o.largeFileThreshold = threshold
+	}
+}
+
+// WithLazyDirHashing makes directory entries returned by ReadDir methods
+// compute hashed names of files only when their Name or Info methods are
+// called, instead of hashing all files in the directory before ReadDir
+// returns. Listing a directory with large files is fast in this mode, but
+// listed files that can not be hashed have their original names, or return an
+// error from the Info method.
+func WithLazyDirHashing() HashFSOption {
+	return func(o *hashFSOptions) {
+		o.lazyDirHashing = true
+	}
+}
+
+// WithHashCache sets the cache for computed hashes. By default, hashes are
+// cached in memory for the lifetime of HashFS.
+func WithHashCache(c HashCache) HashFSOption {
+	return func(o *hashFSOptions) {
+		o.cache = c
+	}
+}
+
+// WithHashOverlays sets filesystems that are searched for files before the
+// one passed to NewHashFS, in the order of precedence, as layers of UnionFS.
+// Files from all filesystems are hashed in a single namespace and by a single
+// cache, so that a file that overrides another one with the same name, for
+// example a theme asset overriding the base one, has the hash of its own
+// content.
+func WithHashOverlays(overlays ...fs.FS) HashFSOption {
+	return func(o *hashFSOptions) {
+		o.overlays = overlays
+	}
 }
 
 // NewHashFS returns a new instance of HashFS.
-func NewHashFS(fsys fs.FS, hasher Hasher) *HashFS {
-	return &HashFS{
+func NewHashFS(fsys fs.FS, hasher Hasher, opts ...HashFSOption) *HashFS {
+	o := hashFSOptions{
+		extensionDepth: 1,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if len(o.overlays) > 0 {
+		fsys = NewUnionFS(append(append([]fs.FS(nil), o.overlays...), fsys)...)
+	}
+	var notExist *NotExistCacheFS
+	if o.notExistTTL > 0 {
+		notExist = NewNotExistCacheFS(fsys, o.notExistTTL)
+		fsys = notExist
+	}
+	s := newHashFS(fsys, hasher, o)
+	s.notExist = notExist
+	return s
+}
+
+func newHashFS(fsys fs.FS, hasher Hasher, o hashFSOptions) *HashFS {
+	s := &HashFS{
 		fsys:   fsys,
 		hasher: hasher,
-		hashes: make(map[string]string),
+		cache:  o.cache,
+		o:      o,
+		hashFSState: &hashFSState{
+			verified: make(map[string]hashEntry),
+		},
+		counters: new(hashCacheCounters),
+	}
+	if s.cache == nil {
+		if o.maxCachedHashes > 0 {
+			s.cache = newLRUHashCache(o.maxCachedHashes, s.forget)
+		} else {
+			s.cache = newMemoryHashCache()
+		}
 	}
+	if o.cacheFile != "" {
+		s.store = newHashCacheStore(s, o.cacheFile, o.cacheSaveInterval)
+	}
+	return s
 }
 
 // Open implements fs.FS interface.
 func (s *HashFS) Open(name string) (fs.File, error) {
-	canonicalName, hash, err := s.canonicalName(name)
+	canonicalName, hash, err := s.canonicalName("open", name)
 	if err != nil {
 		return nil, err
 	}
 	if hash != "" && canonicalName == name {
-		return nil, fs.ErrNotExist
+		if err := s.unhashedAccessError("open", name, hash); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.verify("open", name, canonicalName, hash); err != nil {
+		return nil, err
 	}
 	f, err := s.fsys.Open(canonicalName)
 	if err != nil {
-		return nil, err
+		return nil, &fs.PathError{Op: "open", Path: name, Err: unwrapPathError(err)}
 	}
 	return newHashFile(name, f, s), nil
 }
 
 // Glob implements fs.GlobFS interface.
 func (s *HashFS) Glob(pattern string) ([]string, error) {
-	r, err := fs.Glob(s.fsys, pattern)
+	r, err := s.glob(s.fsys, pattern)
 	if err != nil {
 		return nil, err
 	}
 	var n int
 	for _, e := range r {
-		canonicalName, hash, err := s.canonicalName(e)
+		canonicalName, hash, err := s.canonicalName("glob", e)
 		if err != nil {
 			if errors.Is(err, fs.ErrNotExist) {
 				continue
@@ -86,92 +340,196 @@ func (s *HashFS) Glob(pattern string) ([]string, error) {
 	return r[:n], nil
 }
 
+// glob returns names matching the pattern, concurrently if the
+// WithHashGlobWorkers option is used.
+func (s *HashFS) glob(fsys fs.FS, pattern string) ([]string, error) {
+	if s.o.globWorkers > 0 {
+		return GlobConcurrent(fsys, pattern, s.o.globWorkers)
+	}
+	return fs.Glob(fsys, pattern)
+}
+
 // ReadDir implements fs.ReadDirFS interface.
 func (s *HashFS) ReadDir(name string) ([]fs.DirEntry, error) {
 	r, err := fs.ReadDir(s.fsys, name)
 	if err != nil {
-		return nil, err
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: unwrapPathError(err)}
 	}
-	var n int
-	for _, e := range r {
-		if e.IsDir() {
-			r[n] = e
-			n++
-			continue
-		}
-		canonicalName, hash, err := s.canonicalName(filepath.ToSlash(filepath.Join(name, e.Name())))
-		if err != nil {
-			if errors.Is(err, fs.ErrNotExist) {
-				continue
-			}
-			return nil, err
-		}
-		name := s.hashedPath(filepath.Base(canonicalName), hash)
-		r[n] = &dirEntry{e: e, name: name}
-		n++
-	}
-	return r[:n], nil
+	return s.hashedEntries(name, r)
 }
 
 // ReadFile implements fs.ReadFileFS interface.
 func (s *HashFS) ReadFile(name string) ([]byte, error) {
-	canonicalName, hash, err := s.canonicalName(name)
+	canonicalName, hash, err := s.canonicalName("readfile", name)
 	if err != nil {
 		return nil, err
 	}
 	if hash != "" && canonicalName == name {
-		return nil, fs.ErrNotExist
+		if err := s.unhashedAccessError("readfile", name, hash); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.verify("readfile", name, canonicalName, hash); err != nil {
+		return nil, err
 	}
-	return fs.ReadFile(s.fsys, canonicalName)
+	data, err := fs.ReadFile(s.fsys, canonicalName)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: unwrapPathError(err)}
+	}
+	return data, nil
 }
 
 // Stat implements fs.StatFS interface.
 func (s *HashFS) Stat(name string) (fs.FileInfo, error) {
-	canonicalName, hash, err := s.canonicalName(name)
+	canonicalName, hash, err := s.canonicalName("stat", name)
 	if err != nil {
 		return nil, err
 	}
 	if hash != "" && canonicalName == name {
-		return nil, fs.ErrNotExist
+		if err := s.unhashedAccessError("stat", name, hash); err != nil {
+			return nil, err
+		}
 	}
 	i, err := fs.Stat(s.fsys, canonicalName)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: unwrapPathError(err)}
+	}
+	return NewFileInfo(i, WithName(filepath.Base(name))), nil
+}
+
+// ReadLink implements ReadLinkFS interface.
+func (s *HashFS) ReadLink(name string) (string, error) {
+	canonicalName, hash, err := s.canonicalName("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	if hash != "" && canonicalName == name {
+		if err := s.unhashedAccessError("readlink", name, hash); err != nil {
+			return "", err
+		}
+	}
+	target, err := ReadLink(s.fsys, canonicalName)
+	if err != nil {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: unwrapPathError(err)}
+	}
+	return target, nil
+}
+
+// Lstat implements ReadLinkFS interface.
+func (s *HashFS) Lstat(name string) (fs.FileInfo, error) {
+	canonicalName, hash, err := s.canonicalName("lstat", name)
 	if err != nil {
 		return nil, err
 	}
-	return &fileInfo{i: i, name: filepath.Base(name)}, nil
+	if hash != "" && canonicalName == name {
+		if err := s.unhashedAccessError("lstat", name, hash); err != nil {
+			return nil, err
+		}
+	}
+	i, err := Lstat(s.fsys, canonicalName)
+	if err != nil {
+		return nil, &fs.PathError{Op: "lstat", Path: name, Err: unwrapPathError(err)}
+	}
+	return NewFileInfo(i, WithName(filepath.Base(name))), nil
+}
+
+// Sub implements fs.SubFS interface. It returns a new instance of HashFS
+// with the same options over the subtree of the underlying filesystem. It
+// shares the hash cache, the hash cache file and the statistics with s, so
+// that files are not hashed again, and its Invalidate, SaveHashCache, Close
+// and CacheStats methods operate on the shared state.
+func (s *HashFS) Sub(dir string) (fs.FS, error) {
+	fsys, err := fs.Sub(s.fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	if dir == "." {
+		return s, nil
+	}
+	sub := *s
+	sub.fsys = fsys
+	sub.prefix = s.key(dir)
+	return &sub, nil
+}
+
+// Unwrap returns the underlying filesystem.
+func (s *HashFS) Unwrap() fs.FS {
+	return s.fsys
 }
 
 // HashedPath returns a path with hash injected into the filename.
 func (s *HashFS) HashedPath(name string) (string, error) {
-	canonicalName, hash, err := s.canonicalName(name)
+	canonicalName, hash, err := s.canonicalName("hashedpath", name)
 	if err != nil {
 		return "", err
 	}
 	return s.hashedPath(canonicalName, hash), nil
 }
 
-func (s *HashFS) canonicalName(name string) (canonicalName string, hash string, err error) {
-	d, f := filepath.Split(name)
+// Invalidate removes the hash of the named file from the cache, so that it is
+// computed again on the next access. It should be called when the file
+// content changes.
+func (s *HashFS) Invalidate(name string) error {
+	s.invalidationsMu.Lock()
+	s.invalidations++
+	s.invalidationsMu.Unlock()
+	key := s.key(name)
+	// Calls that follow do not wait for the hashing that is in progress.
+	s.hashing.forget(key)
 
-	parts := strings.Split(f, ".")
-	f = ""
-	l := len(parts)
-	index := 1
-	if l > 2 && !(l == 3 && parts[0] == "") {
-		index = 2
-	}
-	var hashFromName string
-	for i, part := range parts {
-		if i == l-index && s.hasher.IsHash(part) {
-			hashFromName = part
-			continue
-		}
-		if i != 0 {
-			f += "."
-		}
-		f += part
+	s.forget(key)
+
+	if s.notExist != nil {
+		s.notExist.Invalidate(key)
 	}
 
+	return s.cache.Delete(key)
+}
+
+// AddHash stores the hash of the named file with the provided file info,
+// computed elsewhere, for example by TeeHashReader while the file is served,
+// so that HashFS does not read the file to compute it. The hash must be
+// computed with the hasher that HashFS uses for the file.
+func (s *HashFS) AddHash(name, hash string, info fs.FileInfo) error {
+	if info.IsDir() {
+		return &fs.PathError{Op: "addhash", Path: name, Err: errIsDir}
+	}
+	if !s.fileHasher(info).IsHash(hash) {
+		return &fs.PathError{Op: "addhash", Path: name, Err: fmt.Errorf("invalid hash %q", hash)}
+	}
+	return s.storeHash(name, hashEntry{
+		Hash:    hash,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	})
+}
+
+// forget removes the information about the file with the key that is kept in
+// addition to its hash in the cache.
+func (s *HashFS) forget(key string) {
+	s.store.remove(key)
+
+	s.verifiedMu.Lock()
+	delete(s.verified, key)
+	s.verifiedMu.Unlock()
+}
+
+// key returns the name of the file in the state that is shared between
+// HashFS and filesystems returned by its Sub method.
+func (s *HashFS) key(name string) string {
+	if s.prefix == "" {
+		return name
+	}
+	return path.Join(s.prefix, name)
+}
+
+// canonicalName returns the name of the file in the underlying filesystem and
+// its hash. Errors are returned as *fs.PathError with the op and the name.
+func (s *HashFS) canonicalName(op, name string) (canonicalName string, hash string, err error) {
+	d, f := filepath.Split(name)
+
+	f, hashFromName := splitHashedName(f, s.o.extensionDepth, s.hasher.IsHash)
+
 	canonicalName = d + f
 
 	hash, err = s.hash(canonicalName)
@@ -179,16 +537,25 @@ func (s *HashFS) canonicalName(name string) (canonicalName string, hash string,
 		if errors.Is(err, fs.ErrNotExist) {
 			hash, err = s.hash(name)
 			if err != nil {
-				return "", "", err
+				return "", "", &fs.PathError{Op: op, Path: name, Err: unwrapPathError(err)}
 			}
 		} else {
-			return "", "", err
+			return "", "", &fs.PathError{Op: op, Path: name, Err: unwrapPathError(err)}
 		}
 	}
 	if hashFromName != "" && hashFromName != hash {
+		canonicalHash := hash
 		hash, err = s.hash(name)
 		if err != nil {
-			return "", "", err
+			if !errors.Is(err, fs.ErrNotExist) || canonicalHash == "" {
+				return "", "", &fs.PathError{Op: op, Path: name, Err: unwrapPathError(err)}
+			}
+			if s.o.verifyOnOpen {
+				// The name contains the hash of the previous content of the
+				// file.
+				return "", "", &fs.PathError{Op: op, Path: name, Err: &HashedPathError{HashedPath: s.hashedPath(canonicalName, canonicalHash), Mismatch: true}}
+			}
+			return "", "", &fs.PathError{Op: op, Path: name, Err: ErrHashMismatch}
 		}
 		if hashFromName != hash {
 			return name, hash, nil
@@ -199,6 +566,81 @@ func (s *HashFS) canonicalName(name string) (canonicalName string, hash string,
 	return canonicalName, hash, nil
 }
 
+// unhashedAccessError returns the error for the access of the file by its
+// name without the hash, or nil if such access is allowed.
+func (s *HashFS) unhashedAccessError(op, name, hash string) error {
+	switch s.o.unhashedAccess {
+	case UnhashedAccessPermissive:
+		return nil
+	case UnhashedAccessRedirectInfo:
+		return &fs.PathError{Op: op, Path: name, Err: &HashedPathError{HashedPath: s.hashedPath(name, hash)}}
+	}
+	return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+}
+
+// verify computes the hash of the file again if the WithVerifyOnOpen option is
+// used and the size or the modification time of the file changed since its
+// hash was computed. It returns HashedPathError if the name contains the hash
+// that is no longer valid.
+func (s *HashFS) verify(op, name, canonicalName, hash string) error {
+	if !s.o.verifyOnOpen || hash == "" {
+		return nil
+	}
+	info, err := fs.Stat(s.fsys, canonicalName)
+	if err != nil {
+		return &fs.PathError{Op: op, Path: name, Err: unwrapPathError(err)}
+	}
+
+	s.verifiedMu.Lock()
+	e, ok := s.verified[s.key(canonicalName)]
+	s.verifiedMu.Unlock()
+	if ok && e.Size == info.Size() && e.ModTime.Equal(info.ModTime()) {
+		return nil
+	}
+
+	if err := s.Invalidate(canonicalName); err != nil {
+		return &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	newHash, err := s.hash(canonicalName)
+	if err != nil {
+		return &fs.PathError{Op: op, Path: name, Err: unwrapPathError(err)}
+	}
+	if canonicalName != name && newHash != hash {
+		return &fs.PathError{Op: op, Path: name, Err: &HashedPathError{HashedPath: s.hashedPath(canonicalName, newHash), Mismatch: true}}
+	}
+	return nil
+}
+
+// hashedEntries replaces names of file entries in the directory dir with their
+// hashed names.
+func (s *HashFS) hashedEntries(dir string, entries []fs.DirEntry) ([]fs.DirEntry, error) {
+	var n int
+	for _, e := range entries {
+		if e.IsDir() {
+			entries[n] = e
+			n++
+			continue
+		}
+		p := filepath.ToSlash(filepath.Join(dir, e.Name()))
+		if s.o.lazyDirHashing {
+			entries[n] = &lazyHashDirEntry{DirEntry: e, path: p, hashFS: s}
+			n++
+			continue
+		}
+		canonicalName, hash, err := s.canonicalName("readdir", p)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		name := s.hashedPath(filepath.Base(canonicalName), hash)
+		entries[n] = NewDirEntry(e, WithName(name))
+		n++
+	}
+	return entries[:n], nil
+}
+
 func (s *HashFS) hashedPath(name, hash string) string {
 	if hash == "" {
 		return name
@@ -206,110 +648,194 @@ func (s *HashFS) hashedPath(name, hash string) string {
 
 	d, f := filepath.Split(name)
 
-	i := strings.LastIndex(f, ".")
-	if i > 0 {
-		return d + f[:i] + "." + hash + f[i:]
+	return d + hashedName(f, hash, s.o.extensionDepth)
+}
+
+// hashedName inserts the hash into the file name before its last depth
+// extensions.
+func hashedName(name, hash string, depth int) string {
+	prefix, parts := splitNameParts(name)
+	k := depth
+	if k > len(parts)-1 {
+		k = len(parts) - 1
+	}
+	stem := strings.Join(parts[:len(parts)-k], ".")
+	if k == 0 {
+		return prefix + stem + "." + hash
+	}
+	return prefix + stem + "." + hash + "." + strings.Join(parts[len(parts)-k:], ".")
+}
+
+// splitHashedName returns the file name without the hash and the hash, if the
+// part of the name before its last depth extensions is a valid hash.
+// Otherwise, it returns the unchanged name and an empty hash.
+func splitHashedName(name string, depth int, isHash func(string) bool) (string, string) {
+	prefix, parts := splitNameParts(name)
+	if len(parts) < 2 {
+		return name, ""
+	}
+	k := depth
+	if k > len(parts)-2 {
+		k = len(parts) - 2
+	}
+	i := len(parts) - 1 - k
+	if !isHash(parts[i]) {
+		return name, ""
 	}
+	return prefix + strings.Join(append(parts[:i:i], parts[i+1:]...), "."), parts[i]
+}
 
-	return d + f + "." + hash
+// splitNameParts splits the file name into dot separated parts. The leading
+// dot of a hidden file name is returned as the prefix, so that it does not
+// separate an extension.
+func splitNameParts(name string) (prefix string, parts []string) {
+	if strings.HasPrefix(name, ".") {
+		prefix = "."
+		name = name[1:]
+	}
+	return prefix, strings.Split(name, ".")
 }
 
 func (s *HashFS) hash(name string) (string, error) {
-	s.hashesMu.RLock()
-	h, ok := s.hashes[name]
-	s.hashesMu.RUnlock()
+	key := s.key(name)
+	h, ok, err := s.cache.Get(key)
+	if err != nil {
+		return "", fmt.Errorf("hash cache get: %w", err)
+	}
 	if ok {
+		atomic.AddInt64(&s.counters.hits, 1)
 		return h, nil
 	}
+	atomic.AddInt64(&s.counters.misses, 1)
+	return s.hashing.do(key, func() (string, error) {
+		return s.hashFile(name)
+	})
+}
+
+// hashFile computes the hash of the file content, or looks it up in the hash
+// cache file, and stores it in the cache.
+func (s *HashFS) hashFile(name string) (string, error) {
+	s.invalidationsMu.RLock()
+	invalidations := s.invalidations
+	s.invalidationsMu.RUnlock()
 
 	fr, err := s.fsys.Open(name)
 	if err != nil {
-		return "", fmt.Errorf("open file: %w", err)
+		return "", err
 	}
 	defer fr.Close()
 
 	fi, err := fr.Stat()
 	if err != nil {
-		return "", fmt.Errorf("stat file: %w", err)
+		return "", err
 	}
 	if fi.IsDir() {
 		return "", nil // empty hash for directories
 	}
 
-	h, err = s.hasher.Hash(fr)
-	if err != nil {
-		return "", fmt.Errorf("hash file: %w", err)
+	e := hashEntry{
+		Size:    fi.Size(),
+		ModTime: fi.ModTime(),
+	}
+	if h, ok := s.store.lookup(s.key(name), e); ok {
+		e.Hash = h
+	} else {
+		e.Hash, err = hashFileContent(s.fileHasher(fi), fr, fi)
+		if err != nil {
+			return "", fmt.Errorf("hash file: %w", err)
+		}
 	}
 
-	s.hashesMu.Lock()
-	s.hashes[name] = h
-	s.hashesMu.Unlock()
-	return h, nil
-}
-
-var _ fs.DirEntry = (*dirEntry)(nil)
+	// The hash is not stored if a file is invalidated while it is computed,
+	// and Invalidate waits for the hash to be stored before it removes it.
+	s.invalidationsMu.RLock()
+	defer s.invalidationsMu.RUnlock()
 
-// Name-replacing dir entry.
-type dirEntry struct {
-	e    fs.DirEntry
-	name string
-}
-
-func (e *dirEntry) Name() string {
-	return e.name
+	if s.invalidations != invalidations {
+		return e.Hash, nil
+	}
+	if err := s.storeHash(name, e); err != nil {
+		return "", err
+	}
+	return e.Hash, nil
 }
 
-func (e *dirEntry) IsDir() bool {
-	return e.e.IsDir()
-}
+// storeHash stores the hash entry of the named file in the cache.
+func (s *HashFS) storeHash(name string, e hashEntry) error {
+	key := s.key(name)
+	s.store.add(key, e)
 
-func (e *dirEntry) Type() fs.FileMode {
-	return e.e.Type()
-}
+	if s.o.verifyOnOpen {
+		s.verifiedMu.Lock()
+		s.verified[key] = e
+		s.verifiedMu.Unlock()
+	}
 
-func (e *dirEntry) Info() (fs.FileInfo, error) {
-	i, err := e.e.Info()
-	if err != nil {
-		return nil, err
+	if err := s.cache.Set(key, e.Hash); err != nil {
+		return fmt.Errorf("hash cache set: %w", err)
 	}
-	return &fileInfo{i: i, name: e.name}, nil
+	return nil
 }
 
-var _ fs.FileInfo = (*fileInfo)(nil)
-
-// Name-replacing file info.
-type fileInfo struct {
-	i    fs.FileInfo
-	name string
+// fileHasher returns the hasher for the file with the provided info.
+func (s *HashFS) fileHasher(info fs.FileInfo) Hasher {
+	if s.o.largeFileHasher != nil && info.Size() > s.o.largeFileThreshold {
+		return s.o.largeFileHasher
+	}
+	return s.hasher
 }
 
-func (i *fileInfo) Name() string {
-	return i.name
+// hashEntry is the hash of a file with the size and modification time of the
+// file at the time when the hash was computed.
+type hashEntry struct {
+	Hash    string    `json:"hash"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
 }
 
-func (i *fileInfo) Size() int64 {
-	return i.i.Size()
-}
+// lazyHashDirEntry is the dir entry with the hashed name that is computed on
+// the first call of its Name or Info method.
+type lazyHashDirEntry struct {
+	fs.DirEntry
+	path   string
+	hashFS *HashFS
 
-func (i *fileInfo) Mode() fs.FileMode {
-	return i.i.Mode()
+	name string
+	err  error
+	once sync.Once
 }
 
-func (i *fileInfo) ModTime() time.Time {
-	return i.i.ModTime()
+func (e *lazyHashDirEntry) resolve() {
+	e.once.Do(func() {
+		canonicalName, hash, err := e.hashFS.canonicalName("readdir", e.path)
+		if err != nil {
+			e.name = e.DirEntry.Name()
+			e.err = err
+			return
+		}
+		e.name = e.hashFS.hashedPath(filepath.Base(canonicalName), hash)
+	})
 }
 
-func (i *fileInfo) IsDir() bool {
-	return i.i.IsDir()
+func (e *lazyHashDirEntry) Name() string {
+	e.resolve()
+	return e.name
 }
 
-func (i *fileInfo) Sys() interface{} {
-	return i.i.Sys()
+func (e *lazyHashDirEntry) Info() (fs.FileInfo, error) {
+	e.resolve()
+	if e.err != nil {
+		return nil, e.err
+	}
+	info, err := e.DirEntry.Info()
+	if err != nil {
+		return nil, err
+	}
+	return NewFileInfo(info, WithName(e.name)), nil
 }
 
 type hashFile struct {
-	name string
-	fs.File
+	wrappedFile
 	hashFS *HashFS
 
 	initialized bool
@@ -318,9 +844,8 @@ type hashFile struct {
 
 func newHashFile(name string, f fs.File, s *HashFS) *hashFile {
 	return &hashFile{
-		name:   name,
-		File:   f,
-		hashFS: s,
+		wrappedFile: wrappedFile{File: f, name: name},
+		hashFS:      s,
 	}
 }
 
@@ -354,38 +879,28 @@ func (f *hashFile) ReadDir(n int) ([]fs.DirEntry, error) {
 	}
 
 	if !f.isDir {
-		return nil, errors.New("not a directory")
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: errNotDir}
 	}
 
 	r, err := dir.ReadDir(n)
 	if err != nil {
 		return nil, err
 	}
-	var i int
-	for _, e := range r {
-		if e.IsDir() {
-			r[i] = e
-			i++
-			continue
-		}
-		canonicalName, hash, err := f.hashFS.canonicalName(filepath.ToSlash(filepath.Join(f.name, e.Name())))
-		if err != nil {
-			if errors.Is(err, fs.ErrNotExist) {
-				continue
-			}
-			return nil, err
-		}
-		name := f.hashFS.hashedPath(filepath.Base(canonicalName), hash)
-		r[i] = &dirEntry{e: e, name: name}
-		i++
-	}
-	return r[:i], nil
+	return f.hashFS.hashedEntries(f.name, r)
 }
 
-func (f *hashFile) Seek(offset int64, whence int) (int64, error) {
-	s, ok := f.File.(io.Seeker)
-	if !ok {
-		return 0, errors.New("hash file missing seek function")
+// WriteTo implements io.WriterTo interface. It uses the WriteTo method of
+// the underlying file, if it is implemented, or passes the underlying file to
+// io.Copy, so that the destination can read from it directly, as
+// *net.TCPConn does with sendfile for *os.File.
+func (f *hashFile) WriteTo(w io.Writer) (int64, error) {
+	if wt, ok := f.File.(io.WriterTo); ok {
+		return wt.WriteTo(w)
 	}
-	return s.Seek(offset, whence)
+	return io.Copy(w, f.File)
+}
+
+// RawFile returns the underlying *os.File, if there is one.
+func (f *hashFile) RawFile() *os.File {
+	return RawFile(f.File)
 }
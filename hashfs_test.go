@@ -17,7 +17,11 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"resenje.org/fsutil"
 )
@@ -54,10 +58,10 @@ func TestHashFS(t *testing.T) {
 	}
 	for i, e := range dirEntries {
 		if e.Name() == "main.css" {
-			dirEntries[i] = fsutil.NewDirEntry(e, "main.8559e1.css")
+			dirEntries[i] = fsutil.NewDirEntry(e, fsutil.WithName("main.8559e1.css"))
 		}
 		if e.Name() == "main.012345.css" {
-			dirEntries[i] = fsutil.NewDirEntry(e, "main.012345.847f70.css")
+			dirEntries[i] = fsutil.NewDirEntry(e, fsutil.WithName("main.012345.847f70.css"))
 		}
 	}
 	testReadDir(t, fsys, "assets", dirEntries, 0)
@@ -81,12 +85,12 @@ func TestHashFS(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	testStat(t, fsys, "assets/main.8559e1.css", fsutil.NewFileInfo(fileInfo, "main.8559e1.css"), 0)
+	testStat(t, fsys, "assets/main.8559e1.css", fsutil.NewFileInfo(fileInfo, fsutil.WithName("main.8559e1.css")), 0)
 	fileInfo, err = fs.Stat(assetsHashFS, "assets/main.012345.css")
 	if err != nil {
 		t.Fatal(err)
 	}
-	testStat(t, fsys, "assets/main.012345.847f70.css", fsutil.NewFileInfo(fileInfo, "main.012345.847f70.css"), 0)
+	testStat(t, fsys, "assets/main.012345.847f70.css", fsutil.NewFileInfo(fileInfo, fsutil.WithName("main.012345.847f70.css")), 0)
 	fileInfo, err = fs.Stat(assetsHashFS, "assets")
 	if err != nil {
 		t.Fatal(err)
@@ -107,6 +111,91 @@ func TestHashFS(t *testing.T) {
 	}
 }
 
+func TestHashFS_errors(t *testing.T) {
+	fsys := fsutil.NewHashFS(fstest.MapFS{
+		"assets/main.css": {Data: []byte("body{}")},
+	}, fsutil.NewMD5Hasher(6))
+
+	for _, tc := range []struct {
+		name string
+		op   string
+		err  error
+		call func(name string) error
+	}{
+		{
+			name: "assets/main.012345.css",
+			op:   "open",
+			err:  fsutil.ErrHashMismatch,
+			call: func(name string) error { _, err := fsys.Open(name); return err },
+		},
+		{
+			name: "assets/main.012345.css",
+			op:   "stat",
+			err:  fsutil.ErrHashMismatch,
+			call: func(name string) error { _, err := fsys.Stat(name); return err },
+		},
+		{
+			name: "assets/main.css",
+			op:   "readfile",
+			err:  fs.ErrNotExist,
+			call: func(name string) error { _, err := fsys.ReadFile(name); return err },
+		},
+		{
+			name: "assets/missing.css",
+			op:   "open",
+			err:  fs.ErrNotExist,
+			call: func(name string) error { _, err := fsys.Open(name); return err },
+		},
+		{
+			name: "missing",
+			op:   "readdir",
+			err:  fs.ErrNotExist,
+			call: func(name string) error { _, err := fsys.ReadDir(name); return err },
+		},
+	} {
+		t.Run(tc.op+" "+tc.name, func(t *testing.T) {
+			err := tc.call(tc.name)
+			if !errors.Is(err, tc.err) || !errors.Is(err, fs.ErrNotExist) {
+				t.Fatalf("got error %v, want %v", err, tc.err)
+			}
+			var e *fs.PathError
+			if !errors.As(err, &e) {
+				t.Fatalf("got error %T, want *fs.PathError", err)
+			}
+			if e.Op != tc.op || e.Path != tc.name {
+				t.Errorf("got op %q and path %q, want %q and %q", e.Op, e.Path, tc.op, tc.name)
+			}
+		})
+	}
+}
+
+func TestHashFS_File_Seek_notSeekable(t *testing.T) {
+	files := fstest.MapFS{
+		"assets/main.css": {Data: []byte("body{}")},
+	}
+	fsys := fsutil.NewHashFS(fsutil.FSFunc(func(name string) (fs.File, error) {
+		f, err := files.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		return struct{ fs.File }{f}, nil
+	}), fsutil.NewMD5Hasher(6))
+
+	name, err := fsys.HashedPath("assets/main.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := fsys.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err := f.(io.Seeker).Seek(0, io.SeekStart); !errors.Is(err, fsutil.ErrNotSeekable) {
+		t.Errorf("got error %v, want %v", err, fsutil.ErrNotSeekable)
+	}
+}
+
 func TestHashFS_File_ReadDir(t *testing.T) {
 	dir := t.TempDir()
 
@@ -208,3 +297,480 @@ func testHashedPath(t *testing.T, fsys *fsutil.HashFS, name, hashedName string)
 		t.Errorf("got hashed path %q, want %q", hashedPath, hashedName)
 	}
 }
+
+func TestHashFS_lazyDirHashing(t *testing.T) {
+	hasher := &countingHasher{Hasher: fsutil.NewMD5Hasher(6)}
+	fsys := fsutil.NewHashFS(assetsHashFS, hasher, fsutil.WithLazyDirHashing())
+
+	entries, err := fsys.ReadDir("assets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hasher.count(); got != 0 {
+		t.Errorf("got %v hashed files after ReadDir, want 0", got)
+	}
+
+	dirEntries, err := fs.ReadDir(assetsHashFS, "assets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, e := range dirEntries {
+		if e.Name() == "main.css" {
+			dirEntries[i] = fsutil.NewDirEntry(e, fsutil.WithName("main.8559e1.css"))
+		}
+		if e.Name() == "main.012345.css" {
+			dirEntries[i] = fsutil.NewDirEntry(e, fsutil.WithName("main.012345.847f70.css"))
+		}
+	}
+	testReadDir(t, fsys, "assets", dirEntries, 0)
+
+	info, err := entries[1].Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := info.Name(), entries[1].Name(); got != want {
+		t.Errorf("got info name %q, want %q", got, want)
+	}
+	if hasher.count() == 0 {
+		t.Error("files not hashed")
+	}
+
+	t.Run("sub", func(t *testing.T) {
+		hasher := &countingHasher{Hasher: fsutil.NewMD5Hasher(6)}
+		fsys := fsutil.NewHashFS(assetsHashFS, hasher, fsutil.WithLazyDirHashing())
+
+		sub, err := fs.Sub(fsys, "assets")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fs.ReadDir(sub, "."); err != nil {
+			t.Fatal(err)
+		}
+		if got := hasher.count(); got != 0 {
+			t.Errorf("got %v hashed files after ReadDir, want 0", got)
+		}
+	})
+}
+
+func TestHashFS_largeFileHasher(t *testing.T) {
+	modTime := time.Date(2021, 8, 9, 10, 11, 12, 0, time.UTC)
+	files := fsutil.MapFS{
+		"app.css":   {Data: []byte("body{}"), ModTime: modTime},
+		"video.mp4": {Data: bytes.Repeat([]byte("video"), 100), ModTime: modTime},
+	}
+	hasher := &countingHasher{Hasher: fsutil.NewMD5Hasher(8)}
+	largeFileHasher := fsutil.NewSamplingHasher(8, 16)
+	fsys := fsutil.NewHashFS(files, hasher, fsutil.WithLargeFileHasher(100, largeFileHasher))
+
+	info, err := fs.Stat(files, "video.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := largeFileHasher.HashFileInfo(bytes.NewReader(files["video.mp4"].Data), info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testHashedPath(t, fsys, "video.mp4", "video."+hash+".mp4")
+	if got := hasher.count(); got != 0 {
+		t.Errorf("got %v files hashed with the default hasher, want 0", got)
+	}
+	testOpen(t, fsys, "video."+hash+".mp4", string(files["video.mp4"].Data))
+
+	if _, err := fsys.HashedPath("app.css"); err != nil {
+		t.Fatal(err)
+	}
+	if got := hasher.count(); got != 1 {
+		t.Errorf("got %v files hashed with the default hasher, want 1", got)
+	}
+}
+
+func TestHashFS_concurrentHashing(t *testing.T) {
+	files := fsutil.MapFS{
+		"app.css": {Data: []byte("body{}")},
+	}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var once sync.Once
+	hasher := &countingHasher{Hasher: fsutil.NewMD5Hasher(8)}
+	fsys := fsutil.NewHashFS(fsutil.FSFunc(func(name string) (fs.File, error) {
+		f, err := files.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		if name == "app.css" {
+			// block hashing until all requests are made
+			once.Do(func() { close(started) })
+			<-release
+		}
+		return f, nil
+	}), hasher)
+
+	want, err := fsutil.NewHashFS(files, fsutil.NewMD5Hasher(8)).HashedPath("app.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const requests = 100
+	errs := make(chan error, requests)
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := fsys.HashedPath("app.css")
+			if err == nil && got != want {
+				err = fmt.Errorf("got hashed path %q, want %q", got, want)
+			}
+			errs <- err
+		}()
+	}
+
+	<-started
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if got := hasher.count(); got != 1 {
+		t.Errorf("got %v hash computations, want 1", got)
+	}
+}
+
+func TestHashFS_invalidateWhileHashing(t *testing.T) {
+	files := fsutil.MapFS{
+		"app.css": {Data: []byte("body{}")},
+	}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	first := make(chan struct{}, 1)
+	first <- struct{}{}
+	fsys := fsutil.NewHashFS(fsutil.FSFunc(func(name string) (fs.File, error) {
+		f, err := files.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		// block the first hashing until the file is changed
+		select {
+		case <-first:
+			close(started)
+			<-release
+		default:
+		}
+		return f, nil
+	}), fsutil.NewMD5Hasher(8))
+
+	oldPath := make(chan string, 1)
+	go func() {
+		p, err := fsys.HashedPath("app.css")
+		if err != nil {
+			t.Error(err)
+		}
+		oldPath <- p
+	}()
+
+	<-started
+	newFiles := fsutil.MapFS{
+		"app.css": {Data: []byte("body{color:red}")},
+	}
+	want, err := fsutil.NewHashFS(newFiles, fsutil.NewMD5Hasher(8)).HashedPath("app.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files["app.css"] = newFiles["app.css"]
+	if err := fsys.Invalidate("app.css"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The hashing that is in progress is not awaited after Invalidate.
+	newPath := make(chan string, 1)
+	go func() {
+		p, err := fsys.HashedPath("app.css")
+		if err != nil {
+			t.Error(err)
+		}
+		newPath <- p
+	}()
+	select {
+	case got := <-newPath:
+		if got != want {
+			t.Errorf("got hashed path %q, want %q", got, want)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout waiting for hashed path")
+	}
+
+	close(release)
+	<-oldPath
+
+	// The hash of the previous content is not stored.
+	testHashedPath(t, fsys, "app.css", want)
+}
+
+func TestHashFS_notExistCache(t *testing.T) {
+	files := fsutil.MapFS{
+		"app.css": {Data: []byte("body{}")},
+	}
+	var opens int
+	fsys := fsutil.NewHashFS(fsutil.FSFunc(func(name string) (fs.File, error) {
+		opens++
+		return files.Open(name)
+	}), fsutil.NewMD5Hasher(8), fsutil.WithHashNotExistCache(time.Hour))
+
+	if _, err := fsys.Open("wp-login.php"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("got error %v, want %v", err, fs.ErrNotExist)
+	}
+	n := opens
+	for i := 0; i < 3; i++ {
+		if _, err := fsys.Open("wp-login.php"); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("got error %v, want %v", err, fs.ErrNotExist)
+		}
+	}
+	if opens != n {
+		t.Errorf("got %v opens, want %v", opens, n)
+	}
+
+	files["wp-login.php"] = &fsutil.MapFile{Data: []byte("<?php")}
+	if err := fsys.Invalidate("wp-login.php"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.HashedPath("wp-login.php"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHashFS_unhashedAccessMode(t *testing.T) {
+	t.Run("strict", func(t *testing.T) {
+		fsys := fsutil.NewHashFS(assetsHashFS, fsutil.NewMD5Hasher(6), fsutil.WithUnhashedAccessMode(fsutil.UnhashedAccessStrict))
+
+		testOpenNotExist(t, fsys, "assets/main.css")
+		testReadFileNotExist(t, fsys, "assets/main.css")
+		testStatNotExist(t, fsys, "assets/main.css")
+	})
+
+	t.Run("permissive", func(t *testing.T) {
+		fsys := fsutil.NewHashFS(assetsHashFS, fsutil.NewMD5Hasher(6), fsutil.WithUnhashedAccessMode(fsutil.UnhashedAccessPermissive))
+
+		testOpen(t, fsys, "assets/main.css", "body { color: blue; }")
+		testOpen(t, fsys, "assets/main.8559e1.css", "body { color: blue; }")
+		testReadFile(t, fsys, "assets/main.css", "body { color: blue; }")
+		testReadFile(t, fsys, "assets/main.012345.css", "/* file with an invalid hash */")
+		fileInfo, err := fs.Stat(assetsHashFS, "assets/main.css")
+		if err != nil {
+			t.Fatal(err)
+		}
+		testStat(t, fsys, "assets/main.css", fileInfo, 0)
+		testOpenNotExist(t, fsys, "assets/main.012345.8559e1.css")
+	})
+
+	t.Run("redirect info", func(t *testing.T) {
+		fsys := fsutil.NewHashFS(assetsHashFS, fsutil.NewMD5Hasher(6), fsutil.WithUnhashedAccessMode(fsutil.UnhashedAccessRedirectInfo))
+
+		for name, want := range map[string]string{
+			"assets/main.css":        "assets/main.8559e1.css",
+			"assets/main.012345.css": "assets/main.012345.847f70.css",
+		} {
+			_, openErr := fsys.Open(name)
+			_, readFileErr := fsys.ReadFile(name)
+			_, statErr := fsys.Stat(name)
+			for _, err := range []error{openErr, readFileErr, statErr} {
+				if !errors.Is(err, fs.ErrNotExist) {
+					t.Errorf("%s: got error %v, want %v", name, err, fs.ErrNotExist)
+				}
+				var e *fsutil.HashedPathError
+				if !errors.As(err, &e) {
+					t.Fatalf("%s: got error %v, want hashed path error", name, err)
+				}
+				if e.HashedPath != want {
+					t.Errorf("%s: got hashed path %q, want %q", name, e.HashedPath, want)
+				}
+			}
+		}
+
+		testOpen(t, fsys, "assets/main.8559e1.css", "body { color: blue; }")
+	})
+}
+
+func TestHashFS_extensionDepth(t *testing.T) {
+	// The MD5 hash of "x" starts with 9dd4e4.
+	files := fsutil.MapFS{
+		".well-known/security.txt": {Data: []byte("x")},
+		".htaccess":                {Data: []byte("x")},
+		".eslintrc.json":           {Data: []byte("x")},
+		"LICENSE":                  {Data: []byte("x")},
+		"main.css":                 {Data: []byte("x")},
+		"jquery.min.js":            {Data: []byte("x")},
+		"app.v2.bundle.js":         {Data: []byte("x")},
+		"archive.tar.gz":           {Data: []byte("x")},
+	}
+
+	for _, tc := range []struct {
+		depth int
+		want  map[string]string
+	}{
+		{
+			depth: 0,
+			want: map[string]string{
+				".well-known/security.txt": ".well-known/security.txt.9dd4e4",
+				".htaccess":                ".htaccess.9dd4e4",
+				".eslintrc.json":           ".eslintrc.json.9dd4e4",
+				"LICENSE":                  "LICENSE.9dd4e4",
+				"main.css":                 "main.css.9dd4e4",
+				"jquery.min.js":            "jquery.min.js.9dd4e4",
+				"app.v2.bundle.js":         "app.v2.bundle.js.9dd4e4",
+				"archive.tar.gz":           "archive.tar.gz.9dd4e4",
+			},
+		},
+		{
+			depth: 1,
+			want: map[string]string{
+				".well-known/security.txt": ".well-known/security.9dd4e4.txt",
+				".htaccess":                ".htaccess.9dd4e4",
+				".eslintrc.json":           ".eslintrc.9dd4e4.json",
+				"LICENSE":                  "LICENSE.9dd4e4",
+				"main.css":                 "main.9dd4e4.css",
+				"jquery.min.js":            "jquery.min.9dd4e4.js",
+				"app.v2.bundle.js":         "app.v2.bundle.9dd4e4.js",
+				"archive.tar.gz":           "archive.tar.9dd4e4.gz",
+			},
+		},
+		{
+			depth: 2,
+			want: map[string]string{
+				".well-known/security.txt": ".well-known/security.9dd4e4.txt",
+				".htaccess":                ".htaccess.9dd4e4",
+				".eslintrc.json":           ".eslintrc.9dd4e4.json",
+				"LICENSE":                  "LICENSE.9dd4e4",
+				"main.css":                 "main.9dd4e4.css",
+				"jquery.min.js":            "jquery.9dd4e4.min.js",
+				"app.v2.bundle.js":         "app.v2.9dd4e4.bundle.js",
+				"archive.tar.gz":           "archive.9dd4e4.tar.gz",
+			},
+		},
+	} {
+		t.Run(fmt.Sprintf("depth %v", tc.depth), func(t *testing.T) {
+			fsys := fsutil.NewHashFS(files, fsutil.NewMD5Hasher(6), fsutil.WithHashExtensionDepth(tc.depth))
+
+			var hashedPaths []string
+			for name, want := range tc.want {
+				testHashedPath(t, fsys, name, want)
+				testHashedPath(t, fsys, want, want)
+				testOpen(t, fsys, want, "x")
+				testOpenNotExist(t, fsys, name)
+				if !strings.Contains(want, "/") {
+					hashedPaths = append(hashedPaths, want)
+				}
+			}
+			hashedPaths = append(hashedPaths, ".well-known")
+			sort.Strings(hashedPaths)
+			testGlob(t, fsys, "*", hashedPaths)
+		})
+	}
+}
+
+func TestHashFS_verifyOnOpen(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(t *testing.T, content string, modTime time.Time) {
+		t.Helper()
+		p := filepath.Join(dir, "app.css")
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	modTime := time.Date(2021, 8, 9, 10, 11, 12, 0, time.UTC)
+
+	t.Run("verify", func(t *testing.T) {
+		writeFile(t, "body{}", modTime)
+		fsys := fsutil.NewHashFS(os.DirFS(dir), fsutil.NewMD5Hasher(8), fsutil.WithVerifyOnOpen())
+
+		oldPath, err := fsys.HashedPath("app.css")
+		if err != nil {
+			t.Fatal(err)
+		}
+		testOpen(t, fsys, oldPath, "body{}")
+
+		// Changing only the modification time keeps the hashed name valid.
+		writeFile(t, "body{}", modTime.Add(time.Minute))
+		testOpen(t, fsys, oldPath, "body{}")
+
+		writeFile(t, "body{color:red}", modTime.Add(time.Hour))
+
+		newPath, err := fsys.HashedPath("app.css")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if newPath != oldPath {
+			t.Fatalf("got hashed path %q before open, want cached %q", newPath, oldPath)
+		}
+
+		_, openErr := fsys.Open(oldPath)
+		_, readFileErr := fsys.ReadFile(oldPath)
+		for _, err := range []error{openErr, readFileErr} {
+			if !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("got error %v, want %v", err, fs.ErrNotExist)
+			}
+			if !errors.Is(err, fsutil.ErrHashMismatch) {
+				t.Errorf("got error %v, want %v", err, fsutil.ErrHashMismatch)
+			}
+			var e *fsutil.HashedPathError
+			if !errors.As(err, &e) {
+				t.Fatalf("got error %v, want hashed path error", err)
+			}
+			if e.HashedPath == oldPath {
+				t.Errorf("got old hashed path %q", e.HashedPath)
+			}
+			newPath = e.HashedPath
+		}
+
+		testOpen(t, fsys, newPath, "body{color:red}")
+		testReadFile(t, fsys, newPath, "body{color:red}")
+		testHashedPath(t, fsys, "app.css", newPath)
+	})
+
+	t.Run("no verify", func(t *testing.T) {
+		writeFile(t, "body{}", modTime)
+		fsys := fsutil.NewHashFS(os.DirFS(dir), fsutil.NewMD5Hasher(8))
+
+		oldPath, err := fsys.HashedPath("app.css")
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeFile(t, "body{color:red}", modTime.Add(time.Hour))
+
+		testOpen(t, fsys, oldPath, "body{color:red}")
+	})
+}
+
+func TestHashFS_overlays(t *testing.T) {
+	base := fsutil.MapFS{
+		"css/app.css":   {Data: []byte("body{}")},
+		"css/reset.css": {Data: []byte("*{margin:0}")},
+	}
+	theme := fsutil.MapFS{
+		"css/app.css": {Data: []byte("body{color:red}")},
+	}
+	hasher := fsutil.NewMD5Hasher(8)
+	fsys := fsutil.NewHashFS(base, hasher, fsutil.WithHashOverlays(theme))
+
+	themeHashed, err := fsutil.NewHashFS(theme, hasher).HashedPath("css/app.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseHashed, err := fsutil.NewHashFS(base, hasher).HashedPath("css/reset.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testHashedPath(t, fsys, "css/app.css", themeHashed)
+	testHashedPath(t, fsys, "css/reset.css", baseHashed)
+	testReadFile(t, fsys, themeHashed, "body{color:red}")
+	testReadFile(t, fsys, baseHashed, "*{margin:0}")
+	testGlob(t, fsys, "css/*", []string{themeHashed, baseHashed})
+}
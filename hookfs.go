@@ -0,0 +1,152 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"io/fs"
+	"time"
+)
+
+var (
+	_ fs.FS         = (*HookFS)(nil)
+	_ fs.GlobFS     = (*HookFS)(nil)
+	_ fs.ReadDirFS  = (*HookFS)(nil)
+	_ fs.ReadFileFS = (*HookFS)(nil)
+	_ fs.StatFS     = (*HookFS)(nil)
+	_ fs.SubFS      = (*HookFS)(nil)
+	_ ReadLinkFS    = (*HookFS)(nil)
+)
+
+// HookFS is a filesystem that calls functions before and after every Open,
+// Glob, ReadDir, ReadFile, Stat, ReadLink and Lstat call to the underlying
+// filesystem. It can be used to build an audit trail of files that a plugin or
+// a template accessed, for example by constructing a HookFS for every request.
+// Reads from opened files are not reported.
+type HookFS struct {
+	fsys fs.FS
+	o    hookFSOptions
+}
+
+// HookEvent describes a completed filesystem operation.
+type HookEvent struct {
+	// Op is the name of the operation, one of "open", "glob", "readdir",
+	// "readfile", "stat", "readlink" and "lstat".
+	Op string
+	// Path is the name of the file or the pattern passed to Glob.
+	Path string
+	// Err is the error returned by the operation.
+	Err error
+	// Duration is the time that the operation took.
+	Duration time.Duration
+}
+
+// HookFSOption is used to provide optional parameters to NewHookFS function.
+type HookFSOption func(*hookFSOptions)
+
+type hookFSOptions struct {
+	before func(op, name string)
+	after  func(e HookEvent)
+}
+
+// WithHookBefore sets the function that is called before every operation with
+// its name and the path. The function must be safe for concurrent use.
+func WithHookBefore(before func(op, name string)) HookFSOption {
+	return func(o *hookFSOptions) {
+		o.before = before
+	}
+}
+
+// WithHookAfter sets the function that is called after every operation with
+// its result. The function must be safe for concurrent use.
+func WithHookAfter(after func(e HookEvent)) HookFSOption {
+	return func(o *hookFSOptions) {
+		o.after = after
+	}
+}
+
+// NewHookFS returns a new instance of HookFS.
+func NewHookFS(fsys fs.FS, opts ...HookFSOption) *HookFS {
+	var o hookFSOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &HookFS{
+		fsys: fsys,
+		o:    o,
+	}
+}
+
+// Open implements fs.FS interface.
+func (s *HookFS) Open(name string) (f fs.File, err error) {
+	defer s.hook("open", name)(&err)
+	return s.fsys.Open(name)
+}
+
+// Glob implements fs.GlobFS interface.
+func (s *HookFS) Glob(pattern string) (matches []string, err error) {
+	defer s.hook("glob", pattern)(&err)
+	return fs.Glob(s.fsys, pattern)
+}
+
+// ReadDir implements fs.ReadDirFS interface.
+func (s *HookFS) ReadDir(name string) (entries []fs.DirEntry, err error) {
+	defer s.hook("readdir", name)(&err)
+	return fs.ReadDir(s.fsys, name)
+}
+
+// ReadFile implements fs.ReadFileFS interface.
+func (s *HookFS) ReadFile(name string) (data []byte, err error) {
+	defer s.hook("readfile", name)(&err)
+	return fs.ReadFile(s.fsys, name)
+}
+
+// Stat implements fs.StatFS interface.
+func (s *HookFS) Stat(name string) (info fs.FileInfo, err error) {
+	defer s.hook("stat", name)(&err)
+	return fs.Stat(s.fsys, name)
+}
+
+// ReadLink implements ReadLinkFS interface.
+func (s *HookFS) ReadLink(name string) (target string, err error) {
+	defer s.hook("readlink", name)(&err)
+	return ReadLink(s.fsys, name)
+}
+
+// Lstat implements ReadLinkFS interface.
+func (s *HookFS) Lstat(name string) (info fs.FileInfo, err error) {
+	defer s.hook("lstat", name)(&err)
+	return Lstat(s.fsys, name)
+}
+
+// Sub implements fs.SubFS interface.
+func (s *HookFS) Sub(dir string) (fs.FS, error) {
+	return newSubFS(s, dir)
+}
+
+// Unwrap returns the underlying filesystem.
+func (s *HookFS) Unwrap() fs.FS {
+	return s.fsys
+}
+
+// hook calls the before function and returns the function that calls the
+// after function with the error that the operation returned.
+func (s *HookFS) hook(op, name string) func(err *error) {
+	if s.o.before != nil {
+		s.o.before(op, name)
+	}
+	start := time.Now()
+	return func(err *error) {
+		if s.o.after == nil {
+			return
+		}
+		s.o.after(HookEvent{
+			Op:       op,
+			Path:     name,
+			Err:      *err,
+			Duration: time.Since(start),
+		})
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"resenje.org/fsutil"
+)
+
+func TestHookFS(t *testing.T) {
+	files := fsutil.MapFS{
+		"index.html":      {Data: []byte("<html>")},
+		"partials/a.html": {Data: []byte("a")},
+	}
+
+	var (
+		before []string
+		events []fsutil.HookEvent
+		mu     sync.Mutex
+	)
+	fsys := fsutil.NewHookFS(files,
+		fsutil.WithHookBefore(func(op, name string) {
+			mu.Lock()
+			defer mu.Unlock()
+			before = append(before, op+" "+name)
+		}),
+		fsutil.WithHookAfter(func(e fsutil.HookEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, e)
+		}),
+	)
+
+	if err := fstest.TestFS(fsys, "index.html", "partials/a.html"); err != nil {
+		t.Fatal(err)
+	}
+	before, events = nil, nil
+
+	testOpen(t, fsys, "index.html", "<html>")
+	testReadFile(t, fsys, "partials/a.html", "a")
+	testStatNotExist(t, fsys, "missing.html")
+	testGlob(t, fsys, "partials/*", []string{"partials/a.html"})
+
+	sub, err := fs.Sub(fsys, "partials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.ReadDir(sub, "."); err != nil {
+		t.Fatal(err)
+	}
+
+	wantOps := []string{
+		"open index.html",
+		"readfile partials/a.html",
+		"stat missing.html",
+		"glob partials/*",
+		"readdir partials",
+	}
+	if fmt.Sprint(before) != fmt.Sprint(wantOps) {
+		t.Errorf("got before hooks %v, want %v", before, wantOps)
+	}
+	if len(events) != len(wantOps) {
+		t.Fatalf("got %v events, want %v", len(events), len(wantOps))
+	}
+	for i, e := range events {
+		if got := e.Op + " " + e.Path; got != wantOps[i] {
+			t.Errorf("got event %q, want %q", got, wantOps[i])
+		}
+		if e.Duration < 0 {
+			t.Errorf("got negative duration %v for event %q", e.Duration, wantOps[i])
+		}
+		wantErr := e.Op == "stat"
+		if gotErr := errors.Is(e.Err, fs.ErrNotExist); gotErr != wantErr {
+			t.Errorf("got error %v for event %q", e.Err, wantOps[i])
+		}
+	}
+}
+
+func TestHookFS_noHooks(t *testing.T) {
+	files := fsutil.MapFS{
+		"index.html": {Data: []byte("<html>")},
+	}
+	fsys := fsutil.NewHookFS(files)
+
+	testOpen(t, fsys, "index.html", "<html>")
+	testReadFile(t, fsys, "index.html", "<html>")
+	testOpenNotExist(t, fsys, "missing.html")
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+)
+
+var (
+	_ http.FileSystem = (*httpFileSystem)(nil)
+	_ http.File       = (*httpFile)(nil)
+	_ fs.FS           = (*fromHTTPFileSystem)(nil)
+	_ fs.ReadDirFile  = (*fromHTTPFile)(nil)
+	_ io.Seeker       = (*fromHTTPFile)(nil)
+)
+
+// ToHTTPFileSystem converts a filesystem to http.FileSystem. Unlike http.FS,
+// opened files always support seeking, even if the files of the filesystem do
+// not implement io.Seeker, as the filesystem is wrapped with SeekableFS with
+// the provided options. Directories are listed with the Readdir method if the
+// directory implements fs.ReadDirFile.
+func ToHTTPFileSystem(fsys fs.FS, opts ...SeekableFSOption) http.FileSystem {
+	return &httpFileSystem{fsys: SeekableFS(fsys, opts...)}
+}
+
+type httpFileSystem struct {
+	fsys fs.FS
+}
+
+func (s *httpFileSystem) Open(name string) (http.File, error) {
+	if strings.HasPrefix(name, "/") {
+		name = name[1:]
+	}
+	name = path.Clean("/" + name)[1:]
+	if name == "" {
+		name = "."
+	}
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &httpFile{
+		File: f,
+		name: name,
+	}, nil
+}
+
+// httpFile implements http.File for the file from SeekableFS.
+type httpFile struct {
+	fs.File
+	name string
+}
+
+func (f *httpFile) Seek(offset int64, whence int) (int64, error) {
+	s, ok := f.File.(io.Seeker)
+	if !ok {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: errIsDir}
+	}
+	return s.Seek(offset, whence)
+}
+
+func (f *httpFile) Readdir(count int) ([]fs.FileInfo, error) {
+	d, ok := f.File.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: errNotDir}
+	}
+	entries, err := d.ReadDir(count)
+	infos := make([]fs.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			return infos, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, err
+}
+
+// FromHTTPFileSystem converts http.FileSystem to a filesystem, so that the
+// implementations of http.FileSystem can be used with functions that accept
+// fs.FS. Opened directories implement fs.ReadDirFile using the Readdir method
+// and all opened files implement io.Seeker.
+func FromHTTPFileSystem(hfs http.FileSystem) fs.FS {
+	return &fromHTTPFileSystem{hfs: hfs}
+}
+
+type fromHTTPFileSystem struct {
+	hfs http.FileSystem
+}
+
+func (s *fromHTTPFileSystem) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	hname := "/" + name
+	if name == "." {
+		hname = "/"
+	}
+	f, err := s.hfs.Open(hname)
+	if err != nil {
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: pathErr.Err}
+		}
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &fromHTTPFile{
+		File: f,
+		name: name,
+	}, nil
+}
+
+// fromHTTPFile implements fs.ReadDirFile for http.File.
+type fromHTTPFile struct {
+	http.File
+	name string
+}
+
+func (f *fromHTTPFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	infos, err := f.File.Readdir(n)
+	entries := make([]fs.DirEntry, 0, len(infos))
+	for _, info := range infos {
+		entries = append(entries, httpDirEntry{FileInfo: info})
+	}
+	if err != nil {
+		var pathErr *fs.PathError
+		if !errors.Is(err, io.EOF) && !errors.As(err, &pathErr) {
+			err = &fs.PathError{Op: "readdir", Path: f.name, Err: err}
+		}
+	}
+	return entries, err
+}
+
+// httpDirEntry implements fs.DirEntry for the file info returned by the
+// Readdir method of http.File.
+type httpDirEntry struct {
+	fs.FileInfo
+}
+
+func (e httpDirEntry) Type() fs.FileMode          { return e.FileInfo.Mode().Type() }
+func (e httpDirEntry) Info() (fs.FileInfo, error) { return e.FileInfo, nil }
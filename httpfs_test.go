@@ -0,0 +1,136 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"testing"
+	"testing/fstest"
+
+	"resenje.org/fsutil"
+)
+
+func TestToHTTPFileSystem(t *testing.T) {
+	files := fsutil.MapFS{
+		"index.html":  {Data: []byte("<html>")},
+		"css/app.css": {Data: []byte("body{}")},
+	}
+	// Hide io.Seeker from regular files to require buffering.
+	fsys := fsutil.FSFunc(func(name string) (fs.File, error) {
+		f, err := files.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := f.(fs.ReadDirFile); ok {
+			return f, nil
+		}
+		return struct{ fs.File }{f}, nil
+	})
+	hfs := fsutil.ToHTTPFileSystem(fsys)
+
+	t.Run("seek", func(t *testing.T) {
+		f, err := hfs.Open("/css/app.css")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		b := make([]byte, 2)
+		if _, err := io.ReadFull(f, b); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(b), "bo"; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+		offset, err := f.Seek(1, io.SeekCurrent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if offset != 3 {
+			t.Errorf("got offset %v, want %v", offset, 3)
+		}
+		rest, err := io.ReadAll(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(rest), "y{}"; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("readdir", func(t *testing.T) {
+		f, err := hfs.Open("/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		infos, err := f.Readdir(-1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, info := range infos {
+			names = append(names, info.Name())
+		}
+		sort.Strings(names)
+		if len(names) != 2 || names[0] != "css" || names[1] != "index.html" {
+			t.Errorf("got names %v, want [css index.html]", names)
+		}
+	})
+
+	t.Run("not exist", func(t *testing.T) {
+		if _, err := hfs.Open("/missing.html"); !os.IsNotExist(err) {
+			t.Errorf("got error %v, want not exist", err)
+		}
+	})
+
+	t.Run("file server range", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/css/app.css", nil)
+		r.Header.Set("Range", "bytes=2-3")
+		w := httptest.NewRecorder()
+		http.FileServer(hfs).ServeHTTP(w, r)
+
+		if w.Code != http.StatusPartialContent {
+			t.Fatalf("got status %v, want %v", w.Code, http.StatusPartialContent)
+		}
+		if got, want := w.Body.String(), "dy"; got != want {
+			t.Errorf("got body %q, want %q", got, want)
+		}
+	})
+}
+
+func TestFromHTTPFileSystem(t *testing.T) {
+	fsys := fsutil.FromHTTPFileSystem(fsutil.ToHTTPFileSystem(fsutil.MapFS{
+		"index.html":  {Data: []byte("<html>")},
+		"css/app.css": {Data: []byte("body{}")},
+	}))
+
+	if err := fstest.TestFS(fsys, "index.html", "css/app.css"); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := fs.ReadFile(fsys, "css/app.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(content), "body{}"; got != want {
+		t.Errorf("got content %q, want %q", got, want)
+	}
+
+	if _, err := fsys.Open("missing.html"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got error %v, want %v", err, fs.ErrNotExist)
+	}
+	if _, err := fsys.Open("/index.html"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("got error %v, want %v", err, fs.ErrInvalid)
+	}
+}
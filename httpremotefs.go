@@ -0,0 +1,293 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var (
+	_ fs.FS         = (*HTTPRemoteFS)(nil)
+	_ fs.ReadDirFS  = (*HTTPRemoteFS)(nil)
+	_ fs.ReadFileFS = (*HTTPRemoteFS)(nil)
+	_ fs.StatFS     = (*HTTPRemoteFS)(nil)
+	_ OpenContextFS = (*HTTPRemoteFS)(nil)
+	_ StatContextFS = (*HTTPRemoteFS)(nil)
+)
+
+// HTTPStatusError is returned by HTTPRemoteFS when the server responds with an
+// unexpected HTTP status code. It matches fs.ErrNotExist for 404 Not Found and
+// 410 Gone responses and fs.ErrPermission for 401 Unauthorized and 403
+// Forbidden responses.
+type HTTPStatusError struct {
+	StatusCode int
+}
+
+// Error implements error interface.
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("http status %v %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Is reports whether the status code corresponds to the target error.
+func (e *HTTPStatusError) Is(target error) bool {
+	switch target {
+	case fs.ErrNotExist:
+		return e.StatusCode == http.StatusNotFound || e.StatusCode == http.StatusGone
+	case fs.ErrPermission:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	}
+	return false
+}
+
+// HTTPRemoteFS is a read-only filesystem with files served by an HTTP server.
+// Files are retrieved with GET requests and their info with HEAD requests,
+// using Content-Length and Last-Modified response headers. The content of an
+// opened file is read into memory, so that the file implements io.Seeker.
+//
+// Directories are supported only if the directory index is configured with
+// the WithHTTPIndex option. Without it, only the root directory exists and it
+// has no entries.
+type HTTPRemoteFS struct {
+	baseURL *url.URL
+	client  *http.Client
+	o       httpRemoteFSOptions
+}
+
+// HTTPRemoteFSOption is used to provide optional parameters to NewHTTPRemoteFS
+// function.
+type HTTPRemoteFSOption func(*httpRemoteFSOptions)
+
+type httpRemoteFSOptions struct {
+	index string
+}
+
+// WithHTTPIndex sets the name of the file in every directory that the server
+// responds with a JSON encoded list of directory entries, for example:
+//
+//	[{"name":"app.css","size":1024,"modTime":"2021-04-20T10:00:00Z"},{"name":"img","dir":true}]
+func WithHTTPIndex(name string) HTTPRemoteFSOption {
+	return func(o *httpRemoteFSOptions) {
+		o.index = name
+	}
+}
+
+// HTTPIndexEntry is a directory entry in the index response.
+type HTTPIndexEntry struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size,omitempty"`
+	ModTime time.Time `json:"modTime,omitempty"`
+	Dir     bool      `json:"dir,omitempty"`
+}
+
+// NewHTTPRemoteFS returns a new instance of HTTPRemoteFS that requests files
+// relative to the base URL. If client is nil, http.DefaultClient is used.
+func NewHTTPRemoteFS(baseURL string, client *http.Client, opts ...HTTPRemoteFSOption) (*HTTPRemoteFS, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse base url: %w", err)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	var o httpRemoteFSOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &HTTPRemoteFS{
+		baseURL: u,
+		client:  client,
+		o:       o,
+	}, nil
+}
+
+// Open implements fs.FS interface.
+func (s *HTTPRemoteFS) Open(name string) (fs.File, error) {
+	return s.OpenContext(context.Background(), name)
+}
+
+// OpenContext implements OpenContextFS interface.
+func (s *HTTPRemoteFS) OpenContext(ctx context.Context, name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if name != "." {
+		data, info, err := s.get(ctx, name)
+		if err == nil {
+			return newMemFile(name, info, data), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) || s.o.index == "" {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+	entries, err := s.readDir(ctx, name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return newMemDir(name, httpRemoteDirInfo(name), entries), nil
+}
+
+// ReadDir implements fs.ReadDirFS interface.
+func (s *HTTPRemoteFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	entries, err := s.readDir(context.Background(), name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	return entries, nil
+}
+
+// ReadFile implements fs.ReadFileFS interface.
+func (s *HTTPRemoteFS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: errIsDir}
+	}
+	data, _, err := s.get(context.Background(), name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: err}
+	}
+	return data, nil
+}
+
+// Stat implements fs.StatFS interface.
+func (s *HTTPRemoteFS) Stat(name string) (fs.FileInfo, error) {
+	return s.StatContext(context.Background(), name)
+}
+
+// StatContext implements StatContextFS interface.
+func (s *HTTPRemoteFS) StatContext(ctx context.Context, name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return httpRemoteDirInfo(name), nil
+	}
+	resp, err := s.do(ctx, http.MethodHead, name)
+	if err == nil {
+		resp.Body.Close()
+		return httpRemoteFileInfo(name, resp), nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) || s.o.index == "" {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	if _, err := s.readDir(ctx, name); err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return httpRemoteDirInfo(name), nil
+}
+
+// get returns the content and the info of the named file.
+func (s *HTTPRemoteFS) get(ctx context.Context, name string) ([]byte, *memFileInfo, error) {
+	resp, err := s.do(ctx, http.MethodGet, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	info := httpRemoteFileInfo(name, resp)
+	info.size = int64(len(data))
+	return data, info, nil
+}
+
+// readDir returns sorted entries of the named directory from the index.
+// Without the index, only the root directory exists and it is empty.
+func (s *HTTPRemoteFS) readDir(ctx context.Context, name string) ([]fs.DirEntry, error) {
+	if s.o.index == "" {
+		if name == "." {
+			return nil, nil
+		}
+		return nil, fs.ErrNotExist
+	}
+	resp, err := s.do(ctx, http.MethodGet, path.Join(name, s.o.index))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var index []HTTPIndexEntry
+	if err := json.NewDecoder(resp.Body).Decode(&index); err != nil {
+		return nil, fmt.Errorf("decode index: %w", err)
+	}
+	entries := make([]fs.DirEntry, 0, len(index))
+	for _, e := range index {
+		info := &memFileInfo{
+			name:    e.Name,
+			size:    e.Size,
+			mode:    0o444,
+			modTime: e.ModTime,
+		}
+		if e.Dir {
+			info.mode = fs.ModeDir | 0o555
+		}
+		entries = append(entries, info)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// do sends the request for the named file and returns the response if its
+// status code is 200 OK, otherwise the HTTPStatusError is returned.
+func (s *HTTPRemoteFS) do(ctx context.Context, method, name string) (*http.Response, error) {
+	u := *s.baseURL
+	u.Path = path.Join("/", u.Path, name)
+	u.RawPath = ""
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &HTTPStatusError{StatusCode: resp.StatusCode}
+	}
+	return resp, nil
+}
+
+func httpRemoteFileInfo(name string, resp *http.Response) *memFileInfo {
+	info := &memFileInfo{
+		name: path.Base(name),
+		mode: 0o444,
+	}
+	if n, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64); err == nil {
+		info.size = n
+	}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.modTime = t
+	}
+	return info
+}
+
+func httpRemoteDirInfo(name string) *memFileInfo {
+	return &memFileInfo{
+		name: path.Base(name),
+		mode: fs.ModeDir | 0o555,
+	}
+}
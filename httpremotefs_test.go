@@ -0,0 +1,112 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestHTTPRemoteFS(t *testing.T) {
+	modTime := time.Date(2021, 4, 20, 10, 0, 0, 0, time.UTC)
+	files := map[string]string{
+		"/assets/index.html":  "<html>",
+		"/assets/css/app.css": "body{}",
+		"/assets/secret.txt":  "",
+	}
+	index := map[string][]fsutil.HTTPIndexEntry{
+		"/assets/index.json":     {{Name: "index.html", Size: 6, ModTime: modTime}, {Name: "css", Dir: true}},
+		"/assets/css/index.json": {{Name: "app.css", Size: 6, ModTime: modTime}},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/assets/secret.txt" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if entries, ok := index[r.URL.Path]; ok {
+			_ = json.NewEncoder(w).Encode(entries)
+			return
+		}
+		data, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, r.URL.Path, modTime, strings.NewReader(data))
+	}))
+	defer server.Close()
+
+	t.Run("without index", func(t *testing.T) {
+		fsys, err := fsutil.NewHTTPRemoteFS(server.URL+"/assets", server.Client())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		testOpen(t, fsys, "index.html", "<html>")
+		testOpen(t, fsys, "css/app.css", "body{}")
+		testReadFile(t, fsys, "index.html", "<html>")
+		testOpenNotExist(t, fsys, "missing.html")
+		testOpenNotExist(t, fsys, "css")
+
+		info, err := fsys.Stat("index.html")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() != 6 || !info.ModTime().Equal(modTime) || info.Mode() != 0o444 {
+			t.Errorf("got size %v mod time %v mode %v, want size %v mod time %v mode %v", info.Size(), info.ModTime(), info.Mode(), 6, modTime, fs.FileMode(0o444))
+		}
+
+		if _, err := fsys.Open("secret.txt"); !errors.Is(err, fs.ErrPermission) {
+			t.Errorf("got error %v, want %v", err, fs.ErrPermission)
+		}
+
+		entries, err := fs.ReadDir(fsys, ".")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 0 {
+			t.Errorf("got %v root entries, want none", len(entries))
+		}
+	})
+
+	t.Run("with index", func(t *testing.T) {
+		fsys, err := fsutil.NewHTTPRemoteFS(server.URL+"/assets", server.Client(), fsutil.WithHTTPIndex("index.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := fstest.TestFS(fsys, "index.html", "css/app.css"); err != nil {
+			t.Fatal(err)
+		}
+
+		entries, err := fsys.ReadDir("css")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 || entries[0].Name() != "app.css" {
+			t.Errorf("got entries %v, want [app.css]", entries)
+		}
+		testReadDirNotExist(t, fsys, "missing")
+
+		info, err := fsys.Stat("css")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.IsDir() {
+			t.Errorf("got stat of non-directory, want directory")
+		}
+	})
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.23
+// +build go1.23
+
+package fsutil
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"iter"
+	"path"
+)
+
+// entriesBatchSize is the number of directory entries that Entries reads at
+// once.
+const entriesBatchSize = 256
+
+// Entries returns an iterator over entries of the named directory. Entries are
+// read in batches with the ReadDir method of the opened directory, so that
+// large directories are not read into memory at once. This is efficient with
+// directories of BackupFS and HashFS, which read their entries in batches from
+// the underlying filesystems. Entries are in the order in which the directory
+// returns them, which may not be sorted. If the directory does not implement
+// fs.ReadDirFile, fs.ReadDir is used. If an error occurs, it is yielded with a
+// nil entry and the iteration stops.
+func Entries(fsys fs.FS, dir string) iter.Seq2[fs.DirEntry, error] {
+	return func(yield func(fs.DirEntry, error) bool) {
+		entries(fsys, dir, yield)
+	}
+}
+
+// entries yields entries of the directory and reports whether the iteration
+// should continue.
+func entries(fsys fs.FS, dir string, yield func(fs.DirEntry, error) bool) bool {
+	f, err := fsys.Open(dir)
+	if err != nil {
+		return yield(nil, err)
+	}
+	defer f.Close()
+
+	d, ok := f.(fs.ReadDirFile)
+	if !ok {
+		entries, err := fs.ReadDir(fsys, dir)
+		if err != nil {
+			return yield(nil, err)
+		}
+		for _, e := range entries {
+			if !yield(e, nil) {
+				return false
+			}
+		}
+		return true
+	}
+
+	for {
+		entries, err := d.ReadDir(entriesBatchSize)
+		for _, e := range entries {
+			if !yield(e, nil) {
+				return false
+			}
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return true
+			}
+			return yield(nil, &fs.PathError{Op: "readdir", Path: dir, Err: unwrapPathError(err)})
+		}
+		// An empty batch without an error is not the end of the directory,
+		// as wrappers, such as HashFS, may omit all entries of a batch.
+	}
+}
+
+// Paths returns an iterator over paths of all files in the filesystem that
+// are not directories. Directories are read with Entries, so the paths are in
+// the order in which directories return their entries, with files in
+// subdirectories yielded before the rest of the parent directory entries. If
+// an error occurs, it is yielded with an empty path and the iteration stops.
+func Paths(fsys fs.FS) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		paths(fsys, ".", yield)
+	}
+}
+
+// paths yields paths of files in the directory and its subdirectories and
+// reports whether the iteration should continue.
+func paths(fsys fs.FS, dir string, yield func(string, error) bool) bool {
+	var failed bool
+	cont := entries(fsys, dir, func(e fs.DirEntry, err error) bool {
+		if err != nil {
+			failed = true
+			return yield("", err)
+		}
+		p := path.Join(dir, e.Name())
+		if e.IsDir() {
+			return paths(fsys, p, yield)
+		}
+		return yield(p, nil)
+	})
+	return cont && !failed
+}
@@ -0,0 +1,223 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.23
+// +build go1.23
+
+package fsutil_test
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestEntries(t *testing.T) {
+	files := make(fstest.MapFS)
+	var want []string
+	for i := 0; i < 600; i++ {
+		name := fmt.Sprintf("file-%03d.txt", i)
+		files["dir/"+name] = &fstest.MapFile{Data: []byte(name)}
+		want = append(want, name)
+	}
+
+	backupFS, err := fsutil.NewBackupFS(files, filepath.Join(t.TempDir(), "backup"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		fsys fs.FS
+		want []string
+	}{
+		{
+			name: "map",
+			fsys: files,
+			want: want,
+		},
+		{
+			name: "backup",
+			fsys: backupFS,
+			want: want,
+		},
+		{
+			name: "hash",
+			fsys: fsutil.NewHashFS(files, fsutil.NewMD5Hasher(8)),
+			want: hashedNames(t, files, want),
+		},
+		{
+			name: "without read dir file",
+			fsys: noReadDirFileFS{files},
+			want: want,
+		},
+		{
+			name: "empty batch",
+			fsys: emptyBatchFS{files},
+			want: want,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			for e, err := range fsutil.Entries(tc.fsys, "dir") {
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, e.Name())
+			}
+			sort.Strings(got)
+			if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Errorf("got %v entries, want %v", len(got), len(tc.want))
+			}
+		})
+	}
+
+	t.Run("break", func(t *testing.T) {
+		var n int
+		for range fsutil.Entries(files, "dir") {
+			n++
+			if n == 10 {
+				break
+			}
+		}
+		if n != 10 {
+			t.Errorf("got %v entries, want 10", n)
+		}
+	})
+
+	t.Run("not exist", func(t *testing.T) {
+		var errs []error
+		for e, err := range fsutil.Entries(files, "missing") {
+			if e != nil {
+				t.Errorf("got entry %v", e.Name())
+			}
+			errs = append(errs, err)
+		}
+		if len(errs) != 1 || !errors.Is(errs[0], fs.ErrNotExist) {
+			t.Errorf("got errors %v, want %v", errs, fs.ErrNotExist)
+		}
+	})
+}
+
+func TestPaths(t *testing.T) {
+	files := fstest.MapFS{
+		"index.html":           {Data: []byte("<html>")},
+		"assets/main.css":      {Data: []byte("body{}")},
+		"assets/vendor/lib.js": {Data: []byte("lib")},
+		"empty":                {Mode: fs.ModeDir},
+	}
+
+	var got []string
+	for p, err := range fsutil.Paths(files) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, p)
+	}
+	sort.Strings(got)
+	want := []string{"assets/main.css", "assets/vendor/lib.js", "index.html"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	t.Run("break", func(t *testing.T) {
+		var n int
+		for range fsutil.Paths(files) {
+			n++
+			break
+		}
+		if n != 1 {
+			t.Errorf("got %v paths, want 1", n)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		fsys := fsutil.FSFunc(func(name string) (fs.File, error) {
+			if name == "assets/vendor" {
+				return nil, &fs.PathError{Op: "open", Path: name, Err: errTest1}
+			}
+			return files.Open(name)
+		})
+
+		var errs []error
+		for _, err := range fsutil.Paths(fsys) {
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if len(errs) != 1 || !errors.Is(errs[0], errTest1) {
+			t.Errorf("got errors %v, want %v", errs, errTest1)
+		}
+	})
+}
+
+// noReadDirFileFS implements fs.ReadDirFS with directories that do not
+// implement fs.ReadDirFile.
+type noReadDirFileFS struct {
+	fstest.MapFS
+}
+
+func (s noReadDirFileFS) Open(name string) (fs.File, error) {
+	f, err := s.MapFS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return struct{ fs.File }{f}, nil
+}
+
+// emptyBatchFS returns directories that read an empty batch of entries
+// without an error before the entries of the underlying directory.
+type emptyBatchFS struct {
+	fstest.MapFS
+}
+
+func (s emptyBatchFS) Open(name string) (fs.File, error) {
+	f, err := s.MapFS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if d, ok := f.(fs.ReadDirFile); ok {
+		return &emptyBatchDir{ReadDirFile: d}, nil
+	}
+	return f, nil
+}
+
+type emptyBatchDir struct {
+	fs.ReadDirFile
+	read bool
+}
+
+func (d *emptyBatchDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		d.read = true
+		return nil, nil
+	}
+	return d.ReadDirFile.ReadDir(n)
+}
+
+// hashedNames returns base names of hashed paths of files in the dir
+// directory.
+func hashedNames(t *testing.T, fsys fs.FS, names []string) []string {
+	t.Helper()
+
+	hfs := fsutil.NewHashFS(fsys, fsutil.NewMD5Hasher(8))
+	hashed := make([]string, 0, len(names))
+	for _, name := range names {
+		p, err := hfs.HashedPath("dir/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashed = append(hashed, filepath.Base(p))
+	}
+	sort.Strings(hashed)
+	return hashed
+}
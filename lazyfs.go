@@ -0,0 +1,167 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"errors"
+	"io/fs"
+	"sync"
+	"time"
+)
+
+var (
+	_ fs.FS         = (*lazyFS)(nil)
+	_ fs.GlobFS     = (*lazyFS)(nil)
+	_ fs.ReadDirFS  = (*lazyFS)(nil)
+	_ fs.ReadFileFS = (*lazyFS)(nil)
+	_ fs.StatFS     = (*lazyFS)(nil)
+	_ fs.SubFS      = (*lazyFS)(nil)
+	_ ReadLinkFS    = (*lazyFS)(nil)
+)
+
+// LazyFSOption is used to provide optional parameters to LazyFS function.
+type LazyFSOption func(*lazyFSOptions)
+
+type lazyFSOptions struct {
+	retryAfter time.Duration
+}
+
+// WithLazyRetryAfter sets the duration after which the initialization of the
+// filesystem is attempted again if it returned an error. By default, the error
+// is returned for all calls and the initialization is never retried.
+func WithLazyRetryAfter(d time.Duration) LazyFSOption {
+	return func(o *lazyFSOptions) {
+		o.retryAfter = d
+	}
+}
+
+// LazyFS returns a filesystem that calls the init function to construct the
+// underlying filesystem on the first use, instead of when LazyFS is called.
+// Concurrent calls wait for a single init call to return. If the init function
+// returns a nil filesystem without an error, it is handled as an
+// initialization error. It avoids the cost
+// of the filesystem construction, such as copying files by NewBackupFS, for
+// services that may never use it.
+func LazyFS(init func() (fs.FS, error), opts ...LazyFSOption) fs.FS {
+	var o lazyFSOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &lazyFS{
+		init: init,
+		o:    o,
+	}
+}
+
+// errLazyNilFS is returned if the init function of LazyFS returns a nil
+// filesystem without an error.
+var errLazyNilFS = errors.New("lazy filesystem initialized to nil")
+
+type lazyFS struct {
+	init func() (fs.FS, error)
+	o    lazyFSOptions
+
+	fsys     fs.FS
+	err      error
+	failedAt time.Time
+	mu       sync.Mutex
+}
+
+func (s *lazyFS) Open(name string) (fs.File, error) {
+	fsys, err := s.get()
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return fsys.Open(name)
+}
+
+func (s *lazyFS) Glob(pattern string) ([]string, error) {
+	fsys, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	return fs.Glob(fsys, pattern)
+}
+
+func (s *lazyFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	fsys, err := s.get()
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	return fs.ReadDir(fsys, name)
+}
+
+func (s *lazyFS) ReadFile(name string) ([]byte, error) {
+	fsys, err := s.get()
+	if err != nil {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: err}
+	}
+	return fs.ReadFile(fsys, name)
+}
+
+func (s *lazyFS) Stat(name string) (fs.FileInfo, error) {
+	fsys, err := s.get()
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return fs.Stat(fsys, name)
+}
+
+func (s *lazyFS) ReadLink(name string) (string, error) {
+	fsys, err := s.get()
+	if err != nil {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: err}
+	}
+	return ReadLink(fsys, name)
+}
+
+func (s *lazyFS) Lstat(name string) (fs.FileInfo, error) {
+	fsys, err := s.get()
+	if err != nil {
+		return nil, &fs.PathError{Op: "lstat", Path: name, Err: err}
+	}
+	return Lstat(fsys, name)
+}
+
+func (s *lazyFS) Sub(dir string) (fs.FS, error) {
+	return newSubFS(s, dir)
+}
+
+// Unwrap returns the underlying filesystem, or nil if it is not constructed
+// yet. It does not call the init function, so that inspecting the chain of
+// wrappers does not construct the filesystem.
+func (s *lazyFS) Unwrap() fs.FS {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.fsys
+}
+
+// get returns the underlying filesystem, calling the init function if it is
+// not already constructed.
+func (s *lazyFS) get() (fs.FS, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.fsys != nil {
+		return s.fsys, nil
+	}
+	if s.err != nil && (s.o.retryAfter <= 0 || time.Since(s.failedAt) < s.o.retryAfter) {
+		return nil, s.err
+	}
+	fsys, err := s.init()
+	if err == nil && fsys == nil {
+		err = errLazyNilFS
+	}
+	if err != nil {
+		s.err = err
+		s.failedAt = time.Now()
+		return nil, err
+	}
+	s.fsys = fsys
+	s.err = nil
+	return fsys, nil
+}
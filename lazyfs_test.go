@@ -0,0 +1,114 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"errors"
+	"io/fs"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestLazyFS(t *testing.T) {
+	var calls int32
+	fsys := fsutil.LazyFS(func() (fs.FS, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(10 * time.Millisecond)
+		return fsutil.MapFS{
+			"a.txt":     {Data: []byte("a")},
+			"dir/b.txt": {Data: []byte("b")},
+		}, nil
+	})
+
+	if n := atomic.LoadInt32(&calls); n != 0 {
+		t.Fatalf("got %v init calls before use, want none", n)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := fs.Stat(fsys, "a.txt"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := fstest.TestFS(fsys, "a.txt", "dir/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	testReadFile(t, fsys.(fs.ReadFileFS), "dir/b.txt", "b")
+
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("got %v init calls, want %v", n, 1)
+	}
+}
+
+func TestLazyFS_error(t *testing.T) {
+	t.Run("cached", func(t *testing.T) {
+		var calls int
+		fsys := fsutil.LazyFS(func() (fs.FS, error) {
+			calls++
+			return nil, errTest1
+		})
+
+		for i := 0; i < 3; i++ {
+			if _, err := fsys.Open("a.txt"); !errors.Is(err, errTest1) {
+				t.Fatalf("got error %v, want %v", err, errTest1)
+			}
+		}
+		if calls != 1 {
+			t.Errorf("got %v init calls, want %v", calls, 1)
+		}
+	})
+
+	t.Run("retry after", func(t *testing.T) {
+		var calls int
+		fsys := fsutil.LazyFS(func() (fs.FS, error) {
+			calls++
+			if calls == 1 {
+				return nil, errTest1
+			}
+			return fsutil.MapFS{"a.txt": {Data: []byte("a")}}, nil
+		}, fsutil.WithLazyRetryAfter(10*time.Millisecond))
+
+		if _, err := fsys.Open("a.txt"); !errors.Is(err, errTest1) {
+			t.Fatalf("got error %v, want %v", err, errTest1)
+		}
+		if _, err := fsys.Open("a.txt"); !errors.Is(err, errTest1) {
+			t.Fatalf("got error %v, want %v", err, errTest1)
+		}
+
+		time.Sleep(20 * time.Millisecond)
+
+		testOpen(t, fsys, "a.txt", "a")
+		if calls != 2 {
+			t.Errorf("got %v init calls, want %v", calls, 2)
+		}
+	})
+
+	t.Run("nil filesystem", func(t *testing.T) {
+		fsys := fsutil.LazyFS(func() (fs.FS, error) {
+			return nil, nil
+		})
+
+		_, err := fsys.Open("a.txt")
+		var pathErr *fs.PathError
+		if !errors.As(err, &pathErr) {
+			t.Fatalf("got error %v, want path error", err)
+		}
+		if _, err := fs.Stat(fsys, "a.txt"); err == nil {
+			t.Error("got no stat error")
+		}
+	})
+}
@@ -0,0 +1,195 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"sync"
+	"time"
+)
+
+var (
+	_ fs.FS         = (*LimitFS)(nil)
+	_ fs.ReadDirFS  = (*LimitFS)(nil)
+	_ fs.ReadFileFS = (*LimitFS)(nil)
+	_ fs.StatFS     = (*LimitFS)(nil)
+	_ fs.SubFS      = (*LimitFS)(nil)
+	_ OpenContextFS = (*LimitFS)(nil)
+	_ ReadLinkFS    = (*LimitFS)(nil)
+)
+
+// ErrTooManyOpenFiles is returned by LimitFS when the maximal number of
+// simultaneously open files is reached.
+var ErrTooManyOpenFiles = errors.New("too many open files")
+
+// LimitFSOption is used to provide optional parameters to NewLimitFS
+// function.
+type LimitFSOption func(*limitFSOptions)
+
+type limitFSOptions struct {
+	wait        bool
+	waitTimeout time.Duration
+}
+
+// WithLimitWait makes LimitFS wait for an open file to be closed when the
+// limit is reached, instead of returning ErrTooManyOpenFiles immediately. If
+// the timeout is positive, ErrTooManyOpenFiles is returned when no file is
+// closed within the timeout duration, otherwise the wait is not limited.
+func WithLimitWait(timeout time.Duration) LimitFSOption {
+	return func(o *limitFSOptions) {
+		o.wait = true
+		o.waitTimeout = timeout
+	}
+}
+
+// LimitFS is a filesystem that limits the number of files and directories
+// that are simultaneously open from the underlying filesystem, so that bursts
+// of requests to an os.DirFS do not exhaust the limit of open file
+// descriptors of the process. A file counts towards the limit from Open until
+// it is closed. ReadDir and ReadFile calls count towards the limit while they
+// are in progress. Stat calls are not limited.
+type LimitFS struct {
+	fsys fs.FS
+	sem  chan struct{}
+	o    limitFSOptions
+}
+
+// NewLimitFS returns a new instance of LimitFS with at most maxOpen files
+// open at the same time.
+func NewLimitFS(fsys fs.FS, maxOpen int, opts ...LimitFSOption) *LimitFS {
+	var o limitFSOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if maxOpen < 1 {
+		maxOpen = 1
+	}
+	return &LimitFS{
+		fsys: fsys,
+		sem:  make(chan struct{}, maxOpen),
+		o:    o,
+	}
+}
+
+// Open implements fs.FS interface.
+func (s *LimitFS) Open(name string) (fs.File, error) {
+	return s.OpenContext(context.Background(), name)
+}
+
+// OpenContext implements OpenContextFS interface. The context limits the time
+// spent waiting for an open file to be closed, if the WithLimitWait option is
+// used.
+func (s *LimitFS) OpenContext(ctx context.Context, name string) (fs.File, error) {
+	if err := s.acquire(ctx, "open", name); err != nil {
+		return nil, err
+	}
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		s.release()
+		return nil, err
+	}
+	return &limitFile{
+		wrappedFile: wrappedFile{File: f, name: name},
+		limitFS:     s,
+	}, nil
+}
+
+// ReadDir implements fs.ReadDirFS interface.
+func (s *LimitFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if err := s.acquire(context.Background(), "readdir", name); err != nil {
+		return nil, err
+	}
+	defer s.release()
+
+	return fs.ReadDir(s.fsys, name)
+}
+
+// ReadFile implements fs.ReadFileFS interface.
+func (s *LimitFS) ReadFile(name string) ([]byte, error) {
+	if err := s.acquire(context.Background(), "readfile", name); err != nil {
+		return nil, err
+	}
+	defer s.release()
+
+	return fs.ReadFile(s.fsys, name)
+}
+
+// Stat implements fs.StatFS interface.
+func (s *LimitFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(s.fsys, name)
+}
+
+// ReadLink implements ReadLinkFS interface.
+func (s *LimitFS) ReadLink(name string) (string, error) {
+	return ReadLink(s.fsys, name)
+}
+
+// Lstat implements ReadLinkFS interface.
+func (s *LimitFS) Lstat(name string) (fs.FileInfo, error) {
+	return Lstat(s.fsys, name)
+}
+
+// Sub implements fs.SubFS interface.
+func (s *LimitFS) Sub(dir string) (fs.FS, error) {
+	return newSubFS(s, dir)
+}
+
+// Unwrap returns the underlying filesystem.
+func (s *LimitFS) Unwrap() fs.FS {
+	return s.fsys
+}
+
+// OpenFiles returns the number of currently open files.
+func (s *LimitFS) OpenFiles() int {
+	return len(s.sem)
+}
+
+// acquire reserves a place for an open file, waiting for it if the
+// WithLimitWait option is used.
+func (s *LimitFS) acquire(ctx context.Context, op, name string) error {
+	select {
+	case s.sem <- struct{}{}:
+		return nil
+	default:
+	}
+	if !s.o.wait {
+		return &fs.PathError{Op: op, Path: name, Err: ErrTooManyOpenFiles}
+	}
+
+	var timeout <-chan time.Time
+	if s.o.waitTimeout > 0 {
+		t := time.NewTimer(s.o.waitTimeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+	select {
+	case s.sem <- struct{}{}:
+		return nil
+	case <-timeout:
+		return &fs.PathError{Op: op, Path: name, Err: ErrTooManyOpenFiles}
+	case <-ctx.Done():
+		return &fs.PathError{Op: op, Path: name, Err: ctx.Err()}
+	}
+}
+
+func (s *LimitFS) release() {
+	<-s.sem
+}
+
+// limitFile releases its place in LimitFS when it is closed.
+type limitFile struct {
+	wrappedFile
+	limitFS *LimitFS
+	once    sync.Once
+}
+
+func (f *limitFile) Close() error {
+	err := f.File.Close()
+	f.once.Do(f.limitFS.release)
+	return err
+}
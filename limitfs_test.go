@@ -0,0 +1,116 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestLimitFS(t *testing.T) {
+	files := fsutil.MapFS{
+		"index.html":  {Data: []byte("<html>")},
+		"css/app.css": {Data: []byte("body{}")},
+		"js/app.js":   {Data: []byte("alert()")},
+	}
+
+	t.Run("fstest", func(t *testing.T) {
+		fsys := fsutil.NewLimitFS(files, 10)
+
+		if err := fstest.TestFS(fsys, "index.html", "css/app.css", "js/app.js"); err != nil {
+			t.Fatal(err)
+		}
+		if got := fsys.OpenFiles(); got != 0 {
+			t.Errorf("got %v open files, want 0", got)
+		}
+	})
+
+	t.Run("no wait", func(t *testing.T) {
+		fsys := fsutil.NewLimitFS(files, 2)
+
+		f1, err := fsys.Open("index.html")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f2, err := fsys.Open("css/app.css")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fsys.OpenFiles(); got != 2 {
+			t.Errorf("got %v open files, want 2", got)
+		}
+
+		if _, err := fsys.Open("js/app.js"); !errors.Is(err, fsutil.ErrTooManyOpenFiles) {
+			t.Errorf("got error %v, want %v", err, fsutil.ErrTooManyOpenFiles)
+		}
+		if _, err := fsys.ReadFile("js/app.js"); !errors.Is(err, fsutil.ErrTooManyOpenFiles) {
+			t.Errorf("got error %v, want %v", err, fsutil.ErrTooManyOpenFiles)
+		}
+		if _, err := fsys.Stat("js/app.js"); err != nil {
+			t.Errorf("got error %v, want nil", err)
+		}
+
+		if err := f1.Close(); err != nil {
+			t.Fatal(err)
+		}
+		// Closing the file again must not release another place.
+		_ = f1.Close()
+		if got := fsys.OpenFiles(); got != 1 {
+			t.Errorf("got %v open files, want 1", got)
+		}
+
+		testReadFile(t, fsys, "js/app.js", "alert()")
+
+		if err := f2.Close(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("wait", func(t *testing.T) {
+		fsys := fsutil.NewLimitFS(files, 1, fsutil.WithLimitWait(0))
+
+		f, err := fsys.Open("index.html")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			f.Close()
+		}()
+		testReadFile(t, fsys, "js/app.js", "alert()")
+
+		f, err = fsys.Open("index.html")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		if _, err := fsys.OpenContext(ctx, "js/app.js"); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("got error %v, want %v", err, context.DeadlineExceeded)
+		}
+	})
+
+	t.Run("wait timeout", func(t *testing.T) {
+		fsys := fsutil.NewLimitFS(files, 1, fsutil.WithLimitWait(20*time.Millisecond))
+
+		f, err := fsys.Open("index.html")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		if _, err := fsys.Open("js/app.js"); !errors.Is(err, fsutil.ErrTooManyOpenFiles) {
+			t.Errorf("got error %v, want %v", err, fsutil.ErrTooManyOpenFiles)
+		}
+	})
+}
@@ -0,0 +1,173 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	_ fs.FS         = MapFS(nil)
+	_ fs.GlobFS     = MapFS(nil)
+	_ fs.ReadDirFS  = MapFS(nil)
+	_ fs.ReadFileFS = MapFS(nil)
+	_ fs.StatFS     = MapFS(nil)
+)
+
+// MapFS is an in-memory filesystem defined as a map from path names to files
+// or directories. It is similar to testing/fstest.MapFS, but it can be used in
+// non-test code for small virtual filesystems.
+//
+// Directories can be defined explicitly with the fs.ModeDir in the file mode,
+// in order to set their permissions and modification times. Parent directories
+// of all files that are not explicitly defined are present in the filesystem
+// with 0o555 permissions and a zero modification time, as are directories
+// defined with nil files, like in testing/fstest.MapFS.
+type MapFS map[string]*MapFile
+
+// MapFile describes a file or a directory in MapFS.
+type MapFile struct {
+	Data    []byte      // file content
+	Mode    fs.FileMode // file mode, with fs.ModeDir set for directories
+	ModTime time.Time   // modification time
+	Sys     interface{} // underlying data source, returned by FileInfo.Sys
+}
+
+// Open implements fs.FS interface.
+func (m MapFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if f, ok := m[name]; ok && f != nil && !f.Mode.IsDir() {
+		return newMemFile(name, m.info(name, f), f.Data), nil
+	}
+	entries, ok := m.readDir(name)
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return newMemDir(name, m.info(name, m[name]), entries), nil
+}
+
+// Glob implements fs.GlobFS interface.
+func (m MapFS) Glob(pattern string) ([]string, error) {
+	// FSFunc hides the Glob method to avoid recursion.
+	return fs.Glob(FSFunc(m.Open), pattern)
+}
+
+// ReadDir implements fs.ReadDirFS interface.
+func (m MapFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	if f, ok := m[name]; ok && f != nil && !f.Mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errNotDir}
+	}
+	entries, ok := m.readDir(name)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	return entries, nil
+}
+
+// ReadFile implements fs.ReadFileFS interface.
+func (m MapFS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+	f, ok := m[name]
+	if !ok {
+		if _, ok := m.readDir(name); ok {
+			return nil, &fs.PathError{Op: "readfile", Path: name, Err: errIsDir}
+		}
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrNotExist}
+	}
+	if f == nil || f.Mode.IsDir() {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: errIsDir}
+	}
+	data := make([]byte, len(f.Data))
+	copy(data, f.Data)
+	return data, nil
+}
+
+// Stat implements fs.StatFS interface.
+func (m MapFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	if f, ok := m[name]; ok {
+		return m.info(name, f), nil
+	}
+	if _, ok := m.readDir(name); !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return m.info(name, nil), nil
+}
+
+// readDir returns sorted entries of the directory and reports if the directory
+// exists.
+func (m MapFS) readDir(dir string) ([]fs.DirEntry, bool) {
+	f, exists := m[dir]
+	if exists && f != nil && !f.Mode.IsDir() {
+		return nil, false
+	}
+	exists = exists || dir == "."
+
+	prefix := dir + "/"
+	if dir == "." {
+		prefix = ""
+	}
+	children := make(map[string]fs.DirEntry)
+	for name, f := range m {
+		if !strings.HasPrefix(name, prefix) || name == dir {
+			continue
+		}
+		exists = true
+		rest := name[len(prefix):]
+		if i := strings.Index(rest, "/"); i >= 0 {
+			child := rest[:i]
+			if _, ok := children[child]; !ok {
+				p := prefix + child
+				children[child] = m.info(p, m[p])
+			}
+			continue
+		}
+		children[rest] = m.info(name, f)
+	}
+	if !exists {
+		return nil, false
+	}
+
+	entries := make([]fs.DirEntry, 0, len(children))
+	for _, e := range children {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, true
+}
+
+// info returns the file info for the file with the name. If f is nil, the
+// file is an implicit directory.
+func (m MapFS) info(name string, f *MapFile) *memFileInfo {
+	if f == nil {
+		return &memFileInfo{
+			name: path.Base(name),
+			mode: fs.ModeDir | 0o555,
+		}
+	}
+	return &memFileInfo{
+		name:    path.Base(name),
+		size:    int64(len(f.Data)),
+		mode:    f.Mode,
+		modTime: f.ModTime,
+		sys:     f.Sys,
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestMapFS(t *testing.T) {
+	modTime := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	fsys := fsutil.MapFS{
+		"index.html":            {Data: []byte("<h1>Hello</h1>"), Mode: 0o644, ModTime: modTime},
+		"assets":                {Mode: fs.ModeDir | 0o750, ModTime: modTime},
+		"assets/main.css":       {Data: []byte("body { color: red; }"), Mode: 0o600},
+		"assets/img/logo.svg":   {Data: []byte("<svg></svg>")},
+		"empty":                 {Mode: fs.ModeDir | 0o700},
+		"implicit/dir/file.txt": {Data: []byte("text")},
+		"nil":                   nil,
+	}
+
+	if err := fstest.TestFS(fsys, "index.html", "assets/main.css", "assets/img/logo.svg", "empty", "implicit/dir/file.txt", "nil"); err != nil {
+		t.Fatal(err)
+	}
+
+	testOpen(t, fsys, "assets/main.css", "body { color: red; }")
+	testOpenNotExist(t, fsys, "assets/main.js")
+	testReadFile(t, fsys, "index.html", "<h1>Hello</h1>")
+	testReadFileNotExist(t, fsys, "missing.html")
+	testGlob(t, fsys, "*/*.css", []string{"assets/main.css"})
+
+	for _, tc := range []struct {
+		name    string
+		mode    fs.FileMode
+		modTime time.Time
+	}{
+		{name: "index.html", mode: 0o644, modTime: modTime},
+		{name: "assets", mode: fs.ModeDir | 0o750, modTime: modTime},
+		{name: "assets/main.css", mode: 0o600},
+		{name: "empty", mode: fs.ModeDir | 0o700},
+		{name: "implicit", mode: fs.ModeDir | 0o555},
+		{name: "implicit/dir", mode: fs.ModeDir | 0o555},
+		{name: "nil", mode: fs.ModeDir | 0o555},
+	} {
+		info, err := fsys.Stat(tc.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode() != tc.mode {
+			t.Errorf("got %q mode %v, want %v", tc.name, info.Mode(), tc.mode)
+		}
+		if !info.ModTime().Equal(tc.modTime) {
+			t.Errorf("got %q mod time %v, want %v", tc.name, info.ModTime(), tc.modTime)
+		}
+	}
+
+	entries, err := fsys.ReadDir(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+	want := []string{"assets", "empty", "implicit", "index.html", "nil"}
+	if len(got) != len(want) {
+		t.Fatalf("got entries %v, want %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("got entries %v, want %v", got, want)
+		}
+	}
+
+	for _, name := range []string{"assets", "nil"} {
+		if _, err := fsys.ReadFile(name); err == nil {
+			t.Errorf("got no error reading directory %q", name)
+		}
+	}
+	if _, err := fsys.ReadDir("index.html"); err == nil || errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got error %v reading directory of a file", err)
+	}
+}
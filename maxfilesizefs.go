@@ -0,0 +1,163 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+var (
+	_ fs.FS         = (*MaxFileSizeFS)(nil)
+	_ fs.GlobFS     = (*MaxFileSizeFS)(nil)
+	_ fs.ReadDirFS  = (*MaxFileSizeFS)(nil)
+	_ fs.ReadFileFS = (*MaxFileSizeFS)(nil)
+	_ fs.StatFS     = (*MaxFileSizeFS)(nil)
+	_ fs.SubFS      = (*MaxFileSizeFS)(nil)
+	_ ReadLinkFS    = (*MaxFileSizeFS)(nil)
+)
+
+// ErrFileTooLarge is the error that FileTooLargeError wraps.
+var ErrFileTooLarge = errors.New("file too large")
+
+// FileTooLargeError is returned by MaxFileSizeFS when the file is larger than
+// the configured limit.
+type FileTooLargeError struct {
+	// Size is the size of the file reported by its info, or the number of
+	// bytes that are read before the limit is exceeded if the info reports
+	// a smaller size.
+	Size int64
+	// Limit is the configured maximal file size.
+	Limit int64
+}
+
+// Error implements error interface.
+func (e *FileTooLargeError) Error() string {
+	return fmt.Sprintf("%v: size %v limit %v", ErrFileTooLarge, e.Size, e.Limit)
+}
+
+// Unwrap returns ErrFileTooLarge.
+func (e *FileTooLargeError) Unwrap() error {
+	return ErrFileTooLarge
+}
+
+// MaxFileSizeFS is a filesystem that refuses to open and read regular files
+// that are larger than the configured size, based on their info. Reading is
+// also stopped with an error if a file has more data than its info reports.
+// The intended usage is to protect from unexpectedly large files before they
+// are read into memory, for example by ReadFile.
+type MaxFileSizeFS struct {
+	fsys    fs.FS
+	maxSize int64
+}
+
+// NewMaxFileSizeFS returns a new instance of MaxFileSizeFS.
+func NewMaxFileSizeFS(fsys fs.FS, maxSize int64) *MaxFileSizeFS {
+	return &MaxFileSizeFS{
+		fsys:    fsys,
+		maxSize: maxSize,
+	}
+}
+
+// Open implements fs.FS interface.
+func (s *MaxFileSizeFS) Open(name string) (fs.File, error) {
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.Mode().IsRegular() && info.Size() > s.maxSize {
+		f.Close()
+		return nil, &fs.PathError{Op: "open", Path: name, Err: &FileTooLargeError{Size: info.Size(), Limit: s.maxSize}}
+	}
+	return &maxFileSizeFile{wrappedFile: wrappedFile{File: f, name: name}, maxSize: s.maxSize}, nil
+}
+
+// Glob implements fs.GlobFS interface.
+func (s *MaxFileSizeFS) Glob(pattern string) ([]string, error) {
+	return fs.Glob(s.fsys, pattern)
+}
+
+// ReadDir implements fs.ReadDirFS interface.
+func (s *MaxFileSizeFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(s.fsys, name)
+}
+
+// ReadFile implements fs.ReadFileFS interface.
+func (s *MaxFileSizeFS) ReadFile(name string) ([]byte, error) {
+	f, err := s.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return io.ReadAll(f)
+}
+
+// Stat implements fs.StatFS interface.
+func (s *MaxFileSizeFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(s.fsys, name)
+}
+
+// ReadLink implements ReadLinkFS interface.
+func (s *MaxFileSizeFS) ReadLink(name string) (string, error) {
+	return ReadLink(s.fsys, name)
+}
+
+// Lstat implements ReadLinkFS interface.
+func (s *MaxFileSizeFS) Lstat(name string) (fs.FileInfo, error) {
+	return Lstat(s.fsys, name)
+}
+
+// Sub implements fs.SubFS interface.
+func (s *MaxFileSizeFS) Sub(dir string) (fs.FS, error) {
+	return newSubFS(s, dir)
+}
+
+// Unwrap returns the underlying filesystem.
+func (s *MaxFileSizeFS) Unwrap() fs.FS {
+	return s.fsys
+}
+
+type maxFileSizeFile struct {
+	wrappedFile
+	maxSize int64
+	offset  int64
+}
+
+func (f *maxFileSizeFile) Read(p []byte) (int, error) {
+	remaining := f.maxSize - f.offset
+	if remaining <= 0 {
+		// Data at the limit is allowed only if the file ends there.
+		var b [1]byte
+		n, err := f.File.Read(b[:])
+		if n > 0 {
+			return 0, &fs.PathError{Op: "read", Path: f.name, Err: &FileTooLargeError{Size: f.offset + int64(n), Limit: f.maxSize}}
+		}
+		return 0, err
+	}
+	if int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := f.File.Read(p)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *maxFileSizeFile) Seek(offset int64, whence int) (int64, error) {
+	n, err := f.wrappedFile.Seek(offset, whence)
+	if err != nil {
+		return n, err
+	}
+	f.offset = n
+	return n, nil
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"resenje.org/fsutil"
+)
+
+func TestMaxFileSizeFS(t *testing.T) {
+	files := fsutil.MapFS{
+		"small.txt": {Data: []byte("12345")},
+		"limit.txt": {Data: []byte("1234567890")},
+		"large.txt": {Data: []byte("1234567890+")},
+	}
+	fsys := fsutil.NewMaxFileSizeFS(files, 10)
+
+	// Files that are too large are listed but can not be opened, which
+	// TestFS reports as errors.
+	if err := fstest.TestFS(fsutil.NewMaxFileSizeFS(files, 11), "small.txt", "limit.txt", "large.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	testOpen(t, fsys, "small.txt", "12345")
+	testReadFile(t, fsys, "limit.txt", "1234567890")
+
+	if _, err := fsys.Open("large.txt"); !errors.Is(err, fsutil.ErrFileTooLarge) {
+		t.Errorf("got open error %v, want %v", err, fsutil.ErrFileTooLarge)
+	}
+	_, err := fsys.ReadFile("large.txt")
+	var tooLarge *fsutil.FileTooLargeError
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("got read file error %v, want %T", err, tooLarge)
+	}
+	if tooLarge.Size != 11 || tooLarge.Limit != 10 {
+		t.Errorf("got error %+v, want size 11 and limit 10", *tooLarge)
+	}
+
+	t.Run("info smaller than content", func(t *testing.T) {
+		// Report the size of a smaller file for the large one.
+		fsys := fsutil.NewMaxFileSizeFS(fsutil.FSFunc(func(name string) (fs.File, error) {
+			f, err := files.Open("large.txt")
+			if err != nil {
+				return nil, err
+			}
+			info, err := files.Stat("small.txt")
+			if err != nil {
+				return nil, err
+			}
+			return &statFile{File: f, info: info}, nil
+		}), 10)
+
+		f, err := fsys.Open("large.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		if _, err := io.ReadAll(f); !errors.Is(err, fsutil.ErrFileTooLarge) {
+			t.Errorf("got read error %v, want %v", err, fsutil.ErrFileTooLarge)
+		}
+	})
+}
+
+type statFile struct {
+	fs.File
+	info fs.FileInfo
+}
+
+func (f *statFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
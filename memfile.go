@@ -0,0 +1,104 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"time"
+)
+
+var (
+	_ fs.File        = (*memFile)(nil)
+	_ io.ReadSeeker  = (*memFile)(nil)
+	_ io.ReaderAt    = (*memFile)(nil)
+	_ fs.ReadDirFile = (*memDir)(nil)
+)
+
+// memFileInfo is the file info of a file or a directory that is stored in
+// memory.
+type memFileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+	sys     interface{}
+}
+
+func (i *memFileInfo) Name() string               { return i.name }
+func (i *memFileInfo) Size() int64                { return i.size }
+func (i *memFileInfo) Mode() fs.FileMode          { return i.mode }
+func (i *memFileInfo) ModTime() time.Time         { return i.modTime }
+func (i *memFileInfo) IsDir() bool                { return i.mode.IsDir() }
+func (i *memFileInfo) Sys() interface{}           { return i.sys }
+func (i *memFileInfo) Type() fs.FileMode          { return i.mode.Type() }
+func (i *memFileInfo) Info() (fs.FileInfo, error) { return i, nil }
+
+// memFile is an open file with data in memory.
+type memFile struct {
+	path string
+	info *memFileInfo
+	*bytes.Reader
+}
+
+func newMemFile(path string, info *memFileInfo, data []byte) *memFile {
+	return &memFile{
+		path:   path,
+		info:   info,
+		Reader: bytes.NewReader(data),
+	}
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *memFile) Close() error {
+	return nil
+}
+
+// memDir is an open directory with entries in memory.
+type memDir struct {
+	path    string
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func newMemDir(path string, info fs.FileInfo, entries []fs.DirEntry) *memDir {
+	return &memDir{
+		path:    path,
+		info:    info,
+		entries: entries,
+	}
+}
+
+func (d *memDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *memDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.path, Err: fs.ErrInvalid}
+}
+
+func (d *memDir) Close() error {
+	return nil
+}
+
+func (d *memDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	remaining := len(d.entries) - d.offset
+	if n > 0 && remaining == 0 {
+		return nil, io.EOF
+	}
+	if n <= 0 || n > remaining {
+		n = remaining
+	}
+	r := make([]fs.DirEntry, n)
+	copy(r, d.entries[d.offset:d.offset+n])
+	d.offset += n
+	return r, nil
+}
@@ -0,0 +1,193 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+)
+
+var (
+	_ fs.FS         = (*MimeTypeFS)(nil)
+	_ fs.GlobFS     = (*MimeTypeFS)(nil)
+	_ fs.ReadDirFS  = (*MimeTypeFS)(nil)
+	_ fs.ReadFileFS = (*MimeTypeFS)(nil)
+	_ fs.StatFS     = (*MimeTypeFS)(nil)
+	_ fs.SubFS      = (*MimeTypeFS)(nil)
+	_ ReadLinkFS    = (*MimeTypeFS)(nil)
+)
+
+// sniffLen is the number of bytes that http.DetectContentType considers.
+const sniffLen = 512
+
+// MimeTypeFSOption is used to provide optional parameters to NewMimeTypeFS
+// function.
+type MimeTypeFSOption func(*mimeTypeFSOptions)
+
+type mimeTypeFSOptions struct {
+	types map[string]string
+}
+
+// WithMimeTypes sets content types for file extensions, including the leading
+// dot, that take precedence over the ones known by the mime package.
+func WithMimeTypes(types map[string]string) MimeTypeFSOption {
+	return func(o *mimeTypeFSOptions) {
+		for ext, typ := range types {
+			o.types[strings.ToLower(ext)] = typ
+		}
+	}
+}
+
+// MimeTypeFS is a filesystem that determines content types of its files. The
+// content type is determined by the file extension, if it is configured with
+// WithMimeTypes option or known by the mime package, or by sniffing the file
+// content with http.DetectContentType otherwise. Determined content types are
+// cached per file name, so the files are expected not to change.
+type MimeTypeFS struct {
+	fsys  fs.FS
+	types map[string]string
+
+	cache   map[string]string
+	cacheMu sync.Mutex
+}
+
+// NewMimeTypeFS returns a new instance of MimeTypeFS.
+func NewMimeTypeFS(fsys fs.FS, opts ...MimeTypeFSOption) *MimeTypeFS {
+	o := mimeTypeFSOptions{
+		types: make(map[string]string),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &MimeTypeFS{
+		fsys:  fsys,
+		types: o.types,
+		cache: make(map[string]string),
+	}
+}
+
+// Open implements fs.FS interface.
+func (s *MimeTypeFS) Open(name string) (fs.File, error) {
+	return s.fsys.Open(name)
+}
+
+// Glob implements fs.GlobFS interface.
+func (s *MimeTypeFS) Glob(pattern string) ([]string, error) {
+	return fs.Glob(s.fsys, pattern)
+}
+
+// ReadDir implements fs.ReadDirFS interface.
+func (s *MimeTypeFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(s.fsys, name)
+}
+
+// ReadFile implements fs.ReadFileFS interface.
+func (s *MimeTypeFS) ReadFile(name string) ([]byte, error) {
+	return fs.ReadFile(s.fsys, name)
+}
+
+// Stat implements fs.StatFS interface.
+func (s *MimeTypeFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(s.fsys, name)
+}
+
+// ReadLink implements ReadLinkFS interface.
+func (s *MimeTypeFS) ReadLink(name string) (string, error) {
+	return ReadLink(s.fsys, name)
+}
+
+// Lstat implements ReadLinkFS interface.
+func (s *MimeTypeFS) Lstat(name string) (fs.FileInfo, error) {
+	return Lstat(s.fsys, name)
+}
+
+// Sub implements fs.SubFS interface.
+func (s *MimeTypeFS) Sub(dir string) (fs.FS, error) {
+	return newSubFS(s, dir)
+}
+
+// Unwrap returns the underlying filesystem.
+func (s *MimeTypeFS) Unwrap() fs.FS {
+	return s.fsys
+}
+
+// ContentType returns the content type of the named file. An error is
+// returned if the file is a directory.
+func (s *MimeTypeFS) ContentType(name string) (string, error) {
+	s.cacheMu.Lock()
+	typ, ok := s.cache[name]
+	s.cacheMu.Unlock()
+	if ok {
+		return typ, nil
+	}
+
+	typ, err := s.contentType(name)
+	if err != nil {
+		return "", err
+	}
+
+	s.cacheMu.Lock()
+	s.cache[name] = typ
+	s.cacheMu.Unlock()
+
+	return typ, nil
+}
+
+func (s *MimeTypeFS) contentType(name string) (string, error) {
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", &fs.PathError{Op: "contenttype", Path: name, Err: errIsDir}
+	}
+
+	if ext := strings.ToLower(path.Ext(name)); ext != "" {
+		if typ, ok := s.types[ext]; ok {
+			return typ, nil
+		}
+		if typ := mime.TypeByExtension(ext); typ != "" {
+			return typ, nil
+		}
+	}
+
+	buf := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", err
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
+
+// Handler returns a http.Handler that sets the Content-Type header to the
+// content type of the requested file before calling the handler h, which is
+// usually http.FileServer serving the same filesystem. As http.FileServer and
+// http.ServeContent do not change the Content-Type header if it is already
+// set, the content type is not detected by them. The header is not set for
+// directories and files that do not exist.
+func (s *MimeTypeFS) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Clean("/" + r.URL.Path)[1:]
+		if name != "" {
+			if typ, err := s.ContentType(name); err == nil {
+				w.Header().Set("Content-Type", typ)
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"resenje.org/fsutil"
+)
+
+func TestMimeTypeFS(t *testing.T) {
+	files := fsutil.MapFS{
+		"index.html":        {Data: []byte("<html>")},
+		"css/app.css":       {Data: []byte("body{}")},
+		"data.bin":          {Data: []byte("binary")},
+		"blobs/3a7bd3e2360": {Data: []byte("\x89PNG\x0D\x0A\x1A\x0A")},
+		"blobs/c3ab8ff1372": {Data: []byte("plain text")},
+	}
+	counting := fsutil.NewCountingFS(files)
+	fsys := fsutil.NewMimeTypeFS(counting, fsutil.WithMimeTypes(map[string]string{
+		".BIN": "application/x-custom",
+	}))
+
+	if err := fstest.TestFS(fsys, "index.html", "css/app.css", "data.bin", "blobs/3a7bd3e2360", "blobs/c3ab8ff1372"); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{
+		"index.html":        "text/html; charset=utf-8",
+		"css/app.css":       "text/css; charset=utf-8",
+		"data.bin":          "application/x-custom",
+		"blobs/3a7bd3e2360": "image/png",
+		"blobs/c3ab8ff1372": "text/plain; charset=utf-8",
+	} {
+		got, err := fsys.ContentType(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%s: got content type %q, want %q", name, got, want)
+		}
+	}
+
+	t.Run("cache", func(t *testing.T) {
+		opens := counting.Counts()["blobs/c3ab8ff1372"].Opens
+		if _, err := fsys.ContentType("blobs/c3ab8ff1372"); err != nil {
+			t.Fatal(err)
+		}
+		if got := counting.Counts()["blobs/c3ab8ff1372"].Opens; got != opens {
+			t.Errorf("got %v opens, want %v", got, opens)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		if _, err := fsys.ContentType("css"); err == nil {
+			t.Error("expected error for directory")
+		}
+		if _, err := fsys.ContentType("missing"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("got error %v, want %v", err, fs.ErrNotExist)
+		}
+	})
+
+	t.Run("handler", func(t *testing.T) {
+		h := fsys.Handler(http.FileServer(fsutil.ToHTTPFileSystem(fsys)))
+
+		for name, want := range map[string]string{
+			"/blobs/3a7bd3e2360": "image/png",
+			"/data.bin":          "application/x-custom",
+		} {
+			r := httptest.NewRequest(http.MethodGet, name, nil)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != http.StatusOK {
+				t.Fatalf("%s: got status %v, want %v", name, w.Code, http.StatusOK)
+			}
+			if got := w.Header().Get("Content-Type"); got != want {
+				t.Errorf("%s: got content type %q, want %q", name, got, want)
+			}
+		}
+
+		r := httptest.NewRequest(http.MethodGet, "/missing", nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("got status %v, want %v", w.Code, http.StatusNotFound)
+		}
+	})
+}
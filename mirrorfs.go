@@ -0,0 +1,414 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	_ fs.FS         = (*MirrorFS)(nil)
+	_ fs.GlobFS     = (*MirrorFS)(nil)
+	_ fs.ReadDirFS  = (*MirrorFS)(nil)
+	_ fs.ReadFileFS = (*MirrorFS)(nil)
+	_ fs.StatFS     = (*MirrorFS)(nil)
+	_ fs.SubFS      = (*MirrorFS)(nil)
+	_ io.Closer     = (*MirrorFS)(nil)
+	_ ReadLinkFS    = (*MirrorFS)(nil)
+)
+
+// MirrorFS implements a filesystem which keeps a directory in sync with
+// another filesystem and reads files from that directory. All files are copied
+// when it is constructed and after that only files that are changed, while
+// files that are removed from the original filesystem are removed from the
+// directory. Files are synced by the Sync method and periodically with the
+// WithMirrorInterval option. The intended usage is to keep a local copy of
+// files from a slow remote filesystem.
+//
+// A file is considered changed if its size or modification time is different
+// from the copied file. If the original filesystem does not provide
+// modification times, like embed.FS, file contents are compared. Symbolic
+// links are followed.
+//
+// Be aware that all files in the directory that are not in the original
+// filesystem are deleted.
+type MirrorFS struct {
+	fsys   fs.FS
+	dir    string
+	mirror fs.FS
+
+	syncMu  sync.Mutex
+	stats   MirrorStats
+	statsMu sync.Mutex
+
+	quit      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// MirrorFSOption sets an optional parameter of the MirrorFS.
+type MirrorFSOption func(*mirrorFSOptions)
+
+type mirrorFSOptions struct {
+	interval time.Duration
+}
+
+// WithMirrorInterval makes MirrorFS sync files periodically in the background.
+// Errors are reported by the Stats method. Periodic syncing is stopped by the
+// Close method.
+func WithMirrorInterval(d time.Duration) MirrorFSOption {
+	return func(o *mirrorFSOptions) {
+		o.interval = d
+	}
+}
+
+// MirrorStats contains information about syncing files to the mirror
+// directory.
+type MirrorStats struct {
+	// Syncs is the number of completed syncs, including the failed ones.
+	Syncs int
+	// CopiedFiles is the number of files copied by all syncs.
+	CopiedFiles int
+	// CopiedBytes is the total size of files copied by all syncs.
+	CopiedBytes int64
+	// RemovedFiles is the number of files and directories removed by all
+	// syncs.
+	RemovedFiles int
+	// LastSyncAt is the time when the last sync completed.
+	LastSyncAt time.Time
+	// LastSyncErr is the error from the last sync.
+	LastSyncErr error
+}
+
+// NewMirrorFS constructs a new MirrorFS for another filesystem and copies all
+// files to dir.
+func NewMirrorFS(fsys fs.FS, dir string, opts ...MirrorFSOption) (*MirrorFS, error) {
+	dir = filepath.Clean(dir)
+	if !validateDir(dir) {
+		return nil, ErrUnsupportedDir
+	}
+
+	var o mirrorFSOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	s := &MirrorFS{
+		fsys:   fsys,
+		dir:    dir,
+		mirror: os.DirFS(dir),
+	}
+
+	parent, base := filepath.Dir(dir), filepath.Base(dir)
+	if err := os.MkdirAll(parent, 0o777); err != nil {
+		return nil, fmt.Errorf("create mirror parent directory: %w", err)
+	}
+	if err := removeStaleBackupTempDirs(parent, base); err != nil {
+		return nil, fmt.Errorf("remove stale temporary directories: %w", err)
+	}
+
+	if err := s.Sync(); err != nil {
+		return nil, err
+	}
+
+	if o.interval > 0 {
+		s.quit = make(chan struct{})
+		s.done = make(chan struct{})
+		go s.syncLoop(o.interval)
+	}
+
+	return s, nil
+}
+
+// Open implements fs.FS interface.
+func (s *MirrorFS) Open(name string) (fs.File, error) {
+	return s.mirror.Open(name)
+}
+
+// Glob implements fs.GlobFS interface.
+func (s *MirrorFS) Glob(pattern string) ([]string, error) {
+	return fs.Glob(s.mirror, pattern)
+}
+
+// ReadDir implements fs.ReadDirFS interface.
+func (s *MirrorFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(s.mirror, name)
+}
+
+// ReadFile implements fs.ReadFileFS interface.
+func (s *MirrorFS) ReadFile(name string) ([]byte, error) {
+	return fs.ReadFile(s.mirror, name)
+}
+
+// Stat implements fs.StatFS interface.
+func (s *MirrorFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(s.mirror, name)
+}
+
+// ReadLink implements ReadLinkFS interface.
+func (s *MirrorFS) ReadLink(name string) (string, error) {
+	return ReadLink(s.mirror, name)
+}
+
+// Lstat implements ReadLinkFS interface.
+func (s *MirrorFS) Lstat(name string) (fs.FileInfo, error) {
+	return Lstat(s.mirror, name)
+}
+
+// Sub implements fs.SubFS interface.
+func (s *MirrorFS) Sub(dir string) (fs.FS, error) {
+	return newSubFS(s, dir)
+}
+
+// Unwrap returns the original filesystem.
+func (s *MirrorFS) Unwrap() fs.FS {
+	return s.fsys
+}
+
+// Stats returns the current sync statistics.
+func (s *MirrorFS) Stats() MirrorStats {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+
+	return s.stats
+}
+
+// Close stops periodic syncing. Files in the mirror directory are not removed.
+func (s *MirrorFS) Close() error {
+	s.closeOnce.Do(func() {
+		if s.quit != nil {
+			close(s.quit)
+			<-s.done
+		}
+	})
+	return nil
+}
+
+// Sync copies changed files from the original filesystem to the mirror
+// directory and removes files that do not exist in the original filesystem.
+// Every file is written to a temporary directory first and then moved to the
+// mirror directory, so that no file is ever partially written. It can be
+// called to sync files when the original filesystem is known to be changed,
+// for example by a filesystem watcher.
+func (s *MirrorFS) Sync() error {
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+
+	var stats mirrorSyncStats
+	err := s.sync(&stats)
+	if err != nil {
+		err = fmt.Errorf("sync mirror directory: %w", err)
+	}
+
+	s.statsMu.Lock()
+	s.stats.Syncs++
+	s.stats.CopiedFiles += stats.copiedFiles
+	s.stats.CopiedBytes += stats.copiedBytes
+	s.stats.RemovedFiles += stats.removedFiles
+	s.stats.LastSyncAt = time.Now()
+	s.stats.LastSyncErr = err
+	s.statsMu.Unlock()
+
+	return err
+}
+
+// mirrorSyncStats is the progress of a single sync.
+type mirrorSyncStats struct {
+	copiedFiles  int
+	copiedBytes  int64
+	removedFiles int
+}
+
+func (s *MirrorFS) sync(stats *mirrorSyncStats) error {
+	if err := os.MkdirAll(s.dir, 0o777); err != nil {
+		return fmt.Errorf("create mirror directory: %w", err)
+	}
+
+	tmpDir, err := os.MkdirTemp(filepath.Dir(s.dir), filepath.Base(s.dir)+backupTempPattern)
+	if err != nil {
+		return fmt.Errorf("create temporary mirror directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	paths := make(map[string]struct{})
+	if err := fs.WalkDir(s.fsys, ".", s.syncWalkFunc(tmpDir, paths, stats, 0)); err != nil {
+		return err
+	}
+
+	return filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			return err
+		}
+		if _, ok := paths[filepath.ToSlash(rel)]; ok {
+			return nil
+		}
+		if err := os.RemoveAll(path); err != nil {
+			return fmt.Errorf("remove %s: %w", path, err)
+		}
+		stats.removedFiles++
+		if d.IsDir() {
+			return fs.SkipDir
+		}
+		return nil
+	})
+}
+
+func (s *MirrorFS) syncWalkFunc(tmpDir string, paths map[string]struct{}, stats *mirrorSyncStats, depth int) fs.WalkDirFunc {
+	return func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		paths[path] = struct{}{}
+		mirrorPath := filepath.Join(s.dir, filepath.FromSlash(path))
+
+		info, err := fs.Stat(s.fsys, path)
+		if err != nil {
+			return fmt.Errorf("file info %s: %w", path, err)
+		}
+		if info.IsDir() {
+			if mi, err := os.Lstat(mirrorPath); err == nil && !mi.IsDir() {
+				if err := os.Remove(mirrorPath); err != nil {
+					return fmt.Errorf("remove file %s: %w", mirrorPath, err)
+				}
+			}
+			if err := os.MkdirAll(mirrorPath, 0o777); err != nil {
+				return fmt.Errorf("create directory %s: %w", mirrorPath, err)
+			}
+			if d.IsDir() {
+				return nil
+			}
+			// A symbolic link to a directory.
+			if depth >= maxSymlinkDepth {
+				return fmt.Errorf("follow link %s: too many levels of symbolic links", path)
+			}
+			return fs.WalkDir(s.fsys, path, func(p string, d fs.DirEntry, err error) error {
+				if p == path && err == nil {
+					return nil
+				}
+				return s.syncWalkFunc(tmpDir, paths, stats, depth+1)(p, d, err)
+			})
+		}
+
+		changed, err := s.changed(path, mirrorPath, info)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			return nil
+		}
+		return s.syncFile(path, mirrorPath, tmpDir, info, stats)
+	}
+}
+
+// changed reports whether the file in the mirror directory is different from
+// the file in the original filesystem.
+func (s *MirrorFS) changed(path, mirrorPath string, info fs.FileInfo) (bool, error) {
+	mi, err := os.Lstat(mirrorPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return true, nil
+		}
+		return false, fmt.Errorf("mirror file info %s: %w", mirrorPath, err)
+	}
+	if !mi.Mode().IsRegular() || mi.Size() != info.Size() {
+		return true, nil
+	}
+	if !info.ModTime().IsZero() {
+		return !mi.ModTime().Equal(info.ModTime()), nil
+	}
+
+	fr, err := s.fsys.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("open file %s: %w", path, err)
+	}
+	defer fr.Close()
+
+	mr, err := os.Open(mirrorPath)
+	if err != nil {
+		return false, fmt.Errorf("open mirror file %s: %w", mirrorPath, err)
+	}
+	defer mr.Close()
+
+	equal, err := equalContent(fr, mr)
+	if err != nil {
+		return false, fmt.Errorf("compare file %s: %w", path, err)
+	}
+	return !equal, nil
+}
+
+// syncFile copies the file to the temporary directory and moves it to the
+// mirrorPath, with the same modification time as the original file.
+func (s *MirrorFS) syncFile(path, mirrorPath, tmpDir string, info fs.FileInfo, stats *mirrorSyncStats) error {
+	fr, err := s.fsys.Open(path)
+	if err != nil {
+		return fmt.Errorf("open file %s: %w", path, err)
+	}
+	defer fr.Close()
+
+	fw, err := os.CreateTemp(tmpDir, "")
+	if err != nil {
+		return fmt.Errorf("create temporary file: %w", err)
+	}
+	tmpPath := fw.Name()
+
+	n, err := io.Copy(fw, fr)
+	if err != nil {
+		fw.Close()
+		return fmt.Errorf("copy file data %s: %w", path, err)
+	}
+	if err := fw.Close(); err != nil {
+		return fmt.Errorf("close temporary file %s: %w", tmpPath, err)
+	}
+	if err := os.Chmod(tmpPath, info.Mode().Perm()|permUserWrite); err != nil {
+		return fmt.Errorf("change mode %s: %w", tmpPath, err)
+	}
+	if modTime := info.ModTime(); !modTime.IsZero() {
+		if err := os.Chtimes(tmpPath, modTime, modTime); err != nil {
+			return fmt.Errorf("change times %s: %w", tmpPath, err)
+		}
+	}
+
+	if mi, err := os.Lstat(mirrorPath); err == nil && mi.IsDir() {
+		if err := os.RemoveAll(mirrorPath); err != nil {
+			return fmt.Errorf("remove directory %s: %w", mirrorPath, err)
+		}
+	}
+	if err := os.Rename(tmpPath, mirrorPath); err != nil {
+		return fmt.Errorf("move file %s: %w", mirrorPath, err)
+	}
+
+	stats.copiedFiles++
+	stats.copiedBytes += n
+	return nil
+}
+
+// syncLoop syncs files in intervals until MirrorFS is closed.
+func (s *MirrorFS) syncLoop(interval time.Duration) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			_ = s.Sync()
+		case <-s.quit:
+			return
+		}
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestMirrorFS(t *testing.T) {
+	srcDir := t.TempDir()
+	mirrorDir := filepath.Join(t.TempDir(), "mirror")
+
+	modTime := time.Date(2021, 8, 9, 10, 11, 12, 0, time.UTC)
+	writeFile := func(t *testing.T, name, content string, modTime time.Time) {
+		t.Helper()
+		p := filepath.Join(srcDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(t, "index.html", "<html>", modTime)
+	writeFile(t, "assets/main.css", "body{}", modTime)
+	writeFile(t, "assets/main.js", "alert()", modTime)
+
+	fsys, err := fsutil.NewMirrorFS(os.DirFS(srcDir), mirrorDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fsys.Close()
+
+	testReadFile(t, fsys, "index.html", "<html>")
+	testReadFile(t, fsys, "assets/main.css", "body{}")
+	testGlob(t, fsys, "assets/*", []string{"assets/main.css", "assets/main.js"})
+	testMirrorStats(t, fsys, 1, 3, 19, 0)
+
+	t.Run("unchanged", func(t *testing.T) {
+		if err := fsys.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		testMirrorStats(t, fsys, 2, 3, 19, 0)
+	})
+
+	t.Run("changed", func(t *testing.T) {
+		writeFile(t, "assets/main.css", "body{color:red}", modTime.Add(time.Hour))
+		writeFile(t, "assets/extra.css", "p{}", modTime)
+		if err := os.Remove(filepath.Join(srcDir, "assets", "main.js")); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Remove(filepath.Join(srcDir, "index.html")); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := fsys.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		testMirrorStats(t, fsys, 3, 5, 37, 2)
+
+		testReadFile(t, fsys, "assets/main.css", "body{color:red}")
+		testReadFile(t, fsys, "assets/extra.css", "p{}")
+		testReadFileNotExist(t, fsys, "index.html")
+		testReadFileNotExist(t, fsys, "assets/main.js")
+		testStat(t, fsys, "assets/extra.css", &mockFileInfo{
+			name:    "extra.css",
+			size:    3,
+			mode:    0o644,
+			modTime: modTime,
+		}, permUserWrite)
+	})
+
+	t.Run("removed directory", func(t *testing.T) {
+		if err := os.RemoveAll(filepath.Join(srcDir, "assets")); err != nil {
+			t.Fatal(err)
+		}
+		writeFile(t, "assets", "now a file", modTime)
+
+		if err := fsys.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		testReadFile(t, fsys, "assets", "now a file")
+	})
+
+	t.Run("existing directory", func(t *testing.T) {
+		fsys, err := fsutil.NewMirrorFS(os.DirFS(srcDir), mirrorDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testMirrorStats(t, fsys, 1, 0, 0, 0)
+	})
+}
+
+func TestMirrorFS_noModTime(t *testing.T) {
+	files := fstest.MapFS{
+		"a.txt": {Data: []byte("aaa")},
+		"b.txt": {Data: []byte("bbb")},
+	}
+
+	fsys, err := fsutil.NewMirrorFS(files, filepath.Join(t.TempDir(), "mirror"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testMirrorStats(t, fsys, 1, 2, 6, 0)
+
+	files["b.txt"] = &fstest.MapFile{Data: []byte("BBB")}
+
+	if err := fsys.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	testMirrorStats(t, fsys, 2, 3, 9, 0)
+	testReadFile(t, fsys, "a.txt", "aaa")
+	testReadFile(t, fsys, "b.txt", "BBB")
+}
+
+func TestMirrorFS_interval(t *testing.T) {
+	files := fstest.MapFS{
+		"a.txt": {Data: []byte("aaa")},
+	}
+
+	fsys, err := fsutil.NewMirrorFS(files, filepath.Join(t.TempDir(), "mirror"), fsutil.WithMirrorInterval(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for fsys.Stats().Syncs < 3 {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for periodic syncs")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := fsys.Close(); err != nil {
+		t.Fatal(err)
+	}
+	syncs := fsys.Stats().Syncs
+	time.Sleep(10 * time.Millisecond)
+	if got := fsys.Stats().Syncs; got != syncs {
+		t.Errorf("got %v syncs after close, want %v", got, syncs)
+	}
+}
+
+func TestMirrorFS_error(t *testing.T) {
+	_, err := fsutil.NewMirrorFS(faultyFS{}, filepath.Join(t.TempDir(), "mirror"))
+	if !errors.Is(err, errTest1) {
+		t.Errorf("got error %v, want %v", err, errTest1)
+	}
+
+	if _, err := fsutil.NewMirrorFS(fstest.MapFS{}, "."); !errors.Is(err, fsutil.ErrUnsupportedDir) {
+		t.Errorf("got error %v, want %v", err, fsutil.ErrUnsupportedDir)
+	}
+}
+
+// faultyFS returns errTest1 on every open.
+type faultyFS struct{}
+
+func (faultyFS) Open(name string) (fs.File, error) {
+	return nil, &fs.PathError{Op: "open", Path: name, Err: errTest1}
+}
+
+func testMirrorStats(t *testing.T, fsys *fsutil.MirrorFS, syncs, copiedFiles int, copiedBytes int64, removedFiles int) {
+	t.Helper()
+
+	stats := fsys.Stats()
+	if stats.Syncs != syncs {
+		t.Errorf("got %v syncs, want %v", stats.Syncs, syncs)
+	}
+	if stats.CopiedFiles != copiedFiles {
+		t.Errorf("got %v copied files, want %v", stats.CopiedFiles, copiedFiles)
+	}
+	if stats.CopiedBytes != copiedBytes {
+		t.Errorf("got %v copied bytes, want %v", stats.CopiedBytes, copiedBytes)
+	}
+	if stats.RemovedFiles != removedFiles {
+		t.Errorf("got %v removed files, want %v", stats.RemovedFiles, removedFiles)
+	}
+	if stats.LastSyncErr != nil {
+		t.Errorf("got last sync error %v", stats.LastSyncErr)
+	}
+}
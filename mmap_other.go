@@ -0,0 +1,25 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package fsutil
+
+import (
+	"errors"
+	"os"
+)
+
+// mmap maps the content of the file into memory as private read-only data
+// that must be unmapped with munmap.
+func mmap(f *os.File) ([]byte, error) {
+	return nil, errors.New("memory mapping not supported")
+}
+
+// munmap unmaps the data mapped by mmap.
+func munmap(data []byte) error {
+	return nil
+}
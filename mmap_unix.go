@@ -0,0 +1,37 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package fsutil
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// mmap maps the content of the file into memory as private read-only data
+// that must be unmapped with munmap.
+func mmap(f *os.File) ([]byte, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	if size <= 0 {
+		return nil, errors.New("empty file")
+	}
+	if int64(int(size)) != size {
+		return nil, errors.New("file too large")
+	}
+	return syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_PRIVATE)
+}
+
+// munmap unmaps the data mapped by mmap.
+func munmap(data []byte) error {
+	return syscall.Munmap(data)
+}
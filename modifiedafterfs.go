@@ -0,0 +1,190 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"errors"
+	"io/fs"
+	"time"
+)
+
+var (
+	_ fs.FS         = (*OnlyFilesModifiedAfterFS)(nil)
+	_ fs.GlobFS     = (*OnlyFilesModifiedAfterFS)(nil)
+	_ fs.ReadDirFS  = (*OnlyFilesModifiedAfterFS)(nil)
+	_ fs.ReadFileFS = (*OnlyFilesModifiedAfterFS)(nil)
+	_ fs.StatFS     = (*OnlyFilesModifiedAfterFS)(nil)
+	_ fs.SubFS      = (*OnlyFilesModifiedAfterFS)(nil)
+	_ ReadLinkFS    = (*OnlyFilesModifiedAfterFS)(nil)
+)
+
+// OnlyFilesModifiedAfterFS is a filesystem that exposes only files with the
+// modification time after a point in time. Other files do not exist and they
+// are omitted from directory listings, while all directories are exposed, so
+// that the filesystem can be walked. The intended usage is to export files
+// that changed since the last export with Walk or CopyFS, without comparing
+// their content.
+type OnlyFilesModifiedAfterFS struct {
+	fsys   fs.FS
+	cutoff func() time.Time
+}
+
+// NewOnlyFilesModifiedAfterFS returns a new instance of
+// OnlyFilesModifiedAfterFS that exposes files modified after the time t.
+func NewOnlyFilesModifiedAfterFS(fsys fs.FS, t time.Time) *OnlyFilesModifiedAfterFS {
+	return &OnlyFilesModifiedAfterFS{
+		fsys:   fsys,
+		cutoff: func() time.Time { return t },
+	}
+}
+
+// NewOnlyFilesModifiedWithinFS returns a new instance of
+// OnlyFilesModifiedAfterFS that exposes files modified within the duration d
+// before the time of every operation.
+func NewOnlyFilesModifiedWithinFS(fsys fs.FS, d time.Duration) *OnlyFilesModifiedAfterFS {
+	return &OnlyFilesModifiedAfterFS{
+		fsys:   fsys,
+		cutoff: func() time.Time { return time.Now().Add(-d) },
+	}
+}
+
+// Open implements fs.FS interface.
+func (s *OnlyFilesModifiedAfterFS) Open(name string) (fs.File, error) {
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	cutoff := s.cutoff()
+	if !modifiedAfter(info, cutoff) {
+		f.Close()
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if d, ok := f.(fs.ReadDirFile); ok && info.IsDir() {
+		return &modifiedAfterDir{ReadDirFile: d, cutoff: cutoff}, nil
+	}
+	return f, nil
+}
+
+// Glob implements fs.GlobFS interface.
+func (s *OnlyFilesModifiedAfterFS) Glob(pattern string) ([]string, error) {
+	return fs.Glob(readDirFS{FSFunc: s.Open, readDir: s.ReadDir}, pattern)
+}
+
+// ReadDir implements fs.ReadDirFS interface.
+func (s *OnlyFilesModifiedAfterFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := fs.ReadDir(s.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	return filterModifiedAfter(s.cutoff(), entries)
+}
+
+// ReadFile implements fs.ReadFileFS interface.
+func (s *OnlyFilesModifiedAfterFS) ReadFile(name string) ([]byte, error) {
+	if _, err := s.stat("readfile", name, fs.Stat); err != nil {
+		return nil, err
+	}
+	return fs.ReadFile(s.fsys, name)
+}
+
+// Stat implements fs.StatFS interface.
+func (s *OnlyFilesModifiedAfterFS) Stat(name string) (fs.FileInfo, error) {
+	return s.stat("stat", name, fs.Stat)
+}
+
+// ReadLink implements ReadLinkFS interface.
+func (s *OnlyFilesModifiedAfterFS) ReadLink(name string) (string, error) {
+	if _, err := s.stat("readlink", name, Lstat); err != nil {
+		return "", err
+	}
+	return ReadLink(s.fsys, name)
+}
+
+// Lstat implements ReadLinkFS interface.
+func (s *OnlyFilesModifiedAfterFS) Lstat(name string) (fs.FileInfo, error) {
+	return s.stat("lstat", name, Lstat)
+}
+
+// Sub implements fs.SubFS interface.
+func (s *OnlyFilesModifiedAfterFS) Sub(dir string) (fs.FS, error) {
+	return newSubFS(s, dir)
+}
+
+// Unwrap returns the underlying filesystem.
+func (s *OnlyFilesModifiedAfterFS) Unwrap() fs.FS {
+	return s.fsys
+}
+
+// stat returns the file info with the stat function, or fs.ErrNotExist if
+// the file is not modified after the cutoff time.
+func (s *OnlyFilesModifiedAfterFS) stat(op, name string, stat func(fsys fs.FS, name string) (fs.FileInfo, error)) (fs.FileInfo, error) {
+	info, err := stat(s.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	if !modifiedAfter(info, s.cutoff()) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return info, nil
+}
+
+// modifiedAfterDir is a directory opened from OnlyFilesModifiedAfterFS with
+// entries of files that are not modified after the cutoff time omitted.
+type modifiedAfterDir struct {
+	fs.ReadDirFile
+	cutoff time.Time
+}
+
+func (d *modifiedAfterDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	for {
+		entries, err := d.ReadDirFile.ReadDir(n)
+		filtered, ferr := filterModifiedAfter(d.cutoff, entries)
+		if ferr != nil {
+			return filtered, ferr
+		}
+		// Read the next batch if all entries in this one are omitted, so
+		// that an empty result is returned only at the end of the directory.
+		if n > 0 && len(filtered) == 0 && len(entries) > 0 && err == nil {
+			continue
+		}
+		return filtered, err
+	}
+}
+
+// modifiedAfter reports whether the file is a directory or it is modified
+// after the cutoff time.
+func modifiedAfter(info fs.FileInfo, cutoff time.Time) bool {
+	return info.IsDir() || info.ModTime().After(cutoff)
+}
+
+// filterModifiedAfter returns entries of directories and files modified after
+// the cutoff time. Entries of files that are removed after they are listed
+// are omitted.
+func filterModifiedAfter(cutoff time.Time, entries []fs.DirEntry) ([]fs.DirEntry, error) {
+	filtered := make([]fs.DirEntry, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() {
+			filtered = append(filtered, e)
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		if modifiedAfter(info, cutoff) {
+			filtered = append(filtered, e)
+		}
+	}
+	return filtered, nil
+}
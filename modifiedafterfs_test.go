@@ -0,0 +1,92 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestOnlyFilesModifiedAfterFS(t *testing.T) {
+	cutoff := time.Date(2021, 8, 9, 10, 0, 0, 0, time.UTC)
+	files := fstest.MapFS{
+		"new.txt":     {Data: []byte("new"), ModTime: cutoff.Add(time.Minute)},
+		"old.txt":     {Data: []byte("old"), ModTime: cutoff.Add(-time.Minute)},
+		"cutoff.txt":  {Data: []byte("cutoff"), ModTime: cutoff},
+		"dir/new.css": {Data: []byte("new"), ModTime: cutoff.Add(time.Hour)},
+		"dir/old.css": {Data: []byte("old"), ModTime: cutoff.Add(-time.Hour)},
+		"old/old.css": {Data: []byte("old"), ModTime: cutoff.Add(-time.Hour)},
+	}
+
+	fsys := fsutil.NewOnlyFilesModifiedAfterFS(files, cutoff)
+
+	if err := fstest.TestFS(fsys, "new.txt", "dir/new.css", "old"); err != nil {
+		t.Fatal(err)
+	}
+
+	testOpen(t, fsys, "new.txt", "new")
+	testReadFile(t, fsys, "dir/new.css", "new")
+
+	for _, name := range []string{"old.txt", "cutoff.txt", "dir/old.css", "old/old.css"} {
+		if _, err := fsys.Open(name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("got open %s error %v, want %v", name, err, fs.ErrNotExist)
+		}
+		if _, err := fsys.Stat(name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("got stat %s error %v, want %v", name, err, fs.ErrNotExist)
+		}
+		if _, err := fsys.ReadFile(name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("got read file %s error %v, want %v", name, err, fs.ErrNotExist)
+		}
+	}
+
+	var walked []string
+	if err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			walked = append(walked, path)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"dir/new.css", "new.txt"}; !reflect.DeepEqual(walked, want) {
+		t.Errorf("got walked files %v, want %v", walked, want)
+	}
+
+	t.Run("copy", func(t *testing.T) {
+		report, err := fsutil.CopyFS(filepath.Join(t.TempDir(), "export"), fsys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Files != 2 {
+			t.Errorf("got %v copied files, want %v", report.Files, 2)
+		}
+	})
+}
+
+func TestOnlyFilesModifiedAfterFS_within(t *testing.T) {
+	files := fstest.MapFS{
+		"new.txt": {Data: []byte("new"), ModTime: time.Now()},
+		"old.txt": {Data: []byte("old"), ModTime: time.Now().Add(-2 * time.Hour)},
+	}
+
+	fsys := fsutil.NewOnlyFilesModifiedWithinFS(files, time.Hour)
+
+	testOpen(t, fsys, "new.txt", "new")
+	if _, err := fsys.Open("old.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got error %v, want %v", err, fs.ErrNotExist)
+	}
+	testGlob(t, fsys, "*.txt", []string{"new.txt"})
+}
@@ -0,0 +1,185 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"fmt"
+	"io/fs"
+	"strconv"
+	"time"
+)
+
+var (
+	_ fs.FS         = (*modTimeFS)(nil)
+	_ fs.GlobFS     = (*modTimeFS)(nil)
+	_ fs.ReadDirFS  = (*modTimeFS)(nil)
+	_ fs.ReadFileFS = (*modTimeFS)(nil)
+	_ fs.StatFS     = (*modTimeFS)(nil)
+	_ fs.SubFS      = (*modTimeFS)(nil)
+	_ ReadLinkFS    = (*modTimeFS)(nil)
+)
+
+// ModTimeFSOption is used to provide optional parameters to ModTimeFS
+// function.
+type ModTimeFSOption func(*modTimeFSOptions)
+
+type modTimeFSOptions struct {
+	zeroOnly bool
+}
+
+// WithModTimeZeroOnly overrides the modification time only for files and
+// directories that report the zero time, keeping the ones that are set.
+func WithModTimeZeroOnly() ModTimeFSOption {
+	return func(o *modTimeFSOptions) {
+		o.zeroOnly = true
+	}
+}
+
+// ModTimeFS returns a filesystem that reports the same modification time for
+// all files and directories. Filesystems such as embed.FS report the zero
+// time, which omits Last-Modified headers in http.FileServer responses and
+// makes exported archives nondeterministic. The time is usually the time of
+// the build, which can be parsed with ParseBuildTime.
+func ModTimeFS(fsys fs.FS, modTime time.Time, opts ...ModTimeFSOption) fs.FS {
+	var o modTimeFSOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &modTimeFS{
+		fsys:    fsys,
+		modTime: modTime,
+		o:       o,
+	}
+}
+
+// ParseBuildTime parses the build time from a string in RFC 3339 format or as
+// the number of seconds since the Unix epoch. The string is usually injected
+// into a variable with linker flags, for example:
+//
+//	var buildTime string
+//
+//	go build -ldflags "-X main.buildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// The empty string results in the zero time and no error, so that builds
+// without linker flags are not affected.
+func ParseBuildTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if sec, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(sec, 0).UTC(), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parse build time %q: %w", s, err)
+	}
+	return t, nil
+}
+
+type modTimeFS struct {
+	fsys    fs.FS
+	modTime time.Time
+	o       modTimeFSOptions
+}
+
+func (s *modTimeFS) Open(name string) (fs.File, error) {
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &modTimeFile{wrappedFile: wrappedFile{File: f, name: name}, modTimeFS: s}, nil
+}
+
+func (s *modTimeFS) Glob(pattern string) ([]string, error) {
+	return fs.Glob(s.fsys, pattern)
+}
+
+func (s *modTimeFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := fs.ReadDir(s.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	return s.entries(entries), nil
+}
+
+func (s *modTimeFS) ReadFile(name string) ([]byte, error) {
+	return fs.ReadFile(s.fsys, name)
+}
+
+func (s *modTimeFS) Stat(name string) (fs.FileInfo, error) {
+	info, err := fs.Stat(s.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	return s.info(info), nil
+}
+
+func (s *modTimeFS) ReadLink(name string) (string, error) {
+	return ReadLink(s.fsys, name)
+}
+
+func (s *modTimeFS) Lstat(name string) (fs.FileInfo, error) {
+	info, err := Lstat(s.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	return s.info(info), nil
+}
+
+func (s *modTimeFS) Sub(dir string) (fs.FS, error) {
+	return newSubFS(s, dir)
+}
+
+func (s *modTimeFS) Unwrap() fs.FS {
+	return s.fsys
+}
+
+// info returns the file info with the modification time overridden.
+func (s *modTimeFS) info(info fs.FileInfo) fs.FileInfo {
+	if s.o.zeroOnly && !info.ModTime().IsZero() {
+		return info
+	}
+	return NewFileInfo(info, WithModTime(s.modTime))
+}
+
+func (s *modTimeFS) entries(entries []fs.DirEntry) []fs.DirEntry {
+	for i, e := range entries {
+		entries[i] = &modTimeDirEntry{DirEntry: e, modTimeFS: s}
+	}
+	return entries
+}
+
+// modTimeDirEntry is the dir entry with the modification time overridden.
+type modTimeDirEntry struct {
+	fs.DirEntry
+	modTimeFS *modTimeFS
+}
+
+func (e *modTimeDirEntry) Info() (fs.FileInfo, error) {
+	info, err := e.DirEntry.Info()
+	if err != nil {
+		return nil, err
+	}
+	return e.modTimeFS.info(info), nil
+}
+
+type modTimeFile struct {
+	wrappedFile
+	modTimeFS *modTimeFS
+}
+
+func (f *modTimeFile) Stat() (fs.FileInfo, error) {
+	info, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return f.modTimeFS.info(info), nil
+}
+
+func (f *modTimeFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	entries, err := f.wrappedFile.ReadDir(n)
+	return f.modTimeFS.entries(entries), err
+}
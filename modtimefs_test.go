@@ -0,0 +1,127 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestModTimeFS(t *testing.T) {
+	buildTime := time.Date(2021, 7, 8, 9, 10, 11, 0, time.UTC)
+	setTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	files := fsutil.MapFS{
+		"index.html":   {Data: []byte("<html>")},
+		"css/app.css":  {Data: []byte("body{}")},
+		"css/keep.css": {Data: []byte("p{}"), ModTime: setTime},
+	}
+
+	t.Run("all", func(t *testing.T) {
+		fsys := fsutil.ModTimeFS(files, buildTime)
+
+		if err := fstest.TestFS(fsys, "index.html", "css/app.css", "css/keep.css"); err != nil {
+			t.Fatal(err)
+		}
+		testModTimes(t, fsys, map[string]time.Time{
+			".":            buildTime,
+			"index.html":   buildTime,
+			"css":          buildTime,
+			"css/app.css":  buildTime,
+			"css/keep.css": buildTime,
+		})
+	})
+
+	t.Run("zero only", func(t *testing.T) {
+		fsys := fsutil.ModTimeFS(files, buildTime, fsutil.WithModTimeZeroOnly())
+
+		if err := fstest.TestFS(fsys, "index.html", "css/app.css", "css/keep.css"); err != nil {
+			t.Fatal(err)
+		}
+		testModTimes(t, fsys, map[string]time.Time{
+			"index.html":   buildTime,
+			"css/app.css":  buildTime,
+			"css/keep.css": setTime,
+		})
+	})
+
+	t.Run("last modified header", func(t *testing.T) {
+		fsys := fsutil.ModTimeFS(files, buildTime)
+
+		w := httptest.NewRecorder()
+		http.FileServer(http.FS(fsys)).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/css/app.css", nil))
+
+		if got, want := w.Header().Get("Last-Modified"), buildTime.Format(http.TimeFormat); got != want {
+			t.Errorf("got last modified %q, want %q", got, want)
+		}
+	})
+}
+
+func testModTimes(t *testing.T, fsys fs.FS, want map[string]time.Time) {
+	t.Helper()
+
+	for name, modTime := range want {
+		info, err := fs.Stat(fsys, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(modTime) {
+			t.Errorf("got %q stat mod time %v, want %v", name, info.ModTime(), modTime)
+		}
+	}
+	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		modTime, ok := want[path]
+		if !ok {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.ModTime().Equal(modTime) {
+			t.Errorf("got %q entry mod time %v, want %v", path, info.ModTime(), modTime)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseBuildTime(t *testing.T) {
+	for _, tc := range []struct {
+		s       string
+		want    time.Time
+		wantErr bool
+	}{
+		{s: "", want: time.Time{}},
+		{s: "2021-07-08T09:10:11Z", want: time.Date(2021, 7, 8, 9, 10, 11, 0, time.UTC)},
+		{s: "1625735411", want: time.Date(2021, 7, 8, 9, 10, 11, 0, time.UTC)},
+		{s: "yesterday", wantErr: true},
+	} {
+		got, err := fsutil.ParseBuildTime(tc.s)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("%q: got no error", tc.s)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Equal(tc.want) {
+			t.Errorf("%q: got %v, want %v", tc.s, got, tc.want)
+		}
+	}
+}
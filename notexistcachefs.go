@@ -0,0 +1,198 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"errors"
+	"io/fs"
+	"sync"
+	"time"
+)
+
+var (
+	_ fs.FS         = (*NotExistCacheFS)(nil)
+	_ fs.ReadDirFS  = (*NotExistCacheFS)(nil)
+	_ fs.ReadFileFS = (*NotExistCacheFS)(nil)
+	_ fs.StatFS     = (*NotExistCacheFS)(nil)
+	_ fs.SubFS      = (*NotExistCacheFS)(nil)
+	_ ReadLinkFS    = (*NotExistCacheFS)(nil)
+)
+
+// NotExistCacheFS is a filesystem that remembers names of files that do not
+// exist in the underlying filesystem for the ttl duration and returns errors
+// that wrap fs.ErrNotExist for them without accessing the underlying
+// filesystem. It reduces the load caused by scanners that probe many paths
+// that do not exist, which would otherwise be looked up in every layer of a
+// chain of wrappers, such as HashFS over UnionFS. Files that are created
+// during the ttl are not visible until it passes or until Invalidate is
+// called with their names.
+type NotExistCacheFS struct {
+	fsys fs.FS
+	ttl  time.Duration
+
+	missing map[string]notExistCacheEntry
+	// sweepAt is the number of cached names at which expired ones are
+	// removed, so that probing of many distinct names does not grow the cache
+	// without bounds.
+	sweepAt int
+	cacheMu sync.Mutex
+}
+
+type notExistCacheEntry struct {
+	err     error // the error wrapped by fs.PathError, to keep its details
+	expires time.Time
+}
+
+// notExistCacheMinSweep is the number of cached names below which expired
+// names are not removed.
+const notExistCacheMinSweep = 1024
+
+// NewNotExistCacheFS returns a new instance of NotExistCacheFS.
+func NewNotExistCacheFS(fsys fs.FS, ttl time.Duration) *NotExistCacheFS {
+	return &NotExistCacheFS{
+		fsys:    fsys,
+		ttl:     ttl,
+		missing: make(map[string]notExistCacheEntry),
+		sweepAt: notExistCacheMinSweep,
+	}
+}
+
+// Open implements fs.FS interface.
+func (s *NotExistCacheFS) Open(name string) (fs.File, error) {
+	if err := s.cached("open", name); err != nil {
+		return nil, err
+	}
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		s.remember(name, err)
+		return nil, err
+	}
+	return f, nil
+}
+
+// ReadDir implements fs.ReadDirFS interface.
+func (s *NotExistCacheFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if err := s.cached("readdir", name); err != nil {
+		return nil, err
+	}
+	entries, err := fs.ReadDir(s.fsys, name)
+	if err != nil {
+		s.remember(name, err)
+		return nil, err
+	}
+	return entries, nil
+}
+
+// ReadFile implements fs.ReadFileFS interface.
+func (s *NotExistCacheFS) ReadFile(name string) ([]byte, error) {
+	if err := s.cached("readfile", name); err != nil {
+		return nil, err
+	}
+	data, err := fs.ReadFile(s.fsys, name)
+	if err != nil {
+		s.remember(name, err)
+		return nil, err
+	}
+	return data, nil
+}
+
+// Stat implements fs.StatFS interface.
+func (s *NotExistCacheFS) Stat(name string) (fs.FileInfo, error) {
+	if err := s.cached("stat", name); err != nil {
+		return nil, err
+	}
+	info, err := fs.Stat(s.fsys, name)
+	if err != nil {
+		s.remember(name, err)
+		return nil, err
+	}
+	return info, nil
+}
+
+// ReadLink implements ReadLinkFS interface. Its results are not cached.
+func (s *NotExistCacheFS) ReadLink(name string) (string, error) {
+	return ReadLink(s.fsys, name)
+}
+
+// Lstat implements ReadLinkFS interface. Its results are not cached.
+func (s *NotExistCacheFS) Lstat(name string) (fs.FileInfo, error) {
+	return Lstat(s.fsys, name)
+}
+
+// Sub implements fs.SubFS interface.
+func (s *NotExistCacheFS) Sub(dir string) (fs.FS, error) {
+	return newSubFS(s, dir)
+}
+
+// Unwrap returns the underlying filesystem.
+func (s *NotExistCacheFS) Unwrap() fs.FS {
+	return s.fsys
+}
+
+// Invalidate removes the cached result for the named file, so that it is
+// looked up in the underlying filesystem on the next access. It should be
+// called when the file is created.
+func (s *NotExistCacheFS) Invalidate(name string) {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+
+	delete(s.missing, name)
+}
+
+// Purge removes all cached results, including the expired ones.
+func (s *NotExistCacheFS) Purge() {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+
+	s.missing = make(map[string]notExistCacheEntry)
+	s.sweepAt = notExistCacheMinSweep
+}
+
+// cached returns the error for the named file if it is cached as not existing.
+func (s *NotExistCacheFS) cached(op, name string) error {
+	now := time.Now()
+
+	s.cacheMu.Lock()
+	e, ok := s.missing[name]
+	s.cacheMu.Unlock()
+	if !ok || !now.Before(e.expires) {
+		return nil
+	}
+	return &fs.PathError{Op: op, Path: name, Err: e.err}
+}
+
+// remember caches the named file as not existing if the error wraps
+// fs.ErrNotExist.
+func (s *NotExistCacheFS) remember(name string, err error) {
+	if !errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	cause := fs.ErrNotExist
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) && errors.Is(pathErr.Err, fs.ErrNotExist) {
+		cause = pathErr.Err
+	}
+	now := time.Now()
+
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+
+	if len(s.missing) >= s.sweepAt {
+		for n, e := range s.missing {
+			if !now.Before(e.expires) {
+				delete(s.missing, n)
+			}
+		}
+		s.sweepAt = 2 * len(s.missing)
+		if s.sweepAt < notExistCacheMinSweep {
+			s.sweepAt = notExistCacheMinSweep
+		}
+	}
+	s.missing[name] = notExistCacheEntry{
+		err:     cause,
+		expires: now.Add(s.ttl),
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestNotExistCacheFS(t *testing.T) {
+	files := fsutil.MapFS{
+		"a.txt":     {Data: []byte("a")},
+		"dir/b.txt": {Data: []byte("b")},
+	}
+	var opens int
+	backend := fsutil.FSFunc(func(name string) (fs.File, error) {
+		opens++
+		return files.Open(name)
+	})
+
+	fsys := fsutil.NewNotExistCacheFS(backend, time.Hour)
+
+	if err := fstest.TestFS(fsys, "a.txt", "dir/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	fsys.Purge()
+
+	t.Run("not exist", func(t *testing.T) {
+		opens = 0
+
+		for i := 0; i < 3; i++ {
+			if _, err := fsys.Open("wp-login.php"); !errors.Is(err, fs.ErrNotExist) {
+				t.Fatalf("got error %v, want %v", err, fs.ErrNotExist)
+			}
+			if _, err := fs.Stat(fsys, "wp-login.php"); !errors.Is(err, fs.ErrNotExist) {
+				t.Fatalf("got error %v, want %v", err, fs.ErrNotExist)
+			}
+			if _, err := fs.ReadFile(fsys, "wp-login.php"); !errors.Is(err, fs.ErrNotExist) {
+				t.Fatalf("got error %v, want %v", err, fs.ErrNotExist)
+			}
+		}
+		if opens != 1 {
+			t.Errorf("got %v opens, want %v", opens, 1)
+		}
+
+		var pathErr *fs.PathError
+		_, err := fs.Stat(fsys, "wp-login.php")
+		if !errors.As(err, &pathErr) {
+			t.Fatalf("got error %v, want %T", err, pathErr)
+		}
+		if pathErr.Op != "stat" || pathErr.Path != "wp-login.php" {
+			t.Errorf("got op %q path %q, want op %q path %q", pathErr.Op, pathErr.Path, "stat", "wp-login.php")
+		}
+	})
+
+	t.Run("invalidate", func(t *testing.T) {
+		files["c.txt"] = &fsutil.MapFile{Data: []byte("c")}
+		defer delete(files, "c.txt")
+
+		if _, err := fsys.Open("c.txt"); err != nil {
+			t.Fatal(err)
+		}
+
+		delete(files, "c.txt")
+		if _, err := fsys.Open("c.txt"); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("got error %v, want %v", err, fs.ErrNotExist)
+		}
+
+		files["c.txt"] = &fsutil.MapFile{Data: []byte("c")}
+		if _, err := fsys.Open("c.txt"); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("got error %v, want cached %v", err, fs.ErrNotExist)
+		}
+
+		fsys.Invalidate("c.txt")
+		if _, err := fsys.Open("c.txt"); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("existing files", func(t *testing.T) {
+		opens = 0
+
+		for i := 0; i < 3; i++ {
+			testOpen(t, fsys, "a.txt", "a")
+		}
+		if opens != 3 {
+			t.Errorf("got %v opens, want %v", opens, 3)
+		}
+	})
+}
+
+func TestNotExistCacheFS_expiry(t *testing.T) {
+	var opens int
+	fsys := fsutil.NewNotExistCacheFS(fsutil.FSFunc(func(name string) (fs.File, error) {
+		opens++
+		return fsutil.MapFS{}.Open(name)
+	}), 10*time.Millisecond)
+
+	if _, err := fsys.Open("missing.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("got error %v, want %v", err, fs.ErrNotExist)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, err := fsys.Open("missing.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("got error %v, want %v", err, fs.ErrNotExist)
+	}
+	if opens != 2 {
+		t.Errorf("got %v opens, want %v", opens, 2)
+	}
+}
@@ -0,0 +1,287 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package objectfs provides a read-only filesystem over objects in a bucket of
+// an object storage, such as Amazon S3 or Google Cloud Storage. Object storage
+// specific clients are plugged in by implementing the Client interface, so
+// that this package does not depend on any of their SDKs.
+package objectfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+var (
+	_ fs.FS                = (*FS)(nil)
+	_ fs.ReadDirFS         = (*FS)(nil)
+	_ fs.ReadFileFS        = (*FS)(nil)
+	_ fs.StatFS            = (*FS)(nil)
+	_ fsutil.OpenContextFS = (*FS)(nil)
+	_ fsutil.StatContextFS = (*FS)(nil)
+)
+
+// Client provides access to objects in a bucket. Methods must return an error
+// that matches fs.ErrNotExist with errors.Is if the object does not exist.
+// The fsutil.ErrorMappingFS can be used to map errors of a Client that does
+// not comply.
+type Client interface {
+	// GetObject returns the content and the info of the object with the key.
+	GetObject(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error)
+	// HeadObject returns the info of the object with the key.
+	HeadObject(ctx context.Context, key string) (ObjectInfo, error)
+	// ListObjects returns infos of all objects with keys that start with
+	// the prefix and do not contain the delimiter after it, and all distinct
+	// common prefixes of other keys up to and including the first delimiter
+	// after the prefix.
+	ListObjects(ctx context.Context, prefix, delimiter string) (objects []ObjectInfo, commonPrefixes []string, err error)
+}
+
+// ObjectInfo describes an object.
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// FS is a read-only filesystem with files that are objects under a key prefix
+// in a bucket. Directories are derived from "/" delimited object keys. The
+// content of an opened file is read into memory, so that the file implements
+// io.Seeker.
+type FS struct {
+	client Client
+	prefix string
+}
+
+// New returns a new FS with objects that have keys starting with the prefix.
+// The prefix is treated as a directory and the "/" separator is added to it if
+// it is missing. An empty prefix is the root of the bucket.
+func New(client Client, prefix string) *FS {
+	prefix = strings.Trim(prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &FS{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+// Open implements fs.FS interface.
+func (s *FS) Open(name string) (fs.File, error) {
+	return s.OpenContext(context.Background(), name)
+}
+
+// OpenContext implements fsutil.OpenContextFS interface.
+func (s *FS) OpenContext(ctx context.Context, name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if name != "." {
+		data, info, err := s.get(ctx, name)
+		if err == nil {
+			return &file{Reader: bytes.NewReader(data), info: info}, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+	entries, err := s.readDir(ctx, name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &dir{info: dirInfo(name), entries: entries}, nil
+}
+
+// ReadDir implements fs.ReadDirFS interface.
+func (s *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	entries, err := s.readDir(context.Background(), name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	return entries, nil
+}
+
+// ReadFile implements fs.ReadFileFS interface.
+func (s *FS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: errors.New("is a directory")}
+	}
+	data, _, err := s.get(context.Background(), name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: err}
+	}
+	return data, nil
+}
+
+// Stat implements fs.StatFS interface.
+func (s *FS) Stat(name string) (fs.FileInfo, error) {
+	return s.StatContext(context.Background(), name)
+}
+
+// StatContext implements fsutil.StatContextFS interface.
+func (s *FS) StatContext(ctx context.Context, name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return dirInfo(name), nil
+	}
+	o, err := s.client.HeadObject(ctx, s.prefix+name)
+	if err == nil {
+		return objectInfo(name, o), nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	if _, err := s.readDir(ctx, name); err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return dirInfo(name), nil
+}
+
+func (s *FS) get(ctx context.Context, name string) ([]byte, *fileInfo, error) {
+	r, o, err := s.client.GetObject(ctx, s.prefix+name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	info := objectInfo(name, o)
+	info.size = int64(len(data))
+	return data, info, nil
+}
+
+// readDir returns sorted entries of the directory. Directories other than the
+// root exist only if there is at least one object in them.
+func (s *FS) readDir(ctx context.Context, name string) ([]fs.DirEntry, error) {
+	prefix := s.prefix
+	if name != "." {
+		prefix += name + "/"
+	}
+	objects, commonPrefixes, err := s.client.ListObjects(ctx, prefix, "/")
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]fs.DirEntry, 0, len(objects)+len(commonPrefixes))
+	for _, o := range objects {
+		n := strings.TrimPrefix(o.Key, prefix)
+		if n == "" {
+			continue // directory marker object
+		}
+		entries = append(entries, objectInfo(n, o))
+	}
+	for _, p := range commonPrefixes {
+		n := strings.TrimSuffix(strings.TrimPrefix(p, prefix), "/")
+		if n == "" {
+			continue
+		}
+		entries = append(entries, dirInfo(n))
+	}
+	if len(entries) == 0 && len(objects) == 0 && name != "." {
+		return nil, fs.ErrNotExist
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func objectInfo(name string, o ObjectInfo) *fileInfo {
+	return &fileInfo{
+		name:    path.Base(name),
+		size:    o.Size,
+		mode:    0o444,
+		modTime: o.LastModified,
+	}
+}
+
+func dirInfo(name string) *fileInfo {
+	return &fileInfo{
+		name: path.Base(name),
+		mode: fs.ModeDir | 0o555,
+	}
+}
+
+func (i *fileInfo) Name() string               { return i.name }
+func (i *fileInfo) Size() int64                { return i.size }
+func (i *fileInfo) Mode() fs.FileMode          { return i.mode }
+func (i *fileInfo) ModTime() time.Time         { return i.modTime }
+func (i *fileInfo) IsDir() bool                { return i.mode.IsDir() }
+func (i *fileInfo) Sys() interface{}           { return nil }
+func (i *fileInfo) Type() fs.FileMode          { return i.mode.Type() }
+func (i *fileInfo) Info() (fs.FileInfo, error) { return i, nil }
+
+type file struct {
+	*bytes.Reader
+	info *fileInfo
+}
+
+func (f *file) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *file) Close() error {
+	return nil
+}
+
+type dir struct {
+	info    *fileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: errors.New("is a directory")}
+}
+
+func (d *dir) Close() error {
+	return nil
+}
+
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	entries := d.entries[d.offset:]
+	if n > 0 {
+		if len(entries) == 0 {
+			return nil, io.EOF
+		}
+		if n < len(entries) {
+			entries = entries[:n]
+		}
+	}
+	d.offset += len(entries)
+	return entries, nil
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package objectfs_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"resenje.org/fsutil/objectfs"
+)
+
+func TestFS(t *testing.T) {
+	modTime := time.Date(2021, 4, 20, 10, 0, 0, 0, time.UTC)
+	client := &mockClient{
+		objects: map[string]string{
+			"site/index.html":     "<html>",
+			"site/css/":           "",
+			"site/css/app.css":    "body{}",
+			"site/js/lib/lib.js":  "lib()",
+			"other/secret.txt":    "secret",
+			"site-old/index.html": "<old>",
+		},
+		modTime: modTime,
+	}
+
+	fsys := objectfs.New(client, "/site/")
+
+	if err := fstest.TestFS(fsys, "index.html", "css/app.css", "js/lib/lib.js"); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("read file", func(t *testing.T) {
+		data, err := fsys.ReadFile("css/app.css")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "body{}" {
+			t.Errorf("got %q, want %q", data, "body{}")
+		}
+	})
+
+	t.Run("read dir", func(t *testing.T) {
+		entries, err := fsys.ReadDir(".")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		if strings.Join(names, ",") != "css,index.html,js" {
+			t.Errorf("got entries %v, want [css index.html js]", names)
+		}
+	})
+
+	t.Run("stat", func(t *testing.T) {
+		info, err := fsys.Stat("index.html")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() != 6 || !info.ModTime().Equal(modTime) {
+			t.Errorf("got size %v mod time %v, want size %v mod time %v", info.Size(), info.ModTime(), 6, modTime)
+		}
+
+		info, err = fsys.Stat("js/lib")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.IsDir() {
+			t.Error("got non-directory, want directory")
+		}
+	})
+
+	t.Run("not exist", func(t *testing.T) {
+		for _, name := range []string{"missing.html", "../other/secret.txt", "missing"} {
+			if _, err := fsys.Open(name); !errors.Is(err, fs.ErrNotExist) && !errors.Is(err, fs.ErrInvalid) {
+				t.Errorf("%s: got error %v, want not exist", name, err)
+			}
+		}
+		if _, err := fsys.Stat("missing"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("got error %v, want %v", err, fs.ErrNotExist)
+		}
+	})
+
+	t.Run("client error", func(t *testing.T) {
+		errClient := errors.New("access denied")
+		fsys := objectfs.New(&mockClient{err: errClient}, "")
+		if _, err := fsys.Open("index.html"); !errors.Is(err, errClient) {
+			t.Errorf("got error %v, want %v", err, errClient)
+		}
+	})
+}
+
+type mockClient struct {
+	objects map[string]string
+	modTime time.Time
+	err     error
+}
+
+func (c *mockClient) GetObject(_ context.Context, key string) (io.ReadCloser, objectfs.ObjectInfo, error) {
+	info, err := c.HeadObject(context.Background(), key)
+	if err != nil {
+		return nil, objectfs.ObjectInfo{}, err
+	}
+	return io.NopCloser(strings.NewReader(c.objects[key])), info, nil
+}
+
+func (c *mockClient) HeadObject(_ context.Context, key string) (objectfs.ObjectInfo, error) {
+	if c.err != nil {
+		return objectfs.ObjectInfo{}, c.err
+	}
+	data, ok := c.objects[key]
+	if !ok {
+		return objectfs.ObjectInfo{}, fs.ErrNotExist
+	}
+	return objectfs.ObjectInfo{Key: key, Size: int64(len(data)), LastModified: c.modTime}, nil
+}
+
+func (c *mockClient) ListObjects(_ context.Context, prefix, delimiter string) (objects []objectfs.ObjectInfo, commonPrefixes []string, err error) {
+	if c.err != nil {
+		return nil, nil, c.err
+	}
+	seen := make(map[string]struct{})
+	for key, data := range c.objects {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+			p := key[:len(prefix)+i+1]
+			if _, ok := seen[p]; !ok {
+				seen[p] = struct{}{}
+				commonPrefixes = append(commonPrefixes, p)
+			}
+			continue
+		}
+		objects = append(objects, objectfs.ObjectInfo{Key: key, Size: int64(len(data)), LastModified: c.modTime})
+	}
+	sort.Strings(commonPrefixes)
+	return objects, commonPrefixes, nil
+}
@@ -0,0 +1,330 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+var (
+	_ fs.FS         = (*PathValidationFS)(nil)
+	_ fs.GlobFS     = (*PathValidationFS)(nil)
+	_ fs.ReadDirFS  = (*PathValidationFS)(nil)
+	_ fs.ReadFileFS = (*PathValidationFS)(nil)
+	_ fs.StatFS     = (*PathValidationFS)(nil)
+	_ fs.SubFS      = (*PathValidationFS)(nil)
+	_ ReadLinkFS    = (*PathValidationFS)(nil)
+)
+
+// ErrPathNotAllowed is the error that PathValidationError wraps.
+var ErrPathNotAllowed = errors.New("path not allowed")
+
+// PathValidationError is returned by PathValidationFS when a path violates
+// one of its rules.
+type PathValidationError struct {
+	// Rule is "length", "depth", "rune", "component" or "symlink".
+	Rule string
+	// Limit is the configured maximal length or depth for the "length" and
+	// "depth" rules.
+	Limit int
+	// Rune is the rune that is not allowed for the "rune" rule.
+	Rune rune
+	// Component is the banned path element for the "component" rule, or the
+	// path of the symbolic link for the "symlink" rule.
+	Component string
+}
+
+// Error implements error interface.
+func (e *PathValidationError) Error() string {
+	switch e.Rule {
+	case "length", "depth":
+		return fmt.Sprintf("%v: %v limit %v", ErrPathNotAllowed, e.Rule, e.Limit)
+	case "rune":
+		return fmt.Sprintf("%v: rune %q", ErrPathNotAllowed, e.Rune)
+	case "component":
+		return fmt.Sprintf("%v: component %q", ErrPathNotAllowed, e.Component)
+	case "symlink":
+		return fmt.Sprintf("%v: symbolic link %q", ErrPathNotAllowed, e.Component)
+	}
+	return ErrPathNotAllowed.Error()
+}
+
+// Unwrap returns ErrPathNotAllowed.
+func (e *PathValidationError) Unwrap() error {
+	return ErrPathNotAllowed
+}
+
+// PathValidationFSOption is used to provide optional parameters to
+// NewPathValidationFS function.
+type PathValidationFSOption func(*pathValidationFSOptions)
+
+type pathValidationFSOptions struct {
+	maxLength        int
+	maxDepth         int
+	allowedRune      func(r rune) bool
+	bannedComponents map[string]struct{}
+	rejectSymlinks   bool
+}
+
+// WithMaxPathLength limits the length of paths in bytes.
+func WithMaxPathLength(n int) PathValidationFSOption {
+	return func(o *pathValidationFSOptions) {
+		o.maxLength = n
+	}
+}
+
+// WithMaxPathDepth limits the number of path elements, so that depth 1 allows
+// only files in the root directory.
+func WithMaxPathDepth(n int) PathValidationFSOption {
+	return func(o *pathValidationFSOptions) {
+		o.maxDepth = n
+	}
+}
+
+// WithAllowedRunes allows only paths with runes, except the "/" separator, for
+// which the allowed function returns true.
+func WithAllowedRunes(allowed func(r rune) bool) PathValidationFSOption {
+	return func(o *pathValidationFSOptions) {
+		o.allowedRune = allowed
+	}
+}
+
+// WithBannedComponents rejects paths with any element equal to one of the
+// components, for example ".git" or "node_modules".
+func WithBannedComponents(components ...string) PathValidationFSOption {
+	return func(o *pathValidationFSOptions) {
+		if o.bannedComponents == nil {
+			o.bannedComponents = make(map[string]struct{})
+		}
+		for _, c := range components {
+			o.bannedComponents[c] = struct{}{}
+		}
+	}
+}
+
+// WithRejectSymlinks rejects paths where the file or any of its parent
+// directories is a symbolic link in the underlying filesystem, so that links
+// can not be used to reach files that other rules do not allow, for example
+// outside of the directory of an os.DirFS. Links are detected with the Lstat
+// function, which detects none if the underlying filesystem does not
+// implement ReadLinkFS.
+func WithRejectSymlinks() PathValidationFSOption {
+	return func(o *pathValidationFSOptions) {
+		o.rejectSymlinks = true
+	}
+}
+
+// PathValidationFS is a filesystem that validates paths against its rules
+// before passing them to another filesystem. Paths that are not valid return a
+// PathValidationError wrapped in fs.PathError, and directory entries and glob
+// matches that are not valid are omitted. The intended usage is to centralize
+// validation of user provided paths.
+type PathValidationFS struct {
+	fsys fs.FS
+	o    pathValidationFSOptions
+}
+
+// NewPathValidationFS returns a new instance of PathValidationFS. Without any
+// options, all paths are valid.
+func NewPathValidationFS(fsys fs.FS, opts ...PathValidationFSOption) *PathValidationFS {
+	var o pathValidationFSOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &PathValidationFS{
+		fsys: fsys,
+		o:    o,
+	}
+}
+
+// Validate returns PathValidationError if the path violates any of the rules.
+// The root directory "." is always valid. With the WithRejectSymlinks option,
+// errors of the underlying filesystem other than fs.ErrNotExist are returned
+// as well.
+func (s *PathValidationFS) Validate(name string) error {
+	if err := s.validateName(name); err != nil {
+		return err
+	}
+	if s.o.rejectSymlinks {
+		return s.validateSymlinks(name)
+	}
+	return nil
+}
+
+// validateName validates the path against the rules that do not depend on
+// the underlying filesystem.
+func (s *PathValidationFS) validateName(name string) error {
+	if name == "." {
+		return nil
+	}
+	if s.o.maxLength > 0 && len(name) > s.o.maxLength {
+		return &PathValidationError{Rule: "length", Limit: s.o.maxLength}
+	}
+	components := strings.Split(name, "/")
+	if s.o.maxDepth > 0 && len(components) > s.o.maxDepth {
+		return &PathValidationError{Rule: "depth", Limit: s.o.maxDepth}
+	}
+	if s.o.allowedRune != nil {
+		for _, r := range name {
+			if r != '/' && !s.o.allowedRune(r) {
+				return &PathValidationError{Rule: "rune", Rune: r}
+			}
+		}
+	}
+	for _, c := range components {
+		if _, ok := s.o.bannedComponents[c]; ok {
+			return &PathValidationError{Rule: "component", Component: c}
+		}
+	}
+	return nil
+}
+
+// Open implements fs.FS interface.
+func (s *PathValidationFS) Open(name string) (fs.File, error) {
+	if err := s.Validate(name); err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &pathValidationFile{wrappedFile: wrappedFile{File: f, name: name}, pathValidationFS: s}, nil
+}
+
+// Glob implements fs.GlobFS interface.
+func (s *PathValidationFS) Glob(pattern string) ([]string, error) {
+	matches, err := fs.Glob(s.fsys, pattern)
+	if err != nil {
+		return nil, err
+	}
+	valid := matches[:0]
+	for _, m := range matches {
+		if s.Validate(m) == nil {
+			valid = append(valid, m)
+		}
+	}
+	if len(valid) == 0 {
+		return nil, nil
+	}
+	return valid, nil
+}
+
+// ReadDir implements fs.ReadDirFS interface.
+func (s *PathValidationFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if err := s.Validate(name); err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	entries, err := fs.ReadDir(s.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	return s.entries(name, entries), nil
+}
+
+// ReadFile implements fs.ReadFileFS interface.
+func (s *PathValidationFS) ReadFile(name string) ([]byte, error) {
+	if err := s.Validate(name); err != nil {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: err}
+	}
+	return fs.ReadFile(s.fsys, name)
+}
+
+// Stat implements fs.StatFS interface.
+func (s *PathValidationFS) Stat(name string) (fs.FileInfo, error) {
+	if err := s.Validate(name); err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return fs.Stat(s.fsys, name)
+}
+
+// ReadLink implements ReadLinkFS interface.
+func (s *PathValidationFS) ReadLink(name string) (string, error) {
+	if err := s.Validate(name); err != nil {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: err}
+	}
+	return ReadLink(s.fsys, name)
+}
+
+// Lstat implements ReadLinkFS interface.
+func (s *PathValidationFS) Lstat(name string) (fs.FileInfo, error) {
+	if err := s.Validate(name); err != nil {
+		return nil, &fs.PathError{Op: "lstat", Path: name, Err: err}
+	}
+	return Lstat(s.fsys, name)
+}
+
+// Sub implements fs.SubFS interface.
+func (s *PathValidationFS) Sub(dir string) (fs.FS, error) {
+	return newSubFS(s, dir)
+}
+
+// Unwrap returns the underlying filesystem.
+func (s *PathValidationFS) Unwrap() fs.FS {
+	return s.fsys
+}
+
+// validateSymlinks returns PathValidationError for the first element of the
+// path that is a symbolic link. Paths that do not exist are valid, so that the
+// underlying filesystem reports them.
+func (s *PathValidationFS) validateSymlinks(name string) error {
+	if name == "." {
+		return nil
+	}
+	for i := 0; i <= len(name); i++ {
+		if i < len(name) && name[i] != '/' {
+			continue
+		}
+		p := name[:i]
+		info, err := Lstat(s.fsys, p)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return &PathValidationError{Rule: "symlink", Component: p}
+		}
+	}
+	return nil
+}
+
+// entries returns only directory entries with valid paths. Parent directories
+// are already validated, so that symbolic links are detected by entry types.
+func (s *PathValidationFS) entries(dir string, entries []fs.DirEntry) []fs.DirEntry {
+	valid := entries[:0]
+	for _, e := range entries {
+		if s.o.rejectSymlinks && e.Type()&fs.ModeSymlink != 0 {
+			continue
+		}
+		if s.validateName(path.Join(dir, e.Name())) == nil {
+			valid = append(valid, e)
+		}
+	}
+	return valid
+}
+
+type pathValidationFile struct {
+	wrappedFile
+	pathValidationFS *PathValidationFS
+}
+
+func (f *pathValidationFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	for {
+		entries, err := f.wrappedFile.ReadDir(n)
+		valid := f.pathValidationFS.entries(f.name, entries)
+		// Read more entries if all of them are omitted, as an empty slice
+		// with nil error is not allowed when n > 0.
+		if n > 0 && len(valid) == 0 && err == nil {
+			continue
+		}
+		return valid, err
+	}
+}
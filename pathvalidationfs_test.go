@@ -0,0 +1,112 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"testing"
+	"testing/fstest"
+	"unicode"
+
+	"resenje.org/fsutil"
+)
+
+func TestPathValidationFS(t *testing.T) {
+	fsys := fsutil.NewPathValidationFS(fsutil.MapFS{
+		"index.html":             {Data: []byte("<html>")},
+		"assets/app.css":         {Data: []byte("body{}")},
+		"assets/a/b/deep.css":    {Data: []byte("deep")},
+		".git/config":            {Data: []byte("[core]")},
+		"Ünïcode.txt":            {Data: []byte("text")},
+		"very-long-file-name.js": {Data: []byte("long()")},
+	},
+		fsutil.WithMaxPathLength(20),
+		fsutil.WithMaxPathDepth(3),
+		fsutil.WithAllowedRunes(func(r rune) bool {
+			return r < unicode.MaxASCII && r != ' '
+		}),
+		fsutil.WithBannedComponents(".git"),
+	)
+
+	if err := fstest.TestFS(fsys, "index.html", "assets/app.css"); err != nil {
+		t.Fatal(err)
+	}
+
+	testOpen(t, fsys, "index.html", "<html>")
+	testReadFile(t, fsys, "assets/app.css", "body{}")
+	testGlob(t, fsys, "*", []string{"assets", "index.html"})
+
+	for _, tc := range []struct {
+		name string
+		want fsutil.PathValidationError
+	}{
+		{name: "very-long-file-name.js", want: fsutil.PathValidationError{Rule: "length", Limit: 20}},
+		{name: "assets/a/b/deep.css", want: fsutil.PathValidationError{Rule: "depth", Limit: 3}},
+		{name: "Ünïcode.txt", want: fsutil.PathValidationError{Rule: "rune", Rune: 'Ü'}},
+		{name: "my file.txt", want: fsutil.PathValidationError{Rule: "rune", Rune: ' '}},
+		{name: ".git/config", want: fsutil.PathValidationError{Rule: "component", Component: ".git"}},
+	} {
+		_, err := fsys.Open(tc.name)
+		if !errors.Is(err, fsutil.ErrPathNotAllowed) {
+			t.Fatalf("%s: got error %v, want %v", tc.name, err, fsutil.ErrPathNotAllowed)
+		}
+		var verr *fsutil.PathValidationError
+		if !errors.As(err, &verr) {
+			t.Fatalf("%s: got error %T, want %T", tc.name, err, verr)
+		}
+		if *verr != tc.want {
+			t.Errorf("%s: got error %+v, want %+v", tc.name, *verr, tc.want)
+		}
+		if _, err := fs.Stat(fsys, tc.name); !errors.Is(err, fsutil.ErrPathNotAllowed) {
+			t.Errorf("%s: got stat error %v, want %v", tc.name, err, fsutil.ErrPathNotAllowed)
+		}
+	}
+
+	entries, err := fs.ReadDir(fsys, "assets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("got %v entries, want %v", len(entries), 2)
+	}
+}
+
+func TestPathValidationFS_rejectSymlinks(t *testing.T) {
+	dirFS := os.DirFS(newSymlinkDir(t))
+	if _, ok := dirFS.(fsutil.ReadLinkFS); !ok {
+		t.Skip("os.DirFS does not support reading links")
+	}
+	fsys := fsutil.NewPathValidationFS(dirFS, fsutil.WithRejectSymlinks())
+
+	testReadFile(t, fsys, "assets/main.css", "body{}")
+
+	for _, name := range []string{"assets/link.css", "static", "static/main.css"} {
+		_, err := fsys.ReadFile(name)
+		var e *fsutil.PathValidationError
+		if !errors.As(err, &e) || e.Rule != "symlink" {
+			t.Errorf("got error %v for %q, want symlink rule error", err, name)
+		}
+	}
+
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "assets" {
+		t.Errorf("got entries %v, want only assets", entries)
+	}
+	entries, err = fs.ReadDir(fsys, "assets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "main.css" {
+		t.Errorf("got entries %v, want only main.css", entries)
+	}
+
+	testReadFileNotExist(t, fsys, "assets/missing.css")
+}
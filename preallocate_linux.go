@@ -0,0 +1,23 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"os"
+	"syscall"
+)
+
+// fallocKeepSize is the FALLOC_FL_KEEP_SIZE fallocate mode flag.
+const fallocKeepSize = 0x01
+
+// preallocate reserves disk space for size bytes of the file without changing
+// its size, if the filesystem supports it.
+func preallocate(f *os.File, size int64) error {
+	if size <= 0 {
+		return nil
+	}
+	return syscall.Fallocate(int(f.Fd()), fallocKeepSize, 0, size)
+}
@@ -0,0 +1,20 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package fsutil
+
+import (
+	"errors"
+	"os"
+)
+
+// preallocate reserves disk space for size bytes of the file without changing
+// its size, if the filesystem supports it.
+func preallocate(f *os.File, size int64) error {
+	return errors.New("file preallocation not supported")
+}
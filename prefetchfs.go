@@ -0,0 +1,266 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"io"
+	"io/fs"
+	"sync"
+)
+
+var (
+	_ fs.FS         = (*prefetchFS)(nil)
+	_ fs.ReadDirFS  = (*prefetchFS)(nil)
+	_ fs.ReadFileFS = (*prefetchFS)(nil)
+	_ fs.StatFS     = (*prefetchFS)(nil)
+	_ fs.SubFS      = (*prefetchFS)(nil)
+	_ ReadLinkFS    = (*prefetchFS)(nil)
+)
+
+// defaultPrefetchWindow is the number of bytes that are read ahead if the
+// window passed to PrefetchFS is not positive.
+const defaultPrefetchWindow = 1 << 20
+
+// prefetchChunkSize is the maximal number of bytes read from the underlying
+// file at once.
+const prefetchChunkSize = 64 * 1024
+
+// PrefetchFS returns a filesystem that starts reading files in the background
+// as soon as they are opened, keeping up to window bytes ahead of the reader
+// in memory. It improves throughput of sequential reads from filesystems with
+// high latency, such as remote filesystems, as the latency of reads overlaps
+// with the processing of already read data. If the window is not positive,
+// 1 MiB is used. Seeking discards the prefetched data and prefetching
+// continues from the new offset. Directories are not prefetched.
+func PrefetchFS(fsys fs.FS, window int) fs.FS {
+	if window <= 0 {
+		window = defaultPrefetchWindow
+	}
+	return &prefetchFS{
+		fsys:   fsys,
+		window: window,
+	}
+}
+
+type prefetchFS struct {
+	fsys   fs.FS
+	window int
+}
+
+func (s *prefetchFS) Open(name string) (fs.File, error) {
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		return f, nil
+	}
+	return newPrefetchFile(name, f, s.window), nil
+}
+
+func (s *prefetchFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(s.fsys, name)
+}
+
+func (s *prefetchFS) ReadFile(name string) ([]byte, error) {
+	return fs.ReadFile(s.fsys, name)
+}
+
+func (s *prefetchFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(s.fsys, name)
+}
+
+func (s *prefetchFS) ReadLink(name string) (string, error) {
+	return ReadLink(s.fsys, name)
+}
+
+func (s *prefetchFS) Lstat(name string) (fs.FileInfo, error) {
+	return Lstat(s.fsys, name)
+}
+
+func (s *prefetchFS) Sub(dir string) (fs.FS, error) {
+	return newSubFS(s, dir)
+}
+
+func (s *prefetchFS) Unwrap() fs.FS {
+	return s.fsys
+}
+
+// prefetchFile reads the underlying file in a separate goroutine into a
+// buffer from which the Read method returns data.
+type prefetchFile struct {
+	wrappedFile
+	window int
+
+	buf     []byte // prefetched data is in buf[r:w]
+	r, w    int
+	err     error // error returned by the underlying file
+	stopped bool  // set to stop the prefetching goroutine
+	closed  bool
+	done    chan struct{}
+	cond    *sync.Cond
+	mu      sync.Mutex
+}
+
+func newPrefetchFile(name string, f fs.File, window int) *prefetchFile {
+	pf := &prefetchFile{
+		wrappedFile: wrappedFile{File: f, name: name},
+		window:      window,
+		buf:         make([]byte, window),
+	}
+	pf.cond = sync.NewCond(&pf.mu)
+	pf.start()
+	return pf
+}
+
+// start starts the prefetching goroutine, if the file is not closed.
+func (f *prefetchFile) start() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return
+	}
+	f.stopped = false
+	f.done = make(chan struct{})
+	go f.prefetch(f.done)
+}
+
+// prefetch reads the underlying file until the end of file, an error or until
+// it is stopped, waiting for the reader when the buffer is full.
+func (f *prefetchFile) prefetch(done chan struct{}) {
+	defer close(done)
+
+	chunk := make([]byte, prefetchChunkSize)
+	for {
+		f.mu.Lock()
+		for f.w-f.r >= f.window && !f.stopped {
+			f.cond.Wait()
+		}
+		if f.stopped {
+			f.mu.Unlock()
+			return
+		}
+		size := f.window - (f.w - f.r)
+		f.mu.Unlock()
+
+		if size > len(chunk) {
+			size = len(chunk)
+		}
+		n, err := f.File.Read(chunk[:size])
+
+		f.mu.Lock()
+		if n > 0 {
+			if f.w+n > len(f.buf) {
+				// move the unread data to the beginning of the buffer
+				f.w = copy(f.buf, f.buf[f.r:f.w])
+				f.r = 0
+			}
+			f.w += copy(f.buf[f.w:], chunk[:n])
+		}
+		if err != nil {
+			f.err = err
+		}
+		f.cond.Broadcast()
+		f.mu.Unlock()
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// stop stops the prefetching goroutine and waits for it to return.
+func (f *prefetchFile) stop() {
+	f.mu.Lock()
+	f.stopped = true
+	f.cond.Broadcast()
+	done := f.done
+	f.mu.Unlock()
+	<-done
+}
+
+func (f *prefetchFile) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrClosed}
+	}
+	for f.r == f.w && f.err == nil && !f.stopped {
+		f.cond.Wait()
+	}
+	if f.r == f.w {
+		if f.err != nil {
+			return 0, f.err
+		}
+		// Prefetching is stopped by Close or Seek.
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrClosed}
+	}
+	n := copy(p, f.buf[f.r:f.w])
+	f.r += n
+	if f.r == f.w {
+		f.r, f.w = 0, 0
+	}
+	f.cond.Broadcast()
+	return n, nil
+}
+
+func (f *prefetchFile) Seek(offset int64, whence int) (int64, error) {
+	s, ok := f.File.(io.Seeker)
+	if !ok {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: ErrNotSeekable}
+	}
+
+	f.mu.Lock()
+	closed := f.closed
+	f.mu.Unlock()
+	if closed {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrClosed}
+	}
+
+	f.stop()
+	defer f.start()
+
+	f.mu.Lock()
+	// The offset of the underlying file is ahead of the reader by the
+	// number of prefetched bytes.
+	if whence == io.SeekCurrent {
+		offset -= int64(f.w - f.r)
+	}
+	f.r, f.w = 0, 0
+	f.err = nil
+	f.mu.Unlock()
+	return s.Seek(offset, whence)
+}
+
+func (f *prefetchFile) Close() error {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	f.stopped = true
+	f.cond.Broadcast()
+	done := f.done
+	f.mu.Unlock()
+
+	// The underlying file is closed before waiting for the prefetching
+	// goroutine, so that its blocked read returns.
+	err := f.File.Close()
+	<-done
+	return err
+}
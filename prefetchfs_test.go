@@ -0,0 +1,212 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestPrefetchFS(t *testing.T) {
+	data := make([]byte, 100000)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	files := fstest.MapFS{
+		"dir/file.bin": {Data: data},
+	}
+
+	fsys := fsutil.PrefetchFS(files, 1000)
+
+	if err := fstest.TestFS(fsys, "dir/file.bin"); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("read", func(t *testing.T) {
+		f, err := fsys.Open("dir/file.bin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		got, err := io.ReadAll(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Error("got different data")
+		}
+	})
+
+	t.Run("seek", func(t *testing.T) {
+		f, err := fsys.Open("dir/file.bin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		buf := make([]byte, 10)
+		if _, err := io.ReadFull(f, buf); err != nil {
+			t.Fatal(err)
+		}
+		s := f.(io.Seeker)
+		offset, err := s.Seek(5, io.SeekCurrent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if offset != 15 {
+			t.Errorf("got offset %v, want %v", offset, 15)
+		}
+		if _, err := io.ReadFull(f, buf); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf, data[15:25]) {
+			t.Errorf("got data %v, want %v", buf, data[15:25])
+		}
+
+		if _, err := s.Seek(-3, io.SeekEnd); err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data[len(data)-3:]) {
+			t.Errorf("got data %v, want %v", got, data[len(data)-3:])
+		}
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		f, err := fsys.Open("dir/file.bin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Read(make([]byte, 10)); !errors.Is(err, fs.ErrClosed) {
+			t.Errorf("got error %v, want %v", err, fs.ErrClosed)
+		}
+	})
+}
+
+func TestPrefetchFS_readAhead(t *testing.T) {
+	files := fstest.MapFS{
+		"file.bin": {Data: make([]byte, 10000)},
+	}
+	var read int64
+	fsys := fsutil.PrefetchFS(fsutil.FSFunc(func(name string) (fs.File, error) {
+		f, err := files.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		return &countingReadFile{File: f, read: &read}, nil
+	}), 4000)
+
+	f, err := fsys.Open("file.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// the window is filled without any read from the returned file
+	deadline := time.Now().Add(10 * time.Second)
+	for atomic.LoadInt64(&read) < 4000 {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %v prefetched bytes, want %v", atomic.LoadInt64(&read), 4000)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if n := atomic.LoadInt64(&read); n != 4000 {
+		t.Errorf("got %v prefetched bytes, want %v", n, 4000)
+	}
+
+	if _, err := io.ReadFull(f, make([]byte, 1000)); err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 9000 {
+		t.Errorf("got %v bytes, want %v", len(got), 9000)
+	}
+}
+
+func TestPrefetchFS_closeWhileReading(t *testing.T) {
+	files := fstest.MapFS{
+		"file.bin": {Data: make([]byte, 100)},
+	}
+	fsys := fsutil.PrefetchFS(fsutil.FSFunc(func(name string) (fs.File, error) {
+		f, err := files.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		return &blockingReadFile{File: f, closed: make(chan struct{})}, nil
+	}), 4000)
+
+	f, err := fsys.Open("file.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := f.Read(make([]byte, 10))
+		errc <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-errc:
+		if !errors.Is(err, fs.ErrClosed) {
+			t.Errorf("got error %v, want %v", err, fs.ErrClosed)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout waiting for read to return")
+	}
+}
+
+// blockingReadFile blocks reads until the file is closed.
+type blockingReadFile struct {
+	fs.File
+	closed chan struct{}
+}
+
+func (f *blockingReadFile) Read(p []byte) (int, error) {
+	<-f.closed
+	return 0, fs.ErrClosed
+}
+
+func (f *blockingReadFile) Close() error {
+	close(f.closed)
+	return f.File.Close()
+}
+
+// countingReadFile counts bytes read from the file.
+type countingReadFile struct {
+	fs.File
+	read *int64
+}
+
+func (f *countingReadFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	atomic.AddInt64(f.read, int64(n))
+	return n, err
+}
@@ -0,0 +1,286 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"fmt"
+	"io/fs"
+	"sync"
+)
+
+var (
+	_ fs.FS         = (*PreloadFS)(nil)
+	_ fs.GlobFS     = (*PreloadFS)(nil)
+	_ fs.ReadDirFS  = (*PreloadFS)(nil)
+	_ fs.ReadFileFS = (*PreloadFS)(nil)
+	_ fs.StatFS     = (*PreloadFS)(nil)
+	_ fs.SubFS      = (*PreloadFS)(nil)
+)
+
+// PreloadOption sets an optional parameter of the Preload function.
+type PreloadOption func(*preloadOptions)
+
+type preloadOptions struct {
+	mmap        bool
+	mmapMinSize int64
+}
+
+// WithPreloadMmap makes Preload memory-map files of at least minSize bytes,
+// instead of reading them into the heap, which keeps large files such as
+// videos out of the garbage collected memory. Only files that are operating
+// system files, or expose them as reported by RawFile, such as files opened
+// from os.DirFS, are mapped. Files are read into memory if memory mapping is
+// not supported on the platform or if it fails.
+//
+// Mapped files must not be truncated while they are preloaded, as reading
+// their content past the new end of file terminates the process. Mappings are
+// private to the process, but changes of the file content by other processes
+// may be visible. The Release method unmaps the files.
+func WithPreloadMmap(minSize int64) PreloadOption {
+	return func(o *preloadOptions) {
+		o.mmap = true
+		o.mmapMinSize = minSize
+	}
+}
+
+// PreloadFS is a filesystem with files and directories loaded by the Preload
+// function.
+type PreloadFS struct {
+	fsys     MapFS
+	mappings map[string][]byte // memory-mapped file content by path
+
+	open     int // number of open memory-mapped files
+	released bool
+	mu       sync.RWMutex
+}
+
+// Preload reads all files and directories from the filesystem into memory and
+// returns a filesystem that serves them without accessing fsys again. Files of
+// the returned filesystem implement io.Seeker and io.ReaderAt. File modes and
+// modification times are preserved. Symbolic links to directories are followed
+// and their files are preloaded. It is intended for small sets of assets
+// stored on filesystems with high latency. The Release method should be called
+// when the filesystem is not needed anymore if the WithPreloadMmap option is
+// used.
+func Preload(fsys fs.FS, opts ...PreloadOption) (*PreloadFS, error) {
+	var o preloadOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	s := &PreloadFS{
+		mappings: make(map[string][]byte),
+	}
+	m, err := preload(fsys, o, s.mappings)
+	if err != nil {
+		s.unmap()
+		return nil, fmt.Errorf("preload: %w", err)
+	}
+	s.fsys = m
+	return s, nil
+}
+
+// Release frees the memory and unmaps memory-mapped files. After it is called,
+// all methods return errors that wrap fs.ErrClosed. Memory-mapped files that
+// are open are unmapped when the last of them is closed.
+func (s *PreloadFS) Release() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.released {
+		return nil
+	}
+	s.released = true
+	s.fsys = nil
+	if s.open == 0 {
+		return s.unmap()
+	}
+	return nil
+}
+
+// unmap unmaps all memory-mapped files.
+func (s *PreloadFS) unmap() error {
+	var err error
+	for path, data := range s.mappings {
+		if uerr := munmap(data); uerr != nil && err == nil {
+			err = fmt.Errorf("unmap %s: %w", path, uerr)
+		}
+		delete(s.mappings, path)
+	}
+	return err
+}
+
+// Open implements fs.FS interface.
+func (s *PreloadFS) Open(name string) (fs.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.released {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrClosed}
+	}
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := s.mappings[name]; !ok {
+		return f, nil
+	}
+	s.open++
+	return &preloadMmapFile{memFile: f.(*memFile), preloadFS: s}, nil
+}
+
+// Glob implements fs.GlobFS interface.
+func (s *PreloadFS) Glob(pattern string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.released {
+		return nil, &fs.PathError{Op: "glob", Path: pattern, Err: fs.ErrClosed}
+	}
+	return s.fsys.Glob(pattern)
+}
+
+// ReadDir implements fs.ReadDirFS interface.
+func (s *PreloadFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.released {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrClosed}
+	}
+	return s.fsys.ReadDir(name)
+}
+
+// ReadFile implements fs.ReadFileFS interface.
+func (s *PreloadFS) ReadFile(name string) ([]byte, error) {
+	// The lock is held while the data is copied, so that memory-mapped files
+	// are not unmapped in the meantime.
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.released {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrClosed}
+	}
+	return s.fsys.ReadFile(name)
+}
+
+// Stat implements fs.StatFS interface.
+func (s *PreloadFS) Stat(name string) (fs.FileInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.released {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrClosed}
+	}
+	return s.fsys.Stat(name)
+}
+
+// Sub implements fs.SubFS interface.
+func (s *PreloadFS) Sub(dir string) (fs.FS, error) {
+	return newSubFS(s, dir)
+}
+
+// preloadMmapFile is an open file with memory-mapped content that keeps the
+// mapping until it is closed.
+type preloadMmapFile struct {
+	*memFile
+	preloadFS *PreloadFS
+	closeOnce sync.Once
+}
+
+func (f *preloadMmapFile) Close() error {
+	var err error
+	f.closeOnce.Do(func() {
+		s := f.preloadFS
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.open--
+		if s.released && s.open == 0 {
+			err = s.unmap()
+		}
+	})
+	return err
+}
+
+// preload reads all files and directories from the filesystem into a MapFS.
+// Content of memory-mapped files is added to mappings.
+func preload(fsys fs.FS, o preloadOptions, mappings map[string][]byte) (MapFS, error) {
+	m := make(MapFS)
+	err := fs.WalkDir(fsys, ".", preloadWalkFunc(fsys, o, mappings, m, 0))
+	return m, err
+}
+
+// preloadWalkFunc returns a function that adds files and directories to m.
+// Symbolic links to directories are followed up to maxSymlinkDepth levels.
+func preloadWalkFunc(fsys fs.FS, o preloadOptions, mappings map[string][]byte, m MapFS, depth int) fs.WalkDirFunc {
+	return func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			target, err := fs.Stat(fsys, path)
+			if err != nil {
+				return fmt.Errorf("stat link target %s: %w", path, err)
+			}
+			if target.IsDir() {
+				if depth >= maxSymlinkDepth {
+					return fmt.Errorf("follow link %s: too many levels of symbolic links", path)
+				}
+				return fs.WalkDir(fsys, path, preloadWalkFunc(fsys, o, mappings, m, depth+1))
+			}
+		}
+		f := &MapFile{
+			Mode:    info.Mode(),
+			ModTime: info.ModTime(),
+			Sys:     info.Sys(),
+		}
+		if !d.IsDir() {
+			if o.mmap && info.Size() >= o.mmapMinSize && info.Mode().IsRegular() {
+				data, err := preloadMmap(fsys, path)
+				if err != nil {
+					return err
+				}
+				if data != nil {
+					mappings[path] = data
+					f.Data = data
+					m[path] = f
+					return nil
+				}
+			}
+			data, err := fs.ReadFile(fsys, path)
+			if err != nil {
+				return err
+			}
+			f.Data = data
+		}
+		m[path] = f
+		return nil
+	}
+}
+
+// preloadMmap memory-maps the content of the file if it is an operating system
+// file. It returns nil data if the file can not be mapped.
+func preloadMmap(fsys fs.FS, path string) ([]byte, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	raw := RawFile(f)
+	if raw == nil {
+		return nil, nil
+	}
+	data, err := mmap(raw)
+	if err != nil {
+		return nil, nil
+	}
+	return data, nil
+}
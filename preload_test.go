@@ -0,0 +1,201 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestPreload(t *testing.T) {
+	modTime := time.Date(2021, 4, 20, 10, 0, 0, 0, time.UTC)
+	files := fstest.MapFS{
+		"index.html":  {Data: []byte("<html>"), Mode: 0o644, ModTime: modTime},
+		"css/app.css": {Data: []byte("body{}"), Mode: 0o600},
+		"empty":       {Mode: fs.ModeDir | 0o700, ModTime: modTime},
+	}
+
+	var opens int
+	fsys, err := fsutil.Preload(fsutil.FSFunc(func(name string) (fs.File, error) {
+		opens++
+		return files.Open(name)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opens = 0
+
+	if err := fstest.TestFS(fsys, "index.html", "css/app.css", "empty"); err != nil {
+		t.Fatal(err)
+	}
+
+	testOpen(t, fsys, "index.html", "<html>")
+	testOpen(t, fsys, "css/app.css", "body{}")
+
+	info, err := fs.Stat(fsys, "index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode() != 0o644 || !info.ModTime().Equal(modTime) {
+		t.Errorf("got mode %v mod time %v, want mode %v mod time %v", info.Mode(), info.ModTime(), fs.FileMode(0o644), modTime)
+	}
+
+	info, err = fs.Stat(fsys, "empty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode() != fs.ModeDir|0o700 {
+		t.Errorf("got mode %v, want %v", info.Mode(), fs.ModeDir|0o700)
+	}
+
+	f, err := fsys.Open("index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.(io.Seeker).Seek(1, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "html>" {
+		t.Errorf("got data %q, want %q", data, "html>")
+	}
+
+	if opens != 0 {
+		t.Errorf("got %v opens of the underlying filesystem, want none", opens)
+	}
+}
+
+func TestPreload_mmap(t *testing.T) {
+	dir := t.TempDir()
+	large := strings.Repeat("0123456789", 1000)
+	if err := os.WriteFile(filepath.Join(dir, "large.bin"), []byte(large), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "small.txt"), []byte("small"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys, err := fsutil.Preload(os.DirFS(dir), fsutil.WithPreloadMmap(1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fsys.Release()
+
+	if err := fstest.TestFS(fsys, "large.bin", "small.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	testOpen(t, fsys, "large.bin", large)
+	testOpen(t, fsys, "small.txt", "small")
+
+	f, err := fsys.Open("large.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	buf := make([]byte, 5)
+	if _, err := f.(io.ReaderAt).ReadAt(buf, 9995); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "56789" {
+		t.Errorf("got data %q, want %q", buf, "56789")
+	}
+	if _, err := f.(io.Seeker).Seek(-3, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "789" {
+		t.Errorf("got data %q, want %q", data, "789")
+	}
+
+	// Files that are open when the filesystem is released are unmapped when
+	// they are closed.
+	if err := fsys.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.(io.ReaderAt).ReadAt(buf, 0); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "01234" {
+		t.Errorf("got data %q, want %q", buf, "01234")
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.Open("large.bin"); !errors.Is(err, fs.ErrClosed) {
+		t.Errorf("got error %v, want %v", err, fs.ErrClosed)
+	}
+	if _, err := fsys.ReadFile("small.txt"); !errors.Is(err, fs.ErrClosed) {
+		t.Errorf("got error %v, want %v", err, fs.ErrClosed)
+	}
+}
+
+func TestPreload_symlinkDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links require privileges on windows")
+	}
+
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "assets", "main.css"), "body {}")
+	if err := os.Symlink("assets", filepath.Join(dir, "static")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(".", filepath.Join(dir, "assets", "loop")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fsutil.Preload(os.DirFS(dir)); err == nil {
+		t.Fatal("expected error for symbolic link loop")
+	}
+
+	if err := os.Remove(filepath.Join(dir, "assets", "loop")); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys, err := fsutil.Preload(os.DirFS(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fsys.Release()
+
+	if err := fstest.TestFS(fsys, "assets/main.css", "static/main.css"); err != nil {
+		t.Fatal(err)
+	}
+	testReadFile(t, fsys, "static/main.css", "body {}")
+	info, err := fsys.Stat("static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.IsDir() {
+		t.Errorf("got mode %v, want directory", info.Mode())
+	}
+}
+
+func TestPreload_error(t *testing.T) {
+	_, err := fsutil.Preload(fsutil.FSFunc(func(name string) (fs.File, error) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errTest1}
+	}))
+	if !errors.Is(err, errTest1) {
+		t.Fatalf("got error %v, want %v", err, errTest1)
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sync/atomic"
+)
+
+var (
+	_ fs.FS         = (*QuotaFS)(nil)
+	_ fs.GlobFS     = (*QuotaFS)(nil)
+	_ fs.ReadFileFS = (*QuotaFS)(nil)
+	_ fs.StatFS     = (*QuotaFS)(nil)
+	_ fs.SubFS      = (*QuotaFS)(nil)
+	_ ReadLinkFS    = (*QuotaFS)(nil)
+)
+
+// ErrQuotaExceeded is the error that QuotaExceededError wraps.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// QuotaExceededError is returned by QuotaFS when the limit of opened files or
+// read bytes is reached.
+type QuotaExceededError struct {
+	// Resource is "opens" or "bytes".
+	Resource string
+	// Limit is the configured limit of the resource.
+	Limit int64
+}
+
+// Error implements error interface.
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("%v: %v limit %v", ErrQuotaExceeded, e.Resource, e.Limit)
+}
+
+// Unwrap returns ErrQuotaExceeded.
+func (e *QuotaExceededError) Unwrap() error {
+	return ErrQuotaExceeded
+}
+
+// QuotaFS is a filesystem that limits the number of opened files and the total
+// number of bytes read from them. Method Derive returns a new instance with
+// the same limits and with its own counters, so that limits can be enforced
+// for every request. The intended usage is to protect template rendering
+// which accepts user controlled paths.
+type QuotaFS struct {
+	fsys     fs.FS
+	maxOpens int64
+	maxBytes int64
+
+	opens int64
+	bytes int64
+}
+
+// NewQuotaFS returns a new instance of QuotaFS. Limits that are not positive
+// are not enforced.
+func NewQuotaFS(fsys fs.FS, maxOpens, maxBytes int64) *QuotaFS {
+	return &QuotaFS{
+		fsys:     fsys,
+		maxOpens: maxOpens,
+		maxBytes: maxBytes,
+	}
+}
+
+// Derive returns a new instance of QuotaFS with the same filesystem and limits
+// and with zero usage.
+func (s *QuotaFS) Derive() *QuotaFS {
+	return NewQuotaFS(s.fsys, s.maxOpens, s.maxBytes)
+}
+
+// Open implements fs.FS interface.
+func (s *QuotaFS) Open(name string) (fs.File, error) {
+	if s.maxOpens > 0 && atomic.AddInt64(&s.opens, 1) > s.maxOpens {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: &QuotaExceededError{Resource: "opens", Limit: s.maxOpens}}
+	}
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &quotaFile{wrappedFile: wrappedFile{File: f, name: name}, quotaFS: s}, nil
+}
+
+// Glob implements fs.GlobFS interface.
+func (s *QuotaFS) Glob(pattern string) ([]string, error) {
+	return fs.Glob(s.fsys, pattern)
+}
+
+// ReadFile implements fs.ReadFileFS interface.
+func (s *QuotaFS) ReadFile(name string) ([]byte, error) {
+	f, err := s.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return io.ReadAll(f)
+}
+
+// Stat implements fs.StatFS interface.
+func (s *QuotaFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(s.fsys, name)
+}
+
+// ReadLink implements ReadLinkFS interface.
+func (s *QuotaFS) ReadLink(name string) (string, error) {
+	return ReadLink(s.fsys, name)
+}
+
+// Lstat implements ReadLinkFS interface.
+func (s *QuotaFS) Lstat(name string) (fs.FileInfo, error) {
+	return Lstat(s.fsys, name)
+}
+
+// Sub implements fs.SubFS interface.
+func (s *QuotaFS) Sub(dir string) (fs.FS, error) {
+	return newSubFS(s, dir)
+}
+
+// Unwrap returns the underlying filesystem.
+func (s *QuotaFS) Unwrap() fs.FS {
+	return s.fsys
+}
+
+// Usage returns the number of opened files and read bytes. The number of read
+// bytes includes bytes reserved by reads in progress.
+func (s *QuotaFS) Usage() (opens, bytes int64) {
+	opens = atomic.LoadInt64(&s.opens)
+	if s.maxOpens > 0 && opens > s.maxOpens {
+		opens = s.maxOpens
+	}
+	return opens, atomic.LoadInt64(&s.bytes)
+}
+
+type quotaFile struct {
+	wrappedFile
+	quotaFS *QuotaFS
+}
+
+func (f *quotaFile) Read(p []byte) (int, error) {
+	s := f.quotaFS
+	if s.maxBytes <= 0 {
+		n, err := f.File.Read(p)
+		atomic.AddInt64(&s.bytes, int64(n))
+		return n, err
+	}
+	reserved, ok := s.reserveBytes(int64(len(p)))
+	if !ok {
+		// Reading is allowed when the quota is used up only if the file
+		// ends, so that a file that fits exactly can be read to its end.
+		var b [1]byte
+		n, err := f.File.Read(b[:])
+		if n > 0 {
+			return 0, &fs.PathError{Op: "read", Path: f.name, Err: &QuotaExceededError{Resource: "bytes", Limit: s.maxBytes}}
+		}
+		return 0, err
+	}
+	n, err := f.File.Read(p[:reserved])
+	// Refund the part of the reservation that is not read.
+	atomic.AddInt64(&s.bytes, int64(n)-reserved)
+	return n, err
+}
+
+// reserveBytes reserves up to n bytes of the remaining quota, so that
+// concurrent reads can not exceed it, and returns the number of reserved
+// bytes. It returns false if the quota is used up.
+func (s *QuotaFS) reserveBytes(n int64) (reserved int64, ok bool) {
+	for {
+		used := atomic.LoadInt64(&s.bytes)
+		remaining := s.maxBytes - used
+		if remaining <= 0 {
+			return 0, false
+		}
+		if n > remaining {
+			n = remaining
+		}
+		if atomic.CompareAndSwapInt64(&s.bytes, used, used+n) {
+			return n, true
+		}
+	}
+}
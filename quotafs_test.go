@@ -0,0 +1,104 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"resenje.org/fsutil"
+)
+
+func TestQuotaFS(t *testing.T) {
+	fsys := fsutil.NewQuotaFS(fsutil.MapFS{
+		"header.html": {Data: []byte("<header>")},
+		"footer.html": {Data: []byte("<footer>")},
+		"large.html":  {Data: []byte("<main>0123456789</main>")},
+	}, 2, 30)
+
+	t.Run("opens", func(t *testing.T) {
+		fsys := fsys.Derive()
+
+		testReadFile(t, fsys, "header.html", "<header>")
+		testReadFile(t, fsys, "footer.html", "<footer>")
+
+		_, err := fsys.ReadFile("header.html")
+		var qerr *fsutil.QuotaExceededError
+		if !errors.As(err, &qerr) {
+			t.Fatalf("got error %v, want quota exceeded error", err)
+		}
+		if qerr.Resource != "opens" || qerr.Limit != 2 {
+			t.Errorf("got resource %q limit %v, want %q limit %v", qerr.Resource, qerr.Limit, "opens", 2)
+		}
+
+		opens, bytes := fsys.Usage()
+		if opens != 2 || bytes != 16 {
+			t.Errorf("got usage %v opens %v bytes, want 2 opens 16 bytes", opens, bytes)
+		}
+	})
+
+	t.Run("bytes", func(t *testing.T) {
+		fsys := fsys.Derive()
+
+		testReadFile(t, fsys, "header.html", "<header>")
+
+		if _, err := fsys.ReadFile("large.html"); !errors.Is(err, fsutil.ErrQuotaExceeded) {
+			t.Fatalf("got error %v, want %v", err, fsutil.ErrQuotaExceeded)
+		}
+	})
+
+	t.Run("exact bytes", func(t *testing.T) {
+		fsys := fsutil.NewQuotaFS(fsutil.MapFS{
+			"header.html": {Data: []byte("<header>")},
+		}, 0, 8)
+
+		testReadFile(t, fsys, "header.html", "<header>")
+
+		if _, err := fsys.ReadFile("header.html"); !errors.Is(err, fsutil.ErrQuotaExceeded) {
+			t.Fatalf("got error %v, want %v", err, fsutil.ErrQuotaExceeded)
+		}
+	})
+
+	t.Run("derived", func(t *testing.T) {
+		fsys := fsys.Derive()
+
+		testReadFile(t, fsys, "large.html", "<main>0123456789</main>")
+	})
+	t.Run("concurrent", func(t *testing.T) {
+		fsys := fsutil.NewQuotaFS(fsutil.MapFS{
+			"data.bin": {Data: bytes.Repeat([]byte{1}, 1000)},
+		}, 0, 1000)
+
+		var read int64
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				f, err := fsys.Open("data.bin")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				defer f.Close()
+				n, _ := io.Copy(io.Discard, f)
+				atomic.AddInt64(&read, n)
+			}()
+		}
+		wg.Wait()
+
+		if read != 1000 {
+			t.Errorf("got %v read bytes, want %v", read, 1000)
+		}
+		if _, bytes := fsys.Usage(); bytes != 1000 {
+			t.Errorf("got usage %v bytes, want %v", bytes, 1000)
+		}
+	})
+}
@@ -0,0 +1,31 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"io/fs"
+	"os"
+)
+
+// RawFile returns the *os.File that the file is, or that it wraps if the file
+// has a RawFile method returning *os.File. Otherwise, RawFile returns nil.
+// Files of filesystems in this package that wrap files of a single filesystem
+// without changing their content implement the RawFile method, so that the
+// operating system file can be passed to functions that optimize copying of
+// its content, such as io.Copy to a network connection that uses sendfile.
+//
+// The returned file shares the offset with the file that wraps it and it
+// should be used only to read the content. Reading directory entries from it
+// may skip the processing done by the wrapping file.
+func RawFile(f fs.File) *os.File {
+	switch f := f.(type) {
+	case *os.File:
+		return f
+	case interface{ RawFile() *os.File }:
+		return f.RawFile()
+	}
+	return nil
+}
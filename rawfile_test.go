@@ -0,0 +1,204 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestRawFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "data.txt"), []byte("raw data"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	hashedPath := func(fsys *fsutil.HashFS) string {
+		t.Helper()
+		p, err := fsys.HashedPath("data.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	backupFS, err := fsutil.NewBackupFS(os.DirFS(dir), t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hashFS := fsutil.NewHashFS(os.DirFS(dir), fsutil.NewMD5Hasher(8))
+	hashBackupFS := fsutil.NewHashFS(backupFS, fsutil.NewMD5Hasher(8))
+
+	for _, tc := range []struct {
+		name string
+		fsys fs.FS
+		open string
+	}{
+		{
+			name: "dir",
+			fsys: os.DirFS(dir),
+			open: "data.txt",
+		},
+		{
+			name: "hash",
+			fsys: hashFS,
+			open: hashedPath(hashFS),
+		},
+		{
+			name: "backup",
+			fsys: backupFS,
+			open: "data.txt",
+		},
+		{
+			name: "hash over backup",
+			fsys: hashBackupFS,
+			open: hashedPath(hashBackupFS),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := tc.fsys.Open(tc.open)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			raw := fsutil.RawFile(f)
+			if raw == nil {
+				t.Fatal("got no raw file")
+			}
+			data, err := io.ReadAll(raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != "raw data" {
+				t.Errorf("got data %q, want %q", data, "raw data")
+			}
+		})
+	}
+
+	t.Run("memory", func(t *testing.T) {
+		fsys := fsutil.NewHashFS(fstest.MapFS{"data.txt": {Data: []byte("raw data")}}, fsutil.NewMD5Hasher(8))
+		f, err := fsys.Open(hashedPath(fsys))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		if raw := fsutil.RawFile(f); raw != nil {
+			t.Errorf("got raw file %v, want nil", raw.Name())
+		}
+	})
+}
+
+func TestWriteTo(t *testing.T) {
+	var writeToCalls int
+	fsys := fsutil.FSFunc(func(name string) (fs.File, error) {
+		f, err := fstest.MapFS{"data.txt": {Data: []byte("copied data")}}.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := f.(fs.ReadDirFile); ok {
+			return f, nil
+		}
+		return &writerToFile{File: f, calls: &writeToCalls}, nil
+	})
+
+	backupFS, err := fsutil.NewBackupFS(fsys, t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashFS := fsutil.NewHashFS(fsys, fsutil.NewMD5Hasher(8))
+	hashedPath, err := hashFS.HashedPath("data.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		fsys fs.FS
+		open string
+	}{
+		{
+			name: "hash",
+			fsys: hashFS,
+			open: hashedPath,
+		},
+		{
+			name: "backup",
+			fsys: backupFS,
+			open: "data.txt",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := tc.fsys.Open(tc.open)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			if _, ok := f.(io.WriterTo); !ok {
+				t.Fatal("file does not implement io.WriterTo")
+			}
+
+			writeToCalls = 0
+			var buf strings.Builder
+			n, err := io.Copy(&buf, f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != int64(len("copied data")) || buf.String() != "copied data" {
+				t.Errorf("got %v bytes %q, want %q", n, buf.String(), "copied data")
+			}
+			if writeToCalls != 1 {
+				t.Errorf("got %v WriteTo calls of the underlying file, want 1", writeToCalls)
+			}
+		})
+	}
+
+	t.Run("raw file", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "data.txt"), []byte("raw data"), 0o666); err != nil {
+			t.Fatal(err)
+		}
+		fsys, err := fsutil.NewBackupFS(os.DirFS(dir), t.TempDir(), time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := fsys.Open("data.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		var buf strings.Builder
+		if _, err := io.Copy(&buf, f); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != "raw data" {
+			t.Errorf("got %q, want %q", buf.String(), "raw data")
+		}
+	})
+}
+
+// writerToFile counts calls of its WriteTo method.
+type writerToFile struct {
+	fs.File
+	calls *int
+}
+
+func (f *writerToFile) WriteTo(w io.Writer) (int64, error) {
+	*f.calls++
+	return io.Copy(w, struct{ io.Reader }{f.File})
+}
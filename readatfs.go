@@ -0,0 +1,228 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+)
+
+var (
+	_ fs.FS         = (*readerAtFS)(nil)
+	_ fs.GlobFS     = (*readerAtFS)(nil)
+	_ fs.ReadDirFS  = (*readerAtFS)(nil)
+	_ fs.ReadFileFS = (*readerAtFS)(nil)
+	_ fs.StatFS     = (*readerAtFS)(nil)
+	_ fs.SubFS      = (*readerAtFS)(nil)
+	_ io.ReaderAt   = (*readerAtFile)(nil)
+	_ io.ReadSeeker = (*readerAtSeekerFile)(nil)
+	_ ReadLinkFS    = (*readerAtFS)(nil)
+)
+
+// ReaderAtFSOption is used to provide optional parameters to ReaderAtFS
+// function.
+type ReaderAtFSOption func(*readerAtFSOptions)
+
+type readerAtFSOptions struct {
+	maxMemory int64
+	tmpDir    string
+}
+
+// WithReaderAtMaxMemory sets the size in bytes of the largest file content
+// that is kept in memory by ReaderAtFS. The content of larger files is written
+// to a temporary file. The default is 1 MiB.
+func WithReaderAtMaxMemory(n int64) ReaderAtFSOption {
+	return func(o *readerAtFSOptions) {
+		o.maxMemory = n
+	}
+}
+
+// WithReaderAtTempDir sets the directory for temporary files with the content
+// of files larger than the maximal memory size. By default, the default
+// directory for temporary files is used.
+func WithReaderAtTempDir(dir string) ReaderAtFSOption {
+	return func(o *readerAtFSOptions) {
+		o.tmpDir = dir
+	}
+}
+
+// ReaderAtFS returns a filesystem with regular files that always implement
+// io.ReaderAt, as it is required by archive/zip and other readers of formats
+// with data at arbitrary offsets. Files that implement io.ReaderAt are
+// returned as they are. Files that do not implement it, but expose the
+// underlying *os.File, as reported by RawFile, read at offsets from it. The
+// content of other files is spilled to memory or, if it is larger than the
+// maximal memory size, to a temporary file on the first ReadAt call, from the
+// file opened again, so that sequential reads are not affected. The temporary
+// file is removed when the file is closed.
+//
+// Files opened from os.DirFS, Preload, Snapshot, MapFS and from filesystems in
+// this package that return files of the underlying filesystem or forward
+// their io.ReaderAt, such as SeekableFS for seekable files, NotExistCacheFS,
+// StatCacheFS, ThrottleFS, VersionPinFS, ExpiringFS and
+// OnlyFilesModifiedAfterFS, implement io.ReaderAt if the underlying files
+// implement it. Files opened from BackupFS and HashFS expose the underlying
+// *os.File and other wrappers, such as PrefetchFS or LimitFS, hide
+// io.ReaderAt, for which ReaderAtFS can be used.
+func ReaderAtFS(fsys fs.FS, opts ...ReaderAtFSOption) fs.FS {
+	o := readerAtFSOptions{
+		maxMemory: defaultSeekableMaxMemory,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &readerAtFS{
+		fsys: fsys,
+		o:    o,
+	}
+}
+
+type readerAtFS struct {
+	fsys fs.FS
+	o    readerAtFSOptions
+}
+
+func (s *readerAtFS) Open(name string) (fs.File, error) {
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := f.(io.ReaderAt); ok {
+		return f, nil
+	}
+	if _, ok := f.(fs.ReadDirFile); ok {
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if info.IsDir() {
+			return f, nil
+		}
+	}
+	rf := &readerAtFile{
+		File:       f,
+		name:       name,
+		readerAtFS: s,
+		raw:        RawFile(f),
+	}
+	if seeker, ok := f.(io.Seeker); ok {
+		return &readerAtSeekerFile{readerAtFile: rf, Seeker: seeker}, nil
+	}
+	return rf, nil
+}
+
+func (s *readerAtFS) Glob(pattern string) ([]string, error) {
+	return fs.Glob(s.fsys, pattern)
+}
+
+func (s *readerAtFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(s.fsys, name)
+}
+
+func (s *readerAtFS) ReadFile(name string) ([]byte, error) {
+	return fs.ReadFile(s.fsys, name)
+}
+
+func (s *readerAtFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(s.fsys, name)
+}
+
+func (s *readerAtFS) ReadLink(name string) (string, error) {
+	return ReadLink(s.fsys, name)
+}
+
+func (s *readerAtFS) Lstat(name string) (fs.FileInfo, error) {
+	return Lstat(s.fsys, name)
+}
+
+func (s *readerAtFS) Sub(dir string) (fs.FS, error) {
+	return newSubFS(s, dir)
+}
+
+func (s *readerAtFS) Unwrap() fs.FS {
+	return s.fsys
+}
+
+// readerAtFile reads at offsets from the raw file, if it is available, or
+// from the content spilled on the first ReadAt call.
+type readerAtFile struct {
+	fs.File
+	name       string
+	readerAtFS *readerAtFS
+	raw        *os.File
+
+	spilled  io.ReaderAt
+	tmpFile  *os.File
+	spillErr error
+	mu       sync.Mutex
+}
+
+func (f *readerAtFile) ReadAt(p []byte, off int64) (int, error) {
+	if f.raw != nil {
+		return f.raw.ReadAt(p, off)
+	}
+	r, err := f.spill()
+	if err != nil {
+		return 0, &fs.PathError{Op: "readat", Path: f.name, Err: err}
+	}
+	return r.ReadAt(p, off)
+}
+
+func (f *readerAtFile) Close() error {
+	err := f.File.Close()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.tmpFile != nil {
+		if cerr := f.tmpFile.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		if rerr := os.Remove(f.tmpFile.Name()); rerr != nil && err == nil {
+			err = rerr
+		}
+		f.tmpFile = nil
+	}
+	return err
+}
+
+// spill copies the complete content of the file opened again to memory or to
+// a temporary file, only once, as ReadAt may be called concurrently.
+func (f *readerAtFile) spill() (io.ReaderAt, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.spilled != nil || f.spillErr != nil {
+		return f.spilled, f.spillErr
+	}
+
+	rf, err := f.readerAtFS.fsys.Open(f.name)
+	if err != nil {
+		f.spillErr = err
+		return nil, err
+	}
+	defer rf.Close()
+
+	o := f.readerAtFS.o
+	spilled, tmpFile, err := spill(rf, o.maxMemory, o.tmpDir)
+	if err != nil {
+		f.spillErr = err
+		return nil, err
+	}
+	f.spilled = spilled
+	f.tmpFile = tmpFile
+	return spilled, nil
+}
+
+// readerAtSeekerFile is a readerAtFile of the underlying file that implements
+// io.Seeker.
+type readerAtSeekerFile struct {
+	*readerAtFile
+	io.Seeker
+}
@@ -0,0 +1,229 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestReaderAtFS(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 100)
+
+	for _, tc := range []struct {
+		name      string
+		fsys      fs.FS
+		maxMemory int64
+	}{
+		{
+			name: "reader at",
+			fsys: fstest.MapFS{"file.txt": {Data: content}},
+		},
+		{
+			name: "memory",
+			fsys: nonSeekableFS{fstest.MapFS{"file.txt": {Data: content}}},
+		},
+		{
+			name:      "temporary file",
+			fsys:      nonSeekableFS{fstest.MapFS{"file.txt": {Data: content}}},
+			maxMemory: 100,
+		},
+		{
+			name: "raw file",
+			fsys: rawFileFS(t, "file.txt", content),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			opts := []fsutil.ReaderAtFSOption{fsutil.WithReaderAtTempDir(tmpDir)}
+			if tc.maxMemory > 0 {
+				opts = append(opts, fsutil.WithReaderAtMaxMemory(tc.maxMemory))
+			}
+			fsys := fsutil.ReaderAtFS(tc.fsys, opts...)
+
+			if err := fstest.TestFS(fsys, "file.txt"); err != nil {
+				t.Fatal(err)
+			}
+
+			f, err := fsys.Open("file.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			r, ok := f.(io.ReaderAt)
+			if !ok {
+				t.Fatal("file does not implement io.ReaderAt")
+			}
+
+			// read sequentially and at offsets concurrently
+			head := make([]byte, 5)
+			if _, err := io.ReadFull(f, head); err != nil {
+				t.Fatal(err)
+			}
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func(off int64) {
+					defer wg.Done()
+
+					buf := make([]byte, 10)
+					n, err := r.ReadAt(buf, off)
+					if err != nil && err != io.EOF {
+						t.Error(err)
+						return
+					}
+					if want := content[off : off+int64(n)]; !bytes.Equal(buf[:n], want) {
+						t.Errorf("got %q at offset %v, want %q", buf[:n], off, want)
+					}
+				}(int64(i * 95))
+			}
+			wg.Wait()
+			rest, err := io.ReadAll(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := append(head, rest...); !bytes.Equal(got, content) {
+				t.Errorf("got sequential content of %v bytes, want %v", len(got), len(content))
+			}
+
+			if err := f.Close(); err != nil {
+				t.Fatal(err)
+			}
+			entries, err := os.ReadDir(tmpDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("got %v temporary files after close, want none", len(entries))
+			}
+		})
+	}
+}
+
+func TestReaderAtFS_zip(t *testing.T) {
+	archive := newZip(t, time.Now(), []zipTestFile{{name: "a.txt", content: "a"}})
+
+	fsys := fsutil.ReaderAtFS(nonSeekableFS{fstest.MapFS{"archive.zip": {Data: archive}}})
+
+	f, err := fsys.Open("archive.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	zr, err := zip.NewReader(f.(io.ReaderAt), int64(len(archive)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testOpen(t, zr, "a.txt", "a")
+}
+
+// TestReaderAtPreservation documents which filesystems return files that
+// implement io.ReaderAt when the underlying files implement it.
+func TestReaderAtPreservation(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "file.txt"), "data")
+	osFS := os.DirFS(dir)
+
+	backupFS, err := fsutil.NewBackupFS(osFS, t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	versionPinFS, err := fsutil.NewVersionPinFS(osFS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	preloaded, err := fsutil.Preload(osFS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		fsys     fs.FS
+		readerAt bool
+	}{
+		{name: "os.DirFS", fsys: osFS, readerAt: true},
+		{name: "Preload", fsys: preloaded, readerAt: true},
+		{name: "SeekableFS", fsys: fsutil.SeekableFS(osFS), readerAt: true},
+		{name: "NotExistCacheFS", fsys: fsutil.NewNotExistCacheFS(osFS, time.Minute), readerAt: true},
+		{name: "StatCacheFS", fsys: fsutil.NewStatCacheFS(osFS, time.Minute), readerAt: true},
+		{name: "VersionPinFS", fsys: versionPinFS, readerAt: true},
+		{name: "ExpiringFS", fsys: fsutil.NewExpiringFS(osFS, time.Hour), readerAt: true},
+		{name: "OnlyFilesModifiedAfterFS", fsys: fsutil.NewOnlyFilesModifiedAfterFS(osFS, time.Time{}), readerAt: true},
+		{name: "BackupFS", fsys: backupFS},
+		{name: "PrefetchFS", fsys: fsutil.PrefetchFS(osFS, 0)},
+		{name: "ThrottleFS", fsys: fsutil.ThrottleFS(osFS, 1<<20, 1<<20), readerAt: true},
+		{name: "LimitFS", fsys: fsutil.NewLimitFS(osFS, 1)},
+		{name: "ReaderAtFS over BackupFS", fsys: fsutil.ReaderAtFS(backupFS), readerAt: true},
+		{name: "ReaderAtFS over PrefetchFS", fsys: fsutil.ReaderAtFS(fsutil.PrefetchFS(osFS, 0)), readerAt: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := tc.fsys.Open("file.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			r, ok := f.(io.ReaderAt)
+			if ok != tc.readerAt {
+				t.Fatalf("got io.ReaderAt %v, want %v", ok, tc.readerAt)
+			}
+			if !ok {
+				return
+			}
+			buf := make([]byte, 3)
+			if _, err := r.ReadAt(buf, 1); err != nil {
+				t.Fatal(err)
+			}
+			if string(buf) != "ata" {
+				t.Errorf("got %q, want %q", buf, "ata")
+			}
+		})
+	}
+}
+
+// rawFileFS returns a BackupFS with a single file written to a temporary
+// directory, with files that do not implement io.ReaderAt, but expose the
+// underlying *os.File.
+func rawFileFS(t *testing.T, name string, content []byte) fs.FS {
+	t.Helper()
+
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, name), string(content))
+	fsys, err := fsutil.NewBackupFS(os.DirFS(dir), t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fsys
+}
+
+// nonSeekableFS hides all interfaces of regular files other than fs.File.
+type nonSeekableFS struct {
+	fs.FS
+}
+
+func (s nonSeekableFS) Open(name string) (fs.File, error) {
+	f, err := s.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := f.(fs.ReadDirFile); ok {
+		return f, nil
+	}
+	return struct{ fs.File }{f}, nil
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"io/fs"
+)
+
+// ReadLinkFS is the interface implemented by a filesystem that supports
+// symbolic links. It has the same methods as fs.ReadLinkFS from Go 1.25, so
+// that filesystems in this package pass symbolic links through to the
+// underlying filesystems, such as os.DirFS, with the fs.ReadLink and fs.Lstat
+// functions, while ReadLink and Lstat functions in this package provide the
+// same behavior with earlier Go versions.
+type ReadLinkFS interface {
+	fs.FS
+
+	// ReadLink returns the destination of the named symbolic link.
+	ReadLink(name string) (string, error)
+
+	// Lstat returns a fs.FileInfo describing the named file. If the file is
+	// a symbolic link, the returned fs.FileInfo describes the symbolic link.
+	// Lstat makes no attempt to follow the link.
+	Lstat(name string) (fs.FileInfo, error)
+}
+
+// ReadLink returns the destination of the named symbolic link. If fsys does
+// not implement ReadLinkFS, ReadLink returns an error that wraps
+// fs.ErrInvalid.
+func ReadLink(fsys fs.FS, name string) (string, error) {
+	rl, ok := fsys.(ReadLinkFS)
+	if !ok {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return rl.ReadLink(name)
+}
+
+// Lstat returns a fs.FileInfo describing the named file without following
+// symbolic links. If fsys does not implement ReadLinkFS, Lstat is identical
+// to fs.Stat.
+func Lstat(fsys fs.FS, name string) (fs.FileInfo, error) {
+	rl, ok := fsys.(ReadLinkFS)
+	if !ok {
+		return fs.Stat(fsys, name)
+	}
+	return rl.Lstat(name)
+}
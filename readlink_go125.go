@@ -0,0 +1,16 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.25
+// +build go1.25
+
+package fsutil
+
+import (
+	"io/fs"
+)
+
+// Every ReadLinkFS is also fs.ReadLinkFS.
+var _ fs.ReadLinkFS = ReadLinkFS(nil)
@@ -0,0 +1,173 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestReadLink(t *testing.T) {
+	dir := newSymlinkDir(t)
+	dirFS := os.DirFS(dir)
+	if _, ok := dirFS.(fsutil.ReadLinkFS); !ok {
+		t.Skip("os.DirFS does not support reading links")
+	}
+
+	backupFS, err := fsutil.NewBackupFS(dirFS, t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		fsys   fs.FS
+		prefix string
+	}{
+		{name: "backup", fsys: backupFS},
+		{name: "chain", fsys: fsutil.Chain(dirFS).Retry().Timeout(time.Minute).Filter(func(string) (bool, error) { return true, nil }).Count().Limit(10).Validate().Build()},
+		{name: "hash", fsys: fsutil.NewHashFS(dirFS, fsutil.NewMD5Hasher(8), fsutil.WithUnhashedAccessMode(fsutil.UnhashedAccessPermissive))},
+		{name: "hook", fsys: fsutil.NewHookFS(dirFS)},
+		{name: "mime type", fsys: fsutil.NewMimeTypeFS(dirFS)},
+		{name: "no dirs", fsys: fsutil.NoDirsFS(dirFS)},
+		{name: "path validation", fsys: fsutil.NewPathValidationFS(dirFS)},
+		{name: "scoped", fsys: fsutil.NewScopedFS(dirFS, func(context.Context) func(string) bool {
+			return func(string) bool { return true }
+		})},
+		{name: "stat cache", fsys: fsutil.NewStatCacheFS(dirFS, time.Minute)},
+		{name: "tenant", fsys: fsutil.NewTenantFS(func(string) (fs.FS, error) { return dirFS, nil }), prefix: "acme/"},
+		{name: "union", fsys: fsutil.NewUnionFS(fsutil.MapFS{"index.html": {}}, dirFS)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			target, err := fsutil.ReadLink(tc.fsys, tc.prefix+"assets/link.css")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if target != "main.css" {
+				t.Errorf("got target %q, want %q", target, "main.css")
+			}
+
+			info, err := fsutil.Lstat(tc.fsys, tc.prefix+"static")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode()&fs.ModeSymlink == 0 {
+				t.Errorf("got mode %v, want symbolic link", info.Mode())
+			}
+
+			sub, err := fs.Sub(tc.fsys, tc.prefix+"assets")
+			if err != nil {
+				t.Fatal(err)
+			}
+			info, err = fsutil.Lstat(sub, "link.css")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode()&fs.ModeSymlink == 0 {
+				t.Errorf("got sub mode %v, want symbolic link", info.Mode())
+			}
+
+			if _, err := fsutil.ReadLink(tc.fsys, tc.prefix+"assets/missing.css"); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("got error %v, want %v", err, fs.ErrNotExist)
+			}
+		})
+	}
+}
+
+func TestReadLink_hashedPath(t *testing.T) {
+	dirFS := os.DirFS(newSymlinkDir(t))
+	if _, ok := dirFS.(fsutil.ReadLinkFS); !ok {
+		t.Skip("os.DirFS does not support reading links")
+	}
+	fsys := fsutil.NewHashFS(dirFS, fsutil.NewMD5Hasher(8))
+
+	hashedPath, err := fsys.HashedPath("assets/link.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := fsys.ReadLink(hashedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != "main.css" {
+		t.Errorf("got target %q, want %q", target, "main.css")
+	}
+	info, err := fsys.Lstat(hashedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name() != filepath.Base(hashedPath) || info.Mode()&fs.ModeSymlink == 0 {
+		t.Errorf("got name %q and mode %v", info.Name(), info.Mode())
+	}
+}
+
+func TestReadLink_notSupported(t *testing.T) {
+	files := fsutil.MapFS{
+		"index.html": {Data: []byte("<html>")},
+	}
+
+	if _, err := fsutil.ReadLink(files, "index.html"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("got error %v, want %v", err, fs.ErrInvalid)
+	}
+	info, err := fsutil.Lstat(files, "index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 6 {
+		t.Errorf("got size %v, want 6", info.Size())
+	}
+}
+
+func TestComposeFS_readLink(t *testing.T) {
+	files := fsutil.MapFS{}
+	readLink := fsutil.ReadLinkFunc(func(name string) (string, error) {
+		return "target", nil
+	})
+
+	if _, ok := fsutil.ComposeFS(files.Open, readLink).(fsutil.ReadLinkFS); ok {
+		t.Error("filesystem without lstat function implements ReadLinkFS")
+	}
+
+	fsys := fsutil.ComposeFS(files.Open, readLink, fsutil.LstatFunc(files.Stat), fsutil.StatFunc(files.Stat))
+	if _, ok := fsys.(fs.StatFS); !ok {
+		t.Error("filesystem does not implement fs.StatFS")
+	}
+	target, err := fsutil.ReadLink(fsys, "link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != "target" {
+		t.Errorf("got target %q, want %q", target, "target")
+	}
+}
+
+// newSymlinkDir returns a directory with the assets/main.css file, the
+// assets/link.css link to it and the static link to the assets directory.
+func newSymlinkDir(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "assets"), 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "assets", "main.css"), []byte("body{}"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("main.css", filepath.Join(dir, "assets", "link.css")); err != nil {
+		t.Skip("symbolic links are not supported:", err)
+	}
+	if err := os.Symlink("assets", filepath.Join(dir, "static")); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
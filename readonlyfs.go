@@ -0,0 +1,87 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"io/fs"
+)
+
+var (
+	_ fs.FS         = (*readOnlyFS)(nil)
+	_ fs.GlobFS     = (*readOnlyFS)(nil)
+	_ fs.ReadDirFS  = (*readOnlyFS)(nil)
+	_ fs.ReadFileFS = (*readOnlyFS)(nil)
+	_ fs.StatFS     = (*readOnlyFS)(nil)
+	_ fs.SubFS      = (*readOnlyFS)(nil)
+	_ ReadLinkFS    = (*readOnlyFS)(nil)
+	_ WriteFileFS   = (*readOnlyFS)(nil)
+	_ RemoveFS      = (*readOnlyFS)(nil)
+	_ MkdirAllFS    = (*readOnlyFS)(nil)
+)
+
+// ReadOnlyFS returns a filesystem that reads from fsys, but returns errors
+// that wrap fs.ErrPermission for all mutations, so that a writable
+// filesystem can be safely passed to code that should only read from it. The
+// returned filesystem has WriteFile, Remove and MkdirAll methods, regardless
+// of the methods that fsys implements, and fsys can not be reached through
+// it.
+func ReadOnlyFS(fsys fs.FS) fs.FS {
+	return &readOnlyFS{
+		fsys: fsys,
+	}
+}
+
+type readOnlyFS struct {
+	fsys fs.FS
+}
+
+func (s *readOnlyFS) Open(name string) (fs.File, error) {
+	return s.fsys.Open(name)
+}
+
+func (s *readOnlyFS) Glob(pattern string) ([]string, error) {
+	return fs.Glob(s.fsys, pattern)
+}
+
+func (s *readOnlyFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(s.fsys, name)
+}
+
+func (s *readOnlyFS) ReadFile(name string) ([]byte, error) {
+	return fs.ReadFile(s.fsys, name)
+}
+
+func (s *readOnlyFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(s.fsys, name)
+}
+
+func (s *readOnlyFS) ReadLink(name string) (string, error) {
+	return ReadLink(s.fsys, name)
+}
+
+func (s *readOnlyFS) Lstat(name string) (fs.FileInfo, error) {
+	return Lstat(s.fsys, name)
+}
+
+func (s *readOnlyFS) Sub(dir string) (fs.FS, error) {
+	sub, err := fs.Sub(s.fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	return ReadOnlyFS(sub), nil
+}
+
+func (s *readOnlyFS) WriteFile(name string, _ []byte, _ fs.FileMode) error {
+	return &fs.PathError{Op: "writefile", Path: name, Err: fs.ErrPermission}
+}
+
+func (s *readOnlyFS) Remove(name string) error {
+	return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrPermission}
+}
+
+func (s *readOnlyFS) MkdirAll(name string, _ fs.FileMode) error {
+	return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrPermission}
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"resenje.org/fsutil"
+)
+
+func TestReadOnlyFS(t *testing.T) {
+	mapFS := fstest.MapFS{
+		"dir/data.txt": &fstest.MapFile{Data: []byte("data")},
+	}
+
+	fsys := fsutil.ReadOnlyFS(mapFS)
+
+	if err := fstest.TestFS(fsys, "dir/data.txt"); err != nil {
+		t.Fatal(err)
+	}
+	testReadFile(t, fsys.(fs.ReadFileFS), "dir/data.txt", "data")
+
+	sub, err := fs.Sub(fsys, "dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range []fs.FS{fsys, sub} {
+		w, ok := f.(interface {
+			WriteFile(name string, data []byte, perm fs.FileMode) error
+			Remove(name string) error
+			MkdirAll(name string, perm fs.FileMode) error
+		})
+		if !ok {
+			t.Fatalf("filesystem %T has no mutation methods", f)
+		}
+		if err := w.WriteFile("new.txt", []byte("new"), 0o644); !errors.Is(err, fs.ErrPermission) {
+			t.Errorf("got write file error %v, want %v", err, fs.ErrPermission)
+		}
+		if err := w.Remove("data.txt"); !errors.Is(err, fs.ErrPermission) {
+			t.Errorf("got remove error %v, want %v", err, fs.ErrPermission)
+		}
+		if err := w.MkdirAll("new", 0o755); !errors.Is(err, fs.ErrPermission) {
+			t.Errorf("got mkdir error %v, want %v", err, fs.ErrPermission)
+		}
+	}
+
+	if len(mapFS) != 1 {
+		t.Errorf("got %v files, want %v", len(mapFS), 1)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"io"
+	"io/fs"
+	"math"
+)
+
+// ReadRange reads length bytes of the named file starting at the offset off.
+// If length is negative, the file is read until its end. Fewer bytes than
+// length are returned without an error if the file ends before the range.
+func ReadRange(fsys fs.FS, name string, off, length int64) ([]byte, error) {
+	r, err := OpenRange(fsys, name, off, length)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+// OpenRange opens the named file and returns a reader of length bytes of its
+// content starting at the offset off. If length is negative, the reader
+// returns the content until the end of the file. The file is read from the
+// offset with io.ReaderAt or positioned with io.Seeker if it implements one of
+// them, otherwise the content before the offset is read and discarded. The
+// file is closed by closing the returned reader.
+func OpenRange(fsys fs.FS, name string, off, length int64) (io.ReadCloser, error) {
+	if off < 0 {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if length < 0 {
+		length = math.MaxInt64 - off
+	}
+
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var r io.Reader
+	if ra, ok := f.(io.ReaderAt); ok {
+		r = io.NewSectionReader(ra, off, length)
+	} else if seeker, ok := f.(io.Seeker); ok {
+		if _, err := seeker.Seek(off, io.SeekStart); err != nil {
+			f.Close()
+			return nil, &fs.PathError{Op: "seek", Path: name, Err: err}
+		}
+		r = io.LimitReader(f, length)
+	} else {
+		if _, err := io.CopyN(io.Discard, f, off); err != nil && err != io.EOF {
+			f.Close()
+			return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+		}
+		r = io.LimitReader(f, length)
+	}
+
+	return &rangeReader{
+		Reader: r,
+		Closer: f,
+	}, nil
+}
+
+type rangeReader struct {
+	io.Reader
+	io.Closer
+}
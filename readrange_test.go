@@ -0,0 +1,89 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"testing"
+
+	"resenje.org/fsutil"
+)
+
+func TestReadRange(t *testing.T) {
+	files := fsutil.MapFS{
+		"video.mp4": {Data: []byte("0123456789abcdef")},
+	}
+
+	for _, tc := range []struct {
+		name string
+		fsys fs.FS
+	}{
+		{
+			name: "reader at",
+			fsys: files,
+		},
+		{
+			name: "seeker",
+			fsys: fsutil.FSFunc(func(name string) (fs.File, error) {
+				f, err := files.Open(name)
+				if err != nil {
+					return nil, err
+				}
+				return &seekerFile{File: f, Seeker: f.(io.Seeker)}, nil
+			}),
+		},
+		{
+			name: "discard",
+			fsys: fsutil.FSFunc(func(name string) (fs.File, error) {
+				f, err := files.Open(name)
+				if err != nil {
+					return nil, err
+				}
+				return &readerFile{File: f}, nil
+			}),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, r := range []struct {
+				off, length int64
+				want        string
+			}{
+				{off: 0, length: 4, want: "0123"},
+				{off: 10, length: 3, want: "abc"},
+				{off: 12, length: 10, want: "cdef"},
+				{off: 5, length: -1, want: "56789abcdef"},
+				{off: 3, length: 0, want: ""},
+				{off: 20, length: 4, want: ""},
+			} {
+				got, err := fsutil.ReadRange(tc.fsys, "video.mp4", r.off, r.length)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != r.want {
+					t.Errorf("range %v %v: got %q, want %q", r.off, r.length, got, r.want)
+				}
+			}
+
+			if _, err := fsutil.ReadRange(tc.fsys, "missing.mp4", 0, 4); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("got error %v, want %v", err, fs.ErrNotExist)
+			}
+			if _, err := fsutil.ReadRange(tc.fsys, "video.mp4", -1, 4); !errors.Is(err, fs.ErrInvalid) {
+				t.Errorf("got error %v, want %v", err, fs.ErrInvalid)
+			}
+		})
+	}
+}
+
+type seekerFile struct {
+	fs.File
+	io.Seeker
+}
+
+type readerFile struct {
+	fs.File
+}
@@ -0,0 +1,197 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net"
+	"syscall"
+	"time"
+)
+
+var (
+	_ fs.FS         = (*RetryFS)(nil)
+	_ fs.ReadFileFS = (*RetryFS)(nil)
+	_ fs.StatFS     = (*RetryFS)(nil)
+	_ fs.SubFS      = (*RetryFS)(nil)
+	_ ReadLinkFS    = (*RetryFS)(nil)
+)
+
+// RetryFS is a filesystem that retries Open, ReadFile and Stat calls to the
+// underlying filesystem that fail with transient errors. It masks sporadic
+// errors of network, object store or FUSE backed filesystems.
+type RetryFS struct {
+	fsys fs.FS
+	o    retryFSOptions
+}
+
+// RetryFSOption is used to provide optional parameters to NewRetryFS function.
+type RetryFSOption func(*retryFSOptions)
+
+type retryFSOptions struct {
+	attempts  int
+	backoff   func(attempt int) time.Duration
+	retryable func(err error) bool
+}
+
+// WithRetryAttempts sets the maximal number of attempts of every operation,
+// including the first one. The default is 3.
+func WithRetryAttempts(n int) RetryFSOption {
+	return func(o *retryFSOptions) {
+		o.attempts = n
+	}
+}
+
+// WithRetryBackoff sets the function that returns the duration to wait before
+// the next attempt, where attempt starts from 1 for the first retry. The
+// default backoff starts with 10ms and doubles on every retry.
+func WithRetryBackoff(backoff func(attempt int) time.Duration) RetryFSOption {
+	return func(o *retryFSOptions) {
+		o.backoff = backoff
+	}
+}
+
+// WithRetryClassifier sets the function that reports whether the operation
+// should be retried after the error. The default is IsTransientError.
+func WithRetryClassifier(retryable func(err error) bool) RetryFSOption {
+	return func(o *retryFSOptions) {
+		o.retryable = retryable
+	}
+}
+
+// NewRetryFS returns a new instance of RetryFS.
+func NewRetryFS(fsys fs.FS, opts ...RetryFSOption) *RetryFS {
+	o := retryFSOptions{
+		attempts:  3,
+		backoff:   exponentialBackoff(10 * time.Millisecond),
+		retryable: IsTransientError,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.attempts < 1 {
+		o.attempts = 1
+	}
+	return &RetryFS{
+		fsys: fsys,
+		o:    o,
+	}
+}
+
+// IsTransientError reports whether the error may not occur if the operation is
+// repeated. Only errors that are known to be transient are, which are errors
+// that report a timeout, network errors that report that they are temporary
+// and syscall.EAGAIN, syscall.EINTR and syscall.EBUSY errors. Context errors
+// are not transient, even if they report a timeout, as the operation can not
+// succeed with the same context.
+func IsTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	for _, e := range []error{
+		syscall.EAGAIN,
+		syscall.EINTR,
+		syscall.EBUSY,
+	} {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+	var timeout interface{ Timeout() bool }
+	if errors.As(err, &timeout) && timeout.Timeout() {
+		return true
+	}
+	// The deprecated Temporary method of net.Error is called through an
+	// interface, as it is still reported by some network errors.
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if t, ok := netErr.(interface{ Temporary() bool }); ok && t.Temporary() {
+			return true
+		}
+	}
+	return false
+}
+
+// Open implements fs.FS interface.
+func (s *RetryFS) Open(name string) (f fs.File, err error) {
+	err = s.retry(func() (err error) {
+		f, err = s.fsys.Open(name)
+		return err
+	})
+	return f, err
+}
+
+// ReadFile implements fs.ReadFileFS interface.
+func (s *RetryFS) ReadFile(name string) (data []byte, err error) {
+	err = s.retry(func() (err error) {
+		data, err = fs.ReadFile(s.fsys, name)
+		return err
+	})
+	return data, err
+}
+
+// Stat implements fs.StatFS interface.
+func (s *RetryFS) Stat(name string) (info fs.FileInfo, err error) {
+	err = s.retry(func() (err error) {
+		info, err = fs.Stat(s.fsys, name)
+		return err
+	})
+	return info, err
+}
+
+// ReadLink implements ReadLinkFS interface.
+func (s *RetryFS) ReadLink(name string) (target string, err error) {
+	err = s.retry(func() (err error) {
+		target, err = ReadLink(s.fsys, name)
+		return err
+	})
+	return target, err
+}
+
+// Lstat implements ReadLinkFS interface.
+func (s *RetryFS) Lstat(name string) (info fs.FileInfo, err error) {
+	err = s.retry(func() (err error) {
+		info, err = Lstat(s.fsys, name)
+		return err
+	})
+	return info, err
+}
+
+// Sub implements fs.SubFS interface.
+func (s *RetryFS) Sub(dir string) (fs.FS, error) {
+	return newSubFS(s, dir)
+}
+
+// Unwrap returns the underlying filesystem.
+func (s *RetryFS) Unwrap() fs.FS {
+	return s.fsys
+}
+
+// retry calls fn until it returns an error that is not retryable or until the
+// maximal number of attempts is reached.
+func (s *RetryFS) retry(fn func() error) (err error) {
+	for attempt := 0; attempt < s.o.attempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(s.o.backoff(attempt))
+		}
+		err = fn()
+		if err == nil || !s.o.retryable(err) {
+			return err
+		}
+	}
+	return err
+}
+
+func exponentialBackoff(initial time.Duration) func(attempt int) time.Duration {
+	return func(attempt int) time.Duration {
+		return initial << (attempt - 1)
+	}
+}
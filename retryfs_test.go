@@ -0,0 +1,141 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestRetryFS(t *testing.T) {
+	files := fsutil.MapFS{
+		"flaky.txt": {Data: []byte("flaky")},
+	}
+	errBusy := syscall.EBUSY
+
+	newFS := func(failures int, opts ...fsutil.RetryFSOption) (*fsutil.RetryFS, *int) {
+		var calls int
+		opts = append([]fsutil.RetryFSOption{
+			fsutil.WithRetryBackoff(func(int) time.Duration { return 0 }),
+		}, opts...)
+		return fsutil.NewRetryFS(fsutil.FSFunc(func(name string) (fs.File, error) {
+			calls++
+			if calls <= failures {
+				return nil, &fs.PathError{Op: "open", Path: name, Err: errBusy}
+			}
+			return files.Open(name)
+		}), opts...), &calls
+	}
+
+	t.Run("open", func(t *testing.T) {
+		fsys, calls := newFS(2)
+		testOpen(t, fsys, "flaky.txt", "flaky")
+		if *calls != 3 {
+			t.Errorf("got %v calls, want %v", *calls, 3)
+		}
+	})
+
+	t.Run("read file", func(t *testing.T) {
+		fsys, calls := newFS(1)
+		testReadFile(t, fsys, "flaky.txt", "flaky")
+		if *calls != 2 {
+			t.Errorf("got %v calls, want %v", *calls, 2)
+		}
+	})
+
+	t.Run("stat", func(t *testing.T) {
+		fsys, _ := newFS(1)
+		info, err := fsys.Stat("flaky.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Name() != "flaky.txt" {
+			t.Errorf("got name %q, want %q", info.Name(), "flaky.txt")
+		}
+	})
+
+	t.Run("attempts exhausted", func(t *testing.T) {
+		fsys, calls := newFS(5, fsutil.WithRetryAttempts(4))
+		_, err := fsys.Open("flaky.txt")
+		if !errors.Is(err, errBusy) {
+			t.Fatalf("got error %v, want %v", err, errBusy)
+		}
+		if *calls != 4 {
+			t.Errorf("got %v calls, want %v", *calls, 4)
+		}
+	})
+
+	t.Run("not exist", func(t *testing.T) {
+		fsys, calls := newFS(0)
+		testOpenNotExist(t, fsys, "missing.txt")
+		if *calls != 1 {
+			t.Errorf("got %v calls, want %v", *calls, 1)
+		}
+	})
+
+	t.Run("classifier", func(t *testing.T) {
+		fsys, calls := newFS(2, fsutil.WithRetryClassifier(func(error) bool { return false }))
+		if _, err := fsys.Open("flaky.txt"); !errors.Is(err, errBusy) {
+			t.Fatalf("got error %v, want %v", err, errBusy)
+		}
+		if *calls != 1 {
+			t.Errorf("got %v calls, want %v", *calls, 1)
+		}
+	})
+
+	t.Run("backoff", func(t *testing.T) {
+		var attempts []int
+		fsys, _ := newFS(2, fsutil.WithRetryBackoff(func(attempt int) time.Duration {
+			attempts = append(attempts, attempt)
+			return 0
+		}))
+		testOpen(t, fsys, "flaky.txt", "flaky")
+		if len(attempts) != 2 || attempts[0] != 1 || attempts[1] != 2 {
+			t.Errorf("got backoff attempts %v, want [1 2]", attempts)
+		}
+	})
+}
+
+func TestIsTransientError(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{err: nil, want: false},
+		{err: fs.ErrNotExist, want: false},
+		{err: &fs.PathError{Op: "open", Path: "a", Err: fs.ErrPermission}, want: false},
+		{err: errors.New("input/output error"), want: false},
+		{err: context.Canceled, want: false},
+		{err: context.DeadlineExceeded, want: false},
+		{err: &fs.PathError{Op: "open", Path: "a", Err: syscall.EAGAIN}, want: true},
+		{err: syscall.EINTR, want: true},
+		{err: syscall.EBUSY, want: true},
+		{err: &net.OpError{Op: "read", Net: "tcp", Err: netError{timeout: true}}, want: true},
+		{err: &net.OpError{Op: "read", Net: "tcp", Err: netError{temporary: true}}, want: true},
+		{err: &net.OpError{Op: "read", Net: "tcp", Err: netError{}}, want: false},
+	} {
+		if got := fsutil.IsTransientError(tc.err); got != tc.want {
+			t.Errorf("%v: got %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+// netError is a network error that reports if it is a timeout or temporary.
+type netError struct {
+	timeout   bool
+	temporary bool
+}
+
+func (e netError) Error() string   { return "network error" }
+func (e netError) Timeout() bool   { return e.timeout }
+func (e netError) Temporary() bool { return e.temporary }
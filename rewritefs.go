@@ -0,0 +1,252 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+var (
+	_ fs.FS         = (*rewriteFS)(nil)
+	_ fs.GlobFS     = (*rewriteFS)(nil)
+	_ fs.ReadDirFS  = (*rewriteFS)(nil)
+	_ fs.ReadFileFS = (*rewriteFS)(nil)
+	_ fs.StatFS     = (*rewriteFS)(nil)
+	_ fs.SubFS      = (*rewriteFS)(nil)
+	_ ReadLinkFS    = (*rewriteFS)(nil)
+)
+
+// RewriteRule maps paths requested from the RewriteFS to paths in the
+// underlying filesystem and back.
+type RewriteRule interface {
+	// Rewrite returns the path in the underlying filesystem for the requested
+	// name and reports whether the rule applies to it.
+	Rewrite(name string) (string, bool)
+	// Reverse returns the requested path for the name in the underlying
+	// filesystem and reports whether the rule applies to it.
+	Reverse(name string) (string, bool)
+}
+
+// PrefixRule returns a RewriteRule that replaces the from path prefix of
+// requested paths with the to prefix. For example PrefixRule("v2", "dist")
+// maps "v2/app.js" to "dist/app.js".
+func PrefixRule(from, to string) RewriteRule {
+	return prefixRule{from: from, to: to}
+}
+
+type prefixRule struct {
+	from, to string
+}
+
+func (r prefixRule) Rewrite(name string) (string, bool) {
+	return replacePathPrefix(name, r.from, r.to)
+}
+
+func (r prefixRule) Reverse(name string) (string, bool) {
+	return replacePathPrefix(name, r.to, r.from)
+}
+
+func replacePathPrefix(name, from, to string) (string, bool) {
+	if from == "." {
+		if to == "." {
+			return name, true
+		}
+		if name == "." {
+			return to, true
+		}
+		return to + "/" + name, true
+	}
+	if name == from {
+		return to, true
+	}
+	if !strings.HasPrefix(name, from+"/") {
+		return "", false
+	}
+	if to == "." {
+		return name[len(from)+1:], true
+	}
+	return to + name[len(from):], true
+}
+
+// FuncRule returns a RewriteRule that uses functions to map requested paths to
+// paths in the underlying filesystem and back. The reverse function may be nil
+// if the underlying paths should not be mapped in ReadDir and Glob results.
+func FuncRule(rewrite, reverse func(name string) (string, bool)) RewriteRule {
+	return funcRule{rewrite: rewrite, reverse: reverse}
+}
+
+type funcRule struct {
+	rewrite, reverse func(name string) (string, bool)
+}
+
+func (r funcRule) Rewrite(name string) (string, bool) {
+	return r.rewrite(name)
+}
+
+func (r funcRule) Reverse(name string) (string, bool) {
+	if r.reverse == nil {
+		return "", false
+	}
+	return r.reverse(name)
+}
+
+// RewriteFS returns a filesystem that maps requested paths with the first
+// rule that applies to them before opening them from the underlying filesystem.
+// Paths that no rule applies to are used unchanged. Names of entries in ReadDir
+// and Glob results are reverse mapped, so that they can be opened from the
+// returned filesystem. This filesystem can be used to keep old URLs working
+// when files are moved to other directories.
+func RewriteFS(fsys fs.FS, rules ...RewriteRule) fs.FS {
+	return &rewriteFS{
+		fsys:  fsys,
+		rules: rules,
+	}
+}
+
+type rewriteFS struct {
+	fsys  fs.FS
+	rules []RewriteRule
+}
+
+func (s *rewriteFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	f, err := s.fsys.Open(s.rewrite(name))
+	if err != nil {
+		return nil, err
+	}
+	return &rewriteFile{wrappedFile: wrappedFile{File: f, name: name}, rewriteFS: s}, nil
+}
+
+func (s *rewriteFS) Glob(pattern string) ([]string, error) {
+	// Glob in the requested paths namespace by reading reverse mapped
+	// directories. FSFunc with the readDirFS hides this Glob method to avoid
+	// recursion.
+	return fs.Glob(readDirFS{FSFunc: s.Open, readDir: s.ReadDir}, pattern)
+}
+
+func (s *rewriteFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	dir := s.rewrite(name)
+	entries, err := fs.ReadDir(s.fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	entries = s.reverseEntries(name, dir, entries)
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+func (s *rewriteFS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+	return fs.ReadFile(s.fsys, s.rewrite(name))
+}
+
+func (s *rewriteFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	i, err := fs.Stat(s.fsys, s.rewrite(name))
+	if err != nil {
+		return nil, err
+	}
+	return NewFileInfo(i, WithName(path.Base(name))), nil
+}
+
+func (s *rewriteFS) ReadLink(name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return ReadLink(s.fsys, s.rewrite(name))
+}
+
+func (s *rewriteFS) Lstat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "lstat", Path: name, Err: fs.ErrInvalid}
+	}
+	i, err := Lstat(s.fsys, s.rewrite(name))
+	if err != nil {
+		return nil, err
+	}
+	return NewFileInfo(i, WithName(path.Base(name))), nil
+}
+
+func (s *rewriteFS) Sub(dir string) (fs.FS, error) {
+	return newSubFS(s, dir)
+}
+
+func (s *rewriteFS) Unwrap() fs.FS {
+	return s.fsys
+}
+
+func (s *rewriteFS) rewrite(name string) string {
+	for _, r := range s.rules {
+		if n, ok := r.Rewrite(name); ok {
+			return n
+		}
+	}
+	return name
+}
+
+func (s *rewriteFS) reverse(name string) string {
+	for _, r := range s.rules {
+		if n, ok := r.Reverse(name); ok {
+			return n
+		}
+	}
+	return name
+}
+
+// reverseEntries renames entries of the underlying directory dir, if their
+// reverse mapped paths are in the requested directory name.
+func (s *rewriteFS) reverseEntries(name, dir string, entries []fs.DirEntry) []fs.DirEntry {
+	for i, e := range entries {
+		r := s.reverse(path.Join(dir, e.Name()))
+		if path.Dir(r) != name || path.Base(r) == e.Name() {
+			continue
+		}
+		entries[i] = NewDirEntry(e, WithName(path.Base(r)))
+	}
+	return entries
+}
+
+// readDirFS is a filesystem with only Open and ReadDir methods.
+type readDirFS struct {
+	FSFunc
+	readDir func(name string) ([]fs.DirEntry, error)
+}
+
+func (f readDirFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return f.readDir(name)
+}
+
+type rewriteFile struct {
+	wrappedFile
+	rewriteFS *rewriteFS
+}
+
+func (f *rewriteFile) Stat() (fs.FileInfo, error) {
+	i, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return NewFileInfo(i, WithName(path.Base(f.name))), nil
+}
+
+func (f *rewriteFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	entries, err := f.wrappedFile.ReadDir(n)
+	return f.rewriteFS.reverseEntries(f.name, f.rewriteFS.rewrite(f.name), entries), err
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"fmt"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"resenje.org/fsutil"
+)
+
+func TestRewriteFS(t *testing.T) {
+	fsys := fsutil.RewriteFS(fsutil.MapFS{
+		"index.html":       {Data: []byte("<h1>Hello</h1>")},
+		"dist/app.js":      {Data: []byte("app();")},
+		"dist/css/app.css": {Data: []byte("body {}")},
+		"legacy/old.js":    {Data: []byte("old();")},
+	},
+		fsutil.PrefixRule("v2", "dist"),
+		fsutil.FuncRule(func(name string) (string, bool) {
+			if strings.HasSuffix(name, ".min.js") {
+				return "legacy/" + strings.TrimSuffix(name, ".min.js") + ".js", true
+			}
+			return "", false
+		}, nil),
+	)
+
+	testOpen(t, fsys, "v2/app.js", "app();")
+	testOpen(t, fsys, "v2/css/app.css", "body {}")
+	testOpen(t, fsys, "old.min.js", "old();")
+	testOpen(t, fsys, "index.html", "<h1>Hello</h1>")
+	testOpenNotExist(t, fsys, "v2/missing.js")
+
+	rfs := fsys.(interface {
+		fs.GlobFS
+		fs.ReadFileFS
+		fs.StatFS
+	})
+
+	testReadFile(t, rfs, "v2/css/app.css", "body {}")
+	testGlob(t, rfs, "v2/*.js", []string{"v2/app.js"})
+	testGlob(t, rfs, "*/*/*.css", []string{"v2/css/app.css"})
+
+	info, err := rfs.Stat("v2/app.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name() != "app.js" {
+		t.Errorf("got name %q, want %q", info.Name(), "app.js")
+	}
+
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+	if want := []string{"index.html", "legacy", "v2"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got entries %v, want %v", got, want)
+	}
+
+	if err := fstest.TestFS(fsys, "v2/app.js", "v2/css/app.css", "index.html"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,305 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+var (
+	_ fs.FS         = (*SafeNameFS)(nil)
+	_ fs.GlobFS     = (*SafeNameFS)(nil)
+	_ fs.ReadDirFS  = (*SafeNameFS)(nil)
+	_ fs.ReadFileFS = (*SafeNameFS)(nil)
+	_ fs.StatFS     = (*SafeNameFS)(nil)
+	_ fs.SubFS      = (*SafeNameFS)(nil)
+	_ ReadLinkFS    = (*SafeNameFS)(nil)
+)
+
+// errInvalidSafeName is returned by DecodeSafeName for names that are not
+// produced by EncodeSafeName.
+var errInvalidSafeName = errors.New("invalid safe name")
+
+// EncodeSafeName encodes every element of the slash separated path, so that it
+// can be used as a file name on all supported operating systems, including
+// Windows. Characters that are not allowed in Windows file names, trailing
+// dots and spaces, and the first character of reserved device names, such as
+// CON or NUL, are replaced with "%" followed by two hexadecimal digits of the
+// byte value. The "%" character is always encoded, so that the encoding is
+// reversible with DecodeSafeName. Names that do not need encoding are
+// returned unchanged.
+func EncodeSafeName(name string) string {
+	if !needsSafeNameEncoding(name) {
+		return name
+	}
+	elems := strings.Split(name, "/")
+	for i, e := range elems {
+		elems[i] = encodeSafeNameElem(e)
+	}
+	return strings.Join(elems, "/")
+}
+
+// DecodeSafeName returns the path that was encoded with EncodeSafeName.
+func DecodeSafeName(name string) (string, error) {
+	if !strings.Contains(name, "%") {
+		return name, nil
+	}
+	var b strings.Builder
+	b.Grow(len(name))
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c != '%' {
+			b.WriteByte(c)
+			continue
+		}
+		if i+2 >= len(name) || !isUpperHex(name[i+1]) || !isUpperHex(name[i+2]) {
+			return "", fmt.Errorf("%w: %q", errInvalidSafeName, name)
+		}
+		b.WriteByte(unhex(name[i+1])<<4 | unhex(name[i+2]))
+		i += 2
+	}
+	return b.String(), nil
+}
+
+// needsSafeNameEncoding reports whether any element of the path is changed by
+// encodeSafeNameElem.
+func needsSafeNameEncoding(name string) bool {
+	for _, e := range strings.Split(name, "/") {
+		if e == "" || e == "." || e == ".." {
+			continue
+		}
+		if isReservedDeviceName(e) || strings.HasSuffix(e, ".") || strings.HasSuffix(e, " ") {
+			return true
+		}
+		for i := 0; i < len(e); i++ {
+			if isUnsafeNameByte(e[i]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func encodeSafeNameElem(e string) string {
+	if e == "" || e == "." || e == ".." {
+		return e
+	}
+	var b strings.Builder
+	b.Grow(len(e) + 6)
+	for i := 0; i < len(e); i++ {
+		c := e[i]
+		switch {
+		case isUnsafeNameByte(c),
+			i == 0 && isReservedDeviceName(e),
+			i == len(e)-1 && (c == '.' || c == ' '):
+			fmt.Fprintf(&b, "%%%02X", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// isUnsafeNameByte reports whether the byte is not allowed in Windows file
+// names or is the "%" escape character.
+func isUnsafeNameByte(c byte) bool {
+	return c < 0x20 || strings.IndexByte(`%<>:"\|?*`, c) >= 0
+}
+
+// isReservedDeviceName reports whether the name refers to a Windows device,
+// regardless of the extension and trailing spaces before it.
+func isReservedDeviceName(name string) bool {
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		name = name[:i]
+	}
+	name = strings.ToUpper(strings.TrimRight(name, " "))
+	switch name {
+	case "CON", "PRN", "AUX", "NUL", "CONIN$", "CONOUT$":
+		return true
+	}
+	if len(name) == 4 && (strings.HasPrefix(name, "COM") || strings.HasPrefix(name, "LPT")) {
+		return name[3] >= '0' && name[3] <= '9'
+	}
+	return false
+}
+
+func isUpperHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	if c <= '9' {
+		return c - '0'
+	}
+	return c - 'A' + 10
+}
+
+// SafeNameFS is a filesystem that serves files of a filesystem with names
+// encoded by EncodeSafeName under their decoded names, for example a backup
+// directory of BackupFS created with the WithSafeNames option. Files with
+// names that are not valid encodings are omitted.
+type SafeNameFS struct {
+	fsys fs.FS
+}
+
+// NewSafeNameFS returns a new instance of SafeNameFS.
+func NewSafeNameFS(fsys fs.FS) *SafeNameFS {
+	return &SafeNameFS{
+		fsys: fsys,
+	}
+}
+
+// Open implements fs.FS interface.
+func (s *SafeNameFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	f, err := s.fsys.Open(EncodeSafeName(name))
+	if err != nil {
+		return nil, safeNamePathError(name, err)
+	}
+	return &safeNameFile{wrappedFile: wrappedFile{File: f, name: name}}, nil
+}
+
+// Glob implements fs.GlobFS interface.
+func (s *SafeNameFS) Glob(pattern string) ([]string, error) {
+	return fs.Glob(readDirFS{FSFunc: s.Open, readDir: s.ReadDir}, pattern)
+}
+
+// ReadDir implements fs.ReadDirFS interface.
+func (s *SafeNameFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	entries, err := fs.ReadDir(s.fsys, EncodeSafeName(name))
+	if err != nil {
+		return nil, safeNamePathError(name, err)
+	}
+	return decodeSafeNameEntries(entries), nil
+}
+
+// ReadFile implements fs.ReadFileFS interface.
+func (s *SafeNameFS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+	data, err := fs.ReadFile(s.fsys, EncodeSafeName(name))
+	if err != nil {
+		return nil, safeNamePathError(name, err)
+	}
+	return data, nil
+}
+
+// Stat implements fs.StatFS interface.
+func (s *SafeNameFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	info, err := fs.Stat(s.fsys, EncodeSafeName(name))
+	if err != nil {
+		return nil, safeNamePathError(name, err)
+	}
+	return NewFileInfo(info, WithName(path.Base(name))), nil
+}
+
+// ReadLink implements ReadLinkFS interface. Relative targets of links are
+// decoded.
+func (s *SafeNameFS) ReadLink(name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	target, err := ReadLink(s.fsys, EncodeSafeName(name))
+	if err != nil {
+		return "", safeNamePathError(name, err)
+	}
+	if path.IsAbs(target) {
+		return target, nil
+	}
+	decoded, err := DecodeSafeName(target)
+	if err != nil {
+		return target, nil
+	}
+	return decoded, nil
+}
+
+// Lstat implements ReadLinkFS interface.
+func (s *SafeNameFS) Lstat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "lstat", Path: name, Err: fs.ErrInvalid}
+	}
+	info, err := Lstat(s.fsys, EncodeSafeName(name))
+	if err != nil {
+		return nil, safeNamePathError(name, err)
+	}
+	return NewFileInfo(info, WithName(path.Base(name))), nil
+}
+
+// Sub implements fs.SubFS interface.
+func (s *SafeNameFS) Sub(dir string) (fs.FS, error) {
+	return newSubFS(s, dir)
+}
+
+// Unwrap returns the underlying filesystem.
+func (s *SafeNameFS) Unwrap() fs.FS {
+	return s.fsys
+}
+
+// safeNamePathError replaces the encoded path in fs.PathError with the
+// decoded name.
+func safeNamePathError(name string, err error) error {
+	var e *fs.PathError
+	if errors.As(err, &e) {
+		e.Path = name
+	}
+	return err
+}
+
+// decodeSafeNameEntries returns entries with decoded names, omitting the
+// ones that are not valid encodings.
+func decodeSafeNameEntries(entries []fs.DirEntry) []fs.DirEntry {
+	decoded := make([]fs.DirEntry, 0, len(entries))
+	for _, e := range entries {
+		name, err := DecodeSafeName(e.Name())
+		if err != nil || strings.Contains(name, "/") || EncodeSafeName(name) != e.Name() {
+			continue
+		}
+		if name != e.Name() {
+			e = NewDirEntry(e, WithName(name))
+		}
+		decoded = append(decoded, e)
+	}
+	return decoded
+}
+
+// safeNameFile is a file opened from SafeNameFS with the decoded name.
+type safeNameFile struct {
+	wrappedFile
+}
+
+func (f *safeNameFile) Stat() (fs.FileInfo, error) {
+	info, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return NewFileInfo(info, WithName(path.Base(f.name))), nil
+}
+
+func (f *safeNameFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	for {
+		entries, err := f.wrappedFile.ReadDir(n)
+		decoded := decodeSafeNameEntries(entries)
+		// Read more entries if all of them are omitted, as an empty slice
+		// with nil error is not allowed when n > 0.
+		if n > 0 && len(decoded) == 0 && len(entries) > 0 && err == nil {
+			continue
+		}
+		return decoded, err
+	}
+}
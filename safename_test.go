@@ -0,0 +1,148 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestEncodeSafeName(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		encoded string
+	}{
+		{name: "assets/main.css", encoded: "assets/main.css"},
+		{name: "CON", encoded: "%43ON"},
+		{name: "docs/nul.txt", encoded: "docs/%6Eul.txt"},
+		{name: "com1 .log", encoded: "%63om1 .log"},
+		{name: "COM10", encoded: "COM10"},
+		{name: "console", encoded: "console"},
+		{name: "notes./draft ", encoded: "notes%2E/draft%20"},
+		{name: "a:b|c?.txt", encoded: "a%3Ab%7Cc%3F.txt"},
+		{name: "100%.html", encoded: "100%25.html"},
+		{name: "line\nbreak", encoded: "line%0Abreak"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			encoded := fsutil.EncodeSafeName(tc.name)
+			if encoded != tc.encoded {
+				t.Errorf("got encoded %q, want %q", encoded, tc.encoded)
+			}
+			name, err := fsutil.DecodeSafeName(encoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if name != tc.name {
+				t.Errorf("got decoded %q, want %q", name, tc.name)
+			}
+		})
+	}
+}
+
+func TestDecodeSafeName_invalid(t *testing.T) {
+	for _, name := range []string{"100%", "a%2", "a%zz", "a%2e"} {
+		if _, err := fsutil.DecodeSafeName(name); err == nil {
+			t.Errorf("got no error for %q", name)
+		}
+	}
+}
+
+func TestSafeNameFS(t *testing.T) {
+	fsys := fsutil.NewSafeNameFS(fstest.MapFS{
+		"docs/%6Eul.txt": {Data: []byte("null")},
+		"docs/readme":    {Data: []byte("readme")},
+		"docs/bad%zz":    {Data: []byte("bad")},
+		"notes%2E/a.txt": {Data: []byte("a")},
+	})
+
+	testReadFile(t, fsys, "docs/nul.txt", "null")
+	testReadFile(t, fsys, "notes./a.txt", "a")
+	testReadFileNotExist(t, fsys, "docs/%6Eul.txt")
+
+	info, err := fsys.Stat("docs/nul.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name() != "nul.txt" {
+		t.Errorf("got name %q, want %q", info.Name(), "nul.txt")
+	}
+
+	entries, err := fsys.ReadDir("docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if want := []string{"nul.txt", "readme"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got names %v, want %v", names, want)
+	}
+
+	testGlob(t, fsys, "notes./*", []string{"notes./a.txt"})
+
+	if err := fstest.TestFS(fsys, "docs/nul.txt", "docs/readme", "notes./a.txt"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBackupFS_safeNames(t *testing.T) {
+	files := fstest.MapFS{
+		"aux/main.css":   {Data: []byte("body {}")},
+		"docs/draft. ":   {Data: []byte("draft")},
+		"docs/readme.md": {Data: []byte("readme")},
+	}
+	backupDir := t.TempDir()
+
+	fsys, err := fsutil.NewBackupFS(files, backupDir, time.Hour, fsutil.WithSafeNames())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(backupDir, "%61ux", "main.css"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "body {}" {
+		t.Errorf("got content %q, want %q", data, "body {}")
+	}
+	if _, err := os.Stat(filepath.Join(backupDir, "docs", "draft.%20")); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"aux":          "%61ux",
+		"aux/main.css": "%61ux/main.css",
+		"docs/draft. ": "docs/draft.%20",
+	}
+	if got := fsys.EncodedNames(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got encoded names %v, want %v", got, want)
+	}
+
+	if err := fsys.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	delete(files, "docs/draft. ")
+	testReadFile(t, fsys, "docs/draft. ", "draft")
+	entries, err := fsys.ReadDir("docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if want := []string{"draft. ", "readme.md"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got names %v, want %v", names, want)
+	}
+}
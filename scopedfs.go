@@ -0,0 +1,212 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"context"
+	"io/fs"
+	"path"
+)
+
+var (
+	_ fs.FS         = (*ScopedFS)(nil)
+	_ fs.GlobFS     = (*ScopedFS)(nil)
+	_ fs.ReadDirFS  = (*ScopedFS)(nil)
+	_ fs.ReadFileFS = (*ScopedFS)(nil)
+	_ fs.StatFS     = (*ScopedFS)(nil)
+	_ fs.SubFS      = (*ScopedFS)(nil)
+	_ OpenContextFS = (*ScopedFS)(nil)
+	_ StatContextFS = (*ScopedFS)(nil)
+	_ ReadLinkFS    = (*ScopedFS)(nil)
+)
+
+// ScopedFS is a filesystem that allows access only to files that are in the
+// scope defined by values of a context, for example to isolate assets of
+// tenants by the tenant ID from the request context. Files that are not in
+// the scope do not exist for the caller, so that their existence is not
+// revealed, and they are omitted from directory listings.
+//
+// OpenContext and StatContext methods use the provided context, while other
+// methods use the context set by the WithContext method, which is
+// context.Background by default. To use ScopedFS with http.FileServer, which
+// does not pass the request context to the filesystem, construct the file
+// server with the filesystem returned by WithContext for every request.
+type ScopedFS struct {
+	fsys  fs.FS
+	scope func(ctx context.Context) (allowed func(name string) bool)
+	ctx   context.Context
+}
+
+// NewScopedFS returns a new instance of ScopedFS. The scope function is called
+// for every operation with its context and it returns the function that
+// reports whether the named file or directory is accessible. If the scope
+// function returns nil, no files are accessible.
+func NewScopedFS(fsys fs.FS, scope func(ctx context.Context) (allowed func(name string) bool)) *ScopedFS {
+	return &ScopedFS{
+		fsys:  fsys,
+		scope: scope,
+		ctx:   context.Background(),
+	}
+}
+
+// WithContext returns a copy of the filesystem that uses the context for
+// methods that do not accept one.
+func (s *ScopedFS) WithContext(ctx context.Context) *ScopedFS {
+	c := *s
+	c.ctx = ctx
+	return &c
+}
+
+// Open implements fs.FS interface.
+func (s *ScopedFS) Open(name string) (fs.File, error) {
+	return s.OpenContext(s.ctx, name)
+}
+
+// OpenContext implements OpenContextFS interface.
+func (s *ScopedFS) OpenContext(ctx context.Context, name string) (fs.File, error) {
+	allowed := s.scope(ctx)
+	if err := s.check(allowed, "open", name); err != nil {
+		return nil, err
+	}
+	var (
+		f   fs.File
+		err error
+	)
+	if cfs, ok := s.fsys.(OpenContextFS); ok {
+		f, err = cfs.OpenContext(ctx, name)
+	} else {
+		f, err = s.fsys.Open(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	d, ok := f.(fs.ReadDirFile)
+	if !ok {
+		return f, nil
+	}
+	// Regular files, such as *os.File, also implement fs.ReadDirFile and
+	// they are returned as they are to keep io.Seeker and io.ReaderAt.
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if !info.IsDir() {
+		return f, nil
+	}
+	return &scopedDir{ReadDirFile: d, name: name, allowed: allowed}, nil
+}
+
+// Glob implements fs.GlobFS interface.
+func (s *ScopedFS) Glob(pattern string) ([]string, error) {
+	return fs.Glob(readDirFS{FSFunc: s.Open, readDir: s.ReadDir}, pattern)
+}
+
+// ReadDir implements fs.ReadDirFS interface.
+func (s *ScopedFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	allowed := s.scope(s.ctx)
+	if err := s.check(allowed, "readdir", name); err != nil {
+		return nil, err
+	}
+	entries, err := fs.ReadDir(s.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	return filterScopedEntries(allowed, name, entries), nil
+}
+
+// ReadFile implements fs.ReadFileFS interface.
+func (s *ScopedFS) ReadFile(name string) ([]byte, error) {
+	if err := s.check(s.scope(s.ctx), "readfile", name); err != nil {
+		return nil, err
+	}
+	return fs.ReadFile(s.fsys, name)
+}
+
+// Stat implements fs.StatFS interface.
+func (s *ScopedFS) Stat(name string) (fs.FileInfo, error) {
+	return s.StatContext(s.ctx, name)
+}
+
+// ReadLink implements ReadLinkFS interface.
+func (s *ScopedFS) ReadLink(name string) (string, error) {
+	if err := s.check(s.scope(s.ctx), "readlink", name); err != nil {
+		return "", err
+	}
+	return ReadLink(s.fsys, name)
+}
+
+// Lstat implements ReadLinkFS interface.
+func (s *ScopedFS) Lstat(name string) (fs.FileInfo, error) {
+	if err := s.check(s.scope(s.ctx), "lstat", name); err != nil {
+		return nil, err
+	}
+	return Lstat(s.fsys, name)
+}
+
+// StatContext implements StatContextFS interface.
+func (s *ScopedFS) StatContext(ctx context.Context, name string) (fs.FileInfo, error) {
+	if err := s.check(s.scope(ctx), "stat", name); err != nil {
+		return nil, err
+	}
+	if cfs, ok := s.fsys.(StatContextFS); ok {
+		return cfs.StatContext(ctx, name)
+	}
+	return fs.Stat(s.fsys, name)
+}
+
+// Sub implements fs.SubFS interface.
+func (s *ScopedFS) Sub(dir string) (fs.FS, error) {
+	return newSubFS(s, dir)
+}
+
+// Unwrap returns the underlying filesystem.
+func (s *ScopedFS) Unwrap() fs.FS {
+	return s.fsys
+}
+
+// check returns fs.ErrNotExist if the named file is not allowed.
+func (s *ScopedFS) check(allowed func(name string) bool, op, name string) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if allowed == nil || !allowed(name) {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return nil
+}
+
+// scopedDir is a directory opened from ScopedFS with entries that are not
+// allowed omitted.
+type scopedDir struct {
+	fs.ReadDirFile
+	name    string
+	allowed func(name string) bool
+}
+
+func (d *scopedDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	for {
+		entries, err := d.ReadDirFile.ReadDir(n)
+		filtered := filterScopedEntries(d.allowed, d.name, entries)
+		// Read the next batch if all entries in this one are omitted, so
+		// that an empty result is returned only at the end of the directory.
+		if n > 0 && len(filtered) == 0 && len(entries) > 0 && err == nil {
+			continue
+		}
+		return filtered, err
+	}
+}
+
+// filterScopedEntries returns entries of the directory that are allowed.
+func filterScopedEntries(allowed func(name string) bool, dir string, entries []fs.DirEntry) []fs.DirEntry {
+	filtered := make([]fs.DirEntry, 0, len(entries))
+	for _, e := range entries {
+		if allowed(path.Join(dir, e.Name())) {
+			filtered = append(filtered, e)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,179 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"resenje.org/fsutil"
+)
+
+type tenantKey struct{}
+
+func tenantScope(ctx context.Context) func(name string) bool {
+	tenant, ok := ctx.Value(tenantKey{}).(string)
+	if !ok {
+		return nil
+	}
+	return func(name string) bool {
+		return name == "." || name == "shared" || strings.HasPrefix(name, "shared/") ||
+			name == "tenants" || name == "tenants/"+tenant || strings.HasPrefix(name, "tenants/"+tenant+"/")
+	}
+}
+
+func TestScopedFS(t *testing.T) {
+	files := fsutil.MapFS{
+		"shared/logo.svg":      {Data: []byte("<svg>")},
+		"tenants/a/style.css":  {Data: []byte("a{}")},
+		"tenants/a/index.html": {Data: []byte("<html>a")},
+		"tenants/b/style.css":  {Data: []byte("b{}")},
+	}
+	scoped := fsutil.NewScopedFS(files, tenantScope)
+	fsys := scoped.WithContext(context.WithValue(context.Background(), tenantKey{}, "a"))
+
+	if err := fstest.TestFS(fsys, "shared/logo.svg", "tenants/a/style.css", "tenants/a/index.html"); err != nil {
+		t.Fatal(err)
+	}
+
+	testOpen(t, fsys, "tenants/a/style.css", "a{}")
+	testReadFile(t, fsys, "shared/logo.svg", "<svg>")
+	testOpenNotExist(t, fsys, "tenants/b/style.css")
+	testReadFileNotExist(t, fsys, "tenants/b/style.css")
+	testStatNotExist(t, fsys, "tenants/b")
+	testReadDirNotExist(t, fsys, "tenants/b")
+	testGlob(t, fsys, "tenants/*/style.css", []string{"tenants/a/style.css"})
+
+	entries, err := fs.ReadDir(fsys, "tenants")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "a" {
+		t.Errorf("got entries %v, want only a", entries)
+	}
+
+	t.Run("no context", func(t *testing.T) {
+		testOpenNotExist(t, scoped, "shared/logo.svg")
+		testStatNotExist(t, scoped, ".")
+	})
+
+	t.Run("open context", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), tenantKey{}, "b")
+		f, err := scoped.OpenContext(ctx, "tenants/b/style.css")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		if _, err := scoped.OpenContext(ctx, "tenants/a/style.css"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("got error %v, want %v", err, fs.ErrNotExist)
+		}
+		if _, err := fsutil.StatContext(ctx, scoped, "tenants/a"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("got error %v, want %v", err, fs.ErrNotExist)
+		}
+	})
+
+	t.Run("file server", func(t *testing.T) {
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), tenantKey{}, r.Header.Get("Tenant"))
+			http.FileServer(http.FS(scoped.WithContext(ctx))).ServeHTTP(w, r)
+		})
+		for _, tc := range []struct {
+			tenant string
+			path   string
+			status int
+		}{
+			{tenant: "a", path: "/tenants/a/style.css", status: http.StatusOK},
+			{tenant: "b", path: "/tenants/a/style.css", status: http.StatusNotFound},
+			{tenant: "b", path: "/shared/logo.svg", status: http.StatusOK},
+		} {
+			r := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			r.Header.Set("Tenant", tc.tenant)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tc.status {
+				t.Errorf("got status %v for tenant %q and path %q, want %v", w.Code, tc.tenant, tc.path, tc.status)
+			}
+		}
+	})
+}
+
+func TestScopedFS_readDirPaging(t *testing.T) {
+	files := make(fsutil.MapFS)
+	for i := 0; i < 10; i++ {
+		files[fmt.Sprintf("dir/%v.txt", i)] = &fsutil.MapFile{}
+	}
+	fsys := fsutil.NewScopedFS(files, func(context.Context) func(string) bool {
+		return func(name string) bool {
+			return name == "dir" || name == "dir/9.txt"
+		}
+	})
+
+	f, err := fsys.Open("dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	entries, err := f.(fs.ReadDirFile).ReadDir(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "9.txt" {
+		t.Errorf("got entries %v, want 9.txt", entries)
+	}
+}
+
+func TestScopedFS_seek(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("0123456789"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	fsys := fsutil.NewScopedFS(os.DirFS(dir), func(context.Context) func(string) bool {
+		return func(string) bool { return true }
+	})
+
+	f, err := fsys.Open("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	s, ok := f.(io.ReadSeeker)
+	if !ok {
+		t.Fatalf("file %T does not implement io.Seeker", f)
+	}
+	if _, err := s.Seek(5, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	rest, err := io.ReadAll(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rest) != "56789" {
+		t.Errorf("got %q, want %q", rest, "56789")
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/a.txt", nil)
+	r.Header.Set("Range", "bytes=2-4")
+	w := httptest.NewRecorder()
+	http.FileServer(http.FS(fsys)).ServeHTTP(w, r)
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("got status %v, want %v", w.Code, http.StatusPartialContent)
+	}
+	if got := w.Body.String(); got != "234" {
+		t.Errorf("got body %q, want %q", got, "234")
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+)
+
+var (
+	_ fs.FS         = (*seekableFS)(nil)
+	_ fs.GlobFS     = (*seekableFS)(nil)
+	_ fs.ReadDirFS  = (*seekableFS)(nil)
+	_ fs.ReadFileFS = (*seekableFS)(nil)
+	_ fs.StatFS     = (*seekableFS)(nil)
+	_ fs.SubFS      = (*seekableFS)(nil)
+	_ io.ReadSeeker = (*seekableFile)(nil)
+	_ ReadLinkFS    = (*seekableFS)(nil)
+)
+
+// defaultSeekableMaxMemory is the default size in bytes above which the
+// content of a file is spilled to a temporary file instead of memory.
+const defaultSeekableMaxMemory = 1 << 20
+
+// SeekableFSOption is used to provide optional parameters to SeekableFS
+// function.
+type SeekableFSOption func(*seekableFSOptions)
+
+type seekableFSOptions struct {
+	maxMemory int64
+	tmpDir    string
+}
+
+// WithSeekableMaxMemory sets the size in bytes of the largest file content
+// that is kept in memory. The content of larger files is written to a
+// temporary file. The default is 1 MiB.
+func WithSeekableMaxMemory(n int64) SeekableFSOption {
+	return func(o *seekableFSOptions) {
+		o.maxMemory = n
+	}
+}
+
+// WithSeekableTempDir sets the directory for temporary files with the content
+// of files larger than the maximal memory size. By default, the default
+// directory for temporary files is used.
+func WithSeekableTempDir(dir string) SeekableFSOption {
+	return func(o *seekableFSOptions) {
+		o.tmpDir = dir
+	}
+}
+
+// SeekableFS returns a filesystem with regular files that always implement
+// io.Seeker, as it is required by http.ServeContent. Files that do not
+// implement io.Seeker, or that fail to seek to their current offset, are read
+// sequentially until the first Seek call, when their content is spilled to
+// memory or, if it is larger than the maximal memory size, to a temporary
+// file that is removed when the file is closed. If some content is already
+// read, the file is opened again to spill the complete content.
+func SeekableFS(fsys fs.FS, opts ...SeekableFSOption) fs.FS {
+	o := seekableFSOptions{
+		maxMemory: defaultSeekableMaxMemory,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &seekableFS{
+		fsys: fsys,
+		o:    o,
+	}
+}
+
+type seekableFS struct {
+	fsys fs.FS
+	o    seekableFSOptions
+}
+
+func (s *seekableFS) Open(name string) (fs.File, error) {
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		return f, nil
+	}
+	// Wrappers, such as the files of HashFS, implement io.Seeker even if
+	// the underlying file does not, which is detected by seeking to the
+	// current offset.
+	if seeker, ok := f.(io.Seeker); ok {
+		if _, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			return f, nil
+		}
+	}
+	return &seekableFile{
+		File:       f,
+		name:       name,
+		seekableFS: s,
+	}, nil
+}
+
+func (s *seekableFS) Glob(pattern string) ([]string, error) {
+	return fs.Glob(s.fsys, pattern)
+}
+
+func (s *seekableFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(s.fsys, name)
+}
+
+func (s *seekableFS) ReadFile(name string) ([]byte, error) {
+	return fs.ReadFile(s.fsys, name)
+}
+
+func (s *seekableFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(s.fsys, name)
+}
+
+func (s *seekableFS) ReadLink(name string) (string, error) {
+	return ReadLink(s.fsys, name)
+}
+
+func (s *seekableFS) Lstat(name string) (fs.FileInfo, error) {
+	return Lstat(s.fsys, name)
+}
+
+func (s *seekableFS) Sub(dir string) (fs.FS, error) {
+	return newSubFS(s, dir)
+}
+
+func (s *seekableFS) Unwrap() fs.FS {
+	return s.fsys
+}
+
+// seekableFile reads from the file until the first Seek call and from the
+// spilled content after it.
+type seekableFile struct {
+	fs.File
+	name       string
+	seekableFS *seekableFS
+
+	offset  int64
+	spilled io.ReadSeeker
+	tmpFile *os.File
+}
+
+func (f *seekableFile) Read(p []byte) (int, error) {
+	if f.spilled != nil {
+		return f.spilled.Read(p)
+	}
+	n, err := f.File.Read(p)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *seekableFile) Seek(offset int64, whence int) (int64, error) {
+	if f.spilled == nil {
+		// Seeking to the current position does not require spilling.
+		if offset == 0 && whence == io.SeekCurrent {
+			return f.offset, nil
+		}
+		if err := f.spill(); err != nil {
+			return 0, &fs.PathError{Op: "seek", Path: f.name, Err: err}
+		}
+		if _, err := f.spilled.Seek(f.offset, io.SeekStart); err != nil {
+			return 0, err
+		}
+	}
+	return f.spilled.Seek(offset, whence)
+}
+
+func (f *seekableFile) Close() error {
+	err := f.File.Close()
+	if f.tmpFile != nil {
+		if cerr := f.tmpFile.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		if rerr := os.Remove(f.tmpFile.Name()); rerr != nil && err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
+
+// spill copies the complete content of the file to memory or to a temporary
+// file.
+func (f *seekableFile) spill() error {
+	r := io.Reader(f.File)
+	if f.offset > 0 {
+		rf, err := f.seekableFS.fsys.Open(f.name)
+		if err != nil {
+			return err
+		}
+		defer rf.Close()
+		r = rf
+	}
+
+	spilled, tmpFile, err := spill(r, f.seekableFS.o.maxMemory, f.seekableFS.o.tmpDir)
+	if err != nil {
+		return err
+	}
+	f.tmpFile = tmpFile
+	f.spilled = spilled
+	return nil
+}
+
+// spilledContent is the content of a file copied by the spill function.
+type spilledContent interface {
+	io.ReadSeeker
+	io.ReaderAt
+}
+
+// spill copies all data from the reader to memory or, if it is larger than
+// maxMemory bytes, to a temporary file in tmpDir. The temporary file is
+// returned, so that it can be closed and removed.
+func spill(r io.Reader, maxMemory int64, tmpDir string) (spilledContent, *os.File, error) {
+	var buf bytes.Buffer
+	n, err := io.CopyN(&buf, r, maxMemory+1)
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+	if n <= maxMemory {
+		return bytes.NewReader(buf.Bytes()), nil, nil
+	}
+
+	tmpFile, err := os.CreateTemp(tmpDir, "fsutil-spill-")
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := buf.WriteTo(tmpFile); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+		return nil, nil, err
+	}
+	if _, err := io.Copy(tmpFile, r); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+		return nil, nil, err
+	}
+	return tmpFile, tmpFile, nil
+}
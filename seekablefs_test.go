@@ -0,0 +1,155 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestSeekableFS(t *testing.T) {
+	files := fsutil.MapFS{
+		"small.txt":     {Data: []byte("0123456789")},
+		"dir/large.txt": {Data: []byte("abcdefghijklmnopqrstuvwxyz")},
+	}
+	// Hide io.Seeker from regular files.
+	nonSeekable := fsutil.FSFunc(func(name string) (fs.File, error) {
+		f, err := files.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := f.(fs.ReadDirFile); ok {
+			return f, nil
+		}
+		return struct{ fs.File }{f}, nil
+	})
+
+	tmpDir := t.TempDir()
+	fsys := fsutil.SeekableFS(nonSeekable, fsutil.WithSeekableMaxMemory(16), fsutil.WithSeekableTempDir(tmpDir))
+
+	if err := fstest.TestFS(fsys, "small.txt", "dir/large.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		want string
+	}{
+		{name: "small.txt", want: "3456789"},
+		{name: "dir/large.txt", want: "defghijklmnopqrstuvwxyz"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := fsys.Open(tc.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s, ok := f.(io.ReadSeeker)
+			if !ok {
+				t.Fatal("file does not implement io.Seeker")
+			}
+
+			b := make([]byte, 5)
+			if _, err := io.ReadFull(s, b); err != nil {
+				t.Fatal(err)
+			}
+			offset, err := s.Seek(-2, io.SeekCurrent)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if offset != 3 {
+				t.Errorf("got offset %v, want %v", offset, 3)
+			}
+			rest, err := io.ReadAll(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(rest); got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+
+			if err := f.Close(); err != nil {
+				t.Fatal(err)
+			}
+			entries, err := os.ReadDir(tmpDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("got %v temporary files after close, want none", len(entries))
+			}
+		})
+	}
+
+	t.Run("serve content", func(t *testing.T) {
+		f, err := fsys.Open("dir/large.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		r := httptest.NewRequest(http.MethodGet, "/large.txt", nil)
+		r.Header.Set("Range", "bytes=20-")
+		w := httptest.NewRecorder()
+		http.ServeContent(w, r, "large.txt", time.Time{}, f.(io.ReadSeeker))
+
+		if w.Code != http.StatusPartialContent {
+			t.Fatalf("got status %v, want %v", w.Code, http.StatusPartialContent)
+		}
+		if got, want := w.Body.String(), "uvwxyz"; got != want {
+			t.Errorf("got body %q, want %q", got, want)
+		}
+	})
+}
+
+func TestSeekableFS_hashFS(t *testing.T) {
+	files := fsutil.MapFS{
+		"data.txt": {Data: []byte("0123456789")},
+	}
+	// Hide io.Seeker from regular files.
+	nonSeekable := fsutil.FSFunc(func(name string) (fs.File, error) {
+		f, err := files.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := f.(fs.ReadDirFile); ok {
+			return f, nil
+		}
+		return struct{ fs.File }{f}, nil
+	})
+	hashFS := fsutil.NewHashFS(nonSeekable, fsutil.NewMD5Hasher(8))
+	hashedPath, err := hashFS.HashedPath("data.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fsys := fsutil.SeekableFS(hashFS)
+
+	f, err := fsys.Open(hashedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	s := f.(io.ReadSeeker)
+	if _, err := s.Seek(4, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	rest, err := io.ReadAll(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(rest), "456789"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+)
+
+// ServeFileOption sets an optional parameter of the ServeFile function.
+type ServeFileOption func(*serveFileOptions)
+
+type serveFileOptions struct {
+	hasher   Hasher
+	seekable []SeekableFSOption
+}
+
+// WithServeFileHasher sets the ETag header to the hash of the file content
+// computed by the hasher, so that requests with the If-None-Match header are
+// answered without the content if the file did not change. The content is
+// read to compute the hash on every request, unless the ETag header is
+// already set.
+func WithServeFileHasher(h Hasher) ServeFileOption {
+	return func(o *serveFileOptions) {
+		o.hasher = h
+	}
+}
+
+// WithServeFileSeekableOptions sets options of SeekableFS that is used to
+// serve files that do not implement io.Seeker.
+func WithServeFileSeekableOptions(opts ...SeekableFSOption) ServeFileOption {
+	return func(o *serveFileOptions) {
+		o.seekable = opts
+	}
+}
+
+// ServeFile replies to the request with the content of the named file from
+// the filesystem. It uses http.ServeContent to handle Range, If-Match,
+// If-Unmodified-Since, If-None-Match, If-Modified-Since and If-Range headers
+// and HEAD requests. Files that do not implement io.Seeker, which is required
+// by http.ServeContent, are served through SeekableFS. Files that wrap an
+// *os.File, such as files of HashFS and BackupFS on os.DirFS, are served from
+// that file as returned by RawFile, so that their content can be sent by the
+// operating system without copying it through user space. Directories are not
+// served and the response is 404 Not Found, as it is for files that do not
+// exist.
+func ServeFile(w http.ResponseWriter, r *http.Request, fsys fs.FS, name string, opts ...ServeFileOption) {
+	var o serveFileOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if !fs.ValidPath(name) {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	f, err := SeekableFS(fsys, o.seekable...).Open(name)
+	if err != nil {
+		serveFSError(w, r, err)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		serveFSError(w, r, err)
+		return
+	}
+	if info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		serveFSError(w, r, &fs.PathError{Op: "seek", Path: name, Err: ErrNotSeekable})
+		return
+	}
+
+	if o.hasher != nil && w.Header().Get("ETag") == "" {
+		hash, err := hashFileContent(o.hasher, content, info)
+		if err != nil {
+			serveFSError(w, r, err)
+			return
+		}
+		if _, err := content.Seek(0, io.SeekStart); err != nil {
+			serveFSError(w, r, err)
+			return
+		}
+		w.Header().Set("ETag", `"`+hash+`"`)
+	}
+
+	// Serving the operating system file directly allows the response to be
+	// written with sendfile.
+	if raw := RawFile(f); raw != nil {
+		content = raw
+	}
+	http.ServeContent(w, r, info.Name(), info.ModTime(), content)
+}
+
+// serveFSError replies to the request with the HTTP status that corresponds
+// to the filesystem error.
+func serveFSError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		http.NotFound(w, r)
+	case errors.Is(err, fs.ErrPermission):
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+	default:
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
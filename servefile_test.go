@@ -0,0 +1,104 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestServeFile(t *testing.T) {
+	modTime := time.Date(2021, 8, 9, 10, 11, 12, 0, time.UTC)
+	files := fstest.MapFS{
+		"docs/readme.txt": {Data: []byte("hello world"), ModTime: modTime},
+	}
+	hasher := fsutil.NewMD5Hasher(8)
+	etag := `"5eb63bbb"`
+
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "docs"), 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "docs", "readme.txt"), []byte("hello world"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	backupFS, err := fsutil.NewBackupFS(os.DirFS(dir), t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		fsys   fs.FS
+		method string
+		target string
+		header http.Header
+		status int
+		body   string
+		etag   string
+	}{
+		{name: "get", target: "docs/readme.txt", status: http.StatusOK, body: "hello world", etag: etag},
+		{name: "head", method: http.MethodHead, target: "docs/readme.txt", status: http.StatusOK, etag: etag},
+		{name: "range", target: "docs/readme.txt", header: http.Header{"Range": {"bytes=6-"}}, status: http.StatusPartialContent, body: "world", etag: etag},
+		{name: "if none match", target: "docs/readme.txt", header: http.Header{"If-None-Match": {etag}}, status: http.StatusNotModified, etag: etag},
+		{name: "if none match changed", target: "docs/readme.txt", header: http.Header{"If-None-Match": {`"01234567"`}}, status: http.StatusOK, body: "hello world", etag: etag},
+		{name: "if modified since", target: "docs/readme.txt", header: http.Header{"If-Modified-Since": {modTime.Format(http.TimeFormat)}}, status: http.StatusNotModified, etag: etag},
+		{name: "not seekable", fsys: notSeekableFS{files}, target: "docs/readme.txt", header: http.Header{"Range": {"bytes=0-4"}}, status: http.StatusPartialContent, body: "hello", etag: etag},
+		{name: "raw file", fsys: backupFS, target: "docs/readme.txt", header: http.Header{"Range": {"bytes=6-"}}, status: http.StatusPartialContent, body: "world", etag: etag},
+		{name: "directory", target: "docs", status: http.StatusNotFound},
+		{name: "not found", target: "docs/missing.txt", status: http.StatusNotFound},
+		{name: "invalid", target: "../docs/readme.txt", status: http.StatusBadRequest},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fsys := tc.fsys
+			if fsys == nil {
+				fsys = files
+			}
+			method := tc.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			r := httptest.NewRequest(method, "/", nil)
+			for k, v := range tc.header {
+				r.Header[k] = v
+			}
+			w := httptest.NewRecorder()
+
+			fsutil.ServeFile(w, r, fsys, tc.target, fsutil.WithServeFileHasher(hasher))
+
+			if w.Code != tc.status {
+				t.Fatalf("got status %v, want %v", w.Code, tc.status)
+			}
+			if tc.status < 400 && w.Body.String() != tc.body {
+				t.Errorf("got body %q, want %q", w.Body.String(), tc.body)
+			}
+			if got := w.Header().Get("ETag"); got != tc.etag {
+				t.Errorf("got etag %q, want %q", got, tc.etag)
+			}
+		})
+	}
+}
+
+// notSeekableFS returns files that do not implement io.Seeker.
+type notSeekableFS struct {
+	fsys fs.FS
+}
+
+func (s notSeekableFS) Open(name string) (fs.File, error) {
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return struct{ fs.File }{f}, nil
+}
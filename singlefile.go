@@ -0,0 +1,113 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	_ fs.FS         = (*singleFileFS)(nil)
+	_ fs.ReadDirFS  = (*singleFileFS)(nil)
+	_ fs.ReadFileFS = (*singleFileFS)(nil)
+	_ fs.StatFS     = (*singleFileFS)(nil)
+)
+
+// SingleFileFS returns a filesystem with only one file with the provided name,
+// data, permissions and modification time. If the name contains directories,
+// they are also present in the filesystem. This filesystem can be used to
+// serve generated content, such as robots.txt, with the same filesystem
+// wrappers as other files.
+func SingleFileFS(name string, data []byte, mode fs.FileMode, modTime time.Time) fs.FS {
+	return &singleFileFS{
+		name: name,
+		data: data,
+		info: &memFileInfo{
+			name:    path.Base(name),
+			size:    int64(len(data)),
+			mode:    mode &^ fs.ModeType,
+			modTime: modTime,
+		},
+	}
+}
+
+type singleFileFS struct {
+	name string
+	data []byte
+	info *memFileInfo
+}
+
+func (f *singleFileFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == f.name {
+		return newMemFile(name, f.info, f.data), nil
+	}
+	entry, ok := f.dirEntry(name)
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return newMemDir(name, f.dirInfo(name), []fs.DirEntry{entry}), nil
+}
+
+func (f *singleFileFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	entry, ok := f.dirEntry(name)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	return []fs.DirEntry{entry}, nil
+}
+
+func (f *singleFileFS) ReadFile(name string) ([]byte, error) {
+	if name != f.name {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrNotExist}
+	}
+	data := make([]byte, len(f.data))
+	copy(data, f.data)
+	return data, nil
+}
+
+func (f *singleFileFS) Stat(name string) (fs.FileInfo, error) {
+	if name == f.name {
+		return f.info, nil
+	}
+	if _, ok := f.dirEntry(name); !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return f.dirInfo(name), nil
+}
+
+// dirEntry returns the only entry of a directory with the name if it is one
+// of the directories of the file.
+func (f *singleFileFS) dirEntry(name string) (fs.DirEntry, bool) {
+	var rest string
+	if name == "." {
+		rest = f.name
+	} else if strings.HasPrefix(f.name, name+"/") {
+		rest = f.name[len(name)+1:]
+	} else {
+		return nil, false
+	}
+	if i := strings.Index(rest, "/"); i >= 0 {
+		return f.dirInfo(rest[:i]), true
+	}
+	return f.info, true
+}
+
+func (f *singleFileFS) dirInfo(name string) *memFileInfo {
+	return &memFileInfo{
+		name:    path.Base(name),
+		mode:    fs.ModeDir | 0o555,
+		modTime: f.info.modTime,
+	}
+}
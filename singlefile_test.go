@@ -0,0 +1,50 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestSingleFileFS(t *testing.T) {
+	modTime := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	content := "User-agent: *\nDisallow:\n"
+
+	for _, name := range []string{
+		"robots.txt",
+		"static/txt/robots.txt",
+	} {
+		t.Run(name, func(t *testing.T) {
+			fsys := fsutil.SingleFileFS(name, []byte(content), 0o444, modTime)
+
+			if err := fstest.TestFS(fsys, name); err != nil {
+				t.Fatal(err)
+			}
+
+			testOpen(t, fsys, name, content)
+			testOpenNotExist(t, fsys, "index.html")
+
+			info, err := fs.Stat(fsys, name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode() != 0o444 {
+				t.Errorf("got mode %v, want %v", info.Mode(), fs.FileMode(0o444))
+			}
+			if !info.ModTime().Equal(modTime) {
+				t.Errorf("got mod time %v, want %v", info.ModTime(), modTime)
+			}
+			if info.Size() != int64(len(content)) {
+				t.Errorf("got size %v, want %v", info.Size(), len(content))
+			}
+		})
+	}
+}
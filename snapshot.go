@@ -0,0 +1,232 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var (
+	_ fs.FS         = (*SnapshotFS)(nil)
+	_ fs.GlobFS     = (*SnapshotFS)(nil)
+	_ fs.ReadDirFS  = (*SnapshotFS)(nil)
+	_ fs.ReadFileFS = (*SnapshotFS)(nil)
+	_ fs.StatFS     = (*SnapshotFS)(nil)
+	_ fs.SubFS      = (*SnapshotFS)(nil)
+)
+
+// SnapshotFS is an immutable filesystem with files captured by the Snapshot
+// function. It is not affected by changes of the filesystem that it is
+// captured from.
+type SnapshotFS struct {
+	fsys fs.FS
+	dir  string // temporary directory with files, empty if files are in memory
+
+	released bool
+	mu       sync.RWMutex
+}
+
+// SnapshotOption sets an optional parameter of the Snapshot function.
+type SnapshotOption func(*snapshotOptions)
+
+type snapshotOptions struct {
+	toDir bool
+	dir   string
+}
+
+// WithSnapshotDir makes Snapshot copy files to a new temporary directory in
+// dir, instead of reading them into memory. If dir is the empty string, the
+// default directory for temporary files is used. The temporary directory is
+// removed by the Release method.
+func WithSnapshotDir(dir string) SnapshotOption {
+	return func(o *snapshotOptions) {
+		o.toDir = true
+		o.dir = dir
+	}
+}
+
+// Snapshot captures all files and directories from the filesystem and returns
+// a filesystem that serves them without accessing fsys again. By default,
+// files are read into memory, as with Preload. File modes and modification
+// times are preserved and symbolic links to directories are followed. Files
+// that are changed while they are captured may be captured in either state.
+// The Release method should be called when the snapshot is not needed anymore.
+func Snapshot(fsys fs.FS, opts ...SnapshotOption) (*SnapshotFS, error) {
+	var o snapshotOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if !o.toDir {
+		m, err := preload(fsys, preloadOptions{}, nil)
+		if err != nil {
+			return nil, fmt.Errorf("snapshot: %w", err)
+		}
+		return &SnapshotFS{fsys: m}, nil
+	}
+
+	dir, err := os.MkdirTemp(o.dir, "snapshot-")
+	if err != nil {
+		return nil, fmt.Errorf("snapshot: create temporary directory: %w", err)
+	}
+	if err := fs.WalkDir(fsys, ".", snapshotWalkFunc(fsys, dir, 0)); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("snapshot: %w", err)
+	}
+	return &SnapshotFS{
+		fsys: os.DirFS(dir),
+		dir:  dir,
+	}, nil
+}
+
+// snapshotWalkFunc returns a function that copies files and directories to
+// dir. Symbolic links to directories are followed up to maxSymlinkDepth
+// levels.
+func snapshotWalkFunc(fsys fs.FS, dir string, depth int) fs.WalkDirFunc {
+	return func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		snapshotPath := filepath.Join(dir, filepath.FromSlash(path))
+		if d.IsDir() {
+			if err := os.MkdirAll(snapshotPath, 0o777); err != nil {
+				return fmt.Errorf("create directory %s: %w", snapshotPath, err)
+			}
+			return nil
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			info, err := fs.Stat(fsys, path)
+			if err != nil {
+				return fmt.Errorf("stat link target %s: %w", path, err)
+			}
+			if info.IsDir() {
+				if depth >= maxSymlinkDepth {
+					return fmt.Errorf("follow link %s: too many levels of symbolic links", path)
+				}
+				return fs.WalkDir(fsys, path, snapshotWalkFunc(fsys, dir, depth+1))
+			}
+		}
+		return snapshotFile(fsys, path, snapshotPath)
+	}
+}
+
+// snapshotFile copies a single file from the filesystem to the snapshotPath
+// with the same permissions and modification time.
+func snapshotFile(fsys fs.FS, path, snapshotPath string) error {
+	fr, err := fsys.Open(path)
+	if err != nil {
+		return fmt.Errorf("open file %s: %w", path, err)
+	}
+	defer fr.Close()
+
+	info, err := fr.Stat()
+	if err != nil {
+		return fmt.Errorf("file info %s: %w", path, err)
+	}
+	fw, err := os.OpenFile(snapshotPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, info.Mode().Perm()|permUserWrite)
+	if err != nil {
+		return fmt.Errorf("create snapshot file %s: %w", snapshotPath, err)
+	}
+	if _, err := io.Copy(fw, fr); err != nil {
+		fw.Close()
+		return fmt.Errorf("copy file data %s: %w", snapshotPath, err)
+	}
+	if err := fw.Close(); err != nil {
+		return fmt.Errorf("close snapshot file %s: %w", snapshotPath, err)
+	}
+	if modTime := info.ModTime(); !modTime.IsZero() {
+		if err := os.Chtimes(snapshotPath, modTime, modTime); err != nil {
+			return fmt.Errorf("change times %s: %w", snapshotPath, err)
+		}
+	}
+	return nil
+}
+
+// Release frees the memory or removes the temporary directory with captured
+// files. After it is called, all methods return errors that wrap fs.ErrClosed.
+func (s *SnapshotFS) Release() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.released {
+		return nil
+	}
+	s.released = true
+	s.fsys = nil
+	if s.dir != "" {
+		if err := os.RemoveAll(s.dir); err != nil {
+			return fmt.Errorf("remove snapshot directory: %w", err)
+		}
+	}
+	return nil
+}
+
+// filesystem returns the filesystem with captured files or an error if the
+// snapshot is released.
+func (s *SnapshotFS) filesystem(op, name string) (fs.FS, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.released {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrClosed}
+	}
+	return s.fsys, nil
+}
+
+// Open implements fs.FS interface.
+func (s *SnapshotFS) Open(name string) (fs.File, error) {
+	fsys, err := s.filesystem("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return fsys.Open(name)
+}
+
+// Glob implements fs.GlobFS interface.
+func (s *SnapshotFS) Glob(pattern string) ([]string, error) {
+	fsys, err := s.filesystem("glob", pattern)
+	if err != nil {
+		return nil, err
+	}
+	return fs.Glob(fsys, pattern)
+}
+
+// ReadDir implements fs.ReadDirFS interface.
+func (s *SnapshotFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	fsys, err := s.filesystem("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.ReadDir(fsys, name)
+}
+
+// ReadFile implements fs.ReadFileFS interface.
+func (s *SnapshotFS) ReadFile(name string) ([]byte, error) {
+	fsys, err := s.filesystem("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.ReadFile(fsys, name)
+}
+
+// Stat implements fs.StatFS interface.
+func (s *SnapshotFS) Stat(name string) (fs.FileInfo, error) {
+	fsys, err := s.filesystem("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.Stat(fsys, name)
+}
+
+// Sub implements fs.SubFS interface.
+func (s *SnapshotFS) Sub(dir string) (fs.FS, error) {
+	return newSubFS(s, dir)
+}
@@ -0,0 +1,168 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestSnapshot(t *testing.T) {
+	modTime := time.Date(2021, 4, 20, 10, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name string
+		opts func(t *testing.T) []fsutil.SnapshotOption
+	}{
+		{
+			name: "memory",
+			opts: func(t *testing.T) []fsutil.SnapshotOption { return nil },
+		},
+		{
+			name: "directory",
+			opts: func(t *testing.T) []fsutil.SnapshotOption {
+				return []fsutil.SnapshotOption{fsutil.WithSnapshotDir(t.TempDir())}
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			files := fstest.MapFS{
+				"report.csv":  {Data: []byte("a,b"), Mode: 0o644, ModTime: modTime},
+				"data/1.json": {Data: []byte("{}"), Mode: 0o600, ModTime: modTime},
+			}
+
+			fsys, err := fsutil.Snapshot(files, tc.opts(t)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			files["report.csv"] = &fstest.MapFile{Data: []byte("c,d")}
+			files["data/2.json"] = &fstest.MapFile{Data: []byte("[]")}
+			delete(files, "data/1.json")
+
+			if err := fstest.TestFS(fsys, "report.csv", "data/1.json"); err != nil {
+				t.Fatal(err)
+			}
+			testReadFile(t, fsys, "report.csv", "a,b")
+			testReadFile(t, fsys, "data/1.json", "{}")
+			testReadFileNotExist(t, fsys, "data/2.json")
+
+			info, err := fsys.Stat("report.csv")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !info.ModTime().Equal(modTime) {
+				t.Errorf("got mod time %v, want %v", info.ModTime(), modTime)
+			}
+
+			if err := fsys.Release(); err != nil {
+				t.Fatal(err)
+			}
+			if err := fsys.Release(); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := fsys.Open("report.csv"); !errors.Is(err, fs.ErrClosed) {
+				t.Errorf("got error %v, want %v", err, fs.ErrClosed)
+			}
+			if _, err := fsys.ReadFile("report.csv"); !errors.Is(err, fs.ErrClosed) {
+				t.Errorf("got error %v, want %v", err, fs.ErrClosed)
+			}
+		})
+	}
+}
+
+func TestSnapshot_symlinkDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links require privileges on windows")
+	}
+
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "assets", "main.css"), "body {}")
+	if err := os.Symlink("assets", filepath.Join(dir, "static")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		opts func(t *testing.T) []fsutil.SnapshotOption
+	}{
+		{
+			name: "memory",
+			opts: func(t *testing.T) []fsutil.SnapshotOption { return nil },
+		},
+		{
+			name: "directory",
+			opts: func(t *testing.T) []fsutil.SnapshotOption {
+				return []fsutil.SnapshotOption{fsutil.WithSnapshotDir(t.TempDir())}
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fsys, err := fsutil.Snapshot(os.DirFS(dir), tc.opts(t)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer fsys.Release()
+
+			testReadFile(t, fsys, "assets/main.css", "body {}")
+			testReadFile(t, fsys, "static/main.css", "body {}")
+		})
+	}
+}
+
+func TestSnapshot_releaseDir(t *testing.T) {
+	dir := t.TempDir()
+
+	fsys, err := fsutil.Snapshot(fstest.MapFS{
+		"a.txt": {Data: []byte("a")},
+	}, fsutil.WithSnapshotDir(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("got %v entries in the snapshot directory, want 1", len(entries))
+	}
+
+	if err := fsys.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, entries[0].Name())); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got stat error %v, want %v", err, fs.ErrNotExist)
+	}
+}
+
+func TestSnapshot_error(t *testing.T) {
+	dir := t.TempDir()
+
+	if _, err := fsutil.Snapshot(faultyFS{}, fsutil.WithSnapshotDir(dir)); !errors.Is(err, errTest1) {
+		t.Errorf("got error %v, want %v", err, errTest1)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("got %v entries in the snapshot directory, want none", len(entries))
+	}
+
+	if _, err := fsutil.Snapshot(faultyFS{}); !errors.Is(err, errTest1) {
+		t.Errorf("got error %v, want %v", err, errTest1)
+	}
+}
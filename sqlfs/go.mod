@@ -0,0 +1,10 @@
+module resenje.org/fsutil/sqlfs
+
+go 1.16
+
+require (
+	github.com/mattn/go-sqlite3 v1.14.17
+	resenje.org/fsutil v0.0.0-00010101000000-000000000000
+)
+
+replace resenje.org/fsutil => ../
@@ -0,0 +1,514 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package sqlfs provides a writable filesystem with files stored in a table
+// of a SQL database, accessed with the database/sql package, so that any
+// driver can be plugged in.
+//
+// The table must have the following columns, shown here for SQLite:
+//
+//	CREATE TABLE files (
+//		path  TEXT    NOT NULL PRIMARY KEY,
+//		data  BLOB    NOT NULL,
+//		mode  INTEGER NOT NULL,
+//		mtime INTEGER NOT NULL
+//	)
+//
+// The path column holds slash separated names of files as accepted by
+// fs.ValidPath and it must be compared bytewise, without a locale specific
+// collation. The mode column holds permission bits and the mtime column holds
+// the modification time in nanoseconds since the Unix epoch.
+package sqlfs
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+var (
+	_ fs.FS                = (*FS)(nil)
+	_ fs.ReadDirFS         = (*FS)(nil)
+	_ fs.ReadFileFS        = (*FS)(nil)
+	_ fs.StatFS            = (*FS)(nil)
+	_ fsutil.OpenContextFS = (*FS)(nil)
+	_ fsutil.StatContextFS = (*FS)(nil)
+	_ fsutil.WriteFileFS   = (*FS)(nil)
+	_ fsutil.RemoveFS      = (*FS)(nil)
+)
+
+var (
+	errIsDir       = errors.New("is a directory")
+	errNotDir      = errors.New("not a directory")
+	errNotEmpty    = errors.New("directory not empty")
+	errWriteClosed = errors.New("write to closed file")
+)
+
+var tableNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// FS is a filesystem with files that are rows of a database table. Directories
+// are not stored, they are derived from names of files, so that a directory
+// exists only if there is at least one file in it, and it is removed with its
+// last file. The content of an opened file is read into memory, so that the
+// file implements io.Seeker.
+type FS struct {
+	db    *sql.DB
+	table string
+	o     options
+}
+
+// Option is used to provide optional parameters to New function.
+type Option func(*options)
+
+type options struct {
+	placeholder func(i int) string
+}
+
+// WithPlaceholder sets the function that returns the query parameter
+// placeholder for the i-th parameter, starting from 1. By default, the "?"
+// placeholder is used, which is supported by SQLite and MySQL drivers, while
+// PostgreSQL drivers require "$1", "$2" and so on.
+func WithPlaceholder(placeholder func(i int) string) Option {
+	return func(o *options) {
+		o.placeholder = placeholder
+	}
+}
+
+// New returns a new FS with files in the database table. The table name may be
+// qualified with a schema name and it must be a plain identifier, as it is
+// used in queries without quoting.
+func New(db *sql.DB, table string, opts ...Option) (*FS, error) {
+	if !tableNameRegexp.MatchString(table) {
+		return nil, fmt.Errorf("invalid table name %q", table)
+	}
+	o := options{
+		placeholder: func(int) string { return "?" },
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &FS{
+		db:    db,
+		table: table,
+		o:     o,
+	}, nil
+}
+
+// Open implements fs.FS interface.
+func (s *FS) Open(name string) (fs.File, error) {
+	return s.OpenContext(context.Background(), name)
+}
+
+// OpenContext implements fsutil.OpenContextFS interface.
+func (s *FS) OpenContext(ctx context.Context, name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if name != "." {
+		data, info, err := s.get(ctx, s.db, name)
+		if err == nil {
+			return &file{Reader: bytes.NewReader(data), info: info}, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+	entries, err := s.readDir(ctx, name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &dir{info: dirInfo(name), entries: entries}, nil
+}
+
+// ReadDir implements fs.ReadDirFS interface.
+func (s *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	ctx := context.Background()
+	entries, err := s.readDir(ctx, name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			if _, err := s.stat(ctx, s.db, name); err == nil {
+				return nil, &fs.PathError{Op: "readdir", Path: name, Err: errNotDir}
+			}
+		}
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	return entries, nil
+}
+
+// ReadFile implements fs.ReadFileFS interface.
+func (s *FS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: errIsDir}
+	}
+	ctx := context.Background()
+	data, _, err := s.get(ctx, s.db, name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			if ok, _ := s.hasFiles(ctx, s.db, name); ok {
+				err = errIsDir
+			}
+		}
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: err}
+	}
+	return data, nil
+}
+
+// Stat implements fs.StatFS interface.
+func (s *FS) Stat(name string) (fs.FileInfo, error) {
+	return s.StatContext(context.Background(), name)
+}
+
+// StatContext implements fsutil.StatContextFS interface.
+func (s *FS) StatContext(ctx context.Context, name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return dirInfo(name), nil
+	}
+	info, err := s.stat(ctx, s.db, name)
+	if err == nil {
+		return info, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	ok, err := s.hasFiles(ctx, s.db, name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return dirInfo(name), nil
+}
+
+// WriteFile writes data to the named file, creating it with permissions perm
+// if necessary, and truncating it if it exists. Parent directories are
+// created implicitly.
+func (s *FS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return s.write(context.Background(), "writefile", name, data, perm)
+}
+
+// Create creates or truncates the named file with permissions 0o666 and
+// returns a writer to it. Written data is buffered in memory and stored when
+// the writer is closed, so that errors are returned by the Close method.
+func (s *FS) Create(name string) (io.WriteCloser, error) {
+	if !fs.ValidPath(name) || name == "." {
+		return nil, &fs.PathError{Op: "create", Path: name, Err: fs.ErrInvalid}
+	}
+	return &writer{fs: s, name: name}, nil
+}
+
+// Remove removes the named file. Directories can not be removed as they exist
+// only while there are files in them.
+func (s *FS) Remove(name string) error {
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+	}
+	ctx := context.Background()
+	r, err := s.db.ExecContext(ctx, "DELETE FROM "+s.table+" WHERE path = "+s.o.placeholder(1), name)
+	if err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+	n, err := r.RowsAffected()
+	if err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+	if n > 0 {
+		return nil
+	}
+	ok, err := s.hasFiles(ctx, s.db, name)
+	if err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+	if ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: errNotEmpty}
+	}
+	return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+}
+
+// queryer is implemented by both sql.DB and sql.Tx.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func (s *FS) write(ctx context.Context, op, name string, data []byte, perm fs.FileMode) (err error) {
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if data == nil {
+		data = []byte{}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	// A file can not be written where a parent is a file or where a
+	// directory with the same name exists.
+	for p := path.Dir(name); p != "."; p = path.Dir(p) {
+		if _, err := s.stat(ctx, tx, p); err == nil {
+			return &fs.PathError{Op: op, Path: name, Err: errNotDir}
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return &fs.PathError{Op: op, Path: name, Err: err}
+		}
+	}
+	ok, err := s.hasFiles(ctx, tx, name)
+	if err != nil {
+		return &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	if ok {
+		return &fs.PathError{Op: op, Path: name, Err: errIsDir}
+	}
+
+	mtime := time.Now().UnixNano()
+	// Permissions of an existing file are preserved, as with os.WriteFile.
+	r, err := tx.ExecContext(ctx, "UPDATE "+s.table+" SET data = "+s.o.placeholder(1)+", mtime = "+s.o.placeholder(2)+" WHERE path = "+s.o.placeholder(3), data, mtime, name)
+	if err != nil {
+		return &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	n, err := r.RowsAffected()
+	if err != nil {
+		return &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	if n == 0 {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO "+s.table+" (path, data, mode, mtime) VALUES ("+s.o.placeholder(1)+", "+s.o.placeholder(2)+", "+s.o.placeholder(3)+", "+s.o.placeholder(4)+")", name, data, int64(perm.Perm()), mtime); err != nil {
+			return &fs.PathError{Op: op, Path: name, Err: err}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return nil
+}
+
+func (s *FS) get(ctx context.Context, q queryer, name string) ([]byte, *fileInfo, error) {
+	var (
+		data  []byte
+		mode  int64
+		mtime int64
+	)
+	err := q.QueryRowContext(ctx, "SELECT data, mode, mtime FROM "+s.table+" WHERE path = "+s.o.placeholder(1), name).Scan(&data, &mode, &mtime)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, fs.ErrNotExist
+		}
+		return nil, nil, err
+	}
+	if data == nil {
+		data = []byte{}
+	}
+	return data, rowInfo(name, int64(len(data)), mode, mtime), nil
+}
+
+func (s *FS) stat(ctx context.Context, q queryer, name string) (*fileInfo, error) {
+	var size, mode, mtime int64
+	err := q.QueryRowContext(ctx, "SELECT COALESCE(LENGTH(data), 0), mode, mtime FROM "+s.table+" WHERE path = "+s.o.placeholder(1), name).Scan(&size, &mode, &mtime)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fs.ErrNotExist
+		}
+		return nil, err
+	}
+	return rowInfo(name, size, mode, mtime), nil
+}
+
+// hasFiles reports whether there is at least one file in the directory or in
+// any of its subdirectories.
+func (s *FS) hasFiles(ctx context.Context, q queryer, name string) (bool, error) {
+	query, args := s.descendantsQuery("path", name)
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	ok := rows.Next()
+	return ok, rows.Err()
+}
+
+// readDir returns sorted entries of the directory. Directories other than the
+// root exist only if there is at least one file in them.
+func (s *FS) readDir(ctx context.Context, name string) ([]fs.DirEntry, error) {
+	query, args := s.descendantsQuery("path, COALESCE(LENGTH(data), 0), mode, mtime", name)
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	prefix := ""
+	if name != "." {
+		prefix = name + "/"
+	}
+	entries := make([]fs.DirEntry, 0)
+	dirs := make(map[string]struct{})
+	for rows.Next() {
+		var (
+			p                 string
+			size, mode, mtime int64
+		)
+		if err := rows.Scan(&p, &size, &mode, &mtime); err != nil {
+			return nil, err
+		}
+		n := strings.TrimPrefix(p, prefix)
+		if i := strings.IndexByte(n, '/'); i >= 0 {
+			n = n[:i]
+			if _, ok := dirs[n]; !ok {
+				dirs[n] = struct{}{}
+				entries = append(entries, dirInfo(n))
+			}
+			continue
+		}
+		entries = append(entries, rowInfo(n, size, mode, mtime))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 && name != "." {
+		return nil, fs.ErrNotExist
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// descendantsQuery returns the query that selects columns of all files in the
+// directory and its subdirectories. Names in the directory are in the range
+// between the directory name followed by "/" and the directory name followed
+// by "0", which is the character after "/", so that the index on the path
+// column can be used.
+func (s *FS) descendantsQuery(columns, name string) (query string, args []interface{}) {
+	if name == "." {
+		return "SELECT " + columns + " FROM " + s.table + " ORDER BY path", nil
+	}
+	return "SELECT " + columns + " FROM " + s.table + " WHERE path > " + s.o.placeholder(1) + " AND path < " + s.o.placeholder(2) + " ORDER BY path", []interface{}{name + "/", name + "0"}
+}
+
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func rowInfo(name string, size, mode, mtime int64) *fileInfo {
+	return &fileInfo{
+		name:    path.Base(name),
+		size:    size,
+		mode:    fs.FileMode(mode).Perm(),
+		modTime: time.Unix(0, mtime),
+	}
+}
+
+func dirInfo(name string) *fileInfo {
+	return &fileInfo{
+		name: path.Base(name),
+		mode: fs.ModeDir | 0o755,
+	}
+}
+
+func (i *fileInfo) Name() string               { return i.name }
+func (i *fileInfo) Size() int64                { return i.size }
+func (i *fileInfo) Mode() fs.FileMode          { return i.mode }
+func (i *fileInfo) ModTime() time.Time         { return i.modTime }
+func (i *fileInfo) IsDir() bool                { return i.mode.IsDir() }
+func (i *fileInfo) Sys() interface{}           { return nil }
+func (i *fileInfo) Type() fs.FileMode          { return i.mode.Type() }
+func (i *fileInfo) Info() (fs.FileInfo, error) { return i, nil }
+
+type file struct {
+	*bytes.Reader
+	info *fileInfo
+}
+
+func (f *file) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *file) Close() error {
+	return nil
+}
+
+type dir struct {
+	info    *fileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: errIsDir}
+}
+
+func (d *dir) Close() error {
+	return nil
+}
+
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	entries := d.entries[d.offset:]
+	if n > 0 {
+		if len(entries) == 0 {
+			return nil, io.EOF
+		}
+		if n < len(entries) {
+			entries = entries[:n]
+		}
+	}
+	d.offset += len(entries)
+	return entries, nil
+}
+
+// writer buffers data written to a file created by the Create method.
+type writer struct {
+	fs     *FS
+	name   string
+	buf    bytes.Buffer
+	closed bool
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, &fs.PathError{Op: "write", Path: w.name, Err: errWriteClosed}
+	}
+	return w.buf.Write(p)
+}
+
+func (w *writer) Close() error {
+	if w.closed {
+		return &fs.PathError{Op: "close", Path: w.name, Err: fs.ErrClosed}
+	}
+	w.closed = true
+	return w.fs.write(context.Background(), "create", w.name, w.buf.Bytes(), 0o666)
+}
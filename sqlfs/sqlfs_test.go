@@ -0,0 +1,200 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo
+// +build cgo
+
+package sqlfs_test
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"resenje.org/fsutil/sqlfs"
+)
+
+func newTestFS(t *testing.T) *sqlfs.FS {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "files.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Exec(`CREATE TABLE files (
+		path  TEXT    NOT NULL PRIMARY KEY,
+		data  BLOB    NOT NULL,
+		mode  INTEGER NOT NULL,
+		mtime INTEGER NOT NULL
+	)`); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys, err := sqlfs.New(db, "files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fsys
+}
+
+func TestFS(t *testing.T) {
+	fsys := newTestFS(t)
+
+	for name, data := range map[string]string{
+		"index.html":      "<html>",
+		"css/app.css":     "body{}",
+		"js/lib/lib.js":   "lib()",
+		"js0/other.js":    "other()",
+		"js.old/index.js": "old()",
+		"empty.txt":       "",
+	} {
+		if err := fsys.WriteFile(name, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := fstest.TestFS(fsys, "index.html", "css/app.css", "js/lib/lib.js", "js0/other.js", "js.old/index.js", "empty.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("read dir", func(t *testing.T) {
+		entries, err := fsys.ReadDir("js")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(entryNames(entries)); got != "[lib]" {
+			t.Errorf("got entries %v", got)
+		}
+
+		entries, err = fsys.ReadDir(".")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := fmt.Sprint(entryNames(entries)), "[css empty.txt index.html js js.old js0]"; got != want {
+			t.Errorf("got entries %v, want %v", got, want)
+		}
+
+		if _, err := fsys.ReadDir("index.html"); err == nil {
+			t.Error("got no error reading a file as a directory")
+		}
+	})
+
+	t.Run("stat", func(t *testing.T) {
+		info, err := fsys.Stat("css/app.css")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() != 6 || info.Mode() != 0o644 || info.IsDir() {
+			t.Errorf("got size %v, mode %v", info.Size(), info.Mode())
+		}
+
+		info, err = fsys.Stat("js/lib")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.IsDir() {
+			t.Error("got no directory")
+		}
+
+		if _, err := fsys.Stat("js/missing"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("got error %v, want %v", err, fs.ErrNotExist)
+		}
+	})
+
+	t.Run("overwrite", func(t *testing.T) {
+		if err := fsys.WriteFile("index.html", []byte("<new>"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		data, err := fsys.ReadFile("index.html")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "<new>" {
+			t.Errorf("got %q, want %q", data, "<new>")
+		}
+		info, err := fsys.Stat("index.html")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode() != 0o644 {
+			t.Errorf("got mode %v, want %v", info.Mode(), fs.FileMode(0o644))
+		}
+	})
+
+	t.Run("conflicts", func(t *testing.T) {
+		if err := fsys.WriteFile("index.html/a.txt", nil, 0o644); err == nil {
+			t.Error("got no error writing under a file")
+		}
+		if err := fsys.WriteFile("js/lib", nil, 0o644); err == nil {
+			t.Error("got no error writing over a directory")
+		}
+		if err := fsys.WriteFile("../a.txt", nil, 0o644); !errors.Is(err, fs.ErrInvalid) {
+			t.Errorf("got error %v, want %v", err, fs.ErrInvalid)
+		}
+	})
+
+	t.Run("create", func(t *testing.T) {
+		w, err := fsys.Create("docs/readme.md")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(w, "# Readme"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fsys.Stat("docs/readme.md"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("got error %v before close, want %v", err, fs.ErrNotExist)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		data, err := fsys.ReadFile("docs/readme.md")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "# Readme" {
+			t.Errorf("got %q, want %q", data, "# Readme")
+		}
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		if err := fsys.Remove("js"); err == nil {
+			t.Error("got no error removing a directory that is not empty")
+		}
+		if err := fsys.Remove("js/lib/lib.js"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fsys.Stat("js"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("got error %v, want %v", err, fs.ErrNotExist)
+		}
+		if err := fsys.Remove("js/lib/lib.js"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("got error %v, want %v", err, fs.ErrNotExist)
+		}
+	})
+}
+
+func TestNew_invalidTable(t *testing.T) {
+	for _, table := range []string{"", "files; DROP TABLE files", "1files", "a.b.c"} {
+		if _, err := sqlfs.New(nil, table); err == nil {
+			t.Errorf("got no error for table %q", table)
+		}
+	}
+}
+
+func entryNames(entries []fs.DirEntry) []string {
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
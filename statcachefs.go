@@ -0,0 +1,223 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	_ fs.FS        = (*StatCacheFS)(nil)
+	_ fs.ReadDirFS = (*StatCacheFS)(nil)
+	_ fs.StatFS    = (*StatCacheFS)(nil)
+	_ fs.SubFS     = (*StatCacheFS)(nil)
+	_ ReadLinkFS   = (*StatCacheFS)(nil)
+)
+
+// StatCacheFS is a filesystem that caches results of Stat and ReadDir calls to
+// the underlying filesystem for the ttl duration. File contents are not
+// cached. It reduces the latency of http.FileServer, which calls Stat on every
+// request, on filesystems where file metadata is slow to retrieve. The Stat
+// method of opened files shares the cache with the Stat method of the
+// filesystem, as http.FileServer opens files and calls their Stat method. Only
+// successful results are cached. Expired results are removed from the cache
+// periodically as new results are cached.
+type StatCacheFS struct {
+	fsys fs.FS
+	ttl  time.Duration
+
+	stats     map[string]statCacheEntry
+	dirs      map[string]readDirCacheEntry
+	nextPurge time.Time // time to remove expired results
+	cacheMu   sync.Mutex
+}
+
+type statCacheEntry struct {
+	info    fs.FileInfo
+	expires time.Time
+}
+
+type readDirCacheEntry struct {
+	entries []fs.DirEntry
+	expires time.Time
+}
+
+// NewStatCacheFS returns a new instance of StatCacheFS.
+func NewStatCacheFS(fsys fs.FS, ttl time.Duration) *StatCacheFS {
+	return &StatCacheFS{
+		fsys:  fsys,
+		ttl:   ttl,
+		stats: make(map[string]statCacheEntry),
+		dirs:  make(map[string]readDirCacheEntry),
+	}
+}
+
+// Open implements fs.FS interface.
+func (s *StatCacheFS) Open(name string) (fs.File, error) {
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	file := &statCacheFile{
+		wrappedFile: wrappedFile{File: f, name: name},
+		statCacheFS: s,
+	}
+	if _, ok := f.(io.ReaderAt); ok {
+		return statCacheReaderAtFile{file}, nil
+	}
+	return file, nil
+}
+
+// ReadDir implements fs.ReadDirFS interface.
+func (s *StatCacheFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	now := time.Now()
+
+	s.cacheMu.Lock()
+	e, ok := s.dirs[name]
+	s.cacheMu.Unlock()
+	if ok && now.Before(e.expires) {
+		return append([]fs.DirEntry(nil), e.entries...), nil
+	}
+
+	entries, err := fs.ReadDir(s.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	s.cacheMu.Lock()
+	s.removeExpired(now)
+	s.dirs[name] = readDirCacheEntry{
+		entries: append([]fs.DirEntry(nil), entries...),
+		expires: now.Add(s.ttl),
+	}
+	s.cacheMu.Unlock()
+
+	return entries, nil
+}
+
+// Stat implements fs.StatFS interface.
+func (s *StatCacheFS) Stat(name string) (fs.FileInfo, error) {
+	return s.stat(name, func() (fs.FileInfo, error) {
+		return fs.Stat(s.fsys, name)
+	})
+}
+
+// stat returns the cached file info of the named file, or caches the result
+// of the stat function if there is none.
+func (s *StatCacheFS) stat(name string, stat func() (fs.FileInfo, error)) (fs.FileInfo, error) {
+	now := time.Now()
+
+	s.cacheMu.Lock()
+	e, ok := s.stats[name]
+	s.cacheMu.Unlock()
+	if ok && now.Before(e.expires) {
+		return e.info, nil
+	}
+
+	info, err := stat()
+	if err != nil {
+		return nil, err
+	}
+
+	s.cacheMu.Lock()
+	s.removeExpired(now)
+	s.stats[name] = statCacheEntry{
+		info:    info,
+		expires: now.Add(s.ttl),
+	}
+	s.cacheMu.Unlock()
+
+	return info, nil
+}
+
+// ReadLink implements ReadLinkFS interface.
+func (s *StatCacheFS) ReadLink(name string) (string, error) {
+	return ReadLink(s.fsys, name)
+}
+
+// Lstat implements ReadLinkFS interface. Its results are not cached.
+func (s *StatCacheFS) Lstat(name string) (fs.FileInfo, error) {
+	return Lstat(s.fsys, name)
+}
+
+// Sub implements fs.SubFS interface.
+func (s *StatCacheFS) Sub(dir string) (fs.FS, error) {
+	return newSubFS(s, dir)
+}
+
+// Unwrap returns the underlying filesystem.
+func (s *StatCacheFS) Unwrap() fs.FS {
+	return s.fsys
+}
+
+// Invalidate removes cached results for the named file or directory.
+func (s *StatCacheFS) Invalidate(name string) {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+
+	delete(s.stats, name)
+	delete(s.dirs, name)
+}
+
+// Purge removes all cached results, including the expired ones.
+func (s *StatCacheFS) Purge() {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+
+	s.stats = make(map[string]statCacheEntry)
+	s.dirs = make(map[string]readDirCacheEntry)
+}
+
+// removeExpired removes expired results from the cache at most once in the
+// ttl duration, so that the cache does not grow with results of files that
+// are not accessed anymore. It must be called with cacheMu locked.
+func (s *StatCacheFS) removeExpired(now time.Time) {
+	if now.Before(s.nextPurge) {
+		return
+	}
+	s.nextPurge = now.Add(s.ttl)
+
+	for name, e := range s.stats {
+		if !now.Before(e.expires) {
+			delete(s.stats, name)
+		}
+	}
+	for name, e := range s.dirs {
+		if !now.Before(e.expires) {
+			delete(s.dirs, name)
+		}
+	}
+}
+
+type statCacheFile struct {
+	wrappedFile
+	statCacheFS *StatCacheFS
+}
+
+// Stat returns the cached file info, or caches the result of the Stat method
+// of the underlying file.
+func (f *statCacheFile) Stat() (fs.FileInfo, error) {
+	return f.statCacheFS.stat(f.name, f.File.Stat)
+}
+
+// RawFile returns the underlying *os.File, if there is one.
+func (f *statCacheFile) RawFile() *os.File {
+	return RawFile(f.File)
+}
+
+// statCacheReaderAtFile is a statCacheFile of an underlying file that
+// implements io.ReaderAt.
+type statCacheReaderAtFile struct {
+	*statCacheFile
+}
+
+func (f statCacheReaderAtFile) ReadAt(p []byte, off int64) (int, error) {
+	return f.File.(io.ReaderAt).ReadAt(p, off)
+}
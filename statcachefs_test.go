@@ -0,0 +1,173 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestStatCacheFS(t *testing.T) {
+	files := fsutil.MapFS{
+		"a.txt":     {Data: []byte("a")},
+		"dir/b.txt": {Data: []byte("b")},
+	}
+	var opens int
+	backend := fsutil.FSFunc(func(name string) (fs.File, error) {
+		opens++
+		return files.Open(name)
+	})
+
+	fsys := fsutil.NewStatCacheFS(backend, time.Hour)
+
+	if err := fstest.TestFS(fsys, "a.txt", "dir/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	fsys.Purge()
+
+	t.Run("stat", func(t *testing.T) {
+		opens = 0
+
+		for i := 0; i < 3; i++ {
+			info, err := fsys.Stat("a.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Size() != 1 {
+				t.Errorf("got size %v, want %v", info.Size(), 1)
+			}
+		}
+		if opens != 1 {
+			t.Errorf("got %v opens, want %v", opens, 1)
+		}
+
+		files["a.txt"] = &fsutil.MapFile{Data: []byte("aaa")}
+		fsys.Invalidate("a.txt")
+
+		info, err := fsys.Stat("a.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() != 3 {
+			t.Errorf("got size %v, want %v", info.Size(), 3)
+		}
+		if opens != 2 {
+			t.Errorf("got %v opens, want %v", opens, 2)
+		}
+	})
+
+	t.Run("open", func(t *testing.T) {
+		fsys.Purge()
+		opens = 0
+
+		f, err := fsys.Open("dir/b.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		info, err := f.Stat()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() != 1 {
+			t.Errorf("got size %v, want %v", info.Size(), 1)
+		}
+
+		files["dir/b.txt"] = &fsutil.MapFile{Data: []byte("bbb")}
+		defer func() {
+			files["dir/b.txt"] = &fsutil.MapFile{Data: []byte("b")}
+			fsys.Purge()
+		}()
+
+		// Stat of the filesystem uses the result cached by the file.
+		info, err = fsys.Stat("dir/b.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() != 1 {
+			t.Errorf("got size %v, want %v", info.Size(), 1)
+		}
+		if opens != 1 {
+			t.Errorf("got %v opens, want %v", opens, 1)
+		}
+
+		// Stat of a newly opened file uses the cached result.
+		f2, err := fsys.Open("dir/b.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f2.Close()
+
+		info, err = f2.Stat()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() != 1 {
+			t.Errorf("got size %v, want %v", info.Size(), 1)
+		}
+	})
+
+	t.Run("read dir", func(t *testing.T) {
+		opens = 0
+
+		for i := 0; i < 3; i++ {
+			entries, err := fsys.ReadDir("dir")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 || entries[0].Name() != "b.txt" {
+				t.Fatalf("got entries %v, want [b.txt]", entries)
+			}
+			entries[0] = nil // must not modify the cached result
+		}
+		if opens != 1 {
+			t.Errorf("got %v opens, want %v", opens, 1)
+		}
+	})
+
+	t.Run("not exist", func(t *testing.T) {
+		testStatNotExist(t, fsys, "missing.txt")
+		testReadDirNotExist(t, fsys, "missing")
+	})
+
+	t.Run("expiration", func(t *testing.T) {
+		fsys := fsutil.NewStatCacheFS(backend, time.Nanosecond)
+		opens = 0
+
+		for i := 0; i < 2; i++ {
+			if _, err := fsys.Stat("a.txt"); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(time.Millisecond)
+		}
+		if opens != 2 {
+			t.Errorf("got %v opens, want %v", opens, 2)
+		}
+	})
+
+	t.Run("remove expired", func(t *testing.T) {
+		fsys := fsutil.NewStatCacheFS(backend, time.Millisecond)
+
+		if _, err := fsys.Stat("a.txt"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fsys.ReadDir("dir"); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(2 * time.Millisecond)
+		if _, err := fsys.Stat("dir/b.txt"); err != nil {
+			t.Fatal(err)
+		}
+		if got := fsys.CacheLen(); got != 1 {
+			t.Errorf("got %v cached results, want %v", got, 1)
+		}
+	})
+}
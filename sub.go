@@ -0,0 +1,157 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+)
+
+var (
+	_ fs.FS         = (*subFS)(nil)
+	_ fs.GlobFS     = (*subFS)(nil)
+	_ fs.ReadDirFS  = (*subFS)(nil)
+	_ fs.ReadFileFS = (*subFS)(nil)
+	_ fs.StatFS     = (*subFS)(nil)
+	_ fs.SubFS      = (*subFS)(nil)
+	_ ReadLinkFS    = (*subFS)(nil)
+)
+
+// newSubFS returns a filesystem corresponding to the subtree rooted at the
+// directory of fsys. Unlike the one returned by fs.Sub, it implements all
+// optional interfaces by calling the functions from the io/fs package on
+// fsys, so that wrappers that implement fs.SubFS with it preserve their
+// behavior, including any shared state, for the subtree.
+func newSubFS(fsys fs.FS, dir string) (fs.FS, error) {
+	if !fs.ValidPath(dir) {
+		return nil, &fs.PathError{Op: "sub", Path: dir, Err: fs.ErrInvalid}
+	}
+	if dir == "." {
+		return fsys, nil
+	}
+	return &subFS{fsys: fsys, dir: dir}, nil
+}
+
+type subFS struct {
+	fsys fs.FS
+	dir  string
+}
+
+// fullName maps name to the fully-qualified name dir/name.
+func (s *subFS) fullName(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return path.Join(s.dir, name), nil
+}
+
+// shorten maps name, which should start with dir, back to the suffix after
+// dir.
+func (s *subFS) shorten(name string) (rel string, ok bool) {
+	if name == s.dir {
+		return ".", true
+	}
+	if len(name) >= len(s.dir)+2 && name[len(s.dir)] == '/' && name[:len(s.dir)] == s.dir {
+		return name[len(s.dir)+1:], true
+	}
+	return "", false
+}
+
+// fixErr shortens any reported names in fs.PathError.
+func (s *subFS) fixErr(err error) error {
+	var e *fs.PathError
+	if errors.As(err, &e) {
+		if short, ok := s.shorten(e.Path); ok {
+			e.Path = short
+		}
+	}
+	return err
+}
+
+func (s *subFS) Open(name string) (fs.File, error) {
+	full, err := s.fullName("open", name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := s.fsys.Open(full)
+	return f, s.fixErr(err)
+}
+
+func (s *subFS) Glob(pattern string) ([]string, error) {
+	// Check pattern is well-formed.
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	if pattern == "." {
+		return []string{"."}, nil
+	}
+	list, err := fs.Glob(s.fsys, s.dir+"/"+pattern)
+	for i, name := range list {
+		rel, ok := s.shorten(name)
+		if !ok {
+			return nil, errors.New("invalid result from inner fsys Glob: " + name + " not in " + s.dir)
+		}
+		list[i] = rel
+	}
+	return list, s.fixErr(err)
+}
+
+func (s *subFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	full, err := s.fullName("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := fs.ReadDir(s.fsys, full)
+	return entries, s.fixErr(err)
+}
+
+func (s *subFS) ReadFile(name string) ([]byte, error) {
+	full, err := s.fullName("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := fs.ReadFile(s.fsys, full)
+	return data, s.fixErr(err)
+}
+
+func (s *subFS) Stat(name string) (fs.FileInfo, error) {
+	full, err := s.fullName("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := fs.Stat(s.fsys, full)
+	return info, s.fixErr(err)
+}
+
+func (s *subFS) ReadLink(name string) (string, error) {
+	full, err := s.fullName("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	target, err := ReadLink(s.fsys, full)
+	return target, s.fixErr(err)
+}
+
+func (s *subFS) Lstat(name string) (fs.FileInfo, error) {
+	full, err := s.fullName("lstat", name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := Lstat(s.fsys, full)
+	return info, s.fixErr(err)
+}
+
+func (s *subFS) Sub(dir string) (fs.FS, error) {
+	if dir == "." {
+		return s, nil
+	}
+	full, err := s.fullName("sub", dir)
+	if err != nil {
+		return nil, err
+	}
+	return &subFS{fsys: s.fsys, dir: full}, nil
+}
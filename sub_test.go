@@ -0,0 +1,129 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"resenje.org/fsutil"
+)
+
+func TestSub(t *testing.T) {
+	files := fsutil.MapFS{
+		"index.html":          {Data: []byte("<html>")},
+		"assets/app.css":      {Data: []byte("body{}")},
+		"assets/js/app.js":    {Data: []byte("app()")},
+		"assets/js/vendor.js": {Data: []byte("vendor()")},
+	}
+
+	t.Run("hash", func(t *testing.T) {
+		sub, err := fs.Sub(fsutil.NewHashFS(files, fsutil.NewMD5Hasher(8)), "assets")
+		if err != nil {
+			t.Fatal(err)
+		}
+		hfs, ok := sub.(*fsutil.HashFS)
+		if !ok {
+			t.Fatalf("got %T, want %T", sub, hfs)
+		}
+		hashedPath, err := hfs.HashedPath("js/app.js")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(hashedPath, "js/app.") || hashedPath == "js/app.js" {
+			t.Errorf("got hashed path %q", hashedPath)
+		}
+		testOpen(t, hfs, hashedPath, "app()")
+	})
+
+	t.Run("hash shared cache", func(t *testing.T) {
+		hasher := &countingHasher{Hasher: fsutil.NewMD5Hasher(8)}
+		parent := fsutil.NewHashFS(files, hasher)
+		sub, err := fs.Sub(parent, "assets")
+		if err != nil {
+			t.Fatal(err)
+		}
+		hfs := sub.(*fsutil.HashFS)
+
+		subPath, err := hfs.HashedPath("js/app.js")
+		if err != nil {
+			t.Fatal(err)
+		}
+		parentPath, err := parent.HashedPath("assets/js/app.js")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parentPath != "assets/"+subPath {
+			t.Errorf("got hashed path %q, want %q", parentPath, "assets/"+subPath)
+		}
+		if got := hasher.count(); got != 1 {
+			t.Errorf("got %v hashed files, want %v", got, 1)
+		}
+		if got := parent.CacheStats().Hits; got != 1 {
+			t.Errorf("got %v cache hits, want %v", got, 1)
+		}
+
+		if err := hfs.Invalidate("js/app.js"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := parent.HashedPath("assets/js/app.js"); err != nil {
+			t.Fatal(err)
+		}
+		if got := hasher.count(); got != 2 {
+			t.Errorf("got %v hashed files, want %v", got, 2)
+		}
+	})
+
+	t.Run("counting", func(t *testing.T) {
+		cfs := fsutil.NewCountingFS(files)
+		sub, err := fs.Sub(cfs, "assets")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := sub.(interface {
+			fs.GlobFS
+			fs.ReadDirFS
+			fs.ReadFileFS
+			fs.StatFS
+			fs.SubFS
+		}); !ok {
+			t.Fatalf("sub filesystem %T does not implement all interfaces", sub)
+		}
+		if err := fstest.TestFS(sub, "app.css", "js/app.js", "js/vendor.js"); err != nil {
+			t.Fatal(err)
+		}
+		cfs.Reset()
+
+		testReadFile(t, sub.(fs.ReadFileFS), "js/app.js", "app()")
+		testGlob(t, sub.(fs.GlobFS), "js/*.js", []string{"js/app.js", "js/vendor.js"})
+
+		if got := cfs.Counts()["assets/js/app.js"].Opens; got != 1 {
+			t.Errorf("got %v opens in the parent filesystem, want %v", got, 1)
+		}
+
+		_, err = fs.Stat(sub, "js/missing.js")
+		var pathErr *fs.PathError
+		if !errors.As(err, &pathErr) {
+			t.Fatalf("got error %v, want %T", err, pathErr)
+		}
+		if pathErr.Path != "js/missing.js" {
+			t.Errorf("got error path %q, want %q", pathErr.Path, "js/missing.js")
+		}
+
+		subsub, err := fs.Sub(sub, "js")
+		if err != nil {
+			t.Fatal(err)
+		}
+		testReadFile(t, subsub.(fs.ReadFileFS), "vendor.js", "vendor()")
+
+		if _, err := fs.Sub(cfs, "../assets"); !errors.Is(err, fs.ErrInvalid) {
+			t.Errorf("got error %v, want %v", err, fs.ErrInvalid)
+		}
+	})
+}
@@ -0,0 +1,319 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	_ fs.FS         = (*TarFS)(nil)
+	_ fs.GlobFS     = (*TarFS)(nil)
+	_ fs.ReadDirFS  = (*TarFS)(nil)
+	_ fs.ReadFileFS = (*TarFS)(nil)
+	_ fs.StatFS     = (*TarFS)(nil)
+	_ io.Closer     = (*TarFS)(nil)
+)
+
+// TarFS is a read-only filesystem with files from a tar archive. Only regular
+// files and directories are included, other entries, such as links, and
+// entries with names that are not valid fs.FS paths are ignored. If the archive
+// contains multiple entries with the same name, the last one is used. Parent
+// directories of files that are not explicitly present in the archive are
+// included with 0o555 permissions and a zero modification time.
+type TarFS struct {
+	fsys   fs.FS
+	tmpDir string
+}
+
+// NewTarFS reads an uncompressed tar archive from r, which has the size in
+// bytes, in a single pass to index offsets of all files. Files are read
+// directly from r when they are opened and they implement io.Seeker and
+// io.ReaderAt.
+func NewTarFS(r io.ReaderAt, size int64) (*TarFS, error) {
+	sr := io.NewSectionReader(r, 0, size)
+	index := newArchiveIndex()
+	offsets := make(map[string]int64)
+	err := readTar(sr, func(name string, h *tar.Header, tr *tar.Reader) error {
+		offset, err := sr.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		offsets[name] = offset
+		return nil
+	}, index)
+	if err != nil {
+		return nil, err
+	}
+	return &TarFS{
+		fsys: &tarIndexFS{
+			index:   index,
+			r:       r,
+			offsets: offsets,
+		},
+	}, nil
+}
+
+// TarGzFSOption is used to provide optional parameters to NewTarGzFS function.
+type TarGzFSOption func(*tarGzFSOptions)
+
+type tarGzFSOptions struct {
+	tmpDir     bool
+	tmpDirRoot string
+}
+
+// WithTarTempDir extracts files to a new temporary directory under the dir,
+// instead of to memory. If dir is the empty string, the default directory for
+// temporary files is used. The directory is removed by the Close method.
+func WithTarTempDir(dir string) TarGzFSOption {
+	return func(o *tarGzFSOptions) {
+		o.tmpDir = true
+		o.tmpDirRoot = dir
+	}
+}
+
+// NewTarGzFS reads a gzip compressed tar archive from r and extracts all files
+// to memory, as the compressed archive does not allow random access. The
+// WithTarTempDir option extracts files to a temporary directory, which is
+// suitable for larger archives.
+func NewTarGzFS(r io.Reader, opts ...TarGzFSOption) (*TarFS, error) {
+	var o tarGzFSOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	if o.tmpDir {
+		return extractTar(zr, o.tmpDirRoot)
+	}
+
+	index := newArchiveIndex()
+	data := make(map[string][]byte)
+	err = readTar(zr, func(name string, h *tar.Header, tr *tar.Reader) error {
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		data[name] = b
+		return nil
+	}, index)
+	if err != nil {
+		return nil, err
+	}
+	return &TarFS{
+		fsys: &tarIndexFS{
+			index: index,
+			data:  data,
+		},
+	}, nil
+}
+
+// extractTar writes regular files and directories from the tar archive to a
+// new temporary directory.
+func extractTar(r io.Reader, dir string) (s *TarFS, err error) {
+	tmpDir, err := os.MkdirTemp(dir, "fsutil-tar-")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.RemoveAll(tmpDir)
+		}
+	}()
+
+	index := newArchiveIndex()
+	err = readTar(r, func(name string, h *tar.Header, tr *tar.Reader) error {
+		p := filepath.Join(tmpDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, h.FileInfo().Mode().Perm()|0o600)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, tr); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		return os.Chtimes(p, h.ModTime, h.ModTime)
+	}, index)
+	if err != nil {
+		return nil, err
+	}
+	// Directory modification times are set after all files are written, as
+	// writing to a directory changes it.
+	for name, d := range index.dirs {
+		if name == "." {
+			continue
+		}
+		p := filepath.Join(tmpDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(p, 0o755); err != nil {
+			return nil, err
+		}
+		if modTime := d.info.modTime; !modTime.IsZero() {
+			if err := os.Chtimes(p, modTime, modTime); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &TarFS{
+		fsys:   os.DirFS(tmpDir),
+		tmpDir: tmpDir,
+	}, nil
+}
+
+// readTar adds all regular files and directories from the tar archive to the
+// index and calls the file function for every regular file while the tar
+// reader is positioned at its content.
+func readTar(r io.Reader, file func(name string, h *tar.Header, tr *tar.Reader) error, index *archiveIndex) error {
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if h.Typeflag != tar.TypeReg && h.Typeflag != tar.TypeRegA && h.Typeflag != tar.TypeDir {
+			continue
+		}
+		if isSparseTarHeader(h) {
+			continue
+		}
+		name := path.Clean(h.Name)
+		if !fs.ValidPath(name) || name == "." {
+			continue
+		}
+		info := h.FileInfo()
+		mode := info.Mode()
+		if h.Typeflag == tar.TypeDir {
+			mode |= fs.ModeDir
+		}
+		index.add(name, &memFileInfo{
+			name:    path.Base(name),
+			size:    info.Size(),
+			mode:    mode,
+			modTime: info.ModTime(),
+			sys:     h,
+		})
+		if mode.IsDir() {
+			continue
+		}
+		if err := file(name, h, tr); err != nil {
+			return fmt.Errorf("tar file %s: %w", name, err)
+		}
+	}
+	index.finish()
+	return nil
+}
+
+// isSparseTarHeader reports whether the file content is stored as a sparse
+// file, which can not be read directly from the archive.
+func isSparseTarHeader(h *tar.Header) bool {
+	for k := range h.PAXRecords {
+		if strings.HasPrefix(k, "GNU.sparse.") {
+			return true
+		}
+	}
+	return false
+}
+
+// Open implements fs.FS interface.
+func (s *TarFS) Open(name string) (fs.File, error) {
+	return s.fsys.Open(name)
+}
+
+// Glob implements fs.GlobFS interface.
+func (s *TarFS) Glob(pattern string) ([]string, error) {
+	return fs.Glob(s.fsys, pattern)
+}
+
+// ReadDir implements fs.ReadDirFS interface.
+func (s *TarFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(s.fsys, name)
+}
+
+// ReadFile implements fs.ReadFileFS interface.
+func (s *TarFS) ReadFile(name string) ([]byte, error) {
+	return fs.ReadFile(s.fsys, name)
+}
+
+// Stat implements fs.StatFS interface.
+func (s *TarFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(s.fsys, name)
+}
+
+// Close removes the temporary directory with extracted files if the
+// filesystem is constructed with the WithTarTempDir option.
+func (s *TarFS) Close() error {
+	if s.tmpDir == "" {
+		return nil
+	}
+	return os.RemoveAll(s.tmpDir)
+}
+
+// tarIndexFS is a filesystem with files from the index of a tar archive with
+// content either read from an uncompressed archive at offsets or stored in
+// memory.
+type tarIndexFS struct {
+	index   *archiveIndex
+	r       io.ReaderAt
+	offsets map[string]int64
+	data    map[string][]byte
+}
+
+func (s *tarIndexFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if d, ok := s.index.dirs[name]; ok {
+		return newMemDir(name, d.info, d.entries), nil
+	}
+	info, ok := s.index.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if s.data != nil {
+		return newMemFile(name, info, s.data[name]), nil
+	}
+	return &sectionFile{
+		SectionReader: io.NewSectionReader(s.r, s.offsets[name], info.size),
+		info:          info,
+	}, nil
+}
+
+func (s *tarIndexFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	return s.index.readDir(name)
+}
+
+func (s *tarIndexFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	return s.index.stat(name)
+}
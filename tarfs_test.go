@@ -0,0 +1,163 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestTarFS(t *testing.T) {
+	modTime := time.Date(2021, 6, 7, 8, 9, 10, 0, time.UTC)
+	data := newTar(t, modTime)
+
+	var gzData bytes.Buffer
+	zw := gzip.NewWriter(&gzData)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpDir := t.TempDir()
+
+	for _, tc := range []struct {
+		name  string
+		newFS func() (*fsutil.TarFS, error)
+	}{
+		{
+			name: "tar",
+			newFS: func() (*fsutil.TarFS, error) {
+				return fsutil.NewTarFS(bytes.NewReader(data), int64(len(data)))
+			},
+		},
+		{
+			name: "tar.gz memory",
+			newFS: func() (*fsutil.TarFS, error) {
+				return fsutil.NewTarGzFS(bytes.NewReader(gzData.Bytes()))
+			},
+		},
+		{
+			name: "tar.gz temp dir",
+			newFS: func() (*fsutil.TarFS, error) {
+				return fsutil.NewTarGzFS(bytes.NewReader(gzData.Bytes()), fsutil.WithTarTempDir(tmpDir))
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fsys, err := tc.newFS()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer fsys.Close()
+
+			if err := fstest.TestFS(fsys, "index.html", "assets/main.css", "assets/img/logo.svg"); err != nil {
+				t.Fatal(err)
+			}
+
+			testOpen(t, fsys, "index.html", "<html> updated")
+			testOpen(t, fsys, "assets/main.css", "body{}")
+			testOpenNotExist(t, fsys, "link.html")
+			testOpenNotExist(t, fsys, "evil.txt")
+			testReadFile(t, fsys, "assets/img/logo.svg", "<svg></svg>")
+			testReadFileNotExist(t, fsys, "missing.html")
+			testGlob(t, fsys, "*/*.css", []string{"assets/main.css"})
+
+			info, err := fsys.Stat("assets/main.css")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !info.ModTime().Equal(modTime) {
+				t.Errorf("got mod time %v, want %v", info.ModTime(), modTime)
+			}
+			if info.Size() != 6 {
+				t.Errorf("got size %v, want %v", info.Size(), 6)
+			}
+
+			f, err := fsys.Open("assets/main.css")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			s, ok := f.(io.ReadSeeker)
+			if !ok {
+				t.Fatal("file does not implement io.Seeker")
+			}
+			if _, err := s.Seek(4, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+			rest, err := io.ReadAll(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := string(rest), "{}"; got != want {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+	}
+
+	t.Run("close removes temp dir", func(t *testing.T) {
+		dir := t.TempDir()
+		fsys, err := fsutil.NewTarGzFS(bytes.NewReader(gzData.Bytes()), fsutil.WithTarTempDir(dir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := fsys.Close(); err != nil {
+			t.Fatal(err)
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 0 {
+			t.Errorf("got %v entries in temp dir after close, want none", len(entries))
+		}
+	})
+}
+
+func newTar(t *testing.T, modTime time.Time) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, h := range []struct {
+		tar.Header
+		content string
+	}{
+		{Header: tar.Header{Name: "index.html", Mode: 0o644}, content: "<html>"},
+		{Header: tar.Header{Name: "assets/", Typeflag: tar.TypeDir, Mode: 0o750}},
+		{Header: tar.Header{Name: "./assets/main.css", Mode: 0o644}, content: "body{}"},
+		{Header: tar.Header{Name: "assets/img/logo.svg", Mode: 0o644}, content: "<svg></svg>"},
+		{Header: tar.Header{Name: "link.html", Typeflag: tar.TypeSymlink, Linkname: "index.html"}},
+		{Header: tar.Header{Name: "../evil.txt", Mode: 0o644}, content: "evil"},
+		{Header: tar.Header{Name: "index.html", Mode: 0o644}, content: "<html> updated"},
+	} {
+		h.ModTime = modTime
+		if h.Typeflag == 0 {
+			h.Typeflag = tar.TypeReg
+		}
+		h.Size = int64(len(h.content))
+		if err := tw.WriteHeader(&h.Header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(tw, h.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,179 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+)
+
+var (
+	_ fs.File   = (*TeeHashFile)(nil)
+	_ io.Seeker = (*TeeHashFile)(nil)
+)
+
+// ErrHashIncomplete is returned by the Hash method of TeeHashFile if the file
+// is not read sequentially until its end.
+var ErrHashIncomplete = errors.New("hash incomplete")
+
+// TeeHashFile is a file that computes the hash of its content while it is
+// read, for example while it is served by http.ServeContent, so that the hash
+// can be sent in a response trailer or stored with the HashFS AddHash method
+// without reading the file again.
+type TeeHashFile struct {
+	fs.File
+	hasher Hasher
+	info   fs.FileInfo
+
+	offset   int64 // number of bytes passed to the hasher
+	pos      int64 // offset of the file
+	pw       *io.PipeWriter
+	done     chan struct{}
+	hash     string
+	err      error // error of the hasher or of reading the file
+	finished bool  // set when the hash is computed or when hashing failed
+}
+
+// TeeHashReader returns a file that reads from the file f and passes all read
+// data to the hasher h. The hash is available with the Hash method after the
+// file is read until its end or until the number of bytes of its size is read,
+// and immediately for empty regular files. If the hasher is a FileInfoHasher,
+// it is provided with the file info of f. Seeking is allowed, as long as the
+// data is read sequentially from the beginning, which is the case when
+// http.ServeContent determines the size of the file, otherwise the hash becomes
+// unavailable.
+func TeeHashReader(f fs.File, h Hasher) *TeeHashFile {
+	t := &TeeHashFile{
+		File:   f,
+		hasher: h,
+	}
+	info, err := f.Stat()
+	if err != nil {
+		t.fail(err)
+		return t
+	}
+	t.info = info
+	if info.Mode().IsRegular() && info.Size() == 0 {
+		// Readers such as http.ServeContent do not read empty files.
+		t.start()
+		t.finish(nil)
+	}
+	return t
+}
+
+// Read implements fs.File interface.
+func (t *TeeHashFile) Read(p []byte) (int, error) {
+	n, err := t.File.Read(p)
+	if !t.finished {
+		if t.pos != t.offset {
+			t.fail(ErrHashIncomplete)
+		} else {
+			t.write(p[:n], err)
+		}
+	}
+	t.pos += int64(n)
+	return n, err
+}
+
+// Seek implements io.Seeker interface if the file implements it.
+func (t *TeeHashFile) Seek(offset int64, whence int) (int64, error) {
+	s, ok := t.File.(io.Seeker)
+	if !ok {
+		return 0, ErrNotSeekable
+	}
+	n, err := s.Seek(offset, whence)
+	if err != nil {
+		return n, err
+	}
+	t.pos = n
+	return n, nil
+}
+
+// Close closes the file and stops the hashing, if it is not finished.
+func (t *TeeHashFile) Close() error {
+	t.fail(ErrHashIncomplete)
+	return t.File.Close()
+}
+
+// Hash returns the hash of the file content. It returns ErrHashIncomplete if
+// the file is not read sequentially until its end, or the error returned by
+// the hasher or by reading the file.
+func (t *TeeHashFile) Hash() (string, error) {
+	if !t.finished {
+		return "", ErrHashIncomplete
+	}
+	if t.err != nil {
+		return "", t.err
+	}
+	return t.hash, nil
+}
+
+// write passes the data to the hashing goroutine, starting it if needed, and
+// finishes hashing at the end of the file or on a read error.
+func (t *TeeHashFile) write(p []byte, readErr error) {
+	if t.pw == nil {
+		t.start()
+	}
+	if len(p) > 0 {
+		if _, err := t.pw.Write(p); err != nil {
+			// The hashing goroutine returned with an error.
+			t.finish(err)
+			return
+		}
+		t.offset += int64(len(p))
+	}
+	switch {
+	case errors.Is(readErr, io.EOF), readErr == nil && t.offset == t.info.Size():
+		// Readers such as http.ServeContent read only the size of the file,
+		// without reaching the end of file.
+		t.finish(nil)
+	case readErr != nil:
+		t.finish(readErr)
+	}
+}
+
+// start starts the hashing goroutine that reads the data written to the pipe.
+func (t *TeeHashFile) start() {
+	pr, pw := io.Pipe()
+	t.pw = pw
+	t.done = make(chan struct{})
+	go func() {
+		defer close(t.done)
+
+		hash, err := hashFileContent(t.hasher, pr, t.info)
+		if err == nil {
+			// Hashers may not read all data, as SamplingHasher does.
+			_, err = io.Copy(io.Discard, pr)
+		}
+		pr.CloseWithError(err)
+		t.hash, t.err = hash, err
+	}()
+}
+
+// finish closes the pipe with the error, where a nil error marks the end of
+// data, and waits for the hashing goroutine to return.
+func (t *TeeHashFile) finish(err error) {
+	t.pw.CloseWithError(err)
+	<-t.done
+	if err != nil {
+		t.hash, t.err = "", err
+	}
+	t.finished = true
+}
+
+// fail finishes hashing with the error, if it is not finished.
+func (t *TeeHashFile) fail(err error) {
+	if t.finished {
+		return
+	}
+	if t.pw != nil {
+		t.finish(err)
+		return
+	}
+	t.err = err
+	t.finished = true
+}
@@ -0,0 +1,207 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestTeeHashReader(t *testing.T) {
+	content := strings.Repeat("tee hash reader ", 1000)
+	files := fstest.MapFS{
+		"data.txt":  {Data: []byte(content), ModTime: time.Date(2021, 8, 9, 10, 0, 0, 0, time.UTC)},
+		"empty.txt": {},
+	}
+
+	for _, tc := range []struct {
+		name   string
+		file   string
+		hasher fsutil.Hasher
+	}{
+		{name: "md5", file: "data.txt", hasher: fsutil.NewMD5Hasher(16)},
+		{name: "sampling", file: "data.txt", hasher: fsutil.NewSamplingHasher(16, 100)},
+		{name: "empty", file: "empty.txt", hasher: fsutil.NewSHA256Hasher(16)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			want := hashFromFS(t, files, tc.file, tc.hasher)
+
+			f, err := files.Open(tc.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tee := fsutil.TeeHashReader(f, tc.hasher)
+			defer tee.Close()
+
+			if len(files[tc.file].Data) > 0 {
+				if _, err := tee.Hash(); !errors.Is(err, fsutil.ErrHashIncomplete) {
+					t.Errorf("got error %v, want %v", err, fsutil.ErrHashIncomplete)
+				}
+			}
+
+			data, err := io.ReadAll(tee)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != string(files[tc.file].Data) {
+				t.Errorf("got %v bytes, want %v", len(data), len(files[tc.file].Data))
+			}
+
+			got, err := tee.Hash()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Errorf("got hash %q, want %q", got, want)
+			}
+		})
+	}
+
+	t.Run("serve content", func(t *testing.T) {
+		hasher := fsutil.NewMD5Hasher(16)
+		want := hashFromFS(t, files, "data.txt", hasher)
+
+		for _, tc := range []struct {
+			name    string
+			rng     string
+			wantErr error
+		}{
+			{name: "full"},
+			{name: "range", rng: "bytes=10-", wantErr: fsutil.ErrHashIncomplete},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				f, err := files.Open("data.txt")
+				if err != nil {
+					t.Fatal(err)
+				}
+				tee := fsutil.TeeHashReader(f, hasher)
+				defer tee.Close()
+
+				r := httptest.NewRequest(http.MethodGet, "/data.txt", nil)
+				if tc.rng != "" {
+					r.Header.Set("Range", tc.rng)
+				}
+				w := httptest.NewRecorder()
+				http.ServeContent(w, r, "data.txt", time.Time{}, tee)
+
+				got, err := tee.Hash()
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("got error %v, want %v", err, tc.wantErr)
+				}
+				if tc.wantErr == nil && got != want {
+					t.Errorf("got hash %q, want %q", got, want)
+				}
+			})
+		}
+	})
+
+	t.Run("serve empty content", func(t *testing.T) {
+		hasher := fsutil.NewMD5Hasher(16)
+		want := hashFromFS(t, files, "empty.txt", hasher)
+
+		f, err := files.Open("empty.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tee := fsutil.TeeHashReader(f, hasher)
+		defer tee.Close()
+
+		r := httptest.NewRequest(http.MethodGet, "/empty.txt", nil)
+		w := httptest.NewRecorder()
+		http.ServeContent(w, r, "empty.txt", time.Time{}, tee)
+
+		got, err := tee.Hash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("got hash %q, want %q", got, want)
+		}
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		f, err := files.Open("data.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tee := fsutil.TeeHashReader(f, fsutil.NewMD5Hasher(16))
+		if _, err := io.ReadFull(tee, make([]byte, 10)); err != nil {
+			t.Fatal(err)
+		}
+		if err := tee.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tee.Hash(); !errors.Is(err, fsutil.ErrHashIncomplete) {
+			t.Errorf("got error %v, want %v", err, fsutil.ErrHashIncomplete)
+		}
+	})
+}
+
+func TestHashFS_AddHash(t *testing.T) {
+	files := fstest.MapFS{
+		"data.txt": {Data: []byte("data")},
+	}
+	var opens int
+	hasher := fsutil.NewMD5Hasher(8)
+	fsys := fsutil.NewHashFS(fsutil.FSFunc(func(name string) (fs.File, error) {
+		opens++
+		return files.Open(name)
+	}), hasher)
+
+	f, err := files.Open("data.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tee := fsutil.TeeHashReader(f, hasher)
+	if _, err := io.Copy(io.Discard, tee); err != nil {
+		t.Fatal(err)
+	}
+	tee.Close()
+	hash, err := tee.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fsys.AddHash("data.txt", hash, info); err != nil {
+		t.Fatal(err)
+	}
+	testHashedPath(t, fsys, "data.txt", "data."+hash+".txt")
+	if opens != 0 {
+		t.Errorf("got %v opens of the underlying filesystem, want none", opens)
+	}
+
+	if err := fsys.AddHash("data.txt", "not a hash", info); err == nil {
+		t.Error("expected error for invalid hash")
+	}
+}
+
+// hashFromFS returns the hash of the named file computed by HashFS.
+func hashFromFS(t *testing.T, fsys fs.FS, name string, hasher fsutil.Hasher) string {
+	t.Helper()
+
+	hashedPath, err := fsutil.NewHashFS(fsys, hasher).HashedPath(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(hashedPath, ".")
+	if len(parts) != 3 {
+		t.Fatalf("unexpected hashed path %q", hashedPath)
+	}
+	return parts[1]
+}
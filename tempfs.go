@@ -0,0 +1,338 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var (
+	_ fs.FS         = (*TempFS)(nil)
+	_ fs.GlobFS     = (*TempFS)(nil)
+	_ fs.ReadDirFS  = (*TempFS)(nil)
+	_ fs.ReadFileFS = (*TempFS)(nil)
+	_ fs.StatFS     = (*TempFS)(nil)
+	_ fs.SubFS      = (*TempFS)(nil)
+	_ WriteFileFS   = (*TempFS)(nil)
+	_ RemoveFS      = (*TempFS)(nil)
+	_ MkdirAllFS    = (*TempFS)(nil)
+	_ io.Closer     = (*TempFS)(nil)
+)
+
+// TempFS is a writable filesystem in a new temporary directory that is removed
+// when the context passed to NewTempFS is done or when the Close method is
+// called. Files are written with WriteFile and Create methods and read with
+// the methods of fs.FS interfaces. After the directory is removed, all methods
+// return errors that wrap fs.ErrClosed.
+type TempFS struct {
+	dir      string
+	fsys     fs.FS
+	maxBytes int64
+
+	sizes  map[string]int64
+	used   int64
+	closed bool
+	mu     sync.Mutex
+
+	done      chan struct{}
+	closeErr  error
+	closeOnce sync.Once
+}
+
+// TempFSOption sets an optional parameter of the TempFS.
+type TempFSOption func(*tempFSOptions)
+
+type tempFSOptions struct {
+	dir      string
+	maxBytes int64
+}
+
+// WithTempFSDir sets the directory in which the temporary directory is
+// created. The default directory for temporary files is used by default.
+func WithTempFSDir(dir string) TempFSOption {
+	return func(o *tempFSOptions) {
+		o.dir = dir
+	}
+}
+
+// WithTempFSQuota limits the total size of files in the TempFS. Writes that
+// would exceed the limit return *QuotaExceededError with the "bytes"
+// resource.
+func WithTempFSQuota(maxBytes int64) TempFSOption {
+	return func(o *tempFSOptions) {
+		o.maxBytes = maxBytes
+	}
+}
+
+// NewTempFS creates a new temporary directory and returns TempFS rooted in it.
+// The directory is removed when the ctx is done.
+func NewTempFS(ctx context.Context, opts ...TempFSOption) (*TempFS, error) {
+	var o tempFSOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	dir, err := os.MkdirTemp(o.dir, "tempfs-")
+	if err != nil {
+		return nil, fmt.Errorf("create temporary directory: %w", err)
+	}
+
+	s := &TempFS{
+		dir:      dir,
+		fsys:     os.DirFS(dir),
+		maxBytes: o.maxBytes,
+		sizes:    make(map[string]int64),
+		done:     make(chan struct{}),
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = s.Close()
+		case <-s.done:
+		}
+	}()
+
+	return s, nil
+}
+
+// Dir returns the path of the temporary directory.
+func (s *TempFS) Dir() string {
+	return s.dir
+}
+
+// Usage returns the total size of files written to the TempFS.
+func (s *TempFS) Usage() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.used
+}
+
+// Close removes the temporary directory. It is safe to call it multiple
+// times.
+func (s *TempFS) Close() error {
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		s.closed = true
+		s.mu.Unlock()
+
+		close(s.done)
+		if err := os.RemoveAll(s.dir); err != nil {
+			s.closeErr = fmt.Errorf("remove temporary directory: %w", err)
+		}
+	})
+	return s.closeErr
+}
+
+// Done returns a channel that is closed when the temporary directory is
+// removed.
+func (s *TempFS) Done() <-chan struct{} {
+	return s.done
+}
+
+// WriteFile writes data to the named file, creating it with permissions perm
+// if necessary, and truncating it if it exists. Parent directories must
+// exist.
+func (s *TempFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	f, err := s.create("writefile", name, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Create creates or truncates the named file with permissions 0o666 and
+// returns a writer to it. Parent directories must exist.
+func (s *TempFS) Create(name string) (io.WriteCloser, error) {
+	return s.create("create", name, 0o666)
+}
+
+// MkdirAll creates a directory with permissions perm and all parent
+// directories that do not exist.
+func (s *TempFS) MkdirAll(name string, perm fs.FileMode) error {
+	path, err := s.path("mkdir", name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path, perm); err != nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: unwrapPathError(err)}
+	}
+	return nil
+}
+
+// Remove removes the named file or an empty directory.
+func (s *TempFS) Remove(name string) error {
+	path, err := s.path("remove", name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: unwrapPathError(err)}
+	}
+
+	s.mu.Lock()
+	s.used -= s.sizes[name]
+	delete(s.sizes, name)
+	s.mu.Unlock()
+	return nil
+}
+
+// Open implements fs.FS interface.
+func (s *TempFS) Open(name string) (fs.File, error) {
+	if err := s.checkClosed("open", name); err != nil {
+		return nil, err
+	}
+	return s.fsys.Open(name)
+}
+
+// Glob implements fs.GlobFS interface.
+func (s *TempFS) Glob(pattern string) ([]string, error) {
+	if err := s.checkClosed("glob", pattern); err != nil {
+		return nil, err
+	}
+	return fs.Glob(s.fsys, pattern)
+}
+
+// ReadDir implements fs.ReadDirFS interface.
+func (s *TempFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if err := s.checkClosed("readdir", name); err != nil {
+		return nil, err
+	}
+	return fs.ReadDir(s.fsys, name)
+}
+
+// ReadFile implements fs.ReadFileFS interface.
+func (s *TempFS) ReadFile(name string) ([]byte, error) {
+	if err := s.checkClosed("readfile", name); err != nil {
+		return nil, err
+	}
+	return fs.ReadFile(s.fsys, name)
+}
+
+// Stat implements fs.StatFS interface.
+func (s *TempFS) Stat(name string) (fs.FileInfo, error) {
+	if err := s.checkClosed("stat", name); err != nil {
+		return nil, err
+	}
+	return fs.Stat(s.fsys, name)
+}
+
+// Sub implements fs.SubFS interface.
+func (s *TempFS) Sub(dir string) (fs.FS, error) {
+	return newSubFS(s, dir)
+}
+
+func (s *TempFS) checkClosed(op, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrClosed}
+	}
+	return nil
+}
+
+// path returns the operating system path of the named file.
+func (s *TempFS) path(op, name string) (string, error) {
+	if !fs.ValidPath(name) || name == "." {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if err := s.checkClosed(op, name); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(name)), nil
+}
+
+func (s *TempFS) create(op, name string, perm fs.FileMode) (*tempFSFile, error) {
+	path, err := s.path(op, name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: unwrapPathError(err)}
+	}
+
+	// The file is truncated, its previous size is not used anymore.
+	s.mu.Lock()
+	s.used -= s.sizes[name]
+	s.sizes[name] = 0
+	s.mu.Unlock()
+
+	return &tempFSFile{
+		f:    f,
+		name: name,
+		fsys: s,
+	}, nil
+}
+
+// reserve adds n bytes to the usage of the named file if the quota allows it.
+func (s *TempFS) reserve(name string, n int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrClosed}
+	}
+	if s.maxBytes > 0 && s.used+n > s.maxBytes {
+		return &fs.PathError{Op: "write", Path: name, Err: &QuotaExceededError{Resource: "bytes", Limit: s.maxBytes}}
+	}
+	s.used += n
+	s.sizes[name] += n
+	return nil
+}
+
+// unreserve removes n bytes from the usage of the named file.
+func (s *TempFS) unreserve(name string, n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.used -= n
+	s.sizes[name] -= n
+}
+
+// tempFSFile is a file opened for writing in TempFS. It does not embed
+// *os.File, so that writes can not bypass the quota.
+type tempFSFile struct {
+	f    *os.File
+	name string
+	fsys *TempFS
+}
+
+func (f *tempFSFile) Write(p []byte) (int, error) {
+	if err := f.fsys.reserve(f.name, int64(len(p))); err != nil {
+		return 0, err
+	}
+	n, err := f.f.Write(p)
+	if n < len(p) {
+		f.fsys.unreserve(f.name, int64(len(p)-n))
+	}
+	return n, err
+}
+
+func (f *tempFSFile) Close() error {
+	return f.f.Close()
+}
+
+// unwrapPathError returns the error wrapped by *fs.PathError, so that
+// operating system paths are not exposed.
+func unwrapPathError(err error) error {
+	if perr, ok := err.(*fs.PathError); ok {
+		return perr.Err
+	}
+	return err
+}
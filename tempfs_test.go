@@ -0,0 +1,159 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestTempFS(t *testing.T) {
+	fsys, err := fsutil.NewTempFS(context.Background(), fsutil.WithTempFSDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fsys.Close()
+
+	if err := fsys.MkdirAll("reports/2021", 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.WriteFile("reports/2021/q1.csv", []byte("a,b"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	w, err := fsys.Create("index.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(w, strings.NewReader("q1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fstest.TestFS(fsys, "reports/2021/q1.csv", "index.txt"); err != nil {
+		t.Fatal(err)
+	}
+	testReadFile(t, fsys, "reports/2021/q1.csv", "a,b")
+	testReadFile(t, fsys, "index.txt", "q1")
+	if got := fsys.Usage(); got != 5 {
+		t.Errorf("got usage %v, want 5", got)
+	}
+
+	if err := fsys.WriteFile("index.txt", []byte("q1,q2"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := fsys.Usage(); got != 8 {
+		t.Errorf("got usage %v, want 8", got)
+	}
+
+	if err := fsys.Remove("reports/2021/q1.csv"); err != nil {
+		t.Fatal(err)
+	}
+	testReadFileNotExist(t, fsys, "reports/2021/q1.csv")
+	if got := fsys.Usage(); got != 5 {
+		t.Errorf("got usage %v, want 5", got)
+	}
+
+	if err := fsys.Remove("missing.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got error %v, want %v", err, fs.ErrNotExist)
+	}
+	for _, name := range []string{"../escape.txt", "/abs.txt", "."} {
+		if err := fsys.WriteFile(name, nil, 0o644); !errors.Is(err, fs.ErrInvalid) {
+			t.Errorf("got error %v for %q, want %v", err, name, fs.ErrInvalid)
+		}
+	}
+
+	dir := fsys.Dir()
+	if err := fsys.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got stat error %v, want %v", err, fs.ErrNotExist)
+	}
+	if _, err := fsys.Open("index.txt"); !errors.Is(err, fs.ErrClosed) {
+		t.Errorf("got error %v, want %v", err, fs.ErrClosed)
+	}
+	if err := fsys.WriteFile("index.txt", nil, 0o644); !errors.Is(err, fs.ErrClosed) {
+		t.Errorf("got error %v, want %v", err, fs.ErrClosed)
+	}
+	if err := fsys.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTempFS_context(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	fsys, err := fsutil.NewTempFS(ctx, fsutil.WithTempFSDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.WriteFile("a.txt", []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+
+	select {
+	case <-fsys.Done():
+	case <-time.After(30 * time.Second):
+		t.Fatal("timeout waiting for temporary directory to be removed")
+	}
+	if _, err := os.Stat(fsys.Dir()); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got stat error %v, want %v", err, fs.ErrNotExist)
+	}
+}
+
+func TestTempFS_quota(t *testing.T) {
+	fsys, err := fsutil.NewTempFS(context.Background(), fsutil.WithTempFSDir(t.TempDir()), fsutil.WithTempFSQuota(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fsys.Close()
+
+	if err := fsys.WriteFile("a.txt", []byte("12345678"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	err = fsys.WriteFile("b.txt", []byte("123"), 0o644)
+	if !errors.Is(err, fsutil.ErrQuotaExceeded) {
+		t.Fatalf("got error %v, want %v", err, fsutil.ErrQuotaExceeded)
+	}
+	var qerr *fsutil.QuotaExceededError
+	if !errors.As(err, &qerr) {
+		t.Fatalf("got error %T, want %T", err, qerr)
+	}
+	if qerr.Resource != "bytes" || qerr.Limit != 10 {
+		t.Errorf("got resource %q limit %v, want %q limit %v", qerr.Resource, qerr.Limit, "bytes", 10)
+	}
+
+	w, err := fsys.Create("c.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if _, err := io.Copy(w, strings.NewReader("123")); !errors.Is(err, fsutil.ErrQuotaExceeded) {
+		t.Errorf("got error %v, want %v", err, fsutil.ErrQuotaExceeded)
+	}
+
+	// Overwriting a file releases its previous size.
+	if err := fsys.WriteFile("a.txt", []byte("1234567890"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := fsys.Usage(); got != 10 {
+		t.Errorf("got usage %v, want 10", got)
+	}
+}
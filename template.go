@@ -0,0 +1,65 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"strings"
+	"sync"
+)
+
+// TemplateFuncs returns template functions that provide hashed file paths and
+// subresource integrity values from the HashFS:
+//
+//	assetPath "/assets/main.css"      -> "/assets/main.8559e1.css"
+//	assetIntegrity "/assets/main.css" -> "sha384-..."
+//
+// A leading slash in the name is preserved in the returned path, so that the
+// functions can be used directly with absolute URL paths. Integrity values are
+// cached by the hashed path, so that file content is read only once.
+func TemplateFuncs(hfs *HashFS) template.FuncMap {
+	var (
+		integrities   = make(map[string]string)
+		integritiesMu sync.Mutex
+	)
+	return template.FuncMap{
+		"assetPath": func(name string) (string, error) {
+			p, err := hfs.HashedPath(strings.TrimPrefix(name, "/"))
+			if err != nil {
+				return "", fmt.Errorf("asset path %s: %w", name, err)
+			}
+			if strings.HasPrefix(name, "/") {
+				p = "/" + p
+			}
+			return p, nil
+		},
+		"assetIntegrity": func(name string) (string, error) {
+			p, err := hfs.HashedPath(strings.TrimPrefix(name, "/"))
+			if err != nil {
+				return "", fmt.Errorf("asset integrity %s: %w", name, err)
+			}
+			integritiesMu.Lock()
+			integrity, ok := integrities[p]
+			integritiesMu.Unlock()
+			if ok {
+				return integrity, nil
+			}
+			data, err := hfs.ReadFile(p)
+			if err != nil {
+				return "", fmt.Errorf("asset integrity %s: %w", name, err)
+			}
+			sum := sha512.Sum384(data)
+			integrity = "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+			integritiesMu.Lock()
+			integrities[p] = integrity
+			integritiesMu.Unlock()
+			return integrity, nil
+		},
+	}
+}
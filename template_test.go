@@ -0,0 +1,86 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"resenje.org/fsutil"
+)
+
+func TestTemplateFuncs(t *testing.T) {
+	hfs := fsutil.NewHashFS(assetsHashFS, fsutil.NewMD5Hasher(6))
+
+	tpl := template.Must(template.New("").Funcs(fsutil.TemplateFuncs(hfs)).Parse(
+		`<link rel="stylesheet" href="{{assetPath "/assets/main.css"}}" integrity="{{assetIntegrity "/assets/main.css"}}">` +
+			`<link href="{{assetPath "assets/main.45b416.css"}}">`,
+	))
+
+	var b strings.Builder
+	if err := tpl.Execute(&b, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	sum := sha512.Sum384([]byte("body { color: blue; }"))
+	// html/template escapes the plus sign in attribute values.
+	integrity := strings.ReplaceAll("sha384-"+base64.StdEncoding.EncodeToString(sum[:]), "+", "&#43;")
+
+	want := `<link rel="stylesheet" href="/assets/main.8559e1.css" integrity="` + integrity + `">` +
+		`<link href="assets/main.45b416.css">`
+	if got := b.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestTemplateFuncs_integrityCache(t *testing.T) {
+	cfs := fsutil.NewCountingFS(assetsHashFS)
+	hfs := fsutil.NewHashFS(cfs, fsutil.NewMD5Hasher(6))
+
+	tpl := template.Must(template.New("").Funcs(fsutil.TemplateFuncs(hfs)).Parse(
+		`{{assetIntegrity "/assets/main.css"}}`,
+	))
+
+	var want string
+	var wantOpens int64
+	for i := 0; i < 3; i++ {
+		var b strings.Builder
+		if err := tpl.Execute(&b, nil); err != nil {
+			t.Fatal(err)
+		}
+		opens := cfs.Counts()["assets/main.css"].Opens
+		if i == 0 {
+			want = b.String()
+			wantOpens = opens
+			continue
+		}
+		if got := b.String(); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+		if opens != wantOpens {
+			t.Errorf("got %v opens after execution %v, want %v", opens, i+1, wantOpens)
+		}
+	}
+}
+
+func TestTemplateFuncs_notExist(t *testing.T) {
+	hfs := fsutil.NewHashFS(assetsHashFS, fsutil.NewMD5Hasher(6))
+
+	for _, text := range []string{
+		`{{assetPath "/passwords.txt"}}`,
+		`{{assetIntegrity "/passwords.txt"}}`,
+	} {
+		tpl := template.Must(template.New("").Funcs(fsutil.TemplateFuncs(hfs)).Parse(text))
+		if err := tpl.Execute(new(strings.Builder), nil); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("got error %v for template %q, want %v", err, text, fs.ErrNotExist)
+		}
+	}
+}
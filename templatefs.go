@@ -0,0 +1,331 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/fs"
+	"path"
+	"sync"
+	texttemplate "text/template"
+	"time"
+)
+
+var (
+	_ fs.FS         = (*TemplateFS)(nil)
+	_ fs.ReadDirFS  = (*TemplateFS)(nil)
+	_ fs.ReadFileFS = (*TemplateFS)(nil)
+	_ fs.StatFS     = (*TemplateFS)(nil)
+	_ fs.SubFS      = (*TemplateFS)(nil)
+	_ ReadLinkFS    = (*TemplateFS)(nil)
+)
+
+// TemplateDataFunc returns the data for rendering the template file with the
+// name.
+type TemplateDataFunc func(name string) (interface{}, error)
+
+// TemplateFS is a filesystem that renders files which names match configured
+// patterns as templates when they are opened. Files with ".html" and ".htm"
+// extensions are rendered with html/template and all other files with
+// text/template. Patterns have the same syntax as in GlobAll. Directories
+// which names match the patterns are not rendered.
+//
+// File info of rendered files reports the size of the rendered content and a
+// zero modification time, as the content depends on the data and not only on
+// the template file. Templates are parsed once and parsed again only if the
+// modification time or the size of the template file changes.
+type TemplateFS struct {
+	fsys     fs.FS
+	data     TemplateDataFunc
+	patterns []string
+
+	templates   map[string]parsedTemplate
+	templatesMu sync.Mutex
+}
+
+// parsedTemplate is a parsed template file with the modification time and
+// the size of the file that it is parsed from.
+type parsedTemplate struct {
+	template templateExecutor
+	modTime  time.Time
+	size     int64
+}
+
+// templateExecutor is implemented by both html/template and text/template
+// templates.
+type templateExecutor interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
+// NewTemplateFS returns a new instance of TemplateFS that renders files
+// matching any of the patterns with the data returned by the data function.
+func NewTemplateFS(fsys fs.FS, data TemplateDataFunc, patterns ...string) *TemplateFS {
+	return &TemplateFS{
+		fsys:      fsys,
+		data:      data,
+		patterns:  patterns,
+		templates: make(map[string]parsedTemplate),
+	}
+}
+
+// Open implements fs.FS interface.
+func (s *TemplateFS) Open(name string) (fs.File, error) {
+	ok, err := s.isTemplate(name)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		data, info, err := s.render(name)
+		if err != nil {
+			return nil, err
+		}
+		if info != nil {
+			return newMemFile(name, info, data), nil
+		}
+	}
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if d, ok := f.(fs.ReadDirFile); ok {
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if info.IsDir() {
+			return &templateDir{ReadDirFile: d, name: name, templateFS: s}, nil
+		}
+	}
+	return f, nil
+}
+
+// ReadDir implements fs.ReadDirFS interface.
+func (s *TemplateFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := fs.ReadDir(s.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	return s.templateEntries(name, entries)
+}
+
+// ReadFile implements fs.ReadFileFS interface.
+func (s *TemplateFS) ReadFile(name string) ([]byte, error) {
+	ok, err := s.isTemplate(name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return fs.ReadFile(s.fsys, name)
+	}
+	data, info, err := s.render(name)
+	if err != nil {
+		return nil, err
+	}
+	if info == nil {
+		return fs.ReadFile(s.fsys, name)
+	}
+	return data, nil
+}
+
+// Stat implements fs.StatFS interface.
+func (s *TemplateFS) Stat(name string) (fs.FileInfo, error) {
+	ok, err := s.isTemplate(name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return fs.Stat(s.fsys, name)
+	}
+	_, info, err := s.render(name)
+	if err != nil {
+		return nil, err
+	}
+	if info == nil {
+		return fs.Stat(s.fsys, name)
+	}
+	return info, nil
+}
+
+// ReadLink implements ReadLinkFS interface. Rendered templates are not
+// symbolic links.
+func (s *TemplateFS) ReadLink(name string) (string, error) {
+	ok, err := s.isTemplate(name)
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return ReadLink(s.fsys, name)
+}
+
+// Lstat implements ReadLinkFS interface.
+func (s *TemplateFS) Lstat(name string) (fs.FileInfo, error) {
+	ok, err := s.isTemplate(name)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		_, info, err := s.render(name)
+		if err != nil {
+			return nil, err
+		}
+		if info != nil {
+			return info, nil
+		}
+	}
+	return Lstat(s.fsys, name)
+}
+
+// Sub implements fs.SubFS interface.
+func (s *TemplateFS) Sub(dir string) (fs.FS, error) {
+	return newSubFS(s, dir)
+}
+
+// Unwrap returns the underlying filesystem.
+func (s *TemplateFS) Unwrap() fs.FS {
+	return s.fsys
+}
+
+// templateEntries replaces entries of template files in the directory with
+// entries that report the size of the rendered content.
+func (s *TemplateFS) templateEntries(dir string, entries []fs.DirEntry) ([]fs.DirEntry, error) {
+	for i, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		p := path.Join(dir, e.Name())
+		ok, err := s.isTemplate(p)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			entries[i] = &templateDirEntry{DirEntry: e, name: p, templateFS: s}
+		}
+	}
+	return entries, nil
+}
+
+func (s *TemplateFS) isTemplate(name string) (bool, error) {
+	for _, p := range s.patterns {
+		ok, err := MatchAll(p, name)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// render renders the template file. It returns nil data and nil file info if
+// the file is a directory.
+func (s *TemplateFS) render(name string) ([]byte, *memFileInfo, error) {
+	info, err := fs.Stat(s.fsys, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.IsDir() {
+		return nil, nil, nil
+	}
+	t, err := s.parse(name, info)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := s.data(name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("template data %s: %w", name, err)
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return nil, nil, fmt.Errorf("execute template %s: %w", name, err)
+	}
+
+	return buf.Bytes(), &memFileInfo{
+		name: info.Name(),
+		size: int64(buf.Len()),
+		mode: info.Mode(),
+		sys:  info.Sys(),
+	}, nil
+}
+
+// parse returns the parsed template file, parsing it only if it is not
+// already parsed from the file with the same modification time and size.
+func (s *TemplateFS) parse(name string, info fs.FileInfo) (templateExecutor, error) {
+	s.templatesMu.Lock()
+	p, ok := s.templates[name]
+	s.templatesMu.Unlock()
+	if ok && p.modTime.Equal(info.ModTime()) && p.size == info.Size() {
+		return p.template, nil
+	}
+
+	text, err := fs.ReadFile(s.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var t templateExecutor
+	switch path.Ext(name) {
+	case ".html", ".htm":
+		t, err = htmltemplate.New(name).Parse(string(text))
+	default:
+		t, err = texttemplate.New(name).Parse(string(text))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse template %s: %w", name, err)
+	}
+
+	s.templatesMu.Lock()
+	s.templates[name] = parsedTemplate{
+		template: t,
+		modTime:  info.ModTime(),
+		size:     info.Size(),
+	}
+	s.templatesMu.Unlock()
+
+	return t, nil
+}
+
+// templateDirEntry reports the size of the rendered template.
+type templateDirEntry struct {
+	fs.DirEntry
+	name       string
+	templateFS *TemplateFS
+}
+
+func (e *templateDirEntry) Info() (fs.FileInfo, error) {
+	_, info, err := e.templateFS.render(e.name)
+	if err != nil {
+		return nil, err
+	}
+	if info == nil {
+		return e.DirEntry.Info()
+	}
+	return info, nil
+}
+
+// templateDir is an opened directory with entries of template files that
+// report the size of the rendered content.
+type templateDir struct {
+	fs.ReadDirFile
+	name       string
+	templateFS *TemplateFS
+}
+
+func (d *templateDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	entries, err := d.ReadDirFile.ReadDir(n)
+	entries, terr := d.templateFS.templateEntries(d.name, entries)
+	if terr != nil {
+		return nil, terr
+	}
+	return entries, err
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestTemplateFS(t *testing.T) {
+	type config struct {
+		APIURL string
+		Title  string
+	}
+
+	fsys := fsutil.NewTemplateFS(fsutil.MapFS{
+		"index.html":     {Data: []byte("<title>{{.Title}}</title>")},
+		"config.js":      {Data: []byte(`window.apiURL = "{{.APIURL}}";`)},
+		"static/app.js":  {Data: []byte("app({{.APIURL}});")},
+		"static/app.css": {Data: []byte("body {}")},
+	}, func(name string) (interface{}, error) {
+		return config{
+			APIURL: "https://api.example.com",
+			Title:  "Tom & Jerry",
+		}, nil
+	}, "*.{html,js}")
+
+	wantIndex := "<title>Tom &amp; Jerry</title>"
+	wantConfig := `window.apiURL = "https://api.example.com";`
+
+	testOpen(t, fsys, "index.html", wantIndex)
+	testOpen(t, fsys, "config.js", wantConfig)
+	testOpen(t, fsys, "static/app.js", "app({{.APIURL}});")
+	testReadFile(t, fsys, "config.js", wantConfig)
+	testReadFile(t, fsys, "static/app.css", "body {}")
+
+	info, err := fsys.Stat("index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != int64(len(wantIndex)) {
+		t.Errorf("got size %v, want %v", info.Size(), len(wantIndex))
+	}
+	if !info.ModTime().IsZero() {
+		t.Errorf("got modification time %v, want zero", info.ModTime())
+	}
+
+	entries, err := fsys.ReadDir(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.Name() != "config.js" {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() != int64(len(wantConfig)) {
+			t.Errorf("got size %v, want %v", info.Size(), len(wantConfig))
+		}
+	}
+}
+
+func TestTemplateFS_directories(t *testing.T) {
+	fsys := fsutil.NewTemplateFS(fsutil.MapFS{
+		"conf/app.conf":      {Data: []byte("name={{.}}")},
+		"conf/sub/site.conf": {Data: []byte("site={{.}}")},
+	}, func(name string) (interface{}, error) {
+		return "app", nil
+	}, "conf/**")
+
+	if err := fstest.TestFS(fsys, "conf/app.conf", "conf/sub/site.conf"); err != nil {
+		t.Fatal(err)
+	}
+	testOpen(t, fsys, "conf/app.conf", "name=app")
+	testReadFile(t, fsys, "conf/sub/site.conf", "site=app")
+
+	for _, name := range []string{"conf", "conf/sub"} {
+		info, err := fsys.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.IsDir() {
+			t.Errorf("%s: got not a directory", name)
+		}
+	}
+}
+
+func TestTemplateFS_parseOnce(t *testing.T) {
+	files := fsutil.MapFS{
+		"index.html": {Data: []byte("<p>{{.}}</p>")},
+	}
+	fsys := fsutil.NewTemplateFS(files, func(name string) (interface{}, error) {
+		return "text", nil
+	}, "*.html")
+
+	testReadFile(t, fsys, "index.html", "<p>text</p>")
+
+	// A template file with the same modification time and size is not
+	// parsed again.
+	files["index.html"] = &fsutil.MapFile{Data: []byte("<b>{{.}}</b>")}
+	testReadFile(t, fsys, "index.html", "<p>text</p>")
+
+	files["index.html"] = &fsutil.MapFile{Data: []byte("<b>{{.}}</b>"), ModTime: time.Now()}
+	testReadFile(t, fsys, "index.html", "<b>text</b>")
+}
+
+func TestTemplateFS_dataError(t *testing.T) {
+	fsys := fsutil.NewTemplateFS(fsutil.MapFS{
+		"index.html": {Data: []byte("{{.}}")},
+	}, func(name string) (interface{}, error) {
+		return nil, errTest1
+	}, "*.html")
+
+	if _, err := fsys.Open("index.html"); !errors.Is(err, errTest1) {
+		t.Errorf("got error %v, want %v", err, errTest1)
+	}
+	if _, err := fs.Stat(fsys, "missing.html"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got error %v, want %v", err, fs.ErrNotExist)
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+)
+
+var (
+	_ fs.FS         = (*TenantFS)(nil)
+	_ fs.GlobFS     = (*TenantFS)(nil)
+	_ fs.ReadDirFS  = (*TenantFS)(nil)
+	_ fs.ReadFileFS = (*TenantFS)(nil)
+	_ fs.StatFS     = (*TenantFS)(nil)
+	_ fs.SubFS      = (*TenantFS)(nil)
+	_ ReadLinkFS    = (*TenantFS)(nil)
+)
+
+// TenantFS is a filesystem that serves files from a different filesystem for
+// every tenant. The first element of a path is the tenant key and the rest of
+// the path is the name of the file in the tenant filesystem, so that
+// "acme/css/theme.css" is the file "css/theme.css" of the "acme" tenant.
+// Filesystems of tenants are returned by the resolver function and cached, so
+// that wrappers such as HashFS can be composed above TenantFS to serve all
+// tenants with a single cache.
+//
+// The root directory exists, but it has no entries, as tenants are not known
+// until they are accessed.
+type TenantFS struct {
+	resolve func(key string) (fs.FS, error)
+
+	tenants   map[string]*tenantEntry
+	tenantsMu sync.Mutex
+}
+
+type tenantEntry struct {
+	fsys  fs.FS
+	err   error
+	ready chan struct{}
+}
+
+// NewTenantFS returns a new instance of TenantFS. The resolve function returns
+// the filesystem of the tenant with the key. It should return an error that
+// wraps fs.ErrNotExist for unknown tenants. Returned filesystems are cached
+// until they are removed with the Forget method, while errors are not cached.
+func NewTenantFS(resolve func(key string) (fs.FS, error)) *TenantFS {
+	return &TenantFS{
+		resolve: resolve,
+		tenants: make(map[string]*tenantEntry),
+	}
+}
+
+// Open implements fs.FS interface.
+func (s *TenantFS) Open(name string) (fs.File, error) {
+	if name == "." {
+		return newMemDir(name, virtualDirInfo(name), nil), nil
+	}
+	key, rel, fsys, err := s.tenant("open", name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := fsys.Open(rel)
+	if err != nil {
+		return nil, tenantPathError(key, err)
+	}
+	if rel == "." {
+		return &tenantRootFile{wrappedFile{File: f, name: key}}, nil
+	}
+	return f, nil
+}
+
+// Glob implements fs.GlobFS interface.
+func (s *TenantFS) Glob(pattern string) ([]string, error) {
+	return fs.Glob(readDirFS{FSFunc: s.Open, readDir: s.ReadDir}, pattern)
+}
+
+// ReadDir implements fs.ReadDirFS interface.
+func (s *TenantFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if name == "." {
+		return []fs.DirEntry{}, nil
+	}
+	key, rel, fsys, err := s.tenant("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := fs.ReadDir(fsys, rel)
+	if err != nil {
+		return nil, tenantPathError(key, err)
+	}
+	return entries, nil
+}
+
+// ReadFile implements fs.ReadFileFS interface.
+func (s *TenantFS) ReadFile(name string) ([]byte, error) {
+	key, rel, fsys, err := s.tenant("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := fs.ReadFile(fsys, rel)
+	if err != nil {
+		return nil, tenantPathError(key, err)
+	}
+	return data, nil
+}
+
+// Stat implements fs.StatFS interface.
+func (s *TenantFS) Stat(name string) (fs.FileInfo, error) {
+	if name == "." {
+		return virtualDirInfo(name), nil
+	}
+	key, rel, fsys, err := s.tenant("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := fs.Stat(fsys, rel)
+	if err != nil {
+		return nil, tenantPathError(key, err)
+	}
+	if rel == "." {
+		return NewFileInfo(info, WithName(key)), nil
+	}
+	return info, nil
+}
+
+// ReadLink implements ReadLinkFS interface.
+func (s *TenantFS) ReadLink(name string) (string, error) {
+	key, rel, fsys, err := s.tenant("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	target, err := ReadLink(fsys, rel)
+	if err != nil {
+		return "", tenantPathError(key, err)
+	}
+	return target, nil
+}
+
+// Lstat implements ReadLinkFS interface.
+func (s *TenantFS) Lstat(name string) (fs.FileInfo, error) {
+	if name == "." {
+		return virtualDirInfo(name), nil
+	}
+	key, rel, fsys, err := s.tenant("lstat", name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := Lstat(fsys, rel)
+	if err != nil {
+		return nil, tenantPathError(key, err)
+	}
+	if rel == "." {
+		return NewFileInfo(info, WithName(key)), nil
+	}
+	return info, nil
+}
+
+// Sub implements fs.SubFS interface.
+func (s *TenantFS) Sub(dir string) (fs.FS, error) {
+	return newSubFS(s, dir)
+}
+
+// Tenant returns the filesystem of the tenant with the key, resolving it if
+// it is not cached.
+func (s *TenantFS) Tenant(key string) (fs.FS, error) {
+	if !fs.ValidPath(key) || key == "." || strings.Contains(key, "/") {
+		return nil, &fs.PathError{Op: "tenant", Path: key, Err: fs.ErrInvalid}
+	}
+	s.tenantsMu.Lock()
+	e, ok := s.tenants[key]
+	if !ok {
+		e = &tenantEntry{ready: make(chan struct{})}
+		s.tenants[key] = e
+	}
+	s.tenantsMu.Unlock()
+
+	if ok {
+		<-e.ready
+		return e.fsys, e.err
+	}
+
+	e.fsys, e.err = s.resolve(key)
+	if e.err != nil {
+		s.tenantsMu.Lock()
+		if s.tenants[key] == e {
+			delete(s.tenants, key)
+		}
+		s.tenantsMu.Unlock()
+	}
+	close(e.ready)
+	return e.fsys, e.err
+}
+
+// Forget removes the cached filesystem of the tenant with the key, so that it
+// is resolved again on the next access.
+func (s *TenantFS) Forget(key string) {
+	s.tenantsMu.Lock()
+	defer s.tenantsMu.Unlock()
+
+	delete(s.tenants, key)
+}
+
+// tenant splits the name into the tenant key and the name in the tenant
+// filesystem and returns the tenant filesystem.
+func (s *TenantFS) tenant(op, name string) (key, rel string, fsys fs.FS, err error) {
+	if !fs.ValidPath(name) {
+		return "", "", nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return "", "", nil, &fs.PathError{Op: op, Path: name, Err: errIsDir}
+	}
+	key, rel = name, "."
+	if i := strings.IndexByte(name, '/'); i >= 0 {
+		key, rel = name[:i], name[i+1:]
+	}
+	fsys, err = s.Tenant(key)
+	if err != nil {
+		return "", "", nil, &fs.PathError{Op: op, Path: name, Err: unwrapPathError(err)}
+	}
+	return key, rel, fsys, nil
+}
+
+// tenantPathError prefixes the path in fs.PathError with the tenant key.
+func tenantPathError(key string, err error) error {
+	var e *fs.PathError
+	if errors.As(err, &e) {
+		e.Path = path.Join(key, e.Path)
+	}
+	return err
+}
+
+// tenantRootFile is the root directory of a tenant filesystem with the name
+// of the tenant key.
+type tenantRootFile struct {
+	wrappedFile
+}
+
+func (f *tenantRootFile) Stat() (fs.FileInfo, error) {
+	info, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return NewFileInfo(info, WithName(f.name)), nil
+}
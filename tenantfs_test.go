@@ -0,0 +1,130 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"resenje.org/fsutil"
+)
+
+func TestTenantFS(t *testing.T) {
+	tenants := map[string]fs.FS{
+		"acme": fsutil.MapFS{
+			"css/theme.css": {Data: []byte("acme{}")},
+			"logo.svg":      {Data: []byte("<svg>acme")},
+		},
+		"globex": fsutil.MapFS{
+			"css/theme.css": {Data: []byte("globex{}")},
+		},
+	}
+	var (
+		resolved []string
+		mu       sync.Mutex
+	)
+	fsys := fsutil.NewTenantFS(func(key string) (fs.FS, error) {
+		mu.Lock()
+		resolved = append(resolved, key)
+		mu.Unlock()
+		if key == "faulty" {
+			return nil, errTest1
+		}
+		tenant, ok := tenants[key]
+		if !ok {
+			return nil, fmt.Errorf("tenant %s: %w", key, fs.ErrNotExist)
+		}
+		return tenant, nil
+	})
+
+	acme, err := fs.Sub(fsys, "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(acme, "css/theme.css", "logo.svg"); err != nil {
+		t.Fatal(err)
+	}
+
+	testOpen(t, fsys, "acme/css/theme.css", "acme{}")
+	testReadFile(t, fsys, "globex/css/theme.css", "globex{}")
+	testReadFileNotExist(t, fsys, "globex/logo.svg")
+	testOpenNotExist(t, fsys, "initech/css/theme.css")
+	testStatNotExist(t, fsys, "initech")
+	testGlob(t, fsys, "*/css/*.css", nil)
+	testGlob(t, fsys, "acme/*/*.css", []string{"acme/css/theme.css"})
+
+	info, err := fsys.Stat("acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name() != "acme" || !info.IsDir() {
+		t.Errorf("got tenant root %q dir %v", info.Name(), info.IsDir())
+	}
+
+	entries, err := fsys.ReadDir(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("got root entries %v, want none", entries)
+	}
+
+	_, err = fsys.Open("globex/missing.css")
+	var perr *fs.PathError
+	if !errors.As(err, &perr) || perr.Path != "globex/missing.css" {
+		t.Errorf("got error %v, want path error for globex/missing.css", err)
+	}
+
+	if _, err := fsys.Open("faulty/index.html"); !errors.Is(err, errTest1) {
+		t.Errorf("got error %v, want %v", err, errTest1)
+	}
+	if _, err := fsys.Tenant("a/b"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("got error %v, want %v", err, fs.ErrInvalid)
+	}
+
+	t.Run("cache", func(t *testing.T) {
+		count := func(key string) (n int) {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, k := range resolved {
+				if k == key {
+					n++
+				}
+			}
+			return n
+		}
+		if got := count("acme"); got != 1 {
+			t.Errorf("got acme resolved %v times, want 1", got)
+		}
+		if got := count("initech"); got != 2 {
+			t.Errorf("got initech resolved %v times, want 2", got)
+		}
+
+		fsys.Forget("acme")
+		testReadFile(t, fsys, "acme/logo.svg", "<svg>acme")
+		if got := count("acme"); got != 2 {
+			t.Errorf("got acme resolved %v times after forget, want 2", got)
+		}
+	})
+
+	t.Run("hash", func(t *testing.T) {
+		hfs := fsutil.NewHashFS(fsys, fsutil.NewMD5Hasher(8))
+		acmePath, err := hfs.HashedPath("acme/css/theme.css")
+		if err != nil {
+			t.Fatal(err)
+		}
+		globexPath, err := hfs.HashedPath("globex/css/theme.css")
+		if err != nil {
+			t.Fatal(err)
+		}
+		testReadFile(t, hfs, acmePath, "acme{}")
+		testReadFile(t, hfs, globexPath, "globex{}")
+	})
+}
@@ -0,0 +1,175 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"io"
+	"io/fs"
+	"sync"
+	"time"
+)
+
+var (
+	_ fs.FS         = (*throttleFS)(nil)
+	_ fs.ReadFileFS = (*throttleFS)(nil)
+	_ fs.StatFS     = (*throttleFS)(nil)
+	_ fs.SubFS      = (*throttleFS)(nil)
+	_ ReadLinkFS    = (*throttleFS)(nil)
+)
+
+// ThrottleFS returns a filesystem that limits the total read bandwidth of all
+// opened files to bytesPerSecond. All files share a single token bucket, so
+// that the limit applies to the filesystem as a whole and not to every file.
+// The burst is the capacity of the bucket, the number of bytes that can be
+// read without waiting after a period without reads, and also the maximal
+// number of bytes read by a single Read call, so that large files do not
+// starve reads of other files. Files implement io.ReaderAt, with the same
+// limit, if the underlying files implement it. Other optional interfaces of
+// the underlying files, such as io.WriterTo, are hidden, as they would bypass
+// the limit.
+func ThrottleFS(fsys fs.FS, bytesPerSecond int64, burst int) fs.FS {
+	if burst < 1 {
+		burst = 1
+	}
+	return &throttleFS{
+		fsys:   fsys,
+		bucket: newTokenBucket(float64(bytesPerSecond), float64(burst)),
+		burst:  burst,
+	}
+}
+
+type throttleFS struct {
+	fsys   fs.FS
+	bucket *tokenBucket
+	burst  int
+}
+
+func (s *throttleFS) Open(name string) (fs.File, error) {
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	file := &throttleFile{wrappedFile: wrappedFile{File: f, name: name}, throttleFS: s}
+	if _, ok := f.(io.ReaderAt); ok {
+		return throttleReaderAtFile{file}, nil
+	}
+	return file, nil
+}
+
+func (s *throttleFS) ReadFile(name string) ([]byte, error) {
+	f, err := s.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return io.ReadAll(f)
+}
+
+func (s *throttleFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(s.fsys, name)
+}
+
+func (s *throttleFS) ReadLink(name string) (string, error) {
+	return ReadLink(s.fsys, name)
+}
+
+func (s *throttleFS) Lstat(name string) (fs.FileInfo, error) {
+	return Lstat(s.fsys, name)
+}
+
+func (s *throttleFS) Sub(dir string) (fs.FS, error) {
+	return newSubFS(s, dir)
+}
+
+func (s *throttleFS) Unwrap() fs.FS {
+	return s.fsys
+}
+
+type throttleFile struct {
+	wrappedFile
+	throttleFS *throttleFS
+}
+
+func (f *throttleFile) Read(p []byte) (int, error) {
+	if len(p) > f.throttleFS.burst {
+		p = p[:f.throttleFS.burst]
+	}
+	n, err := f.File.Read(p)
+	f.throttleFS.bucket.wait(n)
+	return n, err
+}
+
+// throttleReaderAtFile is a throttleFile of an underlying file that implements
+// io.ReaderAt.
+type throttleReaderAtFile struct {
+	*throttleFile
+}
+
+// ReadAt reads from the underlying file in parts of at most burst bytes,
+// waiting for the bandwidth limit after each of them.
+func (f throttleReaderAtFile) ReadAt(p []byte, off int64) (n int, err error) {
+	r := f.File.(io.ReaderAt)
+	burst := f.throttleFS.burst
+	for n < len(p) {
+		end := n + burst
+		if end > len(p) {
+			end = len(p)
+		}
+		var m int
+		m, err = r.ReadAt(p[n:end], off+int64(n))
+		n += m
+		f.throttleFS.bucket.wait(m)
+		if err != nil {
+			break
+		}
+	}
+	return n, err
+}
+
+// tokenBucket is a rate limiter that allows reservation of tokens in advance,
+// making the callers wait until the reserved tokens are refilled.
+type tokenBucket struct {
+	rate   float64 // tokens per second
+	burst  float64 // bucket capacity
+	tokens float64
+	last   time.Time
+	mu     sync.Mutex
+}
+
+func newTokenBucket(rate, burst float64) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// wait takes n tokens from the bucket, blocking until they are available.
+func (b *tokenBucket) wait(n int) {
+	if n <= 0 || b.rate <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.tokens -= float64(n)
+	var d time.Duration
+	if b.tokens < 0 {
+		d = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mu.Unlock()
+
+	if d > 0 {
+		time.Sleep(d)
+	}
+}
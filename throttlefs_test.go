@@ -0,0 +1,90 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestThrottleFS(t *testing.T) {
+	data := bytes.Repeat([]byte("a"), 3000)
+
+	fsys := fsutil.ThrottleFS(fsutil.MapFS{
+		"file.bin": {Data: data},
+	}, 10000, 1000)
+
+	start := time.Now()
+
+	f, err := fsys.Open("file.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	buf := make([]byte, len(data))
+	n, err := f.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1000 {
+		t.Errorf("got read %v bytes, want %v", n, 1000)
+	}
+
+	rest, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(append(buf[:n], rest...), data) {
+		t.Error("got different data")
+	}
+
+	// The first 1000 bytes are within the burst, the remaining 2000 bytes
+	// require 200ms at 10000 bytes per second.
+	if d := time.Since(start); d < 150*time.Millisecond {
+		t.Errorf("read took %v, want at least %v", d, 150*time.Millisecond)
+	}
+}
+
+func TestThrottleFS_readAt(t *testing.T) {
+	data := bytes.Repeat([]byte("a"), 3000)
+
+	fsys := fsutil.ThrottleFS(fsutil.MapFS{
+		"file.bin": {Data: data},
+	}, 10000, 1000)
+
+	start := time.Now()
+
+	f, err := fsys.Open("file.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	r, ok := f.(io.ReaderAt)
+	if !ok {
+		t.Fatal("file does not implement io.ReaderAt")
+	}
+	buf := make([]byte, len(data))
+	n, err := r.ReadAt(buf, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(data) {
+		t.Errorf("got read %v bytes, want %v", n, len(data))
+	}
+	if !bytes.Equal(buf, data) {
+		t.Error("got different data")
+	}
+
+	if d := time.Since(start); d < 150*time.Millisecond {
+		t.Errorf("read took %v, want at least %v", d, 150*time.Millisecond)
+	}
+}
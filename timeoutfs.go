@@ -0,0 +1,247 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"context"
+	"io/fs"
+	"time"
+)
+
+var (
+	_ fs.FS         = (*TimeoutFS)(nil)
+	_ fs.ReadDirFS  = (*TimeoutFS)(nil)
+	_ fs.ReadFileFS = (*TimeoutFS)(nil)
+	_ fs.StatFS     = (*TimeoutFS)(nil)
+	_ fs.SubFS      = (*TimeoutFS)(nil)
+	_ OpenContextFS = (*TimeoutFS)(nil)
+	_ StatContextFS = (*TimeoutFS)(nil)
+	_ ReadLinkFS    = (*TimeoutFS)(nil)
+)
+
+// OpenContextFS is the interface implemented by a filesystem that can cancel
+// opening a file when the context is done.
+type OpenContextFS interface {
+	fs.FS
+
+	// OpenContext opens the named file. It returns the context error if the
+	// context is done before the file is opened.
+	OpenContext(ctx context.Context, name string) (fs.File, error)
+}
+
+// StatContextFS is the interface implemented by a filesystem that can cancel
+// file stat when the context is done.
+type StatContextFS interface {
+	fs.FS
+
+	// StatContext returns a FileInfo describing the file. It returns the
+	// context error if the context is done before the file info is returned.
+	StatContext(ctx context.Context, name string) (fs.FileInfo, error)
+}
+
+// OpenContext opens the named file from the file system fsys.
+//
+// If fsys implements OpenContextFS, OpenContext calls fsys.OpenContext.
+// Otherwise, fsys.Open is called in a separate goroutine and OpenContext
+// returns the context error as soon as the context is done. The file that is
+// opened after that is closed.
+func OpenContext(ctx context.Context, fsys fs.FS, name string) (fs.File, error) {
+	if fsys, ok := fsys.(OpenContextFS); ok {
+		return fsys.OpenContext(ctx, name)
+	}
+	var f fs.File
+	err := doContext(ctx, func() (err error) {
+		f, err = fsys.Open(name)
+		return err
+	}, func() {
+		_ = f.Close()
+	})
+	if err != nil {
+		return nil, contextPathError("open", name, err)
+	}
+	return f, nil
+}
+
+// StatContext returns a FileInfo describing the named file from the file
+// system fsys.
+//
+// If fsys implements StatContextFS, StatContext calls fsys.StatContext.
+// Otherwise, fs.Stat is called in a separate goroutine and StatContext returns
+// the context error as soon as the context is done.
+func StatContext(ctx context.Context, fsys fs.FS, name string) (fs.FileInfo, error) {
+	if fsys, ok := fsys.(StatContextFS); ok {
+		return fsys.StatContext(ctx, name)
+	}
+	var info fs.FileInfo
+	err := doContext(ctx, func() (err error) {
+		info, err = fs.Stat(fsys, name)
+		return err
+	}, nil)
+	if err != nil {
+		return nil, contextPathError("stat", name, err)
+	}
+	return info, nil
+}
+
+// doContext calls fn in a separate goroutine and waits for it to return or for
+// the context to be done. If the context is done first, the abandon function
+// is called after fn returns without an error, to release the resources that
+// fn acquired.
+func doContext(ctx context.Context, fn func() error, abandon func()) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		if abandon != nil {
+			go func() {
+				if err := <-done; err == nil {
+					abandon()
+				}
+			}()
+		}
+		return ctx.Err()
+	}
+}
+
+// contextPathError wraps context errors into fs.PathError. Other errors are
+// returned unchanged.
+func contextPathError(op, name string, err error) error {
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return err
+}
+
+// TimeoutFS is a filesystem that limits the duration of Open, ReadDir, ReadFile
+// and Stat calls to the underlying filesystem, so that a filesystem that hangs,
+// for example an os.DirFS on an unreachable network mount, does not block the
+// caller forever. Operations that time out return an error that wraps
+// context.DeadlineExceeded. Reads from opened files are not limited.
+//
+// An operation that times out keeps running in the background until the
+// underlying filesystem returns.
+type TimeoutFS struct {
+	fsys    fs.FS
+	timeout time.Duration
+}
+
+// NewTimeoutFS returns a new instance of TimeoutFS that limits every operation
+// to the timeout duration.
+func NewTimeoutFS(fsys fs.FS, timeout time.Duration) *TimeoutFS {
+	return &TimeoutFS{
+		fsys:    fsys,
+		timeout: timeout,
+	}
+}
+
+// Open implements fs.FS interface.
+func (s *TimeoutFS) Open(name string) (fs.File, error) {
+	return s.OpenContext(context.Background(), name)
+}
+
+// OpenContext implements OpenContextFS interface. The operation is canceled
+// when the context is done or when the timeout passes, whichever comes first.
+func (s *TimeoutFS) OpenContext(ctx context.Context, name string) (fs.File, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	return OpenContext(ctx, s.fsys, name)
+}
+
+// ReadDir implements fs.ReadDirFS interface.
+func (s *TimeoutFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	var entries []fs.DirEntry
+	err := doContext(ctx, func() (err error) {
+		entries, err = fs.ReadDir(s.fsys, name)
+		return err
+	}, nil)
+	if err != nil {
+		return nil, contextPathError("readdir", name, err)
+	}
+	return entries, nil
+}
+
+// ReadFile implements fs.ReadFileFS interface.
+func (s *TimeoutFS) ReadFile(name string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	var data []byte
+	err := doContext(ctx, func() (err error) {
+		data, err = fs.ReadFile(s.fsys, name)
+		return err
+	}, nil)
+	if err != nil {
+		return nil, contextPathError("readfile", name, err)
+	}
+	return data, nil
+}
+
+// Stat implements fs.StatFS interface.
+func (s *TimeoutFS) Stat(name string) (fs.FileInfo, error) {
+	return s.StatContext(context.Background(), name)
+}
+
+// ReadLink implements ReadLinkFS interface.
+func (s *TimeoutFS) ReadLink(name string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	var target string
+	err := doContext(ctx, func() (err error) {
+		target, err = ReadLink(s.fsys, name)
+		return err
+	}, nil)
+	if err != nil {
+		return "", contextPathError("readlink", name, err)
+	}
+	return target, nil
+}
+
+// Lstat implements ReadLinkFS interface.
+func (s *TimeoutFS) Lstat(name string) (fs.FileInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	var info fs.FileInfo
+	err := doContext(ctx, func() (err error) {
+		info, err = Lstat(s.fsys, name)
+		return err
+	}, nil)
+	if err != nil {
+		return nil, contextPathError("lstat", name, err)
+	}
+	return info, nil
+}
+
+// Sub implements fs.SubFS interface.
+func (s *TimeoutFS) Sub(dir string) (fs.FS, error) {
+	return newSubFS(s, dir)
+}
+
+// Unwrap returns the underlying filesystem.
+func (s *TimeoutFS) Unwrap() fs.FS {
+	return s.fsys
+}
+
+// StatContext implements StatContextFS interface. The operation is canceled
+// when the context is done or when the timeout passes, whichever comes first.
+func (s *TimeoutFS) StatContext(ctx context.Context, name string) (fs.FileInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	return StatContext(ctx, s.fsys, name)
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"testing"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestTimeoutFS(t *testing.T) {
+	files := fsutil.MapFS{
+		"fast.txt":     {Data: []byte("fast")},
+		"dir/slow.txt": {Data: []byte("slow")},
+	}
+	unblock := make(chan struct{})
+	defer close(unblock)
+
+	fsys := fsutil.NewTimeoutFS(fsutil.FSFunc(func(name string) (fs.File, error) {
+		if name == "dir/slow.txt" || name == "dir" {
+			<-unblock
+		}
+		return files.Open(name)
+	}), 50*time.Millisecond)
+
+	t.Run("open", func(t *testing.T) {
+		testOpen(t, fsys, "fast.txt", "fast")
+
+		_, err := fsys.Open("dir/slow.txt")
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("got error %v, want %v", err, context.DeadlineExceeded)
+		}
+	})
+
+	t.Run("read file", func(t *testing.T) {
+		testReadFile(t, fsys, "fast.txt", "fast")
+
+		_, err := fsys.ReadFile("dir/slow.txt")
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("got error %v, want %v", err, context.DeadlineExceeded)
+		}
+	})
+
+	t.Run("read dir", func(t *testing.T) {
+		_, err := fsys.ReadDir("dir")
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("got error %v, want %v", err, context.DeadlineExceeded)
+		}
+	})
+
+	t.Run("stat", func(t *testing.T) {
+		info, err := fsys.Stat("fast.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Name() != "fast.txt" || info.Size() != 4 {
+			t.Errorf("got name %q size %v, want name %q size %v", info.Name(), info.Size(), "fast.txt", 4)
+		}
+
+		_, err = fsys.Stat("dir/slow.txt")
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("got error %v, want %v", err, context.DeadlineExceeded)
+		}
+	})
+
+	t.Run("canceled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := fsys.OpenContext(ctx, "fast.txt")
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("got error %v, want %v", err, context.Canceled)
+		}
+		_, err = fsys.StatContext(ctx, "fast.txt")
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("got error %v, want %v", err, context.Canceled)
+		}
+	})
+}
+
+func TestOpenContext(t *testing.T) {
+	fsys := fsutil.NewTimeoutFS(fsutil.MapFS{
+		"a.txt": {Data: []byte("a")},
+	}, time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// TimeoutFS implements OpenContextFS and it is used directly.
+	if _, err := fsutil.OpenContext(ctx, fsys, "a.txt"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
+	}
+
+	f, err := fsutil.OpenContext(context.Background(), fsys, "a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+}
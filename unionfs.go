@@ -0,0 +1,214 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"sort"
+)
+
+var (
+	_ fs.FS         = (*UnionFS)(nil)
+	_ fs.GlobFS     = (*UnionFS)(nil)
+	_ fs.ReadDirFS  = (*UnionFS)(nil)
+	_ fs.ReadFileFS = (*UnionFS)(nil)
+	_ fs.StatFS     = (*UnionFS)(nil)
+	_ fs.SubFS      = (*UnionFS)(nil)
+	_ ReadLinkFS    = (*UnionFS)(nil)
+)
+
+// UnionFS is a filesystem that combines layers of filesystems, searching them
+// in order. A file is served from the first layer that has it, so that files
+// in earlier layers override the ones with the same names in later layers,
+// for example theme assets overriding the base ones. Entries of directories
+// with the same name are merged from all layers where the name is a
+// directory. A file in an earlier layer hides a directory with the same name,
+// including all files in it, in later layers and the other way around.
+//
+// Wrapping UnionFS with HashFS hashes files from all layers in a single
+// namespace, with hashes of the content of the files that are served.
+// Wrapping it with NotExistCacheFS avoids searching all layers on repeated
+// accesses to files that do not exist.
+type UnionFS struct {
+	layers []fs.FS
+}
+
+// NewUnionFS returns a new instance of UnionFS with layers in the order of
+// precedence.
+func NewUnionFS(layers ...fs.FS) *UnionFS {
+	return &UnionFS{
+		layers: layers,
+	}
+}
+
+// Open implements fs.FS interface.
+func (s *UnionFS) Open(name string) (fs.File, error) {
+	i, info, err := s.find("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return s.layers[i].Open(name)
+	}
+	entries, err := s.readDir(i, name)
+	if err != nil {
+		return nil, err
+	}
+	return newMemDir(name, info, entries), nil
+}
+
+// Glob implements fs.GlobFS interface.
+func (s *UnionFS) Glob(pattern string) ([]string, error) {
+	return fs.Glob(readDirFS{FSFunc: s.Open, readDir: s.ReadDir}, pattern)
+}
+
+// ReadDir implements fs.ReadDirFS interface.
+func (s *UnionFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	i, info, err := s.find("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errNotDir}
+	}
+	return s.readDir(i, name)
+}
+
+// ReadFile implements fs.ReadFileFS interface.
+func (s *UnionFS) ReadFile(name string) ([]byte, error) {
+	i, _, err := s.find("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.ReadFile(s.layers[i], name)
+}
+
+// Stat implements fs.StatFS interface.
+func (s *UnionFS) Stat(name string) (fs.FileInfo, error) {
+	_, info, err := s.find("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// ReadLink implements ReadLinkFS interface.
+func (s *UnionFS) ReadLink(name string) (string, error) {
+	i, _, err := s.findWith("readlink", name, Lstat)
+	if err != nil {
+		return "", err
+	}
+	return ReadLink(s.layers[i], name)
+}
+
+// Lstat implements ReadLinkFS interface.
+func (s *UnionFS) Lstat(name string) (fs.FileInfo, error) {
+	_, info, err := s.findWith("lstat", name, Lstat)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// Sub implements fs.SubFS interface.
+func (s *UnionFS) Sub(dir string) (fs.FS, error) {
+	return newSubFS(s, dir)
+}
+
+// Layers returns filesystems in the order of precedence.
+func (s *UnionFS) Layers() []fs.FS {
+	return append([]fs.FS(nil), s.layers...)
+}
+
+// find returns the index of the first layer that has the named file and its
+// file info.
+func (s *UnionFS) find(op, name string) (int, fs.FileInfo, error) {
+	return s.findWith(op, name, fs.Stat)
+}
+
+// findWith is find with the function that returns the file info, so that
+// symbolic links can be found without following them.
+func (s *UnionFS) findWith(op, name string, stat func(fsys fs.FS, name string) (fs.FileInfo, error)) (int, fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return 0, nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	for i, fsys := range s.layers {
+		info, err := stat(fsys, name)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return 0, nil, &fs.PathError{Op: op, Path: name, Err: unwrapPathError(err)}
+		}
+		if i > 0 {
+			hidden, err := s.hidden(i, name)
+			if err != nil {
+				return 0, nil, &fs.PathError{Op: op, Path: name, Err: unwrapPathError(err)}
+			}
+			if hidden {
+				break
+			}
+		}
+		return i, info, nil
+	}
+	return 0, nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+}
+
+// hidden reports whether any parent directory of the named file is a file in
+// one of the layers before the layer with the index i.
+func (s *UnionFS) hidden(i int, name string) (bool, error) {
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		for _, fsys := range s.layers[:i] {
+			info, err := fs.Stat(fsys, dir)
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					continue
+				}
+				return false, err
+			}
+			if !info.IsDir() {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// readDir merges sorted entries of the named directory from the layer with
+// the index i and the following layers where it is a directory.
+func (s *UnionFS) readDir(i int, name string) ([]fs.DirEntry, error) {
+	var entries []fs.DirEntry
+	seen := make(map[string]struct{})
+	for _, fsys := range s.layers[i:] {
+		info, err := fs.Stat(fsys, name)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, &fs.PathError{Op: "readdir", Path: name, Err: unwrapPathError(err)}
+		}
+		if !info.IsDir() {
+			continue
+		}
+		layerEntries, err := fs.ReadDir(fsys, name)
+		if err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: name, Err: unwrapPathError(err)}
+		}
+		for _, e := range layerEntries {
+			if _, ok := seen[e.Name()]; ok {
+				continue
+			}
+			seen[e.Name()] = struct{}{}
+			entries = append(entries, e)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"resenje.org/fsutil"
+)
+
+func TestUnionFS(t *testing.T) {
+	theme := fsutil.MapFS{
+		"index.html":        {Data: []byte("<html>theme")},
+		"css/app.css":       {Data: []byte("body{color:red}")},
+		"css/theme.css":     {Data: []byte(".theme{}")},
+		"img":               {Data: []byte("not a directory")},
+		"fonts/sans/a.woff": {Data: []byte("a")},
+	}
+	base := fsutil.MapFS{
+		"index.html":        {Data: []byte("<html>base")},
+		"css/app.css":       {Data: []byte("body{}")},
+		"css/reset.css":     {Data: []byte("*{margin:0}")},
+		"img/logo.svg":      {Data: []byte("<svg>")},
+		"fonts/sans/b.woff": {Data: []byte("b")},
+		"robots.txt":        {Data: []byte("User-agent: *")},
+	}
+	fsys := fsutil.NewUnionFS(theme, base)
+
+	if err := fstest.TestFS(fsys, "index.html", "css/app.css", "css/theme.css", "css/reset.css", "img", "fonts/sans/a.woff", "fonts/sans/b.woff", "robots.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	testOpen(t, fsys, "index.html", "<html>theme")
+	testReadFile(t, fsys, "css/app.css", "body{color:red}")
+	testReadFile(t, fsys, "css/reset.css", "*{margin:0}")
+	testReadFile(t, fsys, "robots.txt", "User-agent: *")
+	testReadFile(t, fsys, "img", "not a directory")
+	testOpenNotExist(t, fsys, "img/logo.svg")
+	testReadFileNotExist(t, fsys, "missing.txt")
+	testStatNotExist(t, fsys, "css/missing.css")
+	testGlob(t, fsys, "css/*.css", []string{"css/app.css", "css/reset.css", "css/theme.css"})
+	testGlob(t, fsys, "fonts/sans/*", []string{"fonts/sans/a.woff", "fonts/sans/b.woff"})
+
+	if got := len(fsys.Layers()); got != 2 {
+		t.Errorf("got %v layers, want 2", got)
+	}
+}
+
+func TestUnionFS_error(t *testing.T) {
+	base := fsutil.MapFS{
+		"index.html": {Data: []byte("<html>")},
+	}
+	faulty := fsutil.FSFunc(func(name string) (fs.File, error) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errTest1}
+	})
+	fsys := fsutil.NewUnionFS(faulty, base)
+
+	if _, err := fsys.Open("index.html"); !errors.Is(err, errTest1) {
+		t.Errorf("got error %v, want %v", err, errTest1)
+	}
+	if _, err := fsys.Open("../index.html"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("got error %v, want %v", err, fs.ErrInvalid)
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"fmt"
+	"io/fs"
+)
+
+var (
+	_ fs.FS         = (*VersionPinFS)(nil)
+	_ fs.GlobFS     = (*VersionPinFS)(nil)
+	_ fs.ReadDirFS  = (*VersionPinFS)(nil)
+	_ fs.ReadFileFS = (*VersionPinFS)(nil)
+	_ fs.StatFS     = (*VersionPinFS)(nil)
+	_ fs.SubFS      = (*VersionPinFS)(nil)
+	_ ReadLinkFS    = (*VersionPinFS)(nil)
+)
+
+// VersionPinFS is a filesystem with the directory structure captured at its
+// construction. Directory listings, including the ones used by Glob and
+// WalkDir, always return the captured entries, so that scans that take long
+// time or that read directories in multiple batches see a consistent state,
+// even if files are added or removed in the meantime. Only the structure is
+// captured, the content and file infos of files are read from the underlying
+// filesystem, and files that are removed after the construction do not
+// exist, even if they are listed. Captured directories exist even if they are
+// removed, while directories created after the construction are listed as in
+// the underlying filesystem. To capture the content as well, use Snapshot.
+type VersionPinFS struct {
+	fsys fs.FS
+	dirs map[string]pinnedDir
+}
+
+type pinnedDir struct {
+	info    fs.FileInfo
+	entries []fs.DirEntry
+}
+
+// NewVersionPinFS returns a new instance of VersionPinFS with all directories
+// of the filesystem read.
+func NewVersionPinFS(fsys fs.FS) (*VersionPinFS, error) {
+	dirs := make(map[string]pinnedDir)
+	if err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return fmt.Errorf("file info %s: %w", path, err)
+		}
+		entries, err := fs.ReadDir(fsys, path)
+		if err != nil {
+			return fmt.Errorf("read directory %s: %w", path, err)
+		}
+		dirs[path] = pinnedDir{
+			info:    info,
+			entries: entries,
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("pin directories: %w", err)
+	}
+	return &VersionPinFS{
+		fsys: fsys,
+		dirs: dirs,
+	}, nil
+}
+
+// Open implements fs.FS interface.
+func (s *VersionPinFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if d, ok := s.dirs[name]; ok {
+		return newMemDir(name, d.info, d.entries), nil
+	}
+	return s.fsys.Open(name)
+}
+
+// Glob implements fs.GlobFS interface.
+func (s *VersionPinFS) Glob(pattern string) ([]string, error) {
+	return fs.Glob(readDirFS{FSFunc: s.Open, readDir: s.ReadDir}, pattern)
+}
+
+// ReadDir implements fs.ReadDirFS interface.
+func (s *VersionPinFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if d, ok := s.dirs[name]; ok {
+		entries := make([]fs.DirEntry, len(d.entries))
+		copy(entries, d.entries)
+		return entries, nil
+	}
+	return fs.ReadDir(s.fsys, name)
+}
+
+// ReadFile implements fs.ReadFileFS interface.
+func (s *VersionPinFS) ReadFile(name string) ([]byte, error) {
+	if _, ok := s.dirs[name]; ok {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: errIsDir}
+	}
+	return fs.ReadFile(s.fsys, name)
+}
+
+// Stat implements fs.StatFS interface.
+func (s *VersionPinFS) Stat(name string) (fs.FileInfo, error) {
+	if d, ok := s.dirs[name]; ok {
+		return d.info, nil
+	}
+	return fs.Stat(s.fsys, name)
+}
+
+// ReadLink implements ReadLinkFS interface.
+func (s *VersionPinFS) ReadLink(name string) (string, error) {
+	return ReadLink(s.fsys, name)
+}
+
+// Lstat implements ReadLinkFS interface.
+func (s *VersionPinFS) Lstat(name string) (fs.FileInfo, error) {
+	if d, ok := s.dirs[name]; ok {
+		return d.info, nil
+	}
+	return Lstat(s.fsys, name)
+}
+
+// Sub implements fs.SubFS interface.
+func (s *VersionPinFS) Sub(dir string) (fs.FS, error) {
+	return newSubFS(s, dir)
+}
+
+// Unwrap returns the underlying filesystem.
+func (s *VersionPinFS) Unwrap() fs.FS {
+	return s.fsys
+}
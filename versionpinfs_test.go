@@ -0,0 +1,119 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"resenje.org/fsutil"
+)
+
+func TestVersionPinFS(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "c.txt", "sub/d.txt"} {
+		writeTestFile(t, filepath.Join(dir, name), name)
+	}
+
+	fsys, err := fsutil.NewVersionPinFS(os.DirFS(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fstest.TestFS(fsys, "a.txt", "b.txt", "c.txt", "sub/d.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := fsys.Open(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	first, err := d.(fs.ReadDirFile).ReadDir(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// change the directory structure in the middle of the listing
+	if err := os.Remove(filepath.Join(dir, "a.txt")); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(dir, "0.txt"), "0.txt")
+	writeTestFile(t, filepath.Join(dir, "sub/e.txt"), "sub/e.txt")
+	if err := os.RemoveAll(filepath.Join(dir, "sub")); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(dir, "new/f.txt"), "new/f.txt")
+
+	rest, err := d.(fs.ReadDirFile).ReadDir(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := dirEntryNames(append(first, rest...)), []string{"a.txt", "b.txt", "c.txt", "sub"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got entries %v, want %v", got, want)
+	}
+
+	testReadDirNames(t, fsys, ".", "a.txt", "b.txt", "c.txt", "sub")
+	testReadDirNames(t, fsys, "sub", "d.txt")
+	testReadDirNames(t, fsys, "new", "f.txt")
+
+	matches, err := fsys.Glob("*/*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"sub/d.txt"}; !reflect.DeepEqual(matches, want) {
+		t.Errorf("got glob %v, want %v", matches, want)
+	}
+
+	// content is not pinned
+	testReadFile(t, fsys, "b.txt", "b.txt")
+	testReadFile(t, fsys, "0.txt", "0.txt")
+	if _, err := fsys.Open("a.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got error %v, want %v", err, fs.ErrNotExist)
+	}
+
+	info, err := fsys.Stat("sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.IsDir() {
+		t.Error("pinned directory is not a directory")
+	}
+	if _, err := fsys.ReadFile("sub"); err == nil {
+		t.Error("expected error reading a directory")
+	}
+}
+
+func TestVersionPinFS_walkError(t *testing.T) {
+	_, err := fsutil.NewVersionPinFS(os.DirFS(filepath.Join(t.TempDir(), "missing")))
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got error %v, want %v", err, fs.ErrNotExist)
+	}
+}
+
+func dirEntryNames(entries []fs.DirEntry) []string {
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func writeTestFile(t *testing.T, name, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(name), 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(content), 0o666); err != nil {
+		t.Fatal(err)
+	}
+}
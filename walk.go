@@ -0,0 +1,129 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"context"
+	"io/fs"
+	"sort"
+	"sync"
+)
+
+// WalkFileFunc is the type of the function called by WalkFilesConcurrent for
+// every file that is not a directory.
+type WalkFileFunc func(ctx context.Context, path string, d fs.DirEntry) error
+
+// WalkError is returned by WalkFilesConcurrent and it contains errors returned
+// by WalkFileFunc in the order in which files are walked.
+type WalkError struct {
+	Files []WalkFileError
+}
+
+// WalkFileError is an error returned by WalkFileFunc for a file.
+type WalkFileError struct {
+	Path string
+	Err  error
+}
+
+// Error implements error interface.
+func (e *WalkError) Error() string {
+	return e.fileErrors().message("walk files failed for ")
+}
+
+// Is reports whether an error of any file matches the target.
+func (e *WalkError) Is(target error) bool {
+	return e.fileErrors().is(target)
+}
+
+// As finds the first error of a file that matches the target.
+func (e *WalkError) As(target interface{}) bool {
+	return e.fileErrors().as(target)
+}
+
+func (e *WalkError) fileErrors() fileErrors {
+	errs := make(fileErrors, 0, len(e.Files))
+	for _, f := range e.Files {
+		errs = append(errs, fileError(f))
+	}
+	return errs
+}
+
+// WalkFilesConcurrent walks the file tree of the filesystem in lexical order
+// and calls fn for every file that is not a directory from a number of
+// concurrent workers. All files are walked even if fn returns an error for some
+// of them, and all errors are returned as *WalkError, ordered as files are
+// walked. If the directory tree can not be read or the context is canceled,
+// walking stops and that error is returned.
+func WalkFilesConcurrent(ctx context.Context, fsys fs.FS, workers int, fn WalkFileFunc) error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	type job struct {
+		index int
+		path  string
+		d     fs.DirEntry
+	}
+	type indexedError struct {
+		index int
+		err   WalkFileError
+	}
+
+	jobs := make(chan job)
+	var errs []indexedError
+	var errsMu sync.Mutex
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if err := fn(ctx, j.path, j.d); err != nil {
+					errsMu.Lock()
+					errs = append(errs, indexedError{index: j.index, err: WalkFileError{Path: j.path, Err: err}})
+					errsMu.Unlock()
+				}
+			}
+		}()
+	}
+
+	var n int
+	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		select {
+		case jobs <- job{index: n, path: path, d: d}:
+			n++
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	close(jobs)
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].index < errs[j].index
+	})
+	werr := &WalkError{Files: make([]WalkFileError, 0, len(errs))}
+	for _, e := range errs {
+		werr.Files = append(werr.Files, e.err)
+	}
+	return werr
+}
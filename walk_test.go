@@ -0,0 +1,92 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"resenje.org/fsutil"
+)
+
+func TestWalkFilesConcurrent(t *testing.T) {
+	fsys := make(fstest.MapFS)
+	var want []string
+	for i := 0; i < 100; i++ {
+		name := fmt.Sprintf("dir%d/file%02d.txt", i%7, i)
+		fsys[name] = &fstest.MapFile{Data: []byte(name)}
+		want = append(want, name)
+	}
+	sort.Strings(want)
+
+	var got []string
+	var mu sync.Mutex
+	err := fsutil.WalkFilesConcurrent(context.Background(), fsys, 8, func(_ context.Context, path string, d fs.DirEntry) error {
+		if d.IsDir() {
+			t.Errorf("got directory %q", path)
+		}
+		mu.Lock()
+		got = append(got, path)
+		mu.Unlock()
+		if strings.HasSuffix(path, "3.txt") {
+			return errTest1
+		}
+		return nil
+	})
+
+	var werr *fsutil.WalkError
+	if !errors.As(err, &werr) {
+		t.Fatalf("got error %v, want walk error", err)
+	}
+	var wantErrPaths []string
+	for _, name := range want {
+		if strings.HasSuffix(name, "3.txt") {
+			wantErrPaths = append(wantErrPaths, name)
+		}
+	}
+	var gotErrPaths []string
+	for _, f := range werr.Files {
+		if !errors.Is(f.Err, errTest1) {
+			t.Errorf("got error %v for file %q, want %v", f.Err, f.Path, errTest1)
+		}
+		gotErrPaths = append(gotErrPaths, f.Path)
+	}
+	if fmt.Sprint(gotErrPaths) != fmt.Sprint(wantErrPaths) {
+		t.Errorf("got error paths %v, want %v", gotErrPaths, wantErrPaths)
+	}
+	if !errors.Is(err, errTest1) {
+		t.Errorf("error %v is not %v", err, errTest1)
+	}
+
+	sort.Strings(got)
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got files %v, want %v", got, want)
+	}
+}
+
+func TestWalkFilesConcurrent_canceled(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.txt": {},
+		"b.txt": {},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := fsutil.WalkFilesConcurrent(ctx, fsys, 1, func(context.Context, string, fs.DirEntry) error {
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+}
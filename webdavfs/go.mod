@@ -0,0 +1,10 @@
+module resenje.org/fsutil/webdavfs
+
+go 1.16
+
+require (
+	golang.org/x/net v0.12.0
+	resenje.org/fsutil v0.0.0-00010101000000-000000000000
+)
+
+replace resenje.org/fsutil => ../
@@ -0,0 +1,354 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package webdavfs provides a webdav.FileSystem over a filesystem, so that it
+// can be browsed and edited remotely with a WebDAV client by serving it with
+// webdav.Handler. Filesystems are read-only, unless they implement writable
+// interfaces of the fsutil package. It is separated from the fsutil package
+// in order to keep the golang.org/x/net dependency out of it.
+package webdavfs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/webdav"
+
+	"resenje.org/fsutil"
+)
+
+var (
+	_ webdav.FileSystem = (*FS)(nil)
+	_ webdav.File       = (*file)(nil)
+	_ webdav.File       = (*writeFile)(nil)
+)
+
+// FS is a webdav.FileSystem that modifies the filesystem only through the
+// writable interfaces that it implements:
+//
+//   - fsutil.WriteFileFS for creating and writing files,
+//   - fsutil.MkdirAllFS for creating directories,
+//   - fsutil.RemoveFS for removing files and directories,
+//   - all of them for renaming, which copies files and removes the old ones.
+//
+// Methods that need an interface that the filesystem does not implement
+// return an error that matches fs.ErrPermission.
+type FS struct {
+	fsys fs.FS
+	hfs  http.FileSystem
+}
+
+// New returns a new webdav.FileSystem with files from the filesystem. Opened
+// files support seeking even if the files of the filesystem do not implement
+// io.Seeker, as it is required by webdav.Handler. Files opened for writing
+// are kept in memory and written to the filesystem when they are closed.
+func New(fsys fs.FS) *FS {
+	return &FS{
+		fsys: fsys,
+		hfs:  fsutil.ToHTTPFileSystem(fsys),
+	}
+}
+
+// Mkdir implements webdav.FileSystem interface. The parent directory must
+// exist.
+func (s *FS) Mkdir(_ context.Context, name string, perm os.FileMode) error {
+	m, ok := s.fsys.(fsutil.MkdirAllFS)
+	if !ok {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrPermission}
+	}
+	p := fsName(name)
+	if _, err := fs.Stat(s.fsys, p); err == nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+	if dir := path.Dir(p); dir != "." {
+		info, err := fs.Stat(s.fsys, dir)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrNotExist}
+		}
+	}
+	return m.MkdirAll(p, perm)
+}
+
+// OpenFile implements webdav.FileSystem interface. Files can be opened for
+// writing only if the filesystem implements fsutil.WriteFileFS.
+func (s *FS) OpenFile(_ context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) == 0 {
+		f, err := s.hfs.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		return &file{File: f, name: name}, nil
+	}
+
+	w, ok := s.fsys.(fsutil.WriteFileFS)
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	p := fsName(name)
+	info, err := fs.Stat(s.fsys, p)
+	switch {
+	case err == nil:
+		if flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0 {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+		}
+		if info.IsDir() {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: errIsDir}
+		}
+		perm = info.Mode().Perm()
+	case errors.Is(err, fs.ErrNotExist) && flag&os.O_CREATE != 0:
+	default:
+		return nil, err
+	}
+
+	f := &writeFile{
+		name:    p,
+		fsys:    w,
+		perm:    perm,
+		append:  flag&os.O_APPEND != 0,
+		modTime: time.Now(),
+	}
+	if info != nil && flag&os.O_TRUNC == 0 {
+		f.data, err = fs.ReadFile(s.fsys, p)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// RemoveAll implements webdav.FileSystem interface. Directories are removed
+// with all their files. It does not return an error if the file does not
+// exist.
+func (s *FS) RemoveAll(_ context.Context, name string) error {
+	r, ok := s.fsys.(fsutil.RemoveFS)
+	if !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrPermission}
+	}
+	p := fsName(name)
+	if p == "." {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+	}
+
+	// Paths are collected before removing files, so that directories are not
+	// modified while they are walked, and removed in the reverse order, so
+	// that directories are empty when they are removed.
+	var paths []string
+	if err := fs.WalkDir(s.fsys, p, func(path string, _ fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		paths = append(paths, path)
+		return nil
+	}); err != nil {
+		if errors.Is(err, fs.ErrNotExist) && len(paths) == 0 {
+			return nil
+		}
+		return err
+	}
+	for i := len(paths) - 1; i >= 0; i-- {
+		if err := r.Remove(paths[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rename implements webdav.FileSystem interface. Files are copied to the new
+// location and removed from the old one, as the writable interfaces of the
+// fsutil package have no method for renaming. The filesystem must implement
+// fsutil.WriteFileFS, fsutil.RemoveFS and fsutil.MkdirAllFS.
+func (s *FS) Rename(ctx context.Context, oldName, newName string) error {
+	w, ok1 := s.fsys.(fsutil.WriteFileFS)
+	m, ok2 := s.fsys.(fsutil.MkdirAllFS)
+	_, ok3 := s.fsys.(fsutil.RemoveFS)
+	if !ok1 || !ok2 || !ok3 {
+		return &fs.PathError{Op: "rename", Path: oldName, Err: fs.ErrPermission}
+	}
+	op, np := fsName(oldName), fsName(newName)
+	if op == "." || np == "." || np == op || strings.HasPrefix(np, op+"/") {
+		return &fs.PathError{Op: "rename", Path: oldName, Err: fs.ErrInvalid}
+	}
+
+	if err := fs.WalkDir(s.fsys, op, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		target := np + strings.TrimPrefix(p, op)
+		if d.IsDir() {
+			return m.MkdirAll(target, info.Mode().Perm())
+		}
+		data, err := fs.ReadFile(s.fsys, p)
+		if err != nil {
+			return err
+		}
+		return w.WriteFile(target, data, info.Mode().Perm())
+	}); err != nil {
+		return err
+	}
+	return s.RemoveAll(ctx, oldName)
+}
+
+// Stat implements webdav.FileSystem interface.
+func (s *FS) Stat(_ context.Context, name string) (os.FileInfo, error) {
+	f, err := s.hfs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return f.Stat()
+}
+
+// file is a read-only webdav.File.
+type file struct {
+	http.File
+	name string
+}
+
+func (f *file) Write([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "write", Path: f.name, Err: fs.ErrPermission}
+}
+
+// writeFile is a webdav.File opened for writing. Its content is kept in memory
+// and written to the filesystem when it is closed.
+type writeFile struct {
+	name    string
+	fsys    fsutil.WriteFileFS
+	perm    fs.FileMode
+	append  bool
+	data    []byte
+	offset  int64
+	modTime time.Time
+	closed  bool
+	mu      sync.Mutex
+}
+
+func (f *writeFile) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrClosed}
+	}
+	if f.offset >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.data[f.offset:])
+	f.offset += int64(n)
+	return n, nil
+}
+
+func (f *writeFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, &fs.PathError{Op: "write", Path: f.name, Err: fs.ErrClosed}
+	}
+	if f.append {
+		f.offset = int64(len(f.data))
+	}
+	if end := f.offset + int64(len(p)); end > int64(len(f.data)) {
+		data := make([]byte, end)
+		copy(data, f.data)
+		f.data = data
+	}
+	n := copy(f.data[f.offset:], p)
+	f.offset += int64(n)
+	f.modTime = time.Now()
+	return n, nil
+}
+
+func (f *writeFile) Seek(offset int64, whence int) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += int64(len(f.data))
+	default:
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *writeFile) Readdir(int) ([]fs.FileInfo, error) {
+	return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: errNotDir}
+}
+
+func (f *writeFile) Stat() (fs.FileInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return &writeFileInfo{
+		name:    path.Base(f.name),
+		size:    int64(len(f.data)),
+		mode:    f.perm,
+		modTime: f.modTime,
+	}, nil
+}
+
+// Close writes the content of the file to the filesystem.
+func (f *writeFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	return f.fsys.WriteFile(f.name, f.data, f.perm)
+}
+
+type writeFileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (i *writeFileInfo) Name() string       { return i.name }
+func (i *writeFileInfo) Size() int64        { return i.size }
+func (i *writeFileInfo) Mode() fs.FileMode  { return i.mode }
+func (i *writeFileInfo) ModTime() time.Time { return i.modTime }
+func (i *writeFileInfo) IsDir() bool        { return false }
+func (i *writeFileInfo) Sys() interface{}   { return nil }
+
+var (
+	errIsDir  = errors.New("is a directory")
+	errNotDir = errors.New("not a directory")
+)
+
+// fsName converts the slash-separated name used by webdav.Handler to the name
+// of the file in the filesystem.
+func fsName(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
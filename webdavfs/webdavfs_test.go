@@ -0,0 +1,152 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webdavfs_test
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/webdav"
+
+	"resenje.org/fsutil"
+	"resenje.org/fsutil/webdavfs"
+)
+
+func TestFS(t *testing.T) {
+	fsys := webdavfs.New(fsutil.MapFS{
+		"index.html":  {Data: []byte("<html>")},
+		"css/app.css": {Data: []byte("body{}")},
+	})
+	handler := &webdav.Handler{
+		FileSystem: fsys,
+		LockSystem: webdav.NewMemLS(),
+	}
+
+	t.Run("get", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/css/app.css", nil))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("got status %v, want %v", w.Code, http.StatusOK)
+		}
+		if got, want := w.Body.String(), "body{}"; got != want {
+			t.Errorf("got body %q, want %q", got, want)
+		}
+	})
+
+	t.Run("propfind", func(t *testing.T) {
+		r := httptest.NewRequest("PROPFIND", "/", nil)
+		r.Header.Set("Depth", "1")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != http.StatusMultiStatus {
+			t.Fatalf("got status %v, want %v", w.Code, http.StatusMultiStatus)
+		}
+		for _, href := range []string{"/index.html", "/css/"} {
+			if !strings.Contains(w.Body.String(), "<D:href>"+href+"</D:href>") {
+				t.Errorf("href %q not found in response %s", href, w.Body.String())
+			}
+		}
+	})
+
+	t.Run("read only", func(t *testing.T) {
+		ctx := context.Background()
+
+		if _, err := fsys.OpenFile(ctx, "/new.txt", os.O_RDWR|os.O_CREATE, 0o644); !errors.Is(err, fs.ErrPermission) {
+			t.Errorf("got open error %v, want %v", err, fs.ErrPermission)
+		}
+		if err := fsys.Mkdir(ctx, "/dir", 0o755); !errors.Is(err, fs.ErrPermission) {
+			t.Errorf("got mkdir error %v, want %v", err, fs.ErrPermission)
+		}
+		if err := fsys.RemoveAll(ctx, "/index.html"); !errors.Is(err, fs.ErrPermission) {
+			t.Errorf("got remove error %v, want %v", err, fs.ErrPermission)
+		}
+		if err := fsys.Rename(ctx, "/index.html", "/main.html"); !errors.Is(err, fs.ErrPermission) {
+			t.Errorf("got rename error %v, want %v", err, fs.ErrPermission)
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/index.html", strings.NewReader("x")))
+		if w.Code < 400 {
+			t.Errorf("got status %v for put, want error", w.Code)
+		}
+	})
+
+	t.Run("stat not exist", func(t *testing.T) {
+		if _, err := fsys.Stat(context.Background(), "/missing.html"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("got error %v, want %v", err, fs.ErrNotExist)
+		}
+	})
+}
+
+func TestFS_writable(t *testing.T) {
+	tempFS, err := fsutil.NewTempFS(context.Background(), fsutil.WithTempFSDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tempFS.Close()
+
+	handler := &webdav.Handler{
+		FileSystem: webdavfs.New(tempFS),
+		LockSystem: webdav.NewMemLS(),
+	}
+	serve := func(t *testing.T, method, target, body string, header http.Header, wantCode int) {
+		t.Helper()
+
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		for k, v := range header {
+			r.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != wantCode {
+			t.Fatalf("%s %s: got status %v, want %v", method, target, w.Code, wantCode)
+		}
+	}
+
+	serve(t, "MKCOL", "/dir", "", nil, http.StatusCreated)
+	serve(t, "MKCOL", "/missing/dir", "", nil, http.StatusConflict)
+	serve(t, http.MethodPut, "/dir/a.txt", "data", nil, http.StatusCreated)
+	serve(t, http.MethodPut, "/dir/a.txt", "new data", nil, http.StatusCreated)
+
+	data, err := fs.ReadFile(tempFS, "dir/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "new data" {
+		t.Errorf("got data %q, want %q", data, "new data")
+	}
+
+	serve(t, "MOVE", "/dir", "", http.Header{"Destination": {"http://example.com/moved"}}, http.StatusCreated)
+
+	if _, err := fs.Stat(tempFS, "dir"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got stat error %v, want %v", err, fs.ErrNotExist)
+	}
+	data, err = fs.ReadFile(tempFS, "moved/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "new data" {
+		t.Errorf("got data %q, want %q", data, "new data")
+	}
+
+	serve(t, http.MethodDelete, "/moved", "", nil, http.StatusNoContent)
+
+	entries, err := fs.ReadDir(tempFS, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("got %v entries, want none", len(entries))
+	}
+}
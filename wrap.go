@@ -0,0 +1,85 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"io"
+	"io/fs"
+	"reflect"
+)
+
+// Unwrap returns the result of calling the Unwrap method on fsys, if its type
+// contains an Unwrap method returning fs.FS. Otherwise, Unwrap returns nil.
+// All filesystems in this package that wrap a single filesystem implement the
+// Unwrap method, so that optional interfaces and methods of filesystems in the
+// chain of wrappers, such as HashedPath of HashFS, can be discovered with As.
+func Unwrap(fsys fs.FS) fs.FS {
+	u, ok := fsys.(interface {
+		Unwrap() fs.FS
+	})
+	if !ok {
+		return nil
+	}
+	return u.Unwrap()
+}
+
+// As finds the first filesystem in the chain of fsys and its underlying
+// filesystems returned by Unwrap that matches target, and if so, sets target
+// to that filesystem and returns true. Otherwise, it returns false. A
+// filesystem matches target if it is assignable to the value pointed to by
+// target, in the same way as errors.As matches errors.
+//
+// As panics if target is not a non-nil pointer to either a type that
+// implements fs.FS, or to any interface type.
+func As(fsys fs.FS, target interface{}) bool {
+	if target == nil {
+		panic("fsutil: target cannot be nil")
+	}
+	val := reflect.ValueOf(target)
+	typ := val.Type()
+	if typ.Kind() != reflect.Ptr || val.IsNil() {
+		panic("fsutil: target must be a non-nil pointer")
+	}
+	targetType := typ.Elem()
+	if targetType.Kind() != reflect.Interface && !targetType.Implements(fsType) {
+		panic("fsutil: *target must be interface or implement fs.FS")
+	}
+	for fsys != nil {
+		if reflect.TypeOf(fsys).AssignableTo(targetType) {
+			val.Elem().Set(reflect.ValueOf(fsys))
+			return true
+		}
+		fsys = Unwrap(fsys)
+	}
+	return false
+}
+
+var fsType = reflect.TypeOf((*fs.FS)(nil)).Elem()
+
+// wrappedFile is embedded in files of wrapper filesystems to forward the
+// ReadDir and Seek methods to the underlying file, returning errors if the
+// underlying file does not implement them. Wrappers override the methods
+// whose results they change.
+type wrappedFile struct {
+	fs.File
+	name string
+}
+
+func (f *wrappedFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	dir, ok := f.File.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: errNotDir}
+	}
+	return dir.ReadDir(n)
+}
+
+func (f *wrappedFile) Seek(offset int64, whence int) (int64, error) {
+	s, ok := f.File.(io.Seeker)
+	if !ok {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: ErrNotSeekable}
+	}
+	return s.Seek(offset, whence)
+}
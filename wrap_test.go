@@ -0,0 +1,76 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"io/fs"
+	"testing"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestUnwrap(t *testing.T) {
+	files := fsutil.MapFS{
+		"app.css": {Data: []byte("body{}")},
+	}
+	hfs := fsutil.NewHashFS(files, fsutil.NewMD5Hasher(8))
+	mfs := fsutil.ModTimeFS(hfs, time.Date(2021, 8, 9, 10, 11, 12, 0, time.UTC))
+	cfs := fsutil.NewCountingFS(mfs)
+
+	if got := fsutil.Unwrap(cfs); got != mfs {
+		t.Errorf("got %v, want %v", got, mfs)
+	}
+	if got := fsutil.Unwrap(mfs); got != hfs {
+		t.Errorf("got %v, want %v", got, hfs)
+	}
+	if got := fsutil.Unwrap(files); got != nil {
+		t.Errorf("got %v, want nil", got)
+	}
+
+	var gotHFS *fsutil.HashFS
+	if !fsutil.As(cfs, &gotHFS) {
+		t.Fatal("hash filesystem not found")
+	}
+	if gotHFS != hfs {
+		t.Errorf("got %v, want %v", gotHFS, hfs)
+	}
+	hashedPath, err := gotHFS.HashedPath("app.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat(cfs, hashedPath); err != nil {
+		t.Error(err)
+	}
+
+	var gotGlobFS fs.GlobFS
+	if !fsutil.As(cfs, &gotGlobFS) {
+		t.Fatal("glob filesystem not found")
+	}
+	if gotGlobFS != cfs {
+		t.Errorf("got %v, want %v", gotGlobFS, cfs)
+	}
+
+	var gotQFS *fsutil.QuotaFS
+	if fsutil.As(cfs, &gotQFS) {
+		t.Errorf("got %v, want not found", gotQFS)
+	}
+
+	t.Run("lazy", func(t *testing.T) {
+		lfs := fsutil.LazyFS(func() (fs.FS, error) {
+			return hfs, nil
+		})
+		if got := fsutil.Unwrap(lfs); got != nil {
+			t.Errorf("got %v before initialization, want nil", got)
+		}
+		if _, err := fs.Stat(lfs, "."); err != nil {
+			t.Fatal(err)
+		}
+		if got := fsutil.Unwrap(lfs); got != hfs {
+			t.Errorf("got %v, want %v", got, hfs)
+		}
+	})
+}
@@ -0,0 +1,39 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"io/fs"
+)
+
+// WriteFileFS is the interface implemented by a filesystem that can write
+// files, such as TempFS.
+type WriteFileFS interface {
+	fs.FS
+
+	// WriteFile writes data to the named file, creating it with permissions
+	// perm if necessary, and truncating it if it exists.
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+}
+
+// RemoveFS is the interface implemented by a filesystem that can remove
+// files.
+type RemoveFS interface {
+	fs.FS
+
+	// Remove removes the named file or an empty directory.
+	Remove(name string) error
+}
+
+// MkdirAllFS is the interface implemented by a filesystem that can create
+// directories.
+type MkdirAllFS interface {
+	fs.FS
+
+	// MkdirAll creates a directory with permissions perm and all parent
+	// directories that do not exist.
+	MkdirAll(name string, perm fs.FileMode) error
+}
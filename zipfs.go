@@ -0,0 +1,268 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil
+
+import (
+	"archive/zip"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+)
+
+var (
+	_ fs.FS         = (*zipFS)(nil)
+	_ fs.GlobFS     = (*zipFS)(nil)
+	_ fs.ReadDirFS  = (*zipFS)(nil)
+	_ fs.ReadFileFS = (*zipFS)(nil)
+	_ fs.StatFS     = (*zipFS)(nil)
+)
+
+// ZipFSOption is used to provide optional parameters to ZipFS function.
+type ZipFSOption func(*zipFSOptions)
+
+type zipFSOptions struct {
+	cacheMaxFileSize int64
+}
+
+// WithZipContentCache keeps the decompressed content of files in memory after
+// they are read for the first time, for files that are not larger than
+// maxFileSize bytes. By default, the content is decompressed on every read.
+func WithZipContentCache(maxFileSize int64) ZipFSOption {
+	return func(o *zipFSOptions) {
+		o.cacheMaxFileSize = maxFileSize
+	}
+}
+
+// ZipFS returns a read-only filesystem with files from the zip archive read
+// from r, which has the size in bytes. The central directory of the archive is
+// read and indexed on the first use of the filesystem, and the error, if any,
+// is returned for all calls.
+//
+// Parent directories of files that are not explicitly present in the archive
+// are included with 0o555 permissions and a zero modification time. Entries
+// with names that are not valid fs.FS paths are ignored. Files that are
+// stored without compression implement io.Seeker and io.ReaderAt.
+func ZipFS(r io.ReaderAt, size int64, opts ...ZipFSOption) fs.FS {
+	var o zipFSOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &zipFS{
+		r:     r,
+		size:  size,
+		o:     o,
+		cache: make(map[string][]byte),
+	}
+}
+
+type zipFS struct {
+	r    io.ReaderAt
+	size int64
+	o    zipFSOptions
+
+	index   *archiveIndex
+	files   map[string]*zip.File
+	err     error
+	indexMu sync.Mutex
+
+	cache   map[string][]byte
+	cacheMu sync.RWMutex
+}
+
+func (s *zipFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	index, err := s.getIndex()
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if d, ok := index.dirs[name]; ok {
+		return newMemDir(name, d.info, d.entries), nil
+	}
+	info, ok := index.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	f := s.files[name]
+	if data, ok := s.cached(name, info); ok {
+		return newMemFile(name, info, data), nil
+	}
+	if s.cacheable(info) {
+		data, err := s.read(name, f, info)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		return newMemFile(name, info, data), nil
+	}
+	if f.Method == zip.Store {
+		offset, err := f.DataOffset()
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		return &sectionFile{
+			SectionReader: io.NewSectionReader(s.r, offset, int64(f.CompressedSize64)),
+			info:          info,
+		}, nil
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &zipFile{
+		ReadCloser: rc,
+		info:       info,
+	}, nil
+}
+
+func (s *zipFS) Glob(pattern string) ([]string, error) {
+	// FSFunc hides the Glob method to avoid recursion.
+	return fs.Glob(FSFunc(s.Open), pattern)
+}
+
+func (s *zipFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	index, err := s.getIndex()
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	return index.readDir(name)
+}
+
+func (s *zipFS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+	index, err := s.getIndex()
+	if err != nil {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: err}
+	}
+	info, ok := index.files[name]
+	if !ok {
+		if _, ok := index.dirs[name]; ok {
+			return nil, &fs.PathError{Op: "readfile", Path: name, Err: errIsDir}
+		}
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrNotExist}
+	}
+	data, ok := s.cached(name, info)
+	if !ok {
+		data, err = s.read(name, s.files[name], info)
+		if err != nil {
+			return nil, &fs.PathError{Op: "readfile", Path: name, Err: err}
+		}
+	}
+	b := make([]byte, len(data))
+	copy(b, data)
+	return b, nil
+}
+
+func (s *zipFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	index, err := s.getIndex()
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return index.stat(name)
+}
+
+// cacheable reports whether the content of the file should be cached.
+func (s *zipFS) cacheable(info *memFileInfo) bool {
+	return s.o.cacheMaxFileSize > 0 && info.size <= s.o.cacheMaxFileSize
+}
+
+// cached returns the cached content of the file, if it is cached.
+func (s *zipFS) cached(name string, info *memFileInfo) ([]byte, bool) {
+	if !s.cacheable(info) {
+		return nil, false
+	}
+	s.cacheMu.RLock()
+	defer s.cacheMu.RUnlock()
+
+	data, ok := s.cache[name]
+	return data, ok
+}
+
+// read decompresses the content of the file and caches it if the file is
+// cacheable.
+func (s *zipFS) read(name string, f *zip.File, info *memFileInfo) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	if s.cacheable(info) {
+		s.cacheMu.Lock()
+		s.cache[name] = data
+		s.cacheMu.Unlock()
+	}
+	return data, nil
+}
+
+// getIndex returns the index of the archive, reading the central directory if
+// it is not already read.
+func (s *zipFS) getIndex() (*archiveIndex, error) {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	if s.index != nil || s.err != nil {
+		return s.index, s.err
+	}
+	zr, err := zip.NewReader(s.r, s.size)
+	if err != nil {
+		s.err = err
+		return nil, err
+	}
+
+	index := newArchiveIndex()
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		name := strings.TrimSuffix(f.Name, "/")
+		if !fs.ValidPath(name) || name == "." {
+			continue
+		}
+		info := f.FileInfo()
+		mi := &memFileInfo{
+			name:    path.Base(name),
+			size:    info.Size(),
+			mode:    info.Mode(),
+			modTime: info.ModTime(),
+			sys:     &f.FileHeader,
+		}
+		if strings.HasSuffix(f.Name, "/") {
+			mi.mode |= fs.ModeDir
+		}
+		index.add(name, mi)
+		if !mi.mode.IsDir() {
+			files[name] = f
+		}
+	}
+	index.finish()
+
+	s.index = index
+	s.files = files
+	return index, nil
+}
+
+// zipFile is an open compressed file that is decompressed while it is read.
+type zipFile struct {
+	io.ReadCloser
+	info *memFileInfo
+}
+
+func (f *zipFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
@@ -0,0 +1,158 @@
+// Copyright (c) 2021, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsutil_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"resenje.org/fsutil"
+)
+
+func TestZipFS(t *testing.T) {
+	modTime := time.Date(2021, 5, 6, 7, 8, 9, 0, time.UTC)
+	data := newZip(t, modTime, []zipTestFile{
+		{name: "index.html", content: "<html>", method: zip.Deflate},
+		{name: "assets/", mode: fs.ModeDir | 0o750},
+		{name: "assets/main.css", content: "body{}", method: zip.Store},
+		{name: "assets/img/logo.svg", content: "<svg></svg>", method: zip.Deflate},
+		{name: "../evil.txt", content: "evil", method: zip.Store},
+	})
+
+	for _, tc := range []struct {
+		name string
+		opts []fsutil.ZipFSOption
+	}{
+		{name: "default"},
+		{name: "content cache", opts: []fsutil.ZipFSOption{fsutil.WithZipContentCache(1024)}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fsys := fsutil.ZipFS(bytes.NewReader(data), int64(len(data)), tc.opts...)
+
+			if err := fstest.TestFS(fsys, "index.html", "assets/main.css", "assets/img/logo.svg"); err != nil {
+				t.Fatal(err)
+			}
+
+			testOpen(t, fsys, "index.html", "<html>")
+			testOpen(t, fsys, "assets/main.css", "body{}")
+			testOpenNotExist(t, fsys, "evil.txt")
+			testReadFile(t, fsys.(fs.ReadFileFS), "assets/img/logo.svg", "<svg></svg>")
+			testReadFile(t, fsys.(fs.ReadFileFS), "assets/img/logo.svg", "<svg></svg>")
+			testReadFileNotExist(t, fsys.(fs.ReadFileFS), "missing.html")
+			testGlob(t, fsys.(fs.GlobFS), "*/*.css", []string{"assets/main.css"})
+
+			entries, err := fs.ReadDir(fsys, ".")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, e := range entries {
+				names = append(names, e.Name())
+			}
+			if got, want := strings.Join(names, ","), "assets,index.html"; got != want {
+				t.Errorf("got entries %q, want %q", got, want)
+			}
+
+			for _, tc := range []struct {
+				name    string
+				mode    fs.FileMode
+				modTime time.Time
+			}{
+				{name: "index.html", mode: 0o644, modTime: modTime},
+				{name: "assets", mode: fs.ModeDir | 0o750, modTime: modTime},
+				{name: "assets/img", mode: fs.ModeDir | 0o555},
+			} {
+				info, err := fs.Stat(fsys, tc.name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.Mode() != tc.mode {
+					t.Errorf("got %q mode %v, want %v", tc.name, info.Mode(), tc.mode)
+				}
+				if !info.ModTime().Equal(tc.modTime) {
+					t.Errorf("got %q mod time %v, want %v", tc.name, info.ModTime(), tc.modTime)
+				}
+			}
+		})
+	}
+
+	t.Run("seek stored", func(t *testing.T) {
+		fsys := fsutil.ZipFS(bytes.NewReader(data), int64(len(data)))
+
+		f, err := fsys.Open("assets/main.css")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		s, ok := f.(io.ReadSeeker)
+		if !ok {
+			t.Fatal("stored file does not implement io.Seeker")
+		}
+		if _, err := s.Seek(4, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		rest, err := io.ReadAll(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(rest), "{}"; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("invalid archive", func(t *testing.T) {
+		fsys := fsutil.ZipFS(strings.NewReader("not a zip"), 9)
+
+		if _, err := fsys.Open("index.html"); !errors.Is(err, zip.ErrFormat) {
+			t.Errorf("got error %v, want %v", err, zip.ErrFormat)
+		}
+	})
+}
+
+type zipTestFile struct {
+	name    string
+	content string
+	mode    fs.FileMode
+	method  uint16
+}
+
+func newZip(t *testing.T, modTime time.Time, files []zipTestFile) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		h := &zip.FileHeader{
+			Name:     f.name,
+			Method:   f.method,
+			Modified: modTime,
+		}
+		mode := f.mode
+		if mode == 0 {
+			mode = 0o644
+		}
+		h.SetMode(mode)
+		w, err := zw.CreateHeader(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(w, f.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}